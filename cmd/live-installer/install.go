@@ -161,9 +161,23 @@ func install(template *config.ImageTemplate, configDir, localRepo string) error
 		return fmt.Errorf("no target disk path specified in the template")
 	}
 
-	diskPathIdMap, err := imagedisc.DiskPartitionsCreate(diskPath, diskInfo.Partitions, diskInfo.PartitionTableType)
+	// Mirror disks get the same partitions, RAID arrays are assembled from
+	// them and everything else is mounted from the primary disk
+	diskPathIdMaps, err := imagedisc.DiskMirroredPartitionsCreate(diskInfo.TargetPaths(), diskInfo.Partitions, diskInfo.PartitionTableType)
 	if err != nil {
-		return fmt.Errorf("failed to create partitions on disk %s: %w", diskPath, err)
+		return fmt.Errorf("failed to create partitions: %w", err)
+	}
+	if diskInfo.DiskGUID != "" {
+		if err := imagedisc.SetDiskID(diskPath, diskInfo.DiskGUID); err != nil {
+			return fmt.Errorf("failed to set disk GUID: %w", err)
+		}
+	}
+	diskPathIdMap, err := imagedisc.DiskRaidArraysCreate(diskInfo.RaidArrays, diskPathIdMaps)
+	if err != nil {
+		return fmt.Errorf("failed to create RAID arrays: %w", err)
+	}
+	if err := imagedisc.DiskVolumeGroupsCreate(diskInfo.VolumeGroups, diskPathIdMap, nil); err != nil {
+		return fmt.Errorf("failed to create volume groups on disk %s: %w", diskPath, err)
 	}
 
 	// Create ImageOs with template
@@ -179,14 +193,47 @@ func install(template *config.ImageTemplate, configDir, localRepo string) error
 
 	log.Infof("OS installation completed with version: %s", versionInfo)
 
-	if err := updateBootOrder(template, diskPathIdMap); err != nil {
+	if err := syncMirroredBootPartitions(template, diskPathIdMaps); err != nil {
+		return fmt.Errorf("failed to copy boot partitions to mirror disks: %w", err)
+	}
+
+	if err := updateBootOrder(template, diskPathIdMaps); err != nil {
 		return fmt.Errorf("failed to update boot order: %w", err)
 	}
 
 	return nil
 }
 
-func updateBootOrder(template *config.ImageTemplate, diskPathIdMap map[string]string) error {
+// syncMirroredBootPartitions copies the EFI system partition of the primary
+// disk to the mirror disks. The firmware cannot read RAID arrays, so every
+// disk needs its own ESP to remain bootable when the others fail. The copies
+// keep the filesystem UUID the image mounts the ESP by.
+func syncMirroredBootPartitions(template *config.ImageTemplate, diskPathIdMaps []map[string]string) error {
+	if len(diskPathIdMaps) < 2 {
+		return nil
+	}
+	for _, partition := range template.GetDiskConfig().Partitions {
+		if partition.MountPoint != "/boot/efi" {
+			continue
+		}
+		srcDev := diskPathIdMaps[0][partition.ID]
+		for _, mirror := range diskPathIdMaps[1:] {
+			dstDev, ok := mirror[partition.ID]
+			if !ok || srcDev == "" {
+				return fmt.Errorf("EFI boot partition %s not found on every disk", partition.ID)
+			}
+			log.Infof("Copying EFI boot partition %s to %s", srcDev, dstDev)
+			cmdStr := fmt.Sprintf("dd if=%s of=%s bs=4M conv=fsync", srcDev, dstDev)
+			if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil); err != nil {
+				log.Errorf("Failed to copy EFI boot partition to %s: %v", dstDev, err)
+				return fmt.Errorf("failed to copy EFI boot partition to %s: %w", dstDev, err)
+			}
+		}
+	}
+	return nil
+}
+
+func updateBootOrder(template *config.ImageTemplate, diskPathIdMaps []map[string]string) error {
 	if template.SystemConfig.Bootloader.BootType != "efi" {
 		log.Infof("Boot order update skipped: non-UEFI boot type detected")
 		return nil
@@ -196,6 +243,23 @@ func updateBootOrder(template *config.ImageTemplate, diskPathIdMap map[string]st
 		return fmt.Errorf("failed to remove old boot entries: %w", err)
 	}
 
+	// efibootmgr puts new entries first in the boot order, so the mirror
+	// disks are added in reverse before the primary disk
+	mirrorPaths := template.GetDiskConfig().MirrorPaths
+	for i := len(mirrorPaths) - 1; i >= 0; i-- {
+		if i+1 >= len(diskPathIdMaps) {
+			continue
+		}
+		label := fmt.Sprintf("OS Image Composer (disk %d)", i+2)
+		if err := createBootEntry(template, mirrorPaths[i], diskPathIdMaps[i+1], label); err != nil {
+			return fmt.Errorf("failed to create boot entry for disk %s: %w", mirrorPaths[i], err)
+		}
+	}
+
+	var diskPathIdMap map[string]string
+	if len(diskPathIdMaps) > 0 {
+		diskPathIdMap = diskPathIdMaps[0]
+	}
 	if err := createNewBootEntry(template, diskPathIdMap); err != nil {
 		return fmt.Errorf("failed to create new boot entry: %w", err)
 	}
@@ -239,11 +303,17 @@ func removeOldBootEntries() error {
 }
 
 func createNewBootEntry(template *config.ImageTemplate, diskPathIdMap map[string]string) error {
-	diskConfig := template.GetDiskConfig()
-	diskPath := diskConfig.Path
+	diskPath := template.GetDiskConfig().Path
 	if diskPath == "" {
 		return fmt.Errorf("no target disk path specified in the template")
 	}
+	return createBootEntry(template, diskPath, diskPathIdMap, "OS Image Composer")
+}
+
+// createBootEntry adds a UEFI boot entry loading the image from the EFI
+// system partition of diskPath.
+func createBootEntry(template *config.ImageTemplate, diskPath string, diskPathIdMap map[string]string, label string) error {
+	diskConfig := template.GetDiskConfig()
 	var bootPartPath string
 	for diskId, diskPartPath := range diskPathIdMap {
 		for _, partition := range diskConfig.Partitions {
@@ -267,7 +337,7 @@ func createNewBootEntry(template *config.ImageTemplate, diskPathIdMap map[string
 	log.Infof("Creating new boot entry for disk %s partition %s", diskPath, partNum)
 	cmdStr := fmt.Sprintf("efibootmgr --create --disk %s --part %s", diskPath, partNum)
 	cmdStr += " --loader /EFI/BOOT/bootx64.efi"
-	cmdStr += " --label 'OS Image Composer' --verbose"
+	cmdStr += fmt.Sprintf(" --label '%s' --verbose", label)
 
 	if _, err := shell.ExecCmdWithStream(cmdStr, true, shell.HostPath, nil); err != nil {
 		log.Errorf("Failed to create new boot entry: %v", err)
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
 )
 
 func TestNewChrootBuilder_MissingConfigDir(t *testing.T) {
@@ -252,15 +253,82 @@ func TestUpdateBootOrder_NonEFIBoot(t *testing.T) {
 		},
 	}
 
-	diskPathIdMap := make(map[string]string)
+	diskPathIdMaps := []map[string]string{make(map[string]string)}
 
 	// Should return nil for non-EFI boot types
-	err := updateBootOrder(template, diskPathIdMap)
+	err := updateBootOrder(template, diskPathIdMaps)
 	if err != nil {
 		t.Errorf("expected no error for non-EFI boot type, got %v", err)
 	}
 }
 
+func mirroredTestTemplate() *config.ImageTemplate {
+	return &config.ImageTemplate{
+		SystemConfig: config.SystemConfig{
+			Bootloader: config.Bootloader{
+				BootType: "efi",
+			},
+		},
+		Disk: config.DiskConfig{
+			Path:        "/dev/nvme0n1",
+			MirrorPaths: []string{"/dev/nvme1n1"},
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+				{ID: "md-root", FsType: "raid"},
+			},
+			RaidArrays: []config.RaidArrayInfo{
+				{ID: "rootfs", Level: 1, Partition: "md-root", FsType: "ext4", MountPoint: "/"},
+			},
+		},
+	}
+}
+
+func mirroredTestDiskPathIdMaps() []map[string]string {
+	return []map[string]string{
+		{"boot": "/dev/nvme0n1p1", "md-root": "/dev/nvme0n1p2"},
+		{"boot": "/dev/nvme1n1p1", "md-root": "/dev/nvme1n1p2"},
+	}
+}
+
+func TestSyncMirroredBootPartitions(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "dd if=/dev/nvme0n1p1 of=/dev/nvme1n1p1 bs=4M conv=fsync$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := syncMirroredBootPartitions(mirroredTestTemplate(), mirroredTestDiskPathIdMaps()); err != nil {
+		t.Fatalf("syncMirroredBootPartitions failed: %v", err)
+	}
+
+	// A single disk has nothing to copy
+	if err := syncMirroredBootPartitions(mirroredTestTemplate(), mirroredTestDiskPathIdMaps()[:1]); err != nil {
+		t.Fatalf("expected no error for a single disk, got %v", err)
+	}
+
+	diskPathIdMaps := mirroredTestDiskPathIdMaps()
+	delete(diskPathIdMaps[1], "boot")
+	if err := syncMirroredBootPartitions(mirroredTestTemplate(), diskPathIdMaps); err == nil {
+		t.Fatal("expected error when a mirror disk has no EFI boot partition")
+	}
+}
+
+func TestUpdateBootOrder_MirrorDisks(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "efibootmgr$", Output: "BootOrder: 0001\nBoot0001* UEFI Shell\n", Error: nil},
+		{Pattern: "efibootmgr --create --disk /dev/nvme1n1 --part 1 .* --label 'OS Image Composer \\(disk 2\\)'", Output: "", Error: nil},
+		{Pattern: "efibootmgr --create --disk /dev/nvme0n1 --part 1 .* --label 'OS Image Composer' ", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := updateBootOrder(mirroredTestTemplate(), mirroredTestDiskPathIdMaps()); err != nil {
+		t.Fatalf("updateBootOrder failed: %v", err)
+	}
+}
+
 func TestUnattendedInstall_InvalidTemplatePath(t *testing.T) {
 	err := unattendedInstall("/nonexistent/template.yml", "/tmp/repo")
 	if err == nil {
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageprovenance"
 	"github.com/open-edge-platform/os-image-composer/internal/image/isomaker"
 	"github.com/open-edge-platform/os-image-composer/internal/provider"
 	"github.com/open-edge-platform/os-image-composer/internal/provider/azl"
@@ -147,6 +148,10 @@ post:
 		log.Info("image build completed successfully")
 		template.MarkBuildFinished()
 		displayImageBuildTiming(template.Target.ImageType, template)
+
+		if err := writeBuildProvenance(template); err != nil {
+			return fmt.Errorf("generating provenance failed: %v", err)
+		}
 	} else {
 		// Avoid logging the full error chain to prevent potential leakage of sensitive data.
 		// Log only the error type/category to aid debugging without exposing sensitive details.
@@ -156,6 +161,19 @@ post:
 	return buildErr
 }
 
+// writeBuildProvenance records SLSA provenance for the artifacts in the image build directory
+func writeBuildProvenance(template *config.ImageTemplate) error {
+	globalWorkDir, err := config.WorkDir()
+	if err != nil {
+		return fmt.Errorf("failed to get work directory: %w", err)
+	}
+	providerId := system.GetProviderId(template.Target.OS, template.Target.Dist, template.Target.Arch)
+	imageBuildDir := filepath.Join(globalWorkDir, providerId, "imagebuild", template.GetSystemConfigName())
+
+	_, err = imageprovenance.GenerateProvenance(template, imageBuildDir)
+	return err
+}
+
 func displayImageBuildTiming(imageType string, template *config.ImageTemplate) {
 	startToDownloadImagePkgsDuration := template.GetDurationStartToDownloadImagePkgs()
 	chrootPkgDownloadDuration := template.GetChrootPkgDownloadDuration()
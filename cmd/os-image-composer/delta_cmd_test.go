@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageinspect"
+)
+
+// writeDeltaImage writes a raw GPT image with a single root partition holding content
+func writeDeltaImage(t *testing.T, path, content string) {
+	t.Helper()
+	const size = 4 * 1024 * 1024
+	disk, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	if err := disk.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	table := &gpt.Table{
+		LogicalSectorSize:  512,
+		PhysicalSectorSize: 512,
+		ProtectiveMBR:      true,
+		Partitions:         []*gpt.Partition{{Start: 2048, End: 6143, Size: 4096 * 512, Type: gpt.LinuxFilesystem, Name: "rootfs"}},
+	}
+	if err := table.Write(disk, size); err != nil {
+		t.Fatalf("failed to write partition table: %v", err)
+	}
+	if _, err := disk.WriteAt([]byte(content), 2048*512+1024*1024); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func runDelta(t *testing.T, args []string) (string, error) {
+	t.Helper()
+	original := config.Global()
+	global := config.DefaultGlobalConfig()
+	global.TempDir = t.TempDir()
+	config.SetGlobal(global)
+	t.Cleanup(func() { config.SetGlobal(original) })
+
+	origNewInspector := newInspector
+	t.Cleanup(func() { newInspector = origNewInspector })
+	newInspector = func(hash bool) inspector {
+		return &fakeCompareInspector{imgByPath: map[string]*imageinspect.ImageSummary{
+			args[1]: minimalImage(args[1], 4*1024*1024),
+		}}
+	}
+
+	cmd := createDeltaCommand()
+	deltaOutput, deltaPartitions, deltaSkipVerify = "", nil, false
+	deltaChunkSize = 64
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	err := executeDelta(cmd, args)
+	return out.String(), err
+}
+
+func TestDeltaCommand(t *testing.T) {
+	dir := t.TempDir()
+	fromImage := filepath.Join(dir, "edge-1.0.raw")
+	toImage := filepath.Join(dir, "edge-1.1.raw")
+	writeDeltaImage(t, fromImage, "version 1.0")
+	writeDeltaImage(t, toImage, "version 1.1")
+
+	out, err := runDelta(t, []string{fromImage, toImage})
+	if err != nil {
+		t.Fatalf("delta failed: %v", err)
+	}
+	for _, want := range []string{
+		"Delta:      " + filepath.Join(dir, "edge-1.1.delta"),
+		"Chunks:     1 new of 32 (64 KiB each)",
+		"Verified:   partition digests (no verity root hash)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	// The delta directory is not overwritten
+	if _, err := runDelta(t, []string{fromImage, toImage}); err == nil {
+		t.Error("expected an error for an existing delta")
+	}
+	if _, err := runDelta(t, []string{fromImage, filepath.Join(dir, "missing.raw")}); err == nil {
+		t.Error("expected an error for an image that cannot be inspected")
+	}
+}
+
+func TestUKICmdline(t *testing.T) {
+	summary := minimalImage("edge.raw", 0)
+	if got := ukiCmdline(summary); got != "" {
+		t.Errorf("expected no command line, got %q", got)
+	}
+	summary.PartitionTable.Partitions = []imageinspect.PartitionSummary{
+		{Index: 1, Filesystem: &imageinspect.FilesystemSummary{EFIBinaries: []imageinspect.EFIBinaryEvidence{
+			{Path: "EFI/BOOT/BOOTX64.EFI"},
+			{Path: "EFI/Linux/linux.efi", IsUKI: true, Cmdline: "roothash=abcd"},
+		}}},
+	}
+	if got := ukiCmdline(summary); got != "roothash=abcd" {
+		t.Errorf("unexpected command line %q", got)
+	}
+}
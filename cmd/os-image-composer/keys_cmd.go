@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imagesign"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/logger"
+	"github.com/spf13/cobra"
+)
+
+// Keys generate command flags
+var (
+	keysDir        string = ""                       // Key set directory, below the config directory when empty
+	keysCommonName string = ""                       // Common name of the certificates, the key set name when empty
+	keysDays       int    = imagesign.DefaultKeyDays // Certificate validity in days
+)
+
+// createKeysCommand creates the keys subcommand
+func createKeysCommand() *cobra.Command {
+	keysCmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage Secure Boot keys",
+		Long: `Manage the Secure Boot key sets of development and lab devices.
+
+Available commands:
+  generate    Create a PK, KEK and db key set with enrollment files`,
+	}
+
+	keysCmd.AddCommand(createKeysGenerateCommand())
+
+	return keysCmd
+}
+
+// createKeysGenerateCommand creates the keys generate subcommand
+func createKeysGenerateCommand() *cobra.Command {
+	generateCmd := &cobra.Command{
+		Use:   "generate [flags] NAME",
+		Short: "Create a Secure Boot key set",
+		Long: `Generate creates a self-signed Secure Boot key set named NAME for
+development and lab devices: PK, KEK and db key pairs with their certificates
+in PEM (.crt) and DER (.cer) format, EFI signature lists (.esl) and signed
+enrollment files (.auth).
+
+A template uses the key set with systemConfig.immutability.secureBootKeys:
+NAME, which signs the image with the db key. With secureBootEnroll the
+enrollment files are placed on the ESP for systemd-boot to enroll.`,
+		Args: cobra.ExactArgs(1),
+		RunE: executeKeysGenerate,
+	}
+
+	generateCmd.Flags().StringVar(&keysDir, "dir", "",
+		"Key set directory (default: keys/NAME in the configuration directory)")
+	generateCmd.Flags().StringVar(&keysCommonName, "common-name", "",
+		"Common name of the certificates, followed by PK, KEK or db (default: NAME)")
+	generateCmd.Flags().IntVar(&keysDays, "days", imagesign.DefaultKeyDays,
+		"Validity of the certificates in days")
+
+	return generateCmd
+}
+
+// executeKeysGenerate handles the keys generate command execution logic
+func executeKeysGenerate(cmd *cobra.Command, args []string) error {
+	log := logger.Logger()
+	name := args[0]
+
+	dir := keysDir
+	if dir == "" {
+		var err error
+		if dir, err = config.SecureBootKeySetDir(name); err != nil {
+			return err
+		}
+	}
+	commonName := keysCommonName
+	if commonName == "" {
+		commonName = name
+	}
+	log.Infof("Generating secure boot key set %s in %s", name, dir)
+
+	if err := imagesign.GenerateKeySet(dir, commonName, keysDays); err != nil {
+		return fmt.Errorf("key generation failed: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Key set:    %s\n", dir)
+	for _, key := range config.SecureBootKeyNames {
+		fmt.Fprintf(out, "%-11s %s\n", key+":", filepath.Join(dir, key+".{key,crt,cer,esl,auth}"))
+	}
+	if keysDir == "" {
+		fmt.Fprintf(out, "Template:   secureBootKeys: %s\n", name)
+	}
+	return nil
+}
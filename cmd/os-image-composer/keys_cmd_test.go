@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imagesign"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func runKeysGenerate(t *testing.T, args []string, dir string) (string, error) {
+	t.Helper()
+	cmd := createKeysGenerateCommand()
+	keysDir, keysCommonName, keysDays = dir, "", imagesign.DefaultKeyDays
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	err := executeKeysGenerate(cmd, args)
+	return out.String(), err
+}
+
+func TestKeysGenerateCommand(t *testing.T) {
+	original := config.Global()
+	global := config.DefaultGlobalConfig()
+	global.ConfigDir = t.TempDir()
+	config.SetGlobal(global)
+	t.Cleanup(func() { config.SetGlobal(original) })
+
+	originalExecutor := shell.Default
+	t.Cleanup(func() { shell.Default = originalExecutor })
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `^openssl req .* -subj '/CN=lab (PK|KEK|db)/' `, Output: ""},
+		{Pattern: `^(openssl x509|cert-to-efi-sig-list|sign-efi-sig-list) `, Output: ""},
+		{Pattern: ".*", Error: fmt.Errorf("unexpected command")},
+	})
+
+	out, err := runKeysGenerate(t, []string{"lab"}, "")
+	if err != nil {
+		t.Fatalf("keys generate failed: %v", err)
+	}
+	setDir := filepath.Join(global.ConfigDir, "keys", "lab")
+	for _, want := range []string{
+		"Key set:    " + setDir,
+		"db:         " + filepath.Join(setDir, "db.{key,crt,cer,esl,auth}"),
+		"Template:   secureBootKeys: lab",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	// The key set is not overwritten
+	if _, err := runKeysGenerate(t, []string{"lab"}, ""); err == nil {
+		t.Error("expected an error for an existing key set")
+	}
+	if _, err := runKeysGenerate(t, []string{"../lab"}, ""); err == nil {
+		t.Error("expected an error for an invalid key set name")
+	}
+
+	// A key set outside the configuration directory is not referenced by name
+	out, err = runKeysGenerate(t, []string{"lab"}, filepath.Join(t.TempDir(), "lab"))
+	if err != nil {
+		t.Fatalf("keys generate failed: %v", err)
+	}
+	if strings.Contains(out, "Template:") {
+		t.Errorf("unexpected template hint:\n%s", out)
+	}
+}
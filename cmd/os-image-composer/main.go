@@ -112,6 +112,10 @@ The tool supports building custom images for:
 	rootCmd.AddCommand(createInspectCommand())
 	rootCmd.AddCommand(createAICommand())
 	rootCmd.AddCommand(createCompareCommand())
+	rootCmd.AddCommand(createDeltaCommand())
+	rootCmd.AddCommand(createKeysCommand())
+	rootCmd.AddCommand(createVerifyCommand())
+	rootCmd.AddCommand(createVerifyProvenanceCommand())
 
 	// Initialize Cobra's default completion command
 	rootCmd.InitDefaultCompletionCmd()
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/open-edge-platform/os-image-composer/internal/image/artifactsign"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/logger"
+	"github.com/spf13/cobra"
+)
+
+// Verify command flags
+var (
+	verifyKey string = "" // Public key used to verify artifact signatures
+)
+
+// createVerifyCommand creates the verify subcommand
+func createVerifyCommand() *cobra.Command {
+	verifyCmd := &cobra.Command{
+		Use:   "verify [flags] ARTIFACT",
+		Short: "Verify the detached signature of an image artifact",
+		Long: `Verify checks the detached signature written next to a build artifact
+(ARTIFACT.asc for GPG, ARTIFACT.sig for cosign-style keys) and, when present,
+the artifact's entry in the signed SHA256SUMS file of the image build directory.`,
+		Args: cobra.ExactArgs(1),
+		RunE: executeVerify,
+	}
+
+	verifyCmd.Flags().StringVar(&verifyKey, "key", "",
+		"Armored OpenPGP public key (gpg) or PEM public key (cosign)")
+	_ = verifyCmd.MarkFlagRequired("key")
+
+	return verifyCmd
+}
+
+// executeVerify handles the verify command execution logic
+func executeVerify(cmd *cobra.Command, args []string) error {
+	log := logger.Logger()
+	artifact := args[0]
+
+	if verifyKey == "" {
+		return fmt.Errorf("--key is required")
+	}
+	log.Infof("Verifying signature of %s", artifact)
+
+	result, err := artifactsign.VerifyArtifact(artifact, verifyKey)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Artifact:   %s\n", result.Artifact)
+	fmt.Fprintf(out, "SHA256:     %s\n", result.SHA256)
+	fmt.Fprintf(out, "Method:     %s\n", result.Method)
+	if result.SignaturePath != "" {
+		fmt.Fprintf(out, "Signature:  %s (verified)\n", result.SignaturePath)
+	}
+	if result.ChecksumFile != "" {
+		fmt.Fprintf(out, "Checksums:  %s (verified with %s)\n", result.ChecksumFile, result.ChecksumSignature)
+	}
+	fmt.Fprintln(out, "Result:     OK")
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/artifactsign"
+)
+
+func setupSignedArtifact(t *testing.T) (artifact, pubPath string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDER, _ := x509.MarshalPKCS8PrivateKey(priv)
+	pubDER, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	privPath := filepath.Join(dir, "cosign.key")
+	pubPath = filepath.Join(dir, "cosign.pub")
+	if err := os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	buildDir := filepath.Join(dir, "imagebuild")
+	if err := os.MkdirAll(buildDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	artifact = filepath.Join(buildDir, "demo-1.0.qcow2")
+	if err := os.WriteFile(artifact, []byte("image data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	template := &config.ImageTemplate{
+		ArtifactSigning: config.ArtifactSigningConfig{Method: artifactsign.MethodCosign, Key: privPath},
+	}
+	if err := artifactsign.SignArtifacts(template, buildDir); err != nil {
+		t.Fatalf("SignArtifacts failed: %v", err)
+	}
+	return artifact, pubPath
+}
+
+func runVerify(t *testing.T, args []string, key string) (string, error) {
+	t.Helper()
+	oldKey := verifyKey
+	t.Cleanup(func() { verifyKey = oldKey })
+
+	cmd := createVerifyCommand()
+	verifyKey = key
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	err := executeVerify(cmd, args)
+	return out.String(), err
+}
+
+func TestVerifyCommand_Success(t *testing.T) {
+	artifact, pubPath := setupSignedArtifact(t)
+
+	out, err := runVerify(t, []string{artifact}, pubPath)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	for _, want := range []string{"Method:     cosign", "SHA256SUMS", "Result:     OK"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestVerifyCommand_Tampered(t *testing.T) {
+	artifact, pubPath := setupSignedArtifact(t)
+	if err := os.WriteFile(artifact, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runVerify(t, []string{artifact}, pubPath); err == nil {
+		t.Fatal("expected verification failure for tampered artifact")
+	}
+}
+
+func TestVerifyCommand_MissingKey(t *testing.T) {
+	artifact, _ := setupSignedArtifact(t)
+
+	if _, err := runVerify(t, []string{artifact}, ""); err == nil {
+		t.Fatal("expected error without --key")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageprovenance"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/logger"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/security"
+	"github.com/spf13/cobra"
+)
+
+// Verify-provenance command flags
+var (
+	provenanceFile string = "" // Provenance file, discovered next to the artifact when empty
+	provenanceKey  string = "" // Public key used to verify a signed provenance
+)
+
+// createVerifyProvenanceCommand creates the verify-provenance subcommand
+func createVerifyProvenanceCommand() *cobra.Command {
+	verifyCmd := &cobra.Command{
+		Use:   "verify-provenance [flags] ARTIFACT",
+		Short: "Verify an image artifact against its SLSA provenance",
+		Long: `Verify-provenance checks that the digest of a built artifact matches a
+subject recorded in the SLSA provenance written during the build. When a
+public key is given, the DSSE signature of the provenance is verified too.`,
+		Args: cobra.ExactArgs(1),
+		RunE: executeVerifyProvenance,
+	}
+
+	verifyCmd.Flags().StringVar(&provenanceFile, "provenance", "",
+		"Provenance file (default: *"+imageprovenance.FileSuffix+" next to the artifact)")
+	verifyCmd.Flags().StringVar(&provenanceKey, "key", "",
+		"PEM public key or certificate used to verify the provenance signature")
+
+	return verifyCmd
+}
+
+// executeVerifyProvenance handles the verify-provenance command execution logic
+func executeVerifyProvenance(cmd *cobra.Command, args []string) error {
+	log := logger.Logger()
+	artifact := args[0]
+
+	path := provenanceFile
+	if path == "" {
+		found, err := findProvenanceFile(artifact)
+		if err != nil {
+			return err
+		}
+		path = found
+	}
+	log.Infof("Verifying %s against provenance %s", artifact, path)
+
+	data, err := security.SafeReadFile(path, security.RejectSymlinks)
+	if err != nil {
+		return fmt.Errorf("reading provenance: %w", err)
+	}
+
+	statement, envelope, err := imageprovenance.ParseProvenance(data)
+	if err != nil {
+		return err
+	}
+
+	if provenanceKey != "" {
+		if envelope == nil {
+			return fmt.Errorf("provenance %s is not signed", path)
+		}
+		if _, err := imageprovenance.VerifyEnvelope(envelope, provenanceKey); err != nil {
+			return fmt.Errorf("provenance signature verification failed: %w", err)
+		}
+	} else if envelope != nil {
+		log.Warnf("provenance is signed but no --key was given; signature not checked")
+	}
+
+	subject, ok := statement.FindSubject(filepath.Base(artifact))
+	if !ok {
+		return fmt.Errorf("artifact %s is not a subject of %s", filepath.Base(artifact), path)
+	}
+	want := subject.Digest["sha256"]
+	if want == "" {
+		return fmt.Errorf("provenance has no sha256 digest for %s", subject.Name)
+	}
+
+	got, err := imageprovenance.FileSHA256(artifact)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got, want) {
+		return fmt.Errorf("digest mismatch for %s: provenance %s, actual %s", subject.Name, want, got)
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Artifact:   %s\n", artifact)
+	fmt.Fprintf(out, "Provenance: %s\n", path)
+	fmt.Fprintf(out, "Builder:    %s\n", statement.Predicate.RunDetails.Builder.ID)
+	fmt.Fprintf(out, "SHA256:     %s\n", got)
+	if provenanceKey != "" {
+		fmt.Fprintln(out, "Signature:  verified")
+	} else {
+		fmt.Fprintln(out, "Signature:  not checked")
+	}
+	fmt.Fprintln(out, "Result:     OK")
+	return nil
+}
+
+// findProvenanceFile looks for a provenance file in the artifact's directory that lists it as a subject
+func findProvenanceFile(artifact string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(artifact), "*"+imageprovenance.FileSuffix))
+	if err != nil {
+		return "", fmt.Errorf("searching provenance files: %w", err)
+	}
+
+	name := filepath.Base(artifact)
+	for _, match := range matches {
+		data, err := os.ReadFile(match)
+		if err != nil {
+			continue
+		}
+		statement, _, err := imageprovenance.ParseProvenance(data)
+		if err != nil {
+			continue
+		}
+		if _, ok := statement.FindSubject(name); ok {
+			return match, nil
+		}
+	}
+	return "", fmt.Errorf("no provenance file found for %s, use --provenance", artifact)
+}
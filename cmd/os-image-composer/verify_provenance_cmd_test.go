@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageprovenance"
+)
+
+func setupProvenanceFixture(t *testing.T, signed bool) (artifact, pubPath string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	templatePath := filepath.Join(dir, "template.yml")
+	if err := os.WriteFile(templatePath, []byte("image: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	template := &config.ImageTemplate{
+		Image:    config.ImageInfo{Name: "demo", Version: "1.0"},
+		PathList: []string{templatePath},
+	}
+
+	if signed {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		privDER, _ := x509.MarshalPKCS8PrivateKey(priv)
+		pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+		privPath := filepath.Join(dir, "key.pem")
+		pubPath = filepath.Join(dir, "key.pub")
+		if err := os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+			t.Fatal(err)
+		}
+		template.Provenance.SigningKey = privPath
+	}
+
+	buildDir := filepath.Join(dir, "imagebuild")
+	if err := os.MkdirAll(buildDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	artifact = filepath.Join(buildDir, "demo-1.0.raw")
+	if err := os.WriteFile(artifact, []byte("image data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := imageprovenance.GenerateProvenance(template, buildDir); err != nil {
+		t.Fatalf("GenerateProvenance failed: %v", err)
+	}
+	return artifact, pubPath
+}
+
+func runVerifyProvenance(t *testing.T, args []string, provenance, key string) (string, error) {
+	t.Helper()
+	oldFile, oldKey := provenanceFile, provenanceKey
+	t.Cleanup(func() { provenanceFile, provenanceKey = oldFile, oldKey })
+
+	// Flag registration resets the bound variables, so assign them afterwards
+	cmd := createVerifyProvenanceCommand()
+	provenanceFile, provenanceKey = provenance, key
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	err := executeVerifyProvenance(cmd, args)
+	return out.String(), err
+}
+
+func TestVerifyProvenance_Unsigned(t *testing.T) {
+	artifact, _ := setupProvenanceFixture(t, false)
+
+	out, err := runVerifyProvenance(t, []string{artifact}, "", "")
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if !strings.Contains(out, "Result:     OK") || !strings.Contains(out, "not checked") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestVerifyProvenance_Signed(t *testing.T) {
+	artifact, pubPath := setupProvenanceFixture(t, true)
+
+	out, err := runVerifyProvenance(t, []string{artifact}, "", pubPath)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if !strings.Contains(out, "Signature:  verified") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestVerifyProvenance_UnsignedWithKey(t *testing.T) {
+	artifact, _ := setupProvenanceFixture(t, false)
+	_, pubPath := setupProvenanceFixture(t, true)
+
+	if _, err := runVerifyProvenance(t, []string{artifact}, "", pubPath); err == nil {
+		t.Fatal("expected error when requiring a signature on unsigned provenance")
+	}
+}
+
+func TestVerifyProvenance_DigestMismatch(t *testing.T) {
+	artifact, _ := setupProvenanceFixture(t, false)
+	if err := os.WriteFile(artifact, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := runVerifyProvenance(t, []string{artifact}, "", "")
+	if err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Fatalf("expected digest mismatch error, got %v", err)
+	}
+}
+
+func TestVerifyProvenance_NotFound(t *testing.T) {
+	dir := t.TempDir()
+	artifact := filepath.Join(dir, "orphan.raw")
+	if err := os.WriteFile(artifact, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runVerifyProvenance(t, []string{artifact}, "", ""); err == nil {
+		t.Fatal("expected error when no provenance file exists")
+	}
+}
+
+func TestVerifyProvenance_ExplicitFileUnknownSubject(t *testing.T) {
+	artifact, _ := setupProvenanceFixture(t, false)
+	provenance := filepath.Join(filepath.Dir(artifact), "demo"+imageprovenance.FileSuffix)
+
+	other := filepath.Join(t.TempDir(), "other.raw")
+	if err := os.WriteFile(other, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runVerifyProvenance(t, []string{other}, provenance, ""); err == nil {
+		t.Fatal("expected error for artifact not listed in provenance")
+	}
+}
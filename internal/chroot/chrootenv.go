@@ -619,6 +619,16 @@ func (chrootEnv *ChrootEnv) UpdateSystemPkgs(template *config.ImageTemplate) err
 	default:
 		return fmt.Errorf("unsupported bootloader provider: %s", bootloaderConfig.Provider)
 	}
+	// The shim chain starts from the distro's Microsoft signed shim, mokutil
+	// imports the MOK certificate on first boot
+	if bootloaderConfig.IsShimChain() {
+		switch chrootEnv.GetTargetOsPkgType() {
+		case "deb":
+			template.BootloaderPkgList = append(template.BootloaderPkgList, "shim-signed", "mokutil")
+		default:
+			template.BootloaderPkgList = append(template.BootloaderPkgList, "shim", "mokutil")
+		}
+	}
 
 	// Update kernel packages by kernel version
 	kernelConfig := template.GetKernel()
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	chroot "github.com/open-edge-platform/os-image-composer/internal/chroot"
@@ -812,6 +813,28 @@ func TestChrootEnv_UpdateSystemPkgs(t *testing.T) {
 	}
 }
 
+func TestChrootEnv_UpdateSystemPkgsShimChain(t *testing.T) {
+	for pkgType, want := range map[string][]string{
+		"deb": {"shim-signed", "mokutil"},
+		"rpm": {"shim", "mokutil"},
+	} {
+		chrootEnv := &chroot.ChrootEnv{
+			ChrootBuilder: &mockChrootBuilder{pkgType: pkgType, tempDir: t.TempDir()},
+		}
+		template := &config.ImageTemplate{
+			SystemConfig: config.SystemConfig{
+				Bootloader: config.Bootloader{Provider: "systemd-boot", BootType: "efi", Chain: config.BootChainShim},
+			},
+		}
+		if err := chrootEnv.UpdateSystemPkgs(template); err != nil {
+			t.Fatalf("UpdateSystemPkgs failed: %v", err)
+		}
+		if !reflect.DeepEqual(template.BootloaderPkgList, want) {
+			t.Errorf("%s: expected bootloader packages %v, got %v", pkgType, want, template.BootloaderPkgList)
+		}
+	}
+}
+
 func TestChrootEnv_UpdateChrootLocalRepoMetadata_Success(t *testing.T) {
 	tempDir := t.TempDir()
 	mockBuilder := &mockChrootBuilder{tempDir: tempDir}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+)
+
+// BootEntry is an entry of the boot menu: a kernel of the image booted with
+// the kernel command line of the image and extra arguments
+type BootEntry struct {
+	ID      string `yaml:"id"`                // ID: entry name, the UKI file name with systemd-boot and the menu entry ID with GRUB
+	Title   string `yaml:"title,omitempty"`   // Title: shown in the boot menu, the ID when empty
+	Kernel  string `yaml:"kernel,omitempty"`  // Kernel: glob matching the release of the kernel booted (e.g. "*-rt*"), the default kernel when empty
+	Cmdline string `yaml:"cmdline,omitempty"` // Cmdline: arguments appended to the kernel command line of the image
+}
+
+// maxBootTimeout is the longest boot menu timeout in seconds
+const maxBootTimeout = 600
+
+// bootEntryIDPattern matches IDs usable as file names on the ESP and as GRUB
+// menu entry IDs
+var bootEntryIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// bootEntryTextPattern matches titles and command lines that need no quoting
+// in the GRUB configuration and the ukify command line
+var bootEntryTextPattern = regexp.MustCompile(`^[^'"$` + "`" + `\\\n]*$`)
+
+// GetTitle returns the title of the boot entry in the boot menu.
+func (e BootEntry) GetTitle() string {
+	if e.Title != "" {
+		return e.Title
+	}
+	return e.ID
+}
+
+// GetBootEntries returns the boot entries of the image, none when the image
+// boots the default kernel with the kernel command line only.
+func (t *ImageTemplate) GetBootEntries() []BootEntry {
+	return t.SystemConfig.Kernel.BootEntries
+}
+
+// DefaultBootEntry returns the ID of the boot entry booted by default, empty
+// without boot entries.
+func (t *ImageTemplate) DefaultBootEntry() string {
+	if id := t.SystemConfig.Bootloader.DefaultEntry; id != "" {
+		return id
+	}
+	if entries := t.GetBootEntries(); len(entries) > 0 {
+		return entries[0].ID
+	}
+	return ""
+}
+
+func validateBootEntries(entries []BootEntry) error {
+	ids := make(map[string]bool)
+	for _, entry := range entries {
+		if !bootEntryIDPattern.MatchString(entry.ID) {
+			return fmt.Errorf("invalid boot entry ID '%s'", entry.ID)
+		}
+		if ids[entry.ID] {
+			return fmt.Errorf("duplicate boot entry ID '%s'", entry.ID)
+		}
+		ids[entry.ID] = true
+		if !bootEntryTextPattern.MatchString(entry.Title) {
+			return fmt.Errorf("boot entry %s: the title must not contain quotes, '$', '`' or '\\'", entry.ID)
+		}
+		if !bootEntryTextPattern.MatchString(entry.Cmdline) {
+			return fmt.Errorf("boot entry %s: the cmdline must not contain quotes, '$', '`' or '\\'", entry.ID)
+		}
+		if _, err := filepath.Match(entry.Kernel, ""); err != nil {
+			return fmt.Errorf("boot entry %s: invalid kernel pattern '%s'", entry.ID, entry.Kernel)
+		}
+	}
+	return nil
+}
+
+func (b Bootloader) validateMenu() error {
+	if b.Timeout != nil && (*b.Timeout < 0 || *b.Timeout > maxBootTimeout) {
+		return fmt.Errorf("bootloader timeout %d is out of range 0-%d", *b.Timeout, maxBootTimeout)
+	}
+	return nil
+}
+
+// validateBootEntries checks the boot menu of the merged template: the
+// default entry is one of the boot entries, which the A/B slots do not
+// support.
+func (t *ImageTemplate) validateBootEntries() error {
+	entries := t.GetBootEntries()
+	bootloader := t.GetBootloaderConfig()
+	if bootloader.DefaultEntry != "" {
+		found := false
+		for _, entry := range entries {
+			found = found || entry.ID == bootloader.DefaultEntry
+		}
+		if !found {
+			return fmt.Errorf("default boot entry '%s' is not one of the boot entries", bootloader.DefaultEntry)
+		}
+	}
+	if t.IsABUpdate() && (len(entries) > 0 || bootloader.Timeout != nil) {
+		return fmt.Errorf("boot entries and the bootloader timeout are not supported with A/B updates")
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestParseYAMLTemplateBootEntries(t *testing.T) {
+	base := `image:
+  name: lab
+  version: "1.0"
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: lab
+`
+	template, err := parseYAMLTemplate([]byte(base+`  bootloader:
+    timeout: 5
+    defaultEntry: rt
+  kernel:
+    bootEntries:
+      - id: production
+        title: Production
+      - id: rt
+        kernel: "*-rt*"
+        cmdline: isolcpus=2-3
+`), false)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed: %v", err)
+	}
+	entries := template.GetBootEntries()
+	if len(entries) != 2 || entries[1].Kernel != "*-rt*" || entries[1].GetTitle() != "rt" || entries[0].GetTitle() != "Production" {
+		t.Errorf("unexpected boot entries %+v", entries)
+	}
+	if timeout := template.SystemConfig.Bootloader.Timeout; timeout == nil || *timeout != 5 {
+		t.Errorf("unexpected timeout %v", timeout)
+	}
+	if id := template.DefaultBootEntry(); id != "rt" {
+		t.Errorf("expected default entry rt, got %q", id)
+	}
+
+	for _, invalid := range []string{
+		"  bootloader:\n    timeout: 601\n",
+		"  bootloader:\n    timeout: -1\n",
+		"  kernel:\n    bootEntries:\n      - id: Production\n",
+		"  kernel:\n    bootEntries:\n      - id: debug\n      - id: debug\n",
+		"  kernel:\n    bootEntries:\n      - id: debug\n        cmdline: \"init=$(reboot)\"\n",
+		"  kernel:\n    bootEntries:\n      - id: debug\n        title: \"it's\"\n",
+		"  kernel:\n    bootEntries:\n      - id: debug\n        kernel: \"[\"\n",
+	} {
+		if _, err := parseYAMLTemplate([]byte(base+invalid), false); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestValidateBootEntries(t *testing.T) {
+	template := &ImageTemplate{}
+	if id := template.DefaultBootEntry(); id != "" {
+		t.Errorf("expected no default entry, got %q", id)
+	}
+	if err := template.validateBootEntries(); err != nil {
+		t.Errorf("validateBootEntries failed without boot entries: %v", err)
+	}
+
+	template.SystemConfig.Kernel.BootEntries = []BootEntry{{ID: "production"}, {ID: "recovery"}}
+	if id := template.DefaultBootEntry(); id != "production" {
+		t.Errorf("expected the first entry by default, got %q", id)
+	}
+	template.SystemConfig.Bootloader.DefaultEntry = "debug"
+	if err := template.validateBootEntries(); err == nil {
+		t.Error("expected an error for an unknown default entry")
+	}
+	template.SystemConfig.Bootloader.DefaultEntry = "recovery"
+	if err := template.validateBootEntries(); err != nil {
+		t.Errorf("validateBootEntries failed: %v", err)
+	}
+
+	template.Updates = UpdatesConfig{Scheme: UpdateSchemeAB}
+	if err := template.validateBootEntries(); err == nil {
+		t.Error("expected an error for boot entries with A/B updates")
+	}
+}
+
+func TestMergeBootEntries(t *testing.T) {
+	timeout := 3
+	defaultTemplate := &ImageTemplate{
+		Image:  ImageInfo{Name: "default", Version: "1.0"},
+		Target: TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64", ImageType: "raw"},
+		SystemConfig: SystemConfig{
+			Name:       "default",
+			Bootloader: Bootloader{BootType: "efi", Provider: "grub", Timeout: &timeout},
+			Kernel:     KernelConfig{Version: "6.8", BootEntries: []BootEntry{{ID: "production"}, {ID: "recovery", Cmdline: "single"}}},
+		},
+	}
+	userTemplate := &ImageTemplate{
+		Image:        ImageInfo{Name: "lab", Version: "1.0"},
+		Target:       defaultTemplate.Target,
+		SystemConfig: SystemConfig{Name: "lab", Bootloader: Bootloader{DefaultEntry: "recovery"}},
+	}
+
+	merged, err := MergeConfigurations(userTemplate, defaultTemplate)
+	if err != nil {
+		t.Fatalf("MergeConfigurations failed: %v", err)
+	}
+	if len(merged.GetBootEntries()) != 2 || merged.DefaultBootEntry() != "recovery" {
+		t.Errorf("expected the default boot entries, got %+v", merged.SystemConfig.Kernel.BootEntries)
+	}
+	if merged.SystemConfig.Bootloader.Timeout == nil || *merged.SystemConfig.Bootloader.Timeout != 3 || merged.SystemConfig.Bootloader.Provider != "grub" {
+		t.Errorf("unexpected merged bootloader %+v", merged.SystemConfig.Bootloader)
+	}
+
+	// The user boot entries replace the default ones
+	userTemplate.SystemConfig.Kernel.BootEntries = []BootEntry{{ID: "rt", Kernel: "*-rt"}}
+	userTemplate.SystemConfig.Bootloader.DefaultEntry = ""
+	merged, err = MergeConfigurations(userTemplate, defaultTemplate)
+	if err != nil {
+		t.Fatalf("MergeConfigurations failed: %v", err)
+	}
+	if entries := merged.GetBootEntries(); len(entries) != 1 || entries[0].ID != "rt" || merged.SystemConfig.Kernel.Version != "6.8" {
+		t.Errorf("expected the user boot entries, got %+v", merged.SystemConfig.Kernel)
+	}
+
+	userTemplate.SystemConfig.Bootloader.DefaultEntry = "recovery"
+	if _, err := MergeConfigurations(userTemplate, defaultTemplate); err == nil {
+		t.Error("expected an error for a default entry replaced by the user boot entries")
+	}
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CmdlineFragments holds the kernel arguments of the image by purpose. The
+// fragments of the user template are appended to those of the default
+// configuration, whose arguments remove takes out first.
+type CmdlineFragments struct {
+	Console  []string `yaml:"console,omitempty"`  // Console: console= and earlycon arguments
+	Security []string `yaml:"security,omitempty"` // Security: LSM, lockdown and mitigation arguments
+	Debug    []string `yaml:"debug,omitempty"`    // Debug: log level and debugging arguments
+	Custom   []string `yaml:"custom,omitempty"`   // Custom: any other argument
+	Remove   []string `yaml:"remove,omitempty"`   // Remove: default arguments dropped, by name ("quiet", "console") or as a whole ("console=tty0")
+}
+
+// cmdlineArgPattern matches a single kernel argument that needs no quoting in
+// the GRUB configuration and the ukify command line
+var cmdlineArgPattern = regexp.MustCompile(`^[^\s'"$` + "`" + `\\]+$`)
+
+// cmdlineSource is a list of kernel arguments set in one place of a template,
+// which may repeat an argument name (e.g. console=ttyS0 console=tty0)
+type cmdlineSource struct {
+	name string
+	args []string
+}
+
+// cmdlineArgName returns the name of a kernel argument, the part before "="
+func cmdlineArgName(arg string) string {
+	name, _, _ := strings.Cut(arg, "=")
+	return name
+}
+
+// args returns the arguments of the fragments in command line order.
+func (f CmdlineFragments) args() []string {
+	var args []string
+	for _, fragment := range [][]string{f.Console, f.Security, f.Debug, f.Custom} {
+		args = append(args, fragment...)
+	}
+	return args
+}
+
+// cmdlineSources returns the arguments of the kernel configuration by place,
+// prefixing the place names with origin
+func (k KernelConfig) cmdlineSources(origin string) []cmdlineSource {
+	f := k.CmdlineFragments
+	return []cmdlineSource{
+		{name: origin + "cmdline", args: strings.Fields(k.Cmdline)},
+		{name: origin + "console fragment", args: f.Console},
+		{name: origin + "security fragment", args: f.Security},
+		{name: origin + "debug fragment", args: f.Debug},
+		{name: origin + "custom fragment", args: f.Custom},
+	}
+}
+
+// GetKernelCmdline returns the kernel command line of the image: cmdline
+// followed by the console, security, debug and custom fragments.
+func (t *ImageTemplate) GetKernelCmdline() string {
+	kernel := t.SystemConfig.Kernel
+	args := strings.Fields(kernel.Cmdline)
+	for _, arg := range kernel.CmdlineFragments.args() {
+		if !containsArg(args, arg) {
+			args = append(args, arg)
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+func containsArg(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+// removeCmdlineArgs drops the arguments matching an entry of remove, by name
+// or as a whole
+func removeCmdlineArgs(args, remove []string) []string {
+	var kept []string
+	for _, arg := range args {
+		removed := false
+		for _, r := range remove {
+			if arg == r || (!strings.Contains(r, "=") && cmdlineArgName(arg) == r) {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			kept = append(kept, arg)
+		}
+	}
+	return kept
+}
+
+// appendCmdlineArgs appends the arguments missing from args
+func appendCmdlineArgs(args, extra []string) []string {
+	var merged []string
+	merged = append(merged, args...)
+	for _, arg := range extra {
+		if !containsArg(merged, arg) {
+			merged = append(merged, arg)
+		}
+	}
+	return merged
+}
+
+// checkCmdlineConflicts reports an argument set with different values in two
+// places. Identical arguments are merged instead.
+func checkCmdlineConflicts(sources []cmdlineSource) error {
+	type setting struct {
+		arg    string
+		source string
+	}
+	seen := make(map[string]setting)
+	for _, source := range sources {
+		for _, arg := range source.args {
+			name := cmdlineArgName(arg)
+			first, ok := seen[name]
+			if !ok {
+				seen[name] = setting{arg: arg, source: source.name}
+				continue
+			}
+			if first.source != source.name && !containsArg(argsOf(sources, first.source), arg) {
+				return fmt.Errorf("kernel argument '%s' of the %s conflicts with '%s' of the %s", arg, source.name, first.arg, first.source)
+			}
+		}
+	}
+	return nil
+}
+
+func argsOf(sources []cmdlineSource, name string) []string {
+	for _, source := range sources {
+		if source.name == name {
+			return source.args
+		}
+	}
+	return nil
+}
+
+func (f CmdlineFragments) validate() error {
+	for _, arg := range append(f.args(), f.Remove...) {
+		if !cmdlineArgPattern.MatchString(arg) {
+			return fmt.Errorf("invalid kernel argument '%s': one argument without spaces, quotes, '$', '`' or '\\' per entry", arg)
+		}
+	}
+	return nil
+}
+
+// validateCmdline checks the kernel arguments of a template on its own
+func (k KernelConfig) validateCmdline() error {
+	if err := k.CmdlineFragments.validate(); err != nil {
+		return err
+	}
+	return checkCmdlineConflicts(k.cmdlineSources(""))
+}
+
+// mergeKernelCmdline merges the command line fragments of the user into the
+// default ones, once the arguments the user removes are gone from the
+// default cmdline and fragments. A user cmdline replaces the default one.
+func mergeKernelCmdline(defaultKernel, userKernel KernelConfig) (string, CmdlineFragments) {
+	remove := userKernel.CmdlineFragments.Remove
+	cmdline := strings.Join(removeCmdlineArgs(strings.Fields(defaultKernel.Cmdline), remove), " ")
+	if userKernel.Cmdline != "" {
+		cmdline = userKernel.Cmdline
+	}
+
+	d, u := defaultKernel.CmdlineFragments, userKernel.CmdlineFragments
+	return cmdline, CmdlineFragments{
+		Console:  appendCmdlineArgs(removeCmdlineArgs(d.Console, remove), u.Console),
+		Security: appendCmdlineArgs(removeCmdlineArgs(d.Security, remove), u.Security),
+		Debug:    appendCmdlineArgs(removeCmdlineArgs(d.Debug, remove), u.Debug),
+		Custom:   appendCmdlineArgs(removeCmdlineArgs(d.Custom, remove), u.Custom),
+	}
+}
+
+// checkKernelCmdlineMerge reports a user argument conflicting with a default
+// one the user does not remove
+func checkKernelCmdlineMerge(defaultKernel, userKernel KernelConfig) error {
+	remove := userKernel.CmdlineFragments.Remove
+	var sources []cmdlineSource
+	for _, source := range defaultKernel.cmdlineSources("default ") {
+		// A user cmdline replaces the default one
+		if source.name == "default cmdline" && userKernel.Cmdline != "" {
+			continue
+		}
+		sources = append(sources, cmdlineSource{name: source.name, args: removeCmdlineArgs(source.args, remove)})
+	}
+	sources = append(sources, userKernel.cmdlineSources("")...)
+	if err := checkCmdlineConflicts(sources); err != nil {
+		return fmt.Errorf("%w; drop the default with cmdlineFragments.remove", err)
+	}
+	return nil
+}
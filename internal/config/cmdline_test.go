@@ -0,0 +1,150 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseYAMLTemplateCmdlineFragments(t *testing.T) {
+	base := `image:
+  name: lab
+  version: "1.0"
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: lab
+  kernel:
+`
+	template, err := parseYAMLTemplate([]byte(base+`    cmdline: "quiet"
+    cmdlineFragments:
+      console: ["console=ttyS0,115200", "console=tty0"]
+      security: ["lockdown=integrity"]
+      debug: ["loglevel=7"]
+      custom: ["quiet", "nosmt"]
+`), false)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed: %v", err)
+	}
+	want := "quiet console=ttyS0,115200 console=tty0 lockdown=integrity loglevel=7 nosmt"
+	if got := template.GetKernelCmdline(); got != want {
+		t.Errorf("expected cmdline %q, got %q", want, got)
+	}
+
+	for _, invalid := range []string{
+		"    cmdlineFragments:\n      console: [\"console=ttyS0 console=tty0\"]\n",
+		"    cmdlineFragments:\n      custom: [\"init=$(reboot)\"]\n",
+		"    cmdlineFragments:\n      remove: [\"\"]\n",
+		"    cmdline: \"console=ttyS0\"\n    cmdlineFragments:\n      console: [\"console=ttyS1\"]\n",
+		"    cmdlineFragments:\n      debug: [\"loglevel=7\"]\n      custom: [\"loglevel=3\"]\n",
+	} {
+		if _, err := parseYAMLTemplate([]byte(base+invalid), false); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestCheckCmdlineConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []cmdlineSource
+		wantErr string
+	}{
+		{
+			name:    "repeated name in one place",
+			sources: []cmdlineSource{{name: "cmdline", args: []string{"console=ttyS0", "console=tty0"}}},
+		},
+		{
+			name: "identical argument in two places",
+			sources: []cmdlineSource{
+				{name: "cmdline", args: []string{"console=ttyS0", "console=tty0"}},
+				{name: "console fragment", args: []string{"console=tty0"}},
+			},
+		},
+		{
+			name: "different values in two places",
+			sources: []cmdlineSource{
+				{name: "cmdline", args: []string{"console=ttyS0"}},
+				{name: "console fragment", args: []string{"console=ttyS1"}},
+			},
+			wantErr: "'console=ttyS1' of the console fragment conflicts with 'console=ttyS0' of the cmdline",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCmdlineConflicts(tt.sources)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMergeCmdlineFragments(t *testing.T) {
+	defaultTemplate := &ImageTemplate{
+		Image:  ImageInfo{Name: "default", Version: "1.0"},
+		Target: TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64", ImageType: "raw"},
+		SystemConfig: SystemConfig{
+			Name: "default",
+			Kernel: KernelConfig{
+				Cmdline: "quiet console=ttyS0,115200 console=tty0 loglevel=7",
+				CmdlineFragments: CmdlineFragments{
+					Security: []string{"apparmor=1"},
+				},
+			},
+		},
+	}
+	userTemplate := &ImageTemplate{
+		Image:  ImageInfo{Name: "lab", Version: "1.0"},
+		Target: defaultTemplate.Target,
+		SystemConfig: SystemConfig{Name: "lab", Kernel: KernelConfig{CmdlineFragments: CmdlineFragments{
+			Security: []string{"apparmor=1", "lockdown=integrity"},
+			Custom:   []string{"nosmt"},
+		}}},
+	}
+
+	// Fragments are appended to the defaults, identical arguments once
+	merged, err := MergeConfigurations(userTemplate, defaultTemplate)
+	if err != nil {
+		t.Fatalf("MergeConfigurations failed: %v", err)
+	}
+	want := "quiet console=ttyS0,115200 console=tty0 loglevel=7 apparmor=1 lockdown=integrity nosmt"
+	if got := merged.GetKernelCmdline(); got != want {
+		t.Errorf("expected cmdline %q, got %q", want, got)
+	}
+
+	// A console of the user conflicts with the default consoles
+	userTemplate.SystemConfig.Kernel.CmdlineFragments.Console = []string{"console=ttyS1,115200"}
+	if _, err := MergeConfigurations(userTemplate, defaultTemplate); err == nil || !strings.Contains(err.Error(), "cmdlineFragments.remove") {
+		t.Errorf("expected a console conflict, got %v", err)
+	}
+
+	// unless the defaults are removed
+	userTemplate.SystemConfig.Kernel.CmdlineFragments.Remove = []string{"console", "quiet", "loglevel=7", "apparmor=1"}
+	merged, err = MergeConfigurations(userTemplate, defaultTemplate)
+	if err != nil {
+		t.Fatalf("MergeConfigurations failed: %v", err)
+	}
+	want = "console=ttyS1,115200 apparmor=1 lockdown=integrity nosmt"
+	if got := merged.GetKernelCmdline(); got != want {
+		t.Errorf("expected cmdline %q, got %q", want, got)
+	}
+	if len(merged.SystemConfig.Kernel.CmdlineFragments.Remove) != 0 {
+		t.Errorf("expected the removals to be applied, got %v", merged.SystemConfig.Kernel.CmdlineFragments.Remove)
+	}
+
+	// A user cmdline still replaces the default one
+	userTemplate.SystemConfig.Kernel = KernelConfig{Cmdline: "console=ttyS2"}
+	merged, err = MergeConfigurations(userTemplate, defaultTemplate)
+	if err != nil {
+		t.Fatalf("MergeConfigurations failed: %v", err)
+	}
+	if got := merged.GetKernelCmdline(); got != "console=ttyS2 apparmor=1" {
+		t.Errorf("unexpected cmdline %q", got)
+	}
+}
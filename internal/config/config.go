@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,8 +20,9 @@ import (
 )
 
 type ImageInfo struct {
-	Name    string `yaml:"name"`
-	Version string `yaml:"version"`
+	Name         string `yaml:"name"`
+	Version      string `yaml:"version"`
+	Reproducible bool   `yaml:"reproducible,omitempty"`
 }
 
 type TargetInfo struct {
@@ -34,12 +38,188 @@ type ArtifactInfo struct {
 }
 
 type DiskConfig struct {
-	Name               string          `yaml:"name"`
-	Path               string          `yaml:"path"` // Path to the disk device (e.g., /dev/sda), used by live installer
-	Artifacts          []ArtifactInfo  `yaml:"artifacts"`
-	Size               string          `yaml:"size"`
-	PartitionTableType string          `yaml:"partitionTableType"`
-	Partitions         []PartitionInfo `yaml:"partitions"`
+	Name               string            `yaml:"name"`
+	Path               string            `yaml:"path"`                  // Path to the disk device (e.g., /dev/sda), used by live installer
+	MirrorPaths        []string          `yaml:"mirrorPaths,omitempty"` // Additional disks receiving the same partition layout, used by live installer
+	Artifacts          []ArtifactInfo    `yaml:"artifacts"`
+	Size               string            `yaml:"size"`
+	PartitionTableType string            `yaml:"partitionTableType"`
+	Partitions         []PartitionInfo   `yaml:"partitions"`
+	VolumeGroups       []VolumeGroupInfo `yaml:"volumeGroups,omitempty"` // LVM volume groups built on partitions with fsType lvm
+	RaidArrays         []RaidArrayInfo   `yaml:"raidArrays,omitempty"`   // Software RAID arrays built on partitions with fsType raid
+	Builder            string            `yaml:"builder,omitempty"`      // Builder: how raw images are assembled, "loop" (default) or "loopless"
+	Shrink             bool              `yaml:"shrink,omitempty"`       // Shrink: trim the raw image to the end of its last partition
+	GrowRoot           bool              `yaml:"growRoot,omitempty"`     // GrowRoot: grow the root partition and filesystem to fill the disk on first boot
+	DiskGUID           string            `yaml:"diskGUID,omitempty"`     // DiskGUID: GPT disk GUID; derived for reproducible builds, random otherwise, when empty
+	HybridMBR          []string          `yaml:"hybridMBR,omitempty"`    // HybridMBR: IDs of up to 3 partitions also listed in a hybrid MBR for legacy BIOS boot
+}
+
+// Raw image builders
+const (
+	// DiskBuilderLoop partitions and formats a loop device, then installs
+	// the OS onto the mounted partitions
+	DiskBuilderLoop = "loop"
+	// DiskBuilderLoopless installs the OS into a directory, then builds each
+	// filesystem as an image file and assembles the disk from them, without
+	// loop devices or mounting its partitions
+	DiskBuilderLoopless = "loopless"
+)
+
+// IsLoopless reports whether raw images of the disk are assembled from
+// filesystem images instead of through a loop device.
+func (d DiskConfig) IsLoopless() bool {
+	return d.Builder == DiskBuilderLoopless
+}
+
+// IsAutoSized reports whether the disk size is computed from the installed
+// content.
+func (d DiskConfig) IsAutoSized() bool {
+	auto, _, _ := ParseAutoSize(d.Size)
+	return auto
+}
+
+// IsAutoSizedPartition reports whether the size of partition is computed from
+// its content. With an automatic disk size, the rest partition is as well.
+func (d DiskConfig) IsAutoSizedPartition(partition PartitionInfo) bool {
+	if partition.Size == "rest" {
+		return d.IsAutoSized()
+	}
+	auto, _, _ := ParseAutoSize(partition.Size)
+	return auto
+}
+
+// IsReadOnlyFsType reports whether fsType is a read-only filesystem, built in
+// one go from the complete content of its mount point.
+func IsReadOnlyFsType(fsType string) bool {
+	return fsType == "squashfs" || fsType == "erofs"
+}
+
+// ReadOnlyRoot returns the root partition when it holds a read-only
+// filesystem.
+func (d DiskConfig) ReadOnlyRoot() (PartitionInfo, bool) {
+	for _, partition := range d.Partitions {
+		if partition.MountPoint == "/" && IsReadOnlyFsType(partition.FsType) {
+			return partition, true
+		}
+	}
+	return PartitionInfo{}, false
+}
+
+// RaidArrayInfo describes an md software RAID array assembled from the same
+// partition on every target disk. Arrays share the ID namespace of
+// partitions, so they can be referenced the same way.
+type RaidArrayInfo struct {
+	ID           string `yaml:"id"`                     // ID: unique identifier for the array
+	Name         string `yaml:"name,omitempty"`         // Name: md array name, the device is /dev/md/<name>; defaults to the ID
+	Level        int    `yaml:"level"`                  // Level: RAID level (0, 1, 5, 6 or 10)
+	Partition    string `yaml:"partition"`              // Partition: ID of the member partition, created on every target disk
+	Metadata     string `yaml:"metadata,omitempty"`     // Metadata: md superblock version; defaults to "1.2"
+	FsType       string `yaml:"fsType"`                 // FsType: filesystem type (e.g., "ext4", "xfs")
+	FsLabel      string `yaml:"fsLabel,omitempty"`      // FsLabel: filesystem label
+	MountPoint   string `yaml:"mountPoint,omitempty"`   // MountPoint: optional mount point for the array
+	MountOptions string `yaml:"mountOptions,omitempty"` // MountOptions: optional mount options for the array
+}
+
+// MDName returns the md array name
+func (r RaidArrayInfo) MDName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.ID
+}
+
+// TargetPaths returns the disks the live installer writes the partition
+// layout to: the primary disk followed by its mirrors.
+func (d DiskConfig) TargetPaths() []string {
+	if d.Path == "" {
+		return nil
+	}
+	return append([]string{d.Path}, d.MirrorPaths...)
+}
+
+// RaidArrayOf returns the RAID array with the given ID, or nil when the ID is
+// not an array.
+func (d DiskConfig) RaidArrayOf(id string) *RaidArrayInfo {
+	for i := range d.RaidArrays {
+		if d.RaidArrays[i].ID == id {
+			return &d.RaidArrays[i]
+		}
+	}
+	return nil
+}
+
+// VolumeGroupInfo describes an LVM volume group and its logical volumes
+type VolumeGroupInfo struct {
+	Name            string              `yaml:"name"`            // Name: volume group name (e.g., "vg0")
+	PhysicalVolumes []string            `yaml:"physicalVolumes"` // PhysicalVolumes: IDs of the partitions used as physical volumes
+	LogicalVolumes  []LogicalVolumeInfo `yaml:"logicalVolumes"`  // LogicalVolumes: logical volumes created in the group, in order
+}
+
+// LogicalVolumeInfo describes an LVM logical volume. Logical volumes share the
+// ID namespace of partitions, so they can be referenced the same way.
+type LogicalVolumeInfo struct {
+	ID           string `yaml:"id"`                     // ID: unique identifier for the logical volume
+	Name         string `yaml:"name,omitempty"`         // Name: logical volume name; defaults to the ID
+	Size         string `yaml:"size"`                   // Size: absolute size (e.g., "4GiB"), share of the group (e.g., "25%") or "0" for the remaining space
+	FsType       string `yaml:"fsType"`                 // FsType: filesystem type (e.g., "ext4", "xfs")
+	FsLabel      string `yaml:"fsLabel,omitempty"`      // FsLabel: filesystem label
+	MountPoint   string `yaml:"mountPoint,omitempty"`   // MountPoint: optional mount point for the logical volume
+	MountOptions string `yaml:"mountOptions,omitempty"` // MountOptions: optional mount options for the logical volume
+}
+
+// LVName returns the name of the logical volume inside its volume group
+func (lv LogicalVolumeInfo) LVName() string {
+	if lv.Name != "" {
+		return lv.Name
+	}
+	return lv.ID
+}
+
+// GetVolumes returns the partitions of the disk followed by its RAID arrays
+// and LVM logical volumes, each described as a partition, so that code mapping
+// IDs to mount points handles all of them the same way.
+func (d DiskConfig) GetVolumes() []PartitionInfo {
+	if len(d.VolumeGroups) == 0 && len(d.RaidArrays) == 0 {
+		return d.Partitions
+	}
+	volumes := make([]PartitionInfo, 0, len(d.Partitions))
+	volumes = append(volumes, d.Partitions...)
+	for _, array := range d.RaidArrays {
+		volumes = append(volumes, PartitionInfo{
+			Name:         array.MDName(),
+			ID:           array.ID,
+			FsType:       array.FsType,
+			FsLabel:      array.FsLabel,
+			MountPoint:   array.MountPoint,
+			MountOptions: array.MountOptions,
+		})
+	}
+	for _, vg := range d.VolumeGroups {
+		for _, lv := range vg.LogicalVolumes {
+			volumes = append(volumes, PartitionInfo{
+				Name:         lv.LVName(),
+				ID:           lv.ID,
+				FsType:       lv.FsType,
+				FsLabel:      lv.FsLabel,
+				MountPoint:   lv.MountPoint,
+				MountOptions: lv.MountOptions,
+			})
+		}
+	}
+	return volumes
+}
+
+// VolumeGroupOf returns the volume group holding the logical volume with the
+// given ID, or nil when the ID is not a logical volume.
+func (d DiskConfig) VolumeGroupOf(id string) *VolumeGroupInfo {
+	for i := range d.VolumeGroups {
+		for _, lv := range d.VolumeGroups[i].LogicalVolumes {
+			if lv.ID == id {
+				return &d.VolumeGroups[i]
+			}
+		}
+	}
+	return nil
 }
 
 type PackageRepository struct {
@@ -79,11 +259,16 @@ type ProviderRepoConfigs struct {
 
 // ImageTemplate represents the YAML image template structure (unchanged)
 type ImageTemplate struct {
-	Image               ImageInfo           `yaml:"image"`
-	Target              TargetInfo          `yaml:"target"`
-	Disk                DiskConfig          `yaml:"disk,omitempty"`
-	SystemConfig        SystemConfig        `yaml:"systemConfig"`
-	PackageRepositories []PackageRepository `yaml:"packageRepositories,omitempty"`
+	Image               ImageInfo             `yaml:"image"`
+	Target              TargetInfo            `yaml:"target"`
+	Disk                DiskConfig            `yaml:"disk,omitempty"`
+	SystemConfig        SystemConfig          `yaml:"systemConfig"`
+	PackageRepositories []PackageRepository   `yaml:"packageRepositories,omitempty"`
+	Provenance          ProvenanceConfig      `yaml:"provenance,omitempty"`
+	ArtifactSigning     ArtifactSigningConfig `yaml:"artifactSigning,omitempty"`
+	SBOM                SBOMConfig            `yaml:"sbom,omitempty"`
+	Updates             UpdatesConfig         `yaml:"updates,omitempty"`
+	MeasuredBoot        MeasuredBootConfig    `yaml:"measuredBoot,omitempty"`
 
 	// Explicitly excluded from YAML serialization/deserialization
 	PathList             []string                `yaml:"-"`
@@ -122,30 +307,75 @@ type Initramfs struct {
 }
 
 type Bootloader struct {
-	BootType string `yaml:"bootType"` // BootType: type of bootloader (e.g., "efi", "legacy")
-	Provider string `yaml:"provider"` // Provider: bootloader provider (e.g., "grub2", "systemd-boot")
+	BootType string `yaml:"bootType"`         // BootType: type of bootloader (e.g., "efi", "legacy")
+	Provider string `yaml:"provider"`         // Provider: bootloader provider (e.g., "grub2", "systemd-boot")
+	Chain    string `yaml:"chain,omitempty"`  // Chain: "shim" starts the provider from the distro's Microsoft signed shim
+	MOKKey   string `yaml:"mokKey,omitempty"` // MOKKey: private key file or PKCS#11 URI signing the EFI binaries started by shim
+	MOKCrt   string `yaml:"mokCrt,omitempty"` // MOKCrt: PEM certificate of MOKKey, imported with mokutil on first boot
+
+	Timeout      *int   `yaml:"timeout,omitempty"`      // Timeout: seconds the boot menu is shown, 0 boots the default entry right away
+	DefaultEntry string `yaml:"defaultEntry,omitempty"` // DefaultEntry: ID of the boot entry booted by default, the first one when empty
+}
+
+// BootChainShim boots the bootloader provider through the distro's shim
+const BootChainShim = "shim"
+
+// IsShimChain returns whether the bootloader is started by the distro's shim
+func (b Bootloader) IsShimChain() bool {
+	return b.Chain == BootChainShim
+}
+
+// ProvenanceConfig holds the SLSA provenance attestation configuration
+type ProvenanceConfig struct {
+	BuilderID  string `yaml:"builderId,omitempty"`  // BuilderID: URI identifying the build platform recorded in the provenance
+	SigningKey string `yaml:"signingKey,omitempty"` // SigningKey: optional PEM private key used to sign the provenance as a DSSE envelope
+}
+
+// ArtifactSigningConfig holds the detached signing configuration for output artifacts
+type ArtifactSigningConfig struct {
+	Method         string `yaml:"method,omitempty"`         // Method: signature format, "gpg" or "cosign"
+	Key            string `yaml:"key,omitempty"`            // Key: armored OpenPGP private key (gpg) or PEM private key (cosign)
+	PassphraseFile string `yaml:"passphraseFile,omitempty"` // PassphraseFile: optional file holding the passphrase of an encrypted GPG key
+}
+
+// SBOMConfig controls whether and where the SPDX SBOM is embedded in the image
+type SBOMConfig struct {
+	Location  string `yaml:"location,omitempty"`  // Location: "rootfs" (default), "esp", "partition", "uki" or "none"
+	Path      string `yaml:"path,omitempty"`      // Path: directory inside the target filesystem (rootfs, esp, partition)
+	Partition string `yaml:"partition,omitempty"` // Partition: ID of the disk partition holding the SBOM (partition)
 }
 
 // ImmutabilityConfig holds the immutability configuration
 type ImmutabilityConfig struct {
-	Enabled         bool   `yaml:"enabled"`                   // Enabled: whether immutability is enabled (default: false)
-	SecureBootDBKey string `yaml:"secureBootDBKey,omitempty"` // SecureBootDBKey: The private key file used to sign the bootloader for UEFI Secure Boot
-	SecureBootDBCrt string `yaml:"secureBootDBCrt,omitempty"` // SecureBootDBCrt: The certificate file in PEM format, which corresponds to the private key for UEFI Secure Boot
-	SecureBootDBCer string `yaml:"secureBootDBCer,omitempty"` // SecureBootDBCer: The same certificate file, but provided in DER (binary) format specifically for UEFI firmware
-	wasProvided     bool   `yaml:"-"`                         // Internal flag to track if section was provided
+	Enabled          bool   `yaml:"enabled"`                    // Enabled: whether immutability is enabled (default: false)
+	SecureBootDBKey  string `yaml:"secureBootDBKey,omitempty"`  // SecureBootDBKey: The private key file used to sign the bootloader for UEFI Secure Boot
+	SecureBootDBCrt  string `yaml:"secureBootDBCrt,omitempty"`  // SecureBootDBCrt: The certificate file in PEM format, which corresponds to the private key for UEFI Secure Boot
+	SecureBootDBCer  string `yaml:"secureBootDBCer,omitempty"`  // SecureBootDBCer: The same certificate file, but provided in DER (binary) format specifically for UEFI firmware
+	SecureBootKeys   string `yaml:"secureBootKeys,omitempty"`   // SecureBootKeys: name of a key set created by "keys generate", supplying the DB files not set above
+	SecureBootEnroll string `yaml:"secureBootEnroll,omitempty"` // SecureBootEnroll: place the key set on the ESP for systemd-boot to enroll, "manual", "if-safe" or "force"
+	ModuleSigningKey string `yaml:"moduleSigningKey,omitempty"` // ModuleSigningKey: private key signing the out-of-tree kernel modules
+	ModuleSigningCrt string `yaml:"moduleSigningCrt,omitempty"` // ModuleSigningCrt: PEM certificate of ModuleSigningKey, enrolled as a MOK or built into the kernel
+	wasProvided      bool   `yaml:"-"`                          // Internal flag to track if section was provided
 }
 
 // UserConfig holds the user configuration
 type UserConfig struct {
-	Name           string   `yaml:"name"`                     // Name: username for the user account
-	Password       string   `yaml:"password,omitempty"`       // Password: plain text password (discouraged for security)
-	HashAlgo       string   `yaml:"hash_algo,omitempty"`      // HashAlgo: algorithm to be used to hash the password (e.g., "sha512", "bcrypt")
-	PasswordMaxAge int      `yaml:"passwordMaxAge,omitempty"` // PasswordMaxAge: maximum password age in days (like /etc/login.defs PASS_MAX_DAYS)
-	StartupScript  string   `yaml:"startupScript,omitempty"`  // StartupScript: shell/script to run on login
-	Groups         []string `yaml:"groups,omitempty"`         // Groups: additional groups to add user to
-	Sudo           bool     `yaml:"sudo,omitempty"`           // Sudo: whether to grant sudo permissions
-	Home           string   `yaml:"home,omitempty"`           // Home: custom home directory path
-	Shell          string   `yaml:"shell,omitempty"`          // Shell: login shell (e.g., /bin/bash, /bin/zsh)
+	Name                  string   `yaml:"name"`                            // Name: username for the user account
+	Password              string   `yaml:"password,omitempty"`              // Password: plain text password (discouraged for security)
+	HashAlgo              string   `yaml:"hash_algo,omitempty"`             // HashAlgo: algorithm to be used to hash the password (e.g., "sha512", "bcrypt")
+	PasswordMaxAge        int      `yaml:"passwordMaxAge,omitempty"`        // PasswordMaxAge: maximum password age in days (like /etc/login.defs PASS_MAX_DAYS)
+	StartupScript         string   `yaml:"startupScript,omitempty"`         // StartupScript: shell/script to run on login
+	Groups                []string `yaml:"groups,omitempty"`                // Groups: additional groups to add user to
+	Sudo                  bool     `yaml:"sudo,omitempty"`                  // Sudo: whether to grant sudo permissions
+	Home                  string   `yaml:"home,omitempty"`                  // Home: custom home directory path
+	Shell                 string   `yaml:"shell,omitempty"`                 // Shell: login shell (e.g., /bin/bash, /bin/zsh)
+	UID                   *int     `yaml:"uid,omitempty"`                   // UID: numeric user ID, allocated by useradd when unset
+	GID                   *int     `yaml:"gid,omitempty"`                   // GID: numeric ID of the primary group, created with the user name when missing
+	SSHAuthorizedKeys     []string `yaml:"sshAuthorizedKeys,omitempty"`     // SSHAuthorizedKeys: public keys written to ~/.ssh/authorized_keys
+	SSHAuthorizedKeysFile string   `yaml:"sshAuthorizedKeysFile,omitempty"` // SSHAuthorizedKeysFile: authorized_keys file appended to SSHAuthorizedKeys, relative to the template
+	System                bool     `yaml:"system,omitempty"`                // System: system account without home directory, with a nologin shell by default
+	LockPassword          bool     `yaml:"lockPassword,omitempty"`          // LockPassword: lock password login, key based SSH login still works
+	Expire                string   `yaml:"expire,omitempty"`                // Expire: account expiry date (YYYY-MM-DD)
 }
 
 // SystemConfig represents a system configuration within the template
@@ -176,26 +406,83 @@ type ConfigurationInfo struct {
 
 // KernelConfig holds the kernel configuration
 type KernelConfig struct {
-	Version            string   `yaml:"version"`
-	Cmdline            string   `yaml:"cmdline"`
-	Packages           []string `yaml:"packages"`
-	UKI                bool     `yaml:"uki,omitempty"`
-	EnableExtraModules string   `yaml:"enableExtraModules"`
+	Version            string           `yaml:"version"`
+	Cmdline            string           `yaml:"cmdline"`
+	Packages           []string         `yaml:"packages"`
+	UKI                bool             `yaml:"uki,omitempty"`
+	EnableExtraModules string           `yaml:"enableExtraModules"`
+	BootEntries        []BootEntry      `yaml:"bootEntries,omitempty"`
+	CmdlineFragments   CmdlineFragments `yaml:"cmdlineFragments,omitempty"`
 }
 
 // PartitionInfo holds information about a partition in the disk layout
 type PartitionInfo struct {
-	Name         string   `yaml:"name"`         // Name: label for the partition
-	ID           string   `yaml:"id"`           // ID: unique identifier for the partition; can be used as a key
-	Flags        []string `yaml:"flags"`        // Flags: optional flags for the partition (e.g., "boot", "hidden")
-	Type         string   `yaml:"type"`         // Type: partition type (e.g., "esp", "linux-root-amd64")
-	TypeGUID     string   `yaml:"typeUUID"`     // TypeGUID: GPT type GUID for the partition (e.g., "8300" for Linux filesystem)
-	FsType       string   `yaml:"fsType"`       // FsType: filesystem type (e.g., "ext4", "xfs", etc.);
-	FsLabel      string   `yaml:"fsLabel"`      // FsLabel: filesystem label (e.g., "cloudimg-rootfs")
-	Start        string   `yaml:"start"`        // Start: start offset of the partition; can be a absolute size (e.g., "512MiB")
-	End          string   `yaml:"end"`          // End: end offset of the partition; can be a absolute size (e.g., "2GiB") or "0" for the end of the disk
-	MountPoint   string   `yaml:"mountPoint"`   // MountPoint: optional mount point for the partition (e.g., "/boot", "/rootfs")
-	MountOptions string   `yaml:"mountOptions"` // MountOptions: optional mount options for the partition (e.g., "defaults", "noatime")
+	Name         string            `yaml:"name"`                 // Name: label for the partition
+	ID           string            `yaml:"id"`                   // ID: unique identifier for the partition; can be used as a key
+	Flags        []string          `yaml:"flags"`                // Flags: optional flags for the partition (e.g., "boot", "hidden")
+	Type         string            `yaml:"type"`                 // Type: partition type (e.g., "esp", "linux-root-amd64")
+	TypeGUID     string            `yaml:"typeUUID"`             // TypeGUID: GPT type GUID for the partition (e.g., "8300" for Linux filesystem)
+	FsType       string            `yaml:"fsType"`               // FsType: filesystem type (e.g., "ext4", "xfs", etc.);
+	FsLabel      string            `yaml:"fsLabel"`              // FsLabel: filesystem label (e.g., "cloudimg-rootfs")
+	Start        string            `yaml:"start"`                // Start: start offset of the partition; can be a absolute size (e.g., "512MiB")
+	End          string            `yaml:"end"`                  // End: end offset of the partition; can be a absolute size (e.g., "2GiB") or "0" for the end of the disk
+	Size         string            `yaml:"size,omitempty"`       // Size: size on the target disk instead of Start/End: absolute (e.g., "512MiB"), share of the disk (e.g., "20%") or "rest"
+	MinSize      string            `yaml:"minSize,omitempty"`    // MinSize: lower bound of a "%" or "rest" size (e.g., "4GiB")
+	MaxSize      string            `yaml:"maxSize,omitempty"`    // MaxSize: upper bound of a "%" or "rest" size (e.g., "64GiB")
+	MountPoint   string            `yaml:"mountPoint"`           // MountPoint: optional mount point for the partition (e.g., "/boot", "/rootfs")
+	MountOptions string            `yaml:"mountOptions"`         // MountOptions: optional mount options for the partition (e.g., "defaults", "noatime")
+	Subvolumes   []BtrfsSubvolume  `yaml:"subvolumes,omitempty"` // Subvolumes: btrfs subvolumes created on the partition
+	Encryption   *EncryptionConfig `yaml:"encryption,omitempty"` // Encryption: optional LUKS2 container holding the filesystem
+	PartUUID     string            `yaml:"partUUID,omitempty"`   // PartUUID: GPT unique partition GUID; derived for reproducible builds, random otherwise, when empty
+	Attributes   []string          `yaml:"attributes,omitempty"` // Attributes: GPT attribute bits, by name (e.g., "required", "no-automount") or number
+	Priority     int               `yaml:"priority,omitempty"`   // Priority: A/B boot priority 0-15, GPT attribute bits 48-51
+	Tries        int               `yaml:"tries,omitempty"`      // Tries: A/B boot tries remaining 0-15, GPT attribute bits 52-55
+	Successful   bool              `yaml:"successful,omitempty"` // Successful: A/B boot successful flag, GPT attribute bit 56
+}
+
+// EncryptionConfig describes the LUKS2 container of an encrypted partition
+type EncryptionConfig struct {
+	Type      string `yaml:"type,omitempty"`    // Type: container format; only "luks2" is supported
+	Cipher    string `yaml:"cipher,omitempty"`  // Cipher: cryptsetup cipher specification (default "aes-xts-plain64")
+	KeySize   int    `yaml:"keySize,omitempty"` // KeySize: volume key size in bits (default 512)
+	KeySource string `yaml:"keySource"`         // KeySource: "keyfile" to unlock with KeyFile, "tpm2" to enroll the TPM2 on first boot
+	KeyFile   string `yaml:"keyFile,omitempty"` // KeyFile: build host path of the key; required for "keyfile", generated for "tpm2" when empty
+	Name      string `yaml:"name,omitempty"`    // Name: device-mapper name of the opened container (default "luks-<id>")
+}
+
+// LuksName returns the device-mapper name of the opened LUKS container of
+// the partition.
+func (p *PartitionInfo) LuksName() string {
+	if p.Encryption == nil {
+		return ""
+	}
+	if p.Encryption.Name != "" {
+		return p.Encryption.Name
+	}
+	return "luks-" + p.ID
+}
+
+// BtrfsSubvolume describes a subvolume of a btrfs partition
+type BtrfsSubvolume struct {
+	Name         string `yaml:"name"`                   // Name: subvolume path relative to the top-level subvolume (e.g., "@", "@home")
+	MountPoint   string `yaml:"mountPoint,omitempty"`   // MountPoint: where the subvolume is mounted; the one at the partition mount point becomes the default subvolume
+	MountOptions string `yaml:"mountOptions,omitempty"` // MountOptions: fstab options added after subvol= (e.g., "noatime")
+	Compression  string `yaml:"compression,omitempty"`  // Compression: compression property of the subvolume (e.g., "zstd", "lzo", "zlib")
+	Snapshot     string `yaml:"snapshot,omitempty"`     // Snapshot: read-only snapshot of the subvolume taken at the end of the build (e.g., "@snapshots/factory")
+}
+
+// DefaultSubvolume returns the btrfs subvolume mounted at the partition mount
+// point, or nil when the top-level subvolume is mounted there.
+func (p *PartitionInfo) DefaultSubvolume() *BtrfsSubvolume {
+	if p.MountPoint == "" {
+		return nil
+	}
+	for i := range p.Subvolumes {
+		if p.Subvolumes[i].MountPoint == p.MountPoint {
+			return &p.Subvolumes[i]
+		}
+	}
+	return nil
 }
 
 var log = logger.Logger()
@@ -273,6 +560,30 @@ func parseYAMLTemplate(data []byte, validateFull bool) (*ImageTemplate, error) {
 		return nil, err
 	}
 
+	if err := template.validatePartitions(); err != nil {
+		return nil, err
+	}
+
+	if err := template.Updates.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := template.MeasuredBoot.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateBootEntries(template.SystemConfig.Kernel.BootEntries); err != nil {
+		return nil, err
+	}
+	if err := template.SystemConfig.Bootloader.validateMenu(); err != nil {
+		return nil, err
+	}
+	if err := template.SystemConfig.Kernel.validateCmdline(); err != nil {
+		return nil, err
+	}
+	if err := validateUsers(template.SystemConfig.Users); err != nil {
+		return nil, err
+	}
+
 	return &template, nil
 }
 
@@ -730,37 +1041,54 @@ func (sc *SystemConfig) HasSecureBootDBConfig() bool {
 
 // HasSecureBootDBConfig returns whether any secure boot DB configuration is provided
 func (ic *ImmutabilityConfig) HasSecureBootDBConfig() bool {
-	return ic.SecureBootDBKey != "" || ic.SecureBootDBCrt != "" || ic.SecureBootDBCer != ""
+	return ic.SecureBootDBKey != "" || ic.SecureBootDBCrt != "" || ic.SecureBootDBCer != "" || ic.SecureBootKeys != ""
 }
 
-// GetSecureBootDBKeyPath returns the secure boot DB private key file path
+// GetSecureBootDBKeyPath returns the secure boot DB private key file path,
+// taken from the key set when not configured explicitly
 func (ic *ImmutabilityConfig) GetSecureBootDBKeyPath() string {
-	return ic.SecureBootDBKey
+	if ic.SecureBootDBKey != "" {
+		return ic.SecureBootDBKey
+	}
+	return ic.secureBootKeySetFile(SecureBootDB + ".key")
 }
 
-// GetSecureBootDBCrtPath returns the secure boot DB certificate file path (PEM format)
+// GetSecureBootDBCrtPath returns the secure boot DB certificate file path (PEM format),
+// taken from the key set when not configured explicitly
 func (ic *ImmutabilityConfig) GetSecureBootDBCrtPath() string {
-	return ic.SecureBootDBCrt
+	if ic.SecureBootDBCrt != "" {
+		return ic.SecureBootDBCrt
+	}
+	return ic.secureBootKeySetFile(SecureBootDB + ".crt")
 }
 
-// GetSecureBootDBCerPath returns the secure boot DB certificate file path (DER format)
+// GetSecureBootDBCerPath returns the secure boot DB certificate file path (DER format),
+// taken from the key set when not configured explicitly
 func (ic *ImmutabilityConfig) GetSecureBootDBCerPath() string {
-	return ic.SecureBootDBCer
+	if ic.SecureBootDBCer != "" {
+		return ic.SecureBootDBCer
+	}
+	return ic.secureBootKeySetFile(SecureBootDB + ".cer")
+}
+
+// HasModuleSigningKey returns whether a kernel module signing key is configured
+func (ic *ImmutabilityConfig) HasModuleSigningKey() bool {
+	return ic.ModuleSigningKey != "" && ic.ModuleSigningCrt != ""
 }
 
 // HasSecureBootDBKey returns whether a secure boot DB private key is configured
 func (ic *ImmutabilityConfig) HasSecureBootDBKey() bool {
-	return ic.SecureBootDBKey != ""
+	return ic.GetSecureBootDBKeyPath() != ""
 }
 
 // HasSecureBootDBCrt returns whether a secure boot DB certificate (PEM) is configured
 func (ic *ImmutabilityConfig) HasSecureBootDBCrt() bool {
-	return ic.SecureBootDBCrt != ""
+	return ic.GetSecureBootDBCrtPath() != ""
 }
 
 // HasSecureBootDBCer returns whether a secure boot DB certificate (DER) is configured
 func (ic *ImmutabilityConfig) HasSecureBootDBCer() bool {
-	return ic.SecureBootDBCer != ""
+	return ic.GetSecureBootDBCerPath() != ""
 }
 
 // GetUsers returns the user configurations from systemConfig
@@ -803,6 +1131,39 @@ func (sc *SystemConfig) HasUsers() bool {
 	return len(sc.Users) > 0
 }
 
+// GetProvenanceConfig returns the provenance attestation configuration
+func (t *ImageTemplate) GetProvenanceConfig() ProvenanceConfig {
+	return t.Provenance
+}
+
+// GetArtifactSigningConfig returns the output artifact signing configuration
+func (t *ImageTemplate) GetArtifactSigningConfig() ArtifactSigningConfig {
+	return t.ArtifactSigning
+}
+
+// GetSBOMConfig returns the SBOM embedding configuration
+func (t *ImageTemplate) GetSBOMConfig() SBOMConfig {
+	return t.SBOM
+}
+
+// GetBuildStartTime returns the start of the overall build timeline.
+func (t *ImageTemplate) GetBuildStartTime() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return t.buildTimelineStart
+}
+
+// GetBuildFinishTime returns the end of the overall build timeline.
+func (t *ImageTemplate) GetBuildFinishTime() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return t.buildFinishedAt
+}
+
 // GetPackageRepositories returns the list of additional package repositories
 func (t *ImageTemplate) GetPackageRepositories() []PackageRepository {
 	return t.PackageRepositories
@@ -965,6 +1326,534 @@ func (t *ImageTemplate) validatePackageRepositories() error {
 	return nil
 }
 
+func (t *ImageTemplate) validatePartitions() error {
+	luksNames := make(map[string]bool)
+	for _, partition := range t.Disk.Partitions {
+		if err := partition.validateSubvolumes(); err != nil {
+			return err
+		}
+		if err := partition.validateEncryption(); err != nil {
+			return err
+		}
+		if name := partition.LuksName(); name != "" {
+			if luksNames[name] {
+				return fmt.Errorf("partition '%s': encrypted volume name '%s' is used more than once", partition.ID, name)
+			}
+			luksNames[name] = true
+		}
+	}
+	if err := t.Disk.validatePartitionSizes(); err != nil {
+		return err
+	}
+	if err := t.Disk.validateGPTIdentity(); err != nil {
+		return err
+	}
+	if err := t.Disk.validateRaidArrays(); err != nil {
+		return err
+	}
+	if err := t.Disk.validateVolumeGroups(); err != nil {
+		return err
+	}
+	// dm-verity hashes the root partition device while the image is built
+	if t.Disk.IsLoopless() && t.IsImmutabilityEnabled() {
+		return fmt.Errorf("the loopless builder does not support immutability")
+	}
+	// The loop builder writes a read-only root filesystem to its partition
+	// right before dm-verity hashes it
+	if root, ok := t.Disk.ReadOnlyRoot(); ok && !t.Disk.IsLoopless() && !t.IsImmutabilityEnabled() {
+		return fmt.Errorf("partition '%s': %s root filesystem requires immutability or the loopless builder", root.ID, root.FsType)
+	}
+	if err := t.validateGrowRoot(); err != nil {
+		return err
+	}
+	return t.Disk.validateBuilder()
+}
+
+// growRootFsTypes are the filesystems that can be grown while mounted
+var growRootFsTypes = []string{"ext2", "ext3", "ext4", "xfs", "btrfs"}
+
+// validateGrowRoot checks that the root filesystem can be grown in place on
+// first boot: it must sit directly on the last partition, and dm-verity must
+// not pin the size of that partition.
+func (t *ImageTemplate) validateGrowRoot() error {
+	if !t.Disk.GrowRoot {
+		return nil
+	}
+	if t.IsImmutabilityEnabled() {
+		return fmt.Errorf("growRoot is not supported with immutability, the root partition is protected by dm-verity")
+	}
+	partitions := t.Disk.Partitions
+	for i, partition := range partitions {
+		if partition.MountPoint != "/" {
+			continue
+		}
+		if i != len(partitions)-1 {
+			return fmt.Errorf("growRoot requires the root partition '%s' to be the last partition", partition.ID)
+		}
+		if partition.Encryption != nil {
+			return fmt.Errorf("growRoot does not support the encrypted root partition '%s'", partition.ID)
+		}
+		if !slice.Contains(growRootFsTypes, partition.FsType) {
+			return fmt.Errorf("growRoot does not support fsType %s of the root partition '%s'", partition.FsType, partition.ID)
+		}
+		return nil
+	}
+	return fmt.Errorf("growRoot requires the root filesystem on a partition")
+}
+
+// looplessFsTypes are the filesystems the loopless builder can create from a
+// directory
+var looplessFsTypes = []string{"", "ext2", "ext3", "ext4", "fat16", "fat32", "vfat", "linux-swap", "squashfs", "erofs"}
+
+// validateBuilder checks that the disk layout can be produced by the selected
+// raw image builder
+func (d *DiskConfig) validateBuilder() error {
+	switch d.Builder {
+	case "", DiskBuilderLoop:
+		// The loop device is created before anything is installed
+		if d.IsAutoSized() {
+			return fmt.Errorf("disk size auto requires the loopless builder")
+		}
+		for _, partition := range d.Partitions {
+			if IsReadOnlyFsType(partition.FsType) && partition.MountPoint != "/" {
+				return fmt.Errorf("partition '%s': %s requires the loopless builder", partition.ID, partition.FsType)
+			}
+			if d.IsAutoSizedPartition(partition) {
+				return fmt.Errorf("partition '%s': size auto requires the loopless builder", partition.ID)
+			}
+		}
+		return nil
+	case DiskBuilderLoopless:
+	default:
+		return fmt.Errorf("unsupported disk builder '%s'", d.Builder)
+	}
+
+	if d.PartitionTableType != "" && d.PartitionTableType != "gpt" {
+		return fmt.Errorf("the loopless builder only supports gpt partition tables")
+	}
+	if len(d.VolumeGroups) > 0 || len(d.RaidArrays) > 0 {
+		return fmt.Errorf("the loopless builder does not support volume groups or RAID arrays")
+	}
+	for _, partition := range d.Partitions {
+		if partition.Encryption != nil {
+			return fmt.Errorf("partition '%s': the loopless builder does not support encryption", partition.ID)
+		}
+		if len(partition.Subvolumes) > 0 {
+			return fmt.Errorf("partition '%s': the loopless builder does not support btrfs subvolumes", partition.ID)
+		}
+		if !slice.Contains(looplessFsTypes, partition.FsType) {
+			return fmt.Errorf("partition '%s': the loopless builder does not support fsType %s", partition.ID, partition.FsType)
+		}
+		if d.IsAutoSizedPartition(partition) {
+			mountPoint := strings.TrimSpace(partition.MountPoint)
+			if mountPoint == "" || mountPoint == "none" || !slice.Contains(autoSizeFsTypes, partition.FsType) {
+				return fmt.Errorf("partition '%s': size auto requires a mount point and an ext, fat, squashfs or erofs filesystem", partition.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// autoSizeFsTypes are the filesystems whose size can be computed from the
+// content of their mount point
+var autoSizeFsTypes = []string{"ext2", "ext3", "ext4", "fat16", "fat32", "vfat", "squashfs", "erofs"}
+
+// validateEncryption checks the LUKS2 settings of a partition
+func (p *PartitionInfo) validateEncryption() error {
+	enc := p.Encryption
+	if enc == nil {
+		return nil
+	}
+	if enc.Type != "" && enc.Type != "luks2" {
+		return fmt.Errorf("partition '%s': unsupported encryption type '%s'", p.ID, enc.Type)
+	}
+	// The firmware and the bootloader read these partitions before anything
+	// can unlock them
+	if p.MountPoint == "/boot/efi" || p.MountPoint == "/boot" {
+		return fmt.Errorf("partition '%s': %s cannot be encrypted", p.ID, p.MountPoint)
+	}
+	switch enc.KeySource {
+	case "keyfile":
+		if enc.KeyFile == "" {
+			return fmt.Errorf("partition '%s': encryption keySource keyfile requires keyFile", p.ID)
+		}
+	case "tpm2":
+	default:
+		return fmt.Errorf("partition '%s': unsupported encryption keySource '%s'", p.ID, enc.KeySource)
+	}
+	if enc.KeySize != 0 && (enc.KeySize%8 != 0 || enc.KeySize < 128) {
+		return fmt.Errorf("partition '%s': invalid encryption keySize %d", p.ID, enc.KeySize)
+	}
+	if !dmNamePattern.MatchString(p.LuksName()) {
+		return fmt.Errorf("partition '%s': invalid encrypted volume name '%s'", p.ID, p.LuksName())
+	}
+	return nil
+}
+
+// dmNamePattern matches names that end up as device-mapper nodes: volume
+// groups, logical volumes and opened LUKS containers
+var dmNamePattern = regexp.MustCompile(`^[a-zA-Z0-9+_.][a-zA-Z0-9+_.-]*$`)
+
+// validateVolumeGroups checks the LVM layout of the disk
+func (d *DiskConfig) validateVolumeGroups() error {
+	if len(d.VolumeGroups) == 0 {
+		return nil
+	}
+
+	partitions := make(map[string]PartitionInfo)
+	ids := make(map[string]bool)
+	for _, partition := range d.Partitions {
+		partitions[partition.ID] = partition
+		ids[partition.ID] = true
+	}
+	for _, array := range d.RaidArrays {
+		ids[array.ID] = true
+	}
+
+	usedPVs := make(map[string]bool)
+	vgNames := make(map[string]bool)
+	for _, vg := range d.VolumeGroups {
+		if !dmNamePattern.MatchString(vg.Name) {
+			return fmt.Errorf("invalid volume group name '%s'", vg.Name)
+		}
+		if vgNames[vg.Name] {
+			return fmt.Errorf("duplicate volume group '%s'", vg.Name)
+		}
+		vgNames[vg.Name] = true
+
+		if len(vg.PhysicalVolumes) == 0 {
+			return fmt.Errorf("volume group '%s': at least one physical volume is required", vg.Name)
+		}
+		for _, pv := range vg.PhysicalVolumes {
+			partition, ok := partitions[pv]
+			if !ok {
+				return fmt.Errorf("volume group '%s': physical volume partition '%s' not found", vg.Name, pv)
+			}
+			if partition.FsType != "lvm" {
+				return fmt.Errorf("volume group '%s': physical volume partition '%s' must have fsType lvm", vg.Name, pv)
+			}
+			if usedPVs[pv] {
+				return fmt.Errorf("volume group '%s': partition '%s' is already a physical volume", vg.Name, pv)
+			}
+			usedPVs[pv] = true
+		}
+
+		lvNames := make(map[string]bool)
+		for i, lv := range vg.LogicalVolumes {
+			if lv.ID == "" {
+				return fmt.Errorf("volume group '%s': logical volume without id", vg.Name)
+			}
+			if ids[lv.ID] {
+				return fmt.Errorf("volume group '%s': id '%s' is already used by another partition or logical volume", vg.Name, lv.ID)
+			}
+			ids[lv.ID] = true
+			if !dmNamePattern.MatchString(lv.LVName()) || lvNames[lv.LVName()] {
+				return fmt.Errorf("volume group '%s': invalid or duplicate logical volume name '%s'", vg.Name, lv.LVName())
+			}
+			lvNames[lv.LVName()] = true
+			if err := validateLogicalVolumeSize(lv.Size, i == len(vg.LogicalVolumes)-1); err != nil {
+				return fmt.Errorf("volume group '%s': logical volume '%s': %w", vg.Name, lv.ID, err)
+			}
+			if lv.FsType == "lvm" {
+				return fmt.Errorf("volume group '%s': logical volume '%s' cannot have fsType lvm", vg.Name, lv.ID)
+			}
+		}
+	}
+
+	for _, partition := range d.Partitions {
+		if partition.FsType == "lvm" && !usedPVs[partition.ID] {
+			return fmt.Errorf("partition '%s' has fsType lvm but is not used by any volume group", partition.ID)
+		}
+	}
+	return nil
+}
+
+// raidMinDevices is the number of member devices each supported RAID level
+// needs
+var raidMinDevices = map[int]int{0: 2, 1: 2, 5: 3, 6: 4, 10: 2}
+
+// validateRaidArrays checks that every array is built on a raid partition
+// replicated on enough target disks for its level
+func (d *DiskConfig) validateRaidArrays() error {
+	for _, path := range d.MirrorPaths {
+		if path == "" || path == d.Path {
+			return fmt.Errorf("invalid mirror disk path '%s'", path)
+		}
+	}
+	if len(d.RaidArrays) == 0 {
+		for _, partition := range d.Partitions {
+			if partition.FsType == "raid" {
+				return fmt.Errorf("partition '%s' has fsType raid but is not used by any RAID array", partition.ID)
+			}
+		}
+		return nil
+	}
+
+	// Every target disk gets the same partitions, so the encrypted volume
+	// names would clash
+	for _, partition := range d.Partitions {
+		if partition.Encryption != nil && len(d.MirrorPaths) > 0 {
+			return fmt.Errorf("partition '%s': encryption is not supported with mirrorPaths", partition.ID)
+		}
+	}
+
+	partitions := make(map[string]PartitionInfo)
+	ids := make(map[string]bool)
+	for _, partition := range d.Partitions {
+		partitions[partition.ID] = partition
+		ids[partition.ID] = true
+	}
+
+	devices := 1 + len(d.MirrorPaths)
+	usedMembers := make(map[string]bool)
+	mdNames := make(map[string]bool)
+	for _, array := range d.RaidArrays {
+		if array.ID == "" {
+			return fmt.Errorf("RAID array without id")
+		}
+		if ids[array.ID] {
+			return fmt.Errorf("RAID array '%s': id is already used by another partition or array", array.ID)
+		}
+		ids[array.ID] = true
+		if !dmNamePattern.MatchString(array.MDName()) || mdNames[array.MDName()] {
+			return fmt.Errorf("RAID array '%s': invalid or duplicate name '%s'", array.ID, array.MDName())
+		}
+		mdNames[array.MDName()] = true
+
+		minDevices, ok := raidMinDevices[array.Level]
+		if !ok {
+			return fmt.Errorf("RAID array '%s': unsupported RAID level %d", array.ID, array.Level)
+		}
+		if devices < minDevices {
+			return fmt.Errorf("RAID array '%s': RAID level %d needs at least %d disks, the template targets %d", array.ID, array.Level, minDevices, devices)
+		}
+
+		partition, ok := partitions[array.Partition]
+		if !ok {
+			return fmt.Errorf("RAID array '%s': member partition '%s' not found", array.ID, array.Partition)
+		}
+		if partition.FsType != "raid" {
+			return fmt.Errorf("RAID array '%s': member partition '%s' must have fsType raid", array.ID, array.Partition)
+		}
+		if usedMembers[array.Partition] {
+			return fmt.Errorf("RAID array '%s': partition '%s' is already a RAID member", array.ID, array.Partition)
+		}
+		usedMembers[array.Partition] = true
+		// The firmware reads the ESP before any array can be assembled
+		if array.MountPoint == "/boot/efi" {
+			return fmt.Errorf("RAID array '%s': /boot/efi cannot be on a RAID array", array.ID)
+		}
+		if array.FsType == "raid" || array.FsType == "lvm" {
+			return fmt.Errorf("RAID array '%s' cannot have fsType %s", array.ID, array.FsType)
+		}
+	}
+
+	for _, partition := range d.Partitions {
+		if partition.FsType == "raid" && !usedMembers[partition.ID] {
+			return fmt.Errorf("partition '%s' has fsType raid but is not used by any RAID array", partition.ID)
+		}
+	}
+	return nil
+}
+
+// validateLogicalVolumeSize accepts an absolute size, a percentage of the
+// volume group or "0" for the remaining space of the last logical volume.
+func validateLogicalVolumeSize(size string, last bool) error {
+	switch {
+	case size == "0":
+		if !last {
+			return fmt.Errorf("size 0 (remaining space) is only allowed for the last logical volume")
+		}
+		return nil
+	case strings.HasSuffix(size, "%"):
+		percent, err := strconv.Atoi(strings.TrimSuffix(size, "%"))
+		if err != nil || percent <= 0 || percent > 100 {
+			return fmt.Errorf("invalid size '%s'", size)
+		}
+		return nil
+	case !absoluteSizePattern.MatchString(size):
+		return fmt.Errorf("invalid size '%s'", size)
+	}
+	return nil
+}
+
+// DiskSizeAuto sizes the disk or a partition from the installed content
+const DiskSizeAuto = "auto"
+
+var autoSizePattern = regexp.MustCompile(`^auto(?:\+([1-9][0-9]*)%)?$`)
+
+// ParseAutoSize reports whether size is an automatic size, "auto" or
+// "auto+N%", and returns its headroom percentage.
+func ParseAutoSize(size string) (bool, int, error) {
+	if !strings.HasPrefix(size, DiskSizeAuto) {
+		return false, 0, nil
+	}
+	match := autoSizePattern.FindStringSubmatch(size)
+	if match == nil {
+		return false, 0, fmt.Errorf("invalid size '%s'", size)
+	}
+	if match[1] == "" {
+		return true, 0, nil
+	}
+	headroom, err := strconv.Atoi(match[1])
+	if err != nil || headroom > 1000 {
+		return false, 0, fmt.Errorf("invalid headroom in size '%s'", size)
+	}
+	return true, headroom, nil
+}
+
+var absoluteSizePattern = regexp.MustCompile(`^([1-9][0-9]*)(K|M|G|KB|MB|GB|KiB|MiB|GiB)$`)
+
+var sizeUnitBytes = map[string]uint64{
+	"K": 1 << 10, "M": 1 << 20, "G": 1 << 30,
+	"KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30,
+	"KB": 1000, "MB": 1000 * 1000, "GB": 1000 * 1000 * 1000,
+}
+
+// absoluteSizeBytes returns the number of bytes of a size matching
+// absoluteSizePattern
+func absoluteSizeBytes(size string) (uint64, error) {
+	match := absoluteSizePattern.FindStringSubmatch(size)
+	if match == nil {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+	num, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s': %w", size, err)
+	}
+	return num * sizeUnitBytes[match[2]], nil
+}
+
+// validatePartitionSizes checks the partition sizes resolved against the
+// target disk. Partitions are either all laid out by size, one after the
+// other, or all placed by their start and end offsets.
+func (d *DiskConfig) validatePartitionSizes() error {
+	diskAuto, _, err := ParseAutoSize(d.Size)
+	if err != nil {
+		return fmt.Errorf("disk: %w", err)
+	}
+	sized := 0
+	for _, partition := range d.Partitions {
+		if partition.Size != "" {
+			sized++
+		} else if partition.MinSize != "" || partition.MaxSize != "" {
+			return fmt.Errorf("partition '%s': minSize and maxSize require size", partition.ID)
+		}
+	}
+	if sized == 0 {
+		if diskAuto {
+			return fmt.Errorf("disk size auto requires partitions laid out by size")
+		}
+		return nil
+	}
+	if sized != len(d.Partitions) {
+		return fmt.Errorf("partitions must either all use size or all use start and end")
+	}
+
+	rest := false
+	percentTotal := 0
+	for _, partition := range d.Partitions {
+		if partition.Start != "" || partition.End != "" {
+			return fmt.Errorf("partition '%s': size cannot be combined with start and end", partition.ID)
+		}
+		relative := true
+		switch {
+		case partition.Size == "rest":
+			if rest {
+				return fmt.Errorf("partition '%s': only one partition can use size rest", partition.ID)
+			}
+			rest = true
+		case strings.HasPrefix(partition.Size, DiskSizeAuto):
+			if _, _, err := ParseAutoSize(partition.Size); err != nil {
+				return fmt.Errorf("partition '%s': %w", partition.ID, err)
+			}
+		case strings.HasSuffix(partition.Size, "%"):
+			if diskAuto {
+				return fmt.Errorf("partition '%s': percentage sizes require a fixed disk size", partition.ID)
+			}
+			percent, err := strconv.Atoi(strings.TrimSuffix(partition.Size, "%"))
+			if err != nil || percent <= 0 || percent > 100 {
+				return fmt.Errorf("partition '%s': invalid size '%s'", partition.ID, partition.Size)
+			}
+			percentTotal += percent
+		case absoluteSizePattern.MatchString(partition.Size):
+			relative = false
+		default:
+			return fmt.Errorf("partition '%s': invalid size '%s'", partition.ID, partition.Size)
+		}
+
+		if partition.MinSize == "" && partition.MaxSize == "" {
+			continue
+		}
+		if !relative {
+			return fmt.Errorf("partition '%s': minSize and maxSize only apply to percentage, rest and auto sizes", partition.ID)
+		}
+		var minBytes, maxBytes uint64
+		var err error
+		if partition.MinSize != "" {
+			if minBytes, err = absoluteSizeBytes(partition.MinSize); err != nil {
+				return fmt.Errorf("partition '%s': minSize: %w", partition.ID, err)
+			}
+		}
+		if partition.MaxSize != "" {
+			if maxBytes, err = absoluteSizeBytes(partition.MaxSize); err != nil {
+				return fmt.Errorf("partition '%s': maxSize: %w", partition.ID, err)
+			}
+			if minBytes > maxBytes {
+				return fmt.Errorf("partition '%s': minSize is larger than maxSize", partition.ID)
+			}
+		}
+	}
+	if percentTotal > 100 {
+		return fmt.Errorf("partition sizes add up to %d%% of the disk", percentTotal)
+	}
+	return nil
+}
+
+// validateSubvolumes checks the btrfs subvolume layout of a partition
+func (p *PartitionInfo) validateSubvolumes() error {
+	if len(p.Subvolumes) == 0 {
+		return nil
+	}
+	if p.FsType != "btrfs" {
+		return fmt.Errorf("partition '%s': subvolumes require fsType btrfs, got '%s'", p.ID, p.FsType)
+	}
+
+	names := make(map[string]bool)
+	mountPoints := make(map[string]bool)
+	for _, subvol := range p.Subvolumes {
+		name := subvol.Name
+		if name == "" || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || slice.Contains(strings.Split(name, "/"), "..") {
+			return fmt.Errorf("partition '%s': invalid subvolume name '%s'", p.ID, name)
+		}
+		if names[name] {
+			return fmt.Errorf("partition '%s': duplicate subvolume '%s'", p.ID, name)
+		}
+		names[name] = true
+		// Nested subvolumes are created inside their parent, so the parent must come first
+		if parent := path.Dir(name); parent != "." && !names[parent] {
+			return fmt.Errorf("partition '%s': subvolume '%s' must be listed after its parent '%s'", p.ID, name, parent)
+		}
+
+		if subvol.MountPoint != "" {
+			if !strings.HasPrefix(subvol.MountPoint, "/") {
+				return fmt.Errorf("partition '%s': subvolume '%s' mount point must be absolute", p.ID, name)
+			}
+			if mountPoints[subvol.MountPoint] {
+				return fmt.Errorf("partition '%s': mount point '%s' used by more than one subvolume", p.ID, subvol.MountPoint)
+			}
+			mountPoints[subvol.MountPoint] = true
+		}
+		if subvol.MountPoint == "/" && p.MountPoint != "/" {
+			return fmt.Errorf("partition '%s': subvolume '%s' is mounted at / so the partition mountPoint must be /", p.ID, name)
+		}
+		if subvol.Snapshot != "" && (strings.HasPrefix(subvol.Snapshot, "/") || slice.Contains(strings.Split(subvol.Snapshot, "/"), "..")) {
+			return fmt.Errorf("partition '%s': invalid snapshot name '%s' for subvolume '%s'", p.ID, subvol.Snapshot, name)
+		}
+	}
+	return nil
+}
+
 // ValidatePackageRepository validates that either URL or Path is provided
 func (pr *PackageRepository) ValidatePackageRepository() error {
 	if pr.URL == "" && pr.Path == "" {
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"strings"
@@ -4256,3 +4257,870 @@ func TestEnsureTempDir(t *testing.T) {
 		t.Error("EnsureTempDir should create the directory")
 	}
 }
+
+func TestParseYAMLTemplateBtrfsSubvolumes(t *testing.T) {
+	templateData := []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+disk:
+  name: default
+  partitions:
+    - id: rootfs
+      fsType: btrfs
+      mountPoint: /
+      subvolumes:
+        - name: "@"
+          mountPoint: /
+          snapshot: "@snapshots/factory"
+        - name: "@home"
+          mountPoint: /home
+          mountOptions: noatime
+          compression: zstd
+        - name: "@snapshots"
+          mountPoint: /.snapshots
+`)
+
+	template, err := parseYAMLTemplate(templateData, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	partition := template.Disk.Partitions[0]
+	if len(partition.Subvolumes) != 3 || partition.Subvolumes[1].Compression != "zstd" {
+		t.Fatalf("unexpected subvolumes: %+v", partition.Subvolumes)
+	}
+	if subvol := partition.DefaultSubvolume(); subvol == nil || subvol.Name != "@" {
+		t.Errorf("expected @ to be the default subvolume, got %+v", subvol)
+	}
+
+	// Unknown compression is rejected by the schema
+	badCompression := bytes.Replace(templateData, []byte("compression: zstd"), []byte("compression: brotli"), 1)
+	if _, err := parseYAMLTemplate(badCompression, false); err == nil {
+		t.Error("expected schema error for unsupported compression")
+	}
+}
+
+func TestValidateSubvolumes(t *testing.T) {
+	tests := []struct {
+		name      string
+		partition PartitionInfo
+		wantErr   string
+	}{
+		{name: "no subvolumes", partition: PartitionInfo{ID: "data", FsType: "ext4"}},
+		{name: "valid", partition: PartitionInfo{ID: "rootfs", FsType: "btrfs", MountPoint: "/", Subvolumes: []BtrfsSubvolume{
+			{Name: "@", MountPoint: "/"}, {Name: "@/var", MountPoint: "/var"}, {Name: "@snapshots"},
+		}}},
+		{name: "not btrfs", partition: PartitionInfo{ID: "rootfs", FsType: "ext4", Subvolumes: []BtrfsSubvolume{{Name: "@"}}},
+			wantErr: "require fsType btrfs"},
+		{name: "absolute name", partition: PartitionInfo{ID: "rootfs", FsType: "btrfs", Subvolumes: []BtrfsSubvolume{{Name: "/@"}}},
+			wantErr: "invalid subvolume name"},
+		{name: "parent traversal", partition: PartitionInfo{ID: "rootfs", FsType: "btrfs", Subvolumes: []BtrfsSubvolume{{Name: "@/../x"}}},
+			wantErr: "invalid subvolume name"},
+		{name: "duplicate", partition: PartitionInfo{ID: "rootfs", FsType: "btrfs", Subvolumes: []BtrfsSubvolume{{Name: "@"}, {Name: "@"}}},
+			wantErr: "duplicate subvolume"},
+		{name: "parent missing", partition: PartitionInfo{ID: "rootfs", FsType: "btrfs", Subvolumes: []BtrfsSubvolume{{Name: "@/var"}, {Name: "@"}}},
+			wantErr: "must be listed after its parent"},
+		{name: "relative mount point", partition: PartitionInfo{ID: "rootfs", FsType: "btrfs", Subvolumes: []BtrfsSubvolume{{Name: "@", MountPoint: "home"}}},
+			wantErr: "must be absolute"},
+		{name: "shared mount point", partition: PartitionInfo{ID: "rootfs", FsType: "btrfs", Subvolumes: []BtrfsSubvolume{
+			{Name: "@a", MountPoint: "/data"}, {Name: "@b", MountPoint: "/data"},
+		}}, wantErr: "used by more than one subvolume"},
+		{name: "root subvolume on non-root partition", partition: PartitionInfo{ID: "data", FsType: "btrfs", MountPoint: "/data", Subvolumes: []BtrfsSubvolume{
+			{Name: "@", MountPoint: "/"},
+		}}, wantErr: "partition mountPoint must be /"},
+		{name: "absolute snapshot", partition: PartitionInfo{ID: "rootfs", FsType: "btrfs", Subvolumes: []BtrfsSubvolume{{Name: "@", Snapshot: "/snap"}}},
+			wantErr: "invalid snapshot name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.partition.validateSubvolumes()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseYAMLTemplateVolumeGroups(t *testing.T) {
+	templateData := []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+disk:
+  name: default
+  partitions:
+    - id: boot
+      fsType: fat32
+      mountPoint: /boot/efi
+    - id: pv0
+      fsType: lvm
+  volumeGroups:
+    - name: vg0
+      physicalVolumes: [pv0]
+      logicalVolumes:
+        - id: rootfs
+          size: 4GiB
+          fsType: ext4
+          mountPoint: /
+        - id: var
+          size: 25%
+          fsType: xfs
+          mountPoint: /var
+        - id: log
+          name: var-log
+          size: "0"
+          fsType: ext4
+          mountPoint: /var/log
+`)
+
+	template, err := parseYAMLTemplate(templateData, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	volumes := template.Disk.GetVolumes()
+	if len(volumes) != 5 {
+		t.Fatalf("expected 2 partitions and 3 logical volumes, got %d volumes", len(volumes))
+	}
+	if volumes[4].ID != "log" || volumes[4].Name != "var-log" || volumes[4].MountPoint != "/var/log" {
+		t.Errorf("unexpected logical volume: %+v", volumes[4])
+	}
+	if vg := template.Disk.VolumeGroupOf("var"); vg == nil || vg.Name != "vg0" {
+		t.Errorf("expected var to belong to vg0, got %+v", vg)
+	}
+	if vg := template.Disk.VolumeGroupOf("boot"); vg != nil {
+		t.Errorf("expected boot not to be a logical volume, got %+v", vg)
+	}
+
+	// Unknown logical volume fields are rejected by the schema
+	badField := bytes.Replace(templateData, []byte("size: 25%"), []byte("size: 25%\n          stripes: 2"), 1)
+	if _, err := parseYAMLTemplate(badField, false); err == nil {
+		t.Error("expected schema error for unknown logical volume field")
+	}
+}
+
+func TestValidateVolumeGroups(t *testing.T) {
+	partitions := []PartitionInfo{
+		{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+		{ID: "pv0", FsType: "lvm"},
+	}
+	rootLV := LogicalVolumeInfo{ID: "rootfs", Size: "4GiB", FsType: "ext4", MountPoint: "/"}
+
+	tests := []struct {
+		name    string
+		disk    DiskConfig
+		wantErr string
+	}{
+		{name: "no volume groups", disk: DiskConfig{Partitions: partitions[:1]}},
+		{name: "valid", disk: DiskConfig{Partitions: partitions, VolumeGroups: []VolumeGroupInfo{
+			{Name: "vg0", PhysicalVolumes: []string{"pv0"}, LogicalVolumes: []LogicalVolumeInfo{
+				rootLV, {ID: "var", Size: "50%", FsType: "xfs"}, {ID: "data", Size: "0", FsType: "ext4"},
+			}},
+		}}},
+		{name: "invalid name", disk: DiskConfig{Partitions: partitions, VolumeGroups: []VolumeGroupInfo{
+			{Name: "vg 0", PhysicalVolumes: []string{"pv0"}},
+		}}, wantErr: "invalid volume group name"},
+		{name: "unknown physical volume", disk: DiskConfig{Partitions: partitions, VolumeGroups: []VolumeGroupInfo{
+			{Name: "vg0", PhysicalVolumes: []string{"pv1"}},
+		}}, wantErr: "not found"},
+		{name: "physical volume not lvm", disk: DiskConfig{Partitions: partitions, VolumeGroups: []VolumeGroupInfo{
+			{Name: "vg0", PhysicalVolumes: []string{"boot", "pv0"}},
+		}}, wantErr: "must have fsType lvm"},
+		{name: "shared physical volume", disk: DiskConfig{Partitions: partitions, VolumeGroups: []VolumeGroupInfo{
+			{Name: "vg0", PhysicalVolumes: []string{"pv0"}}, {Name: "vg1", PhysicalVolumes: []string{"pv0"}},
+		}}, wantErr: "already a physical volume"},
+		{name: "unused lvm partition", disk: DiskConfig{Partitions: append(partitions, PartitionInfo{ID: "pv1", FsType: "lvm"}), VolumeGroups: []VolumeGroupInfo{
+			{Name: "vg0", PhysicalVolumes: []string{"pv0"}},
+		}}, wantErr: "not used by any volume group"},
+		{name: "id clash with partition", disk: DiskConfig{Partitions: partitions, VolumeGroups: []VolumeGroupInfo{
+			{Name: "vg0", PhysicalVolumes: []string{"pv0"}, LogicalVolumes: []LogicalVolumeInfo{{ID: "boot", Size: "1GiB", FsType: "ext4"}}},
+		}}, wantErr: "already used"},
+		{name: "remaining space not last", disk: DiskConfig{Partitions: partitions, VolumeGroups: []VolumeGroupInfo{
+			{Name: "vg0", PhysicalVolumes: []string{"pv0"}, LogicalVolumes: []LogicalVolumeInfo{{ID: "data", Size: "0", FsType: "ext4"}, rootLV}},
+		}}, wantErr: "only allowed for the last"},
+		{name: "bad percentage", disk: DiskConfig{Partitions: partitions, VolumeGroups: []VolumeGroupInfo{
+			{Name: "vg0", PhysicalVolumes: []string{"pv0"}, LogicalVolumes: []LogicalVolumeInfo{{ID: "data", Size: "150%", FsType: "ext4"}}},
+		}}, wantErr: "invalid size"},
+		{name: "bad size", disk: DiskConfig{Partitions: partitions, VolumeGroups: []VolumeGroupInfo{
+			{Name: "vg0", PhysicalVolumes: []string{"pv0"}, LogicalVolumes: []LogicalVolumeInfo{{ID: "data", Size: "big", FsType: "ext4"}}},
+		}}, wantErr: "invalid size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.disk.validateVolumeGroups()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseYAMLTemplateRaidArrays(t *testing.T) {
+	templateData := []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: iso
+disk:
+  name: default
+  path: /dev/nvme0n1
+  mirrorPaths: [/dev/nvme1n1]
+  partitions:
+    - id: boot
+      fsType: fat32
+      mountPoint: /boot/efi
+    - id: md-root
+      fsType: raid
+  raidArrays:
+    - id: rootfs
+      name: root
+      level: 1
+      partition: md-root
+      fsType: ext4
+      mountPoint: /
+`)
+
+	template, err := parseYAMLTemplate(templateData, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if paths := template.Disk.TargetPaths(); len(paths) != 2 || paths[0] != "/dev/nvme0n1" || paths[1] != "/dev/nvme1n1" {
+		t.Errorf("unexpected target paths %v", paths)
+	}
+	volumes := template.Disk.GetVolumes()
+	if len(volumes) != 3 || volumes[2].ID != "rootfs" || volumes[2].Name != "root" || volumes[2].MountPoint != "/" {
+		t.Fatalf("expected the array after the partitions, got %+v", volumes)
+	}
+	if array := template.Disk.RaidArrayOf("rootfs"); array == nil || array.MDName() != "root" {
+		t.Errorf("expected rootfs to be the root array, got %+v", array)
+	}
+	if array := template.Disk.RaidArrayOf("boot"); array != nil {
+		t.Errorf("expected boot not to be an array, got %+v", array)
+	}
+
+	// Unsupported levels are rejected by the schema
+	badLevel := bytes.Replace(templateData, []byte("level: 1"), []byte("level: 4"), 1)
+	if _, err := parseYAMLTemplate(badLevel, false); err == nil {
+		t.Error("expected schema error for unsupported RAID level")
+	}
+}
+
+func TestValidateRaidArrays(t *testing.T) {
+	partitions := []PartitionInfo{
+		{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+		{ID: "md-root", FsType: "raid"},
+	}
+	rootArray := RaidArrayInfo{ID: "rootfs", Level: 1, Partition: "md-root", FsType: "ext4", MountPoint: "/"}
+	mirror := []string{"/dev/sdb"}
+
+	tests := []struct {
+		name    string
+		disk    DiskConfig
+		wantErr string
+	}{
+		{name: "no arrays", disk: DiskConfig{Path: "/dev/sda", Partitions: partitions[:1]}},
+		{name: "valid", disk: DiskConfig{Path: "/dev/sda", MirrorPaths: mirror, Partitions: partitions, RaidArrays: []RaidArrayInfo{rootArray}}},
+		{name: "mirror of the primary disk", disk: DiskConfig{Path: "/dev/sda", MirrorPaths: []string{"/dev/sda"}}, wantErr: "invalid mirror disk path"},
+		{name: "unused raid partition", disk: DiskConfig{Path: "/dev/sda", MirrorPaths: mirror, Partitions: partitions}, wantErr: "not used by any RAID array"},
+		{name: "single disk", disk: DiskConfig{Path: "/dev/sda", Partitions: partitions, RaidArrays: []RaidArrayInfo{rootArray}}, wantErr: "needs at least 2 disks"},
+		{name: "raid5 on two disks", disk: DiskConfig{Path: "/dev/sda", MirrorPaths: mirror, Partitions: partitions, RaidArrays: []RaidArrayInfo{
+			{ID: "rootfs", Level: 5, Partition: "md-root", FsType: "ext4"},
+		}}, wantErr: "needs at least 3 disks"},
+		{name: "unsupported level", disk: DiskConfig{Path: "/dev/sda", MirrorPaths: mirror, Partitions: partitions, RaidArrays: []RaidArrayInfo{
+			{ID: "rootfs", Level: 4, Partition: "md-root", FsType: "ext4"},
+		}}, wantErr: "unsupported RAID level"},
+		{name: "member not raid", disk: DiskConfig{Path: "/dev/sda", MirrorPaths: mirror, Partitions: partitions, RaidArrays: []RaidArrayInfo{
+			rootArray, {ID: "esp", Level: 1, Partition: "boot", FsType: "ext4"},
+		}}, wantErr: "must have fsType raid"},
+		{name: "unknown member", disk: DiskConfig{Path: "/dev/sda", MirrorPaths: mirror, Partitions: partitions, RaidArrays: []RaidArrayInfo{
+			{ID: "rootfs", Level: 1, Partition: "md-data", FsType: "ext4"},
+		}}, wantErr: "not found"},
+		{name: "shared member", disk: DiskConfig{Path: "/dev/sda", MirrorPaths: mirror, Partitions: partitions, RaidArrays: []RaidArrayInfo{
+			rootArray, {ID: "data", Level: 1, Partition: "md-root", FsType: "ext4"},
+		}}, wantErr: "already a RAID member"},
+		{name: "id clash with partition", disk: DiskConfig{Path: "/dev/sda", MirrorPaths: mirror, Partitions: partitions, RaidArrays: []RaidArrayInfo{
+			{ID: "boot", Level: 1, Partition: "md-root", FsType: "ext4"},
+		}}, wantErr: "already used"},
+		{name: "esp on array", disk: DiskConfig{Path: "/dev/sda", MirrorPaths: mirror, Partitions: partitions, RaidArrays: []RaidArrayInfo{
+			{ID: "esp", Level: 1, Partition: "md-root", FsType: "fat32", MountPoint: "/boot/efi"},
+		}}, wantErr: "cannot be on a RAID array"},
+		{name: "encryption on mirrored disks", disk: DiskConfig{Path: "/dev/sda", MirrorPaths: mirror, Partitions: append(partitions,
+			PartitionInfo{ID: "data", FsType: "ext4", Encryption: &EncryptionConfig{KeySource: "tpm2"}}), RaidArrays: []RaidArrayInfo{rootArray}},
+			wantErr: "not supported with mirrorPaths"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.disk.validateRaidArrays()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseYAMLTemplatePartitionSizes(t *testing.T) {
+	templateData := []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: iso
+disk:
+  name: default
+  partitions:
+    - id: boot
+      size: 512MiB
+      fsType: fat32
+      mountPoint: /boot/efi
+    - id: rootfs
+      size: rest
+      minSize: 8GiB
+      fsType: ext4
+      mountPoint: /
+    - id: data
+      size: 20%
+      maxSize: 100GiB
+      fsType: ext4
+      mountPoint: /data
+`)
+
+	template, err := parseYAMLTemplate(templateData, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := template.Disk.Partitions[2]
+	if data.Size != "20%" || data.MaxSize != "100GiB" || template.Disk.Partitions[1].MinSize != "8GiB" {
+		t.Errorf("unexpected partition sizes: %+v", template.Disk.Partitions)
+	}
+
+	mixed := bytes.Replace(templateData, []byte("size: 512MiB"), []byte("start: 1MiB\n      end: 513MiB"), 1)
+	if _, err := parseYAMLTemplate(mixed, false); err == nil || !strings.Contains(err.Error(), "either all use size") {
+		t.Errorf("expected error for mixed sizes and offsets, got %v", err)
+	}
+}
+
+func TestValidatePartitionSizes(t *testing.T) {
+	tests := []struct {
+		name       string
+		partitions []PartitionInfo
+		wantErr    string
+	}{
+		{name: "offsets", partitions: []PartitionInfo{{ID: "boot", Start: "1MiB", End: "513MiB"}, {ID: "rootfs", Start: "513MiB", End: "0"}}},
+		{name: "sizes", partitions: []PartitionInfo{
+			{ID: "boot", Size: "512MiB"}, {ID: "rootfs", Size: "rest", MinSize: "4GiB"}, {ID: "data", Size: "20%", MinSize: "1GiB", MaxSize: "64GiB"},
+		}},
+		{name: "mixed", partitions: []PartitionInfo{{ID: "boot", Start: "1MiB", End: "513MiB"}, {ID: "rootfs", Size: "rest"}}, wantErr: "either all use size"},
+		{name: "size with offsets", partitions: []PartitionInfo{{ID: "rootfs", Size: "rest", Start: "1MiB"}}, wantErr: "cannot be combined"},
+		{name: "two rest", partitions: []PartitionInfo{{ID: "rootfs", Size: "rest"}, {ID: "data", Size: "rest"}}, wantErr: "only one partition"},
+		{name: "bad percentage", partitions: []PartitionInfo{{ID: "rootfs", Size: "0%"}}, wantErr: "invalid size"},
+		{name: "bad size", partitions: []PartitionInfo{{ID: "rootfs", Size: "big"}}, wantErr: "invalid size"},
+		{name: "percentages over 100", partitions: []PartitionInfo{{ID: "rootfs", Size: "60%"}, {ID: "data", Size: "50%"}}, wantErr: "add up to 110%"},
+		{name: "bounds on absolute size", partitions: []PartitionInfo{{ID: "boot", Size: "512MiB", MaxSize: "1GiB"}}, wantErr: "only apply to percentage, rest and auto"},
+		{name: "bounds without size", partitions: []PartitionInfo{{ID: "boot", Start: "1MiB", End: "0", MinSize: "1GiB"}}, wantErr: "require size"},
+		{name: "min above max", partitions: []PartitionInfo{{ID: "rootfs", Size: "rest", MinSize: "2GiB", MaxSize: "1024MiB"}}, wantErr: "larger than maxSize"},
+		{name: "bad bound", partitions: []PartitionInfo{{ID: "rootfs", Size: "rest", MinSize: "2 GiB"}}, wantErr: "minSize"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			disk := DiskConfig{Partitions: tt.partitions}
+			err := disk.validatePartitionSizes()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateEncryption(t *testing.T) {
+	tests := []struct {
+		name      string
+		partition PartitionInfo
+		wantErr   string
+	}{
+		{name: "not encrypted", partition: PartitionInfo{ID: "data", FsType: "ext4"}},
+		{name: "keyfile", partition: PartitionInfo{ID: "data", FsType: "ext4", MountPoint: "/data",
+			Encryption: &EncryptionConfig{KeySource: "keyfile", KeyFile: "/keys/data.key"}}},
+		{name: "tpm2 with generated key", partition: PartitionInfo{ID: "rootfs", FsType: "ext4", MountPoint: "/",
+			Encryption: &EncryptionConfig{Type: "luks2", KeySource: "tpm2", KeySize: 256}}},
+		{name: "luks1", partition: PartitionInfo{ID: "data", Encryption: &EncryptionConfig{Type: "luks1", KeySource: "tpm2"}},
+			wantErr: "unsupported encryption type"},
+		{name: "encrypted esp", partition: PartitionInfo{ID: "boot", MountPoint: "/boot/efi", Encryption: &EncryptionConfig{KeySource: "tpm2"}},
+			wantErr: "cannot be encrypted"},
+		{name: "keyfile without key", partition: PartitionInfo{ID: "data", Encryption: &EncryptionConfig{KeySource: "keyfile"}},
+			wantErr: "requires keyFile"},
+		{name: "unknown key source", partition: PartitionInfo{ID: "data", Encryption: &EncryptionConfig{KeySource: "passphrase"}},
+			wantErr: "unsupported encryption keySource"},
+		{name: "odd key size", partition: PartitionInfo{ID: "data", Encryption: &EncryptionConfig{KeySource: "tpm2", KeySize: 100}},
+			wantErr: "invalid encryption keySize"},
+		{name: "bad name", partition: PartitionInfo{ID: "data", Encryption: &EncryptionConfig{KeySource: "tpm2", Name: "my data"}},
+			wantErr: "invalid encrypted volume name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.partition.validateEncryption()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseYAMLTemplateEncryption(t *testing.T) {
+	templateData := []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+disk:
+  name: default
+  partitions:
+    - id: rootfs
+      fsType: ext4
+      mountPoint: /
+      encryption:
+        keySource: tpm2
+    - id: data
+      fsType: ext4
+      mountPoint: /data
+      encryption:
+        keySource: keyfile
+        keyFile: /keys/data.key
+        cipher: aes-xts-plain64
+        name: cryptdata
+`)
+
+	template, err := parseYAMLTemplate(templateData, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name := template.Disk.Partitions[0].LuksName(); name != "luks-rootfs" {
+		t.Errorf("expected default name luks-rootfs, got %q", name)
+	}
+	if name := template.Disk.Partitions[1].LuksName(); name != "cryptdata" {
+		t.Errorf("expected name cryptdata, got %q", name)
+	}
+
+	// Two containers cannot share a device-mapper name
+	duplicate := bytes.Replace(templateData, []byte("name: cryptdata"), []byte("name: luks-rootfs"), 1)
+	if _, err := parseYAMLTemplate(duplicate, false); err == nil || !strings.Contains(err.Error(), "used more than once") {
+		t.Errorf("expected duplicate name error, got %v", err)
+	}
+
+	// Unknown key sources are rejected by the schema
+	badSource := bytes.Replace(templateData, []byte("keySource: tpm2"), []byte("keySource: fido2"), 1)
+	if _, err := parseYAMLTemplate(badSource, false); err == nil {
+		t.Error("expected schema error for unsupported key source")
+	}
+}
+
+func TestValidateBuilder(t *testing.T) {
+	partitions := []PartitionInfo{
+		{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+		{ID: "rootfs", FsType: "ext4", MountPoint: "/"},
+	}
+
+	tests := []struct {
+		name    string
+		disk    DiskConfig
+		wantErr string
+	}{
+		{name: "default builder", disk: DiskConfig{Partitions: partitions}},
+		{name: "loopless", disk: DiskConfig{Builder: DiskBuilderLoopless, PartitionTableType: "gpt", Partitions: append(partitions,
+			PartitionInfo{ID: "usr", FsType: "squashfs", MountPoint: "/usr"})}},
+		{name: "unknown builder", disk: DiskConfig{Builder: "fuse", Partitions: partitions}, wantErr: "unsupported disk builder"},
+		{name: "squashfs with loop builder", disk: DiskConfig{Partitions: append(partitions,
+			PartitionInfo{ID: "usr", FsType: "squashfs", MountPoint: "/usr"})}, wantErr: "requires the loopless builder"},
+		{name: "erofs root with loop builder", disk: DiskConfig{Partitions: []PartitionInfo{
+			{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+			{ID: "rootfs", FsType: "erofs", MountPoint: "/"},
+		}}},
+		{name: "loopless erofs", disk: DiskConfig{Builder: DiskBuilderLoopless, Partitions: append(partitions,
+			PartitionInfo{ID: "usr", FsType: "erofs", MountPoint: "/usr", Size: "auto"})}},
+		{name: "loopless mbr", disk: DiskConfig{Builder: DiskBuilderLoopless, PartitionTableType: "mbr", Partitions: partitions}, wantErr: "only supports gpt"},
+		{name: "loopless lvm", disk: DiskConfig{Builder: DiskBuilderLoopless, Partitions: partitions, VolumeGroups: []VolumeGroupInfo{{Name: "vg0"}}},
+			wantErr: "does not support volume groups"},
+		{name: "loopless encryption", disk: DiskConfig{Builder: DiskBuilderLoopless, Partitions: append(partitions,
+			PartitionInfo{ID: "data", FsType: "ext4", Encryption: &EncryptionConfig{KeySource: "tpm2"}})}, wantErr: "does not support encryption"},
+		{name: "loopless xfs", disk: DiskConfig{Builder: DiskBuilderLoopless, Partitions: append(partitions,
+			PartitionInfo{ID: "data", FsType: "xfs", MountPoint: "/data"})}, wantErr: "does not support fsType xfs"},
+		{name: "loopless auto", disk: DiskConfig{Builder: DiskBuilderLoopless, Size: "auto+10%", Partitions: []PartitionInfo{
+			{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi", Size: "64MiB"},
+			{ID: "rootfs", FsType: "ext4", MountPoint: "/", Size: "rest"},
+		}}},
+		{name: "auto disk with loop builder", disk: DiskConfig{Size: "auto", Partitions: partitions}, wantErr: "disk size auto requires the loopless builder"},
+		{name: "auto partition with loop builder", disk: DiskConfig{Size: "8GiB", Partitions: []PartitionInfo{
+			{ID: "rootfs", FsType: "ext4", MountPoint: "/", Size: "auto"},
+		}}, wantErr: "size auto requires the loopless builder"},
+		{name: "auto swap", disk: DiskConfig{Builder: DiskBuilderLoopless, Size: "auto", Partitions: []PartitionInfo{
+			{ID: "rootfs", FsType: "ext4", MountPoint: "/", Size: "auto"},
+			{ID: "swap", FsType: "linux-swap", Size: "rest"},
+		}}, wantErr: "size auto requires a mount point"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.disk.validateBuilder()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if !(DiskConfig{Builder: DiskBuilderLoopless}).IsLoopless() || (DiskConfig{}).IsLoopless() {
+		t.Error("IsLoopless does not match the builder")
+	}
+}
+
+func TestParseAutoSize(t *testing.T) {
+	tests := []struct {
+		size         string
+		wantAuto     bool
+		wantHeadroom int
+		wantErr      bool
+	}{
+		{size: "auto", wantAuto: true},
+		{size: "auto+15%", wantAuto: true, wantHeadroom: 15},
+		{size: "4GiB"},
+		{size: "rest"},
+		{size: "auto+0%", wantErr: true},
+		{size: "auto+15", wantErr: true},
+		{size: "automatic", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			auto, headroom, err := ParseAutoSize(tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAutoSize(%q) error = %v, wantErr %v", tt.size, err, tt.wantErr)
+			}
+			if auto != tt.wantAuto || headroom != tt.wantHeadroom {
+				t.Errorf("ParseAutoSize(%q) = %v, %d, want %v, %d", tt.size, auto, headroom, tt.wantAuto, tt.wantHeadroom)
+			}
+		})
+	}
+}
+
+func TestValidateAutoPartitionSizes(t *testing.T) {
+	tests := []struct {
+		name    string
+		disk    DiskConfig
+		wantErr string
+	}{
+		{name: "auto partitions on fixed disk", disk: DiskConfig{Size: "8GiB", Partitions: []PartitionInfo{
+			{ID: "boot", Size: "auto+5%", MinSize: "64MiB"},
+			{ID: "rootfs", Size: "rest"},
+		}}},
+		{name: "auto disk", disk: DiskConfig{Size: "auto", Partitions: []PartitionInfo{
+			{ID: "boot", Size: "256MiB"},
+			{ID: "rootfs", Size: "auto", MaxSize: "4GiB"},
+		}}},
+		{name: "invalid auto size", disk: DiskConfig{Size: "8GiB", Partitions: []PartitionInfo{
+			{ID: "rootfs", Size: "auto+x%"},
+		}}, wantErr: "invalid size"},
+		{name: "invalid auto disk size", disk: DiskConfig{Size: "auto-5%", Partitions: []PartitionInfo{
+			{ID: "rootfs", Size: "auto"},
+		}}, wantErr: "invalid size"},
+		{name: "percentage on auto disk", disk: DiskConfig{Size: "auto", Partitions: []PartitionInfo{
+			{ID: "boot", Size: "10%"},
+			{ID: "rootfs", Size: "auto"},
+		}}, wantErr: "require a fixed disk size"},
+		{name: "auto disk with offsets", disk: DiskConfig{Size: "auto", Partitions: []PartitionInfo{
+			{ID: "rootfs", Start: "1MiB", End: "0"},
+		}}, wantErr: "requires partitions laid out by size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.disk.validatePartitionSizes()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	disk := DiskConfig{Size: "auto"}
+	if !disk.IsAutoSized() || !disk.IsAutoSizedPartition(PartitionInfo{Size: "rest"}) || disk.IsAutoSizedPartition(PartitionInfo{Size: "1GiB"}) {
+		t.Error("rest partitions of an auto sized disk are auto sized")
+	}
+	if (DiskConfig{Size: "8GiB"}).IsAutoSizedPartition(PartitionInfo{Size: "rest"}) {
+		t.Error("rest partitions of a fixed size disk are not auto sized")
+	}
+}
+
+func TestValidateReadOnlyRoot(t *testing.T) {
+	newTemplate := func(fsType string, immutable bool, builder string) *ImageTemplate {
+		template := &ImageTemplate{Disk: DiskConfig{Builder: builder, Partitions: []PartitionInfo{
+			{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+			{ID: "rootfs", FsType: fsType, MountPoint: "/"},
+		}}}
+		template.SystemConfig.Immutability.Enabled = immutable
+		return template
+	}
+
+	if err := newTemplate("erofs", true, "").validatePartitions(); err != nil {
+		t.Errorf("unexpected error for an immutable erofs root: %v", err)
+	}
+	if err := newTemplate("squashfs", false, DiskBuilderLoopless).validatePartitions(); err != nil {
+		t.Errorf("unexpected error for a loopless squashfs root: %v", err)
+	}
+	if err := newTemplate("squashfs", false, "").validatePartitions(); err == nil || !strings.Contains(err.Error(), "requires immutability or the loopless builder") {
+		t.Errorf("expected immutability error, got %v", err)
+	}
+
+	root, ok := newTemplate("erofs", true, "").Disk.ReadOnlyRoot()
+	if !ok || root.ID != "rootfs" {
+		t.Errorf("expected the erofs root partition, got %+v", root)
+	}
+	if _, ok := newTemplate("ext4", true, "").Disk.ReadOnlyRoot(); ok {
+		t.Error("an ext4 root is not read-only")
+	}
+}
+
+func TestValidateGrowRoot(t *testing.T) {
+	tests := []struct {
+		name       string
+		partitions []PartitionInfo
+		immutable  bool
+		wantErr    string
+	}{
+		{name: "root last", partitions: []PartitionInfo{
+			{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+			{ID: "rootfs", FsType: "ext4", MountPoint: "/"},
+		}},
+		{name: "root not last", partitions: []PartitionInfo{
+			{ID: "rootfs", FsType: "ext4", MountPoint: "/"},
+			{ID: "data", FsType: "ext4", MountPoint: "/data"},
+		}, wantErr: "to be the last partition"},
+		{name: "read-only root", partitions: []PartitionInfo{
+			{ID: "rootfs", FsType: "squashfs", MountPoint: "/"},
+		}, wantErr: "does not support fsType squashfs"},
+		{name: "encrypted root", partitions: []PartitionInfo{
+			{ID: "rootfs", FsType: "ext4", MountPoint: "/", Encryption: &EncryptionConfig{KeySource: "tpm2"}},
+		}, wantErr: "encrypted root partition"},
+		{name: "root on a logical volume", partitions: []PartitionInfo{
+			{ID: "pv", FsType: "lvm"},
+		}, wantErr: "root filesystem on a partition"},
+		{name: "dm-verity", immutable: true, partitions: []PartitionInfo{
+			{ID: "rootfs", FsType: "ext4", MountPoint: "/"},
+		}, wantErr: "not supported with immutability"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &ImageTemplate{Disk: DiskConfig{GrowRoot: true, Partitions: tt.partitions}}
+			template.SystemConfig.Immutability.Enabled = tt.immutable
+			err := template.validateGrowRoot()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if err := (&ImageTemplate{}).validateGrowRoot(); err != nil {
+		t.Errorf("expected no error without growRoot, got %v", err)
+	}
+}
+
+func TestGPTAttributes(t *testing.T) {
+	partition := PartitionInfo{ID: "root-a", Attributes: []string{"Required", "read-only", "grow-fs", "62"}, Priority: 15, Tries: 7, Successful: true}
+	attrs, err := partition.GPTAttributes()
+	if err != nil {
+		t.Fatalf("GPTAttributes failed: %v", err)
+	}
+	if want := uint64(1<<0 | 1<<59 | 1<<60 | 1<<62 | 15<<48 | 7<<52 | 1<<56); attrs != want {
+		t.Fatalf("expected attributes %#x, got %#x", want, attrs)
+	}
+	names := strings.Join(GPTAttributeNamesOf(attrs), ",")
+	if names != "required,priority=15,tries=7,successful,grow-fs,read-only,bit62" {
+		t.Errorf("unexpected attribute names %q", names)
+	}
+	if len(GPTAttributeNamesOf(0)) != 0 {
+		t.Error("expected no names without attributes")
+	}
+
+	for _, bad := range []PartitionInfo{
+		{ID: "p", Attributes: []string{"hidden"}},
+		{ID: "p", Attributes: []string{"47"}},
+		{ID: "p", Attributes: []string{"64"}},
+		{ID: "p", Priority: 16},
+		{ID: "p", Tries: -1},
+	} {
+		if _, err := bad.GPTAttributes(); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+}
+
+func TestValidateGPTIdentity(t *testing.T) {
+	partitions := func() []PartitionInfo {
+		return []PartitionInfo{
+			{ID: "esp", FsType: "fat32", MountPoint: "/boot/efi", PartUUID: "0f2a6b1c-3d4e-4f50-8a6b-7c8d9e0f1a2b"},
+			{ID: "rootfs", FsType: "ext4", MountPoint: "/", Attributes: []string{"grow-fs"}, Priority: 1},
+		}
+	}
+	tests := []struct {
+		name    string
+		modify  func(d *DiskConfig)
+		wantErr string
+	}{
+		{name: "valid", modify: func(d *DiskConfig) {
+			d.DiskGUID = "5c3d4d4e-7d8a-4b8e-9c1f-2a6b3c4d5e6f"
+			d.HybridMBR = []string{"esp"}
+		}},
+		{name: "invalid disk GUID", modify: func(d *DiskConfig) { d.DiskGUID = "not-a-guid" }, wantErr: "invalid diskGUID"},
+		{name: "invalid partUUID", modify: func(d *DiskConfig) { d.Partitions[1].PartUUID = "xyz" }, wantErr: "invalid partUUID"},
+		{name: "duplicate partUUID", modify: func(d *DiskConfig) {
+			d.Partitions[1].PartUUID = strings.ToUpper(d.Partitions[0].PartUUID)
+		}, wantErr: "already used by partition 'esp'"},
+		{name: "unknown attribute", modify: func(d *DiskConfig) { d.Partitions[1].Attributes = []string{"hidden"} }, wantErr: "unknown GPT attribute"},
+		{name: "mbr attributes", modify: func(d *DiskConfig) {
+			d.PartitionTableType = "mbr"
+			d.Partitions[0].PartUUID = ""
+		}, wantErr: "GPT attributes require a gpt partition table"},
+		{name: "mirrored partUUID", modify: func(d *DiskConfig) {
+			d.MirrorPaths = []string{"/dev/sdb"}
+		}, wantErr: "partUUID is not supported with mirrorPaths"},
+		{name: "too many hybrid partitions", modify: func(d *DiskConfig) {
+			d.HybridMBR = []string{"esp", "rootfs", "a", "b"}
+		}, wantErr: "at most 3"},
+		{name: "unknown hybrid partition", modify: func(d *DiskConfig) { d.HybridMBR = []string{"data"} }, wantErr: "'data' not found"},
+		{name: "duplicate hybrid partition", modify: func(d *DiskConfig) { d.HybridMBR = []string{"esp", "esp"} }, wantErr: "more than once"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			disk := DiskConfig{Partitions: partitions()}
+			tt.modify(&disk)
+			err := disk.validateGPTIdentity()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseYAMLTemplateGPTIdentity(t *testing.T) {
+	templateData := []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+disk:
+  name: default
+  size: 4GiB
+  diskGUID: 5c3d4d4e-7d8a-4b8e-9c1f-2a6b3c4d5e6f
+  hybridMBR: [boot]
+  partitions:
+    - id: boot
+      fsType: fat32
+      mountPoint: /boot/efi
+      start: 1MiB
+      end: 513MiB
+      attributes: [required, legacy-bios-bootable]
+    - id: rootfs
+      fsType: ext4
+      mountPoint: /
+      start: 513MiB
+      end: "0"
+      partUUID: 0f2a6b1c-3d4e-4f50-8a6b-7c8d9e0f1a2b
+      attributes: ["59"]
+      priority: 15
+      tries: 3
+      successful: true
+`)
+
+	template, err := parseYAMLTemplate(templateData, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	root := template.Disk.Partitions[1]
+	if template.Disk.DiskGUID == "" || len(template.Disk.HybridMBR) != 1 || root.PartUUID == "" ||
+		root.Priority != 15 || root.Tries != 3 || !root.Successful {
+		t.Fatalf("GPT settings not parsed: %+v", template.Disk)
+	}
+
+	// The A/B fields only have 4 bits
+	badPriority := bytes.Replace(templateData, []byte("priority: 15"), []byte("priority: 16"), 1)
+	if _, err := parseYAMLTemplate(badPriority, false); err == nil {
+		t.Error("expected schema error for priority 16")
+	}
+}
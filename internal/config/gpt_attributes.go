@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// GPT partition attribute bits (UEFI specification, section 5.3.3, and the
+// Discoverable Partitions Specification)
+const (
+	GPTAttrRequired           = 0
+	GPTAttrNoBlockIO          = 1
+	GPTAttrLegacyBIOSBootable = 2
+	GPTAttrGrowFS             = 59
+	GPTAttrReadOnly           = 60
+	GPTAttrNoAutomount        = 63
+
+	// The A/B boot fields of the ChromeOS kernel partitions, also read by
+	// other A/B boot schemes
+	GPTAttrPriorityShift   = 48
+	GPTAttrTriesShift      = 52
+	GPTAttrSuccessful      = 56
+	gptAttrABFieldMax      = 15
+	gptAttrFirstTypeBit    = 48
+	gptAttrLastReservedBit = 2
+)
+
+// GPTAttributeNames maps the attribute names accepted in templates to their
+// bit.
+var GPTAttributeNames = map[string]int{
+	"required":             GPTAttrRequired,
+	"no-block-io":          GPTAttrNoBlockIO,
+	"legacy-bios-bootable": GPTAttrLegacyBIOSBootable,
+	"grow-fs":              GPTAttrGrowFS,
+	"read-only":            GPTAttrReadOnly,
+	"no-automount":         GPTAttrNoAutomount,
+}
+
+// maxHybridMBRPartitions is the number of MBR entries left next to the 0xEE
+// entry covering the GPT
+const maxHybridMBRPartitions = 3
+
+// parseGPTAttribute returns the bit of an attribute given by name or number.
+// Bits 3-47 are reserved by the UEFI specification.
+func parseGPTAttribute(attr string) (int, error) {
+	if bit, ok := GPTAttributeNames[strings.ToLower(strings.TrimSpace(attr))]; ok {
+		return bit, nil
+	}
+	bit, err := strconv.Atoi(strings.TrimSpace(attr))
+	if err != nil || bit < 0 || bit > 63 || (bit > gptAttrLastReservedBit && bit < gptAttrFirstTypeBit) {
+		return 0, fmt.Errorf("unknown GPT attribute '%s'", attr)
+	}
+	return bit, nil
+}
+
+// HasGPTAttributes reports whether the partition sets any GPT attribute bit.
+func (p PartitionInfo) HasGPTAttributes() bool {
+	return len(p.Attributes) > 0 || p.Priority != 0 || p.Tries != 0 || p.Successful
+}
+
+// GPTAttributes returns the GPT attribute field of the partition.
+func (p PartitionInfo) GPTAttributes() (uint64, error) {
+	var attrs uint64
+	for _, attr := range p.Attributes {
+		bit, err := parseGPTAttribute(attr)
+		if err != nil {
+			return 0, fmt.Errorf("partition '%s': %w", p.ID, err)
+		}
+		attrs |= 1 << bit
+	}
+	if p.Priority < 0 || p.Priority > gptAttrABFieldMax {
+		return 0, fmt.Errorf("partition '%s': priority %d is out of range 0-%d", p.ID, p.Priority, gptAttrABFieldMax)
+	}
+	if p.Tries < 0 || p.Tries > gptAttrABFieldMax {
+		return 0, fmt.Errorf("partition '%s': tries %d is out of range 0-%d", p.ID, p.Tries, gptAttrABFieldMax)
+	}
+	attrs |= uint64(p.Priority) << GPTAttrPriorityShift
+	attrs |= uint64(p.Tries) << GPTAttrTriesShift
+	if p.Successful {
+		attrs |= 1 << GPTAttrSuccessful
+	}
+	return attrs, nil
+}
+
+// GPTAttributeNamesOf returns the names of the bits set in attrs in bit
+// order: the named attributes, "priority=N", "tries=N" and "successful" for
+// the A/B fields and "bitN" for the other bits.
+func GPTAttributeNamesOf(attrs uint64) []string {
+	bitNames := make(map[int]string, len(GPTAttributeNames))
+	for name, bit := range GPTAttributeNames {
+		bitNames[bit] = name
+	}
+	var names []string
+	for bit := 0; bit < 64; bit++ {
+		switch {
+		case bit == GPTAttrPriorityShift || bit == GPTAttrTriesShift:
+			if field := (attrs >> bit) & gptAttrABFieldMax; field != 0 {
+				name := "priority"
+				if bit == GPTAttrTriesShift {
+					name = "tries"
+				}
+				names = append(names, fmt.Sprintf("%s=%d", name, field))
+			}
+		case bit > GPTAttrPriorityShift && bit < GPTAttrSuccessful, attrs&(1<<bit) == 0:
+		case bit == GPTAttrSuccessful:
+			names = append(names, "successful")
+		case bitNames[bit] != "":
+			names = append(names, bitNames[bit])
+		default:
+			names = append(names, fmt.Sprintf("bit%d", bit))
+		}
+	}
+	return names
+}
+
+// validateGPTIdentity checks the partition GUIDs, attributes, disk GUID and
+// hybrid MBR of the disk. They only exist in GPT partition tables.
+func (d *DiskConfig) validateGPTIdentity() error {
+	isGPT := d.PartitionTableType == "" || d.PartitionTableType == "gpt"
+	if d.DiskGUID != "" {
+		if !isGPT {
+			return fmt.Errorf("diskGUID requires a gpt partition table")
+		}
+		if _, err := uuid.Parse(d.DiskGUID); err != nil {
+			return fmt.Errorf("invalid diskGUID '%s': %w", d.DiskGUID, err)
+		}
+	}
+
+	// Every target disk gets the same partitions, so the GUIDs would clash
+	if len(d.MirrorPaths) > 0 && d.DiskGUID != "" {
+		return fmt.Errorf("diskGUID is not supported with mirrorPaths")
+	}
+	partUUIDs := make(map[string]string)
+	ids := make(map[string]bool)
+	for _, partition := range d.Partitions {
+		ids[partition.ID] = true
+		if partition.PartUUID != "" {
+			if !isGPT {
+				return fmt.Errorf("partition '%s': partUUID requires a gpt partition table", partition.ID)
+			}
+			if len(d.MirrorPaths) > 0 {
+				return fmt.Errorf("partition '%s': partUUID is not supported with mirrorPaths", partition.ID)
+			}
+			parsed, err := uuid.Parse(partition.PartUUID)
+			if err != nil {
+				return fmt.Errorf("partition '%s': invalid partUUID '%s': %w", partition.ID, partition.PartUUID, err)
+			}
+			if other, ok := partUUIDs[parsed.String()]; ok {
+				return fmt.Errorf("partition '%s': partUUID is already used by partition '%s'", partition.ID, other)
+			}
+			partUUIDs[parsed.String()] = partition.ID
+		}
+		if partition.HasGPTAttributes() {
+			if !isGPT {
+				return fmt.Errorf("partition '%s': GPT attributes require a gpt partition table", partition.ID)
+			}
+			if _, err := partition.GPTAttributes(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(d.HybridMBR) == 0 {
+		return nil
+	}
+	if !isGPT {
+		return fmt.Errorf("hybridMBR requires a gpt partition table")
+	}
+	if len(d.HybridMBR) > maxHybridMBRPartitions {
+		return fmt.Errorf("hybridMBR lists %d partitions, at most %d fit next to the GPT protective entry", len(d.HybridMBR), maxHybridMBRPartitions)
+	}
+	listed := make(map[string]bool)
+	for _, id := range d.HybridMBR {
+		if !ids[id] {
+			return fmt.Errorf("hybridMBR partition '%s' not found", id)
+		}
+		if listed[id] {
+			return fmt.Errorf("hybridMBR lists partition '%s' more than once", id)
+		}
+		listed[id] = true
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,7 +13,6 @@ import (
 	"github.com/open-edge-platform/os-image-composer/internal/config"
 	"github.com/open-edge-platform/os-image-composer/internal/config/version"
 	"github.com/open-edge-platform/os-image-composer/internal/ospackage"
-	"github.com/open-edge-platform/os-image-composer/internal/utils/file"
 	"github.com/open-edge-platform/os-image-composer/internal/utils/logger"
 	"github.com/open-edge-platform/os-image-composer/internal/utils/security"
 )
@@ -83,6 +83,16 @@ type SPDXChecksum struct {
 	ChecksumValue string `json:"checksumValue"`
 }
 
+// SPDXOptions controls the volatile fields of a generated SPDX document.
+// The zero value stamps the document with the current time and a random
+// namespace.
+type SPDXOptions struct {
+	// Created overrides the creation timestamp (for example SOURCE_DATE_EPOCH)
+	Created time.Time
+	// NamespaceSeed derives a stable document namespace instead of a random one
+	NamespaceSeed string
+}
+
 var log = logger.Logger()
 
 // WriteManifestToFile writes the manifest to the specified output file.
@@ -121,6 +131,13 @@ func WriteManifestToFile(manifest SoftwarePackageManifest, outputFile string) er
 }
 
 func WriteSPDXToFile(pkgs []ospackage.PackageInfo, outFile string) error {
+	return WriteSPDXToFileWithOptions(pkgs, outFile, SPDXOptions{})
+}
+
+// WriteSPDXToFileWithOptions writes an SPDX document for pkgs to outFile.
+// Packages are always emitted sorted by name and version so the document
+// does not depend on download or query order.
+func WriteSPDXToFileWithOptions(pkgs []ospackage.PackageInfo, outFile string, opts SPDXOptions) error {
 
 	log.Infof("Generating SPDX manifest for %d packages", len(pkgs))
 
@@ -131,14 +148,30 @@ func WriteSPDXToFile(pkgs []ospackage.PackageInfo, outFile string) error {
 		"MD5":    true,
 	}
 
+	created := opts.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	created = created.UTC()
+
+	sorted := make([]ospackage.PackageInfo, len(pkgs))
+	copy(sorted, pkgs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].Version < sorted[j].Version
+	})
+	pkgs = sorted
+
 	spdx := SPDXDocument{
 		SPDXVersion:       SPDXVersion,
 		DataLicense:       SPDXDataLicense,
 		SPDXID:            SPDXDocumentID,
-		DocumentName:      fmt.Sprintf("%s-%s", version.Toolname, time.Now().UTC().Format("20060102T150405Z")),
-		DocumentNamespace: generateDocumentNamespace(),
+		DocumentName:      fmt.Sprintf("%s-%s", version.Toolname, created.Format("20060102T150405Z")),
+		DocumentNamespace: generateDocumentNamespace(opts.NamespaceSeed),
 		CreationInfo: CreationInfo{
-			Created: time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+			Created: created.Format("2006-01-02T15:04:05Z"),
 			Creators: []string{
 				fmt.Sprintf("Tool: %s %s", version.Toolname, version.Version),
 				fmt.Sprintf("Organization: %s", version.Organization),
@@ -214,8 +247,15 @@ func fallbackToDefault(val, fallback string) string {
 	return val
 }
 
-func generateDocumentNamespace() string {
-	return fmt.Sprintf("%s/%s-%s", SPDXNamespaceBase, version.Toolname, uuid.New().String())
+// generateDocumentNamespace returns a unique SPDX document namespace. A
+// non-empty seed yields a name-based UUID so reproducible builds produce the
+// same namespace for the same input.
+func generateDocumentNamespace(seed string) string {
+	id := uuid.New()
+	if seed != "" {
+		id = uuid.NewSHA1(uuid.NameSpaceURL, []byte(SPDXNamespaceBase+"/"+seed))
+	}
+	return fmt.Sprintf("%s/%s-%s", SPDXNamespaceBase, version.Toolname, id.String())
 }
 
 func spdxSupplier(origin string) string {
@@ -278,24 +318,5 @@ func CopySBOMToImageBuildDir(imageBuildDir string) error {
 // This embeds the SBOM inside the image for CVE scanning and compliance tools
 func CopySBOMToChroot(chrootPath string) error {
 	log.Infof("Copying SBOM into image filesystem at %s", ImageSBOMPath)
-
-	// Source: SBOM in temp directory (same location where it was generated)
-	srcSBOM := filepath.Join(config.TempDir(), DefaultSPDXFile)
-
-	// Destination: SBOM inside the chroot filesystem
-	dstSBOM := filepath.Join(chrootPath, ImageSBOMPath, DefaultSPDXFile)
-
-	// Check if source SBOM exists
-	if _, err := os.Stat(srcSBOM); os.IsNotExist(err) {
-		log.Warnf("SBOM file not found at %s, skipping copy to chroot", srcSBOM)
-		return nil
-	}
-
-	if err := file.CopyFile(srcSBOM, dstSBOM, "--preserve=mode", true); err != nil {
-		log.Errorf("Failed to copy SBOM into image filesystem: %v", err)
-		return fmt.Errorf("failed to copy SBOM into image filesystem: %w", err)
-	}
-
-	log.Infof("Successfully copied SBOM into image filesystem at: %s", dstSBOM)
-	return nil
+	return CopySBOMToDir(filepath.Join(chrootPath, ImageSBOMPath))
 }
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/open-edge-platform/os-image-composer/internal/config"
 	"github.com/open-edge-platform/os-image-composer/internal/config/version"
@@ -142,8 +143,8 @@ func TestFallbackToDefault(t *testing.T) {
 }
 
 func TestGenerateDocumentNamespace(t *testing.T) {
-	ns1 := generateDocumentNamespace()
-	ns2 := generateDocumentNamespace()
+	ns1 := generateDocumentNamespace("")
+	ns2 := generateDocumentNamespace("")
 	if ns1 == ns2 {
 		t.Errorf("Expected different namespaces, got %q and %q", ns1, ns2)
 	}
@@ -152,6 +153,54 @@ func TestGenerateDocumentNamespace(t *testing.T) {
 	}
 }
 
+func TestGenerateDocumentNamespace_Seeded(t *testing.T) {
+	ns1 := generateDocumentNamespace("abc123")
+	ns2 := generateDocumentNamespace("abc123")
+	if ns1 != ns2 {
+		t.Errorf("Expected identical namespaces for the same seed, got %q and %q", ns1, ns2)
+	}
+	if ns1 == generateDocumentNamespace("def456") {
+		t.Errorf("Expected different namespaces for different seeds")
+	}
+}
+
+func TestWriteSPDXToFileWithOptions_Deterministic(t *testing.T) {
+	tmpDir := t.TempDir()
+	pkgs := []ospackage.PackageInfo{
+		{Name: "zlib", Version: "1.3", Type: "deb"},
+		{Name: "bash", Version: "5.2", Type: "deb"},
+		{Name: "bash", Version: "5.1", Type: "deb"},
+	}
+	opts := SPDXOptions{Created: time.Unix(1700000000, 0), NamespaceSeed: "template-hash"}
+
+	first := filepath.Join(tmpDir, "first.json")
+	second := filepath.Join(tmpDir, "second.json")
+	if err := WriteSPDXToFileWithOptions(pkgs, first, opts); err != nil {
+		t.Fatalf("WriteSPDXToFileWithOptions failed: %v", err)
+	}
+	reversed := []ospackage.PackageInfo{pkgs[2], pkgs[1], pkgs[0]}
+	if err := WriteSPDXToFileWithOptions(reversed, second, opts); err != nil {
+		t.Fatalf("WriteSPDXToFileWithOptions failed: %v", err)
+	}
+
+	data1, _ := os.ReadFile(first)
+	data2, _ := os.ReadFile(second)
+	if string(data1) != string(data2) {
+		t.Fatalf("Expected identical SPDX documents, got:\n%s\n---\n%s", data1, data2)
+	}
+
+	var doc SPDXDocument
+	if err := json.Unmarshal(data1, &doc); err != nil {
+		t.Fatalf("Failed to parse SPDX JSON: %v", err)
+	}
+	if doc.CreationInfo.Created != "2023-11-14T22:13:20Z" {
+		t.Errorf("Expected clamped creation time, got %q", doc.CreationInfo.Created)
+	}
+	if doc.Packages[0].Name != "bash" || doc.Packages[0].VersionInfo != "5.1" || doc.Packages[2].Name != "zlib" {
+		t.Errorf("Expected packages sorted by name and version, got %+v", doc.Packages)
+	}
+}
+
 func TestSpdxSupplier(t *testing.T) {
 	tests := []struct {
 		origin string
@@ -0,0 +1,228 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/file"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/security"
+)
+
+// SBOM embedding locations
+const (
+	SBOMLocationRootfs    = "rootfs"
+	SBOMLocationESP       = "esp"
+	SBOMLocationPartition = "partition"
+	SBOMLocationUKI       = "uki"
+	SBOMLocationNone      = "none"
+
+	// SBOMPointerPath is the well-known rootfs file that tells inspectors where
+	// the embedded SBOM lives
+	SBOMPointerPath = "/usr/lib/sbom-location.json"
+	// UKISBOMSection is the PE section of the UKI that carries the SBOM
+	UKISBOMSection = ".sbom"
+	// DefaultPartitionSBOMPath is the SBOM directory on the ESP or a dedicated partition
+	DefaultPartitionSBOMPath = "/sbom"
+	// UKIPath is the UKI location on the ESP for systemd-boot images
+	UKIPath = "/EFI/Linux/linux.efi"
+
+	espMountPoint = "/boot/efi"
+)
+
+// SBOMPointer is the content of the SBOM pointer file.
+type SBOMPointer struct {
+	Format    string `json:"format"`
+	Location  string `json:"location"`
+	Partition string `json:"partition,omitempty"` // GPT partition name (or filesystem label) for esp, partition and uki
+	Path      string `json:"path"`                // SBOM file path, or the UKI path for uki, inside that filesystem
+	Section   string `json:"section,omitempty"`   // PE section for uki
+	FileName  string `json:"fileName"`
+	SHA256    string `json:"sha256,omitempty"`
+}
+
+// SBOMPlacement is a validated SBOM embedding configuration.
+type SBOMPlacement struct {
+	Location  string
+	Dir       string                // Directory inside the target filesystem (rootfs, esp, partition)
+	Partition *config.PartitionInfo // Target partition (esp, partition, uki)
+	UKIPath   string                // UKI carrying the SBOM on the ESP (uki)
+}
+
+// ResolveSBOMPlacement applies defaults to the template SBOM configuration and
+// checks it against the disk layout and bootloader.
+func ResolveSBOMPlacement(template *config.ImageTemplate) (*SBOMPlacement, error) {
+	sbomConfig := template.GetSBOMConfig()
+	placement := &SBOMPlacement{Location: sbomConfig.Location, Dir: sbomConfig.Path}
+	if placement.Location == "" {
+		placement.Location = SBOMLocationRootfs
+	}
+
+	partitions := template.GetDiskConfig().Partitions
+	findPartition := func(match func(config.PartitionInfo) bool) *config.PartitionInfo {
+		for i := range partitions {
+			if match(partitions[i]) {
+				return &partitions[i]
+			}
+		}
+		return nil
+	}
+	isESP := func(p config.PartitionInfo) bool { return p.MountPoint == espMountPoint }
+
+	switch placement.Location {
+	case SBOMLocationNone:
+		return placement, nil
+	case SBOMLocationRootfs:
+		if placement.Dir == "" {
+			placement.Dir = ImageSBOMPath
+		}
+	case SBOMLocationESP:
+		if placement.Partition = findPartition(isESP); placement.Partition == nil {
+			return nil, fmt.Errorf("sbom location %q requires a partition mounted at %s", placement.Location, espMountPoint)
+		}
+		if placement.Dir == "" {
+			placement.Dir = DefaultPartitionSBOMPath
+		}
+	case SBOMLocationPartition:
+		if sbomConfig.Partition == "" {
+			return nil, fmt.Errorf("sbom location %q requires a partition ID", placement.Location)
+		}
+		placement.Partition = findPartition(func(p config.PartitionInfo) bool { return p.ID == sbomConfig.Partition })
+		if placement.Partition == nil {
+			return nil, fmt.Errorf("sbom partition %q not found in disk configuration", sbomConfig.Partition)
+		}
+		if placement.Dir == "" {
+			placement.Dir = DefaultPartitionSBOMPath
+		}
+	case SBOMLocationUKI:
+		if template.GetBootloaderConfig().Provider != "systemd-boot" {
+			return nil, fmt.Errorf("sbom location %q requires the systemd-boot bootloader provider", placement.Location)
+		}
+		if placement.Partition = findPartition(isESP); placement.Partition == nil {
+			return nil, fmt.Errorf("sbom location %q requires a partition mounted at %s", placement.Location, espMountPoint)
+		}
+		// Every boot entry has its own UKI, the default one is referenced
+		placement.UKIPath = UKIPath
+		if id := template.DefaultBootEntry(); id != "" {
+			placement.UKIPath = path.Join(path.Dir(UKIPath), id+".efi")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported sbom location %q", placement.Location)
+	}
+
+	if placement.Dir != "" && !strings.HasPrefix(placement.Dir, "/") {
+		return nil, fmt.Errorf("sbom path %q must be absolute", placement.Dir)
+	}
+	return placement, nil
+}
+
+// Pointer returns the pointer file content for an SBOM with the given name
+// and content hash.
+func (p *SBOMPlacement) Pointer(fileName, sha256Hex string) SBOMPointer {
+	pointer := SBOMPointer{
+		Format:   "spdx",
+		Location: p.Location,
+		Path:     path.Join(p.Dir, fileName),
+		FileName: fileName,
+		SHA256:   sha256Hex,
+	}
+	if p.Partition != nil {
+		pointer.Partition = p.Partition.Name
+		if pointer.Partition == "" {
+			pointer.Partition = p.Partition.ID
+		}
+	}
+	if p.Location == SBOMLocationUKI {
+		pointer.Path = p.UKIPath
+		if pointer.Path == "" {
+			pointer.Path = UKIPath
+		}
+		pointer.Section = UKISBOMSection
+	}
+	return pointer
+}
+
+// ParseSBOMPointer decodes an SBOM pointer file.
+func ParseSBOMPointer(data []byte) (*SBOMPointer, error) {
+	var pointer SBOMPointer
+	if err := json.Unmarshal(data, &pointer); err != nil {
+		return nil, fmt.Errorf("failed to parse SBOM pointer: %w", err)
+	}
+	if pointer.Location == "" || pointer.Path == "" {
+		return nil, fmt.Errorf("SBOM pointer is missing location or path")
+	}
+	return &pointer, nil
+}
+
+// GeneratedSBOMPath returns the path of the SBOM generated for the current build.
+func GeneratedSBOMPath() string {
+	return filepath.Join(config.TempDir(), DefaultSPDXFile)
+}
+
+// EmbedSBOMInRootfs copies the generated SBOM into the image root filesystem
+// when the template places it there, and writes the pointer file for every
+// location except none. SBOMs placed on other partitions are copied later
+// with CopySBOMToDir once those filesystems are final.
+func EmbedSBOMInRootfs(chrootPath string, template *config.ImageTemplate) error {
+	placement, err := ResolveSBOMPlacement(template)
+	if err != nil {
+		return err
+	}
+	if placement.Location == SBOMLocationNone {
+		log.Infof("SBOM embedding disabled by template")
+		return nil
+	}
+
+	srcSBOM := GeneratedSBOMPath()
+	if _, err := os.Stat(srcSBOM); os.IsNotExist(err) {
+		log.Warnf("SBOM file not found at %s, skipping embedding", srcSBOM)
+		return nil
+	}
+	data, err := security.SafeReadFile(srcSBOM, security.RejectSymlinks)
+	if err != nil {
+		return fmt.Errorf("failed to read SBOM file: %w", err)
+	}
+
+	if placement.Location == SBOMLocationRootfs {
+		if err := CopySBOMToDir(filepath.Join(chrootPath, placement.Dir)); err != nil {
+			return err
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	pointer := placement.Pointer(DefaultSPDXFile, hex.EncodeToString(sum[:]))
+	pointerData, err := json.MarshalIndent(pointer, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal SBOM pointer: %w", err)
+	}
+	pointerFile := filepath.Join(chrootPath, SBOMPointerPath)
+	if err := file.Write(string(pointerData)+"\n", pointerFile); err != nil {
+		log.Errorf("Failed to write SBOM pointer file: %v", err)
+		return fmt.Errorf("failed to write SBOM pointer file: %w", err)
+	}
+	log.Infof("SBOM pointer written to %s (location: %s, path: %s)", SBOMPointerPath, pointer.Location, pointer.Path)
+	return nil
+}
+
+// CopySBOMToDir copies the generated SBOM into dstDir on the host.
+func CopySBOMToDir(dstDir string) error {
+	srcSBOM := GeneratedSBOMPath()
+	if _, err := os.Stat(srcSBOM); os.IsNotExist(err) {
+		log.Warnf("SBOM file not found at %s, skipping copy", srcSBOM)
+		return nil
+	}
+
+	dstSBOM := filepath.Join(dstDir, DefaultSPDXFile)
+	if err := file.CopyFile(srcSBOM, dstSBOM, "--preserve=mode", true); err != nil {
+		log.Errorf("Failed to copy SBOM to %s: %v", dstDir, err)
+		return fmt.Errorf("failed to copy SBOM to %s: %w", dstDir, err)
+	}
+	log.Infof("Successfully copied SBOM to: %s", dstSBOM)
+	return nil
+}
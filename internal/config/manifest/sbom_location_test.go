@@ -0,0 +1,185 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func sbomTestTemplate(sbom config.SBOMConfig, provider string) *config.ImageTemplate {
+	return &config.ImageTemplate{
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", Name: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+				{ID: "rootfs", Name: "rootfs", FsType: "ext4", MountPoint: "/"},
+				{ID: "meta", FsType: "ext4"},
+			},
+		},
+		SystemConfig: config.SystemConfig{
+			Bootloader: config.Bootloader{BootType: "efi", Provider: provider},
+		},
+		SBOM: sbom,
+	}
+}
+
+func TestResolveSBOMPlacement(t *testing.T) {
+	tests := []struct {
+		name          string
+		sbom          config.SBOMConfig
+		provider      string
+		wantLocation  string
+		wantDir       string
+		wantPartition string
+		wantErr       string
+	}{
+		{name: "default", wantLocation: SBOMLocationRootfs, wantDir: ImageSBOMPath},
+		{name: "rootfs custom path", sbom: config.SBOMConfig{Location: "rootfs", Path: "/usr/share/sbom"},
+			wantLocation: SBOMLocationRootfs, wantDir: "/usr/share/sbom"},
+		{name: "none", sbom: config.SBOMConfig{Location: "none"}, wantLocation: SBOMLocationNone},
+		{name: "esp", sbom: config.SBOMConfig{Location: "esp"},
+			wantLocation: SBOMLocationESP, wantDir: DefaultPartitionSBOMPath, wantPartition: "boot"},
+		{name: "partition", sbom: config.SBOMConfig{Location: "partition", Partition: "meta", Path: "/spdx"},
+			wantLocation: SBOMLocationPartition, wantDir: "/spdx", wantPartition: "meta"},
+		{name: "partition without id", sbom: config.SBOMConfig{Location: "partition"}, wantErr: "requires a partition ID"},
+		{name: "unknown partition", sbom: config.SBOMConfig{Location: "partition", Partition: "data"}, wantErr: "not found"},
+		{name: "uki", sbom: config.SBOMConfig{Location: "uki"}, provider: "systemd-boot",
+			wantLocation: SBOMLocationUKI, wantPartition: "boot"},
+		{name: "uki with grub", sbom: config.SBOMConfig{Location: "uki"}, provider: "grub2", wantErr: "systemd-boot"},
+		{name: "relative path", sbom: config.SBOMConfig{Location: "rootfs", Path: "sbom"}, wantErr: "must be absolute"},
+		{name: "unsupported", sbom: config.SBOMConfig{Location: "tpm"}, wantErr: "unsupported sbom location"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			placement, err := ResolveSBOMPlacement(sbomTestTemplate(tt.sbom, tt.provider))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if placement.Location != tt.wantLocation || placement.Dir != tt.wantDir {
+				t.Errorf("got location %q dir %q, want %q %q", placement.Location, placement.Dir, tt.wantLocation, tt.wantDir)
+			}
+			gotPartition := ""
+			if placement.Partition != nil {
+				gotPartition = placement.Partition.ID
+			}
+			if gotPartition != tt.wantPartition {
+				t.Errorf("got partition %q, want %q", gotPartition, tt.wantPartition)
+			}
+		})
+	}
+}
+
+func TestSBOMPlacementPointer(t *testing.T) {
+	template := sbomTestTemplate(config.SBOMConfig{Location: "partition", Partition: "meta"}, "systemd-boot")
+	placement, err := ResolveSBOMPlacement(template)
+	if err != nil {
+		t.Fatalf("ResolveSBOMPlacement failed: %v", err)
+	}
+	pointer := placement.Pointer(DefaultSPDXFile, "abc")
+	// Unnamed partitions are referenced by ID
+	if pointer.Partition != "meta" || pointer.Path != "/sbom/"+DefaultSPDXFile || pointer.SHA256 != "abc" {
+		t.Errorf("unexpected partition pointer: %+v", pointer)
+	}
+
+	template.SBOM = config.SBOMConfig{Location: "uki"}
+	placement, err = ResolveSBOMPlacement(template)
+	if err != nil {
+		t.Fatalf("ResolveSBOMPlacement failed: %v", err)
+	}
+	pointer = placement.Pointer(DefaultSPDXFile, "abc")
+	if pointer.Partition != "boot" || pointer.Path != UKIPath || pointer.Section != UKISBOMSection {
+		t.Errorf("unexpected uki pointer: %+v", pointer)
+	}
+
+	// With boot entries the SBOM is read from the UKI of the default entry
+	template.SystemConfig.Kernel.BootEntries = []config.BootEntry{{ID: "production"}, {ID: "debug"}}
+	placement, err = ResolveSBOMPlacement(template)
+	if err != nil {
+		t.Fatalf("ResolveSBOMPlacement failed: %v", err)
+	}
+	if pointer = placement.Pointer(DefaultSPDXFile, "abc"); pointer.Path != "/EFI/Linux/production.efi" {
+		t.Errorf("unexpected boot entry uki pointer: %+v", pointer)
+	}
+}
+
+func TestParseSBOMPointer(t *testing.T) {
+	pointer, err := ParseSBOMPointer([]byte(`{"format":"spdx","location":"esp","partition":"boot","path":"/sbom/x.json","fileName":"x.json"}`))
+	if err != nil {
+		t.Fatalf("ParseSBOMPointer failed: %v", err)
+	}
+	if pointer.Location != SBOMLocationESP || pointer.Partition != "boot" || pointer.Path != "/sbom/x.json" {
+		t.Errorf("unexpected pointer: %+v", pointer)
+	}
+
+	if _, err := ParseSBOMPointer([]byte(`{"location":"esp"}`)); err == nil {
+		t.Error("expected error for pointer without path")
+	}
+	if _, err := ParseSBOMPointer([]byte(`not json`)); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestEmbedSBOMInRootfs(t *testing.T) {
+	tempDir := t.TempDir()
+
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	if err := os.WriteFile(filepath.Join(tempDir, DefaultSPDXFile), []byte(`{"spdxVersion":"SPDX-2.3"}`), 0644); err != nil {
+		t.Fatalf("Failed to create dummy SBOM: %v", err)
+	}
+
+	// Default location copies the SBOM and writes the pointer
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mkdir -p", Output: "", Error: nil},
+		{Pattern: "cp --preserve=mode .*" + DefaultSPDXFile + "' '/chroot" + ImageSBOMPath, Output: "", Error: nil},
+		{Pattern: "cp .*filewrite-.* '/chroot" + SBOMPointerPath + "'", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := EmbedSBOMInRootfs("/chroot", sbomTestTemplate(config.SBOMConfig{}, "grub2")); err != nil {
+		t.Fatalf("EmbedSBOMInRootfs failed: %v", err)
+	}
+
+	// ESP placement only writes the pointer into the rootfs
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mkdir -p", Output: "", Error: nil},
+		{Pattern: "cp .*filewrite-.* '/chroot" + SBOMPointerPath + "'", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := EmbedSBOMInRootfs("/chroot", sbomTestTemplate(config.SBOMConfig{Location: "esp"}, "grub2")); err != nil {
+		t.Fatalf("EmbedSBOMInRootfs failed for esp location: %v", err)
+	}
+
+	// Disabled embedding runs no commands
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := EmbedSBOMInRootfs("/chroot", sbomTestTemplate(config.SBOMConfig{Location: "none"}, "grub2")); err != nil {
+		t.Fatalf("EmbedSBOMInRootfs failed for none location: %v", err)
+	}
+
+	// Pointer write failures are reported
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("permission denied")},
+	})
+	if err := EmbedSBOMInRootfs("/chroot", sbomTestTemplate(config.SBOMConfig{Location: "esp"}, "grub2")); err == nil {
+		t.Fatal("expected error when the pointer file cannot be written")
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// MeasuredBootConfig makes ukify sign the PCR 11 values of the UKI, so that
+// devices can bind LUKS and other TPM secrets to the images signed with the
+// key instead of to a single PCR value
+type MeasuredBootConfig struct {
+	PCRPrivateKey string   `yaml:"pcrPrivateKey,omitempty"` // PCRPrivateKey: PEM private key signing the PCR 11 policy stored in the .pcrsig section
+	PCRPublicKey  string   `yaml:"pcrPublicKey,omitempty"`  // PCRPublicKey: PEM public key stored in the .pcrpkey section, derived from PCRPrivateKey when empty
+	Banks         []string `yaml:"banks,omitempty"`         // Banks: PCR banks the policy is signed for (default sha256)
+	Phases        []string `yaml:"phases,omitempty"`        // Phases: boot phase paths the policy is signed for, the ukify defaults when empty
+}
+
+// DefaultPCRBank is the PCR bank of the policy when the template names none
+const DefaultPCRBank = "sha256"
+
+// pcrBanks are the banks ukify signs policies for
+var pcrBanks = map[string]bool{"sha1": true, "sha256": true, "sha384": true, "sha512": true}
+
+// pcrPhasePattern matches a boot phase path such as enter-initrd:leave-initrd
+var pcrPhasePattern = regexp.MustCompile(`^[a-z][a-z-]*(:[a-z][a-z-]*)*$`)
+
+// IsEnabled reports whether the UKI carries a signed PCR policy.
+func (m MeasuredBootConfig) IsEnabled() bool {
+	return m.PCRPrivateKey != ""
+}
+
+// PCRBanks returns the PCR banks of the signed policy and of the predicted
+// PCR values.
+func (m MeasuredBootConfig) PCRBanks() []string {
+	if len(m.Banks) == 0 {
+		return []string{DefaultPCRBank}
+	}
+	return m.Banks
+}
+
+func (m MeasuredBootConfig) validate() error {
+	if !m.IsEnabled() {
+		if m.PCRPublicKey != "" || len(m.Banks) > 0 || len(m.Phases) > 0 {
+			return fmt.Errorf("measuredBoot requires pcrPrivateKey")
+		}
+		return nil
+	}
+	for _, bank := range m.Banks {
+		if !pcrBanks[bank] {
+			return fmt.Errorf("unsupported PCR bank '%s'", bank)
+		}
+	}
+	for _, phase := range m.Phases {
+		if !pcrPhasePattern.MatchString(phase) {
+			return fmt.Errorf("invalid boot phase path '%s'", phase)
+		}
+	}
+	return nil
+}
+
+// validateMeasuredBoot checks that the merged template boots a UKI whose
+// measurements can be predicted: systemd-boot started by the firmware.
+func (t *ImageTemplate) validateMeasuredBoot() error {
+	if !t.MeasuredBoot.IsEnabled() {
+		return nil
+	}
+	bootloader := t.GetBootloaderConfig()
+	if bootloader.Provider != "systemd-boot" || bootloader.BootType != "efi" {
+		return fmt.Errorf("measuredBoot requires the systemd-boot bootloader with efi boot")
+	}
+	if bootloader.IsShimChain() {
+		return fmt.Errorf("measuredBoot is not supported with the shim boot chain")
+	}
+	return t.MeasuredBoot.validate()
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestParseYAMLTemplateMeasuredBoot(t *testing.T) {
+	base := `image:
+  name: lab
+  version: "1.0"
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: lab
+measuredBoot:
+`
+	template, err := parseYAMLTemplate([]byte(base+"  pcrPrivateKey: /keys/pcr.key\n  banks: [sha256, sha384]\n  phases: [\"enter-initrd\", \"enter-initrd:leave-initrd\"]\n"), false)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed: %v", err)
+	}
+	if !template.MeasuredBoot.IsEnabled() || len(template.MeasuredBoot.PCRBanks()) != 2 || len(template.MeasuredBoot.Phases) != 2 {
+		t.Errorf("unexpected measured boot config %+v", template.MeasuredBoot)
+	}
+	if banks := (MeasuredBootConfig{PCRPrivateKey: "/keys/pcr.key"}).PCRBanks(); len(banks) != 1 || banks[0] != DefaultPCRBank {
+		t.Errorf("unexpected default banks %v", banks)
+	}
+
+	for _, invalid := range []string{
+		"  pcrPublicKey: /keys/pcr.pub\n",
+		"  banks: [sha256]\n",
+		"  pcrPrivateKey: /keys/pcr.crt\n",
+		"  pcrPrivateKey: /keys/pcr.key\n  banks: [md5]\n",
+		"  pcrPrivateKey: /keys/pcr.key\n  banks: []\n",
+		"  pcrPrivateKey: /keys/pcr.key\n  phases: [\"Enter-Initrd\"]\n",
+		"  pcrPrivateKey: /keys/pcr.key\n  phases: [\"enter-initrd:\"]\n",
+		"  pcrPrivateKey: /keys/pcr.key\n  pcrSignature: /keys/pcr.sig\n",
+	} {
+		if _, err := parseYAMLTemplate([]byte(base+invalid), false); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestValidateMeasuredBoot(t *testing.T) {
+	template := &ImageTemplate{
+		SystemConfig: SystemConfig{Bootloader: Bootloader{BootType: "efi", Provider: "systemd-boot"}},
+		MeasuredBoot: MeasuredBootConfig{PCRPrivateKey: "/keys/pcr.key"},
+	}
+	if err := template.validateMeasuredBoot(); err != nil {
+		t.Errorf("validateMeasuredBoot failed: %v", err)
+	}
+
+	for _, bootloader := range []Bootloader{
+		{BootType: "efi", Provider: "grub"},
+		{BootType: "legacy", Provider: "grub"},
+		{BootType: "efi", Provider: "systemd-boot", Chain: BootChainShim, MOKKey: "/keys/MOK.key", MOKCrt: "/keys/MOK.crt"},
+	} {
+		template.SystemConfig.Bootloader = bootloader
+		if err := template.validateMeasuredBoot(); err == nil {
+			t.Errorf("expected error for bootloader %+v", bootloader)
+		}
+	}
+
+	// Without a PCR policy any bootloader goes
+	template.MeasuredBoot = MeasuredBootConfig{}
+	if err := template.validateMeasuredBoot(); err != nil {
+		t.Errorf("validateMeasuredBoot failed without measured boot: %v", err)
+	}
+}
+
+func TestMergeMeasuredBoot(t *testing.T) {
+	defaultTemplate := &ImageTemplate{
+		Image:        ImageInfo{Name: "default", Version: "1.0"},
+		Target:       TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64", ImageType: "raw"},
+		SystemConfig: SystemConfig{Name: "default", Bootloader: Bootloader{BootType: "efi", Provider: "systemd-boot"}},
+		MeasuredBoot: MeasuredBootConfig{PCRPrivateKey: "/keys/default.key", Banks: []string{"sha256", "sha384"}},
+	}
+	userTemplate := &ImageTemplate{
+		Image:        ImageInfo{Name: "lab", Version: "1.0"},
+		Target:       defaultTemplate.Target,
+		SystemConfig: SystemConfig{Name: "lab"},
+	}
+
+	merged, err := MergeConfigurations(userTemplate, defaultTemplate)
+	if err != nil {
+		t.Fatalf("MergeConfigurations failed: %v", err)
+	}
+	if merged.MeasuredBoot.PCRPrivateKey != "/keys/default.key" || len(merged.MeasuredBoot.Banks) != 2 {
+		t.Errorf("expected the default measured boot config, got %+v", merged.MeasuredBoot)
+	}
+
+	// The user section replaces the default one as a whole
+	userTemplate.MeasuredBoot = MeasuredBootConfig{PCRPrivateKey: "/keys/lab.key"}
+	merged, err = MergeConfigurations(userTemplate, defaultTemplate)
+	if err != nil {
+		t.Fatalf("MergeConfigurations failed: %v", err)
+	}
+	if merged.MeasuredBoot.PCRPrivateKey != "/keys/lab.key" || len(merged.MeasuredBoot.Banks) != 0 {
+		t.Errorf("expected the user measured boot config, got %+v", merged.MeasuredBoot)
+	}
+
+	userTemplate.SystemConfig.Bootloader = Bootloader{BootType: "efi", Provider: "grub"}
+	if _, err := MergeConfigurations(userTemplate, defaultTemplate); err == nil {
+		t.Error("expected an error for measured boot with grub")
+	}
+}
@@ -105,6 +105,9 @@ func MergeConfigurations(userTemplate, defaultTemplate *ImageTemplate) (*ImageTe
 	if userTemplate.Image.Version != "" {
 		mergedTemplate.Image.Version = userTemplate.Image.Version
 	}
+	if userTemplate.Image.Reproducible {
+		mergedTemplate.Image.Reproducible = true
+	}
 
 	mergedTemplate.Target = userTemplate.Target
 
@@ -132,11 +135,57 @@ func MergeConfigurations(userTemplate, defaultTemplate *ImageTemplate) (*ImageTe
 		log.Debugf("Merged %d package repositories", len(mergedTemplate.PackageRepositories))
 	}
 
+	// Provenance configuration - user values override defaults
+	mergedTemplate.Provenance = mergeProvenanceConfig(defaultTemplate.Provenance, userTemplate.Provenance)
+
+	// Artifact signing configuration - a user signing key replaces the default one entirely
+	mergedTemplate.ArtifactSigning = defaultTemplate.ArtifactSigning
+	if userTemplate.ArtifactSigning.Key != "" {
+		mergedTemplate.ArtifactSigning = userTemplate.ArtifactSigning
+	}
+
+	// SBOM embedding - the fields depend on the location, so a user location replaces the default section
+	mergedTemplate.SBOM = defaultTemplate.SBOM
+	if userTemplate.SBOM.Location != "" {
+		mergedTemplate.SBOM = userTemplate.SBOM
+	}
+
+	// Update scheme - user values override defaults
+	mergedTemplate.Updates = defaultTemplate.Updates
+	if userTemplate.Updates.Scheme != "" {
+		mergedTemplate.Updates = userTemplate.Updates
+	}
+
+	// Measured boot - a user PCR signing key replaces the default section
+	mergedTemplate.MeasuredBoot = defaultTemplate.MeasuredBoot
+	if userTemplate.MeasuredBoot.IsEnabled() {
+		mergedTemplate.MeasuredBoot = userTemplate.MeasuredBoot
+	}
+
 	log.Infof("Successfully merged user and default configurations")
 
 	// Validate immutability configuration and fix if needed
 	validateAndFixImmutabilityConfig(&mergedTemplate)
 
+	// The update slots depend on the final partitions and immutability
+	if err := mergedTemplate.ExpandUpdateSlots(); err != nil {
+		return nil, fmt.Errorf("invalid update configuration: %w", err)
+	}
+	if err := mergedTemplate.validateMeasuredBoot(); err != nil {
+		return nil, fmt.Errorf("invalid measured boot configuration: %w", err)
+	}
+	if err := mergedTemplate.validateBootEntries(); err != nil {
+		return nil, fmt.Errorf("invalid boot menu configuration: %w", err)
+	}
+	if err := validateUsers(mergedTemplate.SystemConfig.Users); err != nil {
+		return nil, fmt.Errorf("invalid user configuration: %w", err)
+	}
+	if !isEmptySystemConfig(userTemplate.SystemConfig) {
+		if err := checkKernelCmdlineMerge(defaultTemplate.SystemConfig.Kernel, userTemplate.SystemConfig.Kernel); err != nil {
+			return nil, fmt.Errorf("invalid kernel command line: %w", err)
+		}
+	}
+
 	// Debug mode: Pretty print the merged template with sensitive data redacted
 	if IsDebugMode() {
 		redactedTemplate := redactSensitiveData(&mergedTemplate)
@@ -160,6 +209,17 @@ func redactSensitiveData(template *ImageTemplate) *ImageTemplate {
 	// Create a deep copy
 	redacted := *template
 	redacted.SystemConfig = redactSensitiveSystemConfig(template.SystemConfig)
+
+	// Signing keys may be PKCS#11 URIs holding the PIN of the token
+	if template.ArtifactSigning.Key != "" {
+		redacted.ArtifactSigning.Key = "[REDACTED]"
+	}
+	if template.Provenance.SigningKey != "" {
+		redacted.Provenance.SigningKey = "[REDACTED]"
+	}
+	if template.MeasuredBoot.PCRPrivateKey != "" {
+		redacted.MeasuredBoot.PCRPrivateKey = "[REDACTED]"
+	}
 	return &redacted
 }
 
@@ -194,6 +254,12 @@ func redactSensitiveSystemConfig(config SystemConfig) SystemConfig {
 	if config.Immutability.SecureBootDBCer != "" {
 		redacted.Immutability.SecureBootDBCer = "[REDACTED]"
 	}
+	if config.Immutability.ModuleSigningKey != "" {
+		redacted.Immutability.ModuleSigningKey = "[REDACTED]"
+	}
+	if config.Bootloader.MOKKey != "" {
+		redacted.Bootloader.MOKKey = "[REDACTED]"
+	}
 
 	return redacted
 }
@@ -276,6 +342,22 @@ func mergeImmutabilityConfig(defaultImmutability, userImmutability ImmutabilityC
 		merged.SecureBootDBCer = userImmutability.SecureBootDBCer
 	}
 
+	if userImmutability.SecureBootKeys != "" {
+		merged.SecureBootKeys = userImmutability.SecureBootKeys
+	}
+
+	if userImmutability.SecureBootEnroll != "" {
+		merged.SecureBootEnroll = userImmutability.SecureBootEnroll
+	}
+
+	if userImmutability.ModuleSigningKey != "" {
+		merged.ModuleSigningKey = userImmutability.ModuleSigningKey
+	}
+
+	if userImmutability.ModuleSigningCrt != "" {
+		merged.ModuleSigningCrt = userImmutability.ModuleSigningCrt
+	}
+
 	return merged
 }
 
@@ -385,13 +467,31 @@ func mergeUserConfig(defaultUser, userUser UserConfig) UserConfig {
 		merged.Shell = userUser.Shell
 	}
 
-	// Merge groups
+	if userUser.UID != nil {
+		merged.UID = userUser.UID
+	}
+	if userUser.GID != nil {
+		merged.GID = userUser.GID
+	}
+	if userUser.SSHAuthorizedKeysFile != "" {
+		merged.SSHAuthorizedKeysFile = userUser.SSHAuthorizedKeysFile
+	}
+	if userUser.Expire != "" {
+		merged.Expire = userUser.Expire
+	}
+
+	// Merge groups and SSH keys
 	if len(userUser.Groups) > 0 {
 		merged.Groups = mergeStringSlices(defaultUser.Groups, userUser.Groups)
 	}
+	if len(userUser.SSHAuthorizedKeys) > 0 {
+		merged.SSHAuthorizedKeys = mergeStringSlices(defaultUser.SSHAuthorizedKeys, userUser.SSHAuthorizedKeys)
+	}
 
-	// Override sudo setting
+	// Override sudo, system and lock settings
 	merged.Sudo = userUser.Sudo
+	merged.System = userUser.System
+	merged.LockPassword = userUser.LockPassword
 
 	return merged
 }
@@ -430,6 +530,21 @@ func mergeBootloader(defaultBootloader, userBootloader Bootloader) Bootloader {
 	if userBootloader.Provider != "" {
 		merged.Provider = userBootloader.Provider
 	}
+	if userBootloader.Chain != "" {
+		merged.Chain = userBootloader.Chain
+	}
+	if userBootloader.MOKKey != "" {
+		merged.MOKKey = userBootloader.MOKKey
+	}
+	if userBootloader.MOKCrt != "" {
+		merged.MOKCrt = userBootloader.MOKCrt
+	}
+	if userBootloader.Timeout != nil {
+		merged.Timeout = userBootloader.Timeout
+	}
+	if userBootloader.DefaultEntry != "" {
+		merged.DefaultEntry = userBootloader.DefaultEntry
+	}
 
 	return merged
 }
@@ -469,9 +584,8 @@ func mergeKernelConfig(defaultKernel, userKernel KernelConfig) KernelConfig {
 	if userKernel.Version != "" {
 		merged.Version = userKernel.Version
 	}
-	if userKernel.Cmdline != "" {
-		merged.Cmdline = userKernel.Cmdline
-	}
+	// Fragments are additive, cmdline is replaced
+	merged.Cmdline, merged.CmdlineFragments = mergeKernelCmdline(defaultKernel, userKernel)
 
 	if len(userKernel.Packages) > 0 {
 		merged.Packages = userKernel.Packages
@@ -482,11 +596,30 @@ func mergeKernelConfig(defaultKernel, userKernel KernelConfig) KernelConfig {
 		merged.EnableExtraModules = userKernel.EnableExtraModules
 	}
 
+	// The boot menu of the user replaces the default one
+	if len(userKernel.BootEntries) > 0 {
+		merged.BootEntries = userKernel.BootEntries
+	}
+
 	// Note: name and uki fields come from defaults and are preserved
 
 	return merged
 }
 
+// mergeProvenanceConfig merges provenance attestation configurations
+func mergeProvenanceConfig(defaultProvenance, userProvenance ProvenanceConfig) ProvenanceConfig {
+	merged := defaultProvenance
+
+	if userProvenance.BuilderID != "" {
+		merged.BuilderID = userProvenance.BuilderID
+	}
+	if userProvenance.SigningKey != "" {
+		merged.SigningKey = userProvenance.SigningKey
+	}
+
+	return merged
+}
+
 func mergePackageRepositories(defaultRepos, userRepos []PackageRepository) []PackageRepository {
 	if len(userRepos) == 0 {
 		return defaultRepos
@@ -528,7 +661,8 @@ func isEmptySystemConfig(config SystemConfig) bool {
 }
 
 func isEmptyBootloader(bootloader Bootloader) bool {
-	return bootloader.BootType == "" && bootloader.Provider == ""
+	return bootloader.BootType == "" && bootloader.Provider == "" && bootloader.Chain == "" &&
+		bootloader.Timeout == nil && bootloader.DefaultEntry == ""
 }
 
 // validateAndFixImmutabilityConfig checks if immutability is enabled but hash partition is missing
@@ -583,6 +717,15 @@ func LoadAndMergeTemplate(templatePath string) (*ImageTemplate, error) {
 		log.Debugf("Default template: %+v", defaultTemplate)
 		log.Warnf("Could not load default configuration: %v", err)
 		log.Info("Proceeding with user template only")
+		if err := userTemplate.ExpandUpdateSlots(); err != nil {
+			return nil, fmt.Errorf("invalid update configuration: %w", err)
+		}
+		if err := userTemplate.validateMeasuredBoot(); err != nil {
+			return nil, fmt.Errorf("invalid measured boot configuration: %w", err)
+		}
+		if err := userTemplate.validateBootEntries(); err != nil {
+			return nil, fmt.Errorf("invalid boot menu configuration: %w", err)
+		}
 		return userTemplate, nil
 	}
 
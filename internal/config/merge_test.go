@@ -98,6 +98,104 @@ func TestMergeConfigurationsImageInfo(t *testing.T) {
 	}
 }
 
+func TestMergeConfigurationsProvenance(t *testing.T) {
+	defaultTemplate := &ImageTemplate{
+		Image:      ImageInfo{Name: "default", Version: "1.0.0"},
+		Provenance: ProvenanceConfig{BuilderID: "https://default.example.com", SigningKey: "/keys/default.pem"},
+	}
+
+	userTemplate := &ImageTemplate{
+		Image:      ImageInfo{Name: "user", Version: "2.0.0"},
+		Provenance: ProvenanceConfig{BuilderID: "https://ci.example.com"},
+	}
+
+	result, err := MergeConfigurations(userTemplate, defaultTemplate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Provenance.BuilderID != "https://ci.example.com" {
+		t.Errorf("expected user builder ID, got '%s'", result.Provenance.BuilderID)
+	}
+	if result.Provenance.SigningKey != "/keys/default.pem" {
+		t.Errorf("expected default signing key to be kept, got '%s'", result.Provenance.SigningKey)
+	}
+}
+
+func TestMergeConfigurationsReproducible(t *testing.T) {
+	defaultTemplate := &ImageTemplate{Image: ImageInfo{Name: "default", Version: "1.0.0"}}
+	userTemplate := &ImageTemplate{Image: ImageInfo{Name: "user", Version: "2.0.0", Reproducible: true}}
+
+	result, err := MergeConfigurations(userTemplate, defaultTemplate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.IsReproducible() {
+		t.Error("expected user reproducible flag to be kept")
+	}
+}
+
+func TestMergeConfigurationsArtifactSigning(t *testing.T) {
+	defaultTemplate := &ImageTemplate{
+		Image:           ImageInfo{Name: "default", Version: "1.0.0"},
+		ArtifactSigning: ArtifactSigningConfig{Method: "gpg", Key: "/keys/default.asc", PassphraseFile: "/keys/pass"},
+	}
+
+	// No user signing config keeps the default
+	result, err := MergeConfigurations(&ImageTemplate{Image: ImageInfo{Name: "user", Version: "2.0.0"}}, defaultTemplate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ArtifactSigning.Key != "/keys/default.asc" {
+		t.Errorf("expected default signing key, got '%s'", result.ArtifactSigning.Key)
+	}
+
+	// A user signing key replaces the whole section so method and passphrase never mix
+	userTemplate := &ImageTemplate{
+		Image:           ImageInfo{Name: "user", Version: "2.0.0"},
+		ArtifactSigning: ArtifactSigningConfig{Method: "cosign", Key: "/keys/cosign.key"},
+	}
+	result, err = MergeConfigurations(userTemplate, defaultTemplate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ArtifactSigning.Method != "cosign" || result.ArtifactSigning.Key != "/keys/cosign.key" {
+		t.Errorf("expected user signing config, got %+v", result.ArtifactSigning)
+	}
+	if result.ArtifactSigning.PassphraseFile != "" {
+		t.Errorf("expected default passphrase file to be dropped, got '%s'", result.ArtifactSigning.PassphraseFile)
+	}
+}
+
+func TestMergeConfigurationsSBOM(t *testing.T) {
+	defaultTemplate := &ImageTemplate{
+		Image: ImageInfo{Name: "default", Version: "1.0.0"},
+		SBOM:  SBOMConfig{Location: "rootfs", Path: "/usr/share/sbom"},
+	}
+
+	// No user SBOM config keeps the default
+	result, err := MergeConfigurations(&ImageTemplate{Image: ImageInfo{Name: "user", Version: "2.0.0"}}, defaultTemplate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.SBOM.Location != "rootfs" || result.SBOM.Path != "/usr/share/sbom" {
+		t.Errorf("expected default SBOM config, got %+v", result.SBOM)
+	}
+
+	// A user location replaces the whole section so a rootfs path never leaks onto a partition
+	userTemplate := &ImageTemplate{
+		Image: ImageInfo{Name: "user", Version: "2.0.0"},
+		SBOM:  SBOMConfig{Location: "partition", Partition: "meta"},
+	}
+	result, err = MergeConfigurations(userTemplate, defaultTemplate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.SBOM.Location != "partition" || result.SBOM.Partition != "meta" || result.SBOM.Path != "" {
+		t.Errorf("expected user SBOM config, got %+v", result.SBOM)
+	}
+}
+
 func TestMergeConfigurationsPathList(t *testing.T) {
 	defaultTemplate := &ImageTemplate{
 		PathList: []string{"/default/path1", "/default/path2"},
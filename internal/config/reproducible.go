@@ -0,0 +1,70 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// SourceDateEpochEnv is the environment variable that pins every timestamp
+// written into a reproducible image (see https://reproducible-builds.org).
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// reproducibleNamespace scopes the identifiers derived for reproducible builds
+// so they never collide with name-based UUIDs generated by other tools.
+var reproducibleNamespace = uuid.NewSHA1(uuid.NameSpaceURL,
+	[]byte("https://github.com/open-edge-platform/os-image-composer/reproducible"))
+
+// IsReproducible returns whether the image must be built bit-for-bit reproducibly
+func (t *ImageTemplate) IsReproducible() bool {
+	return t != nil && t.Image.Reproducible
+}
+
+// GetSourceDateEpoch returns the timestamp that replaces "now" in reproducible
+// builds. It honors SOURCE_DATE_EPOCH and falls back to the Unix epoch.
+func GetSourceDateEpoch() (time.Time, error) {
+	value := strings.TrimSpace(os.Getenv(SourceDateEpochEnv))
+	if value == "" {
+		log.Warnf("%s is not set, using 1970-01-01T00:00:00Z for reproducible build", SourceDateEpochEnv)
+		return time.Unix(0, 0).UTC(), nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, fmt.Errorf("invalid %s value %q: must be a non-negative integer", SourceDateEpochEnv, value)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// GetTemplateHash returns the SHA256 of the merged template. The hash only
+// covers serialized template fields, so it is stable across build hosts,
+// working directories and runs.
+func (t *ImageTemplate) GetTemplateHash() (string, error) {
+	data, err := yaml.Marshal(t)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize template for hashing: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// DeterministicUUID derives a stable UUID for purpose (for example
+// "disk" or "partition/rootfs") from the template hash.
+func (t *ImageTemplate) DeterministicUUID(purpose string) (uuid.UUID, error) {
+	hash, err := t.GetTemplateHash()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return DeriveUUID(hash, purpose), nil
+}
+
+// DeriveUUID returns the name-based UUID for purpose under templateHash.
+func DeriveUUID(templateHash, purpose string) uuid.UUID {
+	return uuid.NewSHA1(reproducibleNamespace, []byte(templateHash+":"+purpose))
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetSourceDateEpoch(t *testing.T) {
+	t.Setenv(SourceDateEpochEnv, "1700000000")
+	epoch, err := GetSourceDateEpoch()
+	if err != nil {
+		t.Fatalf("GetSourceDateEpoch failed: %v", err)
+	}
+	if !epoch.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("expected 1700000000, got %v", epoch.Unix())
+	}
+
+	t.Setenv(SourceDateEpochEnv, "")
+	epoch, err = GetSourceDateEpoch()
+	if err != nil || epoch.Unix() != 0 {
+		t.Errorf("expected Unix epoch fallback, got %v (err %v)", epoch, err)
+	}
+
+	for _, invalid := range []string{"yesterday", "-1", "1.5"} {
+		t.Setenv(SourceDateEpochEnv, invalid)
+		if _, err := GetSourceDateEpoch(); err == nil {
+			t.Errorf("expected error for %s=%q", SourceDateEpochEnv, invalid)
+		}
+	}
+}
+
+func TestIsReproducible(t *testing.T) {
+	var nilTemplate *ImageTemplate
+	if nilTemplate.IsReproducible() {
+		t.Error("nil template must not be reproducible")
+	}
+	template := &ImageTemplate{Image: ImageInfo{Name: "demo", Version: "1.0", Reproducible: true}}
+	if !template.IsReproducible() {
+		t.Error("expected template to be reproducible")
+	}
+}
+
+func TestDeterministicUUID(t *testing.T) {
+	newTemplate := func() *ImageTemplate {
+		return &ImageTemplate{
+			Image:  ImageInfo{Name: "demo", Version: "1.0", Reproducible: true},
+			Target: TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64", ImageType: "raw"},
+			// Runtime-only fields must not affect the hash
+			PathList: []string{"/tmp/" + time.Now().String()},
+		}
+	}
+
+	first, err := newTemplate().DeterministicUUID("disk")
+	if err != nil {
+		t.Fatalf("DeterministicUUID failed: %v", err)
+	}
+	second, _ := newTemplate().DeterministicUUID("disk")
+	if first != second {
+		t.Errorf("expected identical UUIDs for identical templates, got %s and %s", first, second)
+	}
+
+	partition, _ := newTemplate().DeterministicUUID("partition/rootfs")
+	if partition == first {
+		t.Error("expected different UUIDs for different purposes")
+	}
+
+	changed := newTemplate()
+	changed.Image.Version = "1.1"
+	other, _ := changed.DeterministicUUID("disk")
+	if other == first {
+		t.Error("expected different UUIDs for different templates")
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Secure Boot key sets created by "os-image-composer keys generate". A key
+// set is a directory below SecureBootKeysDir holding the platform key (PK),
+// the key exchange key (KEK) and the signature database key (db), each as
+// <name>.key, <name>.crt, <name>.cer, <name>.esl and <name>.auth.
+const (
+	SecureBootPK  = "PK"
+	SecureBootKEK = "KEK"
+	SecureBootDB  = "db"
+
+	// SecureBootGUIDFile holds the owner GUID of the EFI signature lists of a key set
+	SecureBootGUIDFile = "GUID"
+
+	// secureBootKeysDirName is the key set directory below the config directory
+	secureBootKeysDirName = "keys"
+)
+
+// Secure Boot enrollment modes, the values of secure-boot-enroll in the
+// systemd-boot loader.conf
+const (
+	SecureBootEnrollManual = "manual"
+	SecureBootEnrollIfSafe = "if-safe"
+	SecureBootEnrollForce  = "force"
+)
+
+// SecureBootKeyNames lists the keys of a key set in enrollment order
+var SecureBootKeyNames = []string{SecureBootPK, SecureBootKEK, SecureBootDB}
+
+// SecureBootKeysDir returns the directory holding the Secure Boot key sets
+func SecureBootKeysDir() (string, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, secureBootKeysDirName), nil
+}
+
+// SecureBootKeySetDir returns the directory of the Secure Boot key set name
+func SecureBootKeySetDir(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid secure boot key set name %q", name)
+	}
+	keysDir, err := SecureBootKeysDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(keysDir, name), nil
+}
+
+// HasSecureBootEnrollment returns whether the enrollment files of the key set
+// are placed on the ESP for systemd-boot to enroll
+func (ic *ImmutabilityConfig) HasSecureBootEnrollment() bool {
+	return ic.SecureBootKeys != "" && ic.SecureBootEnroll != ""
+}
+
+// secureBootKeySetFile returns the path of the file name in the configured
+// key set, or an empty string without a key set
+func (ic *ImmutabilityConfig) secureBootKeySetFile(name string) string {
+	if ic.SecureBootKeys == "" {
+		return ""
+	}
+	dir, err := SecureBootKeySetDir(ic.SecureBootKeys)
+	if err != nil {
+		log.Warnf("Ignoring secure boot key set: %v", err)
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSecureBootKeySet(t *testing.T) {
+	original := Global()
+	global := DefaultGlobalConfig()
+	global.ConfigDir = t.TempDir()
+	SetGlobal(global)
+	t.Cleanup(func() { SetGlobal(original) })
+
+	setDir := filepath.Join(global.ConfigDir, "keys", "lab")
+	immutability := ImmutabilityConfig{Enabled: true, SecureBootKeys: "lab"}
+	if !immutability.HasSecureBootDBConfig() || !immutability.HasSecureBootDBKey() {
+		t.Error("a key set must count as secure boot DB configuration")
+	}
+	for got, want := range map[string]string{
+		immutability.GetSecureBootDBKeyPath(): filepath.Join(setDir, "db.key"),
+		immutability.GetSecureBootDBCrtPath(): filepath.Join(setDir, "db.crt"),
+		immutability.GetSecureBootDBCerPath(): filepath.Join(setDir, "db.cer"),
+	} {
+		if got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+	if immutability.HasSecureBootEnrollment() {
+		t.Error("no enrollment without a mode")
+	}
+
+	// Explicit files take precedence over the key set
+	immutability.SecureBootDBKey = "/keys/custom.key"
+	if immutability.GetSecureBootDBKeyPath() != "/keys/custom.key" || immutability.GetSecureBootDBCrtPath() != filepath.Join(setDir, "db.crt") {
+		t.Errorf("unexpected paths %s %s", immutability.GetSecureBootDBKeyPath(), immutability.GetSecureBootDBCrtPath())
+	}
+
+	for _, name := range []string{"", ".", "..", "a/b"} {
+		if _, err := SecureBootKeySetDir(name); err == nil {
+			t.Errorf("expected error for key set name %q", name)
+		}
+	}
+	if (&ImmutabilityConfig{SecureBootKeys: "../lab"}).GetSecureBootDBKeyPath() != "" {
+		t.Error("an invalid key set name must not resolve")
+	}
+}
+
+func TestMergeSecureBootKeys(t *testing.T) {
+	merged := mergeImmutabilityConfig(
+		ImmutabilityConfig{Enabled: true, SecureBootKeys: "default", SecureBootEnroll: SecureBootEnrollManual},
+		ImmutabilityConfig{Enabled: true, SecureBootKeys: "lab"},
+	)
+	if merged.SecureBootKeys != "lab" || merged.SecureBootEnroll != SecureBootEnrollManual {
+		t.Errorf("unexpected merge result %+v", merged)
+	}
+
+	merged = mergeImmutabilityConfig(merged, ImmutabilityConfig{Enabled: true, ModuleSigningKey: "/keys/mok.key", ModuleSigningCrt: "/keys/mok.crt"})
+	if !merged.HasModuleSigningKey() || merged.SecureBootKeys != "lab" {
+		t.Errorf("unexpected merge result %+v", merged)
+	}
+}
+
+func TestParseYAMLTemplateSecureBootKeys(t *testing.T) {
+	base := `image:
+  name: lab
+  version: "1.0"
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: lab
+  immutability:
+`
+	template, err := parseYAMLTemplate([]byte(base+"    enabled: true\n    secureBootKeys: lab\n    secureBootEnroll: if-safe\n"), false)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed: %v", err)
+	}
+	if !template.SystemConfig.Immutability.HasSecureBootEnrollment() {
+		t.Errorf("unexpected immutability %+v", template.SystemConfig.Immutability)
+	}
+	if _, err := parseYAMLTemplate([]byte(base+"    enabled: false\n    moduleSigningKey: /keys/mok.key\n    moduleSigningCrt: /keys/mok.crt\n"), false); err != nil {
+		t.Errorf("module signing must not require immutability: %v", err)
+	}
+	// Explicit files may replace single files of the key set
+	if _, err := parseYAMLTemplate([]byte(base+"    enabled: true\n    secureBootKeys: lab\n    secureBootDBKey: /keys/db.key\n"), false); err != nil {
+		t.Errorf("parseYAMLTemplate failed: %v", err)
+	}
+	// Keys may stay in an HSM
+	hsm := "    enabled: true\n    secureBootDBKey: \"pkcs11:token=lab;object=db?pin-source=file:/etc/lab.pin\"\n    secureBootDBCrt: /keys/db.crt\n    secureBootDBCer: /keys/db.cer\n" +
+		"    moduleSigningKey: \"pkcs11:token=lab;object=mok\"\n    moduleSigningCrt: /keys/mok.crt\n"
+	if _, err := parseYAMLTemplate([]byte(base+hsm), false); err != nil {
+		t.Errorf("parseYAMLTemplate failed for PKCS#11 keys: %v", err)
+	}
+	for _, invalid := range []string{
+		"    enabled: true\n    secureBootKeys: lab\n    secureBootDBKey: \"pkcs11:object='db'\"\n",
+		"    enabled: false\n    secureBootKeys: lab\n",
+		"    enabled: true\n    secureBootEnroll: force\n",
+		"    enabled: true\n    secureBootKeys: lab\n    secureBootEnroll: always\n",
+		"    enabled: true\n    secureBootKeys: ../lab\n",
+		"    enabled: true\n    secureBootDBKey: /keys/db.key\n",
+		"    enabled: true\n    moduleSigningKey: /keys/mok.key\n",
+		"    enabled: true\n    moduleSigningKey: /keys/mok.key\n    moduleSigningCrt: /keys/mok.cer\n",
+	} {
+		if _, err := parseYAMLTemplate([]byte(base+invalid), false); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseYAMLTemplateShimChain(t *testing.T) {
+	base := `image:
+  name: lab
+  version: "1.0"
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: lab
+  bootloader:
+`
+	template, err := parseYAMLTemplate([]byte(base+"    bootType: efi\n    provider: grub\n    chain: shim\n    mokKey: /keys/MOK.key\n    mokCrt: /keys/MOK.crt\n"), false)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed: %v", err)
+	}
+	if !template.GetBootloaderConfig().IsShimChain() {
+		t.Errorf("unexpected bootloader %+v", template.SystemConfig.Bootloader)
+	}
+	if _, err := parseYAMLTemplate([]byte(base+"    bootType: efi\n    provider: systemd-boot\n    chain: shim\n    mokKey: \"pkcs11:token=lab;object=mok\"\n    mokCrt: /keys/MOK.pem\n"), false); err != nil {
+		t.Errorf("parseYAMLTemplate failed for a PKCS#11 MOK key: %v", err)
+	}
+	for _, invalid := range []string{
+		"    bootType: efi\n    provider: grub\n    chain: shim\n",
+		"    bootType: efi\n    provider: grub\n    chain: shim\n    mokKey: /keys/MOK.key\n",
+		"    bootType: legacy\n    provider: grub\n    chain: shim\n    mokKey: /keys/MOK.key\n    mokCrt: /keys/MOK.crt\n",
+		"    bootType: efi\n    provider: grub\n    chain: mok\n    mokKey: /keys/MOK.key\n    mokCrt: /keys/MOK.crt\n",
+		"    bootType: efi\n    provider: grub\n    mokKey: /keys/MOK.key\n    mokCrt: /keys/MOK.crt\n",
+		"    bootType: efi\n    provider: grub\n    chain: shim\n    mokKey: /keys/MOK.key\n    mokCrt: /keys/MOK.der\n",
+	} {
+		if _, err := parseYAMLTemplate([]byte(base+invalid), false); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestMergeShimChain(t *testing.T) {
+	merged := mergeBootloader(
+		Bootloader{BootType: "efi", Provider: "grub"},
+		Bootloader{Chain: BootChainShim, MOKKey: "/keys/MOK.key", MOKCrt: "/keys/MOK.crt"},
+	)
+	if !merged.IsShimChain() || merged.Provider != "grub" || merged.MOKKey != "/keys/MOK.key" || merged.MOKCrt != "/keys/MOK.crt" {
+		t.Errorf("unexpected merge result %+v", merged)
+	}
+	if isEmptyBootloader(Bootloader{Chain: BootChainShim}) {
+		t.Error("a bootloader with a chain must not be empty")
+	}
+}
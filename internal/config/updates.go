@@ -0,0 +1,326 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/utils/slice"
+)
+
+// UpdatesConfig selects how the image is updated in the field
+type UpdatesConfig struct {
+	Scheme     string   `yaml:"scheme,omitempty"`     // Scheme: "ab" for two root slots with boot counting; no update slots when empty
+	Tries      int      `yaml:"tries,omitempty"`      // Tries: boots of a new slot before systemd-boot falls back to the other one (default 3)
+	Bundles    []string `yaml:"bundles,omitempty"`    // Bundles: update bundles built next to the image, "sysupdate" and/or "rauc"
+	URL        string   `yaml:"url,omitempty"`        // URL: where devices download the sysupdate bundle files from
+	SigningKey string   `yaml:"signingKey,omitempty"` // SigningKey: armored OpenPGP private key signing the SHA256SUMS of the sysupdate bundle
+	RaucKey    string   `yaml:"raucKey,omitempty"`    // RaucKey: PEM private key signing the RAUC bundle
+	RaucCert   string   `yaml:"raucCert,omitempty"`   // RaucCert: PEM certificate of RaucKey
+}
+
+// Update schemes
+const (
+	// UpdateSchemeAB duplicates the root partition, and the dm-verity hash
+	// partition with immutability, into an A and a B slot. The image boots
+	// slot A, updates are written to the inactive slot.
+	UpdateSchemeAB = "ab"
+
+	// DefaultBootTries is the boot counter of a newly installed slot
+	DefaultBootTries = 3
+	maxBootTries     = 15
+
+	// Update bundle formats
+	UpdateBundleSysupdate = "sysupdate"
+	UpdateBundleRauc      = "rauc"
+
+	// SysupdateEmptyLabel is the GPT name systemd-sysupdate gives to, and
+	// looks for on, partitions free for an update
+	SysupdateEmptyLabel = "_empty"
+	// maxPartitionLabel is the length of a GPT partition name
+	maxPartitionLabel = 36
+
+	// slotBSuffix is appended to the ID and name of a slot A partition to
+	// get its slot B copy
+	slotBSuffix = "-b"
+)
+
+// IsABUpdate reports whether the image is built with A/B update slots.
+func (t *ImageTemplate) IsABUpdate() bool {
+	return t.Updates.Scheme == UpdateSchemeAB
+}
+
+// BootTries returns the boot counter given to the UKI of a slot.
+func (t *ImageTemplate) BootTries() int {
+	if t.Updates.Tries > 0 {
+		return t.Updates.Tries
+	}
+	return DefaultBootTries
+}
+
+// SlotBID returns the ID of the slot B copy of the slot A partition id.
+func SlotBID(id string) string {
+	return id + slotBSuffix
+}
+
+// SlotPartitions returns the slot A partitions of an A/B image: the root
+// partition and, with immutability, the dm-verity hash partition.
+func (t *ImageTemplate) SlotPartitions() []PartitionInfo {
+	var slots []PartitionInfo
+	hashFound := false
+	for _, partition := range t.Disk.Partitions {
+		switch {
+		case partition.MountPoint == "/":
+			slots = append(slots, partition)
+		case partition.MountPoint == "none" && t.IsImmutabilityEnabled() && !hashFound:
+			// The first "none" partition holds the hash tree, as when the
+			// UKI is built
+			slots = append(slots, partition)
+			hashFound = true
+		}
+	}
+	return slots
+}
+
+// HasUpdateBundle reports whether the update bundle format is built.
+func (t *ImageTemplate) HasUpdateBundle(format string) bool {
+	return t.IsABUpdate() && slice.Contains(t.Updates.Bundles, format)
+}
+
+// SysupdateLabel returns the GPT name of the slot partition id holding
+// version. systemd-sysupdate finds the installed versions by these names.
+func SysupdateLabel(id, version string) string {
+	return id + "_" + version
+}
+
+func (u UpdatesConfig) validate() error {
+	switch u.Scheme {
+	case "", UpdateSchemeAB:
+	default:
+		return fmt.Errorf("unsupported update scheme '%s'", u.Scheme)
+	}
+	if u.Tries < 0 || u.Tries > maxBootTries {
+		return fmt.Errorf("update tries %d is out of range 0-%d, 0 for the default of %d", u.Tries, maxBootTries, DefaultBootTries)
+	}
+	if len(u.Bundles) > 0 && u.Scheme != UpdateSchemeAB {
+		return fmt.Errorf("update bundles require update scheme ab")
+	}
+	for _, bundle := range u.Bundles {
+		switch bundle {
+		case UpdateBundleSysupdate:
+			if u.URL == "" || u.SigningKey == "" {
+				return fmt.Errorf("sysupdate update bundles require url and signingKey")
+			}
+		case UpdateBundleRauc:
+			// RAUC writes whichever slot is inactive, but the bundle UKI
+			// carries the slot B PARTUUIDs and cannot boot slot A
+			return fmt.Errorf("rauc update bundles are not supported yet, the bundle UKI only boots slot B")
+		default:
+			return fmt.Errorf("unsupported update bundle '%s'", bundle)
+		}
+	}
+	return nil
+}
+
+// validateABUpdate checks that the merged template can be laid out in A/B
+// slots: systemd-boot picks the slot through boot counting on the UKI names,
+// which carry the PARTUUIDs of their root slot on the kernel command line.
+func (t *ImageTemplate) validateABUpdate() error {
+	bootloader := t.GetBootloaderConfig()
+	if bootloader.Provider != "systemd-boot" || bootloader.BootType != "efi" {
+		return fmt.Errorf("update scheme ab requires the systemd-boot bootloader with efi boot")
+	}
+	if t.Disk.PartitionTableType != "" && t.Disk.PartitionTableType != "gpt" {
+		return fmt.Errorf("update scheme ab requires a gpt partition table")
+	}
+	if t.Disk.IsLoopless() {
+		return fmt.Errorf("update scheme ab requires the loop builder")
+	}
+	if len(t.Disk.MirrorPaths) > 0 {
+		return fmt.Errorf("update scheme ab is not supported with mirrorPaths")
+	}
+	if t.Disk.GrowRoot {
+		return fmt.Errorf("update scheme ab is not supported with growRoot, the root slots have a fixed size")
+	}
+	// Boot counting and updates rename the UKIs, the SBOM pointer would
+	// refer to a file that is gone after the first boot or update
+	if t.GetSBOMConfig().Location == "uki" {
+		return fmt.Errorf("update scheme ab is not supported with sbom location uki, the UKI names change with boot counting and updates")
+	}
+	if err := t.Updates.validate(); err != nil {
+		return err
+	}
+
+	slots := t.SlotPartitions()
+	rootFound := false
+	for _, slot := range slots {
+		if slot.MountPoint == "/" {
+			rootFound = true
+		}
+		switch {
+		case slot.FsType == "lvm" || slot.FsType == "raid":
+			return fmt.Errorf("update scheme ab requires the root filesystem directly on partition '%s'", slot.ID)
+		case slot.Encryption != nil:
+			return fmt.Errorf("update scheme ab does not support the encrypted partition '%s'", slot.ID)
+		case slot.Size == "rest" || strings.HasPrefix(slot.Size, DiskSizeAuto):
+			return fmt.Errorf("partition '%s': update scheme ab requires a fixed slot size", slot.ID)
+		case slot.Size == "" && (slot.Start == "" || slot.End == "" || slot.End == "0"):
+			return fmt.Errorf("partition '%s': update scheme ab requires a fixed slot size", slot.ID)
+		}
+	}
+	if !rootFound {
+		return fmt.Errorf("update scheme ab requires the root filesystem on a partition")
+	}
+
+	if !t.HasUpdateBundle(UpdateBundleSysupdate) {
+		return nil
+	}
+	// The version ends up in partition names and bundle file names
+	version := t.Image.Version
+	if !sysupdateVersionPattern.MatchString(version) {
+		return fmt.Errorf("sysupdate update bundles require an image version of letters, digits, '.', '+', '~' and '-', got '%s'", version)
+	}
+	if !sysupdateVersionPattern.MatchString(t.Image.Name) || strings.Contains(t.Image.Name, "_") {
+		return fmt.Errorf("sysupdate update bundles require an image name of letters, digits, '.', '+', '~' and '-', got '%s'", t.Image.Name)
+	}
+	// systemd-sysupdate picks the free partition of a transfer by its type
+	slotTypes := make(map[string]string)
+	for _, slot := range slots {
+		if label := SysupdateLabel(slot.ID, version); len(label) > maxPartitionLabel {
+			return fmt.Errorf("partition '%s': sysupdate partition name '%s' is longer than %d characters", slot.ID, label, maxPartitionLabel)
+		}
+		slotType := strings.ToLower(slot.TypeGUID)
+		if slotType == "" {
+			slotType = slot.Type
+		}
+		if other, ok := slotTypes[slotType]; ok {
+			return fmt.Errorf("partitions '%s' and '%s': sysupdate update bundles require a distinct partition type on every slot partition", other, slot.ID)
+		}
+		slotTypes[slotType] = slot.ID
+	}
+	return nil
+}
+
+// sysupdateVersionPattern matches the versions systemd-sysupdate accepts in
+// its @v patterns, which must not contain the "_" separator
+var sysupdateVersionPattern = regexp.MustCompile(`^[A-Za-z0-9.+~-]+$`)
+
+// ExpandUpdateSlots adds the slot B copy of every slot partition right after
+// it. Slot B partitions are raw: they get no filesystem or mount point and
+// are hidden from the discoverable partitions generator until an update
+// writes them. Partitions placed by offset after a slot move back by the
+// size of the slot. Templates that already declare the slot B partitions are
+// left alone.
+func (t *ImageTemplate) ExpandUpdateSlots() error {
+	if !t.IsABUpdate() {
+		return nil
+	}
+	if err := t.validateABUpdate(); err != nil {
+		return err
+	}
+
+	slotIDs := make(map[string]bool)
+	for _, slot := range t.SlotPartitions() {
+		slotIDs[slot.ID] = true
+	}
+	for _, partition := range t.Disk.Partitions {
+		if id, ok := strings.CutSuffix(partition.ID, slotBSuffix); ok && slotIDs[id] {
+			log.Debugf("Update slot partition %s is declared by the template", partition.ID)
+			t.applySysupdateLabels()
+			return nil
+		}
+	}
+
+	var shift uint64
+	partitions := make([]PartitionInfo, 0, len(t.Disk.Partitions)+len(slotIDs))
+	for _, partition := range t.Disk.Partitions {
+		if shift > 0 {
+			var err error
+			if partition.Start, err = shiftOffset(partition.Start, shift); err != nil {
+				return fmt.Errorf("partition '%s': %w", partition.ID, err)
+			}
+			if partition.End, err = shiftOffset(partition.End, shift); err != nil {
+				return fmt.Errorf("partition '%s': %w", partition.ID, err)
+			}
+		}
+		partitions = append(partitions, partition)
+		if !slotIDs[partition.ID] {
+			continue
+		}
+
+		slotB := PartitionInfo{
+			Name:       partition.Name,
+			ID:         SlotBID(partition.ID),
+			Type:       partition.Type,
+			TypeGUID:   partition.TypeGUID,
+			Size:       partition.Size,
+			Attributes: []string{"no-automount"},
+		}
+		if slotB.Name != "" {
+			slotB.Name += slotBSuffix
+		}
+		if partition.Size == "" {
+			start, err := absoluteSizeBytes(partition.Start)
+			if err != nil {
+				return fmt.Errorf("partition '%s': %w", partition.ID, err)
+			}
+			end, err := absoluteSizeBytes(partition.End)
+			if err != nil {
+				return fmt.Errorf("partition '%s': %w", partition.ID, err)
+			}
+			if end <= start {
+				return fmt.Errorf("partition '%s': end must be after start", partition.ID)
+			}
+			slotB.Start = partition.End
+			if slotB.End, err = shiftOffset(partition.End, end-start); err != nil {
+				return fmt.Errorf("partition '%s': %w", partition.ID, err)
+			}
+			shift += end - start
+		}
+		partitions = append(partitions, slotB)
+		log.Debugf("Added update slot partition %s for %s", slotB.ID, partition.ID)
+	}
+	t.Disk.Partitions = partitions
+	t.applySysupdateLabels()
+	return nil
+}
+
+// applySysupdateLabels names the slot partitions the way systemd-sysupdate
+// expects: the slot A partitions carry the image version, the slot B
+// partitions are free.
+func (t *ImageTemplate) applySysupdateLabels() {
+	if !t.HasUpdateBundle(UpdateBundleSysupdate) {
+		return
+	}
+	slotIDs := make(map[string]bool)
+	for _, slot := range t.SlotPartitions() {
+		slotIDs[slot.ID] = true
+	}
+	for i, partition := range t.Disk.Partitions {
+		if slotIDs[partition.ID] {
+			t.Disk.Partitions[i].Name = SysupdateLabel(partition.ID, t.Image.Version)
+		} else if id, ok := strings.CutSuffix(partition.ID, slotBSuffix); ok && slotIDs[id] {
+			t.Disk.Partitions[i].Name = SysupdateEmptyLabel
+		}
+	}
+}
+
+// shiftOffset moves a partition offset by shift bytes. The end of the disk,
+// "0", does not move.
+func shiftOffset(offset string, shift uint64) (string, error) {
+	if offset == "" || offset == "0" {
+		return offset, nil
+	}
+	bytes, err := absoluteSizeBytes(offset)
+	if err != nil {
+		return "", err
+	}
+	bytes += shift
+	if bytes%sizeUnitBytes["MiB"] == 0 {
+		return fmt.Sprintf("%dMiB", bytes/sizeUnitBytes["MiB"]), nil
+	}
+	if bytes%sizeUnitBytes["KiB"] != 0 {
+		return "", fmt.Errorf("offset '%s' cannot be moved by %d bytes, use binary units", offset, shift)
+	}
+	return fmt.Sprintf("%dKiB", bytes/sizeUnitBytes["KiB"]), nil
+}
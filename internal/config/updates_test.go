@@ -0,0 +1,270 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func abTemplate(partitions ...PartitionInfo) *ImageTemplate {
+	return &ImageTemplate{
+		Disk: DiskConfig{PartitionTableType: "gpt", Partitions: partitions},
+		SystemConfig: SystemConfig{
+			Bootloader:   Bootloader{BootType: "efi", Provider: "systemd-boot"},
+			Immutability: ImmutabilityConfig{Enabled: true},
+		},
+		Updates: UpdatesConfig{Scheme: UpdateSchemeAB},
+	}
+}
+
+func TestExpandUpdateSlotsOffsets(t *testing.T) {
+	template := abTemplate(
+		PartitionInfo{ID: "boot", Type: "esp", FsType: "fat32", Start: "1MiB", End: "513MiB", MountPoint: "/boot/efi"},
+		PartitionInfo{ID: "rootfs", Name: "root", Type: "linux-root-amd64", FsType: "ext4", Start: "513MiB", End: "2561MiB", MountPoint: "/"},
+		PartitionInfo{ID: "roothashmap", Type: "linux", FsType: "ext4", Start: "2561MiB", End: "3061MiB", MountPoint: "none"},
+		PartitionInfo{ID: "userdata", Type: "linux", FsType: "ext4", Start: "3061MiB", End: "0", MountPoint: "/opt"},
+	)
+	if err := template.ExpandUpdateSlots(); err != nil {
+		t.Fatalf("ExpandUpdateSlots failed: %v", err)
+	}
+
+	want := []struct{ id, name, start, end string }{
+		{"boot", "", "1MiB", "513MiB"},
+		{"rootfs", "root", "513MiB", "2561MiB"},
+		{"rootfs-b", "root-b", "2561MiB", "4609MiB"},
+		{"roothashmap", "", "4609MiB", "5109MiB"},
+		{"roothashmap-b", "", "5109MiB", "5609MiB"},
+		{"userdata", "", "5609MiB", "0"},
+	}
+	partitions := template.Disk.Partitions
+	if len(partitions) != len(want) {
+		t.Fatalf("expected %d partitions, got %+v", len(want), partitions)
+	}
+	for i, w := range want {
+		p := partitions[i]
+		if p.ID != w.id || p.Name != w.name || p.Start != w.start || p.End != w.end {
+			t.Errorf("partition %d: expected %+v, got %s %q %s-%s", i, w, p.ID, p.Name, p.Start, p.End)
+		}
+	}
+	slotB := partitions[2]
+	if slotB.FsType != "" || slotB.MountPoint != "" || slotB.Type != "linux-root-amd64" ||
+		len(slotB.Attributes) != 1 || slotB.Attributes[0] != "no-automount" {
+		t.Errorf("unexpected slot B partition %+v", slotB)
+	}
+	if err := template.Disk.validatePartitionSizes(); err != nil {
+		t.Errorf("expanded layout is invalid: %v", err)
+	}
+
+	// Expanding again leaves the layout alone
+	if err := template.ExpandUpdateSlots(); err != nil || len(template.Disk.Partitions) != len(want) {
+		t.Errorf("expected an idempotent expansion, got %d partitions (err %v)", len(template.Disk.Partitions), err)
+	}
+}
+
+func TestExpandUpdateSlotsSizes(t *testing.T) {
+	template := abTemplate(
+		PartitionInfo{ID: "boot", Type: "esp", FsType: "fat32", Size: "512MiB", MountPoint: "/boot/efi"},
+		PartitionInfo{ID: "rootfs", Type: "linux-root-amd64", FsType: "ext4", Size: "2GiB", MountPoint: "/"},
+		PartitionInfo{ID: "userdata", Type: "linux", FsType: "ext4", Size: "rest", MountPoint: "/opt"},
+	)
+	// Without immutability there is no hash slot
+	template.SystemConfig.Immutability.Enabled = false
+	if err := template.ExpandUpdateSlots(); err != nil {
+		t.Fatalf("ExpandUpdateSlots failed: %v", err)
+	}
+	var ids []string
+	for _, p := range template.Disk.Partitions {
+		ids = append(ids, p.ID+":"+p.Size)
+	}
+	if got := strings.Join(ids, " "); got != "boot:512MiB rootfs:2GiB rootfs-b:2GiB userdata:rest" {
+		t.Errorf("unexpected partitions %s", got)
+	}
+
+	// Templates without the scheme are not touched
+	template = abTemplate(PartitionInfo{ID: "rootfs", Size: "rest", MountPoint: "/"})
+	template.Updates = UpdatesConfig{}
+	if err := template.ExpandUpdateSlots(); err != nil || len(template.Disk.Partitions) != 1 {
+		t.Errorf("expected no slots without update scheme, got %+v (err %v)", template.Disk.Partitions, err)
+	}
+}
+
+func TestExpandUpdateSlotsErrors(t *testing.T) {
+	root := PartitionInfo{ID: "rootfs", FsType: "ext4", Size: "2GiB", MountPoint: "/"}
+	tests := []struct {
+		name     string
+		modify   func(*ImageTemplate)
+		contains string
+	}{
+		{"grub", func(tmpl *ImageTemplate) { tmpl.SystemConfig.Bootloader.Provider = "grub" }, "systemd-boot"},
+		{"mbr", func(tmpl *ImageTemplate) { tmpl.Disk.PartitionTableType = "mbr" }, "gpt"},
+		{"loopless", func(tmpl *ImageTemplate) { tmpl.Disk.Builder = DiskBuilderLoopless }, "loop builder"},
+		{"growRoot", func(tmpl *ImageTemplate) { tmpl.Disk.GrowRoot = true }, "growRoot"},
+		{"uki sbom", func(tmpl *ImageTemplate) { tmpl.SBOM.Location = "uki" }, "sbom location uki"},
+		{"rest", func(tmpl *ImageTemplate) { tmpl.Disk.Partitions[0].Size = "rest" }, "fixed slot size"},
+		{"end of disk", func(tmpl *ImageTemplate) {
+			tmpl.Disk.Partitions[0].Size = ""
+			tmpl.Disk.Partitions[0].Start = "1MiB"
+			tmpl.Disk.Partitions[0].End = "0"
+		}, "fixed slot size"},
+		{"encrypted", func(tmpl *ImageTemplate) {
+			tmpl.Disk.Partitions[0].Encryption = &EncryptionConfig{KeySource: "tpm2"}
+		}, "encrypted"},
+		{"no root", func(tmpl *ImageTemplate) { tmpl.Disk.Partitions[0].MountPoint = "/data" }, "root filesystem"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := abTemplate(root)
+			template.SystemConfig.Immutability.Enabled = false
+			tt.modify(template)
+			err := template.ExpandUpdateSlots()
+			if err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("expected error containing %q, got %v", tt.contains, err)
+			}
+		})
+	}
+}
+
+func TestUpdatesConfig(t *testing.T) {
+	template := &ImageTemplate{}
+	if template.IsABUpdate() || template.BootTries() != DefaultBootTries {
+		t.Errorf("unexpected defaults: ab %v, tries %d", template.IsABUpdate(), template.BootTries())
+	}
+	template.Updates = UpdatesConfig{Scheme: UpdateSchemeAB, Tries: 5}
+	if !template.IsABUpdate() || template.BootTries() != 5 {
+		t.Errorf("unexpected update config: ab %v, tries %d", template.IsABUpdate(), template.BootTries())
+	}
+
+	for _, invalid := range []UpdatesConfig{{Scheme: "rauc"}, {Scheme: UpdateSchemeAB, Tries: 16}} {
+		if err := invalid.validate(); err == nil {
+			t.Errorf("expected error for %+v", invalid)
+		}
+	}
+	// Zero tries means the default, the message states the accepted range
+	if err := (UpdatesConfig{Scheme: UpdateSchemeAB}).validate(); err != nil {
+		t.Errorf("expected default tries to be accepted, got %v", err)
+	}
+	for _, tries := range []int{16, -1} {
+		err := UpdatesConfig{Scheme: UpdateSchemeAB, Tries: tries}.validate()
+		if err == nil || !strings.Contains(err.Error(), "out of range 0-15, 0 for the default of 3") {
+			t.Errorf("unexpected error for tries %d: %v", tries, err)
+		}
+	}
+
+	if _, err := shiftOffset("1MB", 1024); err == nil {
+		t.Error("expected error shifting a decimal offset by a binary size")
+	}
+	if got, _ := shiftOffset("4KiB", 4096); got != "8KiB" {
+		t.Errorf("expected 8KiB, got %s", got)
+	}
+}
+
+func TestMergeConfigurationsUpdates(t *testing.T) {
+	defaultTemplate := abTemplate(
+		PartitionInfo{ID: "rootfs", FsType: "ext4", Start: "1MiB", End: "1025MiB", MountPoint: "/"},
+	)
+	defaultTemplate.Updates = UpdatesConfig{}
+	defaultTemplate.SystemConfig.Immutability.Enabled = false
+	userTemplate := &ImageTemplate{
+		Image:   ImageInfo{Name: "ab", Version: "1.0"},
+		Updates: UpdatesConfig{Scheme: UpdateSchemeAB, Tries: 2},
+	}
+
+	merged, err := MergeConfigurations(userTemplate, defaultTemplate)
+	if err != nil {
+		t.Fatalf("MergeConfigurations failed: %v", err)
+	}
+	if merged.BootTries() != 2 || len(merged.Disk.Partitions) != 2 || merged.Disk.Partitions[1].ID != "rootfs-b" {
+		t.Errorf("expected the slot B partition in the merged template, got %+v", merged.Disk.Partitions)
+	}
+	if len(defaultTemplate.Disk.Partitions) != 1 {
+		t.Errorf("merging must not change the default template")
+	}
+
+	userTemplate.Disk = DiskConfig{Name: "grow", Partitions: []PartitionInfo{{ID: "rootfs", Size: "rest", MountPoint: "/"}}}
+	if _, err := MergeConfigurations(userTemplate, defaultTemplate); err == nil {
+		t.Error("expected error for a root slot without a fixed size")
+	}
+}
+
+func TestParseYAMLTemplateUpdates(t *testing.T) {
+	base := `image:
+  name: ab
+  version: "1.0"
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+`
+	template, err := parseYAMLTemplate([]byte(base+"updates:\n  scheme: ab\n  tries: 4\n"), false)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed: %v", err)
+	}
+	if !template.IsABUpdate() || template.BootTries() != 4 {
+		t.Errorf("unexpected updates %+v", template.Updates)
+	}
+	for _, invalid := range []string{"updates:\n  scheme: rauc\n", "updates:\n  scheme: ab\n  tries: 0\n", "updates:\n  scheme: ab\n  tries: 16\n", "updates:\n  tries: 2\n"} {
+		if _, err := parseYAMLTemplate([]byte(base+invalid), false); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestUpdateBundles(t *testing.T) {
+	newTemplate := func() *ImageTemplate {
+		template := abTemplate(
+			PartitionInfo{ID: "rootfs", Type: "linux-root-amd64", FsType: "ext4", Size: "2GiB", MountPoint: "/"},
+			PartitionInfo{ID: "roothash", Type: "linux-root-amd64-verity", FsType: "ext4", Size: "128MiB", MountPoint: "none"},
+		)
+		template.Image = ImageInfo{Name: "edge", Version: "1.2.0"}
+		template.Updates.Bundles = []string{UpdateBundleSysupdate}
+		template.Updates.URL = "https://updates.example.com/edge"
+		template.Updates.SigningKey = "/keys/sysupdate.asc"
+		return template
+	}
+
+	template := newTemplate()
+	if err := template.ExpandUpdateSlots(); err != nil {
+		t.Fatalf("ExpandUpdateSlots failed: %v", err)
+	}
+	var names []string
+	for _, p := range template.Disk.Partitions {
+		names = append(names, p.ID+":"+p.Name)
+	}
+	if got := strings.Join(names, " "); got != "rootfs:rootfs_1.2.0 rootfs-b:_empty roothash:roothash_1.2.0 roothash-b:_empty" {
+		t.Errorf("unexpected partition names %s", got)
+	}
+	if !template.HasUpdateBundle(UpdateBundleSysupdate) || template.HasUpdateBundle(UpdateBundleRauc) {
+		t.Errorf("unexpected bundles %v", template.Updates.Bundles)
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(*ImageTemplate)
+		contains string
+	}{
+		{"no url", func(tmpl *ImageTemplate) { tmpl.Updates.URL = "" }, "url and signingKey"},
+		{"rauc", func(tmpl *ImageTemplate) {
+			tmpl.Updates.Bundles = []string{UpdateBundleRauc}
+			tmpl.Updates.RaucKey, tmpl.Updates.RaucCert = "/keys/rauc.key.pem", "/keys/rauc.cert.pem"
+		}, "rauc update bundles are not supported"},
+		{"unknown bundle", func(tmpl *ImageTemplate) { tmpl.Updates.Bundles = []string{"swupdate"} }, "unsupported update bundle"},
+		{"version", func(tmpl *ImageTemplate) { tmpl.Image.Version = "1.2_0" }, "image version"},
+		{"name", func(tmpl *ImageTemplate) { tmpl.Image.Name = "edge_os" }, "image name"},
+		{"label length", func(tmpl *ImageTemplate) { tmpl.Image.Version = strings.Repeat("1", 30) }, "longer than 36"},
+		{"same type", func(tmpl *ImageTemplate) { tmpl.Disk.Partitions[1].Type = "linux-root-amd64" }, "distinct partition type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := newTemplate()
+			tt.modify(template)
+			err := template.ExpandUpdateSlots()
+			if err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("expected error containing %q, got %v", tt.contains, err)
+			}
+		})
+	}
+
+	if err := (UpdatesConfig{Bundles: []string{UpdateBundleRauc}, RaucKey: "k", RaucCert: "c"}).validate(); err == nil {
+		t.Error("expected error for bundles without update scheme")
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultUserShell is the login shell of regular users without a shell
+	defaultUserShell = "/bin/bash"
+	// defaultSystemUserShell is the login shell of system users without a
+	// shell, present on deb and rpm targets alike
+	defaultSystemUserShell = "/usr/sbin/nologin"
+	// userExpireLayout is the layout of the account expiry date, as taken by
+	// useradd and chage
+	userExpireLayout = "2006-01-02"
+)
+
+// userNamePattern matches the user names useradd accepts on deb and rpm
+// targets alike
+var userNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// userPathPattern matches home directories and shells that need no quoting
+// on the useradd command line
+var userPathPattern = regexp.MustCompile(`^/[^\s'"$` + "`" + `\\]*$`)
+
+// GetShell returns the login shell of the user: Shell, else a nologin shell
+// for system users and bash for the others.
+func (u UserConfig) GetShell() string {
+	if u.Shell != "" {
+		return u.Shell
+	}
+	if u.System {
+		return defaultSystemUserShell
+	}
+	return defaultUserShell
+}
+
+// GetUserAuthorizedKeys returns the SSH public keys of the user: the inline
+// keys followed by the keys of the authorized_keys file, whose comments and
+// blank lines are skipped. A relative file is looked up next to the
+// templates.
+func (t *ImageTemplate) GetUserAuthorizedKeys(user UserConfig) ([]string, error) {
+	keys := append([]string(nil), user.SSHAuthorizedKeys...)
+	if user.SSHAuthorizedKeysFile == "" {
+		return keys, nil
+	}
+
+	keysFile := user.SSHAuthorizedKeysFile
+	if !filepath.IsAbs(keysFile) {
+		if len(t.PathList) == 0 {
+			return nil, fmt.Errorf("cannot resolve relative authorized keys file path without template file context")
+		}
+		found := false
+		for _, path := range t.PathList {
+			candidatePath := filepath.Join(filepath.Dir(path), user.SSHAuthorizedKeysFile)
+			if _, err := os.Stat(candidatePath); err == nil {
+				keysFile = candidatePath
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("authorized keys file of user %s does not exist: %s", user.Name, user.SSHAuthorizedKeysFile)
+		}
+	}
+
+	data, err := os.ReadFile(keysFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorized keys file of user %s: %w", user.Name, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := validateAuthorizedKey(line); err != nil {
+			return nil, fmt.Errorf("authorized keys file of user %s: %w", user.Name, err)
+		}
+		keys = append(keys, line)
+	}
+	return keys, nil
+}
+
+// validateAuthorizedKey checks an authorized_keys line has a key type and a
+// key, after options if any
+func validateAuthorizedKey(key string) error {
+	if strings.ContainsAny(key, "\r\n") || len(strings.Fields(key)) < 2 {
+		return fmt.Errorf("invalid SSH public key '%s': one key per entry, as in authorized_keys", key)
+	}
+	return nil
+}
+
+func validateAccountID(kind string, id *int) error {
+	if id != nil && (*id < 0 || *id > math.MaxInt32) {
+		return fmt.Errorf("%s %d is out of range 0-%d", kind, *id, math.MaxInt32)
+	}
+	return nil
+}
+
+func validateUsers(users []UserConfig) error {
+	names := make(map[string]bool)
+	uids := make(map[int]string)
+	for _, user := range users {
+		if !userNamePattern.MatchString(user.Name) {
+			return fmt.Errorf("invalid user name '%s'", user.Name)
+		}
+		if names[user.Name] {
+			return fmt.Errorf("duplicate user '%s'", user.Name)
+		}
+		names[user.Name] = true
+
+		if err := validateAccountID("uid", user.UID); err != nil {
+			return fmt.Errorf("user %s: %w", user.Name, err)
+		}
+		if err := validateAccountID("gid", user.GID); err != nil {
+			return fmt.Errorf("user %s: %w", user.Name, err)
+		}
+		if user.UID != nil {
+			if other, ok := uids[*user.UID]; ok {
+				return fmt.Errorf("users %s and %s have the same uid %d", other, user.Name, *user.UID)
+			}
+			uids[*user.UID] = user.Name
+		}
+		if user.Home != "" && !userPathPattern.MatchString(user.Home) {
+			return fmt.Errorf("user %s: home '%s' is not an absolute path without spaces or quotes", user.Name, user.Home)
+		}
+		if user.Shell != "" && !userPathPattern.MatchString(user.Shell) {
+			return fmt.Errorf("user %s: shell '%s' is not an absolute path without spaces or quotes", user.Name, user.Shell)
+		}
+		if user.PasswordMaxAge < 0 {
+			return fmt.Errorf("user %s: passwordMaxAge must not be negative", user.Name)
+		}
+		if user.Expire != "" {
+			if _, err := time.Parse(userExpireLayout, user.Expire); err != nil {
+				return fmt.Errorf("user %s: expire '%s' is not a YYYY-MM-DD date", user.Name, user.Expire)
+			}
+		}
+		for _, key := range user.SSHAuthorizedKeys {
+			if err := validateAuthorizedKey(key); err != nil {
+				return fmt.Errorf("user %s: %w", user.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateUsers(t *testing.T) {
+	uid, negative := 1000, -1
+	tests := []struct {
+		name    string
+		users   []UserConfig
+		wantErr string
+	}{
+		{name: "valid", users: []UserConfig{
+			{Name: "admin", UID: &uid, Home: "/srv/admin", Shell: "/bin/zsh", Expire: "2030-01-31", PasswordMaxAge: 90,
+				SSHAuthorizedKeys: []string{`from="10.0.0.0/8" ssh-ed25519 AAAAadmin admin@example.com`}},
+			{Name: "svc", System: true, LockPassword: true},
+		}},
+		{name: "invalid name", users: []UserConfig{{Name: "Admin"}}, wantErr: "invalid user name"},
+		{name: "duplicate name", users: []UserConfig{{Name: "admin"}, {Name: "admin"}}, wantErr: "duplicate user"},
+		{name: "duplicate uid", users: []UserConfig{{Name: "a", UID: &uid}, {Name: "b", UID: &uid}}, wantErr: "same uid 1000"},
+		{name: "negative gid", users: []UserConfig{{Name: "a", GID: &negative}}, wantErr: "gid -1 is out of range"},
+		{name: "relative home", users: []UserConfig{{Name: "a", Home: "home/a"}}, wantErr: "home"},
+		{name: "shell with spaces", users: []UserConfig{{Name: "a", Shell: "/bin/sh -x"}}, wantErr: "shell"},
+		{name: "expire", users: []UserConfig{{Name: "a", Expire: "31.01.2030"}}, wantErr: "not a YYYY-MM-DD date"},
+		{name: "key without type", users: []UserConfig{{Name: "a", SSHAuthorizedKeys: []string{"AAAAkey"}}}, wantErr: "invalid SSH public key"},
+		{name: "two keys in one entry", users: []UserConfig{{Name: "a", SSHAuthorizedKeys: []string{"ssh-rsa A\nssh-rsa B"}}}, wantErr: "invalid SSH public key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUsers(tt.users)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUserGetShell(t *testing.T) {
+	if shell := (UserConfig{Name: "a"}).GetShell(); shell != "/bin/bash" {
+		t.Errorf("expected /bin/bash, got %s", shell)
+	}
+	if shell := (UserConfig{Name: "a", System: true}).GetShell(); shell != "/usr/sbin/nologin" {
+		t.Errorf("expected /usr/sbin/nologin, got %s", shell)
+	}
+	if shell := (UserConfig{Name: "a", System: true, Shell: "/bin/sh"}).GetShell(); shell != "/bin/sh" {
+		t.Errorf("expected /bin/sh, got %s", shell)
+	}
+}
+
+func TestGetUserAuthorizedKeys(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "keys.pub"), []byte("# operators\nssh-ed25519 AAAAops ops@example.com\n\n  ecdsa-sha2-nistp256 AAAAecdsa\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	template := &ImageTemplate{PathList: []string{filepath.Join(dir, "template.yml")}}
+	user := UserConfig{Name: "admin", SSHAuthorizedKeys: []string{"ssh-rsa AAAArsa"}, SSHAuthorizedKeysFile: "keys.pub"}
+
+	keys, err := template.GetUserAuthorizedKeys(user)
+	if err != nil {
+		t.Fatalf("GetUserAuthorizedKeys failed: %v", err)
+	}
+	want := []string{"ssh-rsa AAAArsa", "ssh-ed25519 AAAAops ops@example.com", "ecdsa-sha2-nistp256 AAAAecdsa"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("expected %v, got %v", want, keys)
+	}
+
+	user.SSHAuthorizedKeysFile = "missing.pub"
+	if _, err := template.GetUserAuthorizedKeys(user); err == nil {
+		t.Error("expected an error for a missing keys file")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bad.pub"), []byte("AAAAnotype\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	user.SSHAuthorizedKeysFile = "bad.pub"
+	if _, err := template.GetUserAuthorizedKeys(user); err == nil {
+		t.Error("expected an error for an invalid key")
+	}
+}
+
+func TestMergeUserAccountSettings(t *testing.T) {
+	defaultUID, userUID := 1000, 2000
+	defaultUser := UserConfig{
+		Name:              "admin",
+		UID:               &defaultUID,
+		SSHAuthorizedKeys: []string{"ssh-rsa AAAAdefault"},
+		Expire:            "2030-01-31",
+	}
+	userUser := UserConfig{
+		Name:              "admin",
+		UID:               &userUID,
+		SSHAuthorizedKeys: []string{"ssh-ed25519 AAAAuser", "ssh-rsa AAAAdefault"},
+		LockPassword:      true,
+	}
+
+	merged := mergeUserConfig(defaultUser, userUser)
+	if merged.UID == nil || *merged.UID != 2000 {
+		t.Errorf("expected uid 2000, got %v", merged.UID)
+	}
+	if !reflect.DeepEqual(merged.SSHAuthorizedKeys, []string{"ssh-rsa AAAAdefault", "ssh-ed25519 AAAAuser"}) {
+		t.Errorf("unexpected SSH keys %v", merged.SSHAuthorizedKeys)
+	}
+	if merged.Expire != "2030-01-31" || !merged.LockPassword || merged.System {
+		t.Errorf("unexpected merged user %+v", merged)
+	}
+}
+
+func TestParseYAMLTemplateUsers(t *testing.T) {
+	base := `image:
+  name: lab
+  version: "1.0"
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: lab
+  users:
+`
+	template, err := parseYAMLTemplate([]byte(base+`    - name: svc
+      system: true
+      uid: 990
+      gid: 990
+      lockPassword: true
+      expire: "2030-01-31"
+      sshAuthorizedKeys:
+        - ssh-ed25519 AAAAsvc svc@example.com
+`), true)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed: %v", err)
+	}
+	user := template.SystemConfig.Users[0]
+	if !user.System || !user.LockPassword || user.UID == nil || *user.UID != 990 || user.GID == nil || *user.GID != 990 || user.Expire != "2030-01-31" {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	for _, invalid := range []string{
+		"    - name: svc\n      uid: -1\n",
+		"    - name: svc\n      expire: \"2030-13-01\"\n",
+		"    - name: svc\n      shell: bash\n",
+		"    - name: svc\n      sshAuthorizedKeys: [\"AAAAnotype\"]\n",
+	} {
+		if _, err := parseYAMLTemplate([]byte(base+invalid), true); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package artifactsign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/logger"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/security"
+)
+
+const (
+	MethodGPG    = "gpg"    // OpenPGP armored detached signatures
+	MethodCosign = "cosign" // cosign sign-blob compatible base64 signatures
+
+	ChecksumFile          = "SHA256SUMS"
+	GPGSignatureSuffix    = ".asc"
+	CosignSignatureSuffix = ".sig"
+)
+
+var log = logger.Logger()
+
+// Signer produces detached signatures for files
+type Signer interface {
+	Method() string
+	SignatureSuffix() string
+	SignFile(path string) ([]byte, error)
+}
+
+// NewSigner returns the signer for the given method using the private key at keyPath.
+// Cosign signers also take the PKCS#11 URI of a key in a token as keyPath.
+// passphraseFile is only used by encrypted GPG keys.
+func NewSigner(method, keyPath, passphraseFile string) (Signer, error) {
+	switch method {
+	case MethodGPG:
+		if IsPKCS11URI(keyPath) {
+			return nil, fmt.Errorf("gpg signing does not support PKCS#11 keys, use cosign")
+		}
+		return newGPGSigner(keyPath, passphraseFile)
+	case MethodCosign:
+		signingKey, err := NewSigningKey(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		key, err := signingKey.Signer()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := SignDigest(key, make([]byte, sha256.Size)); err != nil {
+			return nil, fmt.Errorf("cosign signing key %s: %w", keyPath, err)
+		}
+		return &cosignSigner{key: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported artifact signing method %q", method)
+	}
+}
+
+// SignArtifacts signs every file written to imageBuildDir during the current build,
+// then writes and signs a SHA256SUMS file covering them. It is a no-op when the
+// template does not configure artifact signing.
+func SignArtifacts(template *config.ImageTemplate, imageBuildDir string) error {
+	signingConfig := template.GetArtifactSigningConfig()
+	if signingConfig.Key == "" {
+		return nil
+	}
+
+	signer, err := NewSigner(signingConfig.Method, signingConfig.Key, signingConfig.PassphraseFile)
+	if err != nil {
+		return fmt.Errorf("failed to initialize artifact signer: %w", err)
+	}
+
+	artifacts, err := collectArtifacts(imageBuildDir, template.GetBuildStartTime())
+	if err != nil {
+		return err
+	}
+	if len(artifacts) == 0 {
+		return fmt.Errorf("no artifacts to sign in %s", imageBuildDir)
+	}
+
+	var sums bytes.Buffer
+	for _, name := range artifacts {
+		artifactPath := filepath.Join(imageBuildDir, name)
+		digest, err := fileSHA256(artifactPath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", digest, name)
+
+		if err := writeSignature(signer, artifactPath); err != nil {
+			return err
+		}
+	}
+
+	sumsPath := filepath.Join(imageBuildDir, ChecksumFile)
+	if err := security.SafeWriteFile(sumsPath, sums.Bytes(), 0644, security.RejectSymlinks); err != nil {
+		return fmt.Errorf("failed to write %s: %w", sumsPath, err)
+	}
+	if err := writeSignature(signer, sumsPath); err != nil {
+		return err
+	}
+
+	log.Infof("Signed %d artifacts with %s key, checksums written to %s", len(artifacts), signer.Method(), sumsPath)
+	return nil
+}
+
+func writeSignature(signer Signer, path string) error {
+	sig, err := signer.SignFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to sign %s: %w", path, err)
+	}
+	sigPath := path + signer.SignatureSuffix()
+	if err := security.SafeWriteFile(sigPath, sig, 0644, security.RejectSymlinks); err != nil {
+		return fmt.Errorf("failed to write signature %s: %w", sigPath, err)
+	}
+	return nil
+}
+
+// isSigningOutput reports whether name is a file produced by artifact signing itself.
+func isSigningOutput(name string) bool {
+	return name == ChecksumFile ||
+		strings.HasSuffix(name, GPGSignatureSuffix) ||
+		strings.HasSuffix(name, CosignSignatureSuffix)
+}
+
+// collectArtifacts returns the sorted names of regular files in dir written since the given time.
+func collectArtifacts(dir string, since time.Time) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || isSigningOutput(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", entry.Name(), err)
+		}
+		if !since.IsZero() && info.ModTime().Before(since) {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// VerifyResult describes the outcome of verifying an artifact
+type VerifyResult struct {
+	Artifact          string
+	SHA256            string
+	Method            string
+	SignaturePath     string // detached signature of the artifact, empty if none
+	ChecksumFile      string // SHA256SUMS that listed the artifact, empty if none
+	ChecksumSignature string // detached signature of the SHA256SUMS file
+}
+
+// VerifyArtifact verifies the detached signature of artifactPath and, when present,
+// its entry in the signed SHA256SUMS file next to it. At least one of the two must
+// exist. keyPath is an armored OpenPGP public key for GPG signatures or a PEM public
+// key for cosign signatures.
+func VerifyArtifact(artifactPath, keyPath string) (*VerifyResult, error) {
+	digest, err := fileSHA256(artifactPath)
+	if err != nil {
+		return nil, err
+	}
+	result := &VerifyResult{Artifact: artifactPath, SHA256: digest}
+
+	if sigPath, method, ok := findSignature(artifactPath); ok {
+		if err := verifyFile(method, artifactPath, sigPath, keyPath); err != nil {
+			return nil, fmt.Errorf("signature verification failed for %s: %w", artifactPath, err)
+		}
+		result.Method = method
+		result.SignaturePath = sigPath
+	}
+
+	sumsPath := filepath.Join(filepath.Dir(artifactPath), ChecksumFile)
+	if _, err := os.Stat(sumsPath); err == nil {
+		expected, listed, err := lookupChecksum(sumsPath, filepath.Base(artifactPath))
+		if err != nil {
+			return nil, err
+		}
+		if listed {
+			sigPath, method, ok := findSignature(sumsPath)
+			if !ok {
+				return nil, fmt.Errorf("%s is not signed", sumsPath)
+			}
+			if err := verifyFile(method, sumsPath, sigPath, keyPath); err != nil {
+				return nil, fmt.Errorf("signature verification failed for %s: %w", sumsPath, err)
+			}
+			if !strings.EqualFold(expected, digest) {
+				return nil, fmt.Errorf("checksum mismatch for %s: %s lists %s, actual %s",
+					filepath.Base(artifactPath), ChecksumFile, expected, digest)
+			}
+			result.Method = method
+			result.ChecksumFile = sumsPath
+			result.ChecksumSignature = sigPath
+		}
+	}
+
+	if result.SignaturePath == "" && result.ChecksumFile == "" {
+		return nil, fmt.Errorf("no signature or signed %s entry found for %s", ChecksumFile, artifactPath)
+	}
+	return result, nil
+}
+
+// findSignature looks for a detached signature next to path.
+func findSignature(path string) (string, string, bool) {
+	for _, candidate := range []struct{ suffix, method string }{
+		{GPGSignatureSuffix, MethodGPG},
+		{CosignSignatureSuffix, MethodCosign},
+	} {
+		if _, err := os.Stat(path + candidate.suffix); err == nil {
+			return path + candidate.suffix, candidate.method, true
+		}
+	}
+	return "", "", false
+}
+
+// lookupChecksum returns the digest listed for name in a sha256sum style file.
+func lookupChecksum(sumsPath, name string) (string, bool, error) {
+	data, err := security.SafeReadFile(sumsPath, security.RejectSymlinks)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s: %w", sumsPath, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func verifyFile(method, path, sigPath, keyPath string) error {
+	switch method {
+	case MethodGPG:
+		return verifyGPG(path, sigPath, keyPath)
+	case MethodCosign:
+		return verifyCosign(path, sigPath, keyPath)
+	default:
+		return fmt.Errorf("unsupported signature method %q", method)
+	}
+}
+
+func fileSHA256(path string) (string, error) {
+	sum, err := fileDigest(path)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+func fileDigest(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hash.Sum(nil), nil
+}
+
+// cosignSigner writes base64 encoded signatures over the SHA256 of the file,
+// the format produced by 'cosign sign-blob --output-signature'.
+type cosignSigner struct {
+	key crypto.Signer
+}
+
+func (s *cosignSigner) Method() string          { return MethodCosign }
+func (s *cosignSigner) SignatureSuffix() string { return CosignSignatureSuffix }
+
+func (s *cosignSigner) SignFile(path string) ([]byte, error) {
+	digest, err := fileDigest(path)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := SignDigest(s.key, digest)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sig)), nil
+}
+
+func verifyCosign(path, sigPath, keyPath string) error {
+	pub, err := LoadPEMPublicKey(keyPath)
+	if err != nil {
+		return err
+	}
+	encoded, err := security.SafeReadFile(sigPath, security.RejectSymlinks)
+	if err != nil {
+		return fmt.Errorf("failed to read signature %s: %w", sigPath, err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("failed to decode signature %s: %w", sigPath, err)
+	}
+	digest, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+	return VerifyDigest(pub, digest, sig)
+}
+
+// gpgSigner writes ASCII armored OpenPGP detached signatures.
+type gpgSigner struct {
+	entity *openpgp.Entity
+}
+
+func newGPGSigner(keyPath, passphraseFile string) (*gpgSigner, error) {
+	keyring, err := readKeyRing(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var entity *openpgp.Entity
+	for _, candidate := range keyring {
+		if candidate.PrivateKey != nil {
+			entity = candidate
+			break
+		}
+	}
+	if entity == nil {
+		return nil, fmt.Errorf("no private key found in %s", keyPath)
+	}
+
+	if entity.PrivateKey.Encrypted {
+		if passphraseFile == "" {
+			return nil, fmt.Errorf("GPG key %s is passphrase protected, set passphraseFile", keyPath)
+		}
+		passphrase, err := security.SafeReadFile(passphraseFile, security.RejectSymlinks)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase file %s: %w", passphraseFile, err)
+		}
+		if err := entity.DecryptPrivateKeys(bytes.TrimRight(passphrase, "\r\n")); err != nil {
+			return nil, fmt.Errorf("failed to decrypt GPG key %s: %w", keyPath, err)
+		}
+	}
+	return &gpgSigner{entity: entity}, nil
+}
+
+func (s *gpgSigner) Method() string          { return MethodGPG }
+func (s *gpgSigner) SignatureSuffix() string { return GPGSignatureSuffix }
+
+func (s *gpgSigner) SignFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, s.entity, file, nil); err != nil {
+		return nil, fmt.Errorf("failed to create GPG signature: %w", err)
+	}
+	return sig.Bytes(), nil
+}
+
+func verifyGPG(path, sigPath, keyPath string) error {
+	keyring, err := readKeyRing(keyPath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+	sig, err := os.Open(sigPath)
+	if err != nil {
+		return fmt.Errorf("failed to open signature %s: %w", sigPath, err)
+	}
+	defer sig.Close()
+
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, file, sig, nil); err != nil {
+		return fmt.Errorf("GPG signature check failed: %w", err)
+	}
+	return nil
+}
+
+// readKeyRing reads an armored or binary OpenPGP key file.
+func readKeyRing(keyPath string) (openpgp.EntityList, error) {
+	data, err := security.SafeReadFile(keyPath, security.RejectSymlinks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GPG key %s: %w", keyPath, err)
+	}
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GPG key %s: %w", keyPath, err)
+	}
+	return keyring, nil
+}
+
+// ExportGPGPublicKeys returns the public keys of the OpenPGP key file at
+// keyPath as a binary keyring, the format gpg reads with --keyring.
+func ExportGPGPublicKeys(keyPath string) ([]byte, error) {
+	keyring, err := readKeyRing(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	var pubring bytes.Buffer
+	for _, entity := range keyring {
+		if err := entity.Serialize(&pubring); err != nil {
+			return nil, fmt.Errorf("failed to export public key of %s: %w", keyPath, err)
+		}
+	}
+	return pubring.Bytes(), nil
+}
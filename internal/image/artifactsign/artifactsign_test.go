@@ -0,0 +1,309 @@
+package artifactsign
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+)
+
+func writeGPGKeys(t *testing.T, dir string, passphrase string) (string, string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Image Signer", "", "signer@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+
+	var pub bytes.Buffer
+	w, _ := armor.Encode(&pub, openpgp.PublicKeyType, nil)
+	if err := entity.Serialize(w); err != nil {
+		t.Fatalf("failed to serialize public key: %v", err)
+	}
+	w.Close()
+
+	if passphrase != "" {
+		if err := entity.EncryptPrivateKeys([]byte(passphrase), nil); err != nil {
+			t.Fatalf("failed to encrypt private key: %v", err)
+		}
+	}
+	var priv bytes.Buffer
+	w, _ = armor.Encode(&priv, openpgp.PrivateKeyType, nil)
+	if err := entity.SerializePrivateWithoutSigning(w, nil); err != nil {
+		t.Fatalf("failed to serialize private key: %v", err)
+	}
+	w.Close()
+
+	privPath := filepath.Join(dir, "signing.asc")
+	pubPath := filepath.Join(dir, "signing.pub.asc")
+	if err := os.WriteFile(privPath, priv.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pubPath, pub.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return privPath, pubPath
+}
+
+func writePEMKeys(t *testing.T, dir string, priv any, pub any) (string, string) {
+	t.Helper()
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath := filepath.Join(dir, "cosign.key")
+	pubPath := filepath.Join(dir, "cosign.pub")
+	if err := os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return privPath, pubPath
+}
+
+func setupBuildDir(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "imagebuild")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"minimal-1.0.raw.gz": "compressed image",
+		"minimal-1.0.qcow2":  "qcow2 image",
+		"spdx_manifest.json": `{"spdxVersion":"SPDX-2.3"}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSignArtifacts_NotConfigured(t *testing.T) {
+	dir := setupBuildDir(t)
+	if err := SignArtifacts(&config.ImageTemplate{}, dir); err != nil {
+		t.Fatalf("expected no-op, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ChecksumFile)); !os.IsNotExist(err) {
+		t.Errorf("expected no %s when signing is disabled", ChecksumFile)
+	}
+}
+
+func TestSignArtifacts_GPG(t *testing.T) {
+	keyDir := t.TempDir()
+	privPath, pubPath := writeGPGKeys(t, keyDir, "")
+	dir := setupBuildDir(t)
+
+	template := &config.ImageTemplate{
+		ArtifactSigning: config.ArtifactSigningConfig{Method: MethodGPG, Key: privPath},
+	}
+	if err := SignArtifacts(template, dir); err != nil {
+		t.Fatalf("SignArtifacts failed: %v", err)
+	}
+
+	sums, err := os.ReadFile(filepath.Join(dir, ChecksumFile))
+	if err != nil {
+		t.Fatalf("missing %s: %v", ChecksumFile, err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(sums)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 checksum entries, got %d:\n%s", len(lines), sums)
+	}
+	if !strings.HasSuffix(lines[0], "  minimal-1.0.qcow2") {
+		t.Errorf("expected sorted sha256sum entries, got %q", lines[0])
+	}
+	for _, name := range []string{"minimal-1.0.qcow2", "spdx_manifest.json", ChecksumFile} {
+		if _, err := os.Stat(filepath.Join(dir, name+GPGSignatureSuffix)); err != nil {
+			t.Errorf("expected signature for %s: %v", name, err)
+		}
+	}
+
+	result, err := VerifyArtifact(filepath.Join(dir, "minimal-1.0.qcow2"), pubPath)
+	if err != nil {
+		t.Fatalf("VerifyArtifact failed: %v", err)
+	}
+	if result.Method != MethodGPG || result.SignaturePath == "" || result.ChecksumFile == "" {
+		t.Errorf("unexpected verify result: %+v", result)
+	}
+
+	// Re-signing must not sign the signatures themselves
+	if err := SignArtifacts(template, dir); err != nil {
+		t.Fatalf("SignArtifacts rerun failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "minimal-1.0.qcow2.asc.asc")); !os.IsNotExist(err) {
+		t.Error("signature files must not be signed again")
+	}
+}
+
+func TestSignArtifacts_GPGPassphrase(t *testing.T) {
+	keyDir := t.TempDir()
+	privPath, pubPath := writeGPGKeys(t, keyDir, "s3cret")
+	dir := setupBuildDir(t)
+
+	template := &config.ImageTemplate{
+		ArtifactSigning: config.ArtifactSigningConfig{Method: MethodGPG, Key: privPath},
+	}
+	if err := SignArtifacts(template, dir); err == nil {
+		t.Fatal("expected error for encrypted key without passphrase")
+	}
+
+	passphraseFile := filepath.Join(keyDir, "passphrase")
+	if err := os.WriteFile(passphraseFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	template.ArtifactSigning.PassphraseFile = passphraseFile
+	if err := SignArtifacts(template, dir); err != nil {
+		t.Fatalf("SignArtifacts failed: %v", err)
+	}
+	if _, err := VerifyArtifact(filepath.Join(dir, "spdx_manifest.json"), pubPath); err != nil {
+		t.Errorf("VerifyArtifact failed: %v", err)
+	}
+}
+
+func TestSignArtifacts_Cosign(t *testing.T) {
+	keyDir := t.TempDir()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath, pubPath := writePEMKeys(t, keyDir, priv, &priv.PublicKey)
+	dir := setupBuildDir(t)
+
+	template := &config.ImageTemplate{
+		ArtifactSigning: config.ArtifactSigningConfig{Method: MethodCosign, Key: privPath},
+	}
+	if err := SignArtifacts(template, dir); err != nil {
+		t.Fatalf("SignArtifacts failed: %v", err)
+	}
+
+	artifact := filepath.Join(dir, "minimal-1.0.raw.gz")
+	result, err := VerifyArtifact(artifact, pubPath)
+	if err != nil {
+		t.Fatalf("VerifyArtifact failed: %v", err)
+	}
+	if result.Method != MethodCosign || !strings.HasSuffix(result.SignaturePath, CosignSignatureSuffix) {
+		t.Errorf("unexpected verify result: %+v", result)
+	}
+
+	// Tampering with the artifact breaks the detached signature
+	if err := os.WriteFile(artifact, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyArtifact(artifact, pubPath); err == nil {
+		t.Error("expected verification failure for tampered artifact")
+	}
+
+	// Without the detached signature the SHA256SUMS entry still catches it
+	if err := os.Remove(artifact + CosignSignatureSuffix); err != nil {
+		t.Fatal(err)
+	}
+	_, err = VerifyArtifact(artifact, pubPath)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestSignArtifacts_CosignRejectsEd25519(t *testing.T) {
+	keyDir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath, _ := writePEMKeys(t, keyDir, priv, pub)
+
+	if _, err := NewSigner(MethodCosign, privPath, ""); err == nil {
+		t.Fatal("expected ed25519 key to be rejected for cosign signatures")
+	}
+}
+
+func TestNewSigner_Invalid(t *testing.T) {
+	if _, err := NewSigner("minisign", "/nonexistent", ""); err == nil {
+		t.Error("expected error for unsupported method")
+	}
+	if _, err := NewSigner(MethodGPG, "/nonexistent", ""); err == nil {
+		t.Error("expected error for missing GPG key")
+	}
+	if _, err := NewSigner(MethodCosign, "/nonexistent", ""); err == nil {
+		t.Error("expected error for missing PEM key")
+	}
+}
+
+func TestVerifyArtifact_Unsigned(t *testing.T) {
+	dir := setupBuildDir(t)
+	_, err := VerifyArtifact(filepath.Join(dir, "minimal-1.0.qcow2"), "/nonexistent")
+	if err == nil || !strings.Contains(err.Error(), "no signature") {
+		t.Errorf("expected missing signature error, got %v", err)
+	}
+}
+
+func TestVerifyArtifact_WrongKey(t *testing.T) {
+	keyDir := t.TempDir()
+	privPath, _ := writeGPGKeys(t, keyDir, "")
+	otherDir := t.TempDir()
+	_, otherPub := writeGPGKeys(t, otherDir, "")
+	dir := setupBuildDir(t)
+
+	template := &config.ImageTemplate{
+		ArtifactSigning: config.ArtifactSigningConfig{Method: MethodGPG, Key: privPath},
+	}
+	if err := SignArtifacts(template, dir); err != nil {
+		t.Fatalf("SignArtifacts failed: %v", err)
+	}
+	if _, err := VerifyArtifact(filepath.Join(dir, "minimal-1.0.qcow2"), otherPub); err == nil {
+		t.Error("expected verification failure with a different key")
+	}
+}
+
+func TestCollectArtifacts_SkipsOlderFiles(t *testing.T) {
+	dir := setupBuildDir(t)
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "minimal-1.0.qcow2"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := collectArtifacts(dir, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("collectArtifacts failed: %v", err)
+	}
+	if len(names) != 2 || names[0] != "minimal-1.0.raw.gz" {
+		t.Errorf("unexpected artifacts %v", names)
+	}
+}
+
+func TestExportGPGPublicKeys(t *testing.T) {
+	dir := t.TempDir()
+	privPath, _ := writeGPGKeys(t, dir, "")
+
+	pubring, err := ExportGPGPublicKeys(privPath)
+	if err != nil {
+		t.Fatalf("ExportGPGPublicKeys failed: %v", err)
+	}
+	keyring, err := openpgp.ReadKeyRing(bytes.NewReader(pubring))
+	if err != nil {
+		t.Fatalf("exported keyring is not a binary keyring: %v", err)
+	}
+	if len(keyring) != 1 || keyring[0].PrivateKey != nil {
+		t.Errorf("expected a single public key, got %d entities", len(keyring))
+	}
+
+	if _, err := ExportGPGPublicKeys(filepath.Join(dir, "missing.asc")); err == nil {
+		t.Error("expected error for a missing key")
+	}
+}
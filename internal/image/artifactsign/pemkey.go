@@ -0,0 +1,149 @@
+package artifactsign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/open-edge-platform/os-image-composer/internal/utils/security"
+)
+
+// LoadPEMPrivateKey reads a PKCS#1, SEC1 or PKCS#8 PEM private key from keyPath.
+func LoadPEMPrivateKey(keyPath string) (crypto.Signer, error) {
+	data, err := security.SafeReadFile(keyPath, security.RejectSymlinks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key %s: %w", keyPath, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", keyPath)
+	}
+
+	var key any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "ENCRYPTED SIGSTORE PRIVATE KEY", "ENCRYPTED COSIGN PRIVATE KEY":
+		return nil, fmt.Errorf("encrypted cosign key %s is not supported, export it unencrypted with 'cosign import-key-pair' or openssl", keyPath)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", keyPath, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported signing key type %T", key)
+	}
+	return signer, nil
+}
+
+// LoadPEMPublicKey reads a PEM public key or certificate from keyPath.
+func LoadPEMPublicKey(keyPath string) (crypto.PublicKey, error) {
+	data, err := security.SafeReadFile(keyPath, security.RejectSymlinks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key %s: %w", keyPath, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", keyPath)
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %s: %w", keyPath, err)
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		pub, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %s: %w", keyPath, err)
+		}
+		return pub, nil
+	default:
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %s: %w", keyPath, err)
+		}
+		return pub, nil
+	}
+}
+
+// PublicKeyID returns the hex SHA256 of the PKIX encoding of pub.
+func PublicKeyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SignMessage signs message with signer. Ed25519 keys sign the message directly,
+// other keys sign its SHA256 digest.
+func SignMessage(signer crypto.Signer, message []byte) ([]byte, error) {
+	if _, ok := signer.(ed25519.PrivateKey); ok {
+		sig, err := signer.Sign(rand.Reader, message, crypto.Hash(0))
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign message: %w", err)
+		}
+		return sig, nil
+	}
+	digest := sha256.Sum256(message)
+	return SignDigest(signer, digest[:])
+}
+
+// VerifyMessage verifies a signature produced by SignMessage.
+func VerifyMessage(pub crypto.PublicKey, message, sig []byte) error {
+	if key, ok := pub.(ed25519.PublicKey); ok {
+		if !ed25519.Verify(key, message, sig) {
+			return fmt.Errorf("ed25519 signature mismatch")
+		}
+		return nil
+	}
+	digest := sha256.Sum256(message)
+	return VerifyDigest(pub, digest[:], sig)
+}
+
+// SignDigest signs a precomputed SHA256 digest with an ECDSA or RSA key.
+func SignDigest(signer crypto.Signer, digest []byte) ([]byte, error) {
+	switch signer.Public().(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("key type %T cannot sign a digest, use an ECDSA or RSA key", signer.Public())
+	}
+	sig, err := signer.Sign(rand.Reader, digest, crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign digest: %w", err)
+	}
+	return sig, nil
+}
+
+// VerifyDigest verifies an ECDSA or RSA signature over a SHA256 digest.
+func VerifyDigest(pub crypto.PublicKey, digest, sig []byte) error {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, sig) {
+			return fmt.Errorf("ecdsa signature mismatch")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig); err != nil {
+			return fmt.Errorf("rsa signature mismatch: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package artifactsign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+// PKCS11URIPrefix starts the RFC 7512 URI of a key held in a PKCS#11 token
+const PKCS11URIPrefix = "pkcs11:"
+
+// pkcs11ModuleEnv selects the PKCS#11 module of the OpenSSL pkcs11 engine,
+// the p11-kit proxy module when unset
+const pkcs11ModuleEnv = "PKCS11_MODULE_PATH"
+
+// pkcs11URIPattern matches the URIs that are safe to pass to a command: the
+// path and query characters of RFC 7512 with percent encoding
+var pkcs11URIPattern = regexp.MustCompile(`^pkcs11:[A-Za-z0-9_.~%;=&?:/@,+-]*$`)
+
+// SigningKey is a private key signing images, kernel modules, artifacts and
+// SBOMs, held either in a PEM file or in a PKCS#11 token such as an HSM
+type SigningKey interface {
+	// String returns the key file path or the PKCS#11 URI
+	String() string
+	// Check reports whether the key is usable without signing anything
+	Check() error
+	// SbsignArgs returns the sbsign options selecting the key
+	SbsignArgs() string
+	// OpenSSLArgs returns the openssl options selecting the key
+	OpenSSLArgs() string
+	// Env returns the environment of the commands using the key when they run
+	// with sudo, which does not keep the environment
+	Env() []string
+	// Signer returns a crypto.Signer for the key
+	Signer() (crypto.Signer, error)
+}
+
+// IsPKCS11URI reports whether ref is a PKCS#11 URI rather than a file path
+func IsPKCS11URI(ref string) bool {
+	return strings.HasPrefix(ref, PKCS11URIPrefix)
+}
+
+// NewSigningKey returns the signing key ref refers to, a PKCS#11 URI or the
+// path of a PEM private key file
+func NewSigningKey(ref string) (SigningKey, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("no signing key given")
+	}
+	if IsPKCS11URI(ref) {
+		if !pkcs11URIPattern.MatchString(ref) {
+			return nil, fmt.Errorf("invalid PKCS#11 URI %q", ref)
+		}
+		return &pkcs11Key{uri: ref}, nil
+	}
+	return &fileKey{path: ref}, nil
+}
+
+// fileKey is a PEM private key file
+type fileKey struct {
+	path string
+}
+
+func (k *fileKey) String() string      { return k.path }
+func (k *fileKey) SbsignArgs() string  { return "--key " + k.path }
+func (k *fileKey) OpenSSLArgs() string { return "-inkey " + k.path }
+func (k *fileKey) Env() []string       { return nil }
+
+func (k *fileKey) Check() error {
+	if _, err := os.Stat(k.path); err != nil {
+		return fmt.Errorf("key file not found at %s: %w", k.path, err)
+	}
+	return nil
+}
+
+func (k *fileKey) Signer() (crypto.Signer, error) {
+	return LoadPEMPrivateKey(k.path)
+}
+
+// pkcs11Key is a key in a PKCS#11 token, used through the OpenSSL pkcs11
+// engine of libp11. The URI selects the token and the key object and may hold
+// the PIN with pin-value or pin-source.
+type pkcs11Key struct {
+	uri string
+}
+
+func (k *pkcs11Key) String() string     { return k.uri }
+func (k *pkcs11Key) SbsignArgs() string { return fmt.Sprintf("--engine pkcs11 --key '%s'", k.uri) }
+
+func (k *pkcs11Key) OpenSSLArgs() string {
+	return fmt.Sprintf("-engine pkcs11 -keyform engine -inkey '%s'", k.uri)
+}
+
+func (k *pkcs11Key) Env() []string {
+	if module := os.Getenv(pkcs11ModuleEnv); module != "" {
+		return []string{pkcs11ModuleEnv + "=" + module}
+	}
+	return nil
+}
+
+func (k *pkcs11Key) Check() error {
+	if _, err := k.publicKey(); err != nil {
+		return fmt.Errorf("key %s not usable in the PKCS#11 token: %w", k.uri, err)
+	}
+	return nil
+}
+
+// publicKey reads the public key of the token object
+func (k *pkcs11Key) publicKey() (crypto.PublicKey, error) {
+	tmpDir, err := os.MkdirTemp(config.TempDir(), "pkcs11-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pubPath := filepath.Join(tmpDir, "public.pem")
+	cmd := fmt.Sprintf("openssl pkey -engine pkcs11 -inform engine -in '%s' -pubout -out %s", k.uri, pubPath)
+	if _, err := shell.ExecCmd(cmd, false, shell.HostPath, nil); err != nil {
+		return nil, fmt.Errorf("failed to read the public key: %w", err)
+	}
+	pub, err := LoadPEMPublicKey(pubPath)
+	if err != nil {
+		return nil, err
+	}
+	switch pub.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported PKCS#11 key type %T, use an ECDSA or RSA key", pub)
+	}
+}
+
+func (k *pkcs11Key) Signer() (crypto.Signer, error) {
+	pub, err := k.publicKey()
+	if err != nil {
+		return nil, err
+	}
+	return &pkcs11Signer{key: k, public: pub}, nil
+}
+
+// pkcs11Signer signs SHA256 digests in the token with openssl pkeyutl, giving
+// ASN.1 ECDSA and PKCS#1 v1.5 RSA signatures like the Go private keys
+type pkcs11Signer struct {
+	key    *pkcs11Key
+	public crypto.PublicKey
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey { return s.public }
+
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("PKCS#11 keys only sign SHA256 digests")
+	}
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, fmt.Errorf("PKCS#11 keys do not sign with RSA-PSS")
+	}
+
+	tmpDir, err := os.MkdirTemp(config.TempDir(), "pkcs11-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	digestPath := filepath.Join(tmpDir, "digest")
+	sigPath := filepath.Join(tmpDir, "signature")
+	if err := os.WriteFile(digestPath, digest, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write digest: %w", err)
+	}
+	cmd := fmt.Sprintf("openssl pkeyutl -sign %s -pkeyopt digest:sha256 -in %s -out %s",
+		s.key.OpenSSLArgs(), digestPath, sigPath)
+	if _, err := shell.ExecCmd(cmd, false, shell.HostPath, nil); err != nil {
+		return nil, fmt.Errorf("failed to sign with %s: %w", s.key.uri, err)
+	}
+	sig, err := os.ReadFile(sigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature: %w", err)
+	}
+	return sig, nil
+}
@@ -0,0 +1,146 @@
+package artifactsign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+const testPKCS11URI = "pkcs11:token=lab;object=signing;type=private?pin-value=1234"
+
+// tokenExecutor plays the OpenSSL pkcs11 engine with a key held in memory
+type tokenExecutor struct {
+	t   *testing.T
+	key crypto.Signer
+}
+
+var (
+	pkeyPattern    = regexp.MustCompile(`^openssl pkey -engine pkcs11 -inform engine -in '(\S+)' -pubout -out (\S+)$`)
+	pkeyutlPattern = regexp.MustCompile(`^openssl pkeyutl -sign -engine pkcs11 -keyform engine -inkey '(\S+)' -pkeyopt digest:sha256 -in (\S+) -out (\S+)$`)
+)
+
+func (e *tokenExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	if m := pkeyPattern.FindStringSubmatch(cmdStr); m != nil && m[1] == testPKCS11URI {
+		der, err := x509.MarshalPKIXPublicKey(e.key.Public())
+		if err != nil {
+			e.t.Fatal(err)
+		}
+		return "", os.WriteFile(m[2], pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644)
+	}
+	if m := pkeyutlPattern.FindStringSubmatch(cmdStr); m != nil && m[1] == testPKCS11URI {
+		digest, err := os.ReadFile(m[2])
+		if err != nil {
+			return "", err
+		}
+		sig, err := e.key.Sign(rand.Reader, digest, crypto.SHA256)
+		if err != nil {
+			return "", err
+		}
+		return "", os.WriteFile(m[3], sig, 0644)
+	}
+	return "", errors.New("unexpected command " + cmdStr)
+}
+
+func (e *tokenExecutor) ExecCmdSilent(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (e *tokenExecutor) ExecCmdWithStream(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (e *tokenExecutor) ExecCmdWithInput(inputStr string, cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func TestNewSigningKey(t *testing.T) {
+	key, err := NewSigningKey("/keys/db.key")
+	if err != nil {
+		t.Fatalf("NewSigningKey failed: %v", err)
+	}
+	if key.SbsignArgs() != "--key /keys/db.key" || key.OpenSSLArgs() != "-inkey /keys/db.key" || key.Env() != nil {
+		t.Errorf("unexpected file key arguments %q %q", key.SbsignArgs(), key.OpenSSLArgs())
+	}
+	if err := key.Check(); err == nil || !strings.Contains(err.Error(), "key file not found") {
+		t.Errorf("expected a missing key file error, got %v", err)
+	}
+
+	key, err = NewSigningKey(testPKCS11URI)
+	if err != nil {
+		t.Fatalf("NewSigningKey failed: %v", err)
+	}
+	if key.SbsignArgs() != "--engine pkcs11 --key '"+testPKCS11URI+"'" ||
+		key.OpenSSLArgs() != "-engine pkcs11 -keyform engine -inkey '"+testPKCS11URI+"'" {
+		t.Errorf("unexpected PKCS#11 key arguments %q %q", key.SbsignArgs(), key.OpenSSLArgs())
+	}
+	t.Setenv("PKCS11_MODULE_PATH", "/usr/lib/softhsm/libsofthsm2.so")
+	if env := key.Env(); len(env) != 1 || env[0] != "PKCS11_MODULE_PATH=/usr/lib/softhsm/libsofthsm2.so" {
+		t.Errorf("unexpected PKCS#11 environment %v", env)
+	}
+
+	for _, invalid := range []string{"", "pkcs11:object=db'; rm -rf /", "pkcs11:object=db key"} {
+		if _, err := NewSigningKey(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestPKCS11Signer(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	global := config.DefaultGlobalConfig()
+	global.TempDir = t.TempDir()
+	config.SetGlobal(global)
+
+	tokenKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shell.Default = &tokenExecutor{t: t, key: tokenKey}
+
+	// Artifacts and SBOMs are signed in the token in the cosign format
+	buildDir := setupBuildDir(t)
+	template := &config.ImageTemplate{
+		ArtifactSigning: config.ArtifactSigningConfig{Method: MethodCosign, Key: testPKCS11URI},
+	}
+	if err := SignArtifacts(template, buildDir); err != nil {
+		t.Fatalf("SignArtifacts failed: %v", err)
+	}
+	_, pubPath := writePEMKeys(t, t.TempDir(), tokenKey, &tokenKey.PublicKey)
+	if _, err := VerifyArtifact(filepath.Join(buildDir, "spdx_manifest.json"), pubPath); err != nil {
+		t.Errorf("VerifyArtifact failed: %v", err)
+	}
+
+	key, err := NewSigningKey(testPKCS11URI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := key.Signer()
+	if err != nil {
+		t.Fatalf("Signer failed: %v", err)
+	}
+	if _, err := signer.Sign(rand.Reader, make([]byte, 48), crypto.SHA384); err == nil {
+		t.Error("expected an error for a SHA384 digest")
+	}
+
+	if _, err := NewSigner(MethodGPG, testPKCS11URI, ""); err == nil {
+		t.Error("expected an error for a PKCS#11 GPG key")
+	}
+	if err := (&pkcs11Key{uri: "pkcs11:object=missing"}).Check(); err == nil {
+		t.Error("expected an error for a missing token object")
+	}
+}
@@ -0,0 +1,155 @@
+package imageboot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/file"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+const (
+	// grubEntriesScript generates the menu entries of the boot entries. It
+	// runs before 10_linux, so they come first in the menu.
+	grubEntriesScript = "/etc/grub.d/09_os-image-composer"
+	// grubMenuConfig sets the default entry and the timeout. The files in
+	// /etc/default/grub.d are sourced after /etc/default/grub.
+	grubMenuConfig = "/etc/default/grub.d/90-os-image-composer.cfg"
+)
+
+// ResolveBootEntryKernel returns the release of the kernel in /boot of the
+// install root matching pattern, the last one in lexical order when several
+// match, or defaultVersion when pattern is empty.
+func ResolveBootEntryKernel(installRoot, pattern, defaultVersion string) (string, error) {
+	if pattern == "" {
+		return defaultVersion, nil
+	}
+	kernels, err := filepath.Glob(filepath.Join(installRoot, "boot", "vmlinuz-*"))
+	if err != nil {
+		return "", fmt.Errorf("failed to list kernels: %w", err)
+	}
+	var matches []string
+	for _, kernel := range kernels {
+		version := strings.TrimPrefix(filepath.Base(kernel), "vmlinuz-")
+		if ok, _ := filepath.Match(pattern, version); ok {
+			matches = append(matches, version)
+		}
+	}
+	if len(matches) == 0 {
+		log.Errorf("No kernel in %s matches %s", filepath.Join(installRoot, "boot"), pattern)
+		return "", fmt.Errorf("no kernel matches '%s'", pattern)
+	}
+	sort.Strings(matches)
+	return matches[len(matches)-1], nil
+}
+
+// grubMenuConfigContent returns the GRUB settings of the boot menu, empty
+// when the template keeps the defaults
+func grubMenuConfigContent(template *config.ImageTemplate) string {
+	var conf string
+	if timeout := template.GetBootloaderConfig().Timeout; timeout != nil {
+		conf += fmt.Sprintf("GRUB_TIMEOUT=%d\n", *timeout)
+	}
+	if id := template.DefaultBootEntry(); id != "" {
+		conf += fmt.Sprintf("GRUB_DEFAULT=%s\n", id)
+	}
+	return conf
+}
+
+// grubBootEntry is a boot entry with the kernel files it boots, relative to
+// the filesystem GRUB finds by bootUUID
+type grubBootEntry struct {
+	config.BootEntry
+	kernel string
+	initrd string
+}
+
+// grubEntriesScriptContent returns the /etc/grub.d script printing the menu
+// entries. grub-mkconfig exports the command line of /etc/default/grub to it.
+func grubEntriesScriptContent(bootUUID string, entries []grubBootEntry) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n# Boot entries of the image template\ncat << EOF\n")
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "menuentry '%s' --id %s {\n", entry.GetTitle(), entry.ID)
+		if bootUUID != "" {
+			fmt.Fprintf(&b, "\tsearch --no-floppy --fs-uuid --set=root %s\n", bootUUID)
+		}
+		cmdline := strings.TrimSpace("ro ${GRUB_CMDLINE_LINUX} ${GRUB_CMDLINE_LINUX_DEFAULT} " + entry.Cmdline)
+		fmt.Fprintf(&b, "\tlinux %s %s\n", entry.kernel, cmdline)
+		fmt.Fprintf(&b, "\tinitrd %s\n", entry.initrd)
+		b.WriteString("}\n")
+	}
+	b.WriteString("EOF\n")
+	return b.String()
+}
+
+// grubInitrdPath returns the initramfs of the kernel version in /boot of the
+// install root: initramfs-tools names it initrd.img, dracut initramfs
+func grubInitrdPath(installRoot, version string) (string, error) {
+	for _, name := range []string{"initrd.img-" + version, fmt.Sprintf("initramfs-%s.img", version)} {
+		if _, err := os.Stat(filepath.Join(installRoot, "boot", name)); err == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("initramfs of kernel %s not found", version)
+}
+
+// installGrubBootEntries writes the menu entries of the boot entries, the
+// default entry and the timeout of the GRUB menu. On deb targets the
+// initramfs of every kernel booted is brought up to date first.
+func installGrubBootEntries(installRoot, bootUUID, bootPrefix, pkgType string, template *config.ImageTemplate) error {
+	if conf := grubMenuConfigContent(template); conf != "" {
+		if err := file.Write(conf, filepath.Join(installRoot, grubMenuConfig)); err != nil {
+			log.Errorf("Failed to write GRUB menu configuration: %v", err)
+			return fmt.Errorf("failed to write GRUB menu configuration: %w", err)
+		}
+	}
+	bootEntries := template.GetBootEntries()
+	if len(bootEntries) == 0 {
+		return nil
+	}
+
+	defaultVersion, err := getKernelVersionFromBoot(installRoot)
+	if err != nil {
+		return err
+	}
+	updated := map[string]bool{defaultVersion: true}
+	var entries []grubBootEntry
+	for _, bootEntry := range bootEntries {
+		version, err := ResolveBootEntryKernel(installRoot, bootEntry.Kernel, defaultVersion)
+		if err != nil {
+			return fmt.Errorf("boot entry %s: %w", bootEntry.ID, err)
+		}
+		if pkgType == "deb" && !updated[version] {
+			if err := updateInitramfsForGrub(installRoot, version, template); err != nil {
+				return fmt.Errorf("failed to update initramfs of kernel %s: %w", version, err)
+			}
+			updated[version] = true
+		}
+		initrd, err := grubInitrdPath(installRoot, version)
+		if err != nil {
+			return fmt.Errorf("boot entry %s: %w", bootEntry.ID, err)
+		}
+		entries = append(entries, grubBootEntry{
+			BootEntry: bootEntry,
+			kernel:    bootPrefix + "/vmlinuz-" + version,
+			initrd:    bootPrefix + "/" + initrd,
+		})
+	}
+
+	scriptPath := filepath.Join(installRoot, grubEntriesScript)
+	if err := file.Write(grubEntriesScriptContent(bootUUID, entries), scriptPath); err != nil {
+		log.Errorf("Failed to write GRUB boot entries: %v", err)
+		return fmt.Errorf("failed to write GRUB boot entries: %w", err)
+	}
+	if _, err := shell.ExecCmd("chmod 755 "+scriptPath, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to make GRUB boot entries script executable: %v", err)
+		return fmt.Errorf("failed to make GRUB boot entries script executable: %w", err)
+	}
+	log.Infof("Added %d GRUB boot entries, default %s", len(entries), template.DefaultBootEntry())
+	return nil
+}
@@ -0,0 +1,126 @@
+package imageboot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func TestResolveBootEntryKernel(t *testing.T) {
+	installRoot := t.TempDir()
+	for _, name := range []string{"vmlinuz-6.8.0-generic", "vmlinuz-6.8.0-rt", "vmlinuz-6.10.0-rt", "initrd.img-6.8.0-generic"} {
+		writeTestFile(t, filepath.Join(installRoot, "boot", name))
+	}
+
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"", "6.8.0-generic"},
+		{"*-rt", "6.8.0-rt"},
+		{"6.10.*", "6.10.0-rt"},
+		{"6.8.0-generic", "6.8.0-generic"},
+	}
+	for _, tt := range tests {
+		got, err := ResolveBootEntryKernel(installRoot, tt.pattern, "6.8.0-generic")
+		if err != nil || got != tt.want {
+			t.Errorf("ResolveBootEntryKernel(%q) = %q, %v, want %q", tt.pattern, got, err, tt.want)
+		}
+	}
+	if _, err := ResolveBootEntryKernel(installRoot, "5.*", "6.8.0-generic"); err == nil {
+		t.Error("expected an error when no kernel matches")
+	}
+}
+
+func TestGrubEntriesScriptContent(t *testing.T) {
+	entries := []grubBootEntry{
+		{BootEntry: config.BootEntry{ID: "production", Title: "Production"}, kernel: "/boot/vmlinuz-6.8.0", initrd: "/boot/initrd.img-6.8.0"},
+		{BootEntry: config.BootEntry{ID: "debug", Cmdline: "debug"}, kernel: "/vmlinuz-6.8.0", initrd: "/initrd.img-6.8.0"},
+	}
+	script := grubEntriesScriptContent("1234-abcd", entries)
+	for _, want := range []string{
+		"#!/bin/sh\n",
+		"menuentry 'Production' --id production {\n\tsearch --no-floppy --fs-uuid --set=root 1234-abcd\n\tlinux /boot/vmlinuz-6.8.0 ro ${GRUB_CMDLINE_LINUX} ${GRUB_CMDLINE_LINUX_DEFAULT}\n\tinitrd /boot/initrd.img-6.8.0\n}\n",
+		"menuentry 'debug' --id debug {\n",
+		"\tlinux /vmlinuz-6.8.0 ro ${GRUB_CMDLINE_LINUX} ${GRUB_CMDLINE_LINUX_DEFAULT} debug\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected %q in script:\n%s", want, script)
+		}
+	}
+	if !strings.HasSuffix(script, "}\nEOF\n") {
+		t.Errorf("unterminated script:\n%s", script)
+	}
+	if strings.Contains(grubEntriesScriptContent("", entries), "search") {
+		t.Error("expected no search without a boot UUID")
+	}
+}
+
+func TestGrubMenuConfigContent(t *testing.T) {
+	template := &config.ImageTemplate{}
+	if conf := grubMenuConfigContent(template); conf != "" {
+		t.Errorf("expected no configuration, got %q", conf)
+	}
+	timeout := 3
+	template.SystemConfig.Bootloader.Timeout = &timeout
+	template.SystemConfig.Kernel.BootEntries = []config.BootEntry{{ID: "production"}, {ID: "rt"}}
+	if conf := grubMenuConfigContent(template); conf != "GRUB_TIMEOUT=3\nGRUB_DEFAULT=production\n" {
+		t.Errorf("unexpected configuration %q", conf)
+	}
+	template.SystemConfig.Bootloader.DefaultEntry = "rt"
+	if conf := grubMenuConfigContent(template); conf != "GRUB_TIMEOUT=3\nGRUB_DEFAULT=rt\n" {
+		t.Errorf("unexpected configuration %q", conf)
+	}
+}
+
+func TestInstallGrubBootEntries(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	installRoot := filepath.Join(tempDir, "root")
+	for _, name := range []string{"vmlinuz-6.8.0-generic", "initrd.img-6.8.0-generic", "vmlinuz-6.8.0-rt", "initrd.img-6.8.0-rt"} {
+		writeTestFile(t, filepath.Join(installRoot, "boot", name))
+	}
+	template := &config.ImageTemplate{SystemConfig: config.SystemConfig{Kernel: config.KernelConfig{
+		BootEntries: []config.BootEntry{{ID: "production"}, {ID: "rt", Kernel: "*-rt", Cmdline: "isolcpus=2"}},
+	}}}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `^sudo mkdir -p '.*/root/etc/(default/)?grub\.d'$`, Output: ""},
+		{Pattern: `^sudo cp '.*/filewrite-.*' '.*/root/etc/default/grub\.d/90-os-image-composer\.cfg'$`, Output: ""},
+		{Pattern: `command -v update-initramfs`, Output: "/usr/sbin/update-initramfs\n"},
+		{Pattern: `^sudo chroot .*/root update-initramfs -u -k 6\.8\.0-rt$`, Output: ""},
+		{Pattern: `^sudo cp '.*/filewrite-.*' '.*/root/etc/grub\.d/09_os-image-composer'$`, Output: ""},
+		{Pattern: `^sudo chmod 755 .*/root/etc/grub\.d/09_os-image-composer$`, Output: ""},
+		{Pattern: ".*", Output: "", Error: errors.New("unexpected command")},
+	})
+	if err := installGrubBootEntries(installRoot, "1234-abcd", "/boot", "deb", template); err != nil {
+		t.Fatalf("installGrubBootEntries failed: %v", err)
+	}
+
+	// The rpm initramfs is generated by the kernel package
+	if err := os.Remove(filepath.Join(installRoot, "boot", "initrd.img-6.8.0-rt")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(installRoot, "boot", "initramfs-6.8.0-rt.img"))
+	if err := installGrubBootEntries(installRoot, "", "", "rpm", template); err != nil {
+		t.Fatalf("installGrubBootEntries failed: %v", err)
+	}
+
+	template.SystemConfig.Kernel.BootEntries = []config.BootEntry{{ID: "lts", Kernel: "5.*"}}
+	if err := installGrubBootEntries(installRoot, "", "", "rpm", template); err == nil {
+		t.Error("expected an error for a boot entry without a kernel")
+	}
+}
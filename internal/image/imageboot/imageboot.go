@@ -28,7 +28,7 @@ func NewImageBoot() *ImageBoot {
 
 func getDiskPartDevByMountPoint(mountPoint string, diskPathIdMap map[string]string, template *config.ImageTemplate) string {
 	diskInfo := template.GetDiskConfig()
-	partions := diskInfo.Partitions
+	partions := diskInfo.GetVolumes()
 	for diskId, diskPath := range diskPathIdMap {
 		for _, partition := range partions {
 			if partition.ID == diskId && partition.MountPoint == mountPoint {
@@ -39,6 +39,70 @@ func getDiskPartDevByMountPoint(mountPoint string, diskPathIdMap map[string]stri
 	return ""
 }
 
+// getRootDevID returns the root= argument for rootDev. Partitions are
+// referenced by PARTUUID; logical volumes and LUKS containers have none and
+// are referenced by their device-mapper path, which the initramfs creates when
+// activating the group or unlocking the container. RAID arrays are referenced
+// by filesystem UUID.
+func getRootDevID(rootDev string, template *config.ImageTemplate) (string, error) {
+	diskInfo := template.GetDiskConfig()
+	for _, volume := range diskInfo.GetVolumes() {
+		if volume.MountPoint == "/" && (diskInfo.VolumeGroupOf(volume.ID) != nil || volume.Encryption != nil) {
+			return rootDev, nil
+		}
+		// md device numbers are assigned at assembly time, the filesystem
+		// UUID is the same on every boot
+		if volume.MountPoint == "/" && diskInfo.RaidArrayOf(volume.ID) != nil {
+			rootUUID, err := imagedisc.GetUUID(rootDev)
+			if err != nil {
+				return "", fmt.Errorf("failed to get filesystem UUID for root array %s: %w", rootDev, err)
+			}
+			return fmt.Sprintf("UUID=%s", rootUUID), nil
+		}
+	}
+	rootPartUUID, err := imagedisc.GetPartUUID(rootDev)
+	if err != nil {
+		return "", fmt.Errorf("failed to get partition UUID for root partition %s: %w", rootDev, err)
+	}
+	return fmt.Sprintf("PARTUUID=%s", rootPartUUID), nil
+}
+
+// getRootFsUUID returns the filesystem UUID of rootDev. A read-only root
+// filesystem is only built once the installation is complete, so its UUID is
+// the one it will be built with, empty for squashfs.
+func getRootFsUUID(rootDev string, template *config.ImageTemplate) (string, error) {
+	if root, ok := template.GetDiskConfig().ReadOnlyRoot(); ok {
+		return imagedisc.ReadOnlyFilesystemUUID(template, root)
+	}
+	return imagedisc.GetUUID(rootDev)
+}
+
+// getLuksCmdline returns the kernel argument that makes a dracut initramfs
+// unlock the LUKS container holding the root filesystem.
+func getLuksCmdline(template *config.ImageTemplate) (string, error) {
+	for _, partition := range template.GetDiskConfig().Partitions {
+		if partition.Encryption == nil || partition.MountPoint != "/" {
+			continue
+		}
+		luksUUID, err := imagedisc.GetLuksUUID(partition.LuksName())
+		if err != nil {
+			return "", fmt.Errorf("failed to get LUKS UUID of root partition: %w", err)
+		}
+		return "rd.luks.uuid=" + luksUUID, nil
+	}
+	return "", nil
+}
+
+// getLvmCmdline returns the kernel arguments that make the initramfs activate
+// the volume groups of the image.
+func getLvmCmdline(template *config.ImageTemplate) string {
+	var args []string
+	for _, vg := range template.GetDiskConfig().VolumeGroups {
+		args = append(args, "rd.lvm.vg="+vg.Name)
+	}
+	return strings.Join(args, " ")
+}
+
 func installGrubWithLegacyMode(installRoot, bootUUID, bootPrefix string, template *config.ImageTemplate) error {
 	log.Errorf("Legacy boot mode is not implemented yet")
 	return fmt.Errorf("legacy boot mode is not implemented yet")
@@ -117,13 +181,23 @@ func installGrubWithEfiMode(installRoot, bootUUID, bootPrefix, pkgType, grubVers
 		return fmt.Errorf("failed to set permissions for grub configuration file: %w", err)
 	}
 
+	shimChain := template.GetBootloaderConfig().IsShimChain()
 	if pkgType == "deb" {
 		// Generate bootx64.efi for debian based systems at /EFI/BOOT/bootx64.efi
 		installCmd := fmt.Sprintf("grub-install --target=x86_64-efi --efi-directory=%s --removable", efiDir)
+		if shimChain {
+			// Our grub signed with the MOK key, not the one signed by the distro
+			installCmd += " --no-uefi-secure-boot"
+		}
 		if _, err = shell.ExecCmd(installCmd, true, installRoot, nil); err != nil {
 			log.Errorf("Failed to install bootx64.efi for GRUB EFI bootloader: %v", err)
 			return fmt.Errorf("failed to install bootx64.efi for GRUB EFI bootloader: %w", err)
 		}
+		if err := InstallShimChain(installRoot, template); err != nil {
+			return err
+		}
+	} else if shimChain {
+		return fmt.Errorf("the shim boot chain with GRUB is only supported on deb targets")
 	}
 
 	return nil
@@ -263,6 +337,13 @@ func updateBootConfigTemplate(installRoot, rootDevID, bootUUID, bootPrefix, hash
 		return fmt.Errorf("unsupported bootloader provider: %s", bootloaderConfig.Provider)
 	}
 
+	// A squashfs root has no UUID to look the boot files up by
+	if bootUUID == "" {
+		if err := file.ReplacePlaceholdersInFile("boot_uuid={{.BootUUID}}", "", configFinalPath); err != nil {
+			log.Errorf("Failed to remove boot_uuid from boot configuration: %v", err)
+			return fmt.Errorf("failed to remove boot_uuid from boot configuration: %w", err)
+		}
+	}
 	if err := file.ReplacePlaceholdersInFile("{{.BootUUID}}", bootUUID, configFinalPath); err != nil {
 		log.Errorf("Failed to replace BootUUID in boot configuration: %v", err)
 		return fmt.Errorf("failed to replace BootUUID in boot configuration: %w", err)
@@ -285,6 +366,10 @@ func updateBootConfigTemplate(installRoot, rootDevID, bootUUID, bootPrefix, hash
 		if hashDevID != "" {
 			verityCmd = fmt.Sprintf("systemd.verity_name=root systemd.verity_root_data=%s systemd.verity_root_hash=%s", rootDevID, hashDevID)
 		}
+		// The read-only root filesystem is not probed for on /dev/mapper/root
+		if root, ok := template.GetDiskConfig().ReadOnlyRoot(); ok {
+			verityCmd = strings.TrimSpace(verityCmd + " rootfstype=" + root.FsType)
+		}
 		if err := file.ReplacePlaceholdersInFile("{{.SystemdVerity}}", verityCmd, configFinalPath); err != nil {
 			log.Errorf("Failed to replace dm verity arg in boot configuration: %v", err)
 			return fmt.Errorf("failed to replace dm verity arg in boot configuration: %w", err)
@@ -298,7 +383,7 @@ func updateBootConfigTemplate(installRoot, rootDevID, bootUUID, bootPrefix, hash
 		rootPartition := rootDevID
 
 		// Special case for some security module like EMF required hardcoded root partition
-		cmdline := template.GetKernel().Cmdline
+		cmdline := template.GetKernelCmdline()
 		cmdlineMap := make(map[string]string)
 		if cmdline != "" {
 			// Parse cmdline into key-value pairs
@@ -330,14 +415,16 @@ func updateBootConfigTemplate(installRoot, rootDevID, bootUUID, bootPrefix, hash
 
 	}
 
-	// For now, we do not support LUKS encryption, so we replace the LuksUUID placeholder with an empty string.
-	if err := file.ReplacePlaceholdersInFile("{{.LuksUUID}}", "", configFinalPath); err != nil {
+	luksCmdline, err := getLuksCmdline(template)
+	if err != nil {
+		return err
+	}
+	if err := file.ReplacePlaceholdersInFile("{{.LuksUUID}}", luksCmdline, configFinalPath); err != nil {
 		log.Errorf("Failed to replace LuksUUID in boot configuration: %v", err)
 		return fmt.Errorf("failed to replace LuksUUID in boot configuration: %w", err)
 	}
 
-	// For now, we do not support LVM, so we replace the LVM placeholder with an empty string.
-	if err := file.ReplacePlaceholdersInFile("{{.LVM}}", "", configFinalPath); err != nil {
+	if err := file.ReplacePlaceholdersInFile("{{.LVM}}", getLvmCmdline(template), configFinalPath); err != nil {
 		log.Errorf("Failed to replace LVM in boot configuration: %v", err)
 		return fmt.Errorf("failed to replace LVM in boot configuration: %w", err)
 	}
@@ -366,10 +453,9 @@ func updateBootConfigTemplate(installRoot, rootDevID, bootUUID, bootPrefix, hash
 		return fmt.Errorf("failed to replace CGroup in boot configuration: %w", err)
 	}
 
-	kernelConfig := template.GetKernel()
 	// Special cases for some security module like EMF required hardcoded root partition as additional cmdline arg
 	// Remove the "root" parameter and its value from the cmdline as it's has been handled previously
-	trimRootArgfromCmdLine := kernelConfig.Cmdline
+	trimRootArgfromCmdLine := template.GetKernelCmdline()
 	if trimRootArgfromCmdLine != "" {
 		fields := strings.Fields(trimRootArgfromCmdLine)
 		var filteredFields []string
@@ -418,7 +504,7 @@ func (imageBoot *ImageBoot) InstallImageBoot(installRoot string, diskPathIdMap m
 		if rootDev == "" {
 			return fmt.Errorf("failed to find root partition for mount point '/'")
 		}
-		bootUUID, err = imagedisc.GetUUID(rootDev)
+		bootUUID, err = getRootFsUUID(rootDev, template)
 		if err != nil {
 			return fmt.Errorf("failed to get UUID for boot partition %s: %w", rootDev, err)
 		}
@@ -433,11 +519,15 @@ func (imageBoot *ImageBoot) InstallImageBoot(installRoot string, diskPathIdMap m
 		}
 	}
 
-	rootPartUUID, err := imagedisc.GetPartUUID(rootDev)
+	rootDevID, err := getRootDevID(rootDev, template)
 	if err != nil {
-		return fmt.Errorf("failed to get partition UUID for root partition %s: %w", rootDev, err)
+		return err
+	}
+
+	// The distro's shim is kept before the ESP is rebuilt
+	if err := StageShimChain(installRoot, template); err != nil {
+		return fmt.Errorf("failed to stage the shim boot chain: %w", err)
 	}
-	rootDevID := fmt.Sprintf("PARTUUID=%s", rootPartUUID)
 
 	bootloaderConfig := template.GetBootloaderConfig()
 	switch bootloaderConfig.Provider {
@@ -483,6 +573,10 @@ func (imageBoot *ImageBoot) InstallImageBoot(installRoot string, diskPathIdMap m
 			}
 		}
 
+		if err := installGrubBootEntries(installRoot, bootUUID, bootPrefix, pkgType, template); err != nil {
+			return fmt.Errorf("failed to install GRUB boot entries: %w", err)
+		}
+
 		if err := updateGrubConfig(installRoot, grubVersion); err != nil {
 			return fmt.Errorf("failed to update grub configuration: %w", err)
 		}
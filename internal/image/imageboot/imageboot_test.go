@@ -1526,3 +1526,142 @@ func TestInstallImageBoot_GrubWithEnableExtraModulesUbuntu(t *testing.T) {
 		t.Errorf("Expected no error, got: %v", err)
 	}
 }
+
+func TestLogicalVolumeRoot(t *testing.T) {
+	template := &config.ImageTemplate{
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+				{ID: "pv0", FsType: "lvm"},
+			},
+			VolumeGroups: []config.VolumeGroupInfo{
+				{Name: "vg0", PhysicalVolumes: []string{"pv0"}, LogicalVolumes: []config.LogicalVolumeInfo{
+					{ID: "rootfs", Size: "0", FsType: "ext4", MountPoint: "/"},
+				}},
+			},
+		},
+	}
+	diskPathIdMap := map[string]string{"boot": "/dev/loop0p1", "pv0": "/dev/loop0p2", "rootfs": "/dev/mapper/vg0-rootfs"}
+
+	rootDev := getDiskPartDevByMountPoint("/", diskPathIdMap, template)
+	if rootDev != "/dev/mapper/vg0-rootfs" {
+		t.Fatalf("expected logical volume root device, got %q", rootDev)
+	}
+
+	// Logical volumes have no PARTUUID, so blkid must not be called
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	rootDevID, err := getRootDevID(rootDev, template)
+	if err != nil || rootDevID != "/dev/mapper/vg0-rootfs" {
+		t.Errorf("getRootDevID() = %q, %v; want device-mapper path", rootDevID, err)
+	}
+
+	if got := getLvmCmdline(template); got != "rd.lvm.vg=vg0" {
+		t.Errorf("getLvmCmdline() = %q, want rd.lvm.vg=vg0", got)
+	}
+	if got := getLvmCmdline(&config.ImageTemplate{}); got != "" {
+		t.Errorf("expected no LVM arguments without volume groups, got %q", got)
+	}
+}
+
+func TestEncryptedRoot(t *testing.T) {
+	template := &config.ImageTemplate{
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+				{ID: "rootfs", FsType: "ext4", MountPoint: "/", Encryption: &config.EncryptionConfig{KeySource: "tpm2"}},
+			},
+		},
+	}
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "cryptsetup status luks-rootfs$", Output: "  device:  /dev/loop0p2\n", Error: nil},
+		{Pattern: "cryptsetup luksUUID /dev/loop0p2$", Output: "1111-2222\n", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	rootDevID, err := getRootDevID("/dev/mapper/luks-rootfs", template)
+	if err != nil || rootDevID != "/dev/mapper/luks-rootfs" {
+		t.Errorf("getRootDevID() = %q, %v; want device-mapper path", rootDevID, err)
+	}
+	cmdline, err := getLuksCmdline(template)
+	if err != nil || cmdline != "rd.luks.uuid=1111-2222" {
+		t.Errorf("getLuksCmdline() = %q, %v; want rd.luks.uuid=1111-2222", cmdline, err)
+	}
+
+	// Encrypted data partitions do not touch the kernel command line
+	template.Disk.Partitions[1].MountPoint = "/data"
+	if cmdline, err := getLuksCmdline(template); err != nil || cmdline != "" {
+		t.Errorf("expected empty command line, got %q, %v", cmdline, err)
+	}
+}
+
+func TestRaidArrayRoot(t *testing.T) {
+	template := &config.ImageTemplate{
+		Disk: config.DiskConfig{
+			Path:        "/dev/nvme0n1",
+			MirrorPaths: []string{"/dev/nvme1n1"},
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+				{ID: "md-root", FsType: "raid"},
+			},
+			RaidArrays: []config.RaidArrayInfo{
+				{ID: "rootfs", Level: 1, Partition: "md-root", FsType: "ext4", MountPoint: "/"},
+			},
+		},
+	}
+	diskPathIdMap := map[string]string{"boot": "/dev/nvme0n1p1", "md-root": "/dev/nvme0n1p2", "rootfs": "/dev/md/rootfs"}
+
+	rootDev := getDiskPartDevByMountPoint("/", diskPathIdMap, template)
+	if rootDev != "/dev/md/rootfs" {
+		t.Fatalf("expected RAID array root device, got %q", rootDev)
+	}
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "blkid /dev/md/rootfs -s UUID -o value$", Output: "3333-4444\n", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	rootDevID, err := getRootDevID(rootDev, template)
+	if err != nil || rootDevID != "UUID=3333-4444" {
+		t.Errorf("getRootDevID() = %q, %v; want UUID=3333-4444", rootDevID, err)
+	}
+}
+
+func TestReadOnlyRoot(t *testing.T) {
+	template := &config.ImageTemplate{
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+				{ID: "rootfs", FsType: "erofs", MountPoint: "/"},
+			},
+		},
+	}
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	// The erofs root is not built yet, its UUID is derived from the
+	// template rather than read from the partition
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	templateHash, err := template.GetTemplateHash()
+	if err != nil {
+		t.Fatalf("GetTemplateHash failed: %v", err)
+	}
+	want := config.DeriveUUID(templateHash, "filesystem/rootfs").String()
+	if fsUUID, err := getRootFsUUID("/dev/loop0p2", template); err != nil || fsUUID != want {
+		t.Errorf("getRootFsUUID() = %q, %v; want %s", fsUUID, err, want)
+	}
+
+	template.Disk.Partitions[1].FsType = "squashfs"
+	if fsUUID, err := getRootFsUUID("/dev/loop0p2", template); err != nil || fsUUID != "" {
+		t.Errorf("getRootFsUUID() = %q, %v; want no UUID for squashfs", fsUUID, err)
+	}
+}
@@ -0,0 +1,171 @@
+package imageboot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/file"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+const (
+	// ShimStageDir keeps the distro's shim and MokManager in the image, the
+	// ESP is rebuilt from it
+	ShimStageDir = "/usr/lib/os-image-composer/shim"
+	// MOKCertPath is the DER MOK certificate the image imports on first boot
+	MOKCertPath = "/usr/lib/os-image-composer/mok/MOK.cer"
+
+	mokImportUnitName = "mok-import.service"
+)
+
+// mokImportUnitContent imports the MOK certificate once. MokManager asks for
+// the root password at the next boot to enroll it.
+const mokImportUnitContent = `[Unit]
+Description=Import the MOK certificate of the image for enrollment
+ConditionPathExists=` + MOKCertPath + `
+ConditionPathExists=!/var/lib/os-image-composer/mok-imported
+
+[Service]
+Type=oneshot
+StateDirectory=os-image-composer
+ExecStart=/usr/bin/mokutil --import ` + MOKCertPath + ` --root-pw
+ExecStartPost=/usr/bin/touch /var/lib/os-image-composer/mok-imported
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// shimSearchDirs are where the distro packages install the signed shim:
+// shim-signed on Debian and Ubuntu, the shim package on the ESP on RPM
+// distributions
+var shimSearchDirs = []string{
+	filepath.Join("usr", "lib", "shim"),
+	filepath.Join("boot", "efi", "EFI", "*"),
+}
+
+// shimArch returns the EFI architecture name of arch used in the shim file
+// names
+func shimArch(arch string) (string, error) {
+	switch arch {
+	case "x86_64", "amd64":
+		return "x64", nil
+	case "aarch64", "arm64":
+		return "aa64", nil
+	default:
+		return "", fmt.Errorf("the shim boot chain is not supported for architecture %q", arch)
+	}
+}
+
+// findShimBinary returns the path of the distro binary name below
+// installRoot, the signed variant when there is one
+func findShimBinary(installRoot, name string) (string, error) {
+	for _, dir := range shimSearchDirs {
+		for _, candidate := range []string{name + ".signed", name} {
+			matches, err := filepath.Glob(filepath.Join(installRoot, dir, candidate))
+			if err != nil {
+				return "", err
+			}
+			for _, match := range matches {
+				// EFI/BOOT holds what the image boots, not what the distro ships
+				if filepath.Base(filepath.Dir(match)) != "BOOT" {
+					return match, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("%s not found in the image, the distro shim package must be installed", name)
+}
+
+// StageShimChain prepares the shim boot chain of the image: the distro's shim
+// and MokManager are kept in ShimStageDir before the ESP is rebuilt, the MOK
+// certificate is stored in DER format and a service imports it with mokutil
+// on first boot.
+func StageShimChain(installRoot string, template *config.ImageTemplate) error {
+	bootloader := template.GetBootloaderConfig()
+	if !bootloader.IsShimChain() {
+		return nil
+	}
+	arch, err := shimArch(template.Target.Arch)
+	if err != nil {
+		return err
+	}
+
+	stageDir := filepath.Join(installRoot, ShimStageDir)
+	for _, name := range []string{"shim" + arch + ".efi", "mm" + arch + ".efi"} {
+		src, err := findShimBinary(installRoot, name)
+		if err != nil {
+			log.Errorf("Failed to find %s: %v", name, err)
+			return err
+		}
+		if err := file.CopyFile(src, filepath.Join(stageDir, name), "-f", true); err != nil {
+			log.Errorf("Failed to stage %s: %v", name, err)
+			return fmt.Errorf("failed to stage %s: %w", name, err)
+		}
+	}
+
+	if _, err := os.Stat(bootloader.MOKCrt); err != nil {
+		return fmt.Errorf("MOK certificate file not found at %s: %w", bootloader.MOKCrt, err)
+	}
+	certPath := filepath.Join(installRoot, MOKCertPath)
+	if _, err := shell.ExecCmd("mkdir -p "+filepath.Dir(certPath), true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to create MOK certificate directory: %w", err)
+	}
+	cmd := fmt.Sprintf("openssl x509 -in %s -outform DER -out %s", bootloader.MOKCrt, certPath)
+	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to convert the MOK certificate: %v", err)
+		return fmt.Errorf("failed to convert the MOK certificate: %w", err)
+	}
+
+	unitPath := filepath.Join(installRoot, "etc", "systemd", "system", mokImportUnitName)
+	if err := file.Write(mokImportUnitContent, unitPath); err != nil {
+		log.Errorf("Failed to write MOK import service: %v", err)
+		return fmt.Errorf("failed to write MOK import service: %w", err)
+	}
+	cmd = "systemctl enable --root=\"" + installRoot + "\" " + mokImportUnitName
+	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to enable MOK import service: %w", err)
+	}
+	log.Infof("Shim boot chain staged, the MOK certificate is imported on first boot")
+	return nil
+}
+
+// InstallShimChain puts shim in front of the bootloader on the ESP. The
+// bootloader installed as the fallback loader EFI/BOOT/BOOT<arch>.EFI moves
+// to grub<arch>.efi, the second stage shim starts, and the staged shim and
+// MokManager take its place next to it.
+func InstallShimChain(installRoot string, template *config.ImageTemplate) error {
+	if !template.GetBootloaderConfig().IsShimChain() {
+		return nil
+	}
+	arch, err := shimArch(template.Target.Arch)
+	if err != nil {
+		return err
+	}
+
+	bootDir := filepath.Join(installRoot, "boot", "efi", "EFI", "BOOT")
+	loaderPath := filepath.Join(bootDir, "BOOT"+strings.ToUpper(arch)+".EFI")
+	if _, err := os.Stat(loaderPath); err != nil {
+		return fmt.Errorf("bootloader %s not found on the ESP: %w", loaderPath, err)
+	}
+	cmd := fmt.Sprintf("mv %s %s", loaderPath, filepath.Join(bootDir, "grub"+arch+".efi"))
+	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to move the bootloader behind shim: %v", err)
+		return fmt.Errorf("failed to move the bootloader behind shim: %w", err)
+	}
+
+	stageDir := filepath.Join(installRoot, ShimStageDir)
+	for src, dst := range map[string]string{
+		"shim" + arch + ".efi": loaderPath,
+		"mm" + arch + ".efi":   filepath.Join(bootDir, "mm"+arch+".efi"),
+	} {
+		if err := file.CopyFile(filepath.Join(stageDir, src), dst, "-f", true); err != nil {
+			log.Errorf("Failed to copy %s to the ESP: %v", src, err)
+			return fmt.Errorf("failed to copy %s to the ESP: %w", src, err)
+		}
+	}
+	log.Infof("Shim installed in front of the bootloader on the ESP")
+	return nil
+}
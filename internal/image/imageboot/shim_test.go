@@ -0,0 +1,136 @@
+package imageboot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func shimTemplate(t *testing.T, arch string) *config.ImageTemplate {
+	t.Helper()
+	mokCrt := filepath.Join(t.TempDir(), "MOK.crt")
+	if err := os.WriteFile(mokCrt, []byte("test"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &config.ImageTemplate{
+		Target: config.TargetInfo{Arch: arch},
+		SystemConfig: config.SystemConfig{
+			Bootloader: config.Bootloader{
+				BootType: "efi",
+				Provider: "grub",
+				Chain:    config.BootChainShim,
+				MOKKey:   "/keys/MOK.key",
+				MOKCrt:   mokCrt,
+			},
+		},
+	}
+}
+
+func writeTestFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStageShimChain(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	global := config.DefaultGlobalConfig()
+	global.TempDir = t.TempDir()
+	config.SetGlobal(global)
+
+	// Debian ships the signed shim in /usr/lib/shim, the unsigned one next to it
+	installRoot := t.TempDir()
+	writeTestFile(t, filepath.Join(installRoot, "usr", "lib", "shim", "shimx64.efi"))
+	writeTestFile(t, filepath.Join(installRoot, "usr", "lib", "shim", "shimx64.efi.signed"))
+	writeTestFile(t, filepath.Join(installRoot, "usr", "lib", "shim", "mmx64.efi.signed"))
+	template := shimTemplate(t, "x86_64")
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `^sudo mkdir -p `, Output: ""},
+		{Pattern: `^sudo cp -f '\S+/usr/lib/shim/shimx64\.efi\.signed' '\S+/usr/lib/os-image-composer/shim/shimx64\.efi'$`, Output: ""},
+		{Pattern: `^sudo cp -f '\S+/usr/lib/shim/mmx64\.efi\.signed' '\S+/usr/lib/os-image-composer/shim/mmx64\.efi'$`, Output: ""},
+		{Pattern: `^sudo openssl x509 -in \S+/MOK\.crt -outform DER -out \S+/usr/lib/os-image-composer/mok/MOK\.cer$`, Output: ""},
+		{Pattern: `^sudo cp '\S+' '\S+/etc/systemd/system/mok-import\.service'$`, Output: ""},
+		{Pattern: `^sudo systemctl enable --root="\S+" mok-import\.service$`, Output: ""},
+		{Pattern: ".*", Error: errors.New("unexpected command")},
+	})
+	if err := StageShimChain(installRoot, template); err != nil {
+		t.Fatalf("StageShimChain failed: %v", err)
+	}
+
+	// Without the distro shim package there is nothing to chain from
+	if err := StageShimChain(t.TempDir(), template); err == nil || !strings.Contains(err.Error(), "shim package must be installed") {
+		t.Errorf("expected a missing shim error, got %v", err)
+	}
+
+	template.SystemConfig.Bootloader.MOKCrt = filepath.Join(t.TempDir(), "missing.crt")
+	if err := StageShimChain(installRoot, template); err == nil || !strings.Contains(err.Error(), "MOK certificate file not found") {
+		t.Errorf("expected a missing certificate error, got %v", err)
+	}
+
+	if err := StageShimChain(installRoot, shimTemplate(t, "riscv64")); err == nil {
+		t.Error("expected an error for an unsupported architecture")
+	}
+
+	// Templates without the shim chain are left alone
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Error: errors.New("unexpected command")},
+	})
+	if err := StageShimChain(installRoot, &config.ImageTemplate{}); err != nil {
+		t.Errorf("StageShimChain without the shim chain failed: %v", err)
+	}
+}
+
+func TestFindShimBinary(t *testing.T) {
+	// RPM distributions install shim on the ESP below their vendor directory
+	installRoot := t.TempDir()
+	writeTestFile(t, filepath.Join(installRoot, "boot", "efi", "EFI", "BOOT", "shimaa64.efi"))
+	writeTestFile(t, filepath.Join(installRoot, "boot", "efi", "EFI", "fedora", "shimaa64.efi"))
+
+	path, err := findShimBinary(installRoot, "shimaa64.efi")
+	if err != nil {
+		t.Fatalf("findShimBinary failed: %v", err)
+	}
+	if want := filepath.Join(installRoot, "boot", "efi", "EFI", "fedora", "shimaa64.efi"); path != want {
+		t.Errorf("expected %s, got %s", want, path)
+	}
+}
+
+func TestInstallShimChain(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	installRoot := t.TempDir()
+	writeTestFile(t, filepath.Join(installRoot, "boot", "efi", "EFI", "BOOT", "BOOTAA64.EFI"))
+	writeTestFile(t, filepath.Join(installRoot, ShimStageDir, "shimaa64.efi"))
+	writeTestFile(t, filepath.Join(installRoot, ShimStageDir, "mmaa64.efi"))
+	template := shimTemplate(t, "aarch64")
+
+	// The bootloader moves to the name shim starts, shim takes its place
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `^sudo mv \S+/EFI/BOOT/BOOTAA64\.EFI \S+/EFI/BOOT/grubaa64\.efi$`, Output: ""},
+		{Pattern: `^sudo mkdir -p '\S+/EFI/BOOT'$`, Output: ""},
+		{Pattern: `^sudo cp -f '\S+/shim/shimaa64\.efi' '\S+/EFI/BOOT/BOOTAA64\.EFI'$`, Output: ""},
+		{Pattern: `^sudo cp -f '\S+/shim/mmaa64\.efi' '\S+/EFI/BOOT/mmaa64\.efi'$`, Output: ""},
+		{Pattern: ".*", Error: errors.New("unexpected command")},
+	})
+	if err := InstallShimChain(installRoot, template); err != nil {
+		t.Fatalf("InstallShimChain failed: %v", err)
+	}
+
+	if err := InstallShimChain(t.TempDir(), template); err == nil || !strings.Contains(err.Error(), "not found on the ESP") {
+		t.Errorf("expected a missing bootloader error, got %v", err)
+	}
+}
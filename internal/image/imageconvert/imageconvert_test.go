@@ -659,7 +659,7 @@ func TestCompressImageFile(t *testing.T) {
 			filePath:        testFile,
 			compressionType: "gz",
 			mockCommands: []shell.MockCommand{
-				{Pattern: "gzip -c", Output: "", Error: nil},
+				{Pattern: "gzip -n -c", Output: "", Error: nil},
 			},
 			expectError: false,
 		},
@@ -677,7 +677,7 @@ func TestCompressImageFile(t *testing.T) {
 			filePath:        testFile,
 			compressionType: "gz",
 			mockCommands: []shell.MockCommand{
-				{Pattern: "gzip -c", Output: "", Error: fmt.Errorf("compression failed")},
+				{Pattern: "gzip -n -c", Output: "", Error: fmt.Errorf("compression failed")},
 			},
 			expectError: true,
 			errorMsg:    "failed to compress file",
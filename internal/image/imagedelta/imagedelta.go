@@ -0,0 +1,519 @@
+// Package imagedelta builds binary deltas between two raw images. The
+// partitions of the target image are cut into fixed-size chunks addressed by
+// their SHA256 digest; the delta holds the chunks the source image does not
+// have, compressed, and a manifest listing the chunks of every partition. A
+// device holding the source image rebuilds a target partition from its own
+// partitions and the downloaded chunks.
+package imagedelta
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/logger"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/security"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+var log = logger.Logger()
+
+const (
+	// ManifestFile describes the delta
+	ManifestFile = "delta.json"
+	// ChunkDirName is the chunk store of the delta
+	ChunkDirName = "chunks"
+	// DefaultChunkSize is a multiple of the filesystem and dm-verity block
+	// sizes, so unchanged blocks fall into unchanged chunks
+	DefaultChunkSize = 64 * 1024
+
+	formatVersion = 1
+	compression   = "zstd"
+	chunkSuffix   = ".zst"
+	sectorSize    = 512
+	minChunkSize  = 4096
+)
+
+// Options tune a delta
+type Options struct {
+	ChunkSize  int      // ChunkSize: bytes per chunk, DefaultChunkSize when 0
+	Partitions []string // Partitions: GPT names of the target partitions to include, all when empty
+	Cmdline    string   // Cmdline: kernel command line of the target image carrying its dm-verity root hash
+}
+
+// Manifest describes a delta from one image to another.
+type Manifest struct {
+	Version     int         `json:"version"`
+	From        ImageRef    `json:"from"`
+	To          ImageRef    `json:"to"`
+	ChunkSize   int         `json:"chunkSize"`
+	Compression string      `json:"compression"`
+	Partitions  []Partition `json:"partitions"`
+	Verity      *Verity     `json:"verity,omitempty"`
+	Chunks      int         `json:"chunks"`     // chunks referenced by the partitions
+	NewChunks   int         `json:"newChunks"`  // chunks in the chunk store
+	StoreBytes  int64       `json:"storeBytes"` // compressed size of the chunk store
+}
+
+// ImageRef names an image of the delta
+type ImageRef struct {
+	File string `json:"file"`
+	Size int64  `json:"size"`
+}
+
+// Partition is a target partition rebuilt from its chunks
+type Partition struct {
+	Index    int      `json:"index"` // 1-based GPT entry
+	Name     string   `json:"name"`
+	TypeGUID string   `json:"typeGUID"`
+	PartUUID string   `json:"partUUID"`
+	Size     int64    `json:"size"`
+	SHA256   string   `json:"sha256"`
+	Chunks   []string `json:"chunks"` // SHA256 of each chunk, in order
+}
+
+// Verity is the dm-verity configuration of the target image. A rebuilt data
+// partition must verify against the root hash with the rebuilt hash
+// partition.
+type Verity struct {
+	RootHash      string `json:"rootHash"`
+	DataPartition int    `json:"dataPartition"`
+	HashPartition int    `json:"hashPartition"`
+}
+
+// chunkRef locates a chunk in the source image
+type chunkRef struct {
+	offset int64
+	size   int
+}
+
+// Create writes the delta turning the raw image fromPath into toPath to
+// outDir, which must not exist or be empty.
+func Create(fromPath, toPath, outDir string, opts Options) (*Manifest, error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize < minChunkSize || chunkSize%minChunkSize != 0 {
+		return nil, fmt.Errorf("chunk size %d is not a multiple of %d bytes", chunkSize, minChunkSize)
+	}
+	if entries, err := os.ReadDir(outDir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("output directory %s is not empty", outDir)
+	}
+
+	from, fromTable, err := openImage(fromPath)
+	if err != nil {
+		return nil, err
+	}
+	defer from.Close()
+	to, toTable, err := openImage(toPath)
+	if err != nil {
+		return nil, err
+	}
+	defer to.Close()
+
+	manifest := &Manifest{
+		Version:     formatVersion,
+		From:        imageRef(from),
+		To:          imageRef(to),
+		ChunkSize:   chunkSize,
+		Compression: compression,
+	}
+	if manifest.Verity, err = parseVerity(opts.Cmdline, toTable); err != nil {
+		return nil, err
+	}
+
+	selected, err := selectPartitions(toTable, opts.Partitions, manifest.Verity)
+	if err != nil {
+		return nil, err
+	}
+	known, err := indexChunks(from, fromTable, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	defer encoder.Close()
+	chunkDir := filepath.Join(outDir, ChunkDirName)
+	if err := os.MkdirAll(chunkDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create chunk store %s: %w", chunkDir, err)
+	}
+
+	stored := make(map[string]bool)
+	for _, index := range selected {
+		entry := toTable.Partitions[index-1]
+		partition := Partition{
+			Index:    index,
+			Name:     entry.Name,
+			TypeGUID: strings.ToLower(string(entry.Type)),
+			PartUUID: strings.ToLower(entry.GUID),
+			Size:     int64(partitionBytes(entry)),
+		}
+		hash := sha256.New()
+		err := forEachChunk(to, entry, chunkSize, func(_ int64, data []byte) error {
+			hash.Write(data)
+			digest := chunkDigest(data)
+			partition.Chunks = append(partition.Chunks, digest)
+			if _, ok := known[digest]; ok || stored[digest] {
+				return nil
+			}
+			compressed := encoder.EncodeAll(data, nil)
+			path := chunkPath(outDir, digest)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return fmt.Errorf("failed to create chunk directory: %w", err)
+			}
+			if err := os.WriteFile(path, compressed, 0644); err != nil {
+				return fmt.Errorf("failed to write chunk %s: %w", digest, err)
+			}
+			stored[digest] = true
+			manifest.StoreBytes += int64(len(compressed))
+			return nil
+		})
+		if err != nil {
+			log.Errorf("Failed to chunk partition %d of %s: %v", index, toPath, err)
+			return nil, fmt.Errorf("failed to chunk partition %d of %s: %w", index, toPath, err)
+		}
+		partition.SHA256 = hex.EncodeToString(hash.Sum(nil))
+		manifest.Chunks += len(partition.Chunks)
+		manifest.Partitions = append(manifest.Partitions, partition)
+	}
+	manifest.NewChunks = len(stored)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode delta manifest: %w", err)
+	}
+	manifestPath := filepath.Join(outDir, ManifestFile)
+	if err := security.SafeWriteFile(manifestPath, append(data, '\n'), 0644, security.RejectSymlinks); err != nil {
+		log.Errorf("Failed to write delta manifest %s: %v", manifestPath, err)
+		return nil, fmt.Errorf("failed to write delta manifest %s: %w", manifestPath, err)
+	}
+	log.Infof("Delta written to %s: %d of %d chunks, %d bytes", outDir, manifest.NewChunks, manifest.Chunks, manifest.StoreBytes)
+	return manifest, nil
+}
+
+// Verify rebuilds every partition of the delta in deltaDir from the raw image
+// fromPath, the way a device applies it, and checks the chunk and partition
+// digests. With dm-verity the rebuilt data partition must verify against the
+// root hash of the target image.
+func Verify(fromPath, deltaDir string) (*Manifest, error) {
+	manifest, err := ReadManifest(deltaDir)
+	if err != nil {
+		return nil, err
+	}
+	from, fromTable, err := openImage(fromPath)
+	if err != nil {
+		return nil, err
+	}
+	defer from.Close()
+	known, err := indexChunks(from, fromTable, manifest.ChunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	workDir, err := os.MkdirTemp(config.TempDir(), "delta-verify-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create delta verification directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	defer decoder.Close()
+
+	rebuilt := make(map[int]string)
+	for _, partition := range manifest.Partitions {
+		path := filepath.Join(workDir, fmt.Sprintf("partition-%d.img", partition.Index))
+		if err := rebuildPartition(from, known, deltaDir, decoder, partition, path); err != nil {
+			log.Errorf("Failed to rebuild partition %d from the delta: %v", partition.Index, err)
+			return nil, fmt.Errorf("failed to rebuild partition %d from the delta: %w", partition.Index, err)
+		}
+		rebuilt[partition.Index] = path
+	}
+
+	if manifest.Verity != nil {
+		cmd := fmt.Sprintf("veritysetup verify %s %s %s",
+			rebuilt[manifest.Verity.DataPartition], rebuilt[manifest.Verity.HashPartition], manifest.Verity.RootHash)
+		if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+			log.Errorf("Rebuilt root partition does not match the verity root hash: %v", err)
+			return nil, fmt.Errorf("rebuilt root partition does not match the verity root hash %s: %w", manifest.Verity.RootHash, err)
+		}
+	}
+	log.Infof("Delta %s verified against %s", deltaDir, fromPath)
+	return manifest, nil
+}
+
+// ReadManifest reads the manifest of the delta in deltaDir.
+func ReadManifest(deltaDir string) (*Manifest, error) {
+	manifestPath := filepath.Join(deltaDir, ManifestFile)
+	data, err := security.SafeReadFile(manifestPath, security.RejectSymlinks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delta manifest %s: %w", manifestPath, err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse delta manifest %s: %w", manifestPath, err)
+	}
+	if manifest.Version != formatVersion || manifest.Compression != compression {
+		return nil, fmt.Errorf("unsupported delta format %d with %s compression", manifest.Version, manifest.Compression)
+	}
+	if manifest.ChunkSize < minChunkSize {
+		return nil, fmt.Errorf("invalid delta chunk size %d", manifest.ChunkSize)
+	}
+	return &manifest, nil
+}
+
+// rebuildPartition writes partition to path from the chunks of the source
+// image and the chunk store.
+func rebuildPartition(from *os.File, known map[string]chunkRef, deltaDir string, decoder *zstd.Decoder, partition Partition, path string) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	var offset int64
+	for _, digest := range partition.Chunks {
+		if !isDigest(digest) {
+			return fmt.Errorf("invalid chunk digest %q", digest)
+		}
+		var data []byte
+		if ref, ok := known[digest]; ok {
+			data = make([]byte, ref.size)
+			if _, err := from.ReadAt(data, ref.offset); err != nil {
+				return fmt.Errorf("failed to read chunk %s from the source image: %w", digest, err)
+			}
+		} else {
+			compressed, err := os.ReadFile(chunkPath(deltaDir, digest))
+			if err != nil {
+				return fmt.Errorf("chunk %s missing from the delta: %w", digest, err)
+			}
+			if data, err = decoder.DecodeAll(compressed, nil); err != nil {
+				return fmt.Errorf("failed to decompress chunk %s: %w", digest, err)
+			}
+		}
+		if chunkDigest(data) != digest {
+			return fmt.Errorf("chunk %s is corrupt", digest)
+		}
+		hash.Write(data)
+		if !isZero(data) {
+			if _, err := out.WriteAt(data, offset); err != nil {
+				return err
+			}
+		}
+		offset += int64(len(data))
+	}
+	if offset != partition.Size {
+		return fmt.Errorf("rebuilt %d bytes, expected %d", offset, partition.Size)
+	}
+	if err := out.Truncate(offset); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != partition.SHA256 {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", partition.SHA256, got)
+	}
+	return nil
+}
+
+func openImage(path string) (*os.File, *gpt.Table, error) {
+	image, err := os.Open(path)
+	if err != nil {
+		log.Errorf("Failed to open image %s: %v", path, err)
+		return nil, nil, fmt.Errorf("failed to open image %s: %w", path, err)
+	}
+	table, err := gpt.Read(image, sectorSize, sectorSize)
+	if err != nil {
+		image.Close()
+		log.Errorf("Failed to read GPT of %s: %v", path, err)
+		return nil, nil, fmt.Errorf("failed to read GPT of %s, only raw GPT images are supported: %w", path, err)
+	}
+	return image, table, nil
+}
+
+func imageRef(image *os.File) ImageRef {
+	ref := ImageRef{File: filepath.Base(image.Name())}
+	if info, err := image.Stat(); err == nil {
+		ref.Size = info.Size()
+	}
+	return ref
+}
+
+// selectPartitions returns the 1-based indexes of the target partitions in
+// the delta. The dm-verity partitions are required to verify it.
+func selectPartitions(table *gpt.Table, names []string, verity *Verity) ([]int, error) {
+	var selected []int
+	found := make(map[string]bool)
+	for i, entry := range table.Partitions {
+		if entry.Start == 0 {
+			continue
+		}
+		if len(names) > 0 {
+			match := false
+			for _, name := range names {
+				if entry.Name == name {
+					match = true
+					found[name] = true
+				}
+			}
+			if !match {
+				continue
+			}
+		}
+		selected = append(selected, i+1)
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, fmt.Errorf("partition '%s' not found in the target image", name)
+		}
+	}
+	if verity != nil {
+		for _, index := range []int{verity.DataPartition, verity.HashPartition} {
+			included := false
+			for _, s := range selected {
+				included = included || s == index
+			}
+			if !included {
+				return nil, fmt.Errorf("dm-verity partition %d must be part of the delta", index)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("target image has no partitions")
+	}
+	return selected, nil
+}
+
+// parseVerity reads the dm-verity root hash and the data and hash partitions
+// from the kernel command line of the target image.
+func parseVerity(cmdline string, table *gpt.Table) (*Verity, error) {
+	var rootHash, dataDev, hashDev string
+	for _, field := range strings.Fields(cmdline) {
+		switch {
+		case strings.HasPrefix(field, "roothash="):
+			rootHash = strings.TrimPrefix(field, "roothash=")
+		case strings.HasPrefix(field, "systemd.verity_root_data="):
+			dataDev = strings.TrimPrefix(field, "systemd.verity_root_data=")
+		case strings.HasPrefix(field, "systemd.verity_root_hash="):
+			hashDev = strings.TrimPrefix(field, "systemd.verity_root_hash=")
+		}
+	}
+	if rootHash == "" {
+		return nil, nil
+	}
+	if dataDev == "" || hashDev == "" {
+		log.Warnf("Kernel command line has a verity root hash but no data and hash partitions, the delta is not checked against it")
+		return nil, nil
+	}
+	verity := &Verity{RootHash: rootHash}
+	var err error
+	if verity.DataPartition, err = findPartition(table, dataDev); err != nil {
+		return nil, err
+	}
+	if verity.HashPartition, err = findPartition(table, hashDev); err != nil {
+		return nil, err
+	}
+	return verity, nil
+}
+
+// findPartition returns the 1-based index of the partition a PARTUUID= or
+// PARTLABEL= device reference points to.
+func findPartition(table *gpt.Table, device string) (int, error) {
+	for i, entry := range table.Partitions {
+		if entry.Start == 0 {
+			continue
+		}
+		if partUUID, ok := strings.CutPrefix(device, "PARTUUID="); ok && strings.EqualFold(entry.GUID, partUUID) {
+			return i + 1, nil
+		}
+		if label, ok := strings.CutPrefix(device, "PARTLABEL="); ok && entry.Name == label {
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("dm-verity device %s not found in the target image", device)
+}
+
+// indexChunks returns the location of every chunk of the partitions of the
+// source image.
+func indexChunks(image *os.File, table *gpt.Table, chunkSize int) (map[string]chunkRef, error) {
+	known := make(map[string]chunkRef)
+	for _, entry := range table.Partitions {
+		if entry.Start == 0 {
+			continue
+		}
+		base := int64(entry.Start * sectorSize)
+		err := forEachChunk(image, entry, chunkSize, func(offset int64, data []byte) error {
+			digest := chunkDigest(data)
+			if _, ok := known[digest]; !ok {
+				known[digest] = chunkRef{offset: base + offset, size: len(data)}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Errorf("Failed to index source image %s: %v", image.Name(), err)
+			return nil, fmt.Errorf("failed to index source image %s: %w", image.Name(), err)
+		}
+	}
+	return known, nil
+}
+
+// forEachChunk calls fn with the partition-relative offset and content of
+// every chunk of the partition. The last chunk may be short.
+func forEachChunk(image io.ReaderAt, entry *gpt.Partition, chunkSize int, fn func(int64, []byte) error) error {
+	src := io.NewSectionReader(image, int64(entry.Start*sectorSize), int64(partitionBytes(entry)))
+	buf := make([]byte, chunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			if ferr := fn(offset, buf[:n]); ferr != nil {
+				return ferr
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func partitionBytes(entry *gpt.Partition) uint64 {
+	return (entry.End - entry.Start + 1) * sectorSize
+}
+
+func chunkDigest(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
+
+// chunkPath returns where a chunk lives in the chunk store, fanned out by the
+// first four digits of its digest
+func chunkPath(deltaDir, digest string) string {
+	return filepath.Join(deltaDir, ChunkDirName, digest[:4], digest+chunkSuffix)
+}
+
+func isDigest(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && len(s) == sha256.Size*2
+}
+
+func isZero(b []byte) bool {
+	return len(bytes.TrimLeft(b, "\x00")) == 0
+}
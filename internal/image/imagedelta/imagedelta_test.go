@@ -0,0 +1,180 @@
+package imagedelta
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+const (
+	rootUUID = "4f68bce3-e8cd-4db1-96e7-fbcaf984b709"
+	hashUUID = "77ff5f63-e7b6-4633-acf4-1565b864c0e6"
+	diskSize = 16 * 1024 * 1024
+)
+
+// writeImage writes a raw GPT image with an ESP, a root partition holding
+// rootData and a hash partition.
+func writeImage(t *testing.T, path string, rootData []byte) {
+	t.Helper()
+	disk, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create disk: %v", err)
+	}
+	defer disk.Close()
+	if err := disk.Truncate(diskSize); err != nil {
+		t.Fatalf("failed to size disk: %v", err)
+	}
+	table := &gpt.Table{
+		LogicalSectorSize:  sectorSize,
+		PhysicalSectorSize: sectorSize,
+		ProtectiveMBR:      true,
+		Partitions: []*gpt.Partition{
+			{Start: 2048, End: 4095, Type: gpt.EFISystemPartition, Name: "boot"},
+			{Start: 4096, End: 20479, Type: gpt.LinuxFilesystem, Name: "rootfs", GUID: rootUUID},
+			{Start: 20480, End: 22527, Type: gpt.LinuxFilesystem, Name: "roothash", GUID: hashUUID},
+		},
+	}
+	for _, p := range table.Partitions {
+		p.Size = (p.End - p.Start + 1) * sectorSize
+	}
+	if err := table.Write(disk, diskSize); err != nil {
+		t.Fatalf("failed to write partition table: %v", err)
+	}
+	if _, err := disk.WriteAt(rootData, 4096*sectorSize); err != nil {
+		t.Fatalf("failed to write root data: %v", err)
+	}
+	if _, err := disk.WriteAt([]byte("hash tree"), 20480*sectorSize); err != nil {
+		t.Fatalf("failed to write hash data: %v", err)
+	}
+}
+
+func setupImages(t *testing.T) (string, string) {
+	t.Helper()
+	original := config.Global()
+	global := config.DefaultGlobalConfig()
+	global.TempDir = t.TempDir()
+	config.SetGlobal(global)
+	t.Cleanup(func() { config.SetGlobal(original) })
+
+	dir := t.TempDir()
+	fromPath := filepath.Join(dir, "edge-1.0.raw")
+	toPath := filepath.Join(dir, "edge-1.1.raw")
+	base := []byte(strings.Repeat("root filesystem block ", 1000))
+	writeImage(t, fromPath, base)
+	writeImage(t, toPath, base)
+	// One changed block in the root partition of the target
+	to, err := os.OpenFile(toPath, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := to.WriteAt([]byte("new file content"), 4096*sectorSize+3*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+	to.Close()
+	return fromPath, toPath
+}
+
+func TestCreateAndVerify(t *testing.T) {
+	fromPath, toPath := setupImages(t)
+	outDir := filepath.Join(t.TempDir(), "edge-1.1.delta")
+
+	cmdline := fmt.Sprintf("root=/dev/mapper/root systemd.verity_root_data=PARTUUID=%s systemd.verity_root_hash=PARTLABEL=roothash roothash=abcd ro", rootUUID)
+	manifest, err := Create(fromPath, toPath, outDir, Options{Cmdline: cmdline})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if len(manifest.Partitions) != 3 || manifest.ChunkSize != DefaultChunkSize {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+	// 1 MiB ESP, 8 MiB root and 1 MiB hash partition
+	if manifest.Chunks != 160 {
+		t.Errorf("expected 160 chunks, got %d", manifest.Chunks)
+	}
+	if manifest.NewChunks != 1 {
+		t.Errorf("only the changed chunk belongs in the delta, got %d", manifest.NewChunks)
+	}
+	if manifest.Verity == nil || manifest.Verity.RootHash != "abcd" || manifest.Verity.DataPartition != 2 || manifest.Verity.HashPartition != 3 {
+		t.Errorf("unexpected verity %+v", manifest.Verity)
+	}
+	if manifest.Partitions[1].PartUUID != rootUUID || manifest.Partitions[1].Name != "rootfs" {
+		t.Errorf("unexpected root partition %+v", manifest.Partitions[1])
+	}
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `veritysetup verify \S+/partition-2\.img \S+/partition-3\.img abcd$`, Output: ""},
+		{Pattern: ".*", Error: fmt.Errorf("unexpected command")},
+	})
+	if _, err := Verify(fromPath, outDir); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	// Chunks found in the source image are not read from the store
+	if _, err := Verify(toPath, outDir); err != nil {
+		t.Errorf("the target image must also rebuild itself: %v", err)
+	}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Error: fmt.Errorf("verification failed")},
+	})
+	if _, err := Verify(fromPath, outDir); err == nil {
+		t.Error("expected the verity check to fail")
+	}
+
+	chunks, _ := filepath.Glob(filepath.Join(outDir, ChunkDirName, "*", "*"+chunkSuffix))
+	if len(chunks) != 1 {
+		t.Fatalf("expected one chunk in the store, got %v", chunks)
+	}
+	if err := os.Remove(chunks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(fromPath, outDir); err == nil || !strings.Contains(err.Error(), "missing from the delta") {
+		t.Errorf("expected a missing chunk error, got %v", err)
+	}
+
+	// The output directory must be empty
+	if _, err := Create(fromPath, toPath, outDir, Options{}); err == nil {
+		t.Error("expected an error for a non-empty output directory")
+	}
+}
+
+func TestCreateOptions(t *testing.T) {
+	fromPath, toPath := setupImages(t)
+
+	manifest, err := Create(fromPath, toPath, filepath.Join(t.TempDir(), "delta"), Options{ChunkSize: 1024 * 1024, Partitions: []string{"rootfs"}})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if len(manifest.Partitions) != 1 || manifest.Partitions[0].Index != 2 || manifest.Chunks != 8 || manifest.Verity != nil {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		contains string
+	}{
+		{"chunk size", Options{ChunkSize: 1000}, "chunk size"},
+		{"unknown partition", Options{Partitions: []string{"data"}}, "not found"},
+		{"verity partitions", Options{Partitions: []string{"rootfs"}, Cmdline: "systemd.verity_root_data=PARTLABEL=rootfs systemd.verity_root_hash=PARTLABEL=roothash roothash=abcd"}, "must be part of the delta"},
+		{"unknown verity device", Options{Cmdline: "systemd.verity_root_data=PARTLABEL=root-a systemd.verity_root_hash=PARTLABEL=roothash roothash=abcd"}, "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Create(fromPath, toPath, filepath.Join(t.TempDir(), "delta"), tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("expected error containing %q, got %v", tt.contains, err)
+			}
+		})
+	}
+
+	if _, err := Create(fromPath, filepath.Join(t.TempDir(), "missing.raw"), t.TempDir(), Options{}); err == nil {
+		t.Error("expected an error for a missing target image")
+	}
+}
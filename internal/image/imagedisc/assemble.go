@@ -0,0 +1,630 @@
+package imagedisc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/google/uuid"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+// The loopless builder installs the OS into a plain directory, then builds
+// every partition as a filesystem image from its part of that directory and
+// writes the images into the disk image behind a GPT created in Go. No loop
+// device or partition device is involved and no partition is mounted. The
+// install root belongs to root, so reading it still takes sudo.
+
+const (
+	sectorSize = 512
+	// gptReservedSectors is the size of the backup partition array and
+	// header at the end of the disk
+	gptReservedSectors = 33
+)
+
+// partitionImage is a partition of an assembled disk: its place on the disk,
+// the file its filesystem is built in and the identifiers chosen for it up
+// front, as the filesystem only exists once the OS is installed.
+type partitionImage struct {
+	partition   config.PartitionInfo
+	path        string
+	startSector uint64
+	endSector   uint64
+	partUUID    string
+	fsUUID      string
+}
+
+func (p *partitionImage) sizeBytes() uint64 {
+	return (p.endSector - p.startSector + 1) * sectorSize
+}
+
+var (
+	partitionImagesMu sync.Mutex
+	partitionImages   = make(map[string]*partitionImage)
+)
+
+func lookupPartitionImage(path string) (*partitionImage, bool) {
+	partitionImagesMu.Lock()
+	defer partitionImagesMu.Unlock()
+	image, ok := partitionImages[path]
+	return image, ok
+}
+
+// IsPartitionImage reports whether path is a partition of a disk assembled by
+// DiskAssembler rather than a block device.
+func IsPartitionImage(path string) bool {
+	_, ok := lookupPartitionImage(path)
+	return ok
+}
+
+// DiskAssembler builds a raw disk image from an install root without loop
+// devices.
+type DiskAssembler struct {
+	imagePath string
+	disk      config.DiskConfig
+	diskSize  string
+	diskBytes uint64
+	workDir   string
+	diskGUID  string
+	identity  *DiskIdentity
+	mkfsEnv   []string
+	images    []*partitionImage
+}
+
+// NewDiskAssembler lays out the partitions of the template for the raw image
+// imagePath and picks their identifiers. Reproducible builds use the pinned
+// identifiers of the loop device builder, other builds random ones. Layouts
+// with automatic sizes are only resolved by Assemble, once the content of
+// every partition is known.
+func NewDiskAssembler(imagePath string, template *config.ImageTemplate) (*DiskAssembler, error) {
+	diskInfo := template.GetDiskConfig()
+	identity, err := NewDiskIdentity(template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive reproducible disk identity: %w", err)
+	}
+	var mkfsEnv []string
+	if identity != nil {
+		// mkfs -d adds the files of each directory in collation order
+		mkfsEnv = append(identity.MkfsEnv(), "LC_ALL=C")
+	} else {
+		identity = &DiskIdentity{TemplateHash: uuid.NewString()}
+	}
+
+	assembler := &DiskAssembler{
+		imagePath: imagePath,
+		disk:      diskInfo,
+		workDir:   filepath.Join(filepath.Dir(imagePath), "partitions"),
+		diskGUID:  identity.DiskGUID(),
+		identity:  identity,
+		mkfsEnv:   mkfsEnv,
+	}
+	if diskInfo.DiskGUID != "" {
+		assembler.diskGUID = strings.ToLower(diskInfo.DiskGUID)
+	}
+	for i, partition := range diskInfo.Partitions {
+		fsUUID := filesystemUUID(identity, partition)
+		if config.IsReadOnlyFsType(partition.FsType) {
+			if fsUUID, err = ReadOnlyFilesystemUUID(template, partition); err != nil {
+				return nil, err
+			}
+		}
+		assembler.images = append(assembler.images, &partitionImage{
+			partition: partition,
+			path:      filepath.Join(assembler.workDir, fmt.Sprintf("p%d-%s.img", i+1, partition.ID)),
+			partUUID:  partitionGUID(partition, identity),
+			fsUUID:    fsUUID,
+		})
+	}
+
+	if !diskInfo.IsAutoSized() {
+		diskSize, err := VerifyFileSize(diskInfo.Size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid disk size %s: %w", diskInfo.Size, err)
+		}
+		if assembler.diskBytes, err = TranslateSizeStrToBytes(diskSize); err != nil {
+			return nil, fmt.Errorf("invalid disk size %s: %w", diskInfo.Size, err)
+		}
+		assembler.diskSize = diskSize
+	}
+	if !assembler.isAutoSized() {
+		partitions, err := ResolvePartitionLayout(diskInfo.Partitions, assembler.diskBytes, diskInfo.PartitionTableType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid partition layout: %w", err)
+		}
+		if err := assembler.place(partitions, assembler.diskBytes); err != nil {
+			return nil, err
+		}
+	}
+
+	partitionImagesMu.Lock()
+	defer partitionImagesMu.Unlock()
+	for _, image := range assembler.images {
+		partitionImages[image.path] = image
+	}
+	return assembler, nil
+}
+
+// isAutoSized reports whether the layout depends on the installed content.
+func (a *DiskAssembler) isAutoSized() bool {
+	if a.disk.IsAutoSized() {
+		return true
+	}
+	for _, partition := range a.disk.Partitions {
+		if a.disk.IsAutoSizedPartition(partition) {
+			return true
+		}
+	}
+	return false
+}
+
+// place puts the partition images on a disk of diskBytes, from partitions
+// with resolved start and end offsets.
+func (a *DiskAssembler) place(partitions []config.PartitionInfo, diskBytes uint64) error {
+	for i, partition := range partitions {
+		startSector, endSector, err := partitionSectors(partition, diskBytes)
+		if err != nil {
+			return err
+		}
+		image := a.images[i]
+		image.partition = partition
+		image.startSector = startSector
+		image.endSector = endSector
+	}
+	a.diskBytes = diskBytes
+	if a.diskSize == "" {
+		a.diskSize = fmt.Sprintf("%dMiB", diskBytes/partitionAlignment)
+	}
+	return nil
+}
+
+// partitionSectors returns the first and last sector of partition the way
+// the loop device builder places it: the start aligned to 1MiB and an end of
+// "0" extending to the last usable sector of the GPT.
+func partitionSectors(partition config.PartitionInfo, diskBytes uint64) (uint64, uint64, error) {
+	startBytes, err := TranslateSizeStrToBytes(partition.Start)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start %s of partition %s: %w", partition.Start, partition.ID, err)
+	}
+	startBytes = alignUp(startBytes)
+	if startBytes == 0 {
+		startBytes = partitionAlignment
+	}
+	lastUsable := diskBytes/sectorSize - gptReservedSectors - 1
+	endSector := lastUsable
+	if partition.End != "0" {
+		endBytes, err := TranslateSizeStrToBytes(partition.End)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid end %s of partition %s: %w", partition.End, partition.ID, err)
+		}
+		endSector = endBytes/sectorSize - 1
+	}
+	startSector := startBytes / sectorSize
+	if endSector < startSector || endSector > lastUsable {
+		return 0, 0, fmt.Errorf("partition %s does not fit the disk", partition.ID)
+	}
+	return startSector, endSector, nil
+}
+
+// filesystemUUID returns the UUID blkid reports for the filesystem of
+// partition once built, or an empty string for filesystems without one.
+// Read-only filesystems get theirs from ReadOnlyFilesystemUUID.
+func filesystemUUID(identity *DiskIdentity, partition config.PartitionInfo) string {
+	switch partition.FsType {
+	case "fat32", "fat16", "vfat":
+		volumeID := strings.ToUpper(identity.VolumeID(partition.ID))
+		return volumeID[:4] + "-" + volumeID[4:]
+	case "ext2", "ext3", "ext4", "linux-swap":
+		return identity.FilesystemUUID(partition.ID)
+	}
+	return ""
+}
+
+// PartitionDevices returns the partition image of every partition by ID, to
+// be used in place of the partition devices of a loop device.
+func (a *DiskAssembler) PartitionDevices() map[string]string {
+	devices := make(map[string]string, len(a.images))
+	for _, image := range a.images {
+		devices[image.partition.ID] = image.path
+	}
+	return devices
+}
+
+// Assemble builds the filesystem of every partition from installRoot and
+// writes them, with the partition table, into the raw image. Automatic sizes
+// are resolved first, from the content of each partition.
+func (a *DiskAssembler) Assemble(installRoot string) (err error) {
+	if err := os.MkdirAll(a.workDir, 0700); err != nil {
+		log.Errorf("Failed to create directory %s: %v", a.workDir, err)
+		return fmt.Errorf("failed to create directory %s: %w", a.workDir, err)
+	}
+
+	// Each filesystem only holds the files of its own mount point: mount
+	// points are moved aside deepest first, leaving an empty directory in
+	// the filesystem of their parent, and built from where they were moved
+	var mounted []*partitionImage
+	for _, image := range a.images {
+		if isMountedPartition(image.partition) {
+			mounted = append(mounted, image)
+		}
+	}
+	sort.SliceStable(mounted, func(i, j int) bool {
+		return mountPointDepth(mounted[i].partition.MountPoint) > mountPointDepth(mounted[j].partition.MountPoint)
+	})
+
+	stashDir := filepath.Join(a.workDir, "stash")
+	var stashed []*partitionImage
+	defer func() {
+		for i := len(stashed) - 1; i >= 0; i-- {
+			image := stashed[i]
+			dir := filepath.Join(installRoot, image.partition.MountPoint)
+			if restoreErr := restoreMountPoint(dir, filepath.Join(stashDir, image.partition.ID)); restoreErr != nil && err == nil {
+				err = restoreErr
+			}
+		}
+	}()
+	sources := make(map[*partitionImage]string)
+	for _, image := range mounted {
+		dir := filepath.Join(installRoot, image.partition.MountPoint)
+		if filepath.Clean(image.partition.MountPoint) == "/" {
+			sources[image] = dir
+			continue
+		}
+		stashPath := filepath.Join(stashDir, image.partition.ID)
+		if err := stashMountPoint(dir, stashPath); err != nil {
+			return err
+		}
+		stashed = append(stashed, image)
+		sources[image] = stashPath
+	}
+
+	built := make(map[*partitionImage]bool)
+	if a.isAutoSized() {
+		if err := a.layOutAutoSizes(sources, built); err != nil {
+			return err
+		}
+	}
+	for _, image := range a.images {
+		if built[image] {
+			continue
+		}
+		if err := a.buildFilesystem(image, sources[image]); err != nil {
+			return err
+		}
+	}
+
+	return a.writeDisk()
+}
+
+// isMountedPartition reports whether the filesystem of partition is built from
+// the content of its mount point.
+func isMountedPartition(partition config.PartitionInfo) bool {
+	mountPoint := strings.TrimSpace(partition.MountPoint)
+	return mountPoint != "" && mountPoint != "none" && partition.FsType != "linux-swap"
+}
+
+func mountPointDepth(mountPoint string) int {
+	mountPoint = filepath.Clean(mountPoint)
+	if mountPoint == "/" {
+		return 0
+	}
+	return strings.Count(mountPoint, "/")
+}
+
+// stashMountPoint moves dir to stashPath and leaves an empty directory with
+// the same permissions and times in its place. The modification time of the
+// parent directory is kept as well.
+func stashMountPoint(dir, stashPath string) error {
+	mode := os.FileMode(0755)
+	if info, err := os.Stat(dir); err == nil {
+		mode = info.Mode().Perm()
+	}
+	parentInfo, err := os.Stat(filepath.Dir(dir))
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", filepath.Dir(dir), err)
+	}
+	if _, err := shell.ExecCmd(fmt.Sprintf("mkdir -p %s", filepath.Dir(stashPath)), true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to create directory %s: %v", filepath.Dir(stashPath), err)
+		return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(stashPath), err)
+	}
+	if _, err := shell.ExecCmd(fmt.Sprintf("mv %s %s", dir, stashPath), true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to move %s aside: %v", dir, err)
+		return fmt.Errorf("failed to move %s aside: %w", dir, err)
+	}
+	if _, err := shell.ExecCmd(fmt.Sprintf("mkdir -m %o %s", mode, dir), true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to create mount point %s: %v", dir, err)
+		return fmt.Errorf("failed to create mount point %s: %w", dir, err)
+	}
+	mtime := parentInfo.ModTime()
+	for _, cmdStr := range []string{
+		fmt.Sprintf("touch -r %s %s", stashPath, dir),
+		fmt.Sprintf("touch -m -d @%d.%09d %s", mtime.Unix(), mtime.Nanosecond(), filepath.Dir(dir)),
+	} {
+		if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil); err != nil {
+			log.Errorf("Failed to restore times of mount point %s: %v", dir, err)
+			return fmt.Errorf("failed to restore times of mount point %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// restoreMountPoint puts back a directory moved aside by stashMountPoint.
+func restoreMountPoint(dir, stashPath string) error {
+	if _, err := shell.ExecCmd(fmt.Sprintf("rm -rf %s", dir), true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to remove mount point %s: %v", dir, err)
+		return fmt.Errorf("failed to remove mount point %s: %w", dir, err)
+	}
+	if _, err := shell.ExecCmd(fmt.Sprintf("mv %s %s", stashPath, dir), true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to restore %s: %v", dir, err)
+		return fmt.Errorf("failed to restore %s: %w", dir, err)
+	}
+	return nil
+}
+
+// buildFilesystem creates the filesystem of image, filled with the content of
+// dir when dir is not empty. Reading the install root requires sudo, the
+// image files themselves belong to the build user.
+func (a *DiskAssembler) buildFilesystem(image *partitionImage, dir string) error {
+	partition := image.partition
+	log.Infof("Building %s filesystem image of partition %s", partition.FsType, partition.ID)
+
+	// mksquashfs and mkfs.erofs size their image to the content
+	imageSize := image.sizeBytes()
+	if config.IsReadOnlyFsType(partition.FsType) {
+		imageSize = 0
+	}
+	if _, err := shell.ExecCmd(fmt.Sprintf("truncate -s %d %s", imageSize, image.path), false, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to create partition image %s: %v", image.path, err)
+		return fmt.Errorf("failed to create partition image %s: %w", image.path, err)
+	}
+
+	var labelFlag string
+	if partition.FsLabel != "" {
+		labelFlag = fmt.Sprintf("-L %s ", partition.FsLabel)
+	}
+	idFlags := a.identity.mkfsFlags(partition.ID, partition.FsType)
+
+	var cmdStr string
+	switch partition.FsType {
+	case "ext2", "ext3", "ext4":
+		cmdStr = fmt.Sprintf("mkfs -t %s %s%s %s", partition.FsType, labelFlag, extFeatureFlags(partition.FsType), idFlags)
+		if dir != "" {
+			cmdStr += " -d " + dir
+		}
+		cmdStr += " " + image.path
+	case "fat32", "fat16", "vfat":
+		cmdStr = "mkfs -t vfat "
+		switch partition.FsType {
+		case "fat32":
+			cmdStr += "-F 32 "
+		case "fat16":
+			cmdStr += "-F 16 "
+		}
+		if partition.FsLabel != "" {
+			cmdStr += fmt.Sprintf("-n %s ", partition.FsLabel)
+		}
+		// The hidden sectors field records where the partition starts, as
+		// mkfs.vfat finds out by itself on a partition device
+		cmdStr += fmt.Sprintf("-h %d ", image.startSector)
+		if a.mkfsEnv != nil {
+			cmdStr += "--invariant "
+		}
+		cmdStr += fmt.Sprintf("%s %s", idFlags, image.path)
+	case "linux-swap":
+		cmdStr = fmt.Sprintf("mkswap %s%s %s", labelFlag, idFlags, image.path)
+	case "squashfs", "erofs":
+		if dir == "" {
+			return fmt.Errorf("%s partition %s requires a mount point", partition.FsType, partition.ID)
+		}
+		epoch, err := readOnlyFsEpoch()
+		if err != nil {
+			return err
+		}
+		cmdStr = readOnlyFsCmd(partition, image.fsUUID, dir, image.path, epoch)
+	case "":
+		return nil
+	default:
+		return fmt.Errorf("fs type %s of partition %s is not supported by the loopless builder", partition.FsType, partition.ID)
+	}
+	if _, err := shell.ExecCmd(cmdStr, dir != "", shell.HostPath, a.mkfsEnv); err != nil {
+		log.Errorf("Failed to build filesystem image of partition %s: %v", partition.ID, err)
+		return fmt.Errorf("failed to build filesystem image of partition %s: %w", partition.ID, err)
+	}
+
+	if dir == "" {
+		return nil
+	}
+	switch partition.FsType {
+	case "ext2", "ext3", "ext4":
+		if a.mkfsEnv != nil {
+			if err := a.identity.resetInodeTimes(image.path, dir); err != nil {
+				return err
+			}
+		}
+	case "fat32", "fat16", "vfat":
+		if err := copyToFatImage(dir, image.path, a.mkfsEnv); err != nil {
+			return fmt.Errorf("failed to copy files to partition %s: %w", partition.ID, err)
+		}
+	}
+	return nil
+}
+
+// copyToFatImage copies the content of dir to the root of the FAT image
+// imagePath, keeping the file modification times. Entries are added one by
+// one in sorted order so the directory entries do not depend on the order
+// the install root lists them in.
+func copyToFatImage(dir, imagePath string, env []string) error {
+	output, err := shell.ExecCmd(fmt.Sprintf("find %s -mindepth 1 -printf '%%y %%P\\n'", dir), true, shell.HostPath, nil)
+	if err != nil {
+		log.Errorf("Failed to list %s: %v", dir, err)
+		return fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	// Each directory sorts before its content
+	isDir := make(map[string]bool)
+	var paths []string
+	for _, entry := range strings.Split(output, "\n") {
+		fileType, path, ok := strings.Cut(entry, " ")
+		if !ok || path == "" {
+			continue
+		}
+		isDir[path] = fileType == "d"
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		var cmdStr string
+		if isDir[path] {
+			cmdStr = fmt.Sprintf("mmd -i %s '::/%s'", imagePath, path)
+		} else {
+			cmdStr = fmt.Sprintf("mcopy -i %s -p -Q -m '%s' '::/%s'", imagePath, filepath.Join(dir, path), path)
+		}
+		if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, env); err != nil {
+			log.Errorf("Failed to copy %s to %s: %v", path, imagePath, err)
+			return fmt.Errorf("failed to copy %s to %s: %w", path, imagePath, err)
+		}
+	}
+	return nil
+}
+
+// writeDisk creates the raw image with the partition table and copies the
+// partition images into place.
+func (a *DiskAssembler) writeDisk() error {
+	if err := CreateRawFile(a.imagePath, a.diskSize, false); err != nil {
+		return err
+	}
+	disk, err := os.OpenFile(a.imagePath, os.O_RDWR, 0)
+	if err != nil {
+		log.Errorf("Failed to open raw image %s: %v", a.imagePath, err)
+		return fmt.Errorf("failed to open raw image %s: %w", a.imagePath, err)
+	}
+	defer disk.Close()
+
+	if err := a.writePartitionTable(disk); err != nil {
+		return err
+	}
+	for _, image := range a.images {
+		if err := copyPartitionImage(disk, image); err != nil {
+			return err
+		}
+	}
+	if err := disk.Sync(); err != nil {
+		return fmt.Errorf("failed to sync raw image %s: %w", a.imagePath, err)
+	}
+	log.Infof("Assembled raw image %s from %d partition images", a.imagePath, len(a.images))
+	return nil
+}
+
+// writePartitionTable writes the protective MBR and both GPT headers, with
+// the partition types, names and attributes sfdisk would set.
+func (a *DiskAssembler) writePartitionTable(disk *os.File) error {
+	table := &gpt.Table{
+		LogicalSectorSize:  sectorSize,
+		PhysicalSectorSize: sectorSize,
+		ProtectiveMBR:      true,
+		GUID:               a.diskGUID,
+	}
+	for _, image := range a.images {
+		partition := image.partition
+		typeGUID := gptTypeGUID(partition)
+		if typeGUID == "" {
+			typeGUID = partitionTypeNameToGUID["linux"]
+		}
+		name := partition.Name
+		if name == "" {
+			name = partition.ID
+		}
+		attrs, err := gptPartitionAttributes(partition)
+		if err != nil {
+			log.Errorf("Invalid attributes for partition %s: %v", partition.ID, err)
+			return err
+		}
+		table.Partitions = append(table.Partitions, &gpt.Partition{
+			Start:      image.startSector,
+			End:        image.endSector,
+			Size:       image.sizeBytes(),
+			Type:       gpt.Type(typeGUID),
+			Name:       name,
+			GUID:       image.partUUID,
+			Attributes: attrs,
+		})
+	}
+	if err := table.Write(disk, int64(a.diskBytes)); err != nil {
+		log.Errorf("Failed to write partition table to %s: %v", a.imagePath, err)
+		return fmt.Errorf("failed to write partition table to %s: %w", a.imagePath, err)
+	}
+	return nil
+}
+
+// copyPartitionImage writes the partition image into the disk at the start of
+// its partition. Zero blocks are skipped, the disk reads as zero there.
+func copyPartitionImage(disk *os.File, image *partitionImage) error {
+	src, err := os.Open(image.path)
+	if os.IsNotExist(err) {
+		// Partitions without a filesystem are left empty
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open partition image %s: %w", image.path, err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat partition image %s: %w", image.path, err)
+	}
+	if uint64(info.Size()) > image.sizeBytes() {
+		log.Errorf("Filesystem of partition %s needs %d bytes but the partition only has %d", image.partition.ID, info.Size(), image.sizeBytes())
+		return fmt.Errorf("filesystem of partition %s does not fit the partition: %d > %d bytes", image.partition.ID, info.Size(), image.sizeBytes())
+	}
+
+	buf := make([]byte, partitionAlignment)
+	offset := int64(image.startSector * sectorSize)
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 && !isZero(buf[:n]) {
+			if _, werr := disk.WriteAt(buf[:n], offset); werr != nil {
+				return fmt.Errorf("failed to write partition %s to the raw image: %w", image.partition.ID, werr)
+			}
+		}
+		offset += int64(n)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read partition image %s: %w", image.path, err)
+		}
+	}
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Cleanup removes the partition images. The raw image is kept.
+func (a *DiskAssembler) Cleanup() error {
+	partitionImagesMu.Lock()
+	for _, image := range a.images {
+		delete(partitionImages, image.path)
+	}
+	partitionImagesMu.Unlock()
+
+	if _, err := os.Stat(a.workDir); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := shell.ExecCmd(fmt.Sprintf("rm -rf %s", a.workDir), true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to remove partition images %s: %v", a.workDir, err)
+		return fmt.Errorf("failed to remove partition images %s: %w", a.workDir, err)
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package imagedisc
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func looplessTestTemplate() *config.ImageTemplate {
+	return &config.ImageTemplate{
+		Image: config.ImageInfo{Name: "test"},
+		Disk: config.DiskConfig{
+			Size:               "64MiB",
+			PartitionTableType: "gpt",
+			Builder:            config.DiskBuilderLoopless,
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", Name: "esp", Type: "esp", FsType: "fat32", MountPoint: "/boot/efi", Start: "1MiB", End: "9MiB"},
+				{ID: "rootfs", FsType: "ext4", MountPoint: "/", Start: "9MiB", End: "0"},
+			},
+		},
+	}
+}
+
+func writeTestPartitionImage(t *testing.T, path string, offset int64, marker string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create %s: %v", path, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt([]byte(marker), offset); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestDiskAssembler(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	buildDir := filepath.Join(tempDir, "build")
+	installRoot := filepath.Join(tempDir, "root")
+	if err := os.MkdirAll(filepath.Join(installRoot, "boot", "efi", "EFI"), 0700); err != nil {
+		t.Fatalf("failed to create install root: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(installRoot, "boot", "efi"), 0700); err != nil {
+		t.Fatalf("failed to chmod ESP directory: %v", err)
+	}
+	imagePath := filepath.Join(buildDir, "test.raw")
+
+	assembler, err := NewDiskAssembler(imagePath, looplessTestTemplate())
+	if err != nil {
+		t.Fatalf("NewDiskAssembler failed: %v", err)
+	}
+	devices := assembler.PartitionDevices()
+	bootImage, rootImage := devices["boot"], devices["rootfs"]
+	if !IsPartitionImage(bootImage) || !IsPartitionImage(rootImage) {
+		t.Fatalf("partition images not registered: %v", devices)
+	}
+
+	// The identifiers are known before the filesystems exist
+	bootUUID, err := GetUUID(bootImage)
+	if err != nil || !regexp.MustCompile(`^[0-9A-F]{4}-[0-9A-F]{4}$`).MatchString(bootUUID) {
+		t.Errorf("unexpected FAT volume UUID %q (%v)", bootUUID, err)
+	}
+	rootPartUUID, err := GetPartUUID(rootImage)
+	if err != nil || len(rootPartUUID) != 36 {
+		t.Errorf("unexpected partition UUID %q (%v)", rootPartUUID, err)
+	}
+
+	// The mocked mkfs tools leave the images the test writes untouched
+	if err := os.MkdirAll(filepath.Join(buildDir, "partitions"), 0700); err != nil {
+		t.Fatalf("failed to create partition directory: %v", err)
+	}
+	writeTestPartitionImage(t, bootImage, 0, "FATIMAGE")
+	writeTestPartitionImage(t, rootImage, 4096, "EXTIMAGE")
+	// fallocate is mocked as well
+	writeTestPartitionImage(t, imagePath, 64*1024*1024-1, "\x00")
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "truncate -s (8388608 .*p1-boot.img|57654784 .*p2-rootfs.img)$", Output: "", Error: nil},
+		{Pattern: "mkfs -t vfat -F 32 -h 2048 -i [0-9a-f]{8} .*p1-boot.img$", Output: "", Error: nil},
+		{Pattern: "find .*/partitions/stash/boot -mindepth 1 -printf '%y %P.n'$", Output: "f EFI/BOOT/BOOTX64.EFI\nd EFI\nd EFI/BOOT\n", Error: nil},
+		{Pattern: "mmd -i .*p1-boot.img '::/EFI'$", Output: "", Error: nil},
+		{Pattern: "mmd -i .*p1-boot.img '::/EFI/BOOT'$", Output: "", Error: nil},
+		{Pattern: "mcopy -i .*p1-boot.img -p -Q -m '.*/partitions/stash/boot/EFI/BOOT/BOOTX64.EFI' '::/EFI/BOOT/BOOTX64.EFI'$", Output: "", Error: nil},
+		{Pattern: "mkfs -t ext4 -b 4096 -O .* -U [0-9a-f-]{36} -E hash_seed=[0-9a-f-]{36} -d .*/root .*p2-rootfs.img$", Output: "", Error: nil},
+		{Pattern: "mkdir -p .*/partitions/stash$", Output: "", Error: nil},
+		{Pattern: "mv .*/root/boot/efi .*/partitions/stash/boot$", Output: "", Error: nil},
+		{Pattern: "mkdir -m 700 .*/root/boot/efi$", Output: "", Error: nil},
+		{Pattern: "touch -r .*/partitions/stash/boot .*/root/boot/efi$", Output: "", Error: nil},
+		{Pattern: "touch -m -d @[0-9]+\\.[0-9]{9} .*/root/boot$", Output: "", Error: nil},
+		{Pattern: "rm -rf .*/root/boot/efi$", Output: "", Error: nil},
+		{Pattern: "mv .*/partitions/stash/boot .*/root/boot/efi$", Output: "", Error: nil},
+		{Pattern: "fallocate -l .*test.raw$", Output: "", Error: nil},
+		{Pattern: "rm -rf .*/build/partitions$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	if err := assembler.Assemble(installRoot); err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+
+	disk, err := os.Open(imagePath)
+	if err != nil {
+		t.Fatalf("failed to open raw image: %v", err)
+	}
+	defer disk.Close()
+	table, err := gpt.Read(disk, sectorSize, sectorSize)
+	if err != nil {
+		t.Fatalf("failed to read partition table: %v", err)
+	}
+	if len(table.Partitions) < 2 {
+		t.Fatalf("expected 2 partitions, got %d", len(table.Partitions))
+	}
+	esp, root := table.Partitions[0], table.Partitions[1]
+	if esp.Start != 2048 || esp.End != 18431 || esp.Name != "esp" ||
+		!strings.EqualFold(string(esp.Type), partitionTypeNameToGUID["esp"]) {
+		t.Errorf("unexpected ESP entry %+v", esp)
+	}
+	// The last partition ends on the last usable sector, like with sfdisk
+	if root.Start != 18432 || root.End != 131038 || root.Name != "rootfs" ||
+		!strings.EqualFold(string(root.Type), partitionTypeNameToGUID["linux"]) ||
+		!strings.EqualFold(root.GUID, rootPartUUID) {
+		t.Errorf("unexpected root entry %+v", root)
+	}
+
+	for offset, marker := range map[int64]string{2048 * sectorSize: "FATIMAGE", 18432*sectorSize + 4096: "EXTIMAGE"} {
+		buf := make([]byte, len(marker))
+		if _, err := disk.ReadAt(buf, offset); err != nil || string(buf) != marker {
+			t.Errorf("expected %s at offset %d, got %q (%v)", marker, offset, buf, err)
+		}
+	}
+
+	if err := assembler.Cleanup(); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if IsPartitionImage(bootImage) {
+		t.Error("partition image still registered after cleanup")
+	}
+}
+
+func TestDiskAssemblerFailures(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "rm -rf .*/partitions$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	template := looplessTestTemplate()
+	template.Disk.Partitions[1].End = "128MiB"
+	if _, err := NewDiskAssembler(filepath.Join(t.TempDir(), "test.raw"), template); err == nil {
+		t.Fatal("expected error for a partition beyond the end of the disk")
+	}
+
+	template = looplessTestTemplate()
+	template.Disk.Size = ""
+	if _, err := NewDiskAssembler(filepath.Join(t.TempDir(), "test.raw"), template); err == nil {
+		t.Fatal("expected error without disk size")
+	}
+
+	// A filesystem larger than its partition is rejected
+	assembler, err := NewDiskAssembler(filepath.Join(t.TempDir(), "test.raw"), looplessTestTemplate())
+	if err != nil {
+		t.Fatalf("NewDiskAssembler failed: %v", err)
+	}
+	defer assembler.Cleanup()
+	image := assembler.images[0]
+	if err := os.MkdirAll(filepath.Dir(image.path), 0700); err != nil {
+		t.Fatalf("failed to create partition directory: %v", err)
+	}
+	writeTestPartitionImage(t, image.path, int64(image.sizeBytes()), "X")
+	disk, err := os.Create(filepath.Join(t.TempDir(), "disk.raw"))
+	if err != nil {
+		t.Fatalf("failed to create disk: %v", err)
+	}
+	defer disk.Close()
+	if err := copyPartitionImage(disk, image); err == nil || !strings.Contains(err.Error(), "does not fit") {
+		t.Fatalf("expected does not fit error, got %v", err)
+	}
+}
+
+// writeTestInstallRoot writes files into a new install root at root, in
+// reverse order when reverse is set, and clamps their modification times
+// like the OS installation does. Their access times are set to atime.
+func writeTestInstallRoot(t *testing.T, root string, files map[string]string, reverse bool, atime time.Time) {
+	t.Helper()
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	if reverse {
+		slices.Reverse(paths)
+	}
+	for _, path := range paths {
+		fullPath := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(fullPath), err)
+		}
+		if err := os.WriteFile(fullPath, []byte(files[path]), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", fullPath, err)
+		}
+	}
+	epoch := time.Unix(1700000000, 0)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, atime, epoch)
+	})
+	if err != nil {
+		t.Fatalf("failed to set times under %s: %v", root, err)
+	}
+}
+
+func TestDiskAssemblerReproducible(t *testing.T) {
+	for _, tool := range []string{"sudo", "mkfs.ext4", "debugfs"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+	if err := exec.Command("sudo", "-n", "true").Run(); err != nil {
+		t.Skip("passwordless sudo not available")
+	}
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+	t.Setenv(config.SourceDateEpochEnv, "1700000000")
+
+	template := looplessTestTemplate()
+	template.Image.Reproducible = true
+	files := map[string]string{
+		"etc/hostname":           "edge\n",
+		"etc/os-release":         "ID=test\n",
+		"usr/bin/tool":           "#!/bin/sh\n",
+		"usr/share/doc/a/README": "a\n",
+		"usr/share/doc/b/README": "b\n",
+		"var/lib/state":          "",
+	}
+	// The ESP is only covered where mtools and dosfstools are installed
+	hasFatTools := true
+	for _, tool := range []string{"mkfs.vfat", "mcopy", "mmd"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			hasFatTools = false
+		}
+	}
+	if hasFatTools {
+		files["boot/efi/EFI/BOOT/BOOTX64.EFI"] = "MZ"
+		files["boot/efi/EFI/test/grub.cfg"] = "set timeout=0\n"
+	} else {
+		template.Disk.Partitions = template.Disk.Partitions[1:]
+		template.Disk.Partitions[0].Start = "1MiB"
+	}
+
+	var images [][]byte
+	for i, reverse := range []bool{false, true} {
+		buildDir := filepath.Join(tempDir, fmt.Sprintf("build%d", i))
+		installRoot := filepath.Join(tempDir, fmt.Sprintf("root%d", i))
+		writeTestInstallRoot(t, installRoot, files, reverse, time.Now().Add(time.Duration(i)*time.Hour))
+
+		imagePath := filepath.Join(buildDir, "test.raw")
+		assembler, err := NewDiskAssembler(imagePath, template)
+		if err != nil {
+			t.Fatalf("NewDiskAssembler failed: %v", err)
+		}
+		if err := assembler.Assemble(installRoot); err != nil {
+			t.Fatalf("Assemble failed: %v", err)
+		}
+		if err := assembler.Cleanup(); err != nil {
+			t.Fatalf("Cleanup failed: %v", err)
+		}
+		image, err := os.ReadFile(imagePath)
+		if err != nil {
+			t.Fatalf("failed to read raw image: %v", err)
+		}
+		images = append(images, image)
+	}
+
+	if !bytes.Equal(images[0], images[1]) {
+		t.Fatal("two builds of the same reproducible template differ")
+	}
+}
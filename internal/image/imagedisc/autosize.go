@@ -0,0 +1,183 @@
+package imagedisc
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+// Partitions sized "auto" get the space their content needs once built into a
+// filesystem, plus the requested headroom. A disk sized "auto" is as large as
+// its partitions, with the first MiB and the last MiB left for the GPT.
+
+const (
+	// extInodeRatio is the bytes-per-inode ratio of mke2fs for the
+	// filesystem sizes auto sizing produces
+	extInodeRatio = 16384
+	// extInodeSize is the on-disk size of an ext inode
+	extInodeSize = 256
+	// extBlockSize is the block size the loopless builder formats ext with
+	extBlockSize = 4096
+	// fat32MinBytes fits the 65525 clusters FAT32 needs with the cluster
+	// size mkfs.vfat picks for small volumes
+	fat32MinBytes = 36 * 1024 * 1024
+)
+
+// layOutAutoSizes measures the content of the automatically sized
+// partitions, from the directories in sources, and places every partition.
+// Partitions built while being measured are recorded in built.
+func (a *DiskAssembler) layOutAutoSizes(sources map[*partitionImage]string, built map[*partitionImage]bool) error {
+	_, diskHeadroom, err := config.ParseAutoSize(a.disk.Size)
+	if err != nil {
+		return err
+	}
+	partitions := make([]config.PartitionInfo, len(a.images))
+	for i, image := range a.images {
+		partition := image.partition
+		if a.disk.IsAutoSizedPartition(partition) {
+			size, err := a.autoPartitionSize(image, sources[image], diskHeadroom)
+			if err != nil {
+				return err
+			}
+			built[image] = config.IsReadOnlyFsType(partition.FsType)
+			partition.Size = fmt.Sprintf("%dMiB", size/partitionAlignment)
+			partition.MinSize, partition.MaxSize = "", ""
+		}
+		partitions[i] = partition
+	}
+
+	diskBytes := a.diskBytes
+	if a.disk.IsAutoSized() {
+		diskBytes = 2 * partitionAlignment
+		for _, partition := range partitions {
+			size, err := TranslateSizeStrToBytes(partition.Size)
+			if err != nil {
+				return fmt.Errorf("invalid size %s of partition %s: %w", partition.Size, partition.ID, err)
+			}
+			diskBytes += alignUp(size)
+		}
+		log.Infof("Disk sized to %s", TranslateBytesToSizeStr(diskBytes))
+	}
+	resolved, err := ResolvePartitionLayout(partitions, diskBytes, a.disk.PartitionTableType)
+	if err != nil {
+		return fmt.Errorf("invalid partition layout: %w", err)
+	}
+	return a.place(resolved, diskBytes)
+}
+
+// autoPartitionSize returns the aligned size of an automatically sized
+// partition holding the content of dir. A squashfs or erofs partition is
+// built to measure it.
+func (a *DiskAssembler) autoPartitionSize(image *partitionImage, dir string, diskHeadroom int) (uint64, error) {
+	partition := image.partition
+	_, headroom, err := config.ParseAutoSize(partition.Size)
+	if err != nil || headroom == 0 {
+		headroom = diskHeadroom
+	}
+
+	var needed uint64
+	if config.IsReadOnlyFsType(partition.FsType) {
+		if err := a.buildFilesystem(image, dir); err != nil {
+			return 0, err
+		}
+		info, err := os.Stat(image.path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to stat partition image %s: %w", image.path, err)
+		}
+		needed = uint64(info.Size())
+	} else {
+		contentBytes, inodes, err := measureDirectory(dir)
+		if err != nil {
+			return 0, err
+		}
+		needed = estimateFilesystemBytes(partition.FsType, contentBytes, inodes)
+	}
+
+	minBytes, maxBytes, err := partitionBounds(partition)
+	if err != nil {
+		return 0, err
+	}
+	if maxBytes != 0 && needed > maxBytes {
+		log.Errorf("Content of partition %s needs %s, more than its maxSize %s", partition.ID, TranslateBytesToSizeStr(needed), partition.MaxSize)
+		return 0, fmt.Errorf("content of partition %s needs %s, more than its maxSize %s",
+			partition.ID, TranslateBytesToSizeStr(needed), partition.MaxSize)
+	}
+	size := clampSize(alignUp(needed+needed*uint64(headroom)/100), minBytes, maxBytes)
+	log.Infof("Partition %s sized to %s for %s of filesystem", partition.ID, TranslateBytesToSizeStr(size), TranslateBytesToSizeStr(needed))
+	return size, nil
+}
+
+// measureDirectory returns the disk usage in bytes and the number of inodes
+// of the tree under dir.
+func measureDirectory(dir string) (uint64, uint64, error) {
+	var values [2]uint64
+	for i, flag := range []string{"--block-size=1", "--inodes"} {
+		output, err := shell.ExecCmd(fmt.Sprintf("du -s %s %s", flag, dir), true, shell.HostPath, nil)
+		if err != nil {
+			log.Errorf("Failed to measure %s: %v", dir, err)
+			return 0, 0, fmt.Errorf("failed to measure %s: %w", dir, err)
+		}
+		fields := strings.Fields(output)
+		if len(fields) == 0 {
+			return 0, 0, fmt.Errorf("failed to measure %s: empty du output", dir)
+		}
+		if values[i], err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("failed to measure %s: unexpected du output %q", dir, output)
+		}
+	}
+	return values[0], values[1], nil
+}
+
+// estimateFilesystemBytes returns the size of a filesystem of fsType able to
+// hold contentBytes of files in inodes inodes, metadata included.
+func estimateFilesystemBytes(fsType string, contentBytes, inodes uint64) uint64 {
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		// Directories, extent trees and the superblock and group
+		// descriptor copies, then enough inodes at the mke2fs ratio
+		size := contentBytes + contentBytes/20 + 4*1024*1024
+		if minSize := inodes * extInodeRatio; size < minSize {
+			size = minSize
+		}
+		size += size / extInodeRatio * extInodeSize
+		if fsType != "ext2" {
+			size += extJournalBytes(size / extBlockSize)
+		}
+		return size
+	case "fat32", "fat16", "vfat":
+		// Two FATs and cluster slack, roughly one sector per 512 bytes
+		size := contentBytes + contentBytes/512 + 1024*1024
+		if fsType == "fat32" && size < fat32MinBytes {
+			size = fat32MinBytes
+		}
+		return size
+	}
+	return contentBytes
+}
+
+// extJournalBytes returns the journal size mke2fs picks for a filesystem of
+// blocks 4KiB blocks.
+func extJournalBytes(blocks uint64) uint64 {
+	const mib = 1024 * 1024
+	switch {
+	case blocks < 32768:
+		return 4 * mib
+	case blocks < 256*1024:
+		return 16 * mib
+	case blocks < 512*1024:
+		return 32 * mib
+	case blocks < 4096*1024:
+		return 64 * mib
+	case blocks < 8192*1024:
+		return 128 * mib
+	case blocks < 16384*1024:
+		return 256 * mib
+	case blocks < 32768*1024:
+		return 512 * mib
+	}
+	return 1024 * mib
+}
@@ -0,0 +1,158 @@
+package imagedisc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func TestEstimateFilesystemBytes(t *testing.T) {
+	const mib = 1024 * 1024
+	tests := []struct {
+		name     string
+		fsType   string
+		content  uint64
+		inodes   uint64
+		expected uint64
+	}{
+		// 100MiB + 5% + 4MiB, the inode tables, then a 4MiB journal
+		{name: "ext4", fsType: "ext4", content: 100 * mib, inodes: 5000, expected: 116080640 + 4*mib},
+		{name: "ext2 without journal", fsType: "ext2", content: 100 * mib, inodes: 5000, expected: 116080640},
+		// Many small files need the space of their inodes
+		{name: "ext4 inode bound", fsType: "ext4", content: mib, inodes: 100000, expected: 1638400000 + 1638400000/extInodeRatio*extInodeSize + 32*mib},
+		{name: "fat32 minimum", fsType: "fat32", content: mib, expected: fat32MinBytes},
+		{name: "vfat", fsType: "vfat", content: 512 * mib, expected: 512*mib + mib + mib},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimateFilesystemBytes(tt.fsType, tt.content, tt.inodes); got != tt.expected {
+				t.Errorf("estimateFilesystemBytes(%s, %d, %d) = %d, want %d", tt.fsType, tt.content, tt.inodes, got, tt.expected)
+			}
+		})
+	}
+
+	if extJournalBytes(1000) != 4*mib || extJournalBytes(300*1024) != 32*mib || extJournalBytes(1<<30) != 1024*mib {
+		t.Error("unexpected journal sizes")
+	}
+}
+
+func autoSizeTestTemplate() *config.ImageTemplate {
+	return &config.ImageTemplate{
+		Image: config.ImageInfo{Name: "test"},
+		Disk: config.DiskConfig{
+			Size:               "auto",
+			PartitionTableType: "gpt",
+			Builder:            config.DiskBuilderLoopless,
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", Name: "esp", Type: "esp", FsType: "fat32", MountPoint: "/boot/efi", Size: "auto"},
+				{ID: "rootfs", FsType: "ext4", MountPoint: "/", Size: "auto+20%", MaxSize: "1GiB"},
+			},
+		},
+	}
+}
+
+func TestDiskAssemblerAutoSize(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	buildDir := filepath.Join(tempDir, "build")
+	installRoot := filepath.Join(tempDir, "root")
+	if err := os.MkdirAll(filepath.Join(installRoot, "boot", "efi"), 0755); err != nil {
+		t.Fatalf("failed to create install root: %v", err)
+	}
+	imagePath := filepath.Join(buildDir, "test.raw")
+
+	assembler, err := NewDiskAssembler(imagePath, autoSizeTestTemplate())
+	if err != nil {
+		t.Fatalf("NewDiskAssembler failed: %v", err)
+	}
+	defer assembler.Cleanup()
+
+	// ESP: 1MiB of content is below the FAT32 minimum of 36MiB. Root: the
+	// 120274944 bytes estimated for 100MiB in 5000 inodes, plus 20%, align
+	// to 138MiB. The disk adds 1MiB on both ends.
+	if err := os.MkdirAll(filepath.Join(buildDir, "partitions"), 0700); err != nil {
+		t.Fatalf("failed to create partition directory: %v", err)
+	}
+	writeTestPartitionImage(t, imagePath, 176*1024*1024-1, "\x00")
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "du -s --block-size=1 .*/partitions/stash/boot$", Output: "1048576\t/stash/boot\n", Error: nil},
+		{Pattern: "du -s --inodes .*/partitions/stash/boot$", Output: "10\t/stash/boot\n", Error: nil},
+		{Pattern: "du -s --block-size=1 .*/root$", Output: "104857600\t/root\n", Error: nil},
+		{Pattern: "du -s --inodes .*/root$", Output: "5000\t/root\n", Error: nil},
+		{Pattern: "truncate -s (37748736 .*p1-boot.img|144703488 .*p2-rootfs.img)$", Output: "", Error: nil},
+		{Pattern: "mkfs -t vfat -F 32 -h 2048 .*p1-boot.img$", Output: "", Error: nil},
+		{Pattern: "find .*/partitions/stash/boot -mindepth 1 -printf '%y %P.n'$", Output: "", Error: nil},
+		{Pattern: "mkfs -t ext4 .* -d .*/root .*p2-rootfs.img$", Output: "", Error: nil},
+		{Pattern: "mkdir -p .*/partitions/stash$", Output: "", Error: nil},
+		{Pattern: "mv .*/root/boot/efi .*/partitions/stash/boot$", Output: "", Error: nil},
+		{Pattern: "mkdir -m 755 .*/root/boot/efi$", Output: "", Error: nil},
+		{Pattern: "touch -r .*/partitions/stash/boot .*/root/boot/efi$", Output: "", Error: nil},
+		{Pattern: "touch -m -d @[0-9]+\\.[0-9]{9} .*/root/boot$", Output: "", Error: nil},
+		{Pattern: "rm -rf .*/root/boot/efi$", Output: "", Error: nil},
+		{Pattern: "mv .*/partitions/stash/boot .*/root/boot/efi$", Output: "", Error: nil},
+		{Pattern: "fallocate -l 176MiB .*test.raw$", Output: "", Error: nil},
+		{Pattern: "rm -rf .*/build/partitions$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	if err := assembler.Assemble(installRoot); err != nil {
+		t.Fatalf("Assemble failed: %v", err)
+	}
+
+	disk, err := os.Open(imagePath)
+	if err != nil {
+		t.Fatalf("failed to open raw image: %v", err)
+	}
+	defer disk.Close()
+	table, err := gpt.Read(disk, sectorSize, sectorSize)
+	if err != nil {
+		t.Fatalf("failed to read partition table: %v", err)
+	}
+	if len(table.Partitions) != 2 {
+		t.Fatalf("expected 2 partitions, got %d", len(table.Partitions))
+	}
+	if esp := table.Partitions[0]; esp.Start != 2048 || esp.End != 75775 {
+		t.Errorf("unexpected ESP entry %+v", esp)
+	}
+	if root := table.Partitions[1]; root.Start != 75776 || root.End != 358399 {
+		t.Errorf("unexpected root entry %+v", root)
+	}
+}
+
+func TestDiskAssemblerAutoSizeMaxSize(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	installRoot := filepath.Join(tempDir, "root")
+	if err := os.MkdirAll(installRoot, 0755); err != nil {
+		t.Fatalf("failed to create install root: %v", err)
+	}
+	template := autoSizeTestTemplate()
+	template.Disk.Partitions = template.Disk.Partitions[1:]
+	template.Disk.Partitions[0].MaxSize = "64MiB"
+	assembler, err := NewDiskAssembler(filepath.Join(tempDir, "build", "test.raw"), template)
+	if err != nil {
+		t.Fatalf("NewDiskAssembler failed: %v", err)
+	}
+	defer assembler.Cleanup()
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "du -s --block-size=1 .*/root$", Output: "104857600\t/root\n", Error: nil},
+		{Pattern: "du -s --inodes .*/root$", Output: "5000\t/root\n", Error: nil},
+		{Pattern: "rm -rf .*/build/partitions$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := assembler.Assemble(installRoot); err == nil || !strings.Contains(err.Error(), "more than its maxSize") {
+		t.Fatalf("expected maxSize error, got %v", err)
+	}
+}
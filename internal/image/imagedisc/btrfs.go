@@ -0,0 +1,122 @@
+package imagedisc
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/mount"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+// mountBtrfsTopLevel mounts the top-level subvolume of diskPartDev on a
+// temporary directory and returns the directory and a cleanup function.
+func mountBtrfsTopLevel(diskPartDev, partID string) (string, func(), error) {
+	mountDir := filepath.Join(config.TempDir(), "btrfs-"+partID)
+	if err := mount.MountPath(diskPartDev, mountDir, "-t btrfs -o subvolid=5"); err != nil {
+		log.Errorf("Failed to mount btrfs partition %s: %v", partID, err)
+		return "", nil, fmt.Errorf("failed to mount btrfs partition %s: %w", partID, err)
+	}
+	cleanup := func() {
+		if err := mount.UmountAndDeletePath(mountDir); err != nil {
+			log.Warnf("Failed to unmount btrfs partition %s: %v", partID, err)
+		}
+	}
+	return mountDir, cleanup, nil
+}
+
+// createBtrfsSubvolumes creates the subvolumes of a freshly formatted btrfs
+// partition. The subvolume mounted at the partition mount point becomes the
+// default subvolume, so the kernel mounts it without rootflags=subvol=.
+func createBtrfsSubvolumes(diskPartDev string, partitionInfo config.PartitionInfo) error {
+	if len(partitionInfo.Subvolumes) == 0 {
+		return nil
+	}
+
+	mountDir, cleanup, err := mountBtrfsTopLevel(diskPartDev, partitionInfo.ID)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	for _, subvol := range partitionInfo.Subvolumes {
+		subvolPath := filepath.Join(mountDir, subvol.Name)
+		cmdStr := fmt.Sprintf("btrfs subvolume create %s", subvolPath)
+		if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil); err != nil {
+			log.Errorf("Failed to create btrfs subvolume %s: %v", subvol.Name, err)
+			return fmt.Errorf("failed to create btrfs subvolume %s: %w", subvol.Name, err)
+		}
+
+		// The compression property is inherited by every file written to the
+		// subvolume, unlike the compress= mount option which is per filesystem
+		if subvol.Compression != "" {
+			cmdStr = fmt.Sprintf("btrfs property set %s compression %s", subvolPath, subvol.Compression)
+			if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil); err != nil {
+				log.Errorf("Failed to set compression on btrfs subvolume %s: %v", subvol.Name, err)
+				return fmt.Errorf("failed to set compression on btrfs subvolume %s: %w", subvol.Name, err)
+			}
+		}
+	}
+
+	if defaultSubvol := partitionInfo.DefaultSubvolume(); defaultSubvol != nil {
+		cmdStr := fmt.Sprintf("btrfs subvolume set-default %s", filepath.Join(mountDir, defaultSubvol.Name))
+		if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil); err != nil {
+			log.Errorf("Failed to set default btrfs subvolume %s: %v", defaultSubvol.Name, err)
+			return fmt.Errorf("failed to set default btrfs subvolume %s: %w", defaultSubvol.Name, err)
+		}
+	}
+	return nil
+}
+
+// SnapshotBtrfsSubvolumes takes the read-only snapshots requested by the
+// btrfs subvolumes of the template, giving the device a rollback target that
+// matches the image as built.
+func SnapshotBtrfsSubvolumes(template *config.ImageTemplate, diskPathIdMap map[string]string) error {
+	for _, partition := range template.GetDiskConfig().Partitions {
+		diskPartDev, ok := diskPathIdMap[partition.ID]
+		if !ok || !hasBtrfsSnapshots(partition) {
+			continue
+		}
+		if err := snapshotPartitionSubvolumes(diskPartDev, partition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasBtrfsSnapshots(partition config.PartitionInfo) bool {
+	for _, subvol := range partition.Subvolumes {
+		if subvol.Snapshot != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func snapshotPartitionSubvolumes(diskPartDev string, partition config.PartitionInfo) error {
+	mountDir, cleanup, err := mountBtrfsTopLevel(diskPartDev, partition.ID)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	for _, subvol := range partition.Subvolumes {
+		if subvol.Snapshot == "" {
+			continue
+		}
+		snapshotPath := filepath.Join(mountDir, subvol.Snapshot)
+		if parent := path.Dir(subvol.Snapshot); parent != "." {
+			if _, err := shell.ExecCmd("mkdir -p "+filepath.Join(mountDir, parent), true, shell.HostPath, nil); err != nil {
+				return fmt.Errorf("failed to create directory for btrfs snapshot %s: %w", subvol.Snapshot, err)
+			}
+		}
+		cmdStr := fmt.Sprintf("btrfs subvolume snapshot -r %s %s", filepath.Join(mountDir, subvol.Name), snapshotPath)
+		if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil); err != nil {
+			log.Errorf("Failed to snapshot btrfs subvolume %s: %v", subvol.Name, err)
+			return fmt.Errorf("failed to snapshot btrfs subvolume %s: %w", subvol.Name, err)
+		}
+		log.Infof("Created read-only snapshot %s of btrfs subvolume %s", subvol.Snapshot, subvol.Name)
+	}
+	return nil
+}
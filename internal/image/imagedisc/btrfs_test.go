@@ -0,0 +1,105 @@
+package imagedisc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func btrfsTestPartition() config.PartitionInfo {
+	return config.PartitionInfo{
+		ID:         "rootfs",
+		FsType:     "btrfs",
+		MountPoint: "/",
+		Subvolumes: []config.BtrfsSubvolume{
+			{Name: "@", MountPoint: "/", Snapshot: "@snapshots/factory"},
+			{Name: "@home", MountPoint: "/home", Compression: "zstd"},
+			{Name: "@snapshots", MountPoint: "/.snapshots"},
+		},
+	}
+}
+
+func TestCreateBtrfsSubvolumes(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "^mount$", Output: "", Error: nil},
+		{Pattern: "mkdir -p .*btrfs-rootfs$", Output: "", Error: nil},
+		{Pattern: "mount -t btrfs -o subvolid=5 /dev/loop0p2 .*btrfs-rootfs$", Output: "", Error: nil},
+		{Pattern: "btrfs subvolume create .*btrfs-rootfs/@$", Output: "", Error: nil},
+		{Pattern: "btrfs subvolume create .*btrfs-rootfs/@home$", Output: "", Error: nil},
+		{Pattern: "btrfs subvolume create .*btrfs-rootfs/@snapshots$", Output: "", Error: nil},
+		{Pattern: "btrfs property set .*btrfs-rootfs/@home compression zstd$", Output: "", Error: nil},
+		{Pattern: "btrfs subvolume set-default .*btrfs-rootfs/@$", Output: "", Error: nil},
+		{Pattern: "rm -rf .*btrfs-rootfs$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	if err := createBtrfsSubvolumes("/dev/loop0p2", btrfsTestPartition()); err != nil {
+		t.Fatalf("createBtrfsSubvolumes failed: %v", err)
+	}
+
+	// No subvolumes: nothing runs
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := createBtrfsSubvolumes("/dev/loop0p2", config.PartitionInfo{ID: "data", FsType: "btrfs"}); err != nil {
+		t.Fatalf("expected no-op, got %v", err)
+	}
+}
+
+func TestCreateBtrfsSubvolumesFailure(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "btrfs subvolume create .*/@home$", Output: "", Error: fmt.Errorf("no space left")},
+		{Pattern: ".*", Output: "", Error: nil},
+	})
+
+	err := createBtrfsSubvolumes("/dev/loop0p2", btrfsTestPartition())
+	if err == nil || !strings.Contains(err.Error(), "failed to create btrfs subvolume @home") {
+		t.Fatalf("expected subvolume creation error, got %v", err)
+	}
+}
+
+func TestSnapshotBtrfsSubvolumes(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	template := &config.ImageTemplate{
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+				btrfsTestPartition(),
+			},
+		},
+	}
+	diskPathIdMap := map[string]string{"boot": "/dev/loop0p1", "rootfs": "/dev/loop0p2"}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "^mount$", Output: "", Error: nil},
+		{Pattern: "mkdir -p .*btrfs-rootfs$", Output: "", Error: nil},
+		{Pattern: "mount -t btrfs -o subvolid=5 /dev/loop0p2 .*btrfs-rootfs$", Output: "", Error: nil},
+		{Pattern: "mkdir -p .*btrfs-rootfs/@snapshots$", Output: "", Error: nil},
+		{Pattern: "btrfs subvolume snapshot -r .*btrfs-rootfs/@ .*btrfs-rootfs/@snapshots/factory$", Output: "", Error: nil},
+		{Pattern: "rm -rf .*btrfs-rootfs$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := SnapshotBtrfsSubvolumes(template, diskPathIdMap); err != nil {
+		t.Fatalf("SnapshotBtrfsSubvolumes failed: %v", err)
+	}
+
+	// Templates without snapshots do not touch the disk
+	template.Disk.Partitions[1].Subvolumes[0].Snapshot = ""
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := SnapshotBtrfsSubvolumes(template, diskPathIdMap); err != nil {
+		t.Fatalf("expected no-op, got %v", err)
+	}
+}
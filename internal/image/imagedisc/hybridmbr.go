@@ -0,0 +1,123 @@
+package imagedisc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+)
+
+const (
+	mbrEntriesOffset   = 446
+	mbrEntrySize       = 16
+	mbrSignatureOffset = 510
+
+	mbrTypeProtective = 0xee
+	mbrTypeESP        = 0xef
+	mbrTypeFAT32LBA   = 0x0c
+	mbrTypeLinuxSwap  = 0x82
+	mbrTypeLinux      = 0x83
+	mbrStatusActive   = 0x80
+)
+
+// WriteHybridMBR replaces the protective MBR of the raw image at imagePath
+// with a hybrid MBR listing the partitions of disk.HybridMBR, so BIOS
+// firmware and legacy tools see them next to the GPT. The 0xEE entry comes
+// first and covers the GPT up to the first listed partition. Partitions with
+// the legacy BIOS bootable attribute are marked active. The boot code in the
+// first 446 bytes is kept.
+func WriteHybridMBR(imagePath string, disk config.DiskConfig) error {
+	if len(disk.HybridMBR) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(imagePath, os.O_RDWR, 0)
+	if err != nil {
+		log.Errorf("Failed to open raw image %s: %v", imagePath, err)
+		return fmt.Errorf("failed to open raw image %s: %w", imagePath, err)
+	}
+	defer file.Close()
+
+	table, err := gpt.Read(file, sectorSize, sectorSize)
+	if err != nil {
+		log.Errorf("Failed to read GPT of %s: %v", imagePath, err)
+		return fmt.Errorf("failed to read GPT of %s: %w", imagePath, err)
+	}
+	entries, err := hybridMBREntries(table, disk)
+	if err != nil {
+		log.Errorf("Failed to lay out hybrid MBR of %s: %v", imagePath, err)
+		return err
+	}
+	if _, err := file.WriteAt(entries, mbrEntriesOffset); err != nil {
+		log.Errorf("Failed to write hybrid MBR to %s: %v", imagePath, err)
+		return fmt.Errorf("failed to write hybrid MBR to %s: %w", imagePath, err)
+	}
+	if _, err := file.WriteAt([]byte{0x55, 0xaa}, mbrSignatureOffset); err != nil {
+		return fmt.Errorf("failed to write MBR signature to %s: %w", imagePath, err)
+	}
+	log.Infof("Wrote hybrid MBR with partitions %v to %s", disk.HybridMBR, imagePath)
+	return file.Sync()
+}
+
+// hybridMBREntries returns the four MBR partition entries for the
+// partitions of disk.HybridMBR in table. The GPT holds the partitions of
+// disk in the order of the template.
+func hybridMBREntries(table *gpt.Table, disk config.DiskConfig) ([]byte, error) {
+	gptPartitions := make(map[string]*gpt.Partition)
+	templatePartitions := make(map[string]config.PartitionInfo)
+	for i, partition := range disk.Partitions {
+		if i < len(table.Partitions) {
+			gptPartitions[partition.ID] = table.Partitions[i]
+			templatePartitions[partition.ID] = partition
+		}
+	}
+
+	entries := make([]byte, 4*mbrEntrySize)
+	firstStart := uint64(math.MaxUint32)
+	for i, id := range disk.HybridMBR {
+		part, ok := gptPartitions[id]
+		if !ok || part.Start == 0 {
+			return nil, fmt.Errorf("hybrid MBR partition '%s' not found in the GPT", id)
+		}
+		if part.End >= math.MaxUint32 {
+			return nil, fmt.Errorf("hybrid MBR partition '%s' ends beyond the 2TiB MBR limit", id)
+		}
+		var status byte
+		if part.Attributes&(1<<config.GPTAttrLegacyBIOSBootable) != 0 {
+			status = mbrStatusActive
+		}
+		putMBREntry(entries[(i+1)*mbrEntrySize:], status, mbrPartitionType(templatePartitions[id]),
+			uint32(part.Start), uint32(part.End-part.Start+1))
+		firstStart = min(firstStart, part.Start)
+	}
+	putMBREntry(entries, 0, mbrTypeProtective, 1, uint32(firstStart-1))
+	return entries, nil
+}
+
+// mbrPartitionType returns the MBR type of a hybrid MBR partition
+func mbrPartitionType(partition config.PartitionInfo) byte {
+	switch {
+	case strings.EqualFold(gptTypeGUID(partition), partitionTypeNameToGUID["esp"]):
+		return mbrTypeESP
+	case partition.FsType == "fat32" || partition.FsType == "fat16" || partition.FsType == "vfat":
+		return mbrTypeFAT32LBA
+	case partition.FsType == "linux-swap":
+		return mbrTypeLinuxSwap
+	}
+	return mbrTypeLinux
+}
+
+// putMBREntry writes an MBR partition entry addressed by LBA only, its CHS
+// fields are set to the maximum as for partitions beyond 8GiB.
+func putMBREntry(b []byte, status, partType byte, start, sectors uint32) {
+	chs := []byte{0xfe, 0xff, 0xff}
+	b[0] = status
+	copy(b[1:4], chs)
+	b[4] = partType
+	copy(b[5:8], chs)
+	binary.LittleEndian.PutUint32(b[8:12], start)
+	binary.LittleEndian.PutUint32(b[12:16], sectors)
+}
@@ -0,0 +1,125 @@
+package imagedisc
+
+import (
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+)
+
+func TestWriteHybridMBR(t *testing.T) {
+	path, disk := createTestDisk(t, 64*1024*1024)
+	table := &gpt.Table{
+		LogicalSectorSize:  sectorSize,
+		PhysicalSectorSize: sectorSize,
+		ProtectiveMBR:      true,
+		GUID:               "5c3d4d4e-7d8a-4b8e-9c1f-2a6b3c4d5e6f",
+		Partitions: []*gpt.Partition{
+			{Start: 2048, End: 4095, Size: 2048 * sectorSize, Type: gpt.BIOSBoot, Name: "bios"},
+			{Start: 4096, End: 8191, Size: 4096 * sectorSize, Type: gpt.EFISystemPartition, Name: "esp",
+				Attributes: 1 << config.GPTAttrLegacyBIOSBootable},
+			{Start: 8192, End: 18431, Size: 10240 * sectorSize, Type: gpt.LinuxFilesystem, Name: "rootfs"},
+		},
+	}
+	if err := table.Write(disk, 64*1024*1024); err != nil {
+		t.Fatalf("failed to write partition table: %v", err)
+	}
+	// Boot code the hybrid MBR must keep
+	if _, err := disk.WriteAt([]byte("BOOTCODE"), 0); err != nil {
+		t.Fatalf("failed to write boot code: %v", err)
+	}
+	disk.Close()
+
+	diskConfig := config.DiskConfig{
+		Partitions: []config.PartitionInfo{
+			{ID: "bios", Type: "bios-grub"},
+			{ID: "esp", Type: "esp", FsType: "fat32"},
+			{ID: "rootfs", FsType: "ext4"},
+		},
+		HybridMBR: []string{"rootfs", "esp"},
+	}
+	if err := WriteHybridMBR(path, diskConfig); err != nil {
+		t.Fatalf("WriteHybridMBR failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read disk: %v", err)
+	}
+	if string(data[:8]) != "BOOTCODE" || data[510] != 0x55 || data[511] != 0xaa {
+		t.Fatalf("boot code or signature lost")
+	}
+	want := []struct {
+		status, partType byte
+		start, sectors   uint32
+	}{
+		{0, mbrTypeProtective, 1, 4095},
+		{0, mbrTypeLinux, 8192, 10240},
+		{mbrStatusActive, mbrTypeESP, 4096, 4096},
+		{0, 0, 0, 0},
+	}
+	for i, w := range want {
+		e := data[mbrEntriesOffset+i*mbrEntrySize:]
+		if e[0] != w.status || e[4] != w.partType ||
+			binary.LittleEndian.Uint32(e[8:12]) != w.start || binary.LittleEndian.Uint32(e[12:16]) != w.sectors {
+			t.Errorf("unexpected MBR entry %d: % x", i, e[:mbrEntrySize])
+		}
+	}
+
+	// The GPT is still read, the MBR is no longer a plain protective one
+	disk, err = os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open disk: %v", err)
+	}
+	defer disk.Close()
+	hybrid, err := gpt.Read(disk, sectorSize, sectorSize)
+	if err != nil {
+		t.Fatalf("failed to read GPT: %v", err)
+	}
+	if hybrid.ProtectiveMBR || !strings.EqualFold(hybrid.GUID, table.GUID) {
+		t.Errorf("unexpected partition table %+v", hybrid)
+	}
+
+	// Templates without a hybrid MBR leave the image alone
+	if err := WriteHybridMBR("/nonexistent.raw", config.DiskConfig{}); err != nil {
+		t.Errorf("expected no-op without hybridMBR, got %v", err)
+	}
+}
+
+func TestGPTPartitionAttributes(t *testing.T) {
+	partition := config.PartitionInfo{
+		ID:         "kernel-a",
+		Flags:      []string{PartitionFlagBoot},
+		Attributes: []string{"required", "no-automount"},
+		Priority:   2,
+		Tries:      1,
+	}
+	attrs, err := gptPartitionAttributes(partition)
+	if err != nil {
+		t.Fatalf("gptPartitionAttributes failed: %v", err)
+	}
+	if want := uint64(1<<0 | 1<<2 | 2<<48 | 1<<52 | 1<<63); attrs != want {
+		t.Fatalf("expected attributes %#x, got %#x", want, attrs)
+	}
+	if got := sfdiskAttrs(attrs); got != "RequiredPartition,LegacyBIOSBootable,GUID:49,GUID:52,GUID:63" {
+		t.Errorf("unexpected sfdisk attributes %q", got)
+	}
+
+	if _, err := gptPartitionAttributes(config.PartitionInfo{ID: "bad", Attributes: []string{"10"}}); err == nil {
+		t.Error("expected an error for a reserved attribute bit")
+	}
+
+	identity := &DiskIdentity{TemplateHash: "hash"}
+	if got := partitionGUID(config.PartitionInfo{ID: "rootfs", PartUUID: "4F68BCE3-0000-4000-8000-000000000001"}, identity); got != "4f68bce3-0000-4000-8000-000000000001" {
+		t.Errorf("expected the template partition GUID, got %q", got)
+	}
+	if got := partitionGUID(config.PartitionInfo{ID: "rootfs"}, identity); got != identity.PartitionUUID("rootfs") {
+		t.Errorf("expected the pinned partition GUID, got %q", got)
+	}
+	if got := partitionGUID(config.PartitionInfo{ID: "rootfs"}, nil); got != "" {
+		t.Errorf("expected no partition GUID, got %q", got)
+	}
+}
@@ -0,0 +1,232 @@
+package imagedisc
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+// DiskIdentity pins every identifier and timestamp that partitioning and
+// mkfs would otherwise pick at random, so reproducible builds of the same
+// template produce byte-identical disks.
+type DiskIdentity struct {
+	TemplateHash    string
+	SourceDateEpoch time.Time
+}
+
+// NewDiskIdentity returns the disk identity for a reproducible template, or
+// nil when the template does not request reproducible builds.
+func NewDiskIdentity(template *config.ImageTemplate) (*DiskIdentity, error) {
+	if !template.IsReproducible() {
+		return nil, nil
+	}
+	hash, err := template.GetTemplateHash()
+	if err != nil {
+		return nil, err
+	}
+	epoch, err := config.GetSourceDateEpoch()
+	if err != nil {
+		return nil, err
+	}
+	return &DiskIdentity{TemplateHash: hash, SourceDateEpoch: epoch}, nil
+}
+
+func (id *DiskIdentity) uuid(purpose string) string {
+	return config.DeriveUUID(id.TemplateHash, purpose).String()
+}
+
+// DiskGUID returns the GPT disk GUID.
+func (id *DiskIdentity) DiskGUID() string {
+	return id.uuid("disk")
+}
+
+// MBRDiskID returns the 32-bit MBR disk signature in sfdisk notation.
+func (id *DiskIdentity) MBRDiskID() string {
+	return "0x" + strings.ReplaceAll(id.uuid("disk"), "-", "")[:8]
+}
+
+// PartitionUUID returns the GPT unique partition GUID for partition partID.
+func (id *DiskIdentity) PartitionUUID(partID string) string {
+	return id.uuid("partition/" + partID)
+}
+
+// FilesystemUUID returns the filesystem UUID for partition partID.
+func (id *DiskIdentity) FilesystemUUID(partID string) string {
+	return id.uuid("filesystem/" + partID)
+}
+
+// VolumeID returns the 32-bit FAT volume serial for partition partID.
+func (id *DiskIdentity) VolumeID(partID string) string {
+	return strings.ReplaceAll(id.FilesystemUUID(partID), "-", "")[:8]
+}
+
+// HashSeed returns the ext directory hash seed for partition partID.
+func (id *DiskIdentity) HashSeed(partID string) string {
+	return id.uuid("hash-seed/" + partID)
+}
+
+// MkfsEnv returns the environment that makes mkfs tools use the pinned
+// timestamp instead of the current time.
+func (id *DiskIdentity) MkfsEnv() []string {
+	epoch := fmt.Sprintf("%d", id.SourceDateEpoch.Unix())
+	return []string{
+		config.SourceDateEpochEnv + "=" + epoch,
+		"E2FSPROGS_FAKE_TIME=" + epoch,
+	}
+}
+
+// mkfsFlags returns the extra mkfs flags that pin the identifiers of
+// partition partID formatted as fsType.
+func (id *DiskIdentity) mkfsFlags(partID, fsType string) string {
+	switch fsType {
+	case "fat32", "fat16", "vfat":
+		return fmt.Sprintf("-i %s", id.VolumeID(partID))
+	case "ext2", "ext3", "ext4":
+		return fmt.Sprintf("-U %s -E hash_seed=%s", id.FilesystemUUID(partID), id.HashSeed(partID))
+	case "xfs":
+		return fmt.Sprintf("-m uuid=%s", id.FilesystemUUID(partID))
+	case "btrfs", "linux-swap":
+		return fmt.Sprintf("-U %s", id.FilesystemUUID(partID))
+	}
+	return ""
+}
+
+// setDiskID stamps the partition table of diskPath with the pinned disk
+// identifier.
+func (id *DiskIdentity) setDiskID(diskPath, partitionTableType string) error {
+	diskID := id.DiskGUID()
+	if partitionTableType == PartitionTableTypeMbr {
+		diskID = id.MBRDiskID()
+	}
+	return SetDiskID(diskPath, diskID)
+}
+
+// SetDiskID stamps the partition table of diskPath with diskID: a GUID for
+// GPT, a 32-bit signature such as 0x1234abcd for MBR.
+func SetDiskID(diskPath, diskID string) error {
+	cmdStr := fmt.Sprintf("sfdisk --disk-id %s %s", diskPath, diskID)
+	if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to set disk identifier on %s: %v", diskPath, err)
+		return fmt.Errorf("failed to set disk identifier on %s: %w", diskPath, err)
+	}
+	return nil
+}
+
+// NormalizeFilesystems resets the state the kernel records while the image
+// partitions are mounted during the build (journal contents, mount and write
+// times, mount count, last mount point). It must run after the partitions are
+// unmounted and is a no-op unless the template requests reproducible builds.
+func NormalizeFilesystems(template *config.ImageTemplate, diskPathIdMap map[string]string) error {
+	identity, err := NewDiskIdentity(template)
+	if err != nil || identity == nil {
+		return err
+	}
+
+	for _, partition := range template.GetDiskConfig().Partitions {
+		diskPartDev, ok := diskPathIdMap[partition.ID]
+		if !ok {
+			continue
+		}
+		switch partition.FsType {
+		case "ext3", "ext4":
+			if err := identity.resetJournal(diskPartDev); err != nil {
+				return err
+			}
+			fallthrough
+		case "ext2":
+			if err := identity.resetExtSuperblock(diskPartDev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resetJournal replaces the journal of diskPartDev with a freshly created,
+// empty one.
+func (id *DiskIdentity) resetJournal(diskPartDev string) error {
+	for _, feature := range []string{"^has_journal", "has_journal"} {
+		cmdStr := fmt.Sprintf("tune2fs -O %s %s", feature, diskPartDev)
+		if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, id.MkfsEnv()); err != nil {
+			log.Errorf("Failed to reset journal on %s: %v", diskPartDev, err)
+			return fmt.Errorf("failed to reset journal on %s: %w", diskPartDev, err)
+		}
+	}
+	return nil
+}
+
+// resetExtSuperblock pins the superblock fields the kernel updates on mount.
+func (id *DiskIdentity) resetExtSuperblock(diskPartDev string) error {
+	epoch := id.SourceDateEpoch.Unix()
+	requests := []string{
+		fmt.Sprintf("ssv mtime @%d", epoch),
+		fmt.Sprintf("ssv wtime @%d", epoch),
+		fmt.Sprintf("ssv lastcheck @%d", epoch),
+		"ssv mnt_count 0",
+		"ssv last_mounted /",
+	}
+
+	if err := runDebugfs(requests, diskPartDev, nil); err != nil {
+		log.Errorf("Failed to reset superblock timestamps on %s: %v", diskPartDev, err)
+		return fmt.Errorf("failed to reset superblock timestamps on %s: %w", diskPartDev, err)
+	}
+	return nil
+}
+
+// resetInodeTimes sets the access and change times of every file of the ext
+// image imagePath, built with mkfs -d from dir, to the pinned timestamp.
+// mkfs -d copies them from dir, where they record when the build ran; the
+// modification times are already clamped and the creation times come from
+// E2FSPROGS_FAKE_TIME.
+func (id *DiskIdentity) resetInodeTimes(imagePath, dir string) error {
+	output, err := shell.ExecCmd(fmt.Sprintf("find %s -mindepth 1 -printf '%%P\\n'", dir), true, shell.HostPath, nil)
+	if err != nil {
+		log.Errorf("Failed to list %s: %v", dir, err)
+		return fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	paths := []string{""}
+	for _, path := range strings.Split(output, "\n") {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	epoch := id.SourceDateEpoch.Unix()
+	var requests []string
+	for _, path := range paths {
+		// debugfs reads "" as a literal quote inside a quoted argument
+		quoted := `"/` + strings.ReplaceAll(path, `"`, `""`) + `"`
+		requests = append(requests,
+			fmt.Sprintf("sif %s atime @%d", quoted, epoch),
+			fmt.Sprintf("sif %s ctime @%d", quoted, epoch))
+	}
+	if err := runDebugfs(requests, imagePath, id.MkfsEnv()); err != nil {
+		log.Errorf("Failed to reset file timestamps on %s: %v", imagePath, err)
+		return fmt.Errorf("failed to reset file timestamps on %s: %w", imagePath, err)
+	}
+	return nil
+}
+
+// runDebugfs runs requests against the ext filesystem on device in a single
+// debugfs session.
+func runDebugfs(requests []string, device string, env []string) error {
+	cmdFile, err := os.CreateTemp(config.TempDir(), "debugfs-*.cmd")
+	if err != nil {
+		return fmt.Errorf("failed to create debugfs command file: %w", err)
+	}
+	defer os.Remove(cmdFile.Name())
+	if _, err := cmdFile.WriteString(strings.Join(requests, "\n") + "\n"); err != nil {
+		cmdFile.Close()
+		return fmt.Errorf("failed to write debugfs command file: %w", err)
+	}
+	if err := cmdFile.Close(); err != nil {
+		return fmt.Errorf("failed to write debugfs command file: %w", err)
+	}
+
+	_, err = shell.ExecCmd(fmt.Sprintf("debugfs -w -f %s %s", cmdFile.Name(), device), true, shell.HostPath, env)
+	return err
+}
@@ -0,0 +1,149 @@
+package imagedisc
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func reproducibleTemplate() *config.ImageTemplate {
+	return &config.ImageTemplate{
+		Image:  config.ImageInfo{Name: "demo", Version: "1.0", Reproducible: true},
+		Target: config.TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64", ImageType: "raw"},
+	}
+}
+
+func TestNewDiskIdentity(t *testing.T) {
+	identity, err := NewDiskIdentity(&config.ImageTemplate{})
+	if err != nil || identity != nil {
+		t.Fatalf("expected nil identity for non-reproducible template, got %+v (err %v)", identity, err)
+	}
+
+	t.Setenv(config.SourceDateEpochEnv, "1700000000")
+	identity, err = NewDiskIdentity(reproducibleTemplate())
+	if err != nil || identity == nil {
+		t.Fatalf("NewDiskIdentity failed: %v", err)
+	}
+	again, _ := NewDiskIdentity(reproducibleTemplate())
+	if identity.DiskGUID() != again.DiskGUID() || identity.PartitionUUID("rootfs") != again.PartitionUUID("rootfs") {
+		t.Error("expected identical identifiers for identical templates")
+	}
+	if identity.PartitionUUID("rootfs") == identity.FilesystemUUID("rootfs") {
+		t.Error("expected partition and filesystem UUIDs to differ")
+	}
+	if !regexp.MustCompile(`^0x[0-9a-f]{8}$`).MatchString(identity.MBRDiskID()) {
+		t.Errorf("unexpected MBR disk id %q", identity.MBRDiskID())
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}$`).MatchString(identity.VolumeID("boot")) {
+		t.Errorf("unexpected FAT volume id %q", identity.VolumeID("boot"))
+	}
+	env := identity.MkfsEnv()
+	if len(env) != 2 || env[0] != "SOURCE_DATE_EPOCH=1700000000" || env[1] != "E2FSPROGS_FAKE_TIME=1700000000" {
+		t.Errorf("unexpected mkfs environment %v", env)
+	}
+}
+
+func TestDiskPartitionsCreateWithIdentity(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	t.Setenv(config.SourceDateEpochEnv, "1700000000")
+	identity, err := NewDiskIdentity(reproducibleTemplate())
+	if err != nil {
+		t.Fatalf("NewDiskIdentity failed: %v", err)
+	}
+
+	partitions := []config.PartitionInfo{
+		{ID: "boot", Name: "boot", Start: "1MiB", End: "100MiB", FsType: "fat32", Type: "esp"},
+		{ID: "rootfs", Name: "rootfs", Start: "100MiB", End: "0", FsType: "ext4", Type: "linux"},
+	}
+	rootUUID := identity.FilesystemUUID("rootfs")
+
+	// Only commands carrying the pinned identifiers succeed
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "fdisk -l /dev/sda", Output: "Disk /dev/sda: 1 GiB", Error: nil},
+		{Pattern: "echo 'label: gpt'", Output: "", Error: nil},
+		{Pattern: "sfdisk --disk-id /dev/sda " + identity.DiskGUID(), Output: "", Error: nil},
+		{Pattern: "cat /sys/block/sda/queue/hw_sector_size", Output: "512", Error: nil},
+		{Pattern: "cat /sys/block/sda/queue/physical_block_size", Output: "4096", Error: nil},
+		{Pattern: "echo .*uuid=" + identity.PartitionUUID("boot"), Output: "", Error: nil},
+		{Pattern: "echo .*uuid=" + identity.PartitionUUID("rootfs"), Output: "", Error: nil},
+		{Pattern: "partx -u /dev/sda", Output: "", Error: nil},
+		{Pattern: "SOURCE_DATE_EPOCH=1700000000 E2FSPROGS_FAKE_TIME=1700000000 mkfs -t vfat -F 32 --invariant -i " + identity.VolumeID("boot"), Output: "", Error: nil},
+		{Pattern: "E2FSPROGS_FAKE_TIME=1700000000 mkfs -t ext4 .* -U " + rootUUID + " -E hash_seed=" + identity.HashSeed("rootfs") + " /dev/sda2", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	result, err := DiskPartitionsCreateWithIdentity("/dev/sda", partitions, "gpt", identity)
+	if err != nil {
+		t.Fatalf("DiskPartitionsCreateWithIdentity failed: %v", err)
+	}
+	if result["rootfs"] != "/dev/sda2" {
+		t.Errorf("unexpected partition map %v", result)
+	}
+}
+
+func TestNormalizeFilesystems(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	// Not reproducible: nothing runs
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := NormalizeFilesystems(&config.ImageTemplate{}, map[string]string{"rootfs": "/dev/loop0p2"}); err != nil {
+		t.Fatalf("expected no-op, got %v", err)
+	}
+
+	t.Setenv(config.SourceDateEpochEnv, "1700000000")
+	template := reproducibleTemplate()
+	template.Disk.Partitions = []config.PartitionInfo{
+		{ID: "boot", FsType: "fat32"},
+		{ID: "rootfs", FsType: "ext4"},
+	}
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "E2FSPROGS_FAKE_TIME=1700000000 tune2fs -O \\^has_journal /dev/loop0p2", Output: "", Error: nil},
+		{Pattern: "E2FSPROGS_FAKE_TIME=1700000000 tune2fs -O has_journal /dev/loop0p2", Output: "", Error: nil},
+		{Pattern: "debugfs -w -f .* /dev/loop0p2", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	diskPathIdMap := map[string]string{"boot": "/dev/loop0p1", "rootfs": "/dev/loop0p2"}
+	if err := NormalizeFilesystems(template, diskPathIdMap); err != nil {
+		t.Fatalf("NormalizeFilesystems failed: %v", err)
+	}
+}
+
+func TestResetInodeTimes(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = t.TempDir()
+	config.SetGlobal(newGlobal)
+
+	t.Setenv(config.SourceDateEpochEnv, "1700000000")
+	identity, err := NewDiskIdentity(reproducibleTemplate())
+	if err != nil {
+		t.Fatalf("NewDiskIdentity failed: %v", err)
+	}
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "find /root -mindepth 1 -printf '%P.n'$", Output: "etc\netc/hostname\n", Error: nil},
+		{Pattern: "E2FSPROGS_FAKE_TIME=1700000000 .*debugfs -w -f .*debugfs-.*\\.cmd rootfs.img$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := identity.resetInodeTimes("rootfs.img", "/root"); err != nil {
+		t.Fatalf("resetInodeTimes failed: %v", err)
+	}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "find /root", Output: "", Error: nil},
+		{Pattern: "debugfs", Output: "", Error: fmt.Errorf("bad inode")},
+	})
+	if err := identity.resetInodeTimes("rootfs.img", "/root"); err == nil {
+		t.Fatal("expected error when debugfs fails")
+	}
+}
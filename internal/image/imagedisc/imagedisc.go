@@ -368,6 +368,8 @@ func TranslateSectorToBytes(diskName string, sectorOffset int) (int, error) {
 	return sectorOffset * hwSectorSize, nil
 }
 
+// GetAlignedSectorOffset rounds sectorOffset up to the partition alignment of
+// the disk: 1MiB, or the physical block size if larger.
 func GetAlignedSectorOffset(diskName string, sectorOffset int) (int, error) {
 	hwSectorSize, err := DiskGetHwSectorSize(diskName)
 	if err != nil {
@@ -377,14 +379,18 @@ func GetAlignedSectorOffset(diskName string, sectorOffset int) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	if physicalBlockSize == hwSectorSize {
-		return sectorOffset, nil
+	if hwSectorSize <= 0 {
+		return 0, fmt.Errorf("invalid sector size %d for disk %s", hwSectorSize, diskName)
+	}
+	alignment := partitionAlignment
+	if physicalBlockSize > alignment {
+		alignment = physicalBlockSize
 	}
-	physicalBlockSectorNum := physicalBlockSize / hwSectorSize
-	if sectorOffset%physicalBlockSectorNum == 0 {
+	alignmentSectorNum := alignment / hwSectorSize
+	if sectorOffset%alignmentSectorNum == 0 {
 		return sectorOffset, nil
 	}
-	return ((sectorOffset / physicalBlockSectorNum) + 1) * physicalBlockSectorNum, nil
+	return ((sectorOffset / alignmentSectorNum) + 1) * alignmentSectorNum, nil
 }
 
 func getSectorOffsetFromSize(diskName, sizeStr string) (uint64, error) {
@@ -420,6 +426,34 @@ func PartitionTypeStrToGUID(partitionTypeStr string) (string, error) {
 	return "", fmt.Errorf("partition type not found: %s", partitionTypeStr)
 }
 
+// gptTypeGUID returns the GPT partition type GUID of partitionInfo, or an
+// empty string to let sfdisk default to a Linux filesystem partition.
+func gptTypeGUID(partitionInfo config.PartitionInfo) string {
+	typeGUID := partitionInfo.TypeGUID
+	if typeGUID == "" && partitionInfo.Type != "" {
+		typeGUID, _ = PartitionTypeStrToGUID(partitionInfo.Type)
+	}
+	if typeGUID == "" && partitionInfo.FsType == "lvm" {
+		typeGUID = partitionTypeNameToGUID["linux-lvm"]
+	}
+	if typeGUID == "" && partitionInfo.FsType == "raid" {
+		typeGUID = partitionTypeNameToGUID["linux-raid"]
+	}
+	if typeGUID == "" && partitionInfo.Encryption != nil {
+		typeGUID = partitionTypeNameToGUID["linux-luks"]
+	}
+	return typeGUID
+}
+
+// PartitionTypeGUID returns the GPT partition type GUID partitionInfo is
+// created with.
+func PartitionTypeGUID(partitionInfo config.PartitionInfo) string {
+	if typeGUID := gptTypeGUID(partitionInfo); typeGUID != "" {
+		return typeGUID
+	}
+	return partitionTypeNameToGUID["linux"]
+}
+
 func PartitionGUIDToTypeStr(partitionGUID string) (string, error) {
 	for k, v := range partitionTypeNameToGUID {
 		if v == partitionGUID {
@@ -434,10 +468,12 @@ func diskPartitionCreate(
 	partitionNum int,
 	partitionInfo config.PartitionInfo,
 	partitionTableType string,
-	partitionType string) (string, error) {
+	partitionType string,
+	identity *DiskIdentity) (string, error) {
 
 	partitionTypeList := []string{"primary", "extended", "logical"}
-	fsTypeList := []string{"fat32", "fat16", "vfat", "ext2", "ext3", "ext4", "xfs", "linux-swap"}
+	// Partitions without fsType, such as update slots, are left raw
+	fsTypeList := []string{"", "fat32", "fat16", "vfat", "ext2", "ext3", "ext4", "xfs", "btrfs", "linux-swap", "lvm", "raid", "squashfs", "erofs"}
 
 	// Partition info
 	partitionName := partitionInfo.Name
@@ -482,6 +518,8 @@ func diskPartitionCreate(
 		log.Errorf("Failed to get disk name from path %s: %v", diskPath, err)
 		return "", fmt.Errorf("failed to get disk name from path: %s", diskPath)
 	}
+	// ResolvePartitionLayout aligned the start, after the extended boot
+	// record for logical partitions
 	startSector, _ := getSectorOffsetFromSize(diskName, startSizeStr)
 	var endSector uint64
 	if partitionInfo.End == "0" {
@@ -491,14 +529,6 @@ func diskPartitionCreate(
 		endSector--
 	}
 
-	if partitionType == "logical" {
-		// extended partition takes one sector, the following logical partitions will be aligned to the next sector
-		startSector++
-		if endSector != 0 {
-			endSector++
-		}
-	}
-
 	startSectorStr := fmt.Sprintf("%ds", startSector)
 	endSectorStr := fmt.Sprintf("%ds", endSector)
 	log.Infof("Input partition start: " + startSizeStr + ", aligned start sector: " + startSectorStr)
@@ -515,17 +545,24 @@ func diskPartitionCreate(
 	// Set partition type
 	if partitionTableType == "gpt" {
 		// For GPT, use GUID
-		typeGUID := partitionInfo.TypeGUID
-		if typeGUID == "" && partitionInfo.Type != "" {
-			typeGUID, _ = PartitionTypeStrToGUID(partitionInfo.Type)
-		}
-		if typeGUID != "" {
+		if typeGUID := gptTypeGUID(partitionInfo); typeGUID != "" {
 			sfdiskScript.WriteString(fmt.Sprintf("type=%s ", typeGUID))
 		}
 		// Set partition name if provided
 		if partitionName != "" {
 			sfdiskScript.WriteString(fmt.Sprintf("name=\"%s\" ", partitionName))
 		}
+		if partUUID := partitionGUID(partitionInfo, identity); partUUID != "" {
+			sfdiskScript.WriteString(fmt.Sprintf("uuid=%s ", partUUID))
+		}
+		attrs, err := gptPartitionAttributes(partitionInfo)
+		if err != nil {
+			log.Errorf("Invalid attributes for partition %d: %v", partitionNum, err)
+			return "", err
+		}
+		if attrs != 0 {
+			sfdiskScript.WriteString(fmt.Sprintf("attrs=\"%s\" ", sfdiskAttrs(attrs)))
+		}
 	} else {
 		// For MBR, use hex type code
 		var typeCode string
@@ -534,18 +571,19 @@ func diskPartitionCreate(
 			typeCode = "5"
 		case partitionInfo.FsType == "linux-swap":
 			typeCode = "82"
+		case partitionInfo.FsType == "lvm":
+			typeCode = "8e" // Linux LVM
+		case partitionInfo.FsType == "raid":
+			typeCode = "fd" // Linux RAID autodetect
 		default:
 			typeCode = "83" // Linux
 		}
 		sfdiskScript.WriteString(fmt.Sprintf("type=%s ", typeCode))
 	}
 
-	// Handle boot flag
-	for _, flag := range partitionInfo.Flags {
-		if flag == "boot" {
-			sfdiskScript.WriteString("bootable ")
-			break
-		}
+	// Handle boot flag, GPT has it in the attributes
+	if partitionTableType != "gpt" && slice.Contains(partitionInfo.Flags, PartitionFlagBoot) {
+		sfdiskScript.WriteString("bootable ")
 	}
 
 	// Create the partition using sfdisk
@@ -573,7 +611,108 @@ func diskPartitionCreate(
 		diskPartDev = fmt.Sprintf("%s%d", diskPath, partitionNum)
 	}
 
+	// Encrypted partitions are formatted, and later mounted, through the
+	// opened LUKS container
+	if partitionInfo.Encryption != nil && partitionType != "extended" {
+		diskPartDev, err = openEncryptedPartition(diskPartDev, partitionInfo, identity)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := formatVolume(diskPartDev, partitionInfo, identity); err != nil {
+		return "", err
+	}
+
+	return diskPartDev, nil
+}
+
+// partitionGUID returns the GPT unique partition GUID of partitionInfo: the
+// one of the template, the pinned one of a reproducible build or, when empty,
+// a random one picked by the partitioning tool.
+func partitionGUID(partitionInfo config.PartitionInfo, identity *DiskIdentity) string {
+	if partitionInfo.PartUUID != "" {
+		return strings.ToLower(partitionInfo.PartUUID)
+	}
+	if identity != nil {
+		return identity.PartitionUUID(partitionInfo.ID)
+	}
+	return ""
+}
+
+// gptPartitionAttributes returns the GPT attribute field of partitionInfo.
+// The boot flag sets the legacy BIOS bootable bit.
+func gptPartitionAttributes(partitionInfo config.PartitionInfo) (uint64, error) {
+	attrs, err := partitionInfo.GPTAttributes()
+	if err != nil {
+		return 0, err
+	}
+	if slice.Contains(partitionInfo.Flags, PartitionFlagBoot) {
+		attrs |= 1 << config.GPTAttrLegacyBIOSBootable
+	}
+	return attrs, nil
+}
+
+// sfdiskAttrNames are the sfdisk names of the GPT attribute bits 0-2, the
+// other bits are set as GUID:<bit>
+var sfdiskAttrNames = map[int]string{
+	config.GPTAttrRequired:           "RequiredPartition",
+	config.GPTAttrNoBlockIO:          "NoBlockIOProtocol",
+	config.GPTAttrLegacyBIOSBootable: "LegacyBIOSBootable",
+}
+
+// sfdiskAttrs returns the GPT attribute field attrs in sfdisk script
+// notation.
+func sfdiskAttrs(attrs uint64) string {
+	var names []string
+	for bit := 0; bit < 64; bit++ {
+		if attrs&(1<<bit) == 0 {
+			continue
+		}
+		if name, ok := sfdiskAttrNames[bit]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("GUID:%d", bit))
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// extFeatureFlags returns the mkfs block size and feature flags of the ext
+// filesystem fsType, or an empty string for other filesystems.
+func extFeatureFlags(fsType string) string {
+	switch fsType {
+	case "ext2":
+		return "-b 4096 -O none,sparse_super,large_file,filetype,resize_inode,dir_index,ext_attr"
+	case "ext3":
+		return "-b 4096 -O none,sparse_super,large_file,filetype,resize_inode,dir_index,ext_attr,has_journal"
+	case "ext4":
+		return "-b 4096 -O none,sparse_super,large_file,filetype,resize_inode,dir_index,ext_attr,has_journal,extent,huge_file,flex_bg,metadata_csum,64bit,dir_nlink,extra_isize"
+	}
+	return ""
+}
+
+// formatVolume creates the filesystem (or swap area) described by
+// partitionInfo on diskPartDev, which is a partition or a logical volume.
+// LVM physical volumes and RAID members are left alone; DiskVolumeGroupsCreate
+// and DiskRaidArraysCreate initialize them. Read-only filesystems are written
+// by BuildReadOnlyFilesystem once the OS is installed.
+func formatVolume(diskPartDev string, partitionInfo config.PartitionInfo, identity *DiskIdentity) error {
+	var cmdStr string
+
+	// Reproducible builds pin filesystem identifiers and timestamps
+	var idFlags string
+	var mkfsEnv []string
+	if identity != nil {
+		idFlags = identity.mkfsFlags(partitionInfo.ID, partitionInfo.FsType) + " "
+		mkfsEnv = identity.MkfsEnv()
+	}
+
 	if partitionInfo.FsType == "fat32" || partitionInfo.FsType == "fat16" || partitionInfo.FsType == "vfat" {
+		if identity != nil {
+			// Fixed creation times for the volume label and boot sector
+			idFlags = "--invariant " + idFlags
+		}
 		var fatTypeFlag string
 		switch partitionInfo.FsType {
 		case "fat32":
@@ -586,70 +725,76 @@ func diskPartitionCreate(
 
 		if partitionInfo.FsLabel != "" {
 			if fatTypeFlag != "" {
-				cmdStr = fmt.Sprintf("mkfs -t vfat %s -n %s %s", fatTypeFlag, partitionInfo.FsLabel, diskPartDev)
+				cmdStr = fmt.Sprintf("mkfs -t vfat %s -n %s %s%s", fatTypeFlag, partitionInfo.FsLabel, idFlags, diskPartDev)
 			} else {
-				cmdStr = fmt.Sprintf("mkfs -t vfat -n %s %s", partitionInfo.FsLabel, diskPartDev)
+				cmdStr = fmt.Sprintf("mkfs -t vfat -n %s %s%s", partitionInfo.FsLabel, idFlags, diskPartDev)
 			}
 		} else {
 			if fatTypeFlag != "" {
-				cmdStr = fmt.Sprintf("mkfs -t vfat %s %s", fatTypeFlag, diskPartDev)
+				cmdStr = fmt.Sprintf("mkfs -t vfat %s %s%s", fatTypeFlag, idFlags, diskPartDev)
 			} else {
-				cmdStr = fmt.Sprintf("mkfs -t vfat %s", diskPartDev)
+				cmdStr = fmt.Sprintf("mkfs -t vfat %s%s", idFlags, diskPartDev)
 			}
 		}
-		_, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil)
+		_, err := shell.ExecCmd(cmdStr, true, shell.HostPath, mkfsEnv)
 		if err != nil {
-			log.Errorf("Failed to format partition %d with fs type %s: %v", partitionNum, partitionInfo.FsType, err)
-			return "", fmt.Errorf("failed to format partition %d with fs type %s: %w", partitionNum, partitionInfo.FsType, err)
+			log.Errorf("Failed to format %s with fs type %s: %v", diskPartDev, partitionInfo.FsType, err)
+			return fmt.Errorf("failed to format %s with fs type %s: %w", diskPartDev, partitionInfo.FsType, err)
 		}
 	} else if partitionInfo.FsType == "ext2" || partitionInfo.FsType == "ext3" || partitionInfo.FsType == "ext4" || partitionInfo.FsType == "xfs" {
-		var additionalFlags string
-		switch partitionInfo.FsType {
-		case "ext2":
-			additionalFlags = "-b 4096 -O none,sparse_super,large_file,filetype,resize_inode,dir_index,ext_attr"
-		case "ext3":
-			additionalFlags = "-b 4096 -O none,sparse_super,large_file,filetype,resize_inode,dir_index,ext_attr,has_journal"
-		case "ext4":
-			additionalFlags = "-b 4096 -O none,sparse_super,large_file,filetype,resize_inode,dir_index,ext_attr,has_journal,extent,huge_file,flex_bg,metadata_csum,64bit,dir_nlink,extra_isize"
-		}
+		additionalFlags := extFeatureFlags(partitionInfo.FsType)
 		var labelFlag string
 		if partitionInfo.FsLabel != "" {
 			labelFlag = fmt.Sprintf("-L %s", partitionInfo.FsLabel)
 		}
 		if additionalFlags != "" && labelFlag != "" {
-			cmdStr = fmt.Sprintf("mkfs -t %s %s %s %s", partitionInfo.FsType, labelFlag, additionalFlags, diskPartDev)
+			cmdStr = fmt.Sprintf("mkfs -t %s %s %s %s%s", partitionInfo.FsType, labelFlag, additionalFlags, idFlags, diskPartDev)
 		} else if additionalFlags != "" {
-			cmdStr = fmt.Sprintf("mkfs -t %s %s %s", partitionInfo.FsType, additionalFlags, diskPartDev)
+			cmdStr = fmt.Sprintf("mkfs -t %s %s %s%s", partitionInfo.FsType, additionalFlags, idFlags, diskPartDev)
 		} else if labelFlag != "" {
-			cmdStr = fmt.Sprintf("mkfs -t %s %s %s", partitionInfo.FsType, labelFlag, diskPartDev)
+			cmdStr = fmt.Sprintf("mkfs -t %s %s %s%s", partitionInfo.FsType, labelFlag, idFlags, diskPartDev)
+		} else {
+			cmdStr = fmt.Sprintf("mkfs -t %s %s%s", partitionInfo.FsType, idFlags, diskPartDev)
+		}
+		_, err := shell.ExecCmd(cmdStr, true, shell.HostPath, mkfsEnv)
+		if err != nil {
+			log.Errorf("Failed to format %s with fs type %s: %v", diskPartDev, partitionInfo.FsType, err)
+			return fmt.Errorf("failed to format %s with fs type %s: %w", diskPartDev, partitionInfo.FsType, err)
+		}
+	} else if partitionInfo.FsType == "btrfs" {
+		if partitionInfo.FsLabel != "" {
+			cmdStr = fmt.Sprintf("mkfs -t btrfs -L %s %s%s", partitionInfo.FsLabel, idFlags, diskPartDev)
 		} else {
-			cmdStr = fmt.Sprintf("mkfs -t %s %s", partitionInfo.FsType, diskPartDev)
+			cmdStr = fmt.Sprintf("mkfs -t btrfs %s%s", idFlags, diskPartDev)
 		}
-		_, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil)
+		_, err := shell.ExecCmd(cmdStr, true, shell.HostPath, mkfsEnv)
 		if err != nil {
-			log.Errorf("Failed to format partition %d with fs type %s: %v", partitionNum, partitionInfo.FsType, err)
-			return "", fmt.Errorf("failed to format partition %d with fs type %s: %w", partitionNum, partitionInfo.FsType, err)
+			log.Errorf("Failed to format %s with fs type %s: %v", diskPartDev, partitionInfo.FsType, err)
+			return fmt.Errorf("failed to format %s with fs type %s: %w", diskPartDev, partitionInfo.FsType, err)
+		}
+		if err := createBtrfsSubvolumes(diskPartDev, partitionInfo); err != nil {
+			return err
 		}
 	} else if partitionInfo.FsType == "linux-swap" {
 		if partitionInfo.FsLabel != "" {
-			cmdStr = fmt.Sprintf("mkswap -L %s %s", partitionInfo.FsLabel, diskPartDev)
+			cmdStr = fmt.Sprintf("mkswap -L %s %s%s", partitionInfo.FsLabel, idFlags, diskPartDev)
 		} else {
-			cmdStr = fmt.Sprintf("mkswap %s", diskPartDev)
+			cmdStr = fmt.Sprintf("mkswap %s%s", idFlags, diskPartDev)
 		}
-		_, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil)
+		_, err := shell.ExecCmd(cmdStr, true, shell.HostPath, mkfsEnv)
 		if err != nil {
-			log.Errorf("Failed to format partition %d with fs type %s: %v", partitionNum, partitionInfo.FsType, err)
-			return "", fmt.Errorf("failed to format partition %d with fs type %s: %w", partitionNum, partitionInfo.FsType, err)
+			log.Errorf("Failed to format %s with fs type %s: %v", diskPartDev, partitionInfo.FsType, err)
+			return fmt.Errorf("failed to format %s with fs type %s: %w", diskPartDev, partitionInfo.FsType, err)
 		}
 		cmdStr = fmt.Sprintf("swapon %s", diskPartDev)
 		_, err = shell.ExecCmd(cmdStr, true, shell.HostPath, nil)
 		if err != nil {
-			log.Errorf("Failed to enable swap on partition %d: %v", partitionNum, err)
-			return "", fmt.Errorf("failed to enable swap on partition %d: %w", partitionNum, err)
+			log.Errorf("Failed to enable swap on %s: %v", diskPartDev, err)
+			return fmt.Errorf("failed to enable swap on %s: %w", diskPartDev, err)
 		}
 	}
 
-	return diskPartDev, nil
+	return nil
 }
 
 func diskPartitionDelete(diskPath string, partitionNum int) error {
@@ -676,8 +821,26 @@ func diskPartitionDelete(diskPath string, partitionNum int) error {
 }
 
 func DiskPartitionsCreate(diskPath string, partitionsList []config.PartitionInfo, partitionTableType string) (map[string]string, error) {
+	return DiskPartitionsCreateWithIdentity(diskPath, partitionsList, partitionTableType, nil)
+}
+
+// DiskPartitionsCreateWithIdentity partitions and formats diskPath like
+// DiskPartitionsCreate. A non-nil identity pins the disk, partition and
+// filesystem identifiers for reproducible builds.
+func DiskPartitionsCreateWithIdentity(diskPath string, partitionsList []config.PartitionInfo, partitionTableType string, identity *DiskIdentity) (map[string]string, error) {
 	partIDDiskDevMap := make(map[string]string)
 
+	// Resolve and check the layout against the actual disk before touching it
+	diskInfo, err := DiskGetInfo(diskPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get size of disk %s: %w", diskPath, err)
+	}
+	diskBytes, _ := diskInfo["bytes"].(int)
+	partitionsList, err = ResolvePartitionLayout(partitionsList, uint64(diskBytes), partitionTableType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid partition layout for disk %s: %w", diskPath, err)
+	}
+
 	partitionExist, err := IsDiskPartitionExist(diskPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check if disk %s has partitions: %w", diskPath, err)
@@ -697,10 +860,15 @@ func DiskPartitionsCreate(diskPath string, partitionsList []config.PartitionInfo
 			log.Errorf("Failed to create GPT partition table on disk %s: %v", diskPath, err)
 			return nil, fmt.Errorf("failed to create GPT partition table on disk %s: %w", diskPath, err)
 		}
+		if identity != nil {
+			if err := identity.setDiskID(diskPath, partitionTableType); err != nil {
+				return nil, err
+			}
+		}
 
 		for i, partitionInfo := range partitionsList {
 			partitionNum := i + 1
-			diskPartDev, err := diskPartitionCreate(diskPath, partitionNum, partitionInfo, partitionTableType, "primary")
+			diskPartDev, err := diskPartitionCreate(diskPath, partitionNum, partitionInfo, partitionTableType, "primary", identity)
 			if err != nil {
 				for i := 1; i < partitionNum; i++ {
 					// Clean up previously created partitions if any
@@ -722,6 +890,11 @@ func DiskPartitionsCreate(diskPath string, partitionsList []config.PartitionInfo
 			log.Errorf("Failed to create MBR partition table on disk %s: %v", diskPath, err)
 			return nil, fmt.Errorf("failed to create MBR partition table on disk %s: %w", diskPath, err)
 		}
+		if identity != nil {
+			if err := identity.setDiskID(diskPath, partitionTableType); err != nil {
+				return nil, err
+			}
+		}
 
 		partitionCount := len(partitionsList)
 		for i, partitionInfo := range partitionsList {
@@ -730,10 +903,15 @@ func DiskPartitionsCreate(diskPath string, partitionsList []config.PartitionInfo
 				if i == maxPrimaryPartitionsNum-1 {
 					partitionType = "extended"
 					partitionNum = i + 1
+					logicalPartitionStart := partitionInfo.Start
 					logicalPartitionEnd := partitionInfo.End
 					extendedPartitionEnd := partitionsList[partitionCount-1].End
+					partitionInfo.Start, err = extendedPartitionStart(partitionInfo)
+					if err != nil {
+						return nil, err
+					}
 					partitionInfo.End = extendedPartitionEnd
-					_, err := diskPartitionCreate(diskPath, partitionNum, partitionInfo, partitionTableType, partitionType)
+					_, err := diskPartitionCreate(diskPath, partitionNum, partitionInfo, partitionTableType, partitionType, identity)
 					if err != nil {
 						for i := 1; i < partitionNum; i++ {
 							// Clean up previously created partitions if any
@@ -743,6 +921,7 @@ func DiskPartitionsCreate(diskPath string, partitionsList []config.PartitionInfo
 						}
 						return nil, fmt.Errorf("failed to create extended partition %d: %w", partitionNum, err)
 					}
+					partitionInfo.Start = logicalPartitionStart
 					partitionInfo.End = logicalPartitionEnd
 					partitionType = "logical"
 					partitionNum = i + 1
@@ -756,7 +935,7 @@ func DiskPartitionsCreate(diskPath string, partitionsList []config.PartitionInfo
 				partitionType = "primary"
 				partitionNum = i + 1
 			}
-			diskPartDev, err := diskPartitionCreate(diskPath, partitionNum, partitionInfo, partitionTableType, partitionType)
+			diskPartDev, err := diskPartitionCreate(diskPath, partitionNum, partitionInfo, partitionTableType, partitionType, identity)
 			if err != nil {
 				for i := 1; i < partitionNum; i++ {
 					// Clean up previously created partitions if any
@@ -799,6 +978,9 @@ func WipePartitions(diskPath string) error {
 }
 
 func GetUUID(diskPartitionPath string) (string, error) {
+	if image, ok := lookupPartitionImage(diskPartitionPath); ok {
+		return image.fsUUID, nil
+	}
 	cmd := fmt.Sprintf("blkid %s -s UUID -o value", diskPartitionPath)
 	output, err := shell.ExecCmd(cmd, true, shell.HostPath, nil)
 	if err != nil {
@@ -809,6 +991,9 @@ func GetUUID(diskPartitionPath string) (string, error) {
 }
 
 func GetPartUUID(diskPartitionPath string) (string, error) {
+	if image, ok := lookupPartitionImage(diskPartitionPath); ok {
+		return image.partUUID, nil
+	}
 	cmd := fmt.Sprintf("blkid %s -s PARTUUID -o value", diskPartitionPath)
 	output, err := shell.ExecCmd(cmd, true, shell.HostPath, nil)
 	if err != nil {
@@ -1083,12 +1083,12 @@ func TestGetAlignedSectorOffset(t *testing.T) {
 		{
 			name:         "aligned",
 			diskName:     "sda",
-			sectorOffset: 8,
+			sectorOffset: 4096,
 			mockCommands: []shell.MockCommand{
 				{Pattern: "cat /sys/block/sda/queue/hw_sector_size", Output: "512\n", Error: nil},
 				{Pattern: "cat /sys/block/sda/queue/physical_block_size", Output: "4096\n", Error: nil},
 			},
-			expected:    8,
+			expected:    4096,
 			expectError: false,
 		},
 		{
@@ -1099,7 +1099,7 @@ func TestGetAlignedSectorOffset(t *testing.T) {
 				{Pattern: "cat /sys/block/sda/queue/hw_sector_size", Output: "512\n", Error: nil},
 				{Pattern: "cat /sys/block/sda/queue/physical_block_size", Output: "4096\n", Error: nil},
 			},
-			expected:    8,
+			expected:    2048,
 			expectError: false,
 		},
 		{
@@ -1110,7 +1110,18 @@ func TestGetAlignedSectorOffset(t *testing.T) {
 				{Pattern: "cat /sys/block/sda/queue/hw_sector_size", Output: "512\n", Error: nil},
 				{Pattern: "cat /sys/block/sda/queue/physical_block_size", Output: "512\n", Error: nil},
 			},
-			expected:    10,
+			expected:    2048,
+			expectError: false,
+		},
+		{
+			name:         "4k_sectors",
+			diskName:     "nvme0n1",
+			sectorOffset: 300,
+			mockCommands: []shell.MockCommand{
+				{Pattern: "cat /sys/block/nvme0n1/queue/hw_sector_size", Output: "4096\n", Error: nil},
+				{Pattern: "cat /sys/block/nvme0n1/queue/physical_block_size", Output: "4096\n", Error: nil},
+			},
+			expected:    512,
 			expectError: false,
 		},
 	}
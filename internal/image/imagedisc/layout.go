@@ -0,0 +1,255 @@
+package imagedisc
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+)
+
+// partitionAlignment is the boundary, in bytes, partitions start on. It is
+// the default of fdisk and parted and a multiple of every common physical
+// block and erase block size.
+const partitionAlignment = 1048576
+
+func alignDown(bytes uint64) uint64 {
+	return bytes / partitionAlignment * partitionAlignment
+}
+
+func alignUp(bytes uint64) uint64 {
+	return (bytes + partitionAlignment - 1) / partitionAlignment * partitionAlignment
+}
+
+// IsSizedLayout reports whether the partitions are laid out by size rather
+// than placed by start and end offsets.
+func IsSizedLayout(partitions []config.PartitionInfo) bool {
+	for _, partition := range partitions {
+		if partition.Size != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// partitionBounds returns the minimum and maximum size of a partition, with
+// zero meaning unbounded.
+func partitionBounds(partition config.PartitionInfo) (uint64, uint64, error) {
+	var minBytes, maxBytes uint64
+	var err error
+	if partition.MinSize != "" {
+		if minBytes, err = TranslateSizeStrToBytes(partition.MinSize); err != nil {
+			return 0, 0, fmt.Errorf("invalid minSize %s of partition %s: %w", partition.MinSize, partition.ID, err)
+		}
+	}
+	if partition.MaxSize != "" {
+		if maxBytes, err = TranslateSizeStrToBytes(partition.MaxSize); err != nil {
+			return 0, 0, fmt.Errorf("invalid maxSize %s of partition %s: %w", partition.MaxSize, partition.ID, err)
+		}
+	}
+	return alignUp(minBytes), alignDown(maxBytes), nil
+}
+
+func clampSize(size, minBytes, maxBytes uint64) uint64 {
+	if maxBytes != 0 && size > maxBytes {
+		size = maxBytes
+	}
+	if size < minBytes {
+		size = minBytes
+	}
+	return size
+}
+
+// isLogicalPartition reports whether the partition at index of a table of
+// count partitions is created as a logical partition: on MBR disks with more
+// than four partitions, the fourth one onwards live in an extended partition.
+func isLogicalPartition(index, count int, partitionTableType string) bool {
+	return partitionTableType == PartitionTableTypeMbr && count > 4 && index >= 3
+}
+
+// extendedPartitionStart returns the start of the extended partition whose
+// first logical partition is firstLogical: the boundary before the data of
+// the logical partition, where its extended boot record is.
+func extendedPartitionStart(firstLogical config.PartitionInfo) (string, error) {
+	start, err := TranslateSizeStrToBytes(firstLogical.Start)
+	if err != nil || start < 2*partitionAlignment {
+		return "", fmt.Errorf("invalid start %s of logical partition %s", firstLogical.Start, firstLogical.ID)
+	}
+	return fmt.Sprintf("%dMiB", start/partitionAlignment-1), nil
+}
+
+// ResolvePartitionLayout returns the partitions with their start and end
+// offsets resolved for a disk of diskBytes. Sized partitions are laid out one
+// after the other from the first MiB, and the last MiB of the disk is left for
+// the backup GPT header. Absolute sizes and percentages of the space in
+// between are computed first, bounded by minSize and maxSize, then the "rest"
+// partition gets the remaining space. Partitions placed by offsets start on
+// the next 1MiB boundary and are then checked for overlaps. Logical
+// partitions start one MiB later, after their extended boot record.
+func ResolvePartitionLayout(partitions []config.PartitionInfo, diskBytes uint64, partitionTableType string) ([]config.PartitionInfo, error) {
+	if !IsSizedLayout(partitions) {
+		aligned := alignPartitionStarts(partitions, partitionTableType)
+		if err := validatePartitionOffsets(aligned, diskBytes); err != nil {
+			return nil, err
+		}
+		return aligned, nil
+	}
+	if diskBytes == 0 {
+		return nil, fmt.Errorf("disk size is required to lay out partitions by size")
+	}
+
+	usableEnd := alignDown(diskBytes)
+	if usableEnd > partitionAlignment {
+		usableEnd -= partitionAlignment
+	}
+	available := usableEnd - partitionAlignment
+	for i := range partitions {
+		if isLogicalPartition(i, len(partitions), partitionTableType) && available >= partitionAlignment {
+			available -= partitionAlignment
+		}
+	}
+
+	sizes := make([]uint64, len(partitions))
+	restIndex := -1
+	var used uint64
+	for i, partition := range partitions {
+		minBytes, maxBytes, err := partitionBounds(partition)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case partition.Size == "rest":
+			restIndex = i
+			continue
+		case strings.HasSuffix(partition.Size, "%"):
+			percent, err := strconv.ParseUint(strings.TrimSuffix(partition.Size, "%"), 10, 64)
+			if err != nil || percent == 0 || percent > 100 {
+				return nil, fmt.Errorf("invalid size %s of partition %s", partition.Size, partition.ID)
+			}
+			sizes[i] = clampSize(alignDown(available*percent/100), minBytes, maxBytes)
+		default:
+			sizeBytes, err := TranslateSizeStrToBytes(partition.Size)
+			if err != nil {
+				return nil, fmt.Errorf("invalid size %s of partition %s: %w", partition.Size, partition.ID, err)
+			}
+			sizes[i] = alignUp(sizeBytes)
+		}
+		if sizes[i] == 0 {
+			sizes[i] = partitionAlignment
+		}
+		used += sizes[i]
+	}
+	if used > available {
+		log.Errorf("Partitions need %s but the disk only has %s", TranslateBytesToSizeStr(used), TranslateBytesToSizeStr(available))
+		return nil, fmt.Errorf("partitions need %s but the disk only has %s",
+			TranslateBytesToSizeStr(used), TranslateBytesToSizeStr(available))
+	}
+	if restIndex >= 0 {
+		partition := partitions[restIndex]
+		minBytes, maxBytes, _ := partitionBounds(partition)
+		rest := available - used
+		if rest < partitionAlignment || rest < minBytes {
+			log.Errorf("Not enough space left on the disk for partition %s", partition.ID)
+			return nil, fmt.Errorf("not enough space left on the disk for partition %s: %s available",
+				partition.ID, TranslateBytesToSizeStr(rest))
+		}
+		sizes[restIndex] = clampSize(rest, minBytes, maxBytes)
+	}
+
+	resolved := make([]config.PartitionInfo, len(partitions))
+	offset := uint64(partitionAlignment)
+	for i, partition := range partitions {
+		if isLogicalPartition(i, len(partitions), partitionTableType) {
+			offset += partitionAlignment
+		}
+		partition.Start = fmt.Sprintf("%dMiB", offset/partitionAlignment)
+		offset += sizes[i]
+		partition.End = fmt.Sprintf("%dMiB", offset/partitionAlignment)
+		log.Debugf("Partition %s resolved to %s-%s", partition.ID, partition.Start, partition.End)
+		resolved[i] = partition
+	}
+	return resolved, nil
+}
+
+// alignPartitionStarts returns the partitions with their start offsets moved
+// up to the next 1MiB boundary. The extended boot record of a logical
+// partition takes the sector on that boundary, so it is reserved before the
+// data start is aligned to the following one.
+func alignPartitionStarts(partitions []config.PartitionInfo, partitionTableType string) []config.PartitionInfo {
+	aligned := make([]config.PartitionInfo, len(partitions))
+	for i, partition := range partitions {
+		aligned[i] = partition
+		start, err := TranslateSizeStrToBytes(partition.Start)
+		if partition.Start == "" || err != nil {
+			continue
+		}
+		if alignUp(start) != start {
+			log.Warnf("Start %s of partition %s is not aligned to 1MiB, moving it to the next boundary",
+				partition.Start, partition.ID)
+		}
+		alignedStart := alignUp(start)
+		if isLogicalPartition(i, len(partitions), partitionTableType) {
+			alignedStart = alignUp(alignedStart + sectorSize)
+		}
+		if alignedStart != start {
+			aligned[i].Start = fmt.Sprintf("%dMiB", alignedStart/partitionAlignment)
+		}
+	}
+	return aligned
+}
+
+// validatePartitionOffsets checks that partitions placed by offsets do not
+// overlap and fit the disk when its size is known. Templates may list
+// partitions in any order, so they are checked in the order of their start
+// offsets, and only the partition placed last on the disk may extend to its
+// end.
+func validatePartitionOffsets(partitions []config.PartitionInfo, diskBytes uint64) error {
+	type placedPartition struct {
+		partition config.PartitionInfo
+		start     uint64
+	}
+	var placed []placedPartition
+	for _, partition := range partitions {
+		if partition.Start == "" || partition.End == "" {
+			continue
+		}
+		start, err := TranslateSizeStrToBytes(partition.Start)
+		if err != nil {
+			continue
+		}
+		placed = append(placed, placedPartition{partition: partition, start: start})
+	}
+	sort.SliceStable(placed, func(i, j int) bool {
+		return placed[i].start < placed[j].start
+	})
+
+	var prevEnd uint64
+	var prevID string
+	for i, p := range placed {
+		partition, start := p.partition, p.start
+		if prevID != "" && start < prevEnd {
+			log.Errorf("Partition %s overlaps partition %s", partition.ID, prevID)
+			return fmt.Errorf("partition %s overlaps partition %s", partition.ID, prevID)
+		}
+		if partition.End == "0" {
+			if i != len(placed)-1 {
+				return fmt.Errorf("only the last partition can end at the end of the disk, not partition %s", partition.ID)
+			}
+			continue
+		}
+		end, err := TranslateSizeStrToBytes(partition.End)
+		if err != nil {
+			continue
+		}
+		if end <= start {
+			return fmt.Errorf("partition %s ends before it starts", partition.ID)
+		}
+		if diskBytes != 0 && end > diskBytes {
+			return fmt.Errorf("partition %s ends at %s, beyond the end of the disk (%s)",
+				partition.ID, partition.End, TranslateBytesToSizeStr(diskBytes))
+		}
+		prevEnd, prevID = end, partition.ID
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package imagedisc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+)
+
+const testGiB = 1024 * 1024 * 1024
+
+func TestResolvePartitionLayoutSized(t *testing.T) {
+	partitions := []config.PartitionInfo{
+		{ID: "boot", Size: "512MiB", FsType: "fat32"},
+		{ID: "rootfs", Size: "rest", MinSize: "4GiB", FsType: "ext4"},
+		{ID: "swap", Size: "10%", MaxSize: "1GiB", FsType: "linux-swap"},
+		{ID: "data", Size: "20%", MinSize: "3GiB", FsType: "ext4"},
+	}
+
+	// 16GiB disk: 16382MiB between the first and the last MiB, swap is capped
+	// at 1GiB, data gets 20% (3276MiB) and the root the remaining 11570MiB
+	resolved, err := ResolvePartitionLayout(partitions, 16*testGiB, "gpt")
+	if err != nil {
+		t.Fatalf("ResolvePartitionLayout failed: %v", err)
+	}
+	want := [][2]string{{"1MiB", "513MiB"}, {"513MiB", "12083MiB"}, {"12083MiB", "13107MiB"}, {"13107MiB", "16383MiB"}}
+	for i, offsets := range want {
+		if resolved[i].Start != offsets[0] || resolved[i].End != offsets[1] {
+			t.Errorf("partition %s: got %s-%s, want %s-%s", resolved[i].ID, resolved[i].Start, resolved[i].End, offsets[0], offsets[1])
+		}
+	}
+	// The template partitions are left untouched
+	if partitions[0].Start != "" {
+		t.Error("ResolvePartitionLayout modified its input")
+	}
+
+	// 10GiB disk: data is raised to its 3GiB minimum
+	resolved, err = ResolvePartitionLayout(partitions, 10*testGiB, "gpt")
+	if err != nil {
+		t.Fatalf("ResolvePartitionLayout failed: %v", err)
+	}
+	if resolved[3].Start != "7167MiB" || resolved[3].End != "10239MiB" {
+		t.Errorf("data: got %s-%s", resolved[3].Start, resolved[3].End)
+	}
+
+	// 6GiB disk: the root partition would get less than its minimum
+	if _, err := ResolvePartitionLayout(partitions, 6*testGiB, "gpt"); err == nil || !strings.Contains(err.Error(), "not enough space") {
+		t.Fatalf("expected not enough space error, got %v", err)
+	}
+
+	// Disk too small for the fixed sizes
+	if _, err := ResolvePartitionLayout(partitions[:1], 256*1024*1024, "gpt"); err == nil || !strings.Contains(err.Error(), "partitions need") {
+		t.Fatalf("expected disk too small error, got %v", err)
+	}
+
+	// The disk size must be known
+	if _, err := ResolvePartitionLayout(partitions, 0, "gpt"); err == nil {
+		t.Fatal("expected error for unknown disk size")
+	}
+}
+
+func TestResolvePartitionLayoutOffsets(t *testing.T) {
+	partitions := []config.PartitionInfo{
+		{ID: "boot", Start: "1MiB", End: "513MiB"},
+		{ID: "rootfs", Start: "513MiB", End: "4GiB"},
+		{ID: "data", Start: "4GiB", End: "0"},
+	}
+	resolved, err := ResolvePartitionLayout(partitions, 8*testGiB, "gpt")
+	if err != nil {
+		t.Fatalf("ResolvePartitionLayout failed: %v", err)
+	}
+	if resolved[1].Start != "513MiB" || resolved[1].End != "4GiB" {
+		t.Errorf("offsets changed: %+v", resolved[1])
+	}
+
+	tests := []struct {
+		name       string
+		partitions []config.PartitionInfo
+		diskBytes  uint64
+		wantErr    string
+	}{
+		{name: "overlap", partitions: []config.PartitionInfo{
+			{ID: "boot", Start: "1MiB", End: "513MiB"}, {ID: "rootfs", Start: "512MiB", End: "4GiB"},
+		}, diskBytes: 8 * testGiB, wantErr: "rootfs overlaps partition boot"},
+		{name: "end before start", partitions: []config.PartitionInfo{
+			{ID: "boot", Start: "513MiB", End: "1MiB"},
+		}, diskBytes: 8 * testGiB, wantErr: "ends before it starts"},
+		{name: "beyond disk", partitions: []config.PartitionInfo{
+			{ID: "rootfs", Start: "1MiB", End: "9GiB"},
+		}, diskBytes: 8 * testGiB, wantErr: "beyond the end of the disk"},
+		{name: "unknown disk size", partitions: []config.PartitionInfo{
+			{ID: "rootfs", Start: "1MiB", End: "9GiB"},
+		}},
+		{name: "listed out of disk order", partitions: []config.PartitionInfo{
+			{ID: "boot", Start: "1MiB", End: "100MiB"},
+			{ID: "rootfs", Start: "1025MiB", End: "3583MiB"},
+			{ID: "extendedboot", Start: "101MiB", End: "1024MiB"},
+		}, diskBytes: 4 * testGiB},
+		{name: "overlap out of disk order", partitions: []config.PartitionInfo{
+			{ID: "rootfs", Start: "1025MiB", End: "3583MiB"},
+			{ID: "boot", Start: "1MiB", End: "1100MiB"},
+		}, diskBytes: 4 * testGiB, wantErr: "rootfs overlaps partition boot"},
+		{name: "end of disk listed first", partitions: []config.PartitionInfo{
+			{ID: "data", Start: "4GiB", End: "0"}, {ID: "rootfs", Start: "1MiB", End: "4GiB"},
+		}, diskBytes: 8 * testGiB},
+		{name: "end of disk not last", partitions: []config.PartitionInfo{
+			{ID: "rootfs", Start: "1MiB", End: "0"}, {ID: "data", Start: "4GiB", End: "5GiB"},
+		}, diskBytes: 8 * testGiB, wantErr: "only the last partition"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ResolvePartitionLayout(tt.partitions, tt.diskBytes, "gpt")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestResolvePartitionLayoutAlignment(t *testing.T) {
+	// Starts move up to the next 1MiB boundary before the layout is checked
+	resolved, err := ResolvePartitionLayout([]config.PartitionInfo{
+		{ID: "rootfs", Start: "1500KiB", End: "200MiB"},
+	}, 8*testGiB, "gpt")
+	if err != nil {
+		t.Fatalf("ResolvePartitionLayout failed: %v", err)
+	}
+	if resolved[0].Start != "2MiB" || resolved[0].End != "200MiB" {
+		t.Errorf("unexpected offsets %s-%s", resolved[0].Start, resolved[0].End)
+	}
+	if _, err := ResolvePartitionLayout([]config.PartitionInfo{
+		{ID: "rootfs", Start: "1500KiB", End: "1800KiB"},
+	}, 8*testGiB, "gpt"); err == nil || !strings.Contains(err.Error(), "ends before it starts") {
+		t.Fatalf("expected the aligned start to pass the end, got %v", err)
+	}
+
+	// From the fourth of five MBR partitions on, the data of each logical
+	// partition starts on the boundary after its extended boot record
+	partitions := []config.PartitionInfo{
+		{ID: "boot", Start: "1MiB", End: "100MiB"},
+		{ID: "rootfs", Start: "100MiB", End: "200MiB"},
+		{ID: "var", Start: "200MiB", End: "300MiB"},
+		{ID: "home", Start: "300MiB", End: "400MiB"},
+		{ID: "data", Start: "400MiB", End: "0"},
+	}
+	resolved, err = ResolvePartitionLayout(partitions, 8*testGiB, PartitionTableTypeMbr)
+	if err != nil {
+		t.Fatalf("ResolvePartitionLayout failed: %v", err)
+	}
+	var starts []string
+	for _, partition := range resolved {
+		starts = append(starts, partition.Start)
+	}
+	if got := strings.Join(starts, " "); got != "1MiB 100MiB 200MiB 301MiB 401MiB" {
+		t.Errorf("unexpected MBR starts %s", got)
+	}
+	if start, err := extendedPartitionStart(resolved[3]); err != nil || start != "300MiB" {
+		t.Errorf("unexpected extended partition start %s (%v)", start, err)
+	}
+	// GPT has no logical partitions
+	resolved, err = ResolvePartitionLayout(partitions, 8*testGiB, "gpt")
+	if err != nil || resolved[3].Start != "300MiB" {
+		t.Errorf("unexpected GPT start %+v (%v)", resolved[3], err)
+	}
+
+	// Sized layouts leave a MiB in front of each logical partition
+	for i := range partitions {
+		partitions[i].Start, partitions[i].End, partitions[i].Size = "", "", "100MiB"
+	}
+	resolved, err = ResolvePartitionLayout(partitions, 8*testGiB, PartitionTableTypeMbr)
+	if err != nil {
+		t.Fatalf("ResolvePartitionLayout failed: %v", err)
+	}
+	if resolved[2].End != "301MiB" || resolved[3].Start != "302MiB" || resolved[4].Start != "403MiB" {
+		t.Errorf("unexpected sized MBR layout %+v", resolved)
+	}
+}
@@ -139,13 +139,30 @@ func (loopDev *LoopDev) CreateRawImageLoopDev(filePath string, template *config.
 	var loopDevPath string
 
 	diskInfo := template.GetDiskConfig()
+	// A raw image is a single disk, RAID arrays are assembled by the live
+	// installer across the target disks
+	if len(diskInfo.RaidArrays) > 0 {
+		return loopDevPath, diskPathIdMap, fmt.Errorf("RAID arrays are only supported by the live installer")
+	}
 	loopDevPath, err := loopSetupCreateEmptyRawDisk(filePath, diskInfo.Size)
 	if err != nil {
 		return loopDevPath, diskPathIdMap, fmt.Errorf("failed to create loop device: %w", err)
 	}
-	diskPathIdMap, err = DiskPartitionsCreate(loopDevPath, diskInfo.Partitions, diskInfo.PartitionTableType)
+	identity, err := NewDiskIdentity(template)
+	if err != nil {
+		return loopDevPath, diskPathIdMap, fmt.Errorf("failed to derive reproducible disk identity: %w", err)
+	}
+	diskPathIdMap, err = DiskPartitionsCreateWithIdentity(loopDevPath, diskInfo.Partitions, diskInfo.PartitionTableType, identity)
 	if err != nil {
 		return loopDevPath, diskPathIdMap, fmt.Errorf("failed to create partitions on loop device %s: %w", loopDevPath, err)
 	}
+	if diskInfo.DiskGUID != "" {
+		if err := SetDiskID(loopDevPath, diskInfo.DiskGUID); err != nil {
+			return loopDevPath, diskPathIdMap, err
+		}
+	}
+	if err := DiskVolumeGroupsCreate(diskInfo.VolumeGroups, diskPathIdMap, identity); err != nil {
+		return loopDevPath, diskPathIdMap, fmt.Errorf("failed to create volume groups on loop device %s: %w", loopDevPath, err)
+	}
 	return loopDevPath, diskPathIdMap, nil
 }
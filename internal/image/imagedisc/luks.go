@@ -0,0 +1,148 @@
+package imagedisc
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+const (
+	defaultLuksCipher  = "aes-xts-plain64"
+	defaultLuksKeySize = 512
+	// generatedLuksKeySize is the size in bytes of the one-time keys used for
+	// partitions that enroll the TPM2 on first boot
+	generatedLuksKeySize = 64
+)
+
+// LuksKeyFilePath returns the build host path of the key of an encrypted
+// partition. Partitions that enroll the TPM2 on first boot without a key file
+// of their own get a generated one-time key in the temporary directory.
+func LuksKeyFilePath(partitionInfo config.PartitionInfo) string {
+	if partitionInfo.Encryption.KeyFile != "" {
+		return partitionInfo.Encryption.KeyFile
+	}
+	return filepath.Join(config.TempDir(), "luks-keys", partitionInfo.LuksName()+".key")
+}
+
+// ensureLuksKeyFile returns the key file of the partition, generating the
+// one-time TPM2 enrollment key when needed.
+func ensureLuksKeyFile(partitionInfo config.PartitionInfo) (string, error) {
+	keyFile := LuksKeyFilePath(partitionInfo)
+	if partitionInfo.Encryption.KeyFile != "" {
+		if _, err := os.Stat(keyFile); err != nil {
+			log.Errorf("Key file for encrypted partition %s is not accessible: %v", partitionInfo.ID, err)
+			return "", fmt.Errorf("key file for encrypted partition %s is not accessible: %w", partitionInfo.ID, err)
+		}
+		return keyFile, nil
+	}
+
+	key := make([]byte, generatedLuksKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate key for encrypted partition %s: %w", partitionInfo.ID, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return "", fmt.Errorf("failed to create key directory for encrypted partition %s: %w", partitionInfo.ID, err)
+	}
+	if err := os.WriteFile(keyFile, key, 0600); err != nil {
+		log.Errorf("Failed to write key for encrypted partition %s: %v", partitionInfo.ID, err)
+		return "", fmt.Errorf("failed to write key for encrypted partition %s: %w", partitionInfo.ID, err)
+	}
+	return keyFile, nil
+}
+
+// openEncryptedPartition creates the LUKS2 container of diskPartDev and opens
+// it, returning the device-mapper device holding the filesystem.
+func openEncryptedPartition(diskPartDev string, partitionInfo config.PartitionInfo, identity *DiskIdentity) (string, error) {
+	if identity != nil {
+		// LUKS headers carry random salts and key material
+		return "", fmt.Errorf("encrypted partitions are not supported in reproducible builds")
+	}
+
+	name := partitionInfo.LuksName()
+	mapperDev := "/dev/mapper/" + name
+	if _, err := os.Stat(mapperDev); err == nil {
+		log.Errorf("Device %s already exists on the host", mapperDev)
+		return "", fmt.Errorf("device %s already exists on the host", mapperDev)
+	}
+
+	keyFile, err := ensureLuksKeyFile(partitionInfo)
+	if err != nil {
+		return "", err
+	}
+
+	enc := partitionInfo.Encryption
+	cipher := enc.Cipher
+	if cipher == "" {
+		cipher = defaultLuksCipher
+	}
+	keySize := enc.KeySize
+	if keySize == 0 {
+		keySize = defaultLuksKeySize
+	}
+
+	cmdStr := fmt.Sprintf("cryptsetup luksFormat --batch-mode --type luks2 --cipher %s --key-size %d --key-file %s %s",
+		cipher, keySize, keyFile, diskPartDev)
+	if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to create LUKS2 container on %s: %v", diskPartDev, err)
+		return "", fmt.Errorf("failed to create LUKS2 container on %s: %w", diskPartDev, err)
+	}
+
+	cmdStr = fmt.Sprintf("cryptsetup open --type luks2 --key-file %s %s %s", keyFile, diskPartDev, name)
+	if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to open LUKS2 container on %s: %v", diskPartDev, err)
+		return "", fmt.Errorf("failed to open LUKS2 container on %s: %w", diskPartDev, err)
+	}
+	log.Infof("Opened LUKS2 container of partition %s as %s", partitionInfo.ID, mapperDev)
+	return mapperDev, nil
+}
+
+// GetLuksUUID returns the UUID of the LUKS container opened under name, as
+// used by crypttab and rd.luks.uuid=.
+func GetLuksUUID(name string) (string, error) {
+	output, err := shell.ExecCmd("cryptsetup status "+name, true, shell.HostPath, nil)
+	if err != nil {
+		log.Errorf("Failed to get status of LUKS container %s: %v", name, err)
+		return "", fmt.Errorf("failed to get status of LUKS container %s: %w", name, err)
+	}
+	var device string
+	for _, line := range strings.Split(output, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), ":"); ok && key == "device" {
+			device = strings.TrimSpace(value)
+			break
+		}
+	}
+	if device == "" {
+		return "", fmt.Errorf("no backing device found for LUKS container %s", name)
+	}
+
+	output, err = shell.ExecCmd("cryptsetup luksUUID "+device, true, shell.HostPath, nil)
+	if err != nil {
+		log.Errorf("Failed to get LUKS UUID of %s: %v", device, err)
+		return "", fmt.Errorf("failed to get LUKS UUID of %s: %w", device, err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// CloseEncryptedVolumes closes the LUKS containers of the template so the
+// underlying loop device can be detached.
+func CloseEncryptedVolumes(template *config.ImageTemplate) error {
+	for _, partition := range template.GetDiskConfig().Partitions {
+		if partition.Encryption == nil {
+			continue
+		}
+		name := partition.LuksName()
+		if _, err := os.Stat("/dev/mapper/" + name); os.IsNotExist(err) {
+			continue
+		}
+		if _, err := shell.ExecCmd("cryptsetup close "+name, true, shell.HostPath, nil); err != nil {
+			log.Errorf("Failed to close LUKS container %s: %v", name, err)
+			return fmt.Errorf("failed to close LUKS container %s: %w", name, err)
+		}
+	}
+	return nil
+}
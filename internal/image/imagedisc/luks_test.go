@@ -0,0 +1,132 @@
+package imagedisc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func setLuksTestTempDir(t *testing.T) string {
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	t.Cleanup(func() { config.SetGlobal(originalGlobal) })
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+	return tempDir
+}
+
+func TestOpenEncryptedPartitionKeyFile(t *testing.T) {
+	tempDir := setLuksTestTempDir(t)
+	keyFile := filepath.Join(tempDir, "data.key")
+	if err := os.WriteFile(keyFile, []byte("secret"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "cryptsetup luksFormat --batch-mode --type luks2 --cipher aes-xts-plain64 --key-size 512 --key-file " + keyFile + " /dev/loop0p3$", Output: "", Error: nil},
+		{Pattern: "cryptsetup open --type luks2 --key-file " + keyFile + " /dev/loop0p3 luks-data$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	partition := config.PartitionInfo{ID: "data", FsType: "ext4",
+		Encryption: &config.EncryptionConfig{KeySource: "keyfile", KeyFile: keyFile}}
+	dev, err := openEncryptedPartition("/dev/loop0p3", partition, nil)
+	if err != nil {
+		t.Fatalf("openEncryptedPartition failed: %v", err)
+	}
+	if dev != "/dev/mapper/luks-data" {
+		t.Errorf("expected /dev/mapper/luks-data, got %s", dev)
+	}
+
+	// A missing key file is reported before touching the disk
+	partition.Encryption.KeyFile = filepath.Join(tempDir, "missing.key")
+	if _, err := openEncryptedPartition("/dev/loop0p3", partition, nil); err == nil || !strings.Contains(err.Error(), "not accessible") {
+		t.Fatalf("expected missing key error, got %v", err)
+	}
+}
+
+func TestOpenEncryptedPartitionTpm2(t *testing.T) {
+	tempDir := setLuksTestTempDir(t)
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "cryptsetup luksFormat .* --cipher aes-cbc-essiv:sha256 --key-size 256 --key-file .*/luks-keys/cryptroot.key /dev/loop0p2$", Output: "", Error: nil},
+		{Pattern: "cryptsetup open .* /dev/loop0p2 cryptroot$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	partition := config.PartitionInfo{ID: "rootfs", FsType: "ext4", MountPoint: "/",
+		Encryption: &config.EncryptionConfig{KeySource: "tpm2", Cipher: "aes-cbc-essiv:sha256", KeySize: 256, Name: "cryptroot"}}
+	if _, err := openEncryptedPartition("/dev/loop0p2", partition, nil); err != nil {
+		t.Fatalf("openEncryptedPartition failed: %v", err)
+	}
+
+	// The one-time enrollment key is generated in the temporary directory
+	keyFile := LuksKeyFilePath(partition)
+	if keyFile != filepath.Join(tempDir, "luks-keys", "cryptroot.key") {
+		t.Errorf("unexpected generated key path %s", keyFile)
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf("generated key missing: %v", err)
+	}
+	if info.Size() != generatedLuksKeySize || info.Mode().Perm() != 0600 {
+		t.Errorf("unexpected generated key: size %d mode %v", info.Size(), info.Mode().Perm())
+	}
+}
+
+func TestOpenEncryptedPartitionFailures(t *testing.T) {
+	setLuksTestTempDir(t)
+	partition := config.PartitionInfo{ID: "data", Encryption: &config.EncryptionConfig{KeySource: "tpm2"}}
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "cryptsetup luksFormat", Output: "", Error: fmt.Errorf("device busy")},
+		{Pattern: ".*", Output: "", Error: nil},
+	})
+	if _, err := openEncryptedPartition("/dev/loop0p3", partition, nil); err == nil || !strings.Contains(err.Error(), "failed to create LUKS2 container") {
+		t.Fatalf("expected luksFormat error, got %v", err)
+	}
+
+	if _, err := openEncryptedPartition("/dev/loop0p3", partition, &DiskIdentity{}); err == nil || !strings.Contains(err.Error(), "reproducible") {
+		t.Fatalf("expected reproducible build error, got %v", err)
+	}
+}
+
+func TestGetLuksUUID(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	status := "/dev/mapper/luks-data is active.\n  type:    LUKS2\n  cipher:  aes-xts-plain64\n  device:  /dev/loop0p3\n  sector size:  512\n"
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "cryptsetup status luks-data$", Output: status, Error: nil},
+		{Pattern: "cryptsetup luksUUID /dev/loop0p3$", Output: "0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0\n", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	uuid, err := GetLuksUUID("luks-data")
+	if err != nil {
+		t.Fatalf("GetLuksUUID failed: %v", err)
+	}
+	if uuid != "0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0" {
+		t.Errorf("unexpected UUID %q", uuid)
+	}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "cryptsetup status", Output: "/dev/mapper/luks-data is inactive.\n", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if _, err := GetLuksUUID("luks-data"); err == nil || !strings.Contains(err.Error(), "no backing device") {
+		t.Fatalf("expected missing device error, got %v", err)
+	}
+}
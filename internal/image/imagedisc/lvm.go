@@ -0,0 +1,108 @@
+package imagedisc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+// logicalVolumeDevPath returns the device-mapper node of a logical volume.
+// Device-mapper escapes dashes in volume group and logical volume names by
+// doubling them.
+func logicalVolumeDevPath(vgName, lvName string) string {
+	escape := func(name string) string { return strings.ReplaceAll(name, "-", "--") }
+	return fmt.Sprintf("/dev/mapper/%s-%s", escape(vgName), escape(lvName))
+}
+
+// logicalVolumeSizeFlag translates a logical volume size from the template
+// into the lvcreate size option.
+func logicalVolumeSizeFlag(size string) (string, error) {
+	switch {
+	case size == "0":
+		return "-l 100%FREE", nil
+	case strings.HasSuffix(size, "%"):
+		return fmt.Sprintf("-l %sVG", size), nil
+	}
+	sizeBytes, err := TranslateSizeStrToBytes(size)
+	if err != nil {
+		return "", fmt.Errorf("invalid logical volume size %s: %w", size, err)
+	}
+	return fmt.Sprintf("-L %db", sizeBytes), nil
+}
+
+// DiskVolumeGroupsCreate creates the LVM volume groups of the disk on the
+// physical volume partitions listed in diskPathIdMap, then creates and formats
+// their logical volumes. The device of each logical volume is added to
+// diskPathIdMap under its ID, so it can be mounted like a partition.
+func DiskVolumeGroupsCreate(volumeGroups []config.VolumeGroupInfo, diskPathIdMap map[string]string, identity *DiskIdentity) error {
+	if len(volumeGroups) == 0 {
+		return nil
+	}
+	if identity != nil {
+		// LVM metadata embeds random UUIDs, host names and creation times
+		return fmt.Errorf("LVM volume groups are not supported in reproducible builds")
+	}
+
+	for _, vg := range volumeGroups {
+		// Volume group names are global to the host, so an existing group with
+		// the same name would make the new one inaccessible
+		if _, err := shell.ExecCmd("vgs --noheadings -o vg_name "+vg.Name, true, shell.HostPath, nil); err == nil {
+			log.Errorf("Volume group %s already exists on the host", vg.Name)
+			return fmt.Errorf("volume group %s already exists on the host", vg.Name)
+		}
+
+		var pvDevs []string
+		for _, pv := range vg.PhysicalVolumes {
+			pvDev, ok := diskPathIdMap[pv]
+			if !ok {
+				return fmt.Errorf("physical volume partition %s of volume group %s not found", pv, vg.Name)
+			}
+			if _, err := shell.ExecCmd("pvcreate -y "+pvDev, true, shell.HostPath, nil); err != nil {
+				log.Errorf("Failed to create physical volume on %s: %v", pvDev, err)
+				return fmt.Errorf("failed to create physical volume on %s: %w", pvDev, err)
+			}
+			pvDevs = append(pvDevs, pvDev)
+		}
+
+		cmdStr := fmt.Sprintf("vgcreate %s %s", vg.Name, strings.Join(pvDevs, " "))
+		if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil); err != nil {
+			log.Errorf("Failed to create volume group %s: %v", vg.Name, err)
+			return fmt.Errorf("failed to create volume group %s: %w", vg.Name, err)
+		}
+		log.Infof("Created volume group %s on %s", vg.Name, strings.Join(pvDevs, ", "))
+
+		for _, lv := range vg.LogicalVolumes {
+			sizeFlag, err := logicalVolumeSizeFlag(lv.Size)
+			if err != nil {
+				return fmt.Errorf("logical volume %s: %w", lv.ID, err)
+			}
+			cmdStr := fmt.Sprintf("lvcreate -y -n %s %s %s", lv.LVName(), sizeFlag, vg.Name)
+			if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil); err != nil {
+				log.Errorf("Failed to create logical volume %s in %s: %v", lv.LVName(), vg.Name, err)
+				return fmt.Errorf("failed to create logical volume %s in %s: %w", lv.LVName(), vg.Name, err)
+			}
+
+			lvDev := logicalVolumeDevPath(vg.Name, lv.LVName())
+			volume := config.PartitionInfo{ID: lv.ID, FsType: lv.FsType, FsLabel: lv.FsLabel}
+			if err := formatVolume(lvDev, volume, nil); err != nil {
+				return err
+			}
+			diskPathIdMap[lv.ID] = lvDev
+		}
+	}
+	return nil
+}
+
+// DeactivateVolumeGroups deactivates the volume groups of the template so the
+// underlying loop device can be detached.
+func DeactivateVolumeGroups(template *config.ImageTemplate) error {
+	for _, vg := range template.GetDiskConfig().VolumeGroups {
+		if _, err := shell.ExecCmd("vgchange -an "+vg.Name, true, shell.HostPath, nil); err != nil {
+			log.Errorf("Failed to deactivate volume group %s: %v", vg.Name, err)
+			return fmt.Errorf("failed to deactivate volume group %s: %w", vg.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package imagedisc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func lvmTestVolumeGroups() []config.VolumeGroupInfo {
+	return []config.VolumeGroupInfo{
+		{
+			Name:            "vg0",
+			PhysicalVolumes: []string{"pv0"},
+			LogicalVolumes: []config.LogicalVolumeInfo{
+				{ID: "rootfs", Size: "4GiB", FsType: "ext4", FsLabel: "root", MountPoint: "/"},
+				{ID: "var", Size: "25%", FsType: "xfs", MountPoint: "/var"},
+				{ID: "log", Name: "var-log", Size: "0", FsType: "ext4", MountPoint: "/var/log"},
+			},
+		},
+	}
+}
+
+func TestLogicalVolumeDevPath(t *testing.T) {
+	if got := logicalVolumeDevPath("vg0", "root"); got != "/dev/mapper/vg0-root" {
+		t.Errorf("unexpected device path %s", got)
+	}
+	if got := logicalVolumeDevPath("data-vg", "var-log"); got != "/dev/mapper/data--vg-var--log" {
+		t.Errorf("dashes not escaped: %s", got)
+	}
+}
+
+func TestLogicalVolumeSizeFlag(t *testing.T) {
+	tests := map[string]string{
+		"0":    "-l 100%FREE",
+		"25%":  "-l 25%VG",
+		"4GiB": "-L 4294967296b",
+		"512M": "-L 536870912b",
+	}
+	for size, want := range tests {
+		got, err := logicalVolumeSizeFlag(size)
+		if err != nil || got != want {
+			t.Errorf("logicalVolumeSizeFlag(%q) = %q, %v; want %q", size, got, err, want)
+		}
+	}
+	if _, err := logicalVolumeSizeFlag("big"); err == nil {
+		t.Error("expected error for invalid size")
+	}
+}
+
+func TestDiskVolumeGroupsCreate(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "vgs --noheadings -o vg_name vg0$", Output: "", Error: fmt.Errorf("volume group not found")},
+		{Pattern: "pvcreate -y /dev/loop0p2$", Output: "", Error: nil},
+		{Pattern: "vgcreate vg0 /dev/loop0p2$", Output: "", Error: nil},
+		{Pattern: "lvcreate -y -n rootfs -L 4294967296b vg0$", Output: "", Error: nil},
+		{Pattern: "lvcreate -y -n var -l 25%VG vg0$", Output: "", Error: nil},
+		{Pattern: "lvcreate -y -n var-log -l 100%FREE vg0$", Output: "", Error: nil},
+		{Pattern: "mkfs -t ext4 -L root .* /dev/mapper/vg0-rootfs$", Output: "", Error: nil},
+		{Pattern: "mkfs -t xfs /dev/mapper/vg0-var$", Output: "", Error: nil},
+		{Pattern: "mkfs -t ext4 .* /dev/mapper/vg0-var--log$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	diskPathIdMap := map[string]string{"boot": "/dev/loop0p1", "pv0": "/dev/loop0p2"}
+	if err := DiskVolumeGroupsCreate(lvmTestVolumeGroups(), diskPathIdMap, nil); err != nil {
+		t.Fatalf("DiskVolumeGroupsCreate failed: %v", err)
+	}
+	want := map[string]string{
+		"rootfs": "/dev/mapper/vg0-rootfs",
+		"var":    "/dev/mapper/vg0-var",
+		"log":    "/dev/mapper/vg0-var--log",
+	}
+	for id, dev := range want {
+		if diskPathIdMap[id] != dev {
+			t.Errorf("expected %s to map to %s, got %q", id, dev, diskPathIdMap[id])
+		}
+	}
+}
+
+func TestDiskVolumeGroupsCreateFailures(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	// Volume group name already in use on the host
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "vgs ", Output: "  vg0\n", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	err := DiskVolumeGroupsCreate(lvmTestVolumeGroups(), map[string]string{"pv0": "/dev/loop0p2"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "already exists on the host") {
+		t.Fatalf("expected existing volume group error, got %v", err)
+	}
+
+	// Missing physical volume partition
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "vgs ", Output: "", Error: fmt.Errorf("volume group not found")},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	err = DiskVolumeGroupsCreate(lvmTestVolumeGroups(), map[string]string{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "physical volume partition pv0") {
+		t.Fatalf("expected missing physical volume error, got %v", err)
+	}
+
+	// lvcreate failure
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "vgs ", Output: "", Error: fmt.Errorf("volume group not found")},
+		{Pattern: "lvcreate .* -n var ", Output: "", Error: fmt.Errorf("insufficient free space")},
+		{Pattern: ".*", Output: "", Error: nil},
+	})
+	err = DiskVolumeGroupsCreate(lvmTestVolumeGroups(), map[string]string{"pv0": "/dev/loop0p2"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to create logical volume var") {
+		t.Fatalf("expected lvcreate error, got %v", err)
+	}
+
+	// Reproducible builds are refused
+	err = DiskVolumeGroupsCreate(lvmTestVolumeGroups(), map[string]string{"pv0": "/dev/loop0p2"}, &DiskIdentity{})
+	if err == nil || !strings.Contains(err.Error(), "reproducible") {
+		t.Fatalf("expected reproducible build error, got %v", err)
+	}
+}
+
+func TestDeactivateVolumeGroups(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	template := &config.ImageTemplate{Disk: config.DiskConfig{VolumeGroups: lvmTestVolumeGroups()}}
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "vgchange -an vg0$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := DeactivateVolumeGroups(template); err != nil {
+		t.Fatalf("DeactivateVolumeGroups failed: %v", err)
+	}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("device busy")},
+	})
+	if err := DeactivateVolumeGroups(template); err == nil {
+		t.Fatal("expected error when vgchange fails")
+	}
+}
@@ -0,0 +1,98 @@
+package imagedisc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+const defaultRaidMetadata = "1.2"
+
+// RaidArrayDevPath returns the device node of an md array created by
+// DiskRaidArraysCreate.
+func RaidArrayDevPath(array config.RaidArrayInfo) string {
+	return "/dev/md/" + array.MDName()
+}
+
+// DiskMirroredPartitionsCreate partitions and formats every disk of diskPaths
+// with the same layout. It returns the partition devices of each disk, in the
+// order of diskPaths.
+func DiskMirroredPartitionsCreate(diskPaths []string, partitionsList []config.PartitionInfo, partitionTableType string) ([]map[string]string, error) {
+	diskPathIdMaps := make([]map[string]string, 0, len(diskPaths))
+	for _, diskPath := range diskPaths {
+		diskPathIdMap, err := DiskPartitionsCreate(diskPath, partitionsList, partitionTableType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create partitions on disk %s: %w", diskPath, err)
+		}
+		diskPathIdMaps = append(diskPathIdMaps, diskPathIdMap)
+	}
+	return diskPathIdMaps, nil
+}
+
+// DiskRaidArraysCreate creates the md arrays of the disk from their member
+// partition on every disk of diskPathIdMaps, then formats them. It returns
+// the partition devices of the first disk with the device of each array added
+// under its ID, so arrays can be mounted like partitions.
+func DiskRaidArraysCreate(raidArrays []config.RaidArrayInfo, diskPathIdMaps []map[string]string) (map[string]string, error) {
+	if len(diskPathIdMaps) == 0 {
+		return nil, fmt.Errorf("no disks to create RAID arrays on")
+	}
+	diskPathIdMap := make(map[string]string, len(diskPathIdMaps[0]))
+	for id, dev := range diskPathIdMaps[0] {
+		diskPathIdMap[id] = dev
+	}
+
+	for _, array := range raidArrays {
+		var memberDevs []string
+		for i, partitions := range diskPathIdMaps {
+			memberDev, ok := partitions[array.Partition]
+			if !ok {
+				return nil, fmt.Errorf("member partition %s of RAID array %s not found on disk %d", array.Partition, array.ID, i+1)
+			}
+			memberDevs = append(memberDevs, memberDev)
+		}
+
+		metadata := array.Metadata
+		if metadata == "" {
+			metadata = defaultRaidMetadata
+		}
+		arrayDev := RaidArrayDevPath(array)
+		// homehost any keeps the array named /dev/md/<name> on the installed
+		// system instead of tying it to the installer host name
+		cmdStr := fmt.Sprintf("mdadm --create %s --run --level=%d --raid-devices=%d --metadata=%s --name=%s --homehost=any %s",
+			arrayDev, array.Level, len(memberDevs), metadata, array.MDName(), strings.Join(memberDevs, " "))
+		if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, nil); err != nil {
+			log.Errorf("Failed to create RAID array %s: %v", array.ID, err)
+			return nil, fmt.Errorf("failed to create RAID array %s: %w", array.ID, err)
+		}
+		log.Infof("Created RAID%d array %s on %s", array.Level, arrayDev, strings.Join(memberDevs, ", "))
+
+		volume := config.PartitionInfo{ID: array.ID, FsType: array.FsType, FsLabel: array.FsLabel}
+		if err := formatVolume(arrayDev, volume, nil); err != nil {
+			return nil, err
+		}
+		diskPathIdMap[array.ID] = arrayDev
+	}
+	return diskPathIdMap, nil
+}
+
+// GetRaidArrayConfig returns the mdadm.conf ARRAY lines of the arrays of the
+// template, so the installed system assembles them under the same names.
+func GetRaidArrayConfig(raidArrays []config.RaidArrayInfo) (string, error) {
+	var conf strings.Builder
+	for _, array := range raidArrays {
+		output, err := shell.ExecCmd("mdadm --detail --brief "+RaidArrayDevPath(array), true, shell.HostPath, nil)
+		if err != nil {
+			log.Errorf("Failed to get details of RAID array %s: %v", array.ID, err)
+			return "", fmt.Errorf("failed to get details of RAID array %s: %w", array.ID, err)
+		}
+		for _, line := range strings.Split(output, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "ARRAY ") {
+				conf.WriteString(strings.TrimSpace(line) + "\n")
+			}
+		}
+	}
+	return conf.String(), nil
+}
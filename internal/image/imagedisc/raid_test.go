@@ -0,0 +1,116 @@
+package imagedisc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func raidTestDiskPathIdMaps() []map[string]string {
+	return []map[string]string{
+		{"boot": "/dev/nvme0n1p1", "md-boot": "/dev/nvme0n1p2", "md-root": "/dev/nvme0n1p3"},
+		{"boot": "/dev/nvme1n1p1", "md-boot": "/dev/nvme1n1p2", "md-root": "/dev/nvme1n1p3"},
+	}
+}
+
+func raidTestArrays() []config.RaidArrayInfo {
+	return []config.RaidArrayInfo{
+		{ID: "bootfs", Level: 1, Partition: "md-boot", Metadata: "1.0", FsType: "ext4", MountPoint: "/boot"},
+		{ID: "rootfs", Name: "root", Level: 1, Partition: "md-root", FsType: "xfs", FsLabel: "root", MountPoint: "/"},
+	}
+}
+
+func TestDiskRaidArraysCreate(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mdadm --create /dev/md/bootfs --run --level=1 --raid-devices=2 --metadata=1.0 --name=bootfs --homehost=any /dev/nvme0n1p2 /dev/nvme1n1p2$", Output: "", Error: nil},
+		{Pattern: "mdadm --create /dev/md/root --run --level=1 --raid-devices=2 --metadata=1.2 --name=root --homehost=any /dev/nvme0n1p3 /dev/nvme1n1p3$", Output: "", Error: nil},
+		{Pattern: "mkfs -t ext4 .* /dev/md/bootfs$", Output: "", Error: nil},
+		{Pattern: "mkfs -t xfs -L root /dev/md/root$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	diskPathIdMaps := raidTestDiskPathIdMaps()
+	diskPathIdMap, err := DiskRaidArraysCreate(raidTestArrays(), diskPathIdMaps)
+	if err != nil {
+		t.Fatalf("DiskRaidArraysCreate failed: %v", err)
+	}
+	want := map[string]string{
+		"boot":   "/dev/nvme0n1p1",
+		"bootfs": "/dev/md/bootfs",
+		"rootfs": "/dev/md/root",
+	}
+	for id, dev := range want {
+		if diskPathIdMap[id] != dev {
+			t.Errorf("expected %s to map to %s, got %q", id, dev, diskPathIdMap[id])
+		}
+	}
+	// The per-disk maps are left untouched
+	if _, ok := diskPathIdMaps[0]["rootfs"]; ok {
+		t.Error("array added to the partition map of the first disk")
+	}
+}
+
+func TestDiskRaidArraysCreateFailures(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	if _, err := DiskRaidArraysCreate(raidTestArrays(), nil); err == nil {
+		t.Fatal("expected error without disks")
+	}
+
+	// Member partition missing on the second disk
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	diskPathIdMaps := raidTestDiskPathIdMaps()
+	delete(diskPathIdMaps[1], "md-boot")
+	_, err := DiskRaidArraysCreate(raidTestArrays(), diskPathIdMaps)
+	if err == nil || !strings.Contains(err.Error(), "not found on disk 2") {
+		t.Fatalf("expected missing member error, got %v", err)
+	}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mdadm --create", Output: "", Error: fmt.Errorf("device busy")},
+		{Pattern: ".*", Output: "", Error: nil},
+	})
+	_, err = DiskRaidArraysCreate(raidTestArrays(), raidTestDiskPathIdMaps())
+	if err == nil || !strings.Contains(err.Error(), "failed to create RAID array bootfs") {
+		t.Fatalf("expected mdadm error, got %v", err)
+	}
+}
+
+func TestDiskRaidArraysCreateNoArrays(t *testing.T) {
+	diskPathIdMap, err := DiskRaidArraysCreate(nil, raidTestDiskPathIdMaps()[:1])
+	if err != nil {
+		t.Fatalf("DiskRaidArraysCreate failed: %v", err)
+	}
+	if len(diskPathIdMap) != 3 || diskPathIdMap["md-root"] != "/dev/nvme0n1p3" {
+		t.Errorf("unexpected partition map %v", diskPathIdMap)
+	}
+}
+
+func TestGetRaidArrayConfig(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mdadm --detail --brief /dev/md/bootfs$", Output: "ARRAY /dev/md/bootfs metadata=1.0 name=any:bootfs UUID=1111:2222:3333:4444\n", Error: nil},
+		{Pattern: "mdadm --detail --brief /dev/md/root$", Output: "mdadm: array /dev/md/root started.\nARRAY /dev/md/root metadata=1.2 name=any:root UUID=5555:6666:7777:8888\n", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	conf, err := GetRaidArrayConfig(raidTestArrays())
+	if err != nil {
+		t.Fatalf("GetRaidArrayConfig failed: %v", err)
+	}
+	want := "ARRAY /dev/md/bootfs metadata=1.0 name=any:bootfs UUID=1111:2222:3333:4444\n" +
+		"ARRAY /dev/md/root metadata=1.2 name=any:root UUID=5555:6666:7777:8888\n"
+	if conf != want {
+		t.Errorf("unexpected configuration %q", conf)
+	}
+}
@@ -0,0 +1,107 @@
+package imagedisc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/mount"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+// readOnlyFsCmd returns the command building the read-only filesystem of
+// partition into target from the content of dir. The tools sort directory
+// entries and every build stamps the filesystem and all its files with epoch,
+// so with the UUID derived from the template the output, and the dm-verity
+// root hash computed over it, only depend on the content.
+func readOnlyFsCmd(partition config.PartitionInfo, fsUUID, dir, target string, epoch int64) string {
+	if partition.FsType == "erofs" {
+		cmdStr := fmt.Sprintf("mkfs -t erofs -T %d ", epoch)
+		if partition.FsLabel != "" {
+			cmdStr += fmt.Sprintf("-L %s ", partition.FsLabel)
+		}
+		if fsUUID != "" {
+			cmdStr += fmt.Sprintf("-U %s ", fsUUID)
+		}
+		return cmdStr + target + " " + dir
+	}
+	return fmt.Sprintf("mksquashfs %s %s -noappend -no-progress -mkfs-time %d -all-time %d", dir, target, epoch, epoch)
+}
+
+// readOnlyFsEpoch returns the timestamp of read-only filesystems and their
+// files: SOURCE_DATE_EPOCH when set, the Unix epoch otherwise.
+func readOnlyFsEpoch() (int64, error) {
+	if os.Getenv(config.SourceDateEpochEnv) == "" {
+		return 0, nil
+	}
+	epoch, err := config.GetSourceDateEpoch()
+	if err != nil {
+		return 0, err
+	}
+	return epoch.Unix(), nil
+}
+
+// ReadOnlyFilesystemUUID returns the UUID the read-only filesystem of
+// partition is built with, or an empty string for squashfs, which has none.
+// It is derived from the template in every build, the way reproducible builds
+// derive all filesystem UUIDs, so it is known before the filesystem is built
+// and does not change the dm-verity root hash between builds.
+func ReadOnlyFilesystemUUID(template *config.ImageTemplate, partition config.PartitionInfo) (string, error) {
+	if partition.FsType != "erofs" {
+		return "", nil
+	}
+	hash, err := template.GetTemplateHash()
+	if err != nil {
+		return "", fmt.Errorf("failed to hash template: %w", err)
+	}
+	return config.DeriveUUID(hash, "filesystem/"+partition.ID).String(), nil
+}
+
+// BuildReadOnlyFilesystem writes the read-only filesystem of partition to
+// diskPartDev from the content of sourceDir. The filesystems mounted below
+// sourceDir are left out: the tools read sourceDir through a non-recursive
+// bind mount.
+func BuildReadOnlyFilesystem(template *config.ImageTemplate, partition config.PartitionInfo, diskPartDev, sourceDir string) error {
+	log.Infof("Building %s filesystem of partition %s", partition.FsType, partition.ID)
+
+	identity, err := NewDiskIdentity(template)
+	if err != nil {
+		return fmt.Errorf("failed to derive reproducible disk identity: %w", err)
+	}
+	var mkfsEnv []string
+	if identity != nil {
+		mkfsEnv = identity.MkfsEnv()
+	}
+	fsUUID, err := ReadOnlyFilesystemUUID(template, partition)
+	if err != nil {
+		return err
+	}
+	epoch, err := readOnlyFsEpoch()
+	if err != nil {
+		return err
+	}
+
+	stageDir := filepath.Join(config.TempDir(), "readonly-"+partition.ID)
+	if err := mount.MountPath(sourceDir, stageDir, "--bind"); err != nil {
+		log.Errorf("Failed to bind mount %s: %v", sourceDir, err)
+		return fmt.Errorf("failed to bind mount %s: %w", sourceDir, err)
+	}
+	defer func() {
+		if err := mount.UmountPath(stageDir); err != nil {
+			log.Warnf("Failed to unmount %s: %v", stageDir, err)
+			return
+		}
+		// Only removes the directory once the bind mount is gone
+		if _, err := shell.ExecCmd("rm -d "+stageDir, true, shell.HostPath, nil); err != nil {
+			log.Warnf("Failed to remove %s: %v", stageDir, err)
+		}
+	}()
+
+	cmdStr := readOnlyFsCmd(partition, fsUUID, stageDir, diskPartDev, epoch)
+	if _, err := shell.ExecCmd(cmdStr, true, shell.HostPath, mkfsEnv); err != nil {
+		log.Errorf("Failed to build %s filesystem of partition %s: %v", partition.FsType, partition.ID, err)
+		return fmt.Errorf("failed to build %s filesystem of partition %s: %w", partition.FsType, partition.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package imagedisc
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func TestReadOnlyFsCmd(t *testing.T) {
+	erofs := config.PartitionInfo{ID: "rootfs", FsType: "erofs", FsLabel: "rootfs"}
+	if got := readOnlyFsCmd(erofs, "6d4c0a4e-0000-4000-8000-000000000001", "/src", "/dev/loop0p2", 1700000000); got !=
+		"mkfs -t erofs -T 1700000000 -L rootfs -U 6d4c0a4e-0000-4000-8000-000000000001 /dev/loop0p2 /src" {
+		t.Errorf("unexpected erofs command %q", got)
+	}
+	squashfs := config.PartitionInfo{ID: "rootfs", FsType: "squashfs"}
+	if got := readOnlyFsCmd(squashfs, "", "/src", "/dev/loop0p2", 0); got !=
+		"mksquashfs /src /dev/loop0p2 -noappend -no-progress -mkfs-time 0 -all-time 0" {
+		t.Errorf("unexpected squashfs command %q", got)
+	}
+}
+
+func TestReadOnlyFsEpoch(t *testing.T) {
+	t.Setenv(config.SourceDateEpochEnv, "")
+	if epoch, err := readOnlyFsEpoch(); err != nil || epoch != 0 {
+		t.Errorf("readOnlyFsEpoch() = %d, %v; want 0", epoch, err)
+	}
+	t.Setenv(config.SourceDateEpochEnv, "1700000000")
+	if epoch, err := readOnlyFsEpoch(); err != nil || epoch != 1700000000 {
+		t.Errorf("readOnlyFsEpoch() = %d, %v; want 1700000000", epoch, err)
+	}
+	t.Setenv(config.SourceDateEpochEnv, "yesterday")
+	if _, err := readOnlyFsEpoch(); err == nil {
+		t.Error("expected an error for an invalid SOURCE_DATE_EPOCH")
+	}
+}
+
+func TestBuildReadOnlyFilesystem(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	t.Setenv(config.SourceDateEpochEnv, "")
+	template := &config.ImageTemplate{}
+	partition := config.PartitionInfo{ID: "rootfs", FsType: "erofs", MountPoint: "/"}
+	// The UUID only depends on the template, not on the partition it lands on
+	fsUUID, err := ReadOnlyFilesystemUUID(template, partition)
+	if err != nil || len(fsUUID) != 36 {
+		t.Fatalf("unexpected erofs UUID %q (%v)", fsUUID, err)
+	}
+	if again, _ := ReadOnlyFilesystemUUID(template, partition); again != fsUUID {
+		t.Errorf("erofs UUID changed between calls: %s, %s", fsUUID, again)
+	}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "^mount$", Output: "", Error: nil},
+		{Pattern: "mkdir -p .*/readonly-rootfs$", Output: "", Error: nil},
+		{Pattern: "mount --bind /install/root .*/readonly-rootfs$", Output: "", Error: nil},
+		{Pattern: "mkfs -t erofs -T 0 -U " + regexp.QuoteMeta(fsUUID) + " /dev/loop0p2 .*/readonly-rootfs$", Output: "", Error: nil},
+		{Pattern: "rm -d .*/readonly-rootfs$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	if err := BuildReadOnlyFilesystem(template, partition, "/dev/loop0p2", "/install/root"); err != nil {
+		t.Fatalf("BuildReadOnlyFilesystem failed: %v", err)
+	}
+
+	// squashfs has no UUID to derive
+	if fsUUID, err := ReadOnlyFilesystemUUID(template, config.PartitionInfo{FsType: "squashfs"}); err != nil || fsUUID != "" {
+		t.Errorf("expected no squashfs UUID, got %q (%v)", fsUUID, err)
+	}
+}
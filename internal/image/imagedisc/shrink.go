@@ -0,0 +1,81 @@
+package imagedisc
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/partition/mbr"
+)
+
+// ShrinkRawImage trims the raw image at imagePath to the end of its last
+// partition, rounded up to 1MiB. The backup GPT header and partition array
+// are moved to the new end of the disk. Images already ending there are left
+// unchanged.
+func ShrinkRawImage(imagePath string) error {
+	disk, err := os.OpenFile(imagePath, os.O_RDWR, 0)
+	if err != nil {
+		log.Errorf("Failed to open raw image %s: %v", imagePath, err)
+		return fmt.Errorf("failed to open raw image %s: %w", imagePath, err)
+	}
+	defer disk.Close()
+	info, err := disk.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat raw image %s: %w", imagePath, err)
+	}
+	currentBytes := uint64(info.Size())
+
+	if table, err := gpt.Read(disk, sectorSize, sectorSize); err == nil {
+		var lastSector uint64
+		for _, partition := range table.Partitions {
+			if partition.End > lastSector {
+				lastSector = partition.End
+			}
+		}
+		newBytes := alignUp((lastSector + 1 + gptReservedSectors) * sectorSize)
+		if newBytes >= currentBytes {
+			log.Infof("Raw image %s already ends with its last partition", imagePath)
+			return nil
+		}
+		if err := disk.Truncate(int64(newBytes)); err != nil {
+			log.Errorf("Failed to shrink raw image %s: %v", imagePath, err)
+			return fmt.Errorf("failed to shrink raw image %s: %w", imagePath, err)
+		}
+		shrunk := &gpt.Table{
+			LogicalSectorSize:  sectorSize,
+			PhysicalSectorSize: sectorSize,
+			ProtectiveMBR:      true,
+			GUID:               table.GUID,
+			Partitions:         table.Partitions,
+		}
+		if err := shrunk.Write(disk, int64(newBytes)); err != nil {
+			log.Errorf("Failed to rewrite partition table of %s: %v", imagePath, err)
+			return fmt.Errorf("failed to rewrite partition table of %s: %w", imagePath, err)
+		}
+		log.Infof("Shrunk raw image %s from %s to %s", imagePath, TranslateBytesToSizeStr(currentBytes), TranslateBytesToSizeStr(newBytes))
+		return disk.Sync()
+	}
+
+	table, err := mbr.Read(disk, sectorSize, sectorSize)
+	if err != nil {
+		log.Errorf("Failed to read partition table of %s: %v", imagePath, err)
+		return fmt.Errorf("failed to read partition table of %s: %w", imagePath, err)
+	}
+	var endSector uint64
+	for _, partition := range table.Partitions {
+		if end := uint64(partition.Start) + uint64(partition.Size); partition.Size != 0 && end > endSector {
+			endSector = end
+		}
+	}
+	newBytes := alignUp(endSector * sectorSize)
+	if endSector == 0 || newBytes >= currentBytes {
+		log.Infof("Raw image %s already ends with its last partition", imagePath)
+		return nil
+	}
+	if err := disk.Truncate(int64(newBytes)); err != nil {
+		log.Errorf("Failed to shrink raw image %s: %v", imagePath, err)
+		return fmt.Errorf("failed to shrink raw image %s: %w", imagePath, err)
+	}
+	log.Infof("Shrunk raw image %s from %s to %s", imagePath, TranslateBytesToSizeStr(currentBytes), TranslateBytesToSizeStr(newBytes))
+	return disk.Sync()
+}
@@ -0,0 +1,116 @@
+package imagedisc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/partition/mbr"
+)
+
+func createTestDisk(t *testing.T, size int64) (string, *os.File) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "disk.raw")
+	disk, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create disk: %v", err)
+	}
+	if err := disk.Truncate(size); err != nil {
+		t.Fatalf("failed to size disk: %v", err)
+	}
+	return path, disk
+}
+
+func TestShrinkRawImageGPT(t *testing.T) {
+	path, disk := createTestDisk(t, 64*1024*1024)
+	table := &gpt.Table{
+		LogicalSectorSize:  sectorSize,
+		PhysicalSectorSize: sectorSize,
+		ProtectiveMBR:      true,
+		GUID:               "5c3d4d4e-7d8a-4b8e-9c1f-2a6b3c4d5e6f",
+		Partitions: []*gpt.Partition{
+			{Start: 2048, End: 4095, Size: 2048 * sectorSize, Type: gpt.EFISystemPartition, Name: "esp"},
+			{Start: 4096, End: 18431, Size: 14336 * sectorSize, Type: gpt.LinuxFilesystem, Name: "rootfs"},
+		},
+	}
+	if err := table.Write(disk, 64*1024*1024); err != nil {
+		t.Fatalf("failed to write partition table: %v", err)
+	}
+	if _, err := disk.WriteAt([]byte("ROOTDATA"), 18431*sectorSize); err != nil {
+		t.Fatalf("failed to write partition data: %v", err)
+	}
+	disk.Close()
+
+	if err := ShrinkRawImage(path); err != nil {
+		t.Fatalf("ShrinkRawImage failed: %v", err)
+	}
+
+	// The backup GPT after the last partition rounds the image up to 10MiB
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat disk: %v", err)
+	}
+	if info.Size() != 10*1024*1024 {
+		t.Fatalf("expected 10MiB image, got %d bytes", info.Size())
+	}
+	disk, err = os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open disk: %v", err)
+	}
+	defer disk.Close()
+	shrunk, err := gpt.Read(disk, sectorSize, sectorSize)
+	if err != nil {
+		t.Fatalf("failed to read shrunk partition table: %v", err)
+	}
+	if !strings.EqualFold(shrunk.GUID, table.GUID) || len(shrunk.Partitions) != 2 || shrunk.Partitions[1].End != 18431 {
+		t.Errorf("unexpected shrunk partition table %+v", shrunk)
+	}
+	buf := make([]byte, 8)
+	if _, err := disk.ReadAt(buf, 18431*sectorSize); err != nil || string(buf) != "ROOTDATA" {
+		t.Errorf("partition data lost: %q (%v)", buf, err)
+	}
+
+	// Shrinking again changes nothing
+	if err := ShrinkRawImage(path); err != nil {
+		t.Fatalf("second ShrinkRawImage failed: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 10*1024*1024 {
+		t.Errorf("image size changed on the second shrink")
+	}
+}
+
+func TestShrinkRawImageMBR(t *testing.T) {
+	path, disk := createTestDisk(t, 64*1024*1024)
+	table := &mbr.Table{
+		LogicalSectorSize:  sectorSize,
+		PhysicalSectorSize: sectorSize,
+		Partitions: []*mbr.Partition{
+			{Bootable: true, Type: mbr.Linux, Start: 2048, Size: 16384},
+		},
+	}
+	if err := table.Write(disk, 64*1024*1024); err != nil {
+		t.Fatalf("failed to write partition table: %v", err)
+	}
+	disk.Close()
+
+	if err := ShrinkRawImage(path); err != nil {
+		t.Fatalf("ShrinkRawImage failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat disk: %v", err)
+	}
+	if info.Size() != 9*1024*1024 {
+		t.Errorf("expected 9MiB image, got %d bytes", info.Size())
+	}
+}
+
+func TestShrinkRawImageWithoutPartitionTable(t *testing.T) {
+	path, disk := createTestDisk(t, 1024*1024)
+	disk.Close()
+	if err := ShrinkRawImage(path); err == nil {
+		t.Fatal("expected error for a disk without partition table")
+	}
+}
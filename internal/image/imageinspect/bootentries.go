@@ -0,0 +1,174 @@
+package imageinspect
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// externalGrubConfigEntry prefixes the synthetic entry of a GRUB stub config
+// loading the menu from another filesystem
+const externalGrubConfigEntry = "[External config] "
+
+// grubSetValue returns the value of a "set <name>=<value>" GRUB command. ok is
+// false for other lines and for values taken from variables.
+func grubSetValue(line, name string) (string, bool) {
+	value, found := strings.CutPrefix(line, "set "+name+"=")
+	if !found {
+		return "", false
+	}
+	value = strings.Trim(strings.TrimSpace(value), `"'`)
+	if value == "" || strings.HasPrefix(value, "$") {
+		return "", false
+	}
+	return value, true
+}
+
+// grubMenuEntryID returns the ID of a GRUB menuentry line, given with --id or
+// the $menuentry_id_option grub-mkconfig uses
+func grubMenuEntryID(menuLine string) string {
+	fields := strings.Fields(menuLine)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "--id" || fields[i] == "$menuentry_id_option" {
+			return strings.Trim(fields[i+1], `"'`)
+		}
+	}
+	return ""
+}
+
+// markDefaultBootEntry flags the entry booted by default: the default entry
+// of the menu is an entry ID, a title or a zero-based menu position.
+func markDefaultBootEntry(cfg *BootloaderConfig) {
+	if cfg.DefaultEntry == "" {
+		return
+	}
+	position, err := strconv.Atoi(cfg.DefaultEntry)
+	if err != nil {
+		position = -1
+	}
+	menuIndex := 0
+	for i := range cfg.BootEntries {
+		entry := &cfg.BootEntries[i]
+		if strings.HasPrefix(entry.Name, externalGrubConfigEntry) {
+			continue
+		}
+		entry.IsDefault = menuIndex == position || (entry.ID != "" && entry.ID == cfg.DefaultEntry) || entry.Name == cfg.DefaultEntry
+		menuIndex++
+	}
+}
+
+// addUKIBootEntries adds an entry per UKI in EFI/Linux, which systemd-boot
+// lists in its menu under the PRETTY_NAME of their os-release. The default
+// entry of loader.conf is a glob matching the UKI file names.
+func addUKIBootEntries(cfg *BootloaderConfig, binaries []EFIBinaryEvidence) {
+	for _, uki := range binaries {
+		dir, name := path.Split(strings.TrimPrefix(uki.Path, "/"))
+		if !uki.IsUKI || !strings.EqualFold(strings.TrimSuffix(dir, "/"), "EFI/Linux") {
+			continue
+		}
+		entry := BootEntry{
+			Name:    uki.OSRelease["PRETTY_NAME"],
+			ID:      name,
+			Kernel:  uki.Path,
+			Cmdline: uki.Cmdline,
+			UKIPath: uki.Path,
+		}
+		if entry.Name == "" {
+			entry.Name = name
+		}
+		if cfg.DefaultEntry != "" {
+			entry.IsDefault, _ = path.Match(strings.ToLower(cfg.DefaultEntry), strings.ToLower(name))
+		}
+		for _, token := range strings.Fields(uki.Cmdline) {
+			if root, ok := strings.CutPrefix(token, "root="); ok {
+				entry.RootDevice = strings.Trim(root, `"'`)
+			}
+		}
+		cfg.BootEntries = append(cfg.BootEntries, entry)
+		cfg.KernelReferences = append(cfg.KernelReferences, KernelReference{
+			Path:      uki.Path,
+			BootEntry: entry.Name,
+			RootUUID:  entry.RootDevice,
+		})
+	}
+}
+
+// resolveExternalGrubConfigs replaces the entry of a GRUB stub config on the
+// ESP by the menu of the grub.cfg it loads, read from the filesystem the stub
+// searches for or else from the likely root partitions.
+func resolveExternalGrubConfigs(pt *PartitionTableSummary, readFile partitionFileReader) {
+	for pi := range pt.Partitions {
+		fs := pt.Partitions[pi].Filesystem
+		if fs == nil {
+			continue
+		}
+		for ei := range fs.EFIBinaries {
+			cfg := fs.EFIBinaries[ei].BootConfig
+			if cfg == nil {
+				continue
+			}
+			for i, entry := range cfg.BootEntries {
+				if !strings.HasPrefix(entry.Name, externalGrubConfigEntry) {
+					continue
+				}
+				if mergeExternalGrubConfig(cfg, i, entry.Kernel, *pt, readFile) {
+					break
+				}
+			}
+		}
+	}
+}
+
+// mergeExternalGrubConfig reads configPath and merges its menu into cfg in
+// place of the stub entry at index. It reports whether the file was found.
+func mergeExternalGrubConfig(cfg *BootloaderConfig, index int, configPath string, pt PartitionTableSummary, readFile partitionFileReader) bool {
+	var candidates []int
+	for _, ref := range cfg.UUIDReferences {
+		if ref.Context != "grub_search" {
+			continue
+		}
+		for idx, p := range pt.Partitions {
+			if p.Filesystem != nil && p.Filesystem.UUID != "" && normalizeUUID(p.Filesystem.UUID) == normalizeUUID(ref.UUID) {
+				candidates = append(candidates, idx)
+			}
+		}
+	}
+	candidates = append(candidates, rankRootPartitionCandidates(pt)...)
+
+	for _, idx := range candidates {
+		data, err := readFile(idx, configPath)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		content := string(data)
+		parsed := parseGrubConfigContent(content)
+
+		if cfg.ConfigFiles == nil {
+			cfg.ConfigFiles = make(map[string]string)
+		}
+		if cfg.ConfigRaw == nil {
+			cfg.ConfigRaw = make(map[string]string)
+		}
+		cfg.ConfigFiles[configPath] = hashBytesHex(data)
+		cfg.ConfigRaw[configPath] = parsed.ConfigRaw["grub.cfg"]
+
+		entries := append([]BootEntry{}, cfg.BootEntries[:index]...)
+		entries = append(entries, parsed.BootEntries...)
+		cfg.BootEntries = append(entries, cfg.BootEntries[index+1:]...)
+		var refs []KernelReference
+		for _, ref := range cfg.KernelReferences {
+			if ref.Path != configPath {
+				refs = append(refs, ref)
+			}
+		}
+		cfg.KernelReferences = append(refs, parsed.KernelReferences...)
+		cfg.UUIDReferences = append(cfg.UUIDReferences, parsed.UUIDReferences...)
+		cfg.DefaultEntry = parsed.DefaultEntry
+		cfg.Timeout = parsed.Timeout
+		cfg.Notes = append(cfg.Notes, parsed.Notes...)
+		cfg.Notes = append(cfg.Notes, fmt.Sprintf("Boot entries read from %s on partition %d", configPath, pt.Partitions[idx].Index))
+		return true
+	}
+	return false
+}
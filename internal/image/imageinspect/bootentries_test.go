@@ -0,0 +1,137 @@
+package imageinspect
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseSystemdBootMenu(t *testing.T) {
+	cfg := parseSystemdBootEntries("timeout 5\ndefault\tproduction.efi\n")
+	if cfg.DefaultEntry != "production.efi" || cfg.Timeout != "5" {
+		t.Fatalf("unexpected menu default %q timeout %q", cfg.DefaultEntry, cfg.Timeout)
+	}
+
+	addUKIBootEntries(&cfg, []EFIBinaryEvidence{
+		{Path: "EFI/BOOT/BOOTX64.EFI", Kind: BootloaderSystemdBoot},
+		{Path: "EFI/Linux/debug.efi", IsUKI: true, Cmdline: "root=/dev/sda2 ro debug"},
+		{Path: "EFI/Linux/production.efi", IsUKI: true, Cmdline: "root=/dev/sda2 ro", OSRelease: map[string]string{"PRETTY_NAME": "Production"}},
+	})
+	if len(cfg.BootEntries) != 2 || len(cfg.KernelReferences) != 2 {
+		t.Fatalf("expected 2 UKI entries, got %+v", cfg.BootEntries)
+	}
+	debug, production := cfg.BootEntries[0], cfg.BootEntries[1]
+	if debug.Name != "debug.efi" || debug.IsDefault || debug.RootDevice != "/dev/sda2" {
+		t.Errorf("unexpected debug entry %+v", debug)
+	}
+	if production.Name != "Production" || production.ID != "production.efi" || !production.IsDefault || production.UKIPath != "EFI/Linux/production.efi" {
+		t.Errorf("unexpected production entry %+v", production)
+	}
+}
+
+func TestParseGrubConfigBootMenu(t *testing.T) {
+	grubCfg := `if [ "${next_entry}" ] ; then
+   set default="${next_entry}"
+else
+   set default="rt"
+fi
+set timeout_style=menu
+set timeout=3
+menuentry 'Production' --id production {
+	linux /vmlinuz-6.8.0 root=UUID=11111111-2222-3333-4444-555555555555 ro
+	initrd /initrd.img-6.8.0
+}
+menuentry 'Real-time' --id rt {
+	linux /vmlinuz-6.8.0-rt root=UUID=11111111-2222-3333-4444-555555555555 ro isolcpus=2
+	initrd /initrd.img-6.8.0-rt
+}
+menuentry 'Ubuntu' --class ubuntu $menuentry_id_option 'gnulinux-simple-1111' {
+	linux /vmlinuz-6.8.0 ro
+}`
+	cfg := parseGrubConfigContent(grubCfg)
+	if cfg.DefaultEntry != "rt" || cfg.Timeout != "3" {
+		t.Fatalf("unexpected menu default %q timeout %q", cfg.DefaultEntry, cfg.Timeout)
+	}
+	if len(cfg.BootEntries) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", cfg.BootEntries)
+	}
+	if cfg.BootEntries[0].ID != "production" || cfg.BootEntries[0].IsDefault {
+		t.Errorf("unexpected production entry %+v", cfg.BootEntries[0])
+	}
+	if cfg.BootEntries[1].ID != "rt" || !cfg.BootEntries[1].IsDefault || !strings.HasSuffix(cfg.BootEntries[1].Cmdline, "isolcpus=2") {
+		t.Errorf("unexpected rt entry %+v", cfg.BootEntries[1])
+	}
+	if cfg.BootEntries[2].ID != "gnulinux-simple-1111" {
+		t.Errorf("unexpected menu entry ID %q", cfg.BootEntries[2].ID)
+	}
+
+	// GRUB_DEFAULT=0 picks the first entry of the menu
+	cfg = parseGrubConfigContent(strings.Replace(grubCfg, `set default="rt"`, `set default="0"`, 1))
+	if !cfg.BootEntries[0].IsDefault || cfg.BootEntries[1].IsDefault {
+		t.Errorf("expected the first entry to be the default, got %+v", cfg.BootEntries)
+	}
+}
+
+func TestResolveExternalGrubConfigs(t *testing.T) {
+	stub := parseGrubConfigContent(`search -n -u 0a1b2c3d-0000-1111-2222-333344445555 -s
+set prefix=($root)"/grub"
+configfile $prefix/grub.cfg`)
+	pt := PartitionTableSummary{Partitions: []PartitionSummary{
+		{Index: 1, Name: "boot", Filesystem: &FilesystemSummary{Type: "vfat", EFIBinaries: []EFIBinaryEvidence{
+			{Path: "EFI/BOOT/BOOTX64.EFI", Kind: BootloaderGrub, BootConfig: &stub},
+		}}},
+		{Index: 2, Name: "rootfs", Filesystem: &FilesystemSummary{Type: "ext4", UUID: "99999999-0000-1111-2222-333344445555"}},
+		{Index: 3, Name: "bootfs", Filesystem: &FilesystemSummary{Type: "ext4", UUID: "0a1b2c3d-0000-1111-2222-333344445555"}},
+	}}
+	menu := "set default=\"debug\"\nset timeout=5\nmenuentry 'Production' --id production {\n\tlinux /vmlinuz-6.8.0 ro\n}\nmenuentry 'Debug' --id debug {\n\tlinux /vmlinuz-6.8.0 ro debug\n}\n"
+	var reads []int
+	readFile := func(index int, filePath string) ([]byte, error) {
+		reads = append(reads, index)
+		if index == 2 && filePath == "/grub/grub.cfg" {
+			return []byte(menu), nil
+		}
+		return nil, fmt.Errorf("%s not found", filePath)
+	}
+
+	resolveExternalGrubConfigs(&pt, readFile)
+	cfg := pt.Partitions[0].Filesystem.EFIBinaries[0].BootConfig
+	if len(reads) == 0 || reads[0] != 2 {
+		t.Errorf("expected the searched filesystem to be read first, got %v", reads)
+	}
+	if len(cfg.BootEntries) != 2 || cfg.BootEntries[1].ID != "debug" || !cfg.BootEntries[1].IsDefault {
+		t.Fatalf("expected the external menu entries, got %+v", cfg.BootEntries)
+	}
+	if cfg.DefaultEntry != "debug" || cfg.Timeout != "5" || cfg.ConfigFiles["/grub/grub.cfg"] == "" {
+		t.Errorf("unexpected merged config %+v", cfg)
+	}
+	for _, ref := range cfg.KernelReferences {
+		if ref.Path == "/grub/grub.cfg" {
+			t.Errorf("stub kernel reference left in %+v", cfg.KernelReferences)
+		}
+	}
+}
+
+func TestCompareBootloaderMenu(t *testing.T) {
+	a := &BootloaderConfig{DefaultEntry: "production", Timeout: "5"}
+	b := &BootloaderConfig{DefaultEntry: "debug", Timeout: "5"}
+	if diff := compareBootloaderConfigs(a, a); diff != nil {
+		t.Errorf("expected no diff, got %+v", diff)
+	}
+	diff := compareBootloaderConfigs(a, b)
+	if diff == nil || diff.DefaultEntry == nil || diff.Timeout != nil {
+		t.Fatalf("expected a default entry diff, got %+v", diff)
+	}
+
+	tally := &diffTally{}
+	tallyBootloaderConfigDiff(tally, diff, "EFI/BOOT/BOOTX64.EFI")
+	if tally.meaningful != 1 {
+		t.Errorf("expected a meaningful change, got %v", tally.mReasons)
+	}
+
+	var buf bytes.Buffer
+	renderBootloaderConfigDiffText(&buf, diff, "")
+	if !strings.Contains(buf.String(), "Default entry: production -> debug") {
+		t.Errorf("unexpected diff rendering:\n%s", buf.String())
+	}
+}
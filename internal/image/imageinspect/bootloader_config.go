@@ -112,6 +112,15 @@ func parseGrubConfigContent(content string) BootloaderConfig {
 			}
 		}
 
+		// Default entry and timeout of the menu, skipping the saved and
+		// next entry variables of grub-mkconfig
+		if value, ok := grubSetValue(trimmed, "default"); ok && cfg.DefaultEntry == "" {
+			cfg.DefaultEntry = value
+		}
+		if value, ok := grubSetValue(trimmed, "timeout"); ok && cfg.Timeout == "" {
+			cfg.Timeout = value
+		}
+
 		// Look for configfile directive (loads external config)
 		if strings.HasPrefix(trimmed, "configfile") {
 			parts := strings.Fields(trimmed)
@@ -163,7 +172,7 @@ func parseGrubConfigContent(content string) BootloaderConfig {
 
 		// Add a synthetic entry showing where the config is
 		stubEntry := BootEntry{
-			Name:   "[External config] " + configfilePath,
+			Name:   externalGrubConfigEntry + configfilePath,
 			Kernel: configfilePath,
 		}
 		cfg.BootEntries = append(cfg.BootEntries, stubEntry)
@@ -254,6 +263,8 @@ func parseGrubConfigContent(content string) BootloaderConfig {
 		cfg.BootEntries = append(cfg.BootEntries, *currentEntry)
 	}
 
+	markDefaultBootEntry(&cfg)
+
 	// Extract kernel references
 	for _, entry := range cfg.BootEntries {
 		if entry.Kernel != "" {
@@ -276,7 +287,7 @@ func parseGrubConfigContent(content string) BootloaderConfig {
 
 // parseGrubMenuEntry extracts title/name from a menuentry line.
 func parseGrubMenuEntry(menuLine string) *BootEntry {
-	entry := &BootEntry{}
+	entry := &BootEntry{ID: grubMenuEntryID(menuLine)}
 
 	// Extract text between quotes: menuentry 'Title' { or menuentry "Title" {
 	for _, q := range []rune{'\'', '"'} {
@@ -339,11 +350,16 @@ func parseSystemdBootEntries(content string) BootloaderConfig {
 			continue
 		}
 
-		if strings.HasPrefix(trimmed, "default") {
-			parts := strings.SplitN(trimmed, "=", 2)
-			if len(parts) == 2 {
-				cfg.DefaultEntry = strings.TrimSpace(parts[1])
-			}
+		// loader.conf separates keys and values by whitespace, "=" is accepted too
+		fields := strings.Fields(strings.Replace(trimmed, "=", " ", 1))
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "default":
+			cfg.DefaultEntry = strings.Join(fields[1:], " ")
+		case "timeout":
+			cfg.Timeout = strings.Join(fields[1:], " ")
 		}
 	}
 
@@ -79,6 +79,20 @@ func ParsePEFromBytes(p string, blob []byte) (EFIBinaryEvidence, error) {
 			raw := strings.TrimSpace(string(bytes.Trim(data, "\x00")))
 			ev.OSReleaseRaw = raw
 			ev.OSRelease, ev.OSReleaseSorted = parseOSRelease(raw)
+		case ".pcrsig":
+			sigs, err := parsePCRSignatures(data)
+			if err != nil {
+				ev.Notes = append(ev.Notes, fmt.Sprintf("parse section %s: %v", name, err))
+				continue
+			}
+			ev.PCRSignatures = sigs
+		case ".pcrpkey":
+			fingerprint, err := publicKeyFingerprint(data)
+			if err != nil {
+				ev.Notes = append(ev.Notes, fmt.Sprintf("parse section %s: %v", name, err))
+				continue
+			}
+			ev.PCRPublicKeyFingerprint = fingerprint
 		}
 	}
 
@@ -124,7 +138,7 @@ func classifyBootloaderKind(p string, sections []string) BootloaderKind {
 	if strings.Contains(lp, "grub") {
 		return BootloaderGrub
 	}
-	if strings.Contains(lp, "mmx64.efi") || strings.Contains(lp, "mmia32.efi") {
+	if strings.Contains(lp, "mmx64.efi") || strings.Contains(lp, "mmia32.efi") || strings.Contains(lp, "mmaa64.efi") {
 		return BootloaderMokManager
 	}
 	if strings.Contains(lp, "shim") {
@@ -77,13 +77,14 @@ type VerityDiff struct {
 
 // PartitionTableDiff represents differences in partition table-level fields.
 type PartitionTableDiff struct {
-	DiskGUID           *ValueDiff[string]          `json:"diskGuid,omitempty"`
-	Type               *ValueDiff[string]          `json:"type,omitempty"`
-	LogicalSectorSize  *ValueDiff[int64]           `json:"logicalSectorSize,omitempty"`
-	PhysicalSectorSize *ValueDiff[int64]           `json:"physicalSectorSize,omitempty"`
-	ProtectiveMBR      *ValueDiff[bool]            `json:"protectiveMbr,omitempty"`
-	LargestFreeSpan    *ValueDiff[FreeSpanSummary] `json:"largestFreeSpan,omitempty"`
-	MisalignedParts    *ValueDiff[[]int]           `json:"misalignedPartitions,omitempty"`
+	DiskGUID           *ValueDiff[string]            `json:"diskGuid,omitempty"`
+	Type               *ValueDiff[string]            `json:"type,omitempty"`
+	LogicalSectorSize  *ValueDiff[int64]             `json:"logicalSectorSize,omitempty"`
+	PhysicalSectorSize *ValueDiff[int64]             `json:"physicalSectorSize,omitempty"`
+	ProtectiveMBR      *ValueDiff[bool]              `json:"protectiveMbr,omitempty"`
+	HybridMBR          *ValueDiff[[]MBREntrySummary] `json:"hybridMbr,omitempty"`
+	LargestFreeSpan    *ValueDiff[FreeSpanSummary]   `json:"largestFreeSpan,omitempty"`
+	MisalignedParts    *ValueDiff[[]int]             `json:"misalignedPartitions,omitempty"`
 
 	Changed bool `json:"changed,omitempty"`
 }
@@ -224,6 +225,8 @@ type BootloaderConfigDiff struct {
 	BootEntryChanges     []BootEntryChange  `json:"bootEntryChanges,omitempty"`
 	KernelRefChanges     []KernelRefChange  `json:"kernelRefChanges,omitempty"`
 	UUIDReferenceChanges []UUIDRefChange    `json:"uuidReferenceChanges,omitempty"`
+	DefaultEntry         *ValueDiff[string] `json:"defaultEntry,omitempty"`
+	Timeout              *ValueDiff[string] `json:"timeout,omitempty"`
 	NotesAdded           []string           `json:"notesAdded,omitempty"`
 	NotesRemoved         []string           `json:"notesRemoved,omitempty"`
 }
@@ -500,6 +503,9 @@ func comparePartitionTable(from, to PartitionTableSummary) PartitionTableDiff {
 	if from.ProtectiveMBR != to.ProtectiveMBR {
 		d.ProtectiveMBR = &ValueDiff[bool]{From: from.ProtectiveMBR, To: to.ProtectiveMBR}
 	}
+	if !slices.Equal(from.HybridMBR, to.HybridMBR) {
+		d.HybridMBR = &ValueDiff[[]MBREntrySummary]{From: from.HybridMBR, To: to.HybridMBR}
+	}
 
 	if !freeSpanEqual(from.LargestFreeSpan, to.LargestFreeSpan) {
 		d.LargestFreeSpan = &ValueDiff[FreeSpanSummary]{From: derefFreeSpan(from.LargestFreeSpan), To: derefFreeSpan(to.LargestFreeSpan)}
@@ -509,7 +515,7 @@ func comparePartitionTable(from, to PartitionTableSummary) PartitionTableDiff {
 		d.MisalignedParts = &ValueDiff[[]int]{From: from.MisalignedPartitions, To: to.MisalignedPartitions}
 	}
 
-	d.Changed = d.DiskGUID != nil || d.Type != nil || d.LogicalSectorSize != nil || d.PhysicalSectorSize != nil || d.ProtectiveMBR != nil || d.LargestFreeSpan != nil || d.MisalignedParts != nil
+	d.Changed = d.DiskGUID != nil || d.Type != nil || d.LogicalSectorSize != nil || d.PhysicalSectorSize != nil || d.ProtectiveMBR != nil || d.HybridMBR != nil || d.LargestFreeSpan != nil || d.MisalignedParts != nil
 	return d
 }
 
@@ -919,6 +925,9 @@ func tallyDiffs(d ImageDiff) diffTally {
 	if d.PartitionTable.ProtectiveMBR != nil {
 		t.addMeaningful(1, "PT ProtectiveMBR")
 	}
+	if d.PartitionTable.HybridMBR != nil {
+		t.addMeaningful(1, "PT HybridMBR")
+	}
 	if d.PartitionTable.LargestFreeSpan != nil {
 		t.addMeaningful(1, "PT LargestFreeSpan")
 	}
@@ -1183,6 +1192,15 @@ func tallyBootloaderConfigDiff(t *diffTally, diff *BootloaderConfigDiff, efiKey
 		}
 	}
 
+	// The entry booted without user interaction and the menu timeout change
+	// what the image boots
+	if diff.DefaultEntry != nil {
+		t.addMeaningful(1, "BootConfig["+efiKey+"] default entry changed")
+	}
+	if diff.Timeout != nil {
+		t.addMeaningful(1, "BootConfig["+efiKey+"] timeout changed")
+	}
+
 	// Boot entry changes are meaningful (boot menu changed)
 	for _, be := range diff.BootEntryChanges {
 		switch be.Status {
@@ -289,6 +289,14 @@ func compareBootloaderConfigs(a, b *BootloaderConfig) *BootloaderConfigDiff {
 	// Compare UUID references
 	diff.UUIDReferenceChanges = compareUUIDReferences(a.UUIDReferences, b.UUIDReferences)
 
+	// Compare the boot menu settings
+	if a.DefaultEntry != b.DefaultEntry {
+		diff.DefaultEntry = &ValueDiff[string]{From: a.DefaultEntry, To: b.DefaultEntry}
+	}
+	if a.Timeout != b.Timeout {
+		diff.Timeout = &ValueDiff[string]{From: a.Timeout, To: b.Timeout}
+	}
+
 	// Compare issues
 	diff.NotesRemoved = findRemovedStrings(a.Notes, b.Notes)
 	diff.NotesAdded = findRemovedStrings(b.Notes, a.Notes)
@@ -298,6 +306,8 @@ func compareBootloaderConfigs(a, b *BootloaderConfig) *BootloaderConfigDiff {
 		len(diff.BootEntryChanges) == 0 &&
 		len(diff.KernelRefChanges) == 0 &&
 		len(diff.UUIDReferenceChanges) == 0 &&
+		diff.DefaultEntry == nil &&
+		diff.Timeout == nil &&
 		len(diff.NotesAdded) == 0 &&
 		len(diff.NotesRemoved) == 0 {
 		return nil
@@ -123,6 +123,14 @@ func enrichFilesystemFromRaw(img io.ReaderAt, p *PartitionSummary, pt PartitionT
 		p.Filesystem.Type = "squashfs"
 		return readSquashfsSuperblock(img, partOff, p.Filesystem)
 
+	case "erofs":
+		p.Filesystem.Type = "erofs"
+		return readErofsSuperblock(img, partOff, p.Filesystem)
+
+	case "btrfs":
+		p.Filesystem.Type = "btrfs"
+		return readBtrfsSuperblock(img, partOff, p.Filesystem)
+
 	default:
 		return nil
 	}
@@ -142,6 +150,22 @@ func sniffFilesystemType(r io.ReaderAt, partOff int64) (string, error) {
 		}
 	}
 
+	// erofs magic 0xE0F5E1E2 in the superblock at 1024
+	erofsMagic := make([]byte, 4)
+	if _, err := r.ReadAt(erofsMagic, partOff+erofsSuperblockOffset); err == nil {
+		if binary.LittleEndian.Uint32(erofsMagic) == erofsMagicValue {
+			return "erofs", nil
+		}
+	}
+
+	// btrfs magic "_BHRfS_M" in the primary superblock at 64KiB
+	btrfsMagic := make([]byte, 8)
+	if _, err := r.ReadAt(btrfsMagic, partOff+btrfsSuperblockOffset+0x40); err == nil {
+		if string(btrfsMagic) == btrfsMagicString {
+			return "btrfs", nil
+		}
+	}
+
 	// ext magic 0xEF53 at offset 1024+56
 	extMagic := make([]byte, 2)
 	if _, err := r.ReadAt(extMagic, partOff+1024+56); err == nil {
@@ -320,6 +344,166 @@ func readSquashfsSuperblock(r io.ReaderAt, partOff int64, out *FilesystemSummary
 	return nil
 }
 
+const (
+	erofsSuperblockOffset = 1024
+	erofsMagicValue       = 0xE0F5E1E2
+)
+
+// readErofsSuperblock reads the erofs superblock and fills in details.
+func readErofsSuperblock(r io.ReaderAt, partOff int64, out *FilesystemSummary) error {
+	sb := make([]byte, 128)
+	if _, err := r.ReadAt(sb, partOff+erofsSuperblockOffset); err != nil && err != io.EOF {
+		return fmt.Errorf("read erofs superblock: %w", err)
+	}
+
+	magic := binary.LittleEndian.Uint32(sb[0x00:0x04])
+	if magic != erofsMagicValue {
+		return fmt.Errorf("erofs magic mismatch: 0x%x", magic)
+	}
+
+	// blkszbits at 0x0c
+	out.BlockSize = uint32(1) << sb[0x0c]
+
+	// uuid at 0x30, 16 bytes
+	out.UUID = formatUUID(sb[0x30:0x40])
+
+	// volume_name at 0x40, 16 bytes (null-terminated)
+	out.Label = strings.TrimRight(string(sb[0x40:0x50]), "\x00 ")
+
+	compat := binary.LittleEndian.Uint32(sb[0x08:0x0c])
+	incompat := binary.LittleEndian.Uint32(sb[0x50:0x54])
+	out.Features = append(out.Features, erofsFeatureStrings(compat, incompat)...)
+
+	// available_compr_algs at 0x54 is only valid with compr_cfgs
+	if incompat&erofsIncompatComprCfgs != 0 {
+		out.Compression = erofsCompressionNames(binary.LittleEndian.Uint16(sb[0x54:0x56]))
+	}
+
+	inodes := binary.LittleEndian.Uint64(sb[0x10:0x18])
+	blocks := binary.LittleEndian.Uint32(sb[0x24:0x28])
+	out.Notes = append(out.Notes, fmt.Sprintf("erofs: blocks=%d inodes=%d", blocks, inodes))
+
+	return nil
+}
+
+const erofsIncompatComprCfgs = 0x0002
+
+// erofsFeatureStrings converts erofs feature flags to human-readable strings.
+// Some incompat bits are shared by features of the same format revision and
+// are named after the first one.
+func erofsFeatureStrings(compat, incompat uint32) []string {
+	feats := make([]string, 0, 8)
+	compatNames := []struct {
+		flag uint32
+		name string
+	}{
+		{0x0001, "sb_chksum"},
+		{0x0002, "mtime"},
+		{0x0004, "xattr_filter"},
+	}
+	for _, n := range compatNames {
+		if compat&n.flag != 0 {
+			feats = append(feats, n.name)
+		}
+	}
+	incompatNames := []struct {
+		flag uint32
+		name string
+	}{
+		{0x0001, "zero_padding"},
+		{erofsIncompatComprCfgs, "compr_cfgs"},
+		{0x0004, "chunked_file"},
+		{0x0008, "device_table"},
+		{0x0010, "ztailpacking"},
+		{0x0020, "fragments"},
+		{0x0040, "xattr_prefixes"},
+	}
+	for _, n := range incompatNames {
+		if incompat&n.flag != 0 {
+			feats = append(feats, n.name)
+		}
+	}
+	return feats
+}
+
+// erofsCompressionNames maps the erofs compression algorithm bitmap to a
+// comma-separated list of names.
+func erofsCompressionNames(algs uint16) string {
+	names := []string{"lz4", "lzma", "deflate", "zstd"}
+	var out []string
+	for i, name := range names {
+		if algs&(1<<i) != 0 {
+			out = append(out, name)
+		}
+	}
+	if len(out) == 0 {
+		return "none"
+	}
+	return strings.Join(out, ",")
+}
+
+const (
+	btrfsSuperblockOffset = 0x10000
+	btrfsMagicString      = "_BHRfS_M"
+)
+
+// readBtrfsSuperblock reads the primary btrfs superblock and fills in details.
+func readBtrfsSuperblock(r io.ReaderAt, partOff int64, out *FilesystemSummary) error {
+	sb := make([]byte, 4096)
+	if _, err := r.ReadAt(sb, partOff+btrfsSuperblockOffset); err != nil && err != io.EOF {
+		return fmt.Errorf("read btrfs superblock: %w", err)
+	}
+
+	if string(sb[0x40:0x48]) != btrfsMagicString {
+		return fmt.Errorf("btrfs magic mismatch: %q", string(sb[0x40:0x48]))
+	}
+
+	// fsid at offset 0x20, 16 bytes
+	out.UUID = formatUUID(sb[0x20:0x30])
+
+	// Label at offset 0x12b, 256 bytes (null-terminated)
+	out.Label = strings.TrimRight(string(sb[0x12b:0x22b]), "\x00 ")
+
+	// sectorsize at 0x90
+	out.BlockSize = binary.LittleEndian.Uint32(sb[0x90:0x94])
+
+	// incompat flags at 0xbc
+	incompat := binary.LittleEndian.Uint64(sb[0xbc:0xc4])
+	out.Features = append(out.Features, btrfsFeatureStrings(incompat)...)
+
+	return nil
+}
+
+// btrfsFeatureStrings converts btrfs incompat feature flags to human-readable strings.
+func btrfsFeatureStrings(incompat uint64) []string {
+	names := []struct {
+		flag uint64
+		name string
+	}{
+		{0x0001, "mixed_backref"},
+		{0x0002, "default_subvol"},
+		{0x0004, "mixed_groups"},
+		{0x0008, "compress_lzo"},
+		{0x0010, "compress_zstd"},
+		{0x0020, "big_metadata"},
+		{0x0040, "extended_iref"},
+		{0x0080, "raid56"},
+		{0x0100, "skinny_metadata"},
+		{0x0200, "no_holes"},
+		{0x0400, "metadata_uuid"},
+		{0x0800, "raid1c34"},
+		{0x1000, "zoned"},
+		{0x2000, "extent_tree_v2"},
+	}
+	feats := make([]string, 0, len(names))
+	for _, n := range names {
+		if incompat&n.flag != 0 {
+			feats = append(feats, n.name)
+		}
+	}
+	return feats
+}
+
 // isESPPartition determines if a partition is an EFI System Partition (ESP).
 func isESPPartition(p PartitionSummary) bool {
 	return strings.EqualFold(p.Type, "C12A7328-F81F-11D2-BA4B-00A0C93EC93B") || // GPT ESP
@@ -154,7 +154,10 @@ func scanAndHashEFIFromRawFAT(r io.ReaderAt, partOff int64, out *FilesystemSumma
 			// Try to extract config files
 			efi.BootConfig = extractBootloaderConfigFromFAT(v, efi.Kind)
 			// For systemd-boot on UKI systems, also synthesize boot config from UKI
-			if efi.Kind == BootloaderSystemdBoot && out.HasUKI && efi.BootConfig != nil && len(efi.BootConfig.ConfigFiles) == 0 {
+			if efi.Kind == BootloaderSystemdBoot && out.HasUKI && efi.BootConfig != nil && len(efi.BootConfig.ConfigFiles) > 0 {
+				// Every UKI in EFI/Linux is an entry of the loader.conf menu
+				addUKIBootEntries(efi.BootConfig, out.EFIBinaries)
+			} else if efi.Kind == BootloaderSystemdBoot && out.HasUKI && efi.BootConfig != nil && len(efi.BootConfig.ConfigFiles) == 0 {
 				// No loader.conf found on UKI system; synthesize from UKI cmdline
 				for _, uki := range out.EFIBinaries {
 					if uki.IsUKI && uki.Cmdline != "" {
@@ -282,10 +285,12 @@ func extractBootloaderConfigFromFAT(v *fatVol, kind BootloaderKind) *BootloaderC
 				cfg.Notes = append(cfg.Notes, parsed.Notes...)
 				// Don't overwrite ConfigRaw since we set it above
 				cfg.DefaultEntry = parsed.DefaultEntry
+				cfg.Timeout = parsed.Timeout
 			case BootloaderSystemdBoot:
 				parsed := parseSystemdBootEntries(content)
 				cfg.BootEntries = parsed.BootEntries
 				cfg.DefaultEntry = parsed.DefaultEntry
+				cfg.Timeout = parsed.Timeout
 				cfg.UUIDReferences = parsed.UUIDReferences
 				cfg.Notes = append(cfg.Notes, parsed.Notes...)
 			}
@@ -317,6 +322,7 @@ func extractBootloaderConfigFromFAT(v *fatVol, kind BootloaderKind) *BootloaderC
 			cfg.UUIDReferences = parsed.UUIDReferences
 			cfg.Notes = append(cfg.Notes, parsed.Notes...)
 			cfg.DefaultEntry = parsed.DefaultEntry
+			cfg.Timeout = parsed.Timeout
 		}
 	}
 
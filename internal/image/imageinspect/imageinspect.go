@@ -2,6 +2,7 @@ package imageinspect
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -47,15 +48,26 @@ type PartitionTableSummary struct {
 	LogicalSectorSize  int64
 	PhysicalSectorSize int64
 	ProtectiveMBR      bool
+	HybridMBR          []MBREntrySummary `json:"hybridMbr,omitempty" yaml:"hybridMbr,omitempty"` // non-0xEE entries next to a GPT
 	Partitions         []PartitionSummary
 
 	LargestFreeSpan      *FreeSpanSummary `json:"largestFreeSpan,omitempty" yaml:"largestFreeSpan,omitempty"`
 	MisalignedPartitions []int            `json:"misalignedPartitions,omitempty" yaml:"misalignedPartitions,omitempty"`
 }
 
+// MBREntrySummary is an entry of the MBR in front of a GPT other than the
+// protective 0xEE one, as written by hybrid MBR layouts for legacy BIOS boot.
+type MBREntrySummary struct {
+	Type     string `json:"type" yaml:"type"`
+	StartLBA uint64 `json:"startLba" yaml:"startLba"`
+	EndLBA   uint64 `json:"endLba" yaml:"endLba"`
+	Bootable bool   `json:"bootable,omitempty" yaml:"bootable,omitempty"`
+}
+
 // SBOMSummary holds information about the Software Bill of Materials (SBOM) if available.
 type SBOMSummary struct {
 	Present         bool     `json:"present,omitempty" yaml:"present,omitempty"`
+	Location        string   `json:"location,omitempty" yaml:"location,omitempty"` // from the SBOM pointer: rootfs, esp, partition, uki
 	Path            string   `json:"path,omitempty" yaml:"path,omitempty"`
 	FileName        string   `json:"fileName,omitempty" yaml:"fileName,omitempty"`
 	Format          string   `json:"format,omitempty" yaml:"format,omitempty"` // e.g., "spdx", "cyclonedx"
@@ -89,7 +101,13 @@ type PartitionSummary struct {
 	AttrRaw                uint64 `json:"attrRaw,omitempty" yaml:"attrRaw,omitempty"`
 	AttrRequired           bool   `json:"attrRequired,omitempty" yaml:"attrRequired,omitempty"`
 	AttrLegacyBIOSBootable bool   `json:"attrLegacyBiosBootable,omitempty" yaml:"attrLegacyBiosBootable,omitempty"`
+	AttrNoBlockIO          bool   `json:"attrNoBlockIo,omitempty" yaml:"attrNoBlockIo,omitempty"`
 	AttrReadOnly           bool   `json:"attrReadOnly,omitempty" yaml:"attrReadOnly,omitempty"`
+	AttrGrowFS             bool   `json:"attrGrowFs,omitempty" yaml:"attrGrowFs,omitempty"`
+	AttrNoAutomount        bool   `json:"attrNoAutomount,omitempty" yaml:"attrNoAutomount,omitempty"`
+	AttrPriority           int    `json:"attrPriority,omitempty" yaml:"attrPriority,omitempty"`             // A/B boot priority, bits 48-51
+	AttrTriesRemaining     int    `json:"attrTriesRemaining,omitempty" yaml:"attrTriesRemaining,omitempty"` // A/B boot tries, bits 52-55
+	AttrSuccessful         bool   `json:"attrSuccessful,omitempty" yaml:"attrSuccessful,omitempty"`         // A/B boot successful, bit 56
 
 	// Needed for raw reads:
 	LogicalSectorSize int                `json:"logicalSectorSize,omitempty" yaml:"logicalSectorSize,omitempty"`
@@ -114,7 +132,7 @@ type FilesystemSummary struct {
 	SectorsPerCluster uint8  `json:"sectorsPerCluster,omitempty" yaml:"sectorsPerCluster,omitempty"`
 	ClusterCount      uint32 `json:"clusterCount,omitempty" yaml:"clusterCount,omitempty"`
 
-	// Squashfs-specific
+	// Squashfs- and erofs-specific
 	Compression string   `json:"compression,omitempty" yaml:"compression,omitempty"`
 	Version     string   `json:"version,omitempty" yaml:"version,omitempty"`
 	FsFlags     []string `json:"fsFlags,omitempty" yaml:"fsFlags,omitempty"`
@@ -165,12 +183,25 @@ type EFIBinaryEvidence struct {
 	OSRelSHA256   string            `json:"osrelSha256,omitempty" yaml:"osrelSha256,omitempty"`
 	UnameSHA256   string            `json:"unameSha256,omitempty" yaml:"unameSha256,omitempty"`
 
+	// Signed PCR policy of the UKI (.pcrsig) and the key verifying it (.pcrpkey)
+	PCRPublicKeyFingerprint string         `json:"pcrPublicKeyFingerprint,omitempty" yaml:"pcrPublicKeyFingerprint,omitempty"`
+	PCRSignatures           []PCRSignature `json:"pcrSignatures,omitempty" yaml:"pcrSignatures,omitempty"`
+
 	// Bootloader configuration (for GRUB, systemd-boot, etc.)
 	BootConfig *BootloaderConfig `json:"bootConfig,omitempty" yaml:"bootConfig,omitempty"`
 
 	Notes []string `json:"notes,omitempty" yaml:"notes,omitempty"`
 }
 
+// PCRSignature is a PCR policy signature of the .pcrsig section of a UKI.
+type PCRSignature struct {
+	Bank                 string `json:"bank" yaml:"bank"`
+	PCRs                 []int  `json:"pcrs" yaml:"pcrs"`
+	PublicKeyFingerprint string `json:"publicKeyFingerprint" yaml:"publicKeyFingerprint"` // SHA256 of the DER public key signing the policy
+	Policy               string `json:"policy" yaml:"policy"`                             // TPM2 policy digest of the PCR values
+	SignatureSize        int    `json:"signatureSize" yaml:"signatureSize"`
+}
+
 // BootloaderKind represents the kind of bootloader detected in an EFI binary.
 type BootloaderKind string
 
@@ -203,6 +234,9 @@ type BootloaderConfig struct {
 	// Default boot target/entry
 	DefaultEntry string `json:"defaultEntry,omitempty" yaml:"defaultEntry,omitempty"`
 
+	// Boot menu timeout as configured (seconds, or a mode like menu-force)
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
 	// Configuration issues detected during parsing
 	Notes []string `json:"notes,omitempty" yaml:"notes,omitempty"`
 }
@@ -218,6 +252,7 @@ type KernelReference struct {
 // BootEntry represents a single boot entry (GRUB menu item, systemd-boot entry, etc.).
 type BootEntry struct {
 	Name          string `json:"name" yaml:"name"`                                       // Entry name/title
+	ID            string `json:"id,omitempty" yaml:"id,omitempty"`                       // GRUB menu entry ID or UKI file name
 	Kernel        string `json:"kernel" yaml:"kernel"`                                   // Kernel path
 	Initrd        string `json:"initrd,omitempty" yaml:"initrd,omitempty"`               // Initrd path
 	Cmdline       string `json:"cmdline,omitempty" yaml:"cmdline,omitempty"`             // Kernel cmdline
@@ -374,6 +409,11 @@ func (d *DiskfsInspector) inspectCore(
 	if err != nil {
 		return nil, err
 	}
+	if ptSummary.Type == "gpt" && !ptSummary.ProtectiveMBR {
+		if ptSummary.HybridMBR, err = readHybridMBR(img); err != nil {
+			return nil, err
+		}
+	}
 
 	partitionsWithFS, err := InspectFileSystemsFromHandles(img, disk, ptSummary)
 	if err != nil {
@@ -381,6 +421,9 @@ func (d *DiskfsInspector) inspectCore(
 	}
 	ptSummary.Partitions = partitionsWithFS
 
+	// Follow GRUB stub configs on the ESP to the menu on the boot filesystem
+	resolveExternalGrubConfigs(&ptSummary, diskfsPartitionFileReader(disk, ptSummary))
+
 	// Detect dm-verity configuration
 	verityInfo := detectVerity(ptSummary)
 
@@ -408,6 +451,50 @@ func (d *DiskfsInspector) inspectCore(
 	}, nil
 }
 
+// decodeGPTAttributes sets the decoded attribute fields of p from the GPT
+// attribute field attrs.
+func decodeGPTAttributes(p *PartitionSummary, attrs uint64) {
+	bit := func(n int) bool { return attrs&(1<<n) != 0 }
+	p.AttrRequired = bit(config.GPTAttrRequired)
+	p.AttrNoBlockIO = bit(config.GPTAttrNoBlockIO)
+	p.AttrLegacyBIOSBootable = bit(config.GPTAttrLegacyBIOSBootable)
+	p.AttrReadOnly = bit(config.GPTAttrReadOnly)
+	p.AttrGrowFS = bit(config.GPTAttrGrowFS)
+	p.AttrNoAutomount = bit(config.GPTAttrNoAutomount)
+	p.AttrPriority = int((attrs >> config.GPTAttrPriorityShift) & 0xf)
+	p.AttrTriesRemaining = int((attrs >> config.GPTAttrTriesShift) & 0xf)
+	p.AttrSuccessful = bit(config.GPTAttrSuccessful)
+}
+
+// readHybridMBR returns the MBR entries in front of a GPT other than the
+// protective one. A plain protective MBR has none.
+func readHybridMBR(img io.ReaderAt) ([]MBREntrySummary, error) {
+	sector := make([]byte, 512)
+	if _, err := img.ReadAt(sector, 0); err != nil {
+		return nil, fmt.Errorf("read MBR: %w", err)
+	}
+	if sector[510] != 0x55 || sector[511] != 0xaa {
+		return nil, nil
+	}
+	var entries []MBREntrySummary
+	for i := 0; i < 4; i++ {
+		e := sector[446+i*16 : 446+(i+1)*16]
+		partType := e[4]
+		sectors := binary.LittleEndian.Uint32(e[12:16])
+		if partType == 0 || partType == 0xee || sectors == 0 {
+			continue
+		}
+		start := uint64(binary.LittleEndian.Uint32(e[8:12]))
+		entries = append(entries, MBREntrySummary{
+			Type:     fmt.Sprintf("0x%02x", partType),
+			StartLBA: start,
+			EndLBA:   start + uint64(sectors) - 1,
+			Bootable: e[0] == 0x80,
+		})
+	}
+	return entries, nil
+}
+
 // summarizePartitionTable creates a PartitionTableSummary from a diskfs partition.Table.
 func summarizePartitionTable(pt partition.Table, logicalBlockSize int64, totalSizeBytes int64) (PartitionTableSummary, error) {
 	ptSummary := PartitionTableSummary{
@@ -436,14 +523,10 @@ func summarizePartitionTable(pt partition.Table, logicalBlockSize int64, totalSi
 				StartLBA:  p.Start,
 				EndLBA:    p.End,
 				SizeBytes: sizeBytes,
-				Flags:     fmt.Sprintf("%v", p.Attributes),
+				Flags:     strings.Join(config.GPTAttributeNamesOf(p.Attributes), ","),
 				AttrRaw:   p.Attributes,
 			})
-
-			last := &ptSummary.Partitions[len(ptSummary.Partitions)-1]
-			last.AttrRequired = (p.Attributes & 0x1) != 0
-			last.AttrLegacyBIOSBootable = (p.Attributes & (1 << 2)) != 0
-			last.AttrReadOnly = (p.Attributes & (1 << 60)) != 0
+			decodeGPTAttributes(&ptSummary.Partitions[len(ptSummary.Partitions)-1], p.Attributes)
 		}
 
 		sort.Slice(ptSummary.Partitions, func(i, j int) bool {
@@ -240,6 +240,61 @@ func TestSummarizePartitionTable_GPT(t *testing.T) {
 	}
 }
 
+func TestSummarizePartitionTable_GPTAttributes(t *testing.T) {
+	attrs := uint64(1)<<0 | 1<<2 | 1<<59 | 1<<63 | 15<<48 | 3<<52 | 1<<56 | 1<<62
+	pt := &gpt.Table{
+		LogicalSectorSize: 512,
+		ProtectiveMBR:     true,
+		Partitions: []*gpt.Partition{
+			{Start: 2048, End: 4095, Name: "A", Attributes: attrs},
+		},
+	}
+	sum, err := summarizePartitionTable(pt, 512, 8<<20)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	p := sum.Partitions[0]
+	if p.Flags != "required,legacy-bios-bootable,priority=15,tries=3,successful,grow-fs,bit62,no-automount" {
+		t.Fatalf("Flags=%q", p.Flags)
+	}
+	if !p.AttrRequired || !p.AttrLegacyBIOSBootable || !p.AttrGrowFS || !p.AttrNoAutomount || p.AttrNoBlockIO || p.AttrReadOnly {
+		t.Fatalf("unexpected decoded bits %#v", p)
+	}
+	if p.AttrPriority != 15 || p.AttrTriesRemaining != 3 || !p.AttrSuccessful || p.AttrRaw != attrs {
+		t.Fatalf("unexpected A/B fields %#v", p)
+	}
+}
+
+func TestReadHybridMBR(t *testing.T) {
+	sector := make([]byte, 512)
+	entry := func(i int, status, partType byte, start, size uint32) {
+		e := sector[446+i*16:]
+		e[0], e[4] = status, partType
+		binary.LittleEndian.PutUint32(e[8:12], start)
+		binary.LittleEndian.PutUint32(e[12:16], size)
+	}
+	entry(0, 0, 0xee, 1, 2047)
+	entry(1, 0x80, 0xef, 2048, 2048)
+	sector[510], sector[511] = 0x55, 0xaa
+
+	entries, err := readHybridMBR(bytes.NewReader(sector))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(entries) != 1 || entries[0] != (MBREntrySummary{Type: "0xef", StartLBA: 2048, EndLBA: 4095, Bootable: true}) {
+		t.Fatalf("unexpected entries %#v", entries)
+	}
+	if got := hybridMBRString(entries); got != "0xef*@2048-4095" {
+		t.Fatalf("hybridMBRString=%q", got)
+	}
+
+	// Without the boot signature there is no MBR
+	sector[510] = 0
+	if entries, err := readHybridMBR(bytes.NewReader(sector)); err != nil || entries != nil {
+		t.Fatalf("expected no entries, got %#v (%v)", entries, err)
+	}
+}
+
 func TestSummarizePartitionTable_MBR(t *testing.T) {
 	pt := &mbr.Table{
 		PhysicalSectorSize: 4096,
@@ -496,6 +551,109 @@ func TestReadExtSuperblock_BadMagic(t *testing.T) {
 	}
 }
 
+func TestSniffFilesystemType_Btrfs(t *testing.T) {
+	buf := make([]byte, btrfsSuperblockOffset+4096)
+	copy(buf[btrfsSuperblockOffset+0x40:], btrfsMagicString)
+	r := sliceReaderAt{b: buf}
+
+	got, err := sniffFilesystemType(r, 0)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got != "btrfs" {
+		t.Fatalf("got=%q", got)
+	}
+}
+
+func TestReadBtrfsSuperblock_Success(t *testing.T) {
+	img := newBuf(btrfsSuperblockOffset + 4096)
+	sb := img[btrfsSuperblockOffset:]
+	copy(sb[0x20:0x30], []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef})
+	copy(sb[0x40:], btrfsMagicString)
+	binary.LittleEndian.PutUint32(sb[0x90:0x94], 4096)
+	binary.LittleEndian.PutUint64(sb[0xbc:0xc4], 0x0002|0x0010|0x0200) // default_subvol, compress_zstd, no_holes
+	copy(sb[0x12b:], "rootfs")
+
+	var out FilesystemSummary
+	if err := readBtrfsSuperblock(memReaderAt{img}, 0, &out); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.UUID != "01234567-89ab-cdef-0123-456789abcdef" {
+		t.Fatalf("UUID=%q", out.UUID)
+	}
+	if out.Label != "rootfs" {
+		t.Fatalf("Label=%q", out.Label)
+	}
+	if out.BlockSize != 4096 {
+		t.Fatalf("BlockSize=%d", out.BlockSize)
+	}
+	if strings.Join(out.Features, ",") != "default_subvol,compress_zstd,no_holes" {
+		t.Fatalf("Features=%v", out.Features)
+	}
+}
+
+func TestReadBtrfsSuperblock_BadMagic(t *testing.T) {
+	var out FilesystemSummary
+	if err := readBtrfsSuperblock(memReaderAt{newBuf(btrfsSuperblockOffset + 4096)}, 0, &out); err == nil {
+		t.Fatalf("expected magic mismatch error")
+	}
+}
+
+func TestSniffFilesystemType_Erofs(t *testing.T) {
+	buf := make([]byte, 8192)
+	binary.LittleEndian.PutUint32(buf[erofsSuperblockOffset:], erofsMagicValue)
+	r := sliceReaderAt{b: buf}
+
+	got, err := sniffFilesystemType(r, 0)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got != "erofs" {
+		t.Fatalf("got=%q", got)
+	}
+}
+
+func TestReadErofsSuperblock_Success(t *testing.T) {
+	img := newBuf(4096)
+	sb := img[erofsSuperblockOffset:]
+	binary.LittleEndian.PutUint32(sb[0x00:0x04], erofsMagicValue)
+	binary.LittleEndian.PutUint32(sb[0x08:0x0c], 0x0001|0x0002) // sb_chksum, mtime
+	sb[0x0c] = 12
+	binary.LittleEndian.PutUint64(sb[0x10:0x18], 1500)
+	binary.LittleEndian.PutUint32(sb[0x24:0x28], 20000)
+	copy(sb[0x30:0x40], []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef})
+	copy(sb[0x40:], "rootfs")
+	binary.LittleEndian.PutUint32(sb[0x50:0x54], 0x0001|erofsIncompatComprCfgs|0x0010) // zero_padding, compr_cfgs, ztailpacking
+	binary.LittleEndian.PutUint16(sb[0x54:0x56], 0x0001|0x0002)                        // lz4, lzma
+
+	var out FilesystemSummary
+	if err := readErofsSuperblock(memReaderAt{img}, 0, &out); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.UUID != "01234567-89ab-cdef-0123-456789abcdef" {
+		t.Fatalf("UUID=%q", out.UUID)
+	}
+	if out.Label != "rootfs" {
+		t.Fatalf("Label=%q", out.Label)
+	}
+	if out.BlockSize != 4096 {
+		t.Fatalf("BlockSize=%d", out.BlockSize)
+	}
+	if strings.Join(out.Features, ",") != "sb_chksum,mtime,zero_padding,compr_cfgs,ztailpacking" {
+		t.Fatalf("Features=%v", out.Features)
+	}
+	if out.Compression != "lz4,lzma" {
+		t.Fatalf("Compression=%q", out.Compression)
+	}
+}
+
+func TestReadErofsSuperblock_BadMagic(t *testing.T) {
+	var out FilesystemSummary
+	if err := readErofsSuperblock(memReaderAt{newBuf(4096)}, 0, &out); err == nil {
+		t.Fatalf("expected magic mismatch error")
+	}
+}
+
 func TestReadSquashfsSuperblock_Success(t *testing.T) {
 	img := newBuf(4096)
 	sb := img[:96]
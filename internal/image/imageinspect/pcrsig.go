@@ -0,0 +1,61 @@
+package imageinspect
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sort"
+)
+
+// pcrSignatureEntry is an entry of the .pcrsig JSON written by
+// systemd-measure, keyed by PCR bank
+type pcrSignatureEntry struct {
+	PCRs   []int  `json:"pcrs"`
+	PKFP   string `json:"pkfp"`
+	Policy string `json:"pol"`
+	Sig    string `json:"sig"`
+}
+
+// parsePCRSignatures parses the .pcrsig section of a UKI, sorted by bank
+func parsePCRSignatures(data []byte) ([]PCRSignature, error) {
+	var banks map[string][]pcrSignatureEntry
+	if err := json.Unmarshal(bytes.TrimRight(data, "\x00"), &banks); err != nil {
+		return nil, fmt.Errorf("invalid PCR signature JSON: %w", err)
+	}
+
+	var sigs []PCRSignature
+	for bank, entries := range banks {
+		for _, entry := range entries {
+			sig, err := base64.StdEncoding.DecodeString(entry.Sig)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s PCR signature: %w", bank, err)
+			}
+			sigs = append(sigs, PCRSignature{
+				Bank:                 bank,
+				PCRs:                 entry.PCRs,
+				PublicKeyFingerprint: entry.PKFP,
+				Policy:               entry.Policy,
+				SignatureSize:        len(sig),
+			})
+		}
+	}
+	sort.SliceStable(sigs, func(i, j int) bool {
+		if sigs[i].Bank != sigs[j].Bank {
+			return sigs[i].Bank < sigs[j].Bank
+		}
+		return sigs[i].Policy < sigs[j].Policy
+	})
+	return sigs, nil
+}
+
+// publicKeyFingerprint returns the SHA256 of the DER encoding of the PEM
+// public key in data, the fingerprint the .pcrsig entries refer to
+func publicKeyFingerprint(data []byte) (string, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", fmt.Errorf("no PEM public key found")
+	}
+	return hashBytesHex(block.Bytes), nil
+}
@@ -0,0 +1,98 @@
+package imageinspect
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+const testPCRSig = `{"sha256":[{"pcrs":[11],"pkfp":"6c2bd3a1e0f2","pol":"9a1f0c4b7d5e8f3a2b1c","sig":"AAECAwQ="}],` +
+	`"sha1":[{"pcrs":[11],"pkfp":"6c2bd3a1e0f2","pol":"1b2c3d4e5f6a7b8c9d0e","sig":"AAE="}]}` + "\x00\x00"
+
+func TestParsePCRSignatures(t *testing.T) {
+	sigs, err := parsePCRSignatures([]byte(testPCRSig))
+	if err != nil {
+		t.Fatalf("parsePCRSignatures failed: %v", err)
+	}
+	if len(sigs) != 2 || sigs[0].Bank != "sha1" || sigs[1].Bank != "sha256" {
+		t.Fatalf("unexpected signatures %+v", sigs)
+	}
+	if sigs[1].SignatureSize != 5 || sigs[1].Policy != "9a1f0c4b7d5e8f3a2b1c" || len(sigs[1].PCRs) != 1 || sigs[1].PCRs[0] != 11 {
+		t.Errorf("unexpected sha256 signature %+v", sigs[1])
+	}
+
+	for _, invalid := range []string{"not json", `{"sha256":[{"pcrs":[11],"sig":"%%%"}]}`} {
+		if _, err := parsePCRSignatures([]byte(invalid)); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParsePEFromBytes_PCRSignature(t *testing.T) {
+	ev, err := ParsePEFromBytes("EFI/Linux/linux.efi", minimalPEWithSection(".pcrsig", []byte(testPCRSig)))
+	if err != nil {
+		t.Fatalf("ParsePEFromBytes failed: %v", err)
+	}
+	if len(ev.PCRSignatures) != 2 {
+		t.Errorf("expected the PCR signatures of the .pcrsig section, got %+v", ev.PCRSignatures)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err = ParsePEFromBytes("EFI/Linux/linux.efi", minimalPEWithSection(".pcrpkey", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	if err != nil {
+		t.Fatalf("ParsePEFromBytes failed: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	if ev.PCRPublicKeyFingerprint != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected PCR public key fingerprint %s", ev.PCRPublicKeyFingerprint)
+	}
+
+	ev, err = ParsePEFromBytes("EFI/Linux/linux.efi", minimalPEWithSection(".pcrsig", []byte("garbage")))
+	if err != nil {
+		t.Fatalf("ParsePEFromBytes failed: %v", err)
+	}
+	if len(ev.PCRSignatures) != 0 || len(ev.Notes) == 0 {
+		t.Errorf("expected a note for an invalid .pcrsig section, got %+v", ev.Notes)
+	}
+}
+
+func TestRenderUKIDetailsBlock_PCRSignature(t *testing.T) {
+	uki := EFIBinaryEvidence{
+		Kind:                    BootloaderUKI,
+		IsUKI:                   true,
+		Path:                    "EFI/Linux/linux.efi",
+		PCRPublicKeyFingerprint: "6c2bd3a1e0f2aa",
+		PCRSignatures: []PCRSignature{
+			{Bank: "sha256", PCRs: []int{11}, PublicKeyFingerprint: "6c2bd3a1e0f2aa", Policy: "9a1f0c4b7d5e8f3a2b1c"},
+			{Bank: "sha384", PCRs: []int{11, 15}, PublicKeyFingerprint: "ffffffffffffff", Policy: "1b2c3d4e5f6a7b8c9d0e"},
+		},
+	}
+	var buf bytes.Buffer
+	renderUKIDetailsBlock(&buf, uki)
+	output := buf.String()
+
+	for _, want := range []string{
+		"PCR public key:",
+		"6c2bd3a1e0f2aa",
+		"sha256 PCRs 11 policy 9a1f0c4b7d5e key 6c2bd3a1e0f2\n",
+		"sha384 PCRs 11,15 policy 1b2c3d4e5f6a key ffffffffffff (not the PCR public key)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+}
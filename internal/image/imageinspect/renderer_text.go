@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 )
@@ -87,6 +88,9 @@ func RenderCompareText(w io.Writer, r *ImageCompareResult, opts CompareTextOptio
 		if pt.ProtectiveMBR != nil {
 			fmt.Fprintf(w, "  ProtectiveMBR: %v -> %v\n", pt.ProtectiveMBR.From, pt.ProtectiveMBR.To)
 		}
+		if pt.HybridMBR != nil {
+			fmt.Fprintf(w, "  HybridMBR: %s -> %s\n", hybridMBRString(pt.HybridMBR.From), hybridMBRString(pt.HybridMBR.To))
+		}
 		if pt.LargestFreeSpan != nil {
 			fmt.Fprintf(w, "  Largest free span: %s -> %s\n", freeSpanString(&pt.LargestFreeSpan.From), freeSpanString(&pt.LargestFreeSpan.To))
 		}
@@ -608,8 +612,8 @@ func renderPartitionFilesystemDetails(w io.Writer, p PartitionSummary) {
 		}
 	}
 
-	// Squashfs-specific
-	if strings.EqualFold(fs.Type, "squashfs") {
+	// Squashfs- and erofs-specific
+	if strings.EqualFold(fs.Type, "squashfs") || strings.EqualFold(fs.Type, "erofs") {
 		fmt.Fprintln(w)
 		kv3 := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
 		if fs.Compression != "" {
@@ -652,6 +656,9 @@ func renderPartitionTableHeader(w io.Writer, pt PartitionTableSummary) {
 	if strings.EqualFold(pt.Type, "gpt") {
 		fmt.Fprintf(tw, "Protective MBR:\t%t\n", pt.ProtectiveMBR)
 	}
+	if len(pt.HybridMBR) > 0 {
+		fmt.Fprintf(tw, "Hybrid MBR:\t%s\n", hybridMBRString(pt.HybridMBR))
+	}
 	if pt.LargestFreeSpan != nil {
 		fmt.Fprintf(tw, "Largest free span:\t%s\n", freeSpanString(pt.LargestFreeSpan))
 	}
@@ -775,6 +782,17 @@ func renderUKIDetailsBlock(w io.Writer, uki EFIBinaryEvidence) {
 	if uki.InitrdSHA256 != "" {
 		fmt.Fprintf(kv2, "Initrd SHA256:\t%s\n", uki.InitrdSHA256)
 	}
+	if uki.PCRPublicKeyFingerprint != "" {
+		fmt.Fprintf(kv2, "PCR public key:\t%s\n", uki.PCRPublicKeyFingerprint)
+	}
+	for _, sig := range uki.PCRSignatures {
+		key := shortHash(sig.PublicKeyFingerprint)
+		if uki.PCRPublicKeyFingerprint != "" && sig.PublicKeyFingerprint != uki.PCRPublicKeyFingerprint {
+			key += " (not the PCR public key)"
+		}
+		fmt.Fprintf(kv2, "PCR signature:\t%s PCRs %s policy %s key %s\n",
+			sig.Bank, formatPCRList(sig.PCRs), shortHash(sig.Policy), key)
+	}
 	if len(uki.OSReleaseSorted) > 0 {
 		_ = kv2.Flush()
 
@@ -792,6 +810,15 @@ func renderUKIDetailsBlock(w io.Writer, uki EFIBinaryEvidence) {
 	}
 }
 
+// formatPCRList formats PCR indexes as a comma separated list
+func formatPCRList(pcrs []int) string {
+	parts := make([]string, len(pcrs))
+	for i, pcr := range pcrs {
+		parts[i] = strconv.Itoa(pcr)
+	}
+	return strings.Join(parts, ",")
+}
+
 // renderEqualityReasonsBlock prints the equality reasons.
 func renderEqualityReasonsBlock(w io.Writer, r *ImageCompareResult) {
 	if r == nil {
@@ -881,6 +908,9 @@ func renderBootloaderConfigDetails(w io.Writer, efiPath string, cfg *BootloaderC
 				mark = "*"
 			}
 			fmt.Fprintf(w, "  %s [%d] %s\n", mark, i+1, entry.Name)
+			if entry.ID != "" {
+				fmt.Fprintf(w, "       id:     %s\n", entry.ID)
+			}
 			if entry.Kernel != "" {
 				fmt.Fprintf(w, "       kernel: %s\n", entry.Kernel)
 			}
@@ -901,6 +931,9 @@ func renderBootloaderConfigDetails(w io.Writer, efiPath string, cfg *BootloaderC
 		if cfg.DefaultEntry != "" {
 			fmt.Fprintf(w, "  Default: %s\n", cfg.DefaultEntry)
 		}
+		if cfg.Timeout != "" {
+			fmt.Fprintf(w, "  Timeout: %s\n", cfg.Timeout)
+		}
 	}
 
 	// Display kernel references
@@ -972,6 +1005,13 @@ func renderBootloaderConfigDiffText(w io.Writer, diff *BootloaderConfigDiff, ind
 		}
 	}
 
+	if diff.DefaultEntry != nil {
+		fmt.Fprintf(w, "%sDefault entry: %s -> %s\n", indent, emptyOr(diff.DefaultEntry.From, "(none)"), emptyOr(diff.DefaultEntry.To, "(none)"))
+	}
+	if diff.Timeout != nil {
+		fmt.Fprintf(w, "%sTimeout: %s -> %s\n", indent, emptyOr(diff.Timeout.From, "(none)"), emptyOr(diff.Timeout.To, "(none)"))
+	}
+
 	// Boot entry changes
 	if len(diff.BootEntryChanges) > 0 {
 		fmt.Fprintf(w, "%sBoot entries:\n", indent)
@@ -1145,10 +1185,12 @@ func partitionRole(p PartitionSummary) string {
 		switch strings.ToLower(p.Filesystem.Type) {
 		case "vfat":
 			return "ESP?"
-		case "ext4":
+		case "ext4", "btrfs":
 			return "FS"
 		case "squashfs":
 			return "SQUASHFS"
+		case "erofs":
+			return "EROFS"
 		}
 	}
 	return "-"
@@ -1300,3 +1342,20 @@ func renderImagesBlock(w io.Writer, from, to ImageSummary) {
 		fmt.Fprintf(w, "        SHA256: %s\n", to.SHA256)
 	}
 }
+
+// hybridMBRString formats the hybrid MBR entries as type@start-end, with a
+// '*' for the active entry.
+func hybridMBRString(entries []MBREntrySummary) string {
+	if len(entries) == 0 {
+		return "(none)"
+	}
+	parts := make([]string, 0, len(entries))
+	for _, e := range entries {
+		active := ""
+		if e.Bootable {
+			active = "*"
+		}
+		parts = append(parts, fmt.Sprintf("%s%s@%d-%d", e.Type, active, e.StartLBA, e.EndLBA))
+	}
+	return strings.Join(parts, ", ")
+}
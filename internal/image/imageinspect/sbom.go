@@ -1,7 +1,9 @@
 package imageinspect
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"debug/pe"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -14,6 +16,153 @@ import (
 	"github.com/open-edge-platform/os-image-composer/internal/config/manifest"
 )
 
+// partitionFileReader reads a file from the filesystem of pt.Partitions[index].
+type partitionFileReader func(index int, filePath string) ([]byte, error)
+
+// rawPartitionFileReader reads partition files straight from the image bytes.
+func rawPartitionFileReader(img io.ReaderAt, pt PartitionTableSummary) partitionFileReader {
+	return func(index int, filePath string) ([]byte, error) {
+		partitionSummary := pt.Partitions[index]
+		fsType := ""
+		if partitionSummary.Filesystem != nil {
+			fsType = strings.ToLower(strings.TrimSpace(partitionSummary.Filesystem.Type))
+		}
+		return readFileFromRawPartition(img, partitionStartOffset(pt, partitionSummary), partitionSummary.SizeBytes, fsType, filePath)
+	}
+}
+
+// diskfsPartitionFileReader reads partition files through go-diskfs.
+func diskfsPartitionFileReader(disk diskAccessorFS, pt PartitionTableSummary) partitionFileReader {
+	return func(index int, filePath string) ([]byte, error) {
+		partitionNumber, ok := diskfsPartitionNumberForSummary(disk, pt.Partitions[index])
+		if !ok {
+			return nil, fmt.Errorf("partition %d not found in disk partition table", pt.Partitions[index].Index)
+		}
+		filesystemHandle, err := disk.GetFilesystem(partitionNumber)
+		if err != nil || filesystemHandle == nil {
+			return nil, fmt.Errorf("open filesystem on partition %d: %v", pt.Partitions[index].Index, err)
+		}
+		f, err := filesystemHandle.OpenFile(filePath, os.O_RDONLY)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+}
+
+// inspectSBOMFromPointer locates the SBOM through the pointer file the
+// builder writes to the root filesystem. found is false when none of the root
+// partition candidates carries a pointer file.
+func inspectSBOMFromPointer(pt PartitionTableSummary, readFile partitionFileReader) (summary SBOMSummary, found bool) {
+	summary = SBOMSummary{Format: "spdx"}
+
+	for _, candidateIndex := range rankRootPartitionCandidates(pt) {
+		pointerData, err := readFile(candidateIndex, manifest.SBOMPointerPath)
+		if err != nil {
+			continue
+		}
+
+		pointer, err := manifest.ParseSBOMPointer(pointerData)
+		if err != nil {
+			summary.Notes = append(summary.Notes, fmt.Sprintf("invalid SBOM pointer %s: %v", manifest.SBOMPointerPath, err))
+			return summary, true
+		}
+		summary.Location = pointer.Location
+		summary.Path = pointer.Path
+		summary.FileName = pointer.FileName
+		if pointer.Format != "" {
+			summary.Format = pointer.Format
+		}
+
+		sbomData, err := readSBOMAtPointer(pt, candidateIndex, pointer, readFile)
+		if err != nil {
+			summary.Notes = append(summary.Notes, fmt.Sprintf("SBOM pointer references %s (%s) but it could not be read: %v",
+				pointer.Path, pointer.Location, err))
+			return summary, true
+		}
+
+		summary.Present = true
+		summary.SizeBytes = int64(len(sbomData))
+		summary.SHA256 = sha256Hex(sbomData)
+		summary.Content = append([]byte(nil), sbomData...)
+		if pointer.SHA256 != "" && pointer.SHA256 != summary.SHA256 {
+			summary.Notes = append(summary.Notes, "SBOM content does not match the checksum recorded in the SBOM pointer")
+		}
+
+		canonicalSHA, pkgCount, canonicalErr := canonicalSPDXSHA256(sbomData)
+		if canonicalErr != nil {
+			summary.Notes = append(summary.Notes, "SBOM SPDX parse failed; compare falls back to raw hash")
+			return summary, true
+		}
+		summary.CanonicalSHA256 = canonicalSHA
+		summary.PackageCount = pkgCount
+		return summary, true
+	}
+
+	return summary, false
+}
+
+// readSBOMAtPointer reads the SBOM the pointer found on pt.Partitions[rootIndex] refers to.
+func readSBOMAtPointer(pt PartitionTableSummary, rootIndex int, pointer *manifest.SBOMPointer, readFile partitionFileReader) ([]byte, error) {
+	switch pointer.Location {
+	case manifest.SBOMLocationRootfs:
+		return readFile(rootIndex, pointer.Path)
+	case manifest.SBOMLocationESP, manifest.SBOMLocationPartition, manifest.SBOMLocationUKI:
+		partitionIndex, ok := findPartitionByName(pt, pointer.Partition)
+		if !ok {
+			return nil, fmt.Errorf("partition %q not found", pointer.Partition)
+		}
+		data, err := readFile(partitionIndex, pointer.Path)
+		if err != nil || pointer.Location != manifest.SBOMLocationUKI {
+			return data, err
+		}
+		return peSectionData(data, emptyOr(pointer.Section, manifest.UKISBOMSection))
+	default:
+		return nil, fmt.Errorf("unsupported SBOM location %q", pointer.Location)
+	}
+}
+
+// findPartitionByName returns the index of the partition whose GPT name or
+// filesystem label is name.
+func findPartitionByName(pt PartitionTableSummary, name string) (int, bool) {
+	for idx, partitionSummary := range pt.Partitions {
+		if name != "" && partitionSummary.Name == name {
+			return idx, true
+		}
+	}
+	for idx, partitionSummary := range pt.Partitions {
+		if name != "" && partitionSummary.Filesystem != nil && partitionSummary.Filesystem.Label == name {
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+// peSectionData returns the unpadded contents of section in a PE binary.
+func peSectionData(blob []byte, section string) ([]byte, error) {
+	f, err := pe.NewFile(bytes.NewReader(blob))
+	if err != nil {
+		return nil, fmt.Errorf("parse PE binary: %w", err)
+	}
+	defer f.Close()
+
+	for _, s := range f.Sections {
+		if strings.TrimRight(s.Name, "\x00") != section {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, fmt.Errorf("read section %s: %w", section, err)
+		}
+		if s.VirtualSize > 0 && int(s.VirtualSize) < len(data) {
+			data = data[:s.VirtualSize]
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("section %s not found", section)
+}
+
 func inspectSBOMFromImageRaw(img io.ReaderAt, pt PartitionTableSummary) SBOMSummary {
 	summary := SBOMSummary{Format: "spdx"}
 	rootCandidates := rankRootPartitionCandidates(pt)
@@ -22,6 +171,11 @@ func inspectSBOMFromImageRaw(img io.ReaderAt, pt PartitionTableSummary) SBOMSumm
 		return summary
 	}
 
+	if pointerSummary, found := inspectSBOMFromPointer(pt, rawPartitionFileReader(img, pt)); found {
+		return pointerSummary
+	}
+	// Images built before the SBOM pointer existed: look for the SBOM by file name
+
 	for _, candidateIndex := range rootCandidates {
 		partitionSummary := pt.Partitions[candidateIndex]
 		fsType := ""
@@ -76,6 +230,10 @@ func inspectSBOMFromImageFilesystem(disk diskAccessorFS, pt PartitionTableSummar
 		return summary
 	}
 
+	if pointerSummary, found := inspectSBOMFromPointer(pt, diskfsPartitionFileReader(disk, pt)); found {
+		return pointerSummary
+	}
+
 	dirCandidates := []string{manifest.ImageSBOMPath, strings.TrimPrefix(manifest.ImageSBOMPath, "/")}
 
 	for _, candidateIndex := range rootCandidates {
@@ -269,7 +427,7 @@ func rankRootPartitionCandidates(pt PartitionTableSummary) []int {
 		if fsType == "ext4" || fsType == "ext3" || fsType == "ext2" || fsType == "xfs" || fsType == "btrfs" {
 			total += 100
 		}
-		if fsType == "squashfs" {
+		if fsType == "squashfs" || fsType == "erofs" {
 			total += 80
 		}
 		if isVFATLike(fsType) {
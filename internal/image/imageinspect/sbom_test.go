@@ -3,10 +3,13 @@ package imageinspect
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config/manifest"
 )
 
 func TestCanonicalSPDXSHA256_StableAcrossOrder(t *testing.T) {
@@ -642,3 +645,182 @@ func TestCanonicalSPDXSHA256_InvalidJSON(t *testing.T) {
 		t.Fatalf("expected canonicalization error for invalid json")
 	}
 }
+
+// mapPartitionFileReader serves files keyed by partition index and path.
+func mapPartitionFileReader(files map[int]map[string][]byte) partitionFileReader {
+	return func(index int, filePath string) ([]byte, error) {
+		if data, ok := files[index][filePath]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("%s: file not found", filePath)
+	}
+}
+
+// minimalPEWithSection builds a PE image with a single section holding data.
+func minimalPEWithSection(name string, data []byte) []byte {
+	const peOffset = 0x40
+	const rawOffset = 0x200
+	rawSize := (len(data) + 0x1ff) &^ 0x1ff
+
+	blob := make([]byte, rawOffset+rawSize)
+	copy(blob, "MZ")
+	binary.LittleEndian.PutUint32(blob[0x3c:], peOffset)
+	copy(blob[peOffset:], "PE\x00\x00")
+
+	fileHeader := blob[peOffset+4:]
+	binary.LittleEndian.PutUint16(fileHeader[0:], 0x8664) // Machine: AMD64
+	binary.LittleEndian.PutUint16(fileHeader[2:], 1)      // NumberOfSections
+
+	section := blob[peOffset+4+20:]
+	copy(section[0:8], name)
+	binary.LittleEndian.PutUint32(section[8:], uint32(len(data))) // VirtualSize
+	binary.LittleEndian.PutUint32(section[12:], 0x1000)           // VirtualAddress
+	binary.LittleEndian.PutUint32(section[16:], uint32(rawSize))  // SizeOfRawData
+	binary.LittleEndian.PutUint32(section[20:], rawOffset)        // PointerToRawData
+
+	copy(blob[rawOffset:], data)
+	return blob
+}
+
+func sbomPointerTestTable() PartitionTableSummary {
+	return PartitionTableSummary{
+		LogicalSectorSize: 512,
+		Partitions: []PartitionSummary{
+			{Index: 1, Name: "boot", Filesystem: &FilesystemSummary{Type: "vfat", Label: "ESP"}},
+			{Index: 2, Name: "rootfs", Filesystem: &FilesystemSummary{Type: "ext4"}},
+			{Index: 3, Name: "", Filesystem: &FilesystemSummary{Type: "ext4", Label: "meta"}},
+		},
+	}
+}
+
+func TestInspectSBOMFromPointer_Locations(t *testing.T) {
+	sbom := []byte(`{"spdxVersion":"SPDX-2.3","packages":[{"name":"zlib","versionInfo":"1.2.13"}]}`)
+	sbomSHA := sha256Hex(sbom)
+
+	tests := []struct {
+		name         string
+		wantLocation string
+		pointer      string
+		files        map[int]map[string][]byte
+	}{
+		{
+			name:         "rootfs",
+			wantLocation: "rootfs",
+			pointer:      `{"format":"spdx","location":"rootfs","path":"/usr/share/sbom/spdx_manifest.json","fileName":"spdx_manifest.json"}`,
+			files:        map[int]map[string][]byte{1: {"/usr/share/sbom/spdx_manifest.json": sbom}},
+		},
+		{
+			name:         "esp",
+			wantLocation: "esp",
+			pointer:      `{"format":"spdx","location":"esp","partition":"boot","path":"/sbom/spdx_manifest.json","fileName":"spdx_manifest.json"}`,
+			files:        map[int]map[string][]byte{0: {"/sbom/spdx_manifest.json": sbom}},
+		},
+		{
+			name:         "partition by label",
+			wantLocation: "partition",
+			pointer:      `{"format":"spdx","location":"partition","partition":"meta","path":"/sbom/spdx_manifest.json","fileName":"spdx_manifest.json"}`,
+			files:        map[int]map[string][]byte{2: {"/sbom/spdx_manifest.json": sbom}},
+		},
+		{
+			name:         "uki",
+			wantLocation: "uki",
+			pointer:      `{"format":"spdx","location":"uki","partition":"boot","path":"/EFI/Linux/linux.efi","section":".sbom","fileName":"spdx_manifest.json"}`,
+			files:        map[int]map[string][]byte{0: {"/EFI/Linux/linux.efi": minimalPEWithSection(".sbom", sbom)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pointer := strings.Replace(tt.pointer, `"fileName"`, `"sha256":"`+sbomSHA+`","fileName"`, 1)
+			if tt.files[1] == nil {
+				tt.files[1] = map[string][]byte{}
+			}
+			tt.files[1][manifest.SBOMPointerPath] = []byte(pointer)
+
+			summary, found := inspectSBOMFromPointer(sbomPointerTestTable(), mapPartitionFileReader(tt.files))
+			if !found {
+				t.Fatalf("expected pointer to be found")
+			}
+			if !summary.Present {
+				t.Fatalf("expected SBOM present, notes: %v", summary.Notes)
+			}
+			if summary.Location != tt.wantLocation {
+				t.Errorf("unexpected location %q", summary.Location)
+			}
+			if summary.SHA256 != sbomSHA {
+				t.Errorf("SHA256 mismatch: got %s want %s", summary.SHA256, sbomSHA)
+			}
+			if summary.PackageCount != 1 {
+				t.Errorf("expected 1 package, got %d", summary.PackageCount)
+			}
+			if len(summary.Notes) != 0 {
+				t.Errorf("unexpected notes: %v", summary.Notes)
+			}
+		})
+	}
+}
+
+func TestInspectSBOMFromPointer_Missing(t *testing.T) {
+	_, found := inspectSBOMFromPointer(sbomPointerTestTable(), mapPartitionFileReader(nil))
+	if found {
+		t.Fatalf("expected no pointer to be found")
+	}
+}
+
+func TestInspectSBOMFromPointer_Errors(t *testing.T) {
+	sbom := []byte(`{"spdxVersion":"SPDX-2.3","packages":[]}`)
+
+	tests := []struct {
+		name     string
+		pointer  string
+		files    map[string][]byte
+		present  bool
+		wantNote string
+	}{
+		{name: "invalid pointer", pointer: `{`, wantNote: "invalid SBOM pointer"},
+		{name: "unknown partition",
+			pointer:  `{"location":"partition","partition":"data","path":"/sbom/x.json"}`,
+			wantNote: `partition "data" not found`},
+		{name: "missing file",
+			pointer:  `{"location":"rootfs","path":"/sbom/x.json"}`,
+			wantNote: "could not be read"},
+		{name: "checksum mismatch",
+			pointer:  `{"location":"rootfs","path":"/sbom/x.json","sha256":"0000"}`,
+			files:    map[string][]byte{"/sbom/x.json": sbom},
+			present:  true,
+			wantNote: "does not match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootFiles := map[string][]byte{manifest.SBOMPointerPath: []byte(tt.pointer)}
+			for name, data := range tt.files {
+				rootFiles[name] = data
+			}
+			summary, found := inspectSBOMFromPointer(sbomPointerTestTable(), mapPartitionFileReader(map[int]map[string][]byte{1: rootFiles}))
+			if !found {
+				t.Fatalf("expected pointer to be found")
+			}
+			if summary.Present != tt.present {
+				t.Errorf("Present = %v, want %v", summary.Present, tt.present)
+			}
+			if len(summary.Notes) == 0 || !strings.Contains(strings.Join(summary.Notes, "; "), tt.wantNote) {
+				t.Errorf("expected note containing %q, got %v", tt.wantNote, summary.Notes)
+			}
+		})
+	}
+}
+
+func TestPESectionData_MissingSection(t *testing.T) {
+	blob := minimalPEWithSection(".linux", []byte("kernel"))
+	if _, err := peSectionData(blob, ".sbom"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected missing section error, got %v", err)
+	}
+	data, err := peSectionData(blob, ".linux")
+	if err != nil {
+		t.Fatalf("peSectionData failed: %v", err)
+	}
+	if string(data) != "kernel" {
+		t.Fatalf("unexpected section data %q", data)
+	}
+}
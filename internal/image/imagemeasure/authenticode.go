@@ -0,0 +1,93 @@
+package imagemeasure
+
+import (
+	"bytes"
+	"crypto"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// PE/COFF header offsets used by the Authenticode image hash
+const (
+	peOffsetPointer      = 0x3c // e_lfanew of the DOS header
+	coffHeaderSize       = 20
+	optionalHeaderPE32   = 0x10b
+	optionalHeaderPE32p  = 0x20b
+	checksumOffset       = 64 // in the optional header
+	sizeOfHeadersOffset  = 60 // in the optional header
+	dataDirectoryPE32    = 96
+	dataDirectoryPE32p   = 112
+	securityDirIndex     = 4
+	dataDirectoryEntSize = 8
+)
+
+// AuthenticodeDigest returns the Authenticode hash of the PE image blob, the
+// digest the firmware verifies Secure Boot signatures against and measures
+// into PCR 4. The checksum, the security directory entry and the attribute
+// certificate table are left out, so signing the image does not change it.
+func AuthenticodeDigest(blob []byte, hash crypto.Hash) ([]byte, error) {
+	if len(blob) < peOffsetPointer+4 || !bytes.HasPrefix(blob, []byte("MZ")) {
+		return nil, fmt.Errorf("not a PE image")
+	}
+	peOffset := int(binary.LittleEndian.Uint32(blob[peOffsetPointer:]))
+	optOffset := peOffset + 4 + coffHeaderSize
+	if peOffset < 0 || optOffset+2 > len(blob) || !bytes.Equal(blob[peOffset:peOffset+4], []byte("PE\x00\x00")) {
+		return nil, fmt.Errorf("not a PE image")
+	}
+
+	var dirOffset int
+	switch magic := binary.LittleEndian.Uint16(blob[optOffset:]); magic {
+	case optionalHeaderPE32:
+		dirOffset = optOffset + dataDirectoryPE32
+	case optionalHeaderPE32p:
+		dirOffset = optOffset + dataDirectoryPE32p
+	default:
+		return nil, fmt.Errorf("unknown PE optional header magic 0x%x", magic)
+	}
+	checksum := optOffset + checksumOffset
+	securityDir := dirOffset + securityDirIndex*dataDirectoryEntSize
+	if securityDir+dataDirectoryEntSize > len(blob) {
+		return nil, fmt.Errorf("truncated PE optional header")
+	}
+	sizeOfHeaders := int(binary.LittleEndian.Uint32(blob[optOffset+sizeOfHeadersOffset:]))
+	certSize := int(binary.LittleEndian.Uint32(blob[securityDir+4:]))
+	if sizeOfHeaders < securityDir+dataDirectoryEntSize || sizeOfHeaders > len(blob) || certSize > len(blob) {
+		return nil, fmt.Errorf("invalid PE header sizes")
+	}
+
+	f, err := pe.NewFile(bytes.NewReader(blob))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PE image: %w", err)
+	}
+	defer f.Close()
+
+	h := hash.New()
+	h.Write(blob[:checksum])
+	h.Write(blob[checksum+4 : securityDir])
+	h.Write(blob[securityDir+dataDirectoryEntSize : sizeOfHeaders])
+
+	// The sections in file order, then whatever follows them except the
+	// certificate table
+	sections := make([]*pe.Section, 0, len(f.Sections))
+	for _, s := range f.Sections {
+		if s.Size > 0 {
+			sections = append(sections, s)
+		}
+	}
+	sort.SliceStable(sections, func(i, j int) bool { return sections[i].Offset < sections[j].Offset })
+	hashed := sizeOfHeaders
+	for _, s := range sections {
+		start, end := int(s.Offset), int(s.Offset)+int(s.Size)
+		if start < 0 || end > len(blob) || end < start {
+			return nil, fmt.Errorf("section %s is outside of the PE image", s.Name)
+		}
+		h.Write(blob[start:end])
+		hashed += int(s.Size)
+	}
+	if rest := len(blob) - certSize; rest > hashed {
+		h.Write(blob[hashed:rest])
+	}
+	return h.Sum(nil), nil
+}
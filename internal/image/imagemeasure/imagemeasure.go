@@ -0,0 +1,230 @@
+package imagemeasure
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageupdate"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/logger"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/system"
+)
+
+var log = logger.Logger()
+
+// PredictionFileName is the file next to the image holding the predicted
+// PCR values
+const PredictionFileName = "pcr-prediction.json"
+
+// Prediction holds the PCR values a device reaches when it boots the UKIs of
+// the image
+type Prediction struct {
+	Context string          `json:"context"`                  // what the prediction assumes about the devices
+	Banks   []string        `json:"banks"`                    // PCR banks of the values
+	Phases  []string        `json:"phases"`                   // boot phase paths of the PCR 11 values
+	KeySet  string          `json:"secureBootKeys,omitempty"` // Secure Boot key set of the PCR 7 values
+	UKIs    []UKIPrediction `json:"ukis"`
+	Notes   []string        `json:"notes,omitempty"`
+}
+
+// UKIPrediction holds the PCR values of booting one UKI
+type UKIPrediction struct {
+	Path   string     `json:"path"` // path on the ESP, or file name in the update payload
+	Values []PCRValue `json:"values"`
+}
+
+// PCRValue is the predicted value of a PCR in one bank
+type PCRValue struct {
+	PCR    int    `json:"pcr"`
+	Bank   string `json:"bank"`
+	Phase  string `json:"phase,omitempty"` // boot phase path of a PCR 11 value, empty when the UKI starts the kernel
+	Digest string `json:"digest"`
+}
+
+// predictionContext states what the prediction assumes about the device
+const predictionContext = "PCR 4: the firmware starts the fallback boot loader of the ESP, which starts the UKI. " +
+	"PCR 7: Secure Boot is enabled with the PK, KEK and db of the key set and an empty dbx. " +
+	"PCR 11: systemd-stub measures the UKI sections, systemd-pcrphase the boot phases."
+
+// Predict computes the PCR 4, 7 and 11 values of booting each UKI of the
+// image below installRoot through the fallback boot loader of the ESP.
+func Predict(installRoot string, template *config.ImageTemplate) (*Prediction, error) {
+	espDir := filepath.Join(installRoot, "boot", "efi")
+	loaderName, err := fallbackLoaderName(template.Target.Arch)
+	if err != nil {
+		return nil, err
+	}
+	loader, err := os.ReadFile(filepath.Join(espDir, "EFI", "BOOT", loaderName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the boot loader: %w", err)
+	}
+
+	ukiPaths, err := filepath.Glob(filepath.Join(espDir, "EFI", "Linux", "*.efi"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list UKIs: %w", err)
+	}
+	ukiNames := make(map[string]string)
+	for _, path := range ukiPaths {
+		ukiNames[path] = "/" + strings.TrimPrefix(path, espDir+"/")
+	}
+	// The UKIs of the update payload boot the same way once installed
+	if template.IsABUpdate() {
+		payloadDir, err := imageupdate.PayloadDir(template)
+		if err != nil {
+			return nil, err
+		}
+		payloadUKIs, err := filepath.Glob(filepath.Join(payloadDir, "*.efi"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list update payload UKIs: %w", err)
+		}
+		for _, path := range payloadUKIs {
+			ukiPaths = append(ukiPaths, path)
+			ukiNames[path] = filepath.Base(path)
+		}
+	}
+	if len(ukiPaths) == 0 {
+		return nil, fmt.Errorf("no UKI found on the ESP")
+	}
+	sort.Strings(ukiPaths)
+
+	prediction := &Prediction{
+		Banks:   template.MeasuredBoot.PCRBanks(),
+		Phases:  template.MeasuredBoot.Phases,
+		Context: predictionContext,
+	}
+	if len(prediction.Phases) == 0 {
+		prediction.Phases = DefaultPhases
+	}
+	secureBoot, note, err := secureBootState(template)
+	if err != nil {
+		return nil, err
+	}
+	if secureBoot == nil {
+		prediction.Notes = append(prediction.Notes, note)
+	} else {
+		prediction.KeySet = template.SystemConfig.Immutability.SecureBootKeys
+	}
+
+	for _, path := range ukiPaths {
+		uki, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read UKI %s: %w", path, err)
+		}
+		entry := UKIPrediction{Path: ukiNames[path]}
+		for _, bank := range prediction.Banks {
+			hash, err := BankHash(bank)
+			if err != nil {
+				return nil, err
+			}
+			bootLoaderPCR, err := PredictBootLoaderPCR(hash, loader, uki)
+			if err != nil {
+				return nil, fmt.Errorf("failed to predict PCR %d of %s: %w", PCRBootLoaderCode, entry.Path, err)
+			}
+			entry.Values = append(entry.Values, PCRValue{PCR: PCRBootLoaderCode, Bank: bank, Digest: hex.EncodeToString(bootLoaderPCR)})
+			if secureBoot != nil {
+				entry.Values = append(entry.Values, PCRValue{PCR: PCRSecureBoot, Bank: bank,
+					Digest: hex.EncodeToString(PredictSecureBootPCR(hash, *secureBoot))})
+			}
+			kernelPCR, err := UKIPCR(hash, uki)
+			if err != nil {
+				return nil, fmt.Errorf("failed to predict PCR %d of %s: %w", PCRKernelBoot, entry.Path, err)
+			}
+			entry.Values = append(entry.Values, PCRValue{PCR: PCRKernelBoot, Bank: bank, Digest: hex.EncodeToString(kernelPCR.Value())})
+			for _, phase := range prediction.Phases {
+				entry.Values = append(entry.Values, PCRValue{PCR: PCRKernelBoot, Bank: bank, Phase: phase,
+					Digest: hex.EncodeToString(PhasePCR(kernelPCR, phase))})
+			}
+		}
+		prediction.UKIs = append(prediction.UKIs, entry)
+	}
+	return prediction, nil
+}
+
+// secureBootState returns the Secure Boot variables of a device enrolled with
+// the key set of the template, or nil and the reason PCR 7 is not predicted
+func secureBootState(template *config.ImageTemplate) (*SecureBootState, string, error) {
+	immutability := template.SystemConfig.Immutability
+	switch {
+	case !template.IsImmutabilityEnabled() || !immutability.HasSecureBootDBKey():
+		return nil, "PCR 7 is not predicted: the image is not signed for Secure Boot", nil
+	case immutability.SecureBootKeys == "":
+		return nil, "PCR 7 is not predicted: the Secure Boot variables of the devices are unknown without secureBootKeys", nil
+	case immutability.SecureBootDBCrt != "":
+		return nil, "PCR 7 is not predicted: the image is signed with another db key than the one of the key set", nil
+	}
+
+	keySetDir, err := config.SecureBootKeySetDir(immutability.SecureBootKeys)
+	if err != nil {
+		return nil, "", err
+	}
+	lists := make(map[string][]byte)
+	for _, name := range config.SecureBootKeyNames {
+		data, err := os.ReadFile(filepath.Join(keySetDir, name+".esl"))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read secure boot %s signature list: %w", name, err)
+		}
+		lists[name] = data
+	}
+	authority, err := FirstSignatureData(lists[config.SecureBootDB])
+	if err != nil {
+		return nil, "", fmt.Errorf("secure boot db signature list: %w", err)
+	}
+	return &SecureBootState{
+		PK:        lists[config.SecureBootPK],
+		KEK:       lists[config.SecureBootKEK],
+		DB:        lists[config.SecureBootDB],
+		Authority: authority,
+	}, "", nil
+}
+
+// fallbackLoaderName returns the file name the firmware boots from the ESP
+func fallbackLoaderName(arch string) (string, error) {
+	switch arch {
+	case "x86_64", "amd64":
+		return "BOOTX64.EFI", nil
+	case "aarch64", "arm64":
+		return "BOOTAA64.EFI", nil
+	default:
+		return "", fmt.Errorf("PCR prediction is not supported for architecture %q", arch)
+	}
+}
+
+// WritePrediction predicts the PCR values of the image and writes them next
+// to the image, when the template signs a PCR policy.
+func WritePrediction(installRoot string, template *config.ImageTemplate) error {
+	if !template.MeasuredBoot.IsEnabled() {
+		return nil
+	}
+	prediction, err := Predict(installRoot, template)
+	if err != nil {
+		log.Errorf("Failed to predict PCR values: %v", err)
+		return fmt.Errorf("failed to predict PCR values: %w", err)
+	}
+	for _, note := range prediction.Notes {
+		log.Warnf("%s", note)
+	}
+
+	globalWorkDir, err := config.WorkDir()
+	if err != nil {
+		return fmt.Errorf("failed to get global work directory: %w", err)
+	}
+	providerId := system.GetProviderId(template.Target.OS, template.Target.Dist, template.Target.Arch)
+	outputPath := filepath.Join(globalWorkDir, providerId, "imagebuild", template.GetSystemConfigName(), PredictionFileName)
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create PCR prediction directory: %w", err)
+	}
+	data, err := json.MarshalIndent(prediction, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode PCR prediction: %w", err)
+	}
+	if err := os.WriteFile(outputPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write PCR prediction: %w", err)
+	}
+	log.Infof("Predicted PCR values of %d UKIs written to %s", len(prediction.UKIs), outputPath)
+	return nil
+}
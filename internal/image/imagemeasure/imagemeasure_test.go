@@ -0,0 +1,309 @@
+package imagemeasure
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+)
+
+type testSection struct {
+	name string
+	data []byte
+}
+
+// testPE builds a PE32+ image with the sections, each padded to the file
+// alignment with its virtual size set to the data length
+func testPE(sections ...testSection) []byte {
+	const (
+		peOffset     = 0x40
+		optionalSize = 240
+		alignment    = 0x200
+	)
+	headersSize := peOffset + 4 + 20 + optionalSize + 40*len(sections)
+	headersSize = (headersSize + alignment - 1) &^ (alignment - 1)
+
+	blob := make([]byte, headersSize)
+	copy(blob, "MZ")
+	binary.LittleEndian.PutUint32(blob[0x3c:], peOffset)
+	copy(blob[peOffset:], "PE\x00\x00")
+	coff := blob[peOffset+4:]
+	binary.LittleEndian.PutUint16(coff[0:], 0x8664)
+	binary.LittleEndian.PutUint16(coff[2:], uint16(len(sections)))
+	binary.LittleEndian.PutUint16(coff[16:], optionalSize)
+	opt := blob[peOffset+24:]
+	binary.LittleEndian.PutUint16(opt[0:], optionalHeaderPE32p)
+	binary.LittleEndian.PutUint32(opt[32:], 0x1000)    // SectionAlignment
+	binary.LittleEndian.PutUint32(opt[36:], alignment) // FileAlignment
+	binary.LittleEndian.PutUint32(opt[sizeOfHeadersOffset:], uint32(headersSize))
+	binary.LittleEndian.PutUint32(opt[108:], 16) // NumberOfRvaAndSizes
+
+	tableOffset := peOffset + 24 + optionalSize
+	for i, s := range sections {
+		rawSize := (len(s.data) + alignment - 1) &^ (alignment - 1)
+		header := blob[tableOffset+40*i:]
+		copy(header[0:8], s.name)
+		binary.LittleEndian.PutUint32(header[8:], uint32(len(s.data)))
+		binary.LittleEndian.PutUint32(header[12:], uint32(0x1000*(i+1)))
+		binary.LittleEndian.PutUint32(header[16:], uint32(rawSize))
+		binary.LittleEndian.PutUint32(header[20:], uint32(len(blob)))
+		padded := make([]byte, rawSize)
+		copy(padded, s.data)
+		blob = append(blob, padded...)
+	}
+	return blob
+}
+
+// signTestPE appends an attribute certificate table to blob and sets the
+// checksum, as signing does
+func signTestPE(blob []byte) []byte {
+	signed := append(bytes.Clone(blob), bytes.Repeat([]byte{0xab}, 64)...)
+	opt := signed[0x40+24:]
+	binary.LittleEndian.PutUint32(opt[checksumOffset:], 0x12345678)
+	dir := opt[dataDirectoryPE32p+securityDirIndex*dataDirectoryEntSize:]
+	binary.LittleEndian.PutUint32(dir[0:], uint32(len(blob)))
+	binary.LittleEndian.PutUint32(dir[4:], 64)
+	return signed
+}
+
+func testUKI() []byte {
+	return testPE(
+		testSection{".osrel", []byte("ID=test\n")},
+		testSection{".cmdline", []byte("root=/dev/sda2 ro")},
+		testSection{".linux", []byte("kernel")},
+		testSection{".initrd", []byte("initrd")},
+		testSection{".pcrsig", []byte("{}")},
+	)
+}
+
+func TestAuthenticodeDigest(t *testing.T) {
+	blob := testUKI()
+	digest, err := AuthenticodeDigest(blob, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("AuthenticodeDigest failed: %v", err)
+	}
+	if len(digest) != sha256.Size {
+		t.Fatalf("unexpected digest length %d", len(digest))
+	}
+
+	// Signing leaves the Authenticode hash alone
+	signedDigest, err := AuthenticodeDigest(signTestPE(blob), crypto.SHA256)
+	if err != nil {
+		t.Fatalf("AuthenticodeDigest of the signed image failed: %v", err)
+	}
+	if !bytes.Equal(digest, signedDigest) {
+		t.Error("the signature must not change the Authenticode hash")
+	}
+
+	// Any other change does
+	changed := bytes.Clone(blob)
+	changed[len(changed)-1] ^= 0xff
+	changedDigest, err := AuthenticodeDigest(changed, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(digest, changedDigest) {
+		t.Error("a changed section must change the Authenticode hash")
+	}
+
+	for _, invalid := range [][]byte{nil, []byte("MZ not a PE image"), bytes.Repeat([]byte{0}, 0x100)} {
+		if _, err := AuthenticodeDigest(invalid, crypto.SHA256); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestPCR(t *testing.T) {
+	pcr := NewPCR(crypto.SHA256)
+	pcr.Measure([]byte("abc"))
+
+	// PCR = SHA256(zeros || SHA256("abc"))
+	data := sha256.Sum256([]byte("abc"))
+	want := sha256.Sum256(append(make([]byte, sha256.Size), data[:]...))
+	if !bytes.Equal(pcr.Value(), want[:]) {
+		t.Errorf("unexpected PCR value %x", pcr.Value())
+	}
+
+	for _, bank := range []string{"sha1", "sha256", "sha384", "sha512"} {
+		hash, err := BankHash(bank)
+		if err != nil {
+			t.Fatalf("BankHash(%s) failed: %v", bank, err)
+		}
+		if len(NewPCR(hash).Value()) != hash.Size() {
+			t.Errorf("unexpected %s PCR size", bank)
+		}
+	}
+	if _, err := BankHash("md5"); err == nil {
+		t.Error("expected an error for an unsupported bank")
+	}
+}
+
+func TestUKIPCR(t *testing.T) {
+	pcr, err := UKIPCR(crypto.SHA256, testUKI())
+	if err != nil {
+		t.Fatalf("UKIPCR failed: %v", err)
+	}
+
+	// The sections are measured in the order of systemd-stub, without
+	// padding and without .pcrsig
+	want := NewPCR(crypto.SHA256)
+	for _, s := range []testSection{
+		{".linux", []byte("kernel")},
+		{".osrel", []byte("ID=test\n")},
+		{".cmdline", []byte("root=/dev/sda2 ro")},
+		{".initrd", []byte("initrd")},
+	} {
+		want.Measure([]byte(s.name + "\x00"))
+		want.Measure(s.data)
+	}
+	if !bytes.Equal(pcr.Value(), want.Value()) {
+		t.Errorf("unexpected PCR 11 value %x, want %x", pcr.Value(), want.Value())
+	}
+
+	want.Measure([]byte("enter-initrd"))
+	want.Measure([]byte("leave-initrd"))
+	if got := PhasePCR(pcr, "enter-initrd:leave-initrd"); !bytes.Equal(got, want.Value()) {
+		t.Errorf("unexpected phase PCR 11 value %x", got)
+	}
+
+	if _, err := UKIPCR(crypto.SHA256, testPE(testSection{".text", []byte("code")})); err == nil {
+		t.Error("expected an error for a PE image without .linux")
+	}
+}
+
+func TestFirstSignatureData(t *testing.T) {
+	entry := append(bytes.Repeat([]byte{0x11}, 16), []byte("certificate")...)
+	esl := make([]byte, 28)
+	copy(esl, bytes.Repeat([]byte{0x22}, 16))
+	binary.LittleEndian.PutUint32(esl[16:], uint32(28+len(entry)))
+	binary.LittleEndian.PutUint32(esl[24:], uint32(len(entry)))
+	esl = append(esl, entry...)
+
+	data, err := FirstSignatureData(esl)
+	if err != nil {
+		t.Fatalf("FirstSignatureData failed: %v", err)
+	}
+	if !bytes.Equal(data, entry) {
+		t.Errorf("unexpected signature data %x", data)
+	}
+	if _, err := FirstSignatureData(esl[:40]); err == nil {
+		t.Error("expected an error for a truncated signature list")
+	}
+}
+
+func TestVariableData(t *testing.T) {
+	data := variableData(efiGlobalVariable, "PK", []byte{1, 2})
+	want, _ := hex.DecodeString("61dfe48bca93d211aa0d00e098032b8c" + "0200000000000000" + "0200000000000000" + "50004b00" + "0102")
+	if !bytes.Equal(data, want) {
+		t.Errorf("unexpected UEFI_VARIABLE_DATA %x", data)
+	}
+}
+
+func TestWritePrediction(t *testing.T) {
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	global := config.DefaultGlobalConfig()
+	global.WorkDir = t.TempDir()
+	global.ConfigDir = t.TempDir()
+	config.SetGlobal(global)
+
+	installRoot := t.TempDir()
+	espDir := filepath.Join(installRoot, "boot", "efi")
+	loader := signTestPE(testPE(testSection{".sdmagic", []byte("systemd-boot")}))
+	for path, data := range map[string][]byte{
+		filepath.Join(espDir, "EFI", "BOOT", "BOOTX64.EFI"): loader,
+		filepath.Join(espDir, "EFI", "Linux", "linux.efi"):  testUKI(),
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	template := &config.ImageTemplate{
+		Target:       config.TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64"},
+		SystemConfig: config.SystemConfig{Name: "test-config"},
+		MeasuredBoot: config.MeasuredBootConfig{PCRPrivateKey: "/keys/pcr.key", Banks: []string{"sha256", "sha384"}},
+	}
+
+	// Without Secure Boot PCR 7 depends on the device
+	prediction, err := Predict(installRoot, template)
+	if err != nil {
+		t.Fatalf("Predict failed: %v", err)
+	}
+	if len(prediction.UKIs) != 1 || prediction.UKIs[0].Path != "/EFI/Linux/linux.efi" {
+		t.Fatalf("unexpected UKIs %+v", prediction.UKIs)
+	}
+	// PCR 4 and PCR 11 at boot and after the four default phases, in both banks
+	if values := prediction.UKIs[0].Values; len(values) != 2*(1+1+len(DefaultPhases)) {
+		t.Errorf("unexpected values %+v", values)
+	}
+	if len(prediction.Notes) != 1 || !strings.Contains(prediction.Notes[0], "PCR 7 is not predicted") {
+		t.Errorf("unexpected notes %v", prediction.Notes)
+	}
+	wantPCR4, err := PredictBootLoaderPCR(crypto.SHA256, loader, testUKI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prediction.UKIs[0].Values[0]; got.PCR != PCRBootLoaderCode || got.Bank != "sha256" || got.Digest != hex.EncodeToString(wantPCR4) {
+		t.Errorf("unexpected PCR 4 value %+v", got)
+	}
+
+	// The key set gives the Secure Boot variables of the devices
+	template.MeasuredBoot.Banks = nil
+	template.MeasuredBoot.Phases = []string{"enter-initrd"}
+	template.SystemConfig.Immutability = config.ImmutabilityConfig{Enabled: true, SecureBootKeys: "lab"}
+	keySetDir := filepath.Join(global.ConfigDir, "keys", "lab")
+	if err := os.MkdirAll(keySetDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	esl := make([]byte, 28)
+	binary.LittleEndian.PutUint32(esl[16:], 28+20)
+	binary.LittleEndian.PutUint32(esl[24:], 20)
+	esl = append(esl, bytes.Repeat([]byte{0x33}, 20)...)
+	for _, name := range config.SecureBootKeyNames {
+		if err := os.WriteFile(filepath.Join(keySetDir, name+".esl"), esl, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WritePrediction(installRoot, template); err != nil {
+		t.Fatalf("WritePrediction failed: %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(global.WorkDir, "*", "imagebuild", "test-config", PredictionFileName))
+	if len(matches) != 1 {
+		t.Fatalf("expected the prediction next to the image, got %v", matches)
+	}
+	data, err := os.ReadFile(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written Prediction
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatalf("invalid prediction JSON: %v", err)
+	}
+	if written.KeySet != "lab" || len(written.Notes) != 0 || len(written.UKIs[0].Values) != 4 {
+		t.Errorf("unexpected prediction %+v", written)
+	}
+	if pcr7 := written.UKIs[0].Values[1]; pcr7.PCR != PCRSecureBoot || pcr7.Digest == "" {
+		t.Errorf("unexpected PCR 7 value %+v", pcr7)
+	}
+
+	// Templates without measured boot predict nothing
+	if err := WritePrediction(t.TempDir(), &config.ImageTemplate{}); err != nil {
+		t.Errorf("WritePrediction without measured boot failed: %v", err)
+	}
+	template.Target.Arch = "riscv64"
+	if _, err := Predict(installRoot, template); err == nil {
+		t.Error("expected an error for an unsupported architecture")
+	}
+}
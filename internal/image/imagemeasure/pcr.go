@@ -0,0 +1,243 @@
+package imagemeasure
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+)
+
+// TPM PCRs predicted for the image
+const (
+	PCRBootLoaderCode = 4  // PE images started by the firmware
+	PCRSecureBoot     = 7  // Secure Boot state and the db entries trusted
+	PCRKernelBoot     = 11 // UKI sections measured by systemd-stub, then the boot phases
+)
+
+// bootOptionAction is the event the firmware measures into PCR 4 before it
+// starts the boot loader
+const bootOptionAction = "Calling EFI Application from Boot Option"
+
+// separatorEvent ends the pre-boot measurements of PCRs 0 to 7
+var separatorEvent = []byte{0, 0, 0, 0}
+
+// EFI variable vendor GUIDs of the Secure Boot variables
+var (
+	efiGlobalVariable        = uuid.MustParse("8be4df61-93ca-11d2-aa0d-00e098032b8c")
+	efiImageSecurityDatabase = uuid.MustParse("d719b2cb-3d3a-4596-a3bc-dad00e67656f")
+)
+
+// secureBootEnabled is the SecureBoot variable of a device booting with
+// Secure Boot
+var secureBootEnabled = []byte{1}
+
+// ukiMeasuredSections are the UKI sections systemd-stub measures into PCR 11,
+// in measurement order. The .pcrsig section is not measured, it signs the
+// result.
+var ukiMeasuredSections = []string{
+	".linux", ".osrel", ".cmdline", ".initrd", ".ucode", ".splash", ".dtb", ".uname", ".sbat", ".pcrpkey",
+}
+
+// DefaultPhases are the boot phase paths ukify signs PCR 11 policies for
+// when none are given. systemd-pcrphase measures each phase word into PCR 11.
+var DefaultPhases = []string{
+	"enter-initrd",
+	"enter-initrd:leave-initrd",
+	"enter-initrd:leave-initrd:sysinit",
+	"enter-initrd:leave-initrd:sysinit:ready",
+}
+
+// BankHash returns the hash algorithm of the PCR bank name
+func BankHash(bank string) (crypto.Hash, error) {
+	switch bank {
+	case "sha1":
+		return crypto.SHA1, nil
+	case "sha256":
+		return crypto.SHA256, nil
+	case "sha384":
+		return crypto.SHA384, nil
+	case "sha512":
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported PCR bank %q", bank)
+	}
+}
+
+// PCR is a simulated TPM PCR of one bank, starting at all zeros
+type PCR struct {
+	hash  crypto.Hash
+	value []byte
+}
+
+// NewPCR returns a PCR of the bank of hash after reset
+func NewPCR(hash crypto.Hash) *PCR {
+	return &PCR{hash: hash, value: make([]byte, hash.Size())}
+}
+
+// Extend extends the PCR with a digest of its bank
+func (p *PCR) Extend(digest []byte) {
+	h := p.hash.New()
+	h.Write(p.value)
+	h.Write(digest)
+	p.value = h.Sum(nil)
+}
+
+// Measure extends the PCR with the digest of data
+func (p *PCR) Measure(data []byte) {
+	h := p.hash.New()
+	h.Write(data)
+	p.Extend(h.Sum(nil))
+}
+
+// Value returns the current PCR value
+func (p *PCR) Value() []byte {
+	return bytes.Clone(p.value)
+}
+
+// Clone returns a copy of the PCR
+func (p *PCR) Clone() *PCR {
+	return &PCR{hash: p.hash, value: p.Value()}
+}
+
+// PredictBootLoaderPCR returns PCR 4 after the firmware started images in
+// order: the boot option action and the separator, then the Authenticode hash
+// of each image.
+func PredictBootLoaderPCR(hash crypto.Hash, images ...[]byte) ([]byte, error) {
+	pcr := NewPCR(hash)
+	pcr.Measure([]byte(bootOptionAction))
+	pcr.Measure(separatorEvent)
+	for _, image := range images {
+		digest, err := AuthenticodeDigest(image, hash)
+		if err != nil {
+			return nil, err
+		}
+		pcr.Extend(digest)
+	}
+	return pcr.Value(), nil
+}
+
+// SecureBootState holds the Secure Boot variables of a device and the db
+// entry verifying the images it boots
+type SecureBootState struct {
+	PK, KEK, DB, DBX []byte // EFI signature lists enrolled, empty when unset
+	Authority        []byte // EFI_SIGNATURE_DATA of the db entry verifying the images
+}
+
+// PredictSecureBootPCR returns PCR 7 of a device with Secure Boot enabled and
+// the variables of state: the SecureBoot, PK, KEK, db and dbx variables, the
+// separator and the db entry the images are verified with, measured once.
+func PredictSecureBootPCR(hash crypto.Hash, state SecureBootState) []byte {
+	pcr := NewPCR(hash)
+	pcr.Measure(variableData(efiGlobalVariable, "SecureBoot", secureBootEnabled))
+	pcr.Measure(variableData(efiGlobalVariable, "PK", state.PK))
+	pcr.Measure(variableData(efiGlobalVariable, "KEK", state.KEK))
+	pcr.Measure(variableData(efiImageSecurityDatabase, "db", state.DB))
+	pcr.Measure(variableData(efiImageSecurityDatabase, "dbx", state.DBX))
+	pcr.Measure(separatorEvent)
+	if len(state.Authority) > 0 {
+		pcr.Measure(variableData(efiImageSecurityDatabase, "db", state.Authority))
+	}
+	return pcr.Value()
+}
+
+// variableData encodes the UEFI_VARIABLE_DATA of an EFI variable event
+func variableData(vendor uuid.UUID, name string, data []byte) []byte {
+	unicodeName := utf16.Encode([]rune(name))
+	var buf bytes.Buffer
+	buf.Write(efiGUID(vendor))
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(len(unicodeName)))
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(len(data)))
+	_ = binary.Write(&buf, binary.LittleEndian, unicodeName)
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// efiGUID returns the EFI_GUID encoding of id, with the first three fields
+// little endian
+func efiGUID(id uuid.UUID) []byte {
+	b := id[:]
+	return []byte{
+		b[3], b[2], b[1], b[0],
+		b[5], b[4],
+		b[7], b[6],
+		b[8], b[9], b[10], b[11], b[12], b[13], b[14], b[15],
+	}
+}
+
+// FirstSignatureData returns the first EFI_SIGNATURE_DATA entry of the EFI
+// signature list esl: the owner GUID and the certificate.
+func FirstSignatureData(esl []byte) ([]byte, error) {
+	const listHeaderSize = 28
+	if len(esl) < listHeaderSize {
+		return nil, fmt.Errorf("EFI signature list is too short")
+	}
+	listSize := int(binary.LittleEndian.Uint32(esl[16:]))
+	headerSize := int(binary.LittleEndian.Uint32(esl[20:]))
+	signatureSize := int(binary.LittleEndian.Uint32(esl[24:]))
+	start := listHeaderSize + headerSize
+	if listSize > len(esl) || signatureSize <= 16 || start+signatureSize > listSize {
+		return nil, fmt.Errorf("invalid EFI signature list")
+	}
+	return bytes.Clone(esl[start : start+signatureSize]), nil
+}
+
+// UKIPCR returns PCR 11 after systemd-stub measured the sections of the UKI
+// blob: the name of each section with its NUL terminator, then its contents.
+func UKIPCR(hash crypto.Hash, blob []byte) (*PCR, error) {
+	f, err := pe.NewFile(bytes.NewReader(blob))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse UKI: %w", err)
+	}
+	defer f.Close()
+
+	sections := make(map[string]*pe.Section)
+	for _, s := range f.Sections {
+		sections[strings.TrimRight(s.Name, "\x00")] = s
+	}
+	if sections[".linux"] == nil {
+		return nil, fmt.Errorf("not a UKI, the .linux section is missing")
+	}
+
+	pcr := NewPCR(hash)
+	for _, name := range ukiMeasuredSections {
+		s := sections[name]
+		if s == nil {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read UKI section %s: %w", name, err)
+		}
+		// The section is measured as loaded: its virtual size, zero filled
+		// beyond the raw data
+		if size := int(s.VirtualSize); size > 0 && size != len(data) {
+			if size < len(data) {
+				data = data[:size]
+			} else {
+				data = append(data, make([]byte, size-len(data))...)
+			}
+		}
+		pcr.Measure(append([]byte(name), 0))
+		pcr.Measure(data)
+	}
+	return pcr, nil
+}
+
+// PhasePCR returns PCR 11 after systemd-pcrphase measured the words of the
+// boot phase path, such as enter-initrd:leave-initrd, on top of the UKI
+// measurements in pcr.
+func PhasePCR(pcr *PCR, phase string) []byte {
+	p := pcr.Clone()
+	for _, word := range strings.Split(phase, ":") {
+		p.Measure([]byte(word))
+	}
+	return p.Value()
+}
@@ -0,0 +1,90 @@
+package imageos
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageboot"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/file"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+// bootEntryOSReleaseStage is where the os-release of a boot entry with its
+// own title is staged for ukify, next to the staged SBOM
+const bootEntryOSReleaseStage = "/boot/efi/.os-release-%s"
+
+// bootEntryOSRelease returns the os-release of the image with the title of
+// the boot entry as PRETTY_NAME, which systemd-boot shows in its menu
+func bootEntryOSRelease(osRelease, title string) string {
+	prettyName := fmt.Sprintf("PRETTY_NAME=\"%s\"", title)
+	var lines []string
+	replaced := false
+	for _, line := range strings.Split(strings.TrimRight(osRelease, "\n"), "\n") {
+		if strings.HasPrefix(line, "PRETTY_NAME=") {
+			line = prettyName
+			replaced = true
+		}
+		lines = append(lines, line)
+	}
+	if !replaced {
+		lines = append(lines, prettyName)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// bootEntryUKIOutputs returns one UKI per boot entry of the image, named
+// after the entry in EFI/Linux, and a function removing the os-release files
+// staged for their titles. The initramfs of every kernel booted besides the
+// default one is generated first.
+func bootEntryUKIOutputs(installRoot, espDir, defaultVersion string, template *config.ImageTemplate) ([]ukiOutput, func(), error) {
+	var staged []string
+	remove := func() {
+		for _, stage := range staged {
+			if _, err := shell.ExecCmd("rm -f "+filepath.Join(installRoot, stage), true, shell.HostPath, nil); err != nil {
+				log.Warnf("Failed to remove staged os-release %s: %v", stage, err)
+			}
+		}
+	}
+
+	updated := map[string]bool{defaultVersion: true}
+	var outputs []ukiOutput
+	for _, entry := range template.GetBootEntries() {
+		version, err := imageboot.ResolveBootEntryKernel(installRoot, entry.Kernel, defaultVersion)
+		if err != nil {
+			remove()
+			return nil, nil, fmt.Errorf("boot entry %s: %w", entry.ID, err)
+		}
+		if !updated[version] {
+			if err := updateInitramfs(installRoot, version, template); err != nil {
+				remove()
+				return nil, nil, fmt.Errorf("failed to update initramfs of kernel %s: %w", version, err)
+			}
+			updated[version] = true
+		}
+
+		output := ukiOutput{
+			path:          filepath.Join(espDir, "EFI", "Linux", entry.ID+".efi"),
+			kernelVersion: version,
+			extraCmdline:  entry.Cmdline,
+		}
+		if entry.Title != "" {
+			osRelease, err := shell.ExecCmd("cat /etc/os-release", true, installRoot, nil)
+			if err != nil {
+				remove()
+				log.Errorf("Failed to read os-release: %v", err)
+				return nil, nil, fmt.Errorf("failed to read os-release: %w", err)
+			}
+			stage := fmt.Sprintf(bootEntryOSReleaseStage, entry.ID)
+			if err := file.Write(bootEntryOSRelease(osRelease, entry.Title), filepath.Join(installRoot, stage)); err != nil {
+				remove()
+				return nil, nil, fmt.Errorf("failed to stage os-release of boot entry %s: %w", entry.ID, err)
+			}
+			staged = append(staged, stage)
+			output.osRelease = stage
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, remove, nil
+}
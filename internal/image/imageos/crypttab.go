@@ -0,0 +1,228 @@
+package imageos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imagedisc"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/file"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+const (
+	luksKeyDir             = "/etc/cryptsetup-keys.d"
+	luksTpm2EnrollScript   = "/usr/lib/os-image-composer/luks-tpm2-enroll.sh"
+	luksTpm2EnrollUnitName = "luks-tpm2-enroll.service"
+)
+
+// luksTpm2EnrollScriptContent enrolls the TPM2 into every LUKS2 container
+// marked tpm2-device=auto in /etc/crypttab, then wipes the one-time key the
+// image was built with and drops it from crypttab.
+const luksTpm2EnrollScriptContent = `#!/bin/sh
+set -e
+regenerate=0
+while read -r name device keyfile options; do
+	case "$name" in ''|\#*) continue ;; esac
+	case ",$options," in *,tpm2-device=auto,*) ;; *) continue ;; esac
+	[ -f "$keyfile" ] || continue
+	blockdev="$device"
+	case "$device" in UUID=*) blockdev="/dev/disk/by-uuid/${device#UUID=}" ;; esac
+	systemd-cryptenroll --unlock-key-file="$keyfile" --tpm2-device=auto --wipe-slot=password "$blockdev"
+	sed -i "s|^$name[[:space:]].*|$name $device none $options|" /etc/crypttab
+	rm -f "$keyfile"
+	regenerate=1
+done < /etc/crypttab
+# Drop the wiped keys from the initramfs
+if [ "$regenerate" = 1 ]; then
+	if command -v dracut >/dev/null; then
+		dracut --force --regenerate-all
+	elif command -v update-initramfs >/dev/null; then
+		update-initramfs -u -k all
+	fi
+fi
+`
+
+const luksTpm2EnrollUnitContent = `[Unit]
+Description=Enroll the TPM2 into LUKS2 volumes
+After=cryptsetup.target local-fs.target
+ConditionPathExists=/etc/crypttab
+
+[Service]
+Type=oneshot
+ExecStart=` + luksTpm2EnrollScript + `
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// encryptedPartitions returns the encrypted partitions of the template that
+// were created on the disk.
+func encryptedPartitions(diskPathIdMap map[string]string, template *config.ImageTemplate) []config.PartitionInfo {
+	var partitions []config.PartitionInfo
+	for _, partition := range template.GetDiskConfig().Partitions {
+		if _, ok := diskPathIdMap[partition.ID]; ok && partition.Encryption != nil {
+			partitions = append(partitions, partition)
+		}
+	}
+	return partitions
+}
+
+func hasEncryptedRoot(template *config.ImageTemplate) bool {
+	for _, partition := range template.GetDiskConfig().Partitions {
+		if partition.Encryption != nil && partition.MountPoint == "/" {
+			return true
+		}
+	}
+	return false
+}
+
+// isLuksKeyExposed reports whether the key of an encrypted partition unlocked
+// with a key file is readable without unlocking anything: the root key is
+// copied into the initramfs on the unencrypted ESP, other keys are stored on
+// the root filesystem, which only the TPM2 protects.
+func isLuksKeyExposed(partition config.PartitionInfo, template *config.ImageTemplate) bool {
+	if partition.Encryption.KeySource != "keyfile" {
+		return false
+	}
+	if partition.MountPoint == "/" {
+		return true
+	}
+	for _, root := range template.GetDiskConfig().Partitions {
+		if root.MountPoint == "/" && root.Encryption != nil {
+			return root.Encryption.KeySource != "tpm2"
+		}
+	}
+	return true
+}
+
+// crypttabEntry returns the /etc/crypttab line of an encrypted partition.
+// The root container is also unlocked by the initramfs.
+func crypttabEntry(partition config.PartitionInfo, luksUUID string) string {
+	options := []string{"luks"}
+	if partition.MountPoint == "/" {
+		options = append(options, "initramfs", "x-initrd.attach")
+	}
+	if partition.Encryption.KeySource == "tpm2" {
+		options = append(options, "tpm2-device=auto")
+	}
+	keyFile := filepath.Join(luksKeyDir, partition.LuksName()+".key")
+	return fmt.Sprintf("%s UUID=%s %s %s\n", partition.LuksName(), luksUUID, keyFile, strings.Join(options, ","))
+}
+
+// updateImageCrypttab installs the keys of the encrypted partitions into the
+// image and writes their /etc/crypttab entries. Partitions unlocked by the
+// TPM2 get a first-boot service that enrolls it and wipes the build-time key.
+func updateImageCrypttab(installRoot string, diskPathIdMap map[string]string, template *config.ImageTemplate) error {
+	partitions := encryptedPartitions(diskPathIdMap, template)
+	if len(partitions) == 0 {
+		return nil
+	}
+
+	crypttabPath := filepath.Join(installRoot, "etc", "crypttab")
+	keyDir := filepath.Join(installRoot, luksKeyDir)
+	needsTpm2Enroll := false
+	for _, partition := range partitions {
+		if isLuksKeyExposed(partition, template) {
+			log.Warnf("The key of encrypted partition %s is stored unencrypted in the image: anyone with the disk can unlock it. "+
+				"keySource keyfile is meant for provisioning only, use tpm2 to protect the partition at rest", partition.ID)
+		}
+		luksUUID, err := imagedisc.GetLuksUUID(partition.LuksName())
+		if err != nil {
+			return fmt.Errorf("failed to get LUKS UUID for partition %s: %w", partition.ID, err)
+		}
+
+		keyPath := filepath.Join(keyDir, partition.LuksName()+".key")
+		if err := file.CopyFile(imagedisc.LuksKeyFilePath(partition), keyPath, "", true); err != nil {
+			log.Errorf("Failed to install key for encrypted partition %s: %v", partition.ID, err)
+			return fmt.Errorf("failed to install key for encrypted partition %s: %w", partition.ID, err)
+		}
+		if _, err := shell.ExecCmd("chmod 0400 "+keyPath, true, shell.HostPath, nil); err != nil {
+			return fmt.Errorf("failed to set permissions on key for encrypted partition %s: %w", partition.ID, err)
+		}
+
+		entry := crypttabEntry(partition, luksUUID)
+		log.Debugf("Adding crypttab entry: %s", entry)
+		if err := file.Append(entry, crypttabPath); err != nil {
+			log.Errorf("Failed to append crypttab entry for %s: %v", partition.ID, err)
+			return fmt.Errorf("failed to append crypttab entry for %s: %w", partition.ID, err)
+		}
+		if partition.Encryption.KeySource == "tpm2" {
+			needsTpm2Enroll = true
+		}
+	}
+
+	if _, err := shell.ExecCmd("chmod 0700 "+keyDir, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", luksKeyDir, err)
+	}
+
+	if needsTpm2Enroll {
+		if err := addLuksTpm2EnrollService(installRoot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addLuksTpm2EnrollService(installRoot string) error {
+	scriptPath := filepath.Join(installRoot, luksTpm2EnrollScript)
+	if err := file.Write(luksTpm2EnrollScriptContent, scriptPath); err != nil {
+		log.Errorf("Failed to write TPM2 enrollment script: %v", err)
+		return fmt.Errorf("failed to write TPM2 enrollment script: %w", err)
+	}
+	if _, err := shell.ExecCmd("chmod 0755 "+scriptPath, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to set permissions on TPM2 enrollment script: %w", err)
+	}
+
+	unitPath := filepath.Join(installRoot, "etc", "systemd", "system", luksTpm2EnrollUnitName)
+	if err := file.Write(luksTpm2EnrollUnitContent, unitPath); err != nil {
+		log.Errorf("Failed to write TPM2 enrollment service: %v", err)
+		return fmt.Errorf("failed to write TPM2 enrollment service: %w", err)
+	}
+	cmd := "systemctl enable --root=\"" + installRoot + "\" " + luksTpm2EnrollUnitName
+	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to enable TPM2 enrollment service: %w", err)
+	}
+	return nil
+}
+
+// addLuksInitrdConfig makes the initramfs able to unlock an encrypted root
+// partition: dracut gets the crypt module, crypttab and the root key, and
+// cryptsetup-initramfs copies the keys referenced by crypttab.
+func addLuksInitrdConfig(installRoot string, diskPathIdMap map[string]string, template *config.ImageTemplate) error {
+	var rootKey string
+	for _, partition := range encryptedPartitions(diskPathIdMap, template) {
+		if partition.MountPoint == "/" {
+			rootKey = filepath.Join(luksKeyDir, partition.LuksName()+".key")
+		}
+	}
+	if rootKey == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(filepath.Join(installRoot, "usr", "lib", "dracut")); err == nil {
+		confPath := filepath.Join(installRoot, "etc", "dracut.conf.d", "90-luks.conf")
+		content := fmt.Sprintf("add_dracutmodules+=\" crypt \"\ninstall_items+=\" /etc/crypttab %s \"\n", rootKey)
+		if err := file.Write(content, confPath); err != nil {
+			log.Errorf("Failed to write dracut LUKS configuration %s: %v", confPath, err)
+			return fmt.Errorf("failed to write dracut LUKS configuration: %w", err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(installRoot, "etc", "cryptsetup-initramfs")); err == nil {
+		hookPath := filepath.Join(installRoot, "etc", "cryptsetup-initramfs", "conf-hook")
+		if err := file.Append(fmt.Sprintf("KEYFILE_PATTERN=\"%s/*.key\"\n", luksKeyDir), hookPath); err != nil {
+			log.Errorf("Failed to write cryptsetup-initramfs configuration: %v", err)
+			return fmt.Errorf("failed to write cryptsetup-initramfs configuration: %w", err)
+		}
+		// Keeps the embedded keys unreadable to other users
+		umaskPath := filepath.Join(installRoot, "etc", "initramfs-tools", "conf.d", "umask")
+		if err := file.Write("UMASK=0077\n", umaskPath); err != nil {
+			log.Errorf("Failed to write initramfs umask configuration: %v", err)
+			return fmt.Errorf("failed to write initramfs umask configuration: %w", err)
+		}
+	}
+	return nil
+}
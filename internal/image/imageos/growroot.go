@@ -0,0 +1,93 @@
+package imageos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/file"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+const (
+	growRootScript   = "/usr/lib/os-image-composer/grow-root.sh"
+	growRootStamp    = "/var/lib/os-image-composer/grow-root.done"
+	growRootUnitName = "grow-root.service"
+)
+
+// growRootScriptContent extends the partition holding / to the end of its
+// disk, then grows the filesystem online. sfdisk also moves the backup GPT
+// header to the end of the disk, and partx tells the kernel about the new
+// size of the partition while it is in use.
+const growRootScriptContent = `#!/bin/sh
+set -e
+device=$(readlink -f "$(findmnt -n -v -o SOURCE /)")
+fstype=$(findmnt -n -o FSTYPE /)
+name=$(basename "$device")
+if [ ! -f "/sys/class/block/$name/partition" ]; then
+	echo "root filesystem is not on a partition, nothing to grow"
+	exit 0
+fi
+partnum=$(cat "/sys/class/block/$name/partition")
+disk="/dev/$(lsblk -n -d -o PKNAME "$device")"
+echo ", +" | sfdisk --no-reread --no-tell-kernel -N "$partnum" "$disk"
+partx -u -n "$partnum" "$disk"
+case "$fstype" in
+	ext2|ext3|ext4) resize2fs "$device" ;;
+	xfs) xfs_growfs / ;;
+	btrfs) btrfs filesystem resize max / ;;
+esac
+mkdir -p "$(dirname ` + growRootStamp + `)"
+touch ` + growRootStamp + `
+`
+
+const growRootUnitContent = `[Unit]
+Description=Grow the root partition and filesystem to fill the disk
+After=local-fs.target
+ConditionPathExists=!` + growRootStamp + `
+
+[Service]
+Type=oneshot
+ExecStart=` + growRootScript + `
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// addGrowRootService installs the first-boot service growing the root
+// partition and filesystem to the size of the disk the image is written to.
+// It only relies on util-linux and the tools of the root filesystem, which
+// deb and rpm based images ship under the same names.
+func addGrowRootService(installRoot string, template *config.ImageTemplate) error {
+	if !template.GetDiskConfig().GrowRoot {
+		return nil
+	}
+	// sbin is a symlink to usr/sbin on merged /usr images
+	if _, err := os.Stat(filepath.Join(installRoot, "usr", "sbin", "sfdisk")); err != nil {
+		if _, err := os.Stat(filepath.Join(installRoot, "sbin", "sfdisk")); err != nil {
+			log.Errorf("growRoot requires sfdisk in the image")
+			return fmt.Errorf("growRoot requires sfdisk in the image, add the package providing it")
+		}
+	}
+
+	scriptPath := filepath.Join(installRoot, growRootScript)
+	if err := file.Write(growRootScriptContent, scriptPath); err != nil {
+		log.Errorf("Failed to write root grow script: %v", err)
+		return fmt.Errorf("failed to write root grow script: %w", err)
+	}
+	if _, err := shell.ExecCmd("chmod 0755 "+scriptPath, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to set permissions on root grow script: %w", err)
+	}
+
+	unitPath := filepath.Join(installRoot, "etc", "systemd", "system", growRootUnitName)
+	if err := file.Write(growRootUnitContent, unitPath); err != nil {
+		log.Errorf("Failed to write root grow service: %v", err)
+		return fmt.Errorf("failed to write root grow service: %w", err)
+	}
+	cmd := "systemctl enable --root=\"" + installRoot + "\" " + growRootUnitName
+	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to enable root grow service: %w", err)
+	}
+	return nil
+}
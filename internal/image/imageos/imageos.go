@@ -16,8 +16,10 @@ import (
 	"github.com/open-edge-platform/os-image-composer/internal/config/manifest"
 	"github.com/open-edge-platform/os-image-composer/internal/image/imageboot"
 	"github.com/open-edge-platform/os-image-composer/internal/image/imagedisc"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imagemeasure"
 	"github.com/open-edge-platform/os-image-composer/internal/image/imagesecure"
 	"github.com/open-edge-platform/os-image-composer/internal/image/imagesign"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageupdate"
 	"github.com/open-edge-platform/os-image-composer/internal/ospackage"
 	"github.com/open-edge-platform/os-image-composer/internal/ospackage/debutils"
 	"github.com/open-edge-platform/os-image-composer/internal/ospackage/rpmutils"
@@ -146,23 +148,41 @@ func (imageOs *ImageOs) InstallImageOs(diskPathIdMap map[string]string) (version
 		}
 	}()
 
+	// Partition images of the loopless builder are filled from the install
+	// root once the installation is complete, no partition is mounted
+	loopless := isPartitionImageMap(diskPathIdMap)
+	timestampDirs := []map[string]string{{"MountPoint": imageOs.installRoot}}
+
 	pkgType := imageOs.chrootEnv.GetTargetOsPkgType()
 	if pkgType == "deb" {
-		if err = mountDiskRootToChroot(imageOs.installRoot, diskPathIdMap, imageOs.template); err != nil {
-			err = fmt.Errorf("failed to mount disk root to chroot: %w", err)
-			return
+		if !loopless {
+			if err = mountDiskRootToChroot(imageOs.installRoot, diskPathIdMap, imageOs.template); err != nil {
+				err = fmt.Errorf("failed to mount disk root to chroot: %w", err)
+				return
+			}
+			mounted = true
 		}
-		mounted = true
 		if err = imageOs.initRootfsForDeb(imageOs.installRoot); err != nil {
 			err = fmt.Errorf("failed to initialize rootfs for deb: %w", err)
 			return
 		}
 	}
 
-	mountPointInfoList, err = imageOs.mountDiskToChroot(imageOs.installRoot, diskPathIdMap, imageOs.template)
-	if err != nil {
-		err = fmt.Errorf("failed to mount disk to chroot: %w", err)
-		return
+	if loopless {
+		if err = imageOs.mountSysfsToRootfs(imageOs.installRoot); err != nil {
+			return
+		}
+	} else {
+		mountPointInfoList, err = imageOs.mountDiskToChroot(imageOs.installRoot, diskPathIdMap, imageOs.template)
+		if err != nil {
+			err = fmt.Errorf("failed to mount disk to chroot: %w", err)
+			return
+		}
+		timestampDirs = mountPointInfoList
+		// A read-only root filesystem is built from the install root itself
+		if _, ok := imageOs.template.GetDiskConfig().ReadOnlyRoot(); ok {
+			timestampDirs = append([]map[string]string{{"MountPoint": imageOs.installRoot}}, timestampDirs...)
+		}
 	}
 	mounted = true
 
@@ -184,6 +204,12 @@ func (imageOs *ImageOs) InstallImageOs(diskPathIdMap map[string]string) (version
 		log.Warnf("Failed to fix kernel symlinks: %v (continuing anyway)", err)
 	}
 
+	// Before the initramfs picks the modules up
+	if err = imagesign.SignKernelModules(imageOs.installRoot, imageOs.template); err != nil {
+		err = fmt.Errorf("failed to sign kernel modules: %w", err)
+		return
+	}
+
 	log.Infof("Image system configuration...")
 	if err = updateImageConfig(imageOs.installRoot, diskPathIdMap, imageOs.template); err != nil {
 		err = fmt.Errorf("failed to update image config: %w", err)
@@ -208,15 +234,13 @@ func (imageOs *ImageOs) InstallImageOs(diskPathIdMap map[string]string) (version
 		return
 	}
 
-	log.Infof("Configuring UKI... ")
-	if err = buildImageUKI(imageOs.installRoot, imageOs.template); err != nil {
-		err = fmt.Errorf("failed to configure UKI: %w", err)
+	// The root filesystem may be sealed read-only by dm-verity while the
+	// UKI is built, so clamp its timestamps first
+	if err = clampImageTimestamps(timestampDirs, imageOs.template); err != nil {
 		return
 	}
 
-	log.Infof("Configuring Sign Image...")
-	if err = imagesign.SignImage(imageOs.installRoot, imageOs.template); err != nil {
-		err = fmt.Errorf("failed to sign image: %w", err)
+	if err = buildImageBootArtifacts(imageOs.installRoot, diskPathIdMap, imageOs.template); err != nil {
 		return
 	}
 
@@ -227,9 +251,117 @@ func (imageOs *ImageOs) InstallImageOs(diskPathIdMap map[string]string) (version
 		return
 	}
 
+	if err = embedSBOMInPartition(imageOs.installRoot, diskPathIdMap, imageOs.template); err != nil {
+		err = fmt.Errorf("failed to embed SBOM: %w", err)
+		return
+	}
+
+	// Catch files written to the ESP by UKI creation and signing
+	if err = clampImageTimestamps(timestampDirs, imageOs.template); err != nil {
+		return
+	}
+
+	if err = imagedisc.SnapshotBtrfsSubvolumes(imageOs.template, diskPathIdMap); err != nil {
+		err = fmt.Errorf("failed to snapshot btrfs subvolumes: %w", err)
+		return
+	}
+
 	return
 }
 
+// buildImageBootArtifacts builds and signs the UKIs of the image, then
+// predicts the PCR values of booting the signed UKIs from the ESP.
+func buildImageBootArtifacts(installRoot string, diskPathIdMap map[string]string, template *config.ImageTemplate) error {
+	log.Infof("Configuring UKI... ")
+	if err := buildImageUKI(installRoot, diskPathIdMap, template); err != nil {
+		return fmt.Errorf("failed to configure UKI: %w", err)
+	}
+
+	log.Infof("Configuring Sign Image...")
+	if err := imagesign.SignImage(installRoot, template); err != nil {
+		return fmt.Errorf("failed to sign image: %w", err)
+	}
+
+	return imagemeasure.WritePrediction(installRoot, template)
+}
+
+// clampImageTimestamps resets every file newer than SOURCE_DATE_EPOCH on the
+// image partitions to SOURCE_DATE_EPOCH for reproducible builds.
+func clampImageTimestamps(mountPointInfoList []map[string]string, template *config.ImageTemplate) error {
+	if !template.IsReproducible() {
+		return nil
+	}
+	epoch, err := config.GetSourceDateEpoch()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Clamping image timestamps to %s", epoch.Format(time.RFC3339))
+	for _, mountPointInfo := range mountPointInfoList {
+		mountPoint := mountPointInfo["MountPoint"]
+		cmd := fmt.Sprintf("find %s -xdev -newermt @%d -exec touch --no-dereference --date=@%d {} +",
+			mountPoint, epoch.Unix(), epoch.Unix())
+		if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+			log.Errorf("Failed to clamp timestamps under %s: %v", mountPoint, err)
+			return fmt.Errorf("failed to clamp timestamps under %s: %w", mountPoint, err)
+		}
+	}
+	return nil
+}
+
+// embedSBOMInPartition copies the SBOM onto the ESP or a dedicated partition
+// once the bootloader setup no longer rewrites those filesystems.
+func embedSBOMInPartition(installRoot string, diskPathIdMap map[string]string, template *config.ImageTemplate) error {
+	placement, err := manifest.ResolveSBOMPlacement(template)
+	if err != nil {
+		return err
+	}
+	if placement.Location != manifest.SBOMLocationESP && placement.Location != manifest.SBOMLocationPartition {
+		return nil
+	}
+
+	partition := placement.Partition
+	if !isNonMountablePartition(*partition) {
+		return manifest.CopySBOMToDir(filepath.Join(installRoot, partition.MountPoint, placement.Dir))
+	}
+
+	// Partitions without a mount point are mounted just long enough to copy the SBOM
+	diskPartDev, ok := diskPathIdMap[partition.ID]
+	if !ok {
+		return fmt.Errorf("device for sbom partition %s not found", partition.ID)
+	}
+	if imagedisc.IsPartitionImage(diskPartDev) {
+		return fmt.Errorf("sbom partition %s needs a mount point with the loopless builder", partition.ID)
+	}
+	fsType := partition.FsType
+	if fsType == "fat32" || fsType == "fat16" {
+		fsType = "vfat"
+	}
+	mountDir := filepath.Join(config.TempDir(), "sbom-"+partition.ID)
+	if err := mount.MountPath(diskPartDev, mountDir, "-t "+fsType); err != nil {
+		return fmt.Errorf("failed to mount sbom partition %s: %w", partition.ID, err)
+	}
+	defer func() {
+		if err := mount.UmountAndDeletePath(mountDir); err != nil {
+			log.Warnf("Failed to unmount sbom partition %s: %v", partition.ID, err)
+		}
+	}()
+	return manifest.CopySBOMToDir(filepath.Join(mountDir, placement.Dir))
+}
+
+// reproducibleEnv returns the SOURCE_DATE_EPOCH environment for tools that
+// embed timestamps (dracut, ukify), or nil for regular builds.
+func reproducibleEnv(template *config.ImageTemplate) ([]string, error) {
+	if !template.IsReproducible() {
+		return nil, nil
+	}
+	epoch, err := config.GetSourceDateEpoch()
+	if err != nil {
+		return nil, err
+	}
+	return []string{fmt.Sprintf("%s=%d", config.SourceDateEpochEnv, epoch.Unix())}, nil
+}
+
 func (imageOs *ImageOs) initRootfsForDeb(installRoot string) error {
 	essentialPkgsList, err := imageOs.chrootEnv.GetChrootEnvEssentialPackageList()
 	if err != nil {
@@ -294,13 +426,20 @@ func (imageOs *ImageOs) umountSysfsFromRootfs(installRoot string) error {
 
 func mountDiskRootToChroot(installRoot string, diskPathIdMap map[string]string, template *config.ImageTemplate) error {
 	diskInfo := template.GetDiskConfig()
-	partions := diskInfo.Partitions
+	partions := diskInfo.GetVolumes()
 	for diskId, diskPath := range diskPathIdMap {
 		for _, partition := range partions {
 			if partition.ID == diskId {
 				if partition.MountPoint == "/" {
+					if config.IsReadOnlyFsType(partition.FsType) {
+						log.Debugf("Read-only root partition %s is built once installed", partition.ID)
+						return nil
+					}
 					mountPoint := filepath.Join(installRoot, partition.MountPoint)
 					mountFlags := fmt.Sprintf("-t %s", partition.FsType)
+					if subvol := partition.DefaultSubvolume(); subvol != nil {
+						mountFlags += " -o subvol=" + subvol.Name
+					}
 					if err := mount.MountPath(diskPath, mountPoint, mountFlags); err != nil {
 						log.Errorf("Failed to mount %s to %s: %v", diskPath, mountPoint, err)
 						return fmt.Errorf("failed to mount %s to %s: %w", diskPath, mountPoint, err)
@@ -314,6 +453,17 @@ func mountDiskRootToChroot(installRoot string, diskPathIdMap map[string]string,
 	return fmt.Errorf("no root partition found in diskPathIdMap")
 }
 
+// isPartitionImageMap reports whether the partitions of diskPathIdMap are
+// images of the loopless builder rather than devices.
+func isPartitionImageMap(diskPathIdMap map[string]string) bool {
+	for _, diskPath := range diskPathIdMap {
+		if !imagedisc.IsPartitionImage(diskPath) {
+			return false
+		}
+	}
+	return len(diskPathIdMap) > 0
+}
+
 func isSwapFsType(fsType string) bool {
 	return fsType == "swap" || fsType == "linux-swap"
 }
@@ -323,18 +473,49 @@ func isNonMountablePartition(partition config.PartitionInfo) bool {
 	return mountPoint == "" || mountPoint == "none" || isSwapFsType(partition.FsType)
 }
 
+// btrfsSubvolumeMounts returns the subvolumes of partition that have a mount
+// point of their own, that is every mounted subvolume except the default one,
+// which is mounted with the partition itself.
+func btrfsSubvolumeMounts(partition config.PartitionInfo) []config.BtrfsSubvolume {
+	var mounts []config.BtrfsSubvolume
+	for _, subvol := range partition.Subvolumes {
+		mountPoint := strings.TrimSpace(subvol.MountPoint)
+		if mountPoint == "" || mountPoint == "none" || mountPoint == partition.MountPoint {
+			continue
+		}
+		mounts = append(mounts, subvol)
+	}
+	return mounts
+}
+
 func (imageOs *ImageOs) mountDiskToChroot(installRoot string, diskPathIdMap map[string]string, template *config.ImageTemplate) ([]map[string]string, error) {
 	var mountPointInfoList []map[string]string
 	diskInfo := template.GetDiskConfig()
-	partions := diskInfo.Partitions
+	partions := diskInfo.GetVolumes()
 	for diskId, diskPath := range diskPathIdMap {
 		for _, partition := range partions {
 			if partition.ID == diskId {
+				for _, subvol := range btrfsSubvolumeMounts(partition) {
+					mountPointInfoList = append(mountPointInfoList, map[string]string{
+						"Id":         diskId,
+						"Path":       diskPath,
+						"MountPoint": filepath.Join(installRoot, subvol.MountPoint),
+						"Flags":      fmt.Sprintf("-t %s -o subvol=%s", partition.FsType, subvol.Name),
+					})
+				}
+
 				if isNonMountablePartition(partition) {
 					log.Debugf("Skipping non-mountable partition %s (fsType=%s, mountPoint=%q)",
 						partition.ID, partition.FsType, partition.MountPoint)
 					continue
 				}
+				// The OS is installed into the plain install root directory,
+				// the read-only filesystem is built from it before dm-verity
+				// hashes the partition
+				if config.IsReadOnlyFsType(partition.FsType) {
+					log.Debugf("Skipping read-only partition %s until the installation is complete", partition.ID)
+					continue
+				}
 
 				mountPointInfo := make(map[string]string)
 				mountPointInfo["Id"] = diskId
@@ -346,6 +527,8 @@ func (imageOs *ImageOs) mountDiskToChroot(installRoot string, diskPathIdMap map[
 					} else {
 						mountPointInfo["Flags"] = fmt.Sprintf("-t %s -o umask=0077", partition.FsType)
 					}
+				} else if subvol := partition.DefaultSubvolume(); subvol != nil {
+					mountPointInfo["Flags"] = fmt.Sprintf("-t %s -o subvol=%s", partition.FsType, subvol.Name)
 				} else {
 					mountPointInfo["Flags"] = fmt.Sprintf("-t %s", partition.FsType)
 				}
@@ -788,9 +971,27 @@ func updateImageConfig(installRoot string, diskPathIdMap map[string]string, temp
 	if err := addImageIDFile(installRoot, template); err != nil {
 		return fmt.Errorf("failed to add image ID file: %w", err)
 	}
+	if err := addSysupdateConfig(installRoot, template); err != nil {
+		return fmt.Errorf("failed to add sysupdate configuration: %w", err)
+	}
 	if err := updateImageFstab(installRoot, diskPathIdMap, template); err != nil {
 		return fmt.Errorf("failed to update image fstab: %w", err)
 	}
+	if err := addLvmInitrdConfig(installRoot, template); err != nil {
+		return fmt.Errorf("failed to add LVM initramfs configuration: %w", err)
+	}
+	if err := updateImageMdadmConf(installRoot, template); err != nil {
+		return fmt.Errorf("failed to update image mdadm configuration: %w", err)
+	}
+	if err := updateImageCrypttab(installRoot, diskPathIdMap, template); err != nil {
+		return fmt.Errorf("failed to update image crypttab: %w", err)
+	}
+	if err := addLuksInitrdConfig(installRoot, diskPathIdMap, template); err != nil {
+		return fmt.Errorf("failed to add LUKS initramfs configuration: %w", err)
+	}
+	if err := addGrowRootService(installRoot, template); err != nil {
+		return fmt.Errorf("failed to add root grow service: %w", err)
+	}
 	if err := createResolvConfSymlink(installRoot, template); err != nil {
 		return fmt.Errorf("failed to create resolv.conf: %w", err)
 	}
@@ -953,16 +1154,39 @@ func updateImageFstab(installRoot string, diskPathIdMap map[string]string, templ
 	log.Infof("Updating fstab for image: %s", template.GetImageName())
 	fstabFullPath := filepath.Join(installRoot, "etc", "fstab")
 	diskInfo := template.GetDiskConfig()
-	partitions := diskInfo.Partitions
+	partitions := diskInfo.GetVolumes()
 	for diskId, diskPath := range diskPathIdMap {
 		for _, partition := range partitions {
 			if partition.ID == diskId {
-				// Get the partition UUID and mount point
-				partUUID, err := imagedisc.GetPartUUID(diskPath)
-				if err != nil {
-					return fmt.Errorf("failed to get partition UUID for %s: %w", diskPath, err)
+				// LVM physical volumes and RAID members are assembled by the
+				// initramfs, not mounted
+				if partition.FsType == "lvm" || partition.FsType == "raid" {
+					continue
+				}
+
+				var mountId string
+				if diskInfo.VolumeGroupOf(diskId) != nil || partition.Encryption != nil {
+					// Logical volumes and opened LUKS containers have no
+					// partition UUID; their device-mapper name is stable as it
+					// comes from the template
+					mountId = diskPath
+				} else if diskInfo.RaidArrayOf(diskId) != nil || (len(diskInfo.MirrorPaths) > 0 && partition.MountPoint == "/boot/efi") {
+					// Arrays have no partition UUID, and the ESP copies on the
+					// mirror disks share the filesystem UUID, so either one
+					// can be mounted when a disk fails
+					uuid, err := imagedisc.GetUUID(diskPath)
+					if err != nil {
+						return fmt.Errorf("failed to get filesystem UUID for %s: %w", diskPath, err)
+					}
+					mountId = fmt.Sprintf("UUID=%s", uuid)
+				} else {
+					// Get the partition UUID and mount point
+					partUUID, err := imagedisc.GetPartUUID(diskPath)
+					if err != nil {
+						return fmt.Errorf("failed to get partition UUID for %s: %w", diskPath, err)
+					}
+					mountId = fmt.Sprintf("PARTUUID=%s", partUUID)
 				}
-				mountId := fmt.Sprintf("PARTUUID=%s", partUUID)
 				mountPoint := partition.MountPoint
 
 				// Get the filesystem type
@@ -996,11 +1220,31 @@ func updateImageFstab(installRoot string, diskPathIdMap map[string]string, templ
 					pass = disablePass // No pass value for swap
 				}
 
+				// squashfs and erofs are read-only and have no fsck
+				if config.IsReadOnlyFsType(fsType) {
+					pass = disablePass
+				}
+
+				// fsck.btrfs is a no-op, btrfs checks itself on mount
+				if fsType == "btrfs" {
+					pass = disablePass
+					if len(partition.Subvolumes) > 0 {
+						if err := appendBtrfsFstabEntries(fstabFullPath, mountId, partition); err != nil {
+							return err
+						}
+						if isNonMountablePartition(partition) {
+							continue
+						}
+						if subvol := partition.DefaultSubvolume(); subvol != nil {
+							options = btrfsSubvolumeOptions(*subvol, options)
+						}
+					}
+				}
+
 				newEntry := fmt.Sprintf("%v %v %v %v %v %v\n",
 					mountId, mountPoint, fsType, options, defaultDump, pass)
 				log.Debugf("Adding fstab entry: %s", newEntry)
-				err = file.Append(newEntry, fstabFullPath)
-				if err != nil {
+				if err := file.Append(newEntry, fstabFullPath); err != nil {
 					log.Errorf("Failed to append fstab entry for %s: %v", mountPoint, err)
 					return fmt.Errorf("failed to append fstab entry for %s: %w", mountPoint, err)
 				}
@@ -1010,6 +1254,55 @@ func updateImageFstab(installRoot string, diskPathIdMap map[string]string, templ
 	return nil
 }
 
+// btrfsSubvolumeOptions returns the fstab options that mount subvol, falling
+// back to the partition options when the subvolume has none of its own.
+func btrfsSubvolumeOptions(subvol config.BtrfsSubvolume, partitionOptions string) string {
+	options := partitionOptions
+	if subvol.MountOptions != "" {
+		options = subvol.MountOptions
+	}
+	return "subvol=" + subvol.Name + "," + options
+}
+
+// appendBtrfsFstabEntries adds an fstab entry for every btrfs subvolume with
+// its own mount point.
+func appendBtrfsFstabEntries(fstabFullPath, mountId string, partition config.PartitionInfo) error {
+	partitionOptions := "defaults"
+	if partition.MountOptions != "" {
+		partitionOptions = partition.MountOptions
+	}
+	for _, subvol := range btrfsSubvolumeMounts(partition) {
+		newEntry := fmt.Sprintf("%v %v %v %v %v %v\n",
+			mountId, subvol.MountPoint, "btrfs", btrfsSubvolumeOptions(subvol, partitionOptions), "0", "0")
+		log.Debugf("Adding fstab entry: %s", newEntry)
+		if err := file.Append(newEntry, fstabFullPath); err != nil {
+			log.Errorf("Failed to append fstab entry for %s: %v", subvol.MountPoint, err)
+			return fmt.Errorf("failed to append fstab entry for %s: %w", subvol.MountPoint, err)
+		}
+	}
+	return nil
+}
+
+// addLvmInitrdConfig makes dracut include the lvm module, so the initramfs
+// can activate a root filesystem on a logical volume. Images built with
+// initramfs-tools get the lvm2 hook from the lvm2 package itself.
+func addLvmInitrdConfig(installRoot string, template *config.ImageTemplate) error {
+	if len(template.GetDiskConfig().VolumeGroups) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(installRoot, "usr", "lib", "dracut")); os.IsNotExist(err) {
+		log.Debugf("dracut not installed in image, skipping LVM dracut configuration")
+		return nil
+	}
+
+	confPath := filepath.Join(installRoot, "etc", "dracut.conf.d", "90-lvm.conf")
+	if err := file.Write("add_dracutmodules+=\" lvm \"\n", confPath); err != nil {
+		log.Errorf("Failed to write dracut LVM configuration %s: %v", confPath, err)
+		return fmt.Errorf("failed to write dracut LVM configuration: %w", err)
+	}
+	return nil
+}
+
 func createResolvConfSymlink(installRoot string, template *config.ImageTemplate) error {
 	log.Infof("Creating resolv.conf for image: %s", template.GetImageName())
 	resolveConfPath := "/etc/resolv.conf"
@@ -1028,7 +1321,7 @@ func createResolvConfSymlink(installRoot string, template *config.ImageTemplate)
 	return nil
 }
 
-func buildImageUKI(installRoot string, template *config.ImageTemplate) error {
+func buildImageUKI(installRoot string, diskPathIdMap map[string]string, template *config.ImageTemplate) error {
 	bootloaderConfig := template.GetBootloaderConfig()
 	if bootloaderConfig.Provider == "systemd-boot" {
 		// 1. Update initramfs
@@ -1056,7 +1349,25 @@ func buildImageUKI(installRoot string, template *config.ImageTemplate) error {
 		}
 		log.Debugf("Succesfully Creating EspPath:", espDir)
 
-		outputPath := filepath.Join(espDir, "EFI", "Linux", "linux.efi")
+		outputs := []ukiOutput{{path: filepath.Join(espDir, "EFI", "Linux", "linux.efi")}}
+		if template.IsABUpdate() {
+			if outputs, err = slotUKIOutputs(installRoot, espDir, diskPathIdMap, template); err != nil {
+				return err
+			}
+		} else if len(template.GetBootEntries()) > 0 {
+			var removeStaged func()
+			if outputs, removeStaged, err = bootEntryUKIOutputs(installRoot, espDir, kernelVersion, template); err != nil {
+				return err
+			}
+			defer removeStaged()
+		}
+		if err := writeLoaderConf(installRoot, espDir, template); err != nil {
+			return err
+		}
+		if err := addSecureBootEnrollment(installRoot, espDir, template); err != nil {
+			return err
+		}
+		outputPath := outputs[0].path
 		log.Debugf("UKI Path:", outputPath)
 
 		cmdlineFile := filepath.Join("/boot", "cmdline.conf")
@@ -1092,7 +1403,7 @@ func buildImageUKI(installRoot string, template *config.ImageTemplate) error {
 			log.Warnf("outputPath does not exist at %s", outputPath)
 		}
 
-		if err := buildUKI(installRoot, kernelPath, initrdPath, cmdlineFile, outputPath, template); err != nil {
+		if err := buildUKI(installRoot, kernelPath, initrdPath, cmdlineFile, outputs, template); err != nil {
 			return fmt.Errorf("failed to build UKI: %w", err)
 		}
 		log.Debugf("UKI created successfully on:", outputPath)
@@ -1125,6 +1436,9 @@ func buildImageUKI(installRoot string, template *config.ImageTemplate) error {
 			}
 		}
 		log.Debugf("Bootloader copied successfully to:", dstBootloader)
+		if err := imageboot.InstallShimChain(installRoot, template); err != nil {
+			return err
+		}
 	} else {
 		log.Infof("Skipping UKI build for image: %s, bootloader provider is not systemd-boot", template.GetImageName())
 	}
@@ -1132,6 +1446,72 @@ func buildImageUKI(installRoot string, template *config.ImageTemplate) error {
 	return nil
 }
 
+// slotUKIOutputs returns the UKIs of an A/B image. The slot A UKI boots the
+// installed partitions from the ESP. The slot B UKI carries the PARTUUIDs of
+// the slot B partitions instead and goes to the update payload, the updater
+// installs it once the slot B partitions are written. Both names carry the
+// boot counter, systemd-boot falls back to the other slot when a slot keeps
+// failing to boot.
+func slotUKIOutputs(installRoot, espDir string, diskPathIdMap map[string]string, template *config.ImageTemplate) ([]ukiOutput, error) {
+	var pairs, labels []string
+	for _, slot := range template.SlotPartitions() {
+		slotA, err := imagedisc.GetPartUUID(diskPathIdMap[slot.ID])
+		if err != nil {
+			return nil, fmt.Errorf("failed to get partition UUID of slot A partition %s: %w", slot.ID, err)
+		}
+		slotBID := config.SlotBID(slot.ID)
+		slotBDev, ok := diskPathIdMap[slotBID]
+		if !ok {
+			log.Errorf("Slot B partition %s not found", slotBID)
+			return nil, fmt.Errorf("slot B partition %s not found", slotBID)
+		}
+		slotB, err := imagedisc.GetPartUUID(slotBDev)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get partition UUID of slot B partition %s: %w", slotBID, err)
+		}
+		pairs = append(pairs, slotA, slotB)
+		// systemd-sysupdate gives every version its own partition names
+		labels = append(labels, "PARTUUID="+slotA, "PARTLABEL="+config.SysupdateLabel(slot.ID, template.Image.Version))
+	}
+
+	payloadDir, err := imageupdate.PayloadDir(template)
+	if err != nil {
+		return nil, err
+	}
+	// Drop the payload of a previous build
+	if err := os.RemoveAll(payloadDir); err != nil {
+		return nil, fmt.Errorf("failed to clean up update payload directory %s: %w", payloadDir, err)
+	}
+	if err := os.MkdirAll(payloadDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create update payload directory %s: %w", payloadDir, err)
+	}
+
+	tries := template.BootTries()
+	slotBName := imageupdate.UKIName(imageupdate.SlotB, tries)
+	slotB := ukiOutput{
+		// /tmp is writable even while dm-verity seals the root filesystem
+		path:     filepath.Join("/tmp", slotBName),
+		hostPath: filepath.Join(payloadDir, slotBName),
+		cmdline:  strings.NewReplacer(pairs...),
+	}
+	if !template.HasUpdateBundle(config.UpdateBundleSysupdate) {
+		return []ukiOutput{
+			{path: filepath.Join(espDir, "EFI", "Linux", imageupdate.UKIName(imageupdate.SlotA, tries))},
+			slotB,
+		}, nil
+	}
+
+	// The slot A UKI is the one systemd-sysupdate would have installed, the
+	// bundle carries it without the boot counter
+	bundleName := imageupdate.SysupdateUKIName(template)
+	byLabel := strings.NewReplacer(labels...)
+	return []ukiOutput{
+		{path: filepath.Join(espDir, "EFI", "Linux", imageupdate.SysupdateInstalledUKIName(template)), cmdline: byLabel},
+		slotB,
+		{path: filepath.Join("/tmp", bundleName), hostPath: filepath.Join(payloadDir, bundleName), cmdline: byLabel},
+	}, nil
+}
+
 // Helper to get the current kernel version from the rootfs
 func getKernelVersion(installRoot string) (string, error) {
 	kernelDir := filepath.Join(installRoot, "boot")
@@ -1160,6 +1540,9 @@ func updateInitramfs(installRoot, kernelVersion string, template *config.ImageTe
 	cmdParts = append(cmdParts, "--force")
 	cmdParts = append(cmdParts, "--no-hostonly")
 	cmdParts = append(cmdParts, "--verbose")
+	if template.IsReproducible() {
+		cmdParts = append(cmdParts, "--reproducible")
+	}
 
 	// Add systemd-veritysetup module if immutability is enabled
 	if template.IsImmutabilityEnabled() {
@@ -1168,6 +1551,12 @@ func updateInitramfs(installRoot, kernelVersion string, template *config.ImageTe
 		cmdParts = append(cmdParts, "--add", "crypt")
 	}
 
+	// Mount a read-only root filesystem without relying on host-only module
+	// detection
+	if root, ok := template.GetDiskConfig().ReadOnlyRoot(); ok {
+		cmdParts = append(cmdParts, fmt.Sprintf("--add-drivers '%s'", root.FsType))
+	}
+
 	// Add cut utility for EMT images only
 	if template.Target.OS == "edge-microvisor-toolkit" {
 		log.Debugf("Adding /usr/bin/cut to initramfs for EMT image")
@@ -1177,6 +1566,21 @@ func updateInitramfs(installRoot, kernelVersion string, template *config.ImageTe
 	}
 	cmdParts = append(cmdParts, "--add", "systemd")
 
+	// Activate logical volumes holding the root filesystem
+	if len(template.GetDiskConfig().VolumeGroups) > 0 {
+		cmdParts = append(cmdParts, "--add", "lvm")
+	}
+
+	// Assemble the RAID arrays holding the root filesystem
+	if len(template.GetDiskConfig().RaidArrays) > 0 {
+		cmdParts = append(cmdParts, "--add", "mdraid")
+	}
+
+	// Unlock the LUKS container holding the root filesystem
+	if !template.IsImmutabilityEnabled() && hasEncryptedRoot(template) {
+		cmdParts = append(cmdParts, "--add", "crypt")
+	}
+
 	// Always add USB drivers
 	extraModules := strings.TrimSpace(template.SystemConfig.Kernel.EnableExtraModules)
 	if extraModules != "" {
@@ -1189,7 +1593,11 @@ func updateInitramfs(installRoot, kernelVersion string, template *config.ImageTe
 
 	// Execute single dracut command
 	cmd := strings.Join(cmdParts, " ")
-	_, err := shell.ExecCmd(cmd, true, installRoot, nil)
+	envVars, err := reproducibleEnv(template)
+	if err != nil {
+		return err
+	}
+	_, err = shell.ExecCmd(cmd, true, installRoot, envVars)
 	if err != nil {
 		if template.IsImmutabilityEnabled() {
 			log.Errorf("Failed to update initramfs with veritysetup and USB drivers: %v", err)
@@ -1267,7 +1675,7 @@ func replaceRootHashPH(input, newRootHash string) string {
 	return strings.Join(parts, " ")
 }
 
-func prepareVeritySetup(partPair, installRoot string) error {
+func prepareVeritySetup(partPair, installRoot string, template *config.ImageTemplate) error {
 	// Extract the first part of partPair (before the space)
 	parts := strings.Fields(partPair)
 	if len(parts) < 1 {
@@ -1276,12 +1684,20 @@ func prepareVeritySetup(partPair, installRoot string) error {
 	}
 	device := parts[0]
 
-	// Remount the device as read-only
-	remountCmd := fmt.Sprintf("mount -o remount,ro %s", device)
-	log.Debugf("Remounting device as read-only: %s", remountCmd)
-	if _, err := shell.ExecCmd(remountCmd, true, installRoot, nil); err != nil {
-		log.Errorf("Failed to remount %s as read-only: %v", device, err)
-		return fmt.Errorf("failed to remount %s as read-only: %w", device, err)
+	if root, ok := template.GetDiskConfig().ReadOnlyRoot(); ok {
+		// The read-only root filesystem is written to the device from the
+		// complete install root, before the scratch mounts below exist
+		if err := imagedisc.BuildReadOnlyFilesystem(template, root, device, installRoot); err != nil {
+			return fmt.Errorf("failed to build read-only root filesystem: %w", err)
+		}
+	} else {
+		// Remount the device as read-only
+		remountCmd := fmt.Sprintf("mount -o remount,ro %s", device)
+		log.Debugf("Remounting device as read-only: %s", remountCmd)
+		if _, err := shell.ExecCmd(remountCmd, true, installRoot, nil); err != nil {
+			log.Errorf("Failed to remount %s as read-only: %v", device, err)
+			return fmt.Errorf("failed to remount %s as read-only: %w", device, err)
+		}
 	}
 
 	// Create and mount /tmp for ukify (Python tempfile needs this)
@@ -1338,8 +1754,21 @@ func removeVerityTmp(installRoot string) {
 	}
 }
 
-func getVerityRootHash(partPair, installRoot string) (string, error) {
+func getVerityRootHash(partPair, installRoot string, template *config.ImageTemplate) (string, error) {
 	cmd := fmt.Sprintf(`veritysetup format %s`, partPair)
+	if template.IsReproducible() {
+		// Pin the otherwise random salt and superblock UUID
+		verityUUID, err := template.DeterministicUUID("verity/uuid")
+		if err != nil {
+			return "", err
+		}
+		saltUUID, err := template.DeterministicUUID("verity/salt")
+		if err != nil {
+			return "", err
+		}
+		salt := strings.ReplaceAll(saltUUID.String(), "-", "")
+		cmd = fmt.Sprintf(`veritysetup format --uuid=%s --salt=%s %s`, verityUUID, salt, partPair)
+	}
 	log.Debugf("Veritysetup Executing command:", cmd)
 	// runs on host
 	exists, _ := shell.IsCommandExist("ukify", installRoot)
@@ -1365,81 +1794,164 @@ func getVerityRootHash(partPair, installRoot string) (string, error) {
 	return "", fmt.Errorf("root hash not found in veritysetup output")
 }
 
+// stageUKISBOM copies the SBOM onto the ESP so ukify can embed it as the
+// .sbom section. It returns the staged path inside installRoot, or "" when the
+// template does not place the SBOM in the UKI.
+func stageUKISBOM(installRoot string, template *config.ImageTemplate) (string, error) {
+	placement, err := manifest.ResolveSBOMPlacement(template)
+	if err != nil {
+		return "", err
+	}
+	if placement.Location != manifest.SBOMLocationUKI {
+		return "", nil
+	}
+	if _, err := os.Stat(manifest.GeneratedSBOMPath()); err != nil {
+		log.Warnf("SBOM file not found at %s, UKI is built without %s section", manifest.GeneratedSBOMPath(), manifest.UKISBOMSection)
+		return "", nil
+	}
+
+	stage := "/boot/efi/.sbom-staging.json"
+	if err := file.CopyFile(manifest.GeneratedSBOMPath(), filepath.Join(installRoot, stage), "", true); err != nil {
+		return "", fmt.Errorf("failed to stage SBOM for UKI: %w", err)
+	}
+	return stage, nil
+}
+
+// ukiOutput is a UKI built from the kernel command line of the image
+type ukiOutput struct {
+	path          string            // path of the UKI inside the install root
+	hostPath      string            // host path the UKI is moved to once built, kept in place when empty
+	cmdline       *strings.Replacer // rewrites the kernel command line of the UKI, nil to keep it
+	kernelVersion string            // kernel of the UKI, the default kernel when empty
+	extraCmdline  string            // arguments appended to the kernel command line
+	osRelease     string            // os-release of the UKI inside the install root, /etc/os-release when empty
+}
+
 // Helper to build UKI using ukify
-func buildUKI(installRoot, kernelPath, initrdPath, cmdlineFile, outputPath string, template *config.ImageTemplate) error {
+func buildUKI(installRoot, kernelPath, initrdPath, cmdlineFile string, outputs []ukiOutput, template *config.ImageTemplate) error {
 	data, err := file.Read(filepath.Join(installRoot, cmdlineFile))
 	if err != nil {
 		log.Errorf("Failed to read cmdline file %s: %v", cmdlineFile, err)
 		return fmt.Errorf("failed to read cmdline file: %w", err)
 	}
 
+	ukiEnv, err := reproducibleEnv(template)
+	if err != nil {
+		return err
+	}
+
+	sbomStage, err := stageUKISBOM(installRoot, template)
+	if err != nil {
+		return err
+	}
+	if sbomStage != "" {
+		defer func() {
+			if _, err := shell.ExecCmd("rm -f "+filepath.Join(installRoot, sbomStage), true, shell.HostPath, nil); err != nil {
+				log.Warnf("Failed to remove staged UKI SBOM: %v", err)
+			}
+		}()
+	}
+
 	cmdlineStr := string(data)
 	if template.IsImmutabilityEnabled() {
 		partData := extractRootHashPH(cmdlineStr)
-		err := prepareVeritySetup(partData, installRoot)
+		err := prepareVeritySetup(partData, installRoot, template)
 		if err != nil {
 			return fmt.Errorf("failed to get root hash part: %w", err)
 		}
-		rootHashR, err := getVerityRootHash(partData, installRoot)
+		rootHashR, err := getVerityRootHash(partData, installRoot, template)
 		if err != nil {
 			return fmt.Errorf("failed to get verity root hash: %w", err)
 		}
 		cmdlineStr = replaceRootHashPH(cmdlineStr, rootHashR)
+		// Every UKI is built before the scratch mounts are gone
+		defer removeVerityTmp(installRoot)
+		// Set TMPDIR environment variable to use the mounted tmpfs
+		ukiEnv = append([]string{"TMPDIR=/tmp"}, ukiEnv...)
 	}
 
 	// runs on host
-	var cmd string
-	var backInstallRoot = installRoot
+	ukifyRoot := installRoot
 	exists, _ := shell.IsCommandExist("ukify", installRoot)
 	if !exists {
 		log.Debugf("Ukify not found, running ukify on host")
-		kernelPath = filepath.Join(installRoot, kernelPath)
-		initrdPath = filepath.Join(installRoot, initrdPath)
-		outputPath = filepath.Join(installRoot, outputPath)
-		osRelease := filepath.Join(installRoot, "/etc/os-release")
-		installRoot = shell.HostPath
-
-		cmd = fmt.Sprintf(
-			"ukify build --linux \"%s\" --initrd \"%s\" --cmdline \"%s\" --os-release @\"%s\" --output \"%s\"",
-			kernelPath,
-			initrdPath,
-			cmdlineStr,
-			osRelease,
-			outputPath,
-		)
+		ukifyRoot = shell.HostPath
+	}
 
-	} else {
-		cmd = fmt.Sprintf(
-			"ukify build --linux \"%s\" --initrd \"%s\" --cmdline \"%s\" --output \"%s\"",
-			kernelPath,
-			initrdPath,
-			cmdlineStr,
-			outputPath,
-		)
+	pcrArgs, removePCRKeys, err := stagePCRKeys(installRoot, !exists, template)
+	if err != nil {
+		return err
 	}
+	defer removePCRKeys()
 
-	log.Debugf("UKI Executing command:", cmd)
-	if template.IsImmutabilityEnabled() {
-		// Set TMPDIR environment variable to use the mounted tmpfs
-		envVars := []string{"TMPDIR=/tmp"}
-		_, err = shell.ExecCmd(cmd, true, installRoot, envVars)
-		if err != nil {
-			log.Errorf("Failed to build UKI with veritysetup: %v failing command: %s", err, cmd)
-			err = fmt.Errorf("failed to build UKI with veritysetup: %w", err)
+	for _, output := range outputs {
+		cmdline := cmdlineStr
+		if output.cmdline != nil {
+			cmdline = output.cmdline.Replace(cmdlineStr)
 		}
-		installRoot = backInstallRoot
-		removeVerityTmp(installRoot)
-	} else {
-		_, err = shell.ExecCmd(cmd, true, installRoot, nil)
-		if err != nil {
-			log.Errorf("non-immutable: Failed to build UKI: %v failing command %s", err, cmd)
-			err = fmt.Errorf("failed to build UKI: %w", err)
+		if output.extraCmdline != "" {
+			cmdline = strings.TrimSpace(cmdline) + " " + output.extraCmdline
+		}
+		kernel, initrd := kernelPath, initrdPath
+		if output.kernelVersion != "" {
+			kernel = filepath.Join("/boot", "vmlinuz-"+output.kernelVersion)
+			initrd = fmt.Sprintf("/boot/initramfs-%s.img", output.kernelVersion)
+		}
+
+		var cmd string
+		if !exists {
+			osRelease := filepath.Join(installRoot, "/etc/os-release")
+			if output.osRelease != "" {
+				osRelease = filepath.Join(installRoot, output.osRelease)
+			}
+			cmd = fmt.Sprintf(
+				"ukify build --linux \"%s\" --initrd \"%s\" --cmdline \"%s\" --os-release @\"%s\" --output \"%s\"",
+				filepath.Join(installRoot, kernel),
+				filepath.Join(installRoot, initrd),
+				cmdline,
+				osRelease,
+				filepath.Join(installRoot, output.path),
+			)
+			if sbomStage != "" {
+				cmd += fmt.Sprintf(" --section \"%s:@%s\"", manifest.UKISBOMSection, filepath.Join(installRoot, sbomStage))
+			}
 		} else {
-			log.Infof("non-immutable: Successfully built UKI: %v  command %s", err, cmd)
+			cmd = fmt.Sprintf(
+				"ukify build --linux \"%s\" --initrd \"%s\" --cmdline \"%s\" --output \"%s\"",
+				kernel,
+				initrd,
+				cmdline,
+				output.path,
+			)
+			if output.osRelease != "" {
+				cmd += fmt.Sprintf(" --os-release @\"%s\"", output.osRelease)
+			}
+			if sbomStage != "" {
+				cmd += fmt.Sprintf(" --section \"%s:@%s\"", manifest.UKISBOMSection, sbomStage)
+			}
 		}
+		cmd += pcrArgs
 
+		log.Debugf("UKI Executing command:", cmd)
+		if _, err := shell.ExecCmd(cmd, true, ukifyRoot, ukiEnv); err != nil {
+			if template.IsImmutabilityEnabled() {
+				log.Errorf("Failed to build UKI with veritysetup: %v failing command: %s", err, cmd)
+				return fmt.Errorf("failed to build UKI with veritysetup: %w", err)
+			}
+			log.Errorf("non-immutable: Failed to build UKI: %v failing command %s", err, cmd)
+			return fmt.Errorf("failed to build UKI: %w", err)
+		}
+		log.Infof("Successfully built UKI %s", output.path)
+
+		if output.hostPath != "" {
+			mvCmd := fmt.Sprintf("mv %s %s", filepath.Join(installRoot, output.path), output.hostPath)
+			if _, err := shell.ExecCmd(mvCmd, true, shell.HostPath, nil); err != nil {
+				log.Errorf("Failed to move UKI %s to %s: %v", output.path, output.hostPath, err)
+				return fmt.Errorf("failed to move UKI %s to %s: %w", output.path, output.hostPath, err)
+			}
+		}
 	}
-	return err
+	return nil
 }
 
 // Helper to copy the bootloader EFI file
@@ -1500,13 +2012,26 @@ func createUser(installRoot string, template *config.ImageTemplate) error {
 	for _, user := range template.SystemConfig.Users {
 		log.Infof("Creating user: %s", user.Name)
 
-		// Create the user with useradd command
-		// -m creates home directory, -s sets shell
-		cmd := fmt.Sprintf("useradd -m -s /bin/bash %s", user.Name)
-		output, err := shell.ExecCmdSilent(cmd, true, installRoot, nil)
+		// The keys are read first, a missing keys file fails before any change
+		authorizedKeys, err := template.GetUserAuthorizedKeys(user)
+		if err != nil {
+			return err
+		}
+
+		if user.GID != nil {
+			if err := ensureGroupIDExists(installRoot, user.Name, *user.GID, user.System); err != nil {
+				return fmt.Errorf("failed to ensure group %d of user %s exists: %w", *user.GID, user.Name, err)
+			}
+		}
+
+		output, err := shell.ExecCmdSilent(userAddCmd(user), true, installRoot, nil)
 		if err != nil {
 			if strings.Contains(output, "already exists") {
+				// Existing users, such as root, get the settings of the template
 				log.Warnf("User %s already exists", user.Name)
+				if err := modifyExistingUser(installRoot, user); err != nil {
+					return err
+				}
 			} else {
 				log.Errorf("Failed to create user %s: output: %s, err: %v", user.Name, output, err)
 				return fmt.Errorf("failed to create user %s: output: %s, err: %w", user.Name, output, err)
@@ -1518,7 +2043,7 @@ func createUser(installRoot string, template *config.ImageTemplate) error {
 			if err := setUserPassword(installRoot, user); err != nil {
 				return fmt.Errorf("failed to set password for user %s: %w", user.Name, err)
 			}
-		} else {
+		} else if !user.System && !user.LockPassword {
 			cmd := fmt.Sprintf("passwd -d %s", user.Name)
 			if _, err := shell.ExecCmd(cmd, true, installRoot, nil); err != nil {
 				log.Errorf("Failed to delete password for user %s: %v", user.Name, err)
@@ -1526,6 +2051,16 @@ func createUser(installRoot string, template *config.ImageTemplate) error {
 			}
 			log.Debugf("Deleted password for user %s (no password set)", user.Name)
 		}
+		if user.LockPassword {
+			cmd := fmt.Sprintf("usermod -L %s", user.Name)
+			if _, err := shell.ExecCmd(cmd, true, installRoot, nil); err != nil {
+				log.Errorf("Failed to lock password of user %s: %v", user.Name, err)
+				return fmt.Errorf("failed to lock password of user %s: %w", user.Name, err)
+			}
+		}
+		if err := setUserAging(installRoot, user); err != nil {
+			return err
+		}
 
 		// Collect requested groups and auto-add sudo groups when needed
 		groupCandidates := collectUserGroups(user, template)
@@ -1547,6 +2082,12 @@ func createUser(installRoot string, template *config.ImageTemplate) error {
 			return fmt.Errorf("user verification failed for %s: %w", user.Name, err)
 		}
 
+		if len(authorizedKeys) > 0 {
+			if err := installAuthorizedKeys(installRoot, user.Name, authorizedKeys); err != nil {
+				return fmt.Errorf("failed to install SSH keys of user %s: %w", user.Name, err)
+			}
+		}
+
 		if user.StartupScript != "" {
 			if err := configUserStartupScript(installRoot, user); err != nil {
 				return fmt.Errorf("failed to configure startup script for user %s: %w", user.Name, err)
@@ -1559,6 +2100,128 @@ func createUser(installRoot string, template *config.ImageTemplate) error {
 	return nil
 }
 
+// userAddCmd returns the useradd command creating the user. The home
+// directory is created or not explicitly, as the default differs between deb
+// and rpm targets: regular users get one, system users only with a home.
+func userAddCmd(user config.UserConfig) string {
+	args := []string{"useradd"}
+	if user.System {
+		args = append(args, "-r")
+	}
+	if user.System && user.Home == "" {
+		args = append(args, "-M")
+	} else {
+		args = append(args, "-m")
+	}
+	args = append(args, "-s", user.GetShell())
+	args = append(args, userIDArgs(user)...)
+	return strings.Join(append(args, user.Name), " ")
+}
+
+// userIDArgs returns the home directory and ID options shared by useradd and
+// usermod
+func userIDArgs(user config.UserConfig) []string {
+	var args []string
+	if user.Home != "" {
+		args = append(args, "-d", user.Home)
+	}
+	if user.UID != nil {
+		args = append(args, "-u", strconv.Itoa(*user.UID))
+	}
+	if user.GID != nil {
+		args = append(args, "-g", strconv.Itoa(*user.GID))
+	}
+	return args
+}
+
+// modifyExistingUser applies the shell, home directory and IDs set in the
+// template to a user that already exists in the image
+func modifyExistingUser(installRoot string, user config.UserConfig) error {
+	args := userIDArgs(user)
+	if user.Shell != "" {
+		args = append(args, "-s", user.Shell)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	cmd := fmt.Sprintf("usermod %s %s", strings.Join(args, " "), user.Name)
+	if _, err := shell.ExecCmd(cmd, true, installRoot, nil); err != nil {
+		log.Errorf("Failed to modify existing user %s: %v", user.Name, err)
+		return fmt.Errorf("failed to modify existing user %s: %w", user.Name, err)
+	}
+	return nil
+}
+
+// setUserAging sets the maximum password age and the expiry date of the
+// account
+func setUserAging(installRoot string, user config.UserConfig) error {
+	var args []string
+	if user.PasswordMaxAge > 0 {
+		args = append(args, "-M", strconv.Itoa(user.PasswordMaxAge))
+	}
+	if user.Expire != "" {
+		args = append(args, "-E", user.Expire)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	cmd := fmt.Sprintf("chage %s %s", strings.Join(args, " "), user.Name)
+	if _, err := shell.ExecCmd(cmd, true, installRoot, nil); err != nil {
+		log.Errorf("Failed to set password aging of user %s: %v", user.Name, err)
+		return fmt.Errorf("failed to set password aging of user %s: %w", user.Name, err)
+	}
+	return nil
+}
+
+// ensureGroupIDExists creates the primary group of a user, named after the
+// user, unless a group with the GID exists
+func ensureGroupIDExists(installRoot, name string, gid int, system bool) error {
+	if _, err := shell.ExecCmdSilent(fmt.Sprintf("getent group %d", gid), true, installRoot, nil); err == nil {
+		return nil
+	}
+	cmd := fmt.Sprintf("groupadd -g %d %s", gid, name)
+	if system {
+		cmd = fmt.Sprintf("groupadd -r -g %d %s", gid, name)
+	}
+	if _, err := shell.ExecCmd(cmd, true, installRoot, nil); err != nil {
+		return fmt.Errorf("groupadd failed: %w", err)
+	}
+	return nil
+}
+
+// installAuthorizedKeys writes the SSH public keys of the user to
+// ~/.ssh/authorized_keys, owned by the user and only readable by them
+func installAuthorizedKeys(installRoot, userName string, keys []string) error {
+	output, err := shell.ExecCmd("getent passwd "+userName, true, installRoot, nil)
+	if err != nil {
+		log.Errorf("Failed to look up home directory of user %s: %v", userName, err)
+		return fmt.Errorf("failed to look up home directory of user %s: %w", userName, err)
+	}
+	fields := strings.Split(strings.TrimSpace(output), ":")
+	if len(fields) < 6 || !filepath.IsAbs(fields[5]) {
+		return fmt.Errorf("no home directory for user %s", userName)
+	}
+	sshDir := filepath.Join(fields[5], ".ssh")
+	keysFile := filepath.Join(sshDir, "authorized_keys")
+
+	if err := file.Write(strings.Join(keys, "\n")+"\n", filepath.Join(installRoot, keysFile)); err != nil {
+		log.Errorf("Failed to write authorized keys of user %s: %v", userName, err)
+		return fmt.Errorf("failed to write authorized keys: %w", err)
+	}
+	for _, cmd := range []string{
+		fmt.Sprintf("chmod 700 %s", sshDir),
+		fmt.Sprintf("chmod 600 %s", keysFile),
+		fmt.Sprintf("chown -R %s: %s", userName, sshDir),
+	} {
+		if _, err := shell.ExecCmd(cmd, true, installRoot, nil); err != nil {
+			log.Errorf("Failed to set permissions of %s: %v", sshDir, err)
+			return fmt.Errorf("failed to set permissions of %s: %w", sshDir, err)
+		}
+	}
+	log.Debugf("Installed %d SSH keys for user %s", len(keys), userName)
+	return nil
+}
+
 func ensureGroupExists(installRoot, group string) error {
 	cmd := fmt.Sprintf("getent group %s", group)
 	if _, err := shell.ExecCmdSilent(cmd, true, installRoot, nil); err == nil {
@@ -1725,12 +2388,33 @@ func configUserStartupScript(installRoot string, user config.UserConfig) error {
 	return nil
 }
 func (imageOs *ImageOs) generateSBOM(installRoot string, template *config.ImageTemplate) (string, error) {
+	if _, err := manifest.ResolveSBOMPlacement(template); err != nil {
+		return "", fmt.Errorf("invalid sbom configuration: %w", err)
+	}
+
+	// Reproducible builds stamp the SBOM with SOURCE_DATE_EPOCH and derive
+	// its namespace from the template hash instead of the wall clock
+	var spdxOpts manifest.SPDXOptions
+	sBomTime := time.Now()
+	if template.IsReproducible() {
+		epoch, err := config.GetSourceDateEpoch()
+		if err != nil {
+			return "", err
+		}
+		templateHash, err := template.GetTemplateHash()
+		if err != nil {
+			return "", err
+		}
+		spdxOpts = manifest.SPDXOptions{Created: epoch, NamespaceSeed: templateHash}
+		sBomTime = epoch
+	}
+
 	pkgType := imageOs.chrootEnv.GetTargetOsPkgType()
-	sBomFNm := rpmutils.GenerateSPDXFileName(template.GetImageName())
+	sBomFNm := rpmutils.GenerateSPDXFileNameAt(template.GetImageName(), sBomTime)
 	cmd := "rpm -qa"
 	if pkgType == "deb" {
 		cmd = "dpkg -l | awk '/^ii/ {print $2}'"
-		sBomFNm = debutils.GenerateSPDXFileName(template.GetImageName())
+		sBomFNm = debutils.GenerateSPDXFileNameAt(template.GetImageName(), sBomTime)
 	}
 	manifest.DefaultSPDXFile = sBomFNm
 
@@ -1773,14 +2457,14 @@ func (imageOs *ImageOs) generateSBOM(installRoot string, template *config.ImageT
 
 	// Generate SPDX manifest, generated in temp directory
 	spdxFile := filepath.Join(config.TempDir(), manifest.DefaultSPDXFile)
-	if err := manifest.WriteSPDXToFile(finalPkgs, spdxFile); err != nil {
+	if err := manifest.WriteSPDXToFileWithOptions(finalPkgs, spdxFile, spdxOpts); err != nil {
 		log.Warnf("SPDX SBOM creation error: %v", err)
 	}
 	log.Infof("SPDX file created at %s", spdxFile)
 
-	// Copy SBOM into image filesystem
-	if err := manifest.CopySBOMToChroot(installRoot); err != nil {
-		log.Warnf("failed to copy SBOM into image filesystem: %v", err)
+	// Embed SBOM in the image filesystem and write the SBOM pointer file
+	if err := manifest.EmbedSBOMInRootfs(installRoot, template); err != nil {
+		log.Warnf("failed to embed SBOM into image filesystem: %v", err)
 		// Don't fail the build if SBOM copy fails, just log warning
 	}
 
@@ -1,6 +1,7 @@
 package imageos
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,8 +9,11 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
 	"github.com/open-edge-platform/os-image-composer/internal/chroot"
 	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imagedisc"
 	"github.com/open-edge-platform/os-image-composer/internal/ospackage"
 	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
 )
@@ -1473,7 +1477,7 @@ func TestGetVerityRootHashWithMock(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			shell.Default = shell.NewMockExecutor(tt.mockCommands)
 
-			result, err := getVerityRootHash("/dev/loop0", "/dev/loop1")
+			result, err := getVerityRootHash("/dev/loop0", "/dev/loop1", nil)
 
 			if tt.expectedError && err == nil {
 				t.Error("Expected error but got none")
@@ -1659,6 +1663,30 @@ func TestUpdateInitramfsVariants(t *testing.T) {
 		}
 	})
 
+	t.Run("read-only root filesystem driver included", func(t *testing.T) {
+		mockCommands := []shell.MockCommand{
+			{
+				Pattern: `sudo.*chroot.*dracut --force --no-hostonly --verbose --add systemd-veritysetup --add dm --add crypt --add-drivers 'erofs' --add systemd --kver 6\.1\.0 /boot/initramfs-6\.1\.0\.img`,
+				Output:  "ok",
+				Error:   nil,
+			},
+		}
+		shell.Default = shell.NewMockExecutor(mockCommands)
+
+		template := &config.ImageTemplate{
+			Target: config.TargetInfo{OS: "ubuntu"},
+			Disk: config.DiskConfig{Partitions: []config.PartitionInfo{
+				{ID: "rootfs", FsType: "erofs", MountPoint: "/"},
+			}},
+			SystemConfig: config.SystemConfig{Immutability: config.ImmutabilityConfig{Enabled: true}},
+		}
+
+		err := updateInitramfs("/tmp/test-initramfs", "6.1.0", template)
+		if err != nil {
+			t.Fatalf("updateInitramfs() returned unexpected error: %v", err)
+		}
+	})
+
 	t.Run("non-immutable command failure", func(t *testing.T) {
 		mockCommands := []shell.MockCommand{
 			{
@@ -1854,12 +1882,49 @@ func TestMountUmountSysfsErrorPaths(t *testing.T) {
 }
 
 func TestPrepareVeritySetupInvalidPair(t *testing.T) {
-	err := prepareVeritySetup("   ", "/tmp/install-root")
+	err := prepareVeritySetup("   ", "/tmp/install-root", &config.ImageTemplate{})
 	if err == nil || !strings.Contains(err.Error(), "invalid partPair") {
 		t.Fatalf("expected invalid partPair error, got: %v", err)
 	}
 }
 
+func TestPrepareVeritySetupReadOnlyRoot(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	installRoot := filepath.Join(tempDir, "root")
+	template := &config.ImageTemplate{
+		Disk: config.DiskConfig{Partitions: []config.PartitionInfo{
+			{ID: "rootfs", FsType: "squashfs", MountPoint: "/"},
+		}},
+		SystemConfig: config.SystemConfig{Immutability: config.ImmutabilityConfig{Enabled: true}},
+	}
+
+	// The root filesystem is built from the install root instead of being
+	// remounted read-only
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "^mount$", Output: "", Error: nil},
+		{Pattern: "mkdir -p .*/readonly-rootfs$", Output: "", Error: nil},
+		{Pattern: "mount --bind .*/root .*/readonly-rootfs$", Output: "", Error: nil},
+		{Pattern: "mksquashfs .*/readonly-rootfs /dev/loop0p2 -noappend -no-progress -mkfs-time [0-9]+ -all-time [0-9]+$", Output: "", Error: nil},
+		{Pattern: "rm -d .*/readonly-rootfs$", Output: "", Error: nil},
+		{Pattern: "mkdir -p .*/root/(tmp|boot/efi/tmp)$", Output: "", Error: nil},
+		{Pattern: "chroot .*/root (mount -t tmpfs tmpfs|chmod 1777) /(tmp|boot/efi/tmp)$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	if err := prepareVeritySetup("/dev/loop0p2 /dev/loop0p3", installRoot, template); err != nil {
+		t.Fatalf("prepareVeritySetup failed: %v", err)
+	}
+}
+
 // TestInitRootfsForDeb tests the initRootfsForDeb functionality
 func TestInitRootfsForDeb(t *testing.T) {
 	// Set up mock executor
@@ -2226,6 +2291,449 @@ func TestMountDiskToChrootSkipsNonMountablePartitions(t *testing.T) {
 	}
 }
 
+func btrfsTestTemplate() *config.ImageTemplate {
+	return &config.ImageTemplate{
+		Image:        config.ImageInfo{Name: "test-image"},
+		SystemConfig: config.SystemConfig{Name: "test-system"},
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+				{ID: "rootfs", FsType: "btrfs", MountPoint: "/", Subvolumes: []config.BtrfsSubvolume{
+					{Name: "@", MountPoint: "/"},
+					{Name: "@home", MountPoint: "/home", MountOptions: "noatime"},
+					{Name: "@var", MountPoint: "/var"},
+					{Name: "@swap"},
+				}},
+			},
+		},
+	}
+}
+
+func TestBtrfsSubvolumeMounts(t *testing.T) {
+	partition := btrfsTestTemplate().Disk.Partitions[1]
+	mounts := btrfsSubvolumeMounts(partition)
+	if len(mounts) != 2 || mounts[0].Name != "@home" || mounts[1].Name != "@var" {
+		t.Fatalf("expected @home and @var mounts, got %+v", mounts)
+	}
+
+	if got := btrfsSubvolumeOptions(mounts[0], "defaults"); got != "subvol=@home,noatime" {
+		t.Errorf("unexpected options for @home: %q", got)
+	}
+	if got := btrfsSubvolumeOptions(mounts[1], "defaults"); got != "subvol=@var,defaults" {
+		t.Errorf("unexpected options for @var: %q", got)
+	}
+}
+
+func TestMountDiskToChrootBtrfsSubvolumes(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	testDir := t.TempDir()
+	template := btrfsTestTemplate()
+	imageOs := &ImageOs{
+		installRoot: filepath.Join(testDir, template.SystemConfig.Name),
+		chrootEnv:   &MockChrootEnv{chrootImageBuildDir: testDir},
+		template:    template,
+	}
+	installRoot := imageOs.installRoot
+
+	// Only mounts that select the right subvolume succeed
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "^mount$", Output: "", Error: nil},
+		{Pattern: "mkdir -p ", Output: "", Error: nil},
+		{Pattern: "mount -t btrfs -o subvol=@ /dev/loop0p2 " + installRoot + "$", Output: "", Error: nil},
+		{Pattern: "mount -t btrfs -o subvol=@home /dev/loop0p2 " + installRoot + "/home$", Output: "", Error: nil},
+		{Pattern: "mount -t btrfs -o subvol=@var /dev/loop0p2 " + installRoot + "/var$", Output: "", Error: nil},
+		{Pattern: "mount -t vfat -o umask=0077 /dev/loop0p1 " + installRoot + "/boot/efi$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	diskPathIdMap := map[string]string{"boot": "/dev/loop0p1", "rootfs": "/dev/loop0p2"}
+	mountInfo, err := imageOs.mountDiskToChroot(installRoot, diskPathIdMap, template)
+	if err != nil {
+		t.Fatalf("mountDiskToChroot failed: %v", err)
+	}
+	if len(mountInfo) != 4 {
+		t.Fatalf("expected 4 mounts, got %v", mountInfo)
+	}
+	if mountInfo[0]["MountPoint"] != installRoot {
+		t.Errorf("expected root to be mounted first, got %v", mountInfo[0])
+	}
+}
+
+func lvmTestTemplate() *config.ImageTemplate {
+	return &config.ImageTemplate{
+		Image:        config.ImageInfo{Name: "test-image"},
+		SystemConfig: config.SystemConfig{Name: "test-system"},
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+				{ID: "pv0", FsType: "lvm"},
+			},
+			VolumeGroups: []config.VolumeGroupInfo{
+				{Name: "vg0", PhysicalVolumes: []string{"pv0"}, LogicalVolumes: []config.LogicalVolumeInfo{
+					{ID: "rootfs", Size: "4GiB", FsType: "ext4", MountPoint: "/"},
+					{ID: "var", Size: "0", FsType: "xfs", MountPoint: "/var"},
+				}},
+			},
+		},
+	}
+}
+
+func TestMountDiskToChrootLogicalVolumes(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	testDir := t.TempDir()
+	template := lvmTestTemplate()
+	imageOs := &ImageOs{
+		installRoot: filepath.Join(testDir, template.SystemConfig.Name),
+		chrootEnv:   &MockChrootEnv{chrootImageBuildDir: testDir},
+		template:    template,
+	}
+	installRoot := imageOs.installRoot
+
+	// The physical volume partition is never mounted
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "^mount$", Output: "", Error: nil},
+		{Pattern: "mkdir -p ", Output: "", Error: nil},
+		{Pattern: "mount -t ext4 /dev/mapper/vg0-rootfs " + installRoot + "$", Output: "", Error: nil},
+		{Pattern: "mount -t xfs /dev/mapper/vg0-var " + installRoot + "/var$", Output: "", Error: nil},
+		{Pattern: "mount -t vfat -o umask=0077 /dev/loop0p1 " + installRoot + "/boot/efi$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	diskPathIdMap := map[string]string{
+		"boot":   "/dev/loop0p1",
+		"pv0":    "/dev/loop0p2",
+		"rootfs": "/dev/mapper/vg0-rootfs",
+		"var":    "/dev/mapper/vg0-var",
+	}
+	mountInfo, err := imageOs.mountDiskToChroot(installRoot, diskPathIdMap, template)
+	if err != nil {
+		t.Fatalf("mountDiskToChroot failed: %v", err)
+	}
+	if len(mountInfo) != 3 {
+		t.Fatalf("expected 3 mounts, got %v", mountInfo)
+	}
+}
+
+func TestUpdateImageFstabLogicalVolumes(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	// Only the ESP is looked up by PARTUUID; logical volumes use their
+	// device-mapper path and the physical volume gets no entry
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "blkid /dev/loop0p1 -s PARTUUID -o value", Output: "1234-abcd\n", Error: nil},
+		{Pattern: "tee -a .*/etc/fstab", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	diskPathIdMap := map[string]string{
+		"boot":   "/dev/loop0p1",
+		"pv0":    "/dev/loop0p2",
+		"rootfs": "/dev/mapper/vg0-rootfs",
+		"var":    "/dev/mapper/vg0-var",
+	}
+	if err := updateImageFstab(tempDir, diskPathIdMap, lvmTestTemplate()); err != nil {
+		t.Fatalf("updateImageFstab failed: %v", err)
+	}
+}
+
+func TestAddLvmInitrdConfig(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	installRoot := filepath.Join(tempDir, "root")
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	// Nothing to do without volume groups or without dracut
+	if err := addLvmInitrdConfig(installRoot, btrfsTestTemplate()); err != nil {
+		t.Fatalf("expected no-op without volume groups, got %v", err)
+	}
+	if err := addLvmInitrdConfig(installRoot, lvmTestTemplate()); err != nil {
+		t.Fatalf("expected no-op without dracut, got %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(installRoot, "usr", "lib", "dracut"), 0755); err != nil {
+		t.Fatalf("Failed to create dracut dir: %v", err)
+	}
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mkdir -p ", Output: "", Error: nil},
+		{Pattern: "cp .*filewrite-.* .*/etc/dracut.conf.d/90-lvm.conf", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := addLvmInitrdConfig(installRoot, lvmTestTemplate()); err != nil {
+		t.Fatalf("addLvmInitrdConfig failed: %v", err)
+	}
+}
+
+func luksTestTemplate(keyFile string) *config.ImageTemplate {
+	return &config.ImageTemplate{
+		Image:        config.ImageInfo{Name: "test-image"},
+		SystemConfig: config.SystemConfig{Name: "test-system"},
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+				{ID: "rootfs", FsType: "ext4", MountPoint: "/", Encryption: &config.EncryptionConfig{KeySource: "tpm2"}},
+				{ID: "data", FsType: "ext4", MountPoint: "/data", Encryption: &config.EncryptionConfig{KeySource: "keyfile", KeyFile: keyFile}},
+			},
+		},
+	}
+}
+
+func TestCrypttabEntry(t *testing.T) {
+	template := luksTestTemplate("/keys/data.key")
+	root := crypttabEntry(template.Disk.Partitions[1], "1111")
+	if root != "luks-rootfs UUID=1111 /etc/cryptsetup-keys.d/luks-rootfs.key luks,initramfs,x-initrd.attach,tpm2-device=auto\n" {
+		t.Errorf("unexpected root entry %q", root)
+	}
+	data := crypttabEntry(template.Disk.Partitions[2], "2222")
+	if data != "luks-data UUID=2222 /etc/cryptsetup-keys.d/luks-data.key luks\n" {
+		t.Errorf("unexpected data entry %q", data)
+	}
+	if !hasEncryptedRoot(template) {
+		t.Error("expected encrypted root")
+	}
+}
+
+func TestIsLuksKeyExposed(t *testing.T) {
+	template := luksTestTemplate("/keys/data.key")
+	root, data := template.Disk.Partitions[1], template.Disk.Partitions[2]
+	// The data key lives on the TPM2-protected root
+	if isLuksKeyExposed(root, template) || isLuksKeyExposed(data, template) {
+		t.Error("expected no exposed key with a TPM2 root")
+	}
+	// A key file root ends up in the initramfs, and so does not protect
+	// the data key either
+	template.Disk.Partitions[1].Encryption.KeySource = "keyfile"
+	if !isLuksKeyExposed(template.Disk.Partitions[1], template) || !isLuksKeyExposed(data, template) {
+		t.Error("expected the root and data keys to be exposed")
+	}
+	template.Disk.Partitions[1].Encryption = nil
+	if !isLuksKeyExposed(data, template) {
+		t.Error("expected the data key to be exposed on an unencrypted root")
+	}
+}
+
+func TestUpdateImageCrypttab(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	installRoot := filepath.Join(tempDir, "root")
+	dataKey := filepath.Join(tempDir, "data.key")
+	rootKey := filepath.Join(tempDir, "luks-keys", "luks-rootfs.key")
+	for _, key := range []string{dataKey, rootKey} {
+		if err := os.MkdirAll(filepath.Dir(key), 0700); err != nil {
+			t.Fatalf("Failed to create key dir: %v", err)
+		}
+		if err := os.WriteFile(key, []byte("secret"), 0600); err != nil {
+			t.Fatalf("Failed to write key: %v", err)
+		}
+	}
+	template := luksTestTemplate(dataKey)
+	diskPathIdMap := map[string]string{
+		"boot":   "/dev/loop0p1",
+		"rootfs": "/dev/mapper/luks-rootfs",
+		"data":   "/dev/mapper/luks-data",
+	}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "cryptsetup status luks-rootfs$", Output: "  device:  /dev/loop0p2\n", Error: nil},
+		{Pattern: "cryptsetup status luks-data$", Output: "  device:  /dev/loop0p3\n", Error: nil},
+		{Pattern: "cryptsetup luksUUID /dev/loop0p[23]$", Output: "1111\n", Error: nil},
+		{Pattern: "mkdir -p ", Output: "", Error: nil},
+		{Pattern: "cp '.*/luks-keys/luks-rootfs.key' '.*/etc/cryptsetup-keys.d/luks-rootfs.key'", Output: "", Error: nil},
+		{Pattern: "cp '.*/data.key' '.*/etc/cryptsetup-keys.d/luks-data.key'", Output: "", Error: nil},
+		{Pattern: "chmod 0400 .*/etc/cryptsetup-keys.d/luks-(rootfs|data).key$", Output: "", Error: nil},
+		{Pattern: "chmod 0700 .*/etc/cryptsetup-keys.d$", Output: "", Error: nil},
+		{Pattern: "tee -a .*/etc/crypttab", Output: "", Error: nil},
+		{Pattern: "cp .*filewrite-.* .*/usr/lib/os-image-composer/luks-tpm2-enroll.sh", Output: "", Error: nil},
+		{Pattern: "chmod 0755 .*/luks-tpm2-enroll.sh$", Output: "", Error: nil},
+		{Pattern: "cp .*filewrite-.* .*/etc/systemd/system/luks-tpm2-enroll.service", Output: "", Error: nil},
+		{Pattern: "systemctl enable --root=.* luks-tpm2-enroll.service$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := updateImageCrypttab(installRoot, diskPathIdMap, template); err != nil {
+		t.Fatalf("updateImageCrypttab failed: %v", err)
+	}
+
+	// Images without encrypted partitions are left alone
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := updateImageCrypttab(installRoot, diskPathIdMap, lvmTestTemplate()); err != nil {
+		t.Fatalf("expected no-op, got %v", err)
+	}
+	if err := addLuksInitrdConfig(installRoot, diskPathIdMap, lvmTestTemplate()); err != nil {
+		t.Fatalf("expected no-op, got %v", err)
+	}
+}
+
+func TestAddLuksInitrdConfig(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	installRoot := filepath.Join(tempDir, "root")
+	for _, dir := range []string{"usr/lib/dracut", "etc/cryptsetup-initramfs"} {
+		if err := os.MkdirAll(filepath.Join(installRoot, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	diskPathIdMap := map[string]string{"rootfs": "/dev/mapper/luks-rootfs"}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mkdir -p ", Output: "", Error: nil},
+		{Pattern: "cp .*filewrite-.* .*/etc/dracut.conf.d/90-luks.conf", Output: "", Error: nil},
+		{Pattern: "tee -a .*/etc/cryptsetup-initramfs/conf-hook", Output: "", Error: nil},
+		{Pattern: "cp .*filewrite-.* .*/etc/initramfs-tools/conf.d/umask", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := addLuksInitrdConfig(installRoot, diskPathIdMap, luksTestTemplate("/keys/data.key")); err != nil {
+		t.Fatalf("addLuksInitrdConfig failed: %v", err)
+	}
+}
+
+func raidTestTemplate() *config.ImageTemplate {
+	return &config.ImageTemplate{
+		Image:        config.ImageInfo{Name: "test-image"},
+		SystemConfig: config.SystemConfig{Name: "test-system"},
+		Disk: config.DiskConfig{
+			Path:        "/dev/nvme0n1",
+			MirrorPaths: []string{"/dev/nvme1n1"},
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+				{ID: "md-root", FsType: "raid"},
+				{ID: "swap", FsType: "linux-swap"},
+			},
+			RaidArrays: []config.RaidArrayInfo{
+				{ID: "rootfs", Name: "root", Level: 1, Partition: "md-root", FsType: "ext4", MountPoint: "/"},
+			},
+		},
+	}
+}
+
+func TestUpdateImageFstabRaidArrays(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	// The array and the mirrored ESP are looked up by filesystem UUID, the
+	// swap partition of the primary disk by PARTUUID and the RAID member
+	// gets no entry
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "blkid /dev/nvme0n1p1 -s UUID -o value$", Output: "ABCD-1234\n", Error: nil},
+		{Pattern: "blkid /dev/md/root -s UUID -o value$", Output: "5678-efgh\n", Error: nil},
+		{Pattern: "blkid /dev/nvme0n1p3 -s PARTUUID -o value$", Output: "9999-0000\n", Error: nil},
+		{Pattern: "tee -a .*/etc/fstab", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	diskPathIdMap := map[string]string{
+		"boot":    "/dev/nvme0n1p1",
+		"md-root": "/dev/nvme0n1p2",
+		"swap":    "/dev/nvme0n1p3",
+		"rootfs":  "/dev/md/root",
+	}
+	if err := updateImageFstab(tempDir, diskPathIdMap, raidTestTemplate()); err != nil {
+		t.Fatalf("updateImageFstab failed: %v", err)
+	}
+}
+
+func TestUpdateImageMdadmConf(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	installRoot := filepath.Join(tempDir, "root")
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	// Nothing to do without arrays
+	if err := updateImageMdadmConf(installRoot, lvmTestTemplate()); err != nil {
+		t.Fatalf("expected no-op without RAID arrays, got %v", err)
+	}
+
+	detail := "ARRAY /dev/md/root metadata=1.2 name=any:root UUID=aaaa:bbbb:cccc:dddd\n"
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mdadm --detail --brief /dev/md/root$", Output: detail, Error: nil},
+		{Pattern: "tee -a .*/root/etc/mdadm.conf ", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := updateImageMdadmConf(installRoot, raidTestTemplate()); err != nil {
+		t.Fatalf("updateImageMdadmConf failed: %v", err)
+	}
+
+	// Debian based images keep the file under /etc/mdadm, and dracut based
+	// ones get the mdraid module
+	for _, dir := range []string{filepath.Join("etc", "mdadm"), filepath.Join("usr", "lib", "dracut")} {
+		if err := os.MkdirAll(filepath.Join(installRoot, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mdadm --detail --brief /dev/md/root$", Output: detail, Error: nil},
+		{Pattern: "tee -a .*/root/etc/mdadm/mdadm.conf ", Output: "", Error: nil},
+		{Pattern: "mkdir -p ", Output: "", Error: nil},
+		{Pattern: "cp .*filewrite-.* .*/etc/dracut.conf.d/90-mdraid.conf", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := updateImageMdadmConf(installRoot, raidTestTemplate()); err != nil {
+		t.Fatalf("updateImageMdadmConf failed: %v", err)
+	}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mdadm --detail", Output: "", Error: fmt.Errorf("no such device")},
+		{Pattern: ".*", Output: "", Error: nil},
+	})
+	if err := updateImageMdadmConf(installRoot, raidTestTemplate()); err == nil {
+		t.Fatal("expected error when the array details are unavailable")
+	}
+}
+
 // TestGetImageVersionInfo tests the getImageVersionInfo functionality
 func TestGetImageVersionInfoDetailed(t *testing.T) {
 	// Set up mock executor
@@ -2672,6 +3180,32 @@ func TestAddImageAdditionalFiles(t *testing.T) {
 	t.Log("addImageAdditionalFiles test completed")
 }
 
+// TestBuildImageBootArtifactsPrediction checks that raw image builds predict
+// the PCR values once the UKIs are built and signed
+func TestBuildImageBootArtifactsPrediction(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	template := &config.ImageTemplate{
+		Image:  config.ImageInfo{Name: "edge", Version: "1.2.0"},
+		Target: config.TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64", ImageType: "raw"},
+	}
+	installRoot := t.TempDir()
+	if err := buildImageBootArtifacts(installRoot, nil, template); err != nil {
+		t.Fatalf("expected no boot artifacts without systemd-boot, got %v", err)
+	}
+
+	// The ESP of the install root has no boot loader to measure
+	template.MeasuredBoot = config.MeasuredBootConfig{PCRPrivateKey: "/keys/pcr.key"}
+	err := buildImageBootArtifacts(installRoot, nil, template)
+	if err == nil || !strings.Contains(err.Error(), "failed to predict PCR values") {
+		t.Fatalf("expected the PCR prediction to read the ESP, got %v", err)
+	}
+}
+
 // TestBuildImageUKI tests the buildImageUKI function
 func TestBuildImageUKI(t *testing.T) {
 	// Set up mock executor
@@ -2767,7 +3301,7 @@ func TestBuildImageUKI(t *testing.T) {
 				},
 			}
 
-			err = buildImageUKI(tempDir, template)
+			err = buildImageUKI(tempDir, nil, template)
 
 			if tt.expectError {
 				if err == nil {
@@ -2960,7 +3494,7 @@ func TestBuildUKI(t *testing.T) {
 			cmdlineFile := "/etc/cmdline"
 			outputPath := "/boot/efi/EFI/Linux/test.efi"
 
-			err = buildUKI(tempDir, kernelPath, initrdPath, cmdlineFile, outputPath, template)
+			err = buildUKI(tempDir, kernelPath, initrdPath, cmdlineFile, []ukiOutput{{path: outputPath}}, template)
 
 			if tt.expectError {
 				if err == nil {
@@ -4076,6 +4610,85 @@ func TestUserManagementEdgeCases(t *testing.T) {
 	}
 }
 
+func TestUserAddCmd(t *testing.T) {
+	uid, gid := 1500, 1600
+	tests := []struct {
+		name string
+		user config.UserConfig
+		want string
+	}{
+		{"regular user", config.UserConfig{Name: "user"}, "useradd -m -s /bin/bash user"},
+		{"shell and home", config.UserConfig{Name: "user", Shell: "/bin/zsh", Home: "/srv/user"}, "useradd -m -s /bin/zsh -d /srv/user user"},
+		{"ids", config.UserConfig{Name: "user", UID: &uid, GID: &gid}, "useradd -m -s /bin/bash -u 1500 -g 1600 user"},
+		{"system user", config.UserConfig{Name: "svc", System: true}, "useradd -r -M -s /usr/sbin/nologin svc"},
+		{"system user with home", config.UserConfig{Name: "svc", System: true, Home: "/var/lib/svc"}, "useradd -r -m -s /usr/sbin/nologin -d /var/lib/svc svc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := userAddCmd(tt.user); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCreateUserAccountSettings(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	templatePath := filepath.Join(tempDir, "template.yml")
+	if err := os.WriteFile(filepath.Join(tempDir, "ops.pub"), []byte("# operators\nssh-ed25519 AAAAops ops@example.com\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gid := 990
+	template := createTestImageTemplate()
+	template.PathList = []string{templatePath}
+	template.SystemConfig.Users = []config.UserConfig{
+		{
+			Name:                  "svc",
+			System:                true,
+			GID:                   &gid,
+			SSHAuthorizedKeys:     []string{"ssh-ed25519 AAAAsvc svc@example.com"},
+			SSHAuthorizedKeysFile: "ops.pub",
+		},
+		{Name: "root", Shell: "/bin/sh", LockPassword: true, PasswordMaxAge: 90, Expire: "2030-01-31"},
+	}
+
+	installRoot := filepath.Join(tempDir, "root")
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `^sudo chroot .*/root getent group 990$`, Error: fmt.Errorf("exit status 2")},
+		{Pattern: `^sudo chroot .*/root groupadd -r -g 990 svc$`, Output: ""},
+		{Pattern: `^sudo chroot .*/root useradd -r -M -s /usr/sbin/nologin -g 990 svc$`, Output: ""},
+		{Pattern: `^sudo chroot .*/root grep '\^(svc|root):' /etc/(passwd|shadow)$`, Output: "ok"},
+		{Pattern: `^sudo chroot .*/root getent passwd svc$`, Output: "svc:x:990:990::/home/svc:/usr/sbin/nologin\n"},
+		{Pattern: `^sudo mkdir -p '.*/root/home/svc/\.ssh'$`, Output: ""},
+		{Pattern: `^sudo cp '.*/filewrite-.*' '.*/root/home/svc/\.ssh/authorized_keys'$`, Output: ""},
+		{Pattern: `^sudo chroot .*/root chmod 700 /home/svc/\.ssh$`, Output: ""},
+		{Pattern: `^sudo chroot .*/root chmod 600 /home/svc/\.ssh/authorized_keys$`, Output: ""},
+		{Pattern: `^sudo chroot .*/root chown -R svc: /home/svc/\.ssh$`, Output: ""},
+		{Pattern: `^sudo chroot .*/root useradd -m -s /bin/sh root$`, Output: "useradd: user 'root' already exists", Error: fmt.Errorf("exit status 9")},
+		{Pattern: `^sudo chroot .*/root usermod -s /bin/sh root$`, Output: ""},
+		{Pattern: `^sudo chroot .*/root usermod -L root$`, Output: ""},
+		{Pattern: `^sudo chroot .*/root chage -M 90 -E 2030-01-31 root$`, Output: ""},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := createUser(installRoot, template); err != nil {
+		t.Fatalf("createUser failed: %v", err)
+	}
+
+	template.SystemConfig.Users = []config.UserConfig{{Name: "svc", SSHAuthorizedKeysFile: "missing.pub"}}
+	if err := createUser(installRoot, template); err == nil || !strings.Contains(err.Error(), "missing.pub") {
+		t.Errorf("expected an error for a missing keys file, got %v", err)
+	}
+}
+
 // TestPasswordHashingAlgorithmSupport tests various password hashing algorithms
 func TestPasswordHashingAlgorithmSupport(t *testing.T) {
 	originalExecutor := shell.Default
@@ -5263,3 +5876,555 @@ func TestFixKernelSymlinksEdgeCases(t *testing.T) {
 		t.Error("Unexpected symlink created for regular file")
 	}
 }
+
+func TestUpdateImageFstabPartitionImages(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	template := &config.ImageTemplate{
+		Image: config.ImageInfo{Name: "test"},
+		Disk: config.DiskConfig{
+			Size:    "64MiB",
+			Builder: config.DiskBuilderLoopless,
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi", Start: "1MiB", End: "9MiB"},
+				{ID: "rootfs", FsType: "ext4", MountPoint: "/", Start: "9MiB", End: "0"},
+			},
+		},
+	}
+	assembler, err := imagedisc.NewDiskAssembler(filepath.Join(tempDir, "test.raw"), template)
+	if err != nil {
+		t.Fatalf("NewDiskAssembler failed: %v", err)
+	}
+	defer assembler.Cleanup()
+	diskPathIdMap := assembler.PartitionDevices()
+	if !isPartitionImageMap(diskPathIdMap) || isPartitionImageMap(map[string]string{"rootfs": "/dev/loop0p2"}) {
+		t.Fatal("partition images not told apart from devices")
+	}
+
+	// The partition UUIDs are chosen by the assembler, blkid is not involved
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "tee -a .*/etc/fstab", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := updateImageFstab(tempDir, diskPathIdMap, template); err != nil {
+		t.Fatalf("updateImageFstab failed: %v", err)
+	}
+}
+
+func TestAddGrowRootService(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	installRoot := filepath.Join(tempDir, "root")
+	template := &config.ImageTemplate{Disk: config.DiskConfig{Partitions: []config.PartitionInfo{
+		{ID: "rootfs", FsType: "ext4", MountPoint: "/"},
+	}}}
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	// Nothing to do unless requested
+	if err := addGrowRootService(installRoot, template); err != nil {
+		t.Fatalf("expected no-op without growRoot, got %v", err)
+	}
+
+	template.Disk.GrowRoot = true
+	if err := addGrowRootService(installRoot, template); err == nil || !strings.Contains(err.Error(), "requires sfdisk") {
+		t.Fatalf("expected missing sfdisk error, got %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(installRoot, "usr", "sbin"), 0755); err != nil {
+		t.Fatalf("Failed to create sbin: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(installRoot, "usr", "sbin", "sfdisk"), nil, 0755); err != nil {
+		t.Fatalf("Failed to create sfdisk: %v", err)
+	}
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mkdir -p ", Output: "", Error: nil},
+		{Pattern: "cp .*filewrite-.* .*/usr/lib/os-image-composer/grow-root.sh", Output: "", Error: nil},
+		{Pattern: "chmod 0755 .*/grow-root.sh$", Output: "", Error: nil},
+		{Pattern: "cp .*filewrite-.* .*/etc/systemd/system/grow-root.service", Output: "", Error: nil},
+		{Pattern: "systemctl enable --root=.* grow-root.service$", Output: "", Error: nil},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := addGrowRootService(installRoot, template); err != nil {
+		t.Fatalf("addGrowRootService failed: %v", err)
+	}
+
+	for _, expected := range []string{"sfdisk --no-reread --no-tell-kernel -N", "partx -u -n", "resize2fs", "xfs_growfs /"} {
+		if !strings.Contains(growRootScriptContent, expected) {
+			t.Errorf("grow script does not contain %q", expected)
+		}
+	}
+}
+
+func TestSlotUKIOutputs(t *testing.T) {
+	originalGlobal := config.Global()
+	global := config.DefaultGlobalConfig()
+	global.WorkDir = t.TempDir()
+	global.TempDir = t.TempDir()
+	config.SetGlobal(global)
+	defer config.SetGlobal(originalGlobal)
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `blkid /dev/loop0p2 -s PARTUUID`, Output: "aaaa-root\n"},
+		{Pattern: `blkid /dev/loop0p3 -s PARTUUID`, Output: "bbbb-root\n"},
+		{Pattern: `mkdir -p .*/boot/efi/loader`, Output: ""},
+		{Pattern: `cp .*loader/loader\.conf`, Output: ""},
+		{Pattern: `cat .*cmdline\.conf`, Output: "root=PARTUUID=aaaa-root ro quiet"},
+		{Pattern: `command -v ukify`, Output: "/usr/bin/ukify"},
+		// Each UKI must boot the partitions of its own slot
+		{Pattern: `ukify build .*PARTUUID=aaaa-root.*/tmp/linux-b\+2-0\.efi`, Error: fmt.Errorf("slot B UKI boots slot A")},
+		{Pattern: `ukify build .*PARTUUID=bbbb-root.*EFI/Linux/linux-a\+2-0\.efi`, Error: fmt.Errorf("slot A UKI boots slot B")},
+		{Pattern: `ukify build `, Output: ""},
+		{Pattern: `mv .*/tmp/linux-b\+2-0\.efi .*/update-b/linux-b\+2-0\.efi`, Output: ""},
+		{Pattern: `.*`, Error: fmt.Errorf("unexpected command")},
+	})
+
+	template := &config.ImageTemplate{
+		Target:       config.TargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64"},
+		SystemConfig: config.SystemConfig{Name: "ab"},
+		Disk: config.DiskConfig{Partitions: []config.PartitionInfo{
+			{ID: "boot", MountPoint: "/boot/efi"},
+			{ID: "rootfs", MountPoint: "/"},
+			{ID: "rootfs-b"},
+		}},
+		Updates: config.UpdatesConfig{Scheme: config.UpdateSchemeAB, Tries: 2},
+	}
+	diskPathIdMap := map[string]string{"boot": "/dev/loop0p1", "rootfs": "/dev/loop0p2", "rootfs-b": "/dev/loop0p3"}
+
+	installRoot := t.TempDir()
+	outputs, err := slotUKIOutputs(installRoot, "/boot/efi", diskPathIdMap, template)
+	if err != nil {
+		t.Fatalf("slotUKIOutputs failed: %v", err)
+	}
+	if len(outputs) != 2 || outputs[0].path != "/boot/efi/EFI/Linux/linux-a+2-0.efi" || outputs[0].hostPath != "" {
+		t.Fatalf("unexpected slot A UKI %+v", outputs)
+	}
+	if !strings.HasSuffix(outputs[1].hostPath, "/update-b/linux-b+2-0.efi") {
+		t.Errorf("unexpected slot B UKI destination %s", outputs[1].hostPath)
+	}
+	if got := outputs[1].cmdline.Replace("root=PARTUUID=aaaa-root"); got != "root=PARTUUID=bbbb-root" {
+		t.Errorf("unexpected slot B command line %s", got)
+	}
+
+	if err := buildUKI(installRoot, "/boot/vmlinuz", "/boot/initramfs.img", "/boot/cmdline.conf", outputs, template); err != nil {
+		t.Errorf("buildUKI failed: %v", err)
+	}
+
+	delete(diskPathIdMap, "rootfs-b")
+	if _, err := slotUKIOutputs(installRoot, "/boot/efi", diskPathIdMap, template); err == nil {
+		t.Error("expected an error without the slot B partition")
+	}
+}
+
+func TestSlotUKIOutputsSysupdate(t *testing.T) {
+	originalGlobal := config.Global()
+	global := config.DefaultGlobalConfig()
+	global.WorkDir = t.TempDir()
+	global.TempDir = t.TempDir()
+	config.SetGlobal(global)
+	defer config.SetGlobal(originalGlobal)
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `blkid /dev/loop0p2 -s PARTUUID`, Output: "aaaa-root\n"},
+		{Pattern: `blkid /dev/loop0p3 -s PARTUUID`, Output: "bbbb-root\n"},
+		{Pattern: `mkdir -p .*/boot/efi/loader`, Output: ""},
+		{Pattern: `cp .*loader/loader\.conf`, Output: ""},
+		{Pattern: `.*`, Error: fmt.Errorf("unexpected command")},
+	})
+
+	template := &config.ImageTemplate{
+		Image:        config.ImageInfo{Name: "edge", Version: "1.2.0"},
+		Target:       config.TargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64"},
+		SystemConfig: config.SystemConfig{Name: "ab"},
+		Disk: config.DiskConfig{Partitions: []config.PartitionInfo{
+			{ID: "boot", MountPoint: "/boot/efi"},
+			{ID: "rootfs", MountPoint: "/"},
+			{ID: "rootfs-b"},
+		}},
+		Updates: config.UpdatesConfig{Scheme: config.UpdateSchemeAB, Tries: 2, Bundles: []string{config.UpdateBundleSysupdate}},
+	}
+	diskPathIdMap := map[string]string{"boot": "/dev/loop0p1", "rootfs": "/dev/loop0p2", "rootfs-b": "/dev/loop0p3"}
+
+	outputs, err := slotUKIOutputs(t.TempDir(), "/boot/efi", diskPathIdMap, template)
+	if err != nil {
+		t.Fatalf("slotUKIOutputs failed: %v", err)
+	}
+	if len(outputs) != 3 || outputs[0].path != "/boot/efi/EFI/Linux/edge_1.2.0+2-0.efi" {
+		t.Fatalf("unexpected UKIs %+v", outputs)
+	}
+	// Versions installed by systemd-sysupdate are found by partition name
+	for _, i := range []int{0, 2} {
+		if got := outputs[i].cmdline.Replace("root=PARTUUID=aaaa-root"); got != "root=PARTLABEL=rootfs_1.2.0" {
+			t.Errorf("unexpected command line of %s: %s", outputs[i].path, got)
+		}
+	}
+	if !strings.HasSuffix(outputs[2].hostPath, "/update-b/edge_1.2.0.efi") {
+		t.Errorf("unexpected bundle UKI destination %s", outputs[2].hostPath)
+	}
+	if got := outputs[1].cmdline.Replace("root=PARTUUID=aaaa-root"); got != "root=PARTUUID=bbbb-root" {
+		t.Errorf("unexpected slot B command line %s", got)
+	}
+}
+
+func TestAddSysupdateConfig(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	template := &config.ImageTemplate{
+		Image: config.ImageInfo{Name: "edge", Version: "1.2.0"},
+		Disk: config.DiskConfig{Partitions: []config.PartitionInfo{
+			{ID: "rootfs", Type: "linux-root-amd64", MountPoint: "/"},
+			{ID: "rootfs-b", Type: "linux-root-amd64"},
+		}},
+		Updates: config.UpdatesConfig{Scheme: config.UpdateSchemeAB, URL: "https://updates.example.com/edge"},
+	}
+	installRoot := filepath.Join(tempDir, "root")
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	// Nothing to do without the sysupdate bundle
+	if err := addSysupdateConfig(installRoot, template); err != nil {
+		t.Fatalf("expected no-op without sysupdate bundle, got %v", err)
+	}
+
+	entity, err := openpgp.NewEntity("Update Signer", "", "updates@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+	var priv bytes.Buffer
+	w, _ := armor.Encode(&priv, openpgp.PrivateKeyType, nil)
+	if err := entity.SerializePrivateWithoutSigning(w, nil); err != nil {
+		t.Fatalf("failed to serialize private key: %v", err)
+	}
+	w.Close()
+	template.Updates.SigningKey = filepath.Join(tempDir, "sysupdate.asc")
+	if err := os.WriteFile(template.Updates.SigningKey, priv.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	template.Updates.Bundles = []string{config.UpdateBundleSysupdate}
+
+	// An absolute os-release symlink resolves inside the image
+	if err := os.MkdirAll(filepath.Join(installRoot, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/usr/lib/os-release", filepath.Join(installRoot, "etc", "os-release")); err != nil {
+		t.Fatal(err)
+	}
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mkdir -p ", Output: ""},
+		{Pattern: "cp .*filewrite-.* .*/root/usr/lib/sysupdate.d/50-rootfs.transfer'$", Output: ""},
+		{Pattern: "cp .*filewrite-.* .*/root/usr/lib/sysupdate.d/90-uki.transfer'$", Output: ""},
+		{Pattern: "cp .*filewrite-.* .*/root/etc/systemd/import-pubring.gpg'$", Output: ""},
+		{Pattern: "cat .*/root/usr/lib/os-release", Output: "ID=azurelinux\nIMAGE_VERSION=1.1.0\n"},
+		{Pattern: "cp .*filewrite-.* .*/root/usr/lib/os-release'$", Output: ""},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := addSysupdateConfig(installRoot, template); err != nil {
+		t.Fatalf("addSysupdateConfig failed: %v", err)
+	}
+
+	template.Updates.SigningKey = filepath.Join(tempDir, "missing.asc")
+	if err := addSysupdateConfig(installRoot, template); err == nil {
+		t.Error("expected an error for a missing signing key")
+	}
+}
+
+// TestUpdateImageConfigSysupdate checks that raw images get the sysupdate
+// configuration through updateImageConfig
+func TestUpdateImageConfigSysupdate(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	template := &config.ImageTemplate{
+		Image:  config.ImageInfo{Name: "edge", Version: "1.2.0"},
+		Target: config.TargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64", ImageType: "raw"},
+		Disk: config.DiskConfig{Partitions: []config.PartitionInfo{
+			{ID: "rootfs", Type: "linux-root-amd64", MountPoint: "/"},
+			{ID: "rootfs-b", Type: "linux-root-amd64"},
+		}},
+		Updates: config.UpdatesConfig{
+			Scheme:  config.UpdateSchemeAB,
+			URL:     "https://updates.example.com/edge",
+			Bundles: []string{config.UpdateBundleSysupdate},
+		},
+	}
+	// Every other step succeeds; the first sysupdate transfer marks that
+	// addSysupdateConfig ran
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "cp .*/usr/lib/sysupdate.d/50-rootfs.transfer'$", Output: "", Error: fmt.Errorf("transfer reached")},
+		{Pattern: ".*", Output: "", Error: nil},
+	})
+	err := updateImageConfig(filepath.Join(tempDir, "root"), map[string]string{"rootfs": "/dev/loop0p2"}, template)
+	if err == nil || !strings.Contains(err.Error(), "sysupdate") || !strings.Contains(err.Error(), "transfer reached") {
+		t.Fatalf("expected updateImageConfig to write the sysupdate transfers, got %v", err)
+	}
+}
+
+func TestSecureBootEnrollment(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	newGlobal.ConfigDir = filepath.Join(tempDir, "config")
+	config.SetGlobal(newGlobal)
+
+	template := &config.ImageTemplate{
+		Image: config.ImageInfo{Name: "edge", Version: "1.2.0"},
+		SystemConfig: config.SystemConfig{Immutability: config.ImmutabilityConfig{
+			Enabled:        true,
+			SecureBootKeys: "lab",
+		}},
+	}
+	installRoot := filepath.Join(tempDir, "root")
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	// A key set alone only signs the image
+	if conf := loaderConf(template); conf != "" {
+		t.Errorf("expected no loader.conf, got %q", conf)
+	}
+	if err := writeLoaderConf(installRoot, "/boot/efi", template); err != nil {
+		t.Fatalf("expected no-op without loader.conf, got %v", err)
+	}
+	if err := addSecureBootEnrollment(installRoot, "/boot/efi", template); err != nil {
+		t.Fatalf("expected no-op without enrollment, got %v", err)
+	}
+
+	template.SystemConfig.Immutability.SecureBootEnroll = config.SecureBootEnrollIfSafe
+	if conf := loaderConf(template); conf != "secure-boot-enroll if-safe\n" {
+		t.Errorf("unexpected loader.conf %q", conf)
+	}
+	template.Updates = config.UpdatesConfig{Scheme: config.UpdateSchemeAB}
+	if conf := loaderConf(template); !strings.HasPrefix(conf, "timeout 0\n") || !strings.HasSuffix(conf, "\nsecure-boot-enroll if-safe\n") {
+		t.Errorf("unexpected A/B loader.conf %q", conf)
+	}
+
+	// The enrollment files must exist
+	if err := addSecureBootEnrollment(installRoot, "/boot/efi", template); err == nil {
+		t.Error("expected an error for a missing key set")
+	}
+
+	keySetDir := filepath.Join(newGlobal.ConfigDir, "keys", "lab")
+	if err := os.MkdirAll(keySetDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range config.SecureBootKeyNames {
+		if err := os.WriteFile(filepath.Join(keySetDir, name+".auth"), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `mkdir -p '.*/root/boot/efi/loader/keys/lab'$`, Output: ""},
+		{Pattern: `cp '.*/keys/lab/(PK|KEK|db)\.auth' '.*/root/boot/efi/loader/keys/lab/(PK|KEK|db)\.auth'$`, Output: ""},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := addSecureBootEnrollment(installRoot, "/boot/efi", template); err != nil {
+		t.Errorf("addSecureBootEnrollment failed: %v", err)
+	}
+}
+
+func TestStagePCRKeys(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+
+	tempDir := t.TempDir()
+	installRoot := filepath.Join(tempDir, "root")
+	template := &config.ImageTemplate{}
+	args, remove, err := stagePCRKeys(installRoot, false, template)
+	if err != nil || args != "" {
+		t.Fatalf("expected no-op without measured boot, got %q, %v", args, err)
+	}
+	remove()
+
+	privateKey := filepath.Join(tempDir, "pcr.key")
+	publicKey := filepath.Join(tempDir, "pcr.pub")
+	for _, path := range []string{privateKey, publicKey} {
+		if err := os.WriteFile(path, []byte("key"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	template.MeasuredBoot = config.MeasuredBootConfig{
+		PCRPrivateKey: privateKey,
+		Banks:         []string{"sha256", "sha384"},
+		Phases:        []string{"enter-initrd", "enter-initrd:leave-initrd"},
+	}
+
+	// ukify on the host reads the keys where they are
+	args, _, err = stagePCRKeys(installRoot, true, template)
+	if err != nil {
+		t.Fatalf("stagePCRKeys failed: %v", err)
+	}
+	want := fmt.Sprintf(` --pcr-private-key "%s" --pcr-banks sha256,sha384 --phases "enter-initrd enter-initrd:leave-initrd"`, privateKey)
+	if args != want {
+		t.Errorf("expected %q, got %q", want, args)
+	}
+
+	// ukify in the image reads them from a tmpfs
+	template.MeasuredBoot.PCRPublicKey = publicKey
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `^sudo mkdir -p .*/root/run/os-image-composer-pcr'?$`, Output: ""},
+		{Pattern: `^sudo mount -t tmpfs -o mode=0700 tmpfs .*/root/run/os-image-composer-pcr$`, Output: ""},
+		{Pattern: `^sudo cp '.*/pcr\.key' '.*/root/run/os-image-composer-pcr/pcr-private\.pem'$`, Output: ""},
+		{Pattern: `^sudo cp '.*/pcr\.pub' '.*/root/run/os-image-composer-pcr/pcr-public\.pem'$`, Output: ""},
+		{Pattern: `^sudo umount .*/root/run/os-image-composer-pcr$`, Output: ""},
+		{Pattern: `^sudo rm -rf .*/root/run/os-image-composer-pcr$`, Output: ""},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	args, remove, err = stagePCRKeys(installRoot, false, template)
+	if err != nil {
+		t.Fatalf("stagePCRKeys failed: %v", err)
+	}
+	defer remove()
+	if !strings.HasPrefix(args, ` --pcr-private-key "/run/os-image-composer-pcr/pcr-private.pem" --pcr-public-key "/run/os-image-composer-pcr/pcr-public.pem" --pcr-banks`) {
+		t.Errorf("unexpected ukify options %q", args)
+	}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mount -t tmpfs", Output: "", Error: fmt.Errorf("mount failed")},
+		{Pattern: ".*", Output: ""},
+	})
+	if _, _, err := stagePCRKeys(installRoot, false, template); err == nil {
+		t.Error("expected an error when the tmpfs cannot be mounted")
+	}
+}
+
+func TestBootEntryOSRelease(t *testing.T) {
+	osRelease := "NAME=\"Ubuntu\"\nPRETTY_NAME=\"Ubuntu 24.04 LTS\"\nID=ubuntu\n"
+	if got := bootEntryOSRelease(osRelease, "Recovery"); got != "NAME=\"Ubuntu\"\nPRETTY_NAME=\"Recovery\"\nID=ubuntu\n" {
+		t.Errorf("unexpected os-release %q", got)
+	}
+	if got := bootEntryOSRelease("ID=ubuntu", "Recovery"); got != "ID=ubuntu\nPRETTY_NAME=\"Recovery\"\n" {
+		t.Errorf("unexpected os-release %q", got)
+	}
+}
+
+func TestBootEntryUKIOutputs(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = tempDir
+	config.SetGlobal(newGlobal)
+
+	installRoot := filepath.Join(tempDir, "root")
+	if err := os.MkdirAll(filepath.Join(installRoot, "boot"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"6.8.0-generic", "6.8.0-rt", "6.9.0-rt"} {
+		if err := os.WriteFile(filepath.Join(installRoot, "boot", "vmlinuz-"+version), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	template := &config.ImageTemplate{SystemConfig: config.SystemConfig{Kernel: config.KernelConfig{
+		BootEntries: []config.BootEntry{
+			{ID: "production"},
+			{ID: "rt", Title: "Real-time", Kernel: "*-rt"},
+			{ID: "debug", Cmdline: "debug loglevel=7"},
+		},
+	}}}
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `^sudo chroot .*/root dracut .*--kver 6\.9\.0-rt`, Output: ""},
+		{Pattern: `^sudo chroot .*/root cat /etc/os-release$`, Output: "ID=ubuntu\nPRETTY_NAME=\"Ubuntu\"\n"},
+		{Pattern: `^sudo mkdir -p .*/root/boot/efi'?$`, Output: ""},
+		{Pattern: `^sudo cp '.*/filewrite-.*' '.*/root/boot/efi/\.os-release-rt'$`, Output: ""},
+		{Pattern: `^sudo rm -f .*/root/boot/efi/\.os-release-rt$`, Output: ""},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	outputs, remove, err := bootEntryUKIOutputs(installRoot, "/boot/efi", "6.8.0-generic", template)
+	if err != nil {
+		t.Fatalf("bootEntryUKIOutputs failed: %v", err)
+	}
+	defer remove()
+	if len(outputs) != 3 {
+		t.Fatalf("expected 3 UKIs, got %d", len(outputs))
+	}
+	if outputs[0].path != "/boot/efi/EFI/Linux/production.efi" || outputs[0].kernelVersion != "6.8.0-generic" || outputs[0].osRelease != "" {
+		t.Errorf("unexpected production UKI %+v", outputs[0])
+	}
+	if outputs[1].path != "/boot/efi/EFI/Linux/rt.efi" || outputs[1].kernelVersion != "6.9.0-rt" || outputs[1].osRelease != "/boot/efi/.os-release-rt" {
+		t.Errorf("unexpected rt UKI %+v", outputs[1])
+	}
+	if outputs[2].extraCmdline != "debug loglevel=7" || outputs[2].kernelVersion != "6.8.0-generic" {
+		t.Errorf("unexpected debug UKI %+v", outputs[2])
+	}
+
+	template.SystemConfig.Kernel.BootEntries = []config.BootEntry{{ID: "lts", Kernel: "5.*"}}
+	if _, _, err := bootEntryUKIOutputs(installRoot, "/boot/efi", "6.8.0-generic", template); err == nil {
+		t.Error("expected an error for a boot entry without a kernel")
+	}
+
+	// loader.conf selects the default entry and the timeout
+	timeout := 5
+	template.SystemConfig.Kernel.BootEntries = []config.BootEntry{{ID: "production"}, {ID: "debug"}}
+	template.SystemConfig.Bootloader = config.Bootloader{Timeout: &timeout, DefaultEntry: "debug"}
+	if conf := loaderConf(template); conf != "timeout 5\ndefault debug.efi\n" {
+		t.Errorf("unexpected loader.conf %q", conf)
+	}
+}
+
+func TestBuildUKIBootEntries(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	installRoot := t.TempDir()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `^sudo cat .*/boot/cmdline\.conf$`, Output: "root=/dev/sda2 ro quiet\n"},
+		{Pattern: `command -v ukify`, Output: "/usr/bin/ukify"},
+		{Pattern: `ukify build --linux "/boot/vmlinuz-6\.8\.0-generic" --initrd "/boot/initramfs-6\.8\.0-generic\.img" --cmdline "root=/dev/sda2 ro quiet\n" --output "/boot/efi/EFI/Linux/production\.efi"$`, Output: ""},
+		{Pattern: `ukify build --linux "/boot/vmlinuz-6\.9\.0-rt" --initrd "/boot/initramfs-6\.9\.0-rt\.img" --cmdline "root=/dev/sda2 ro quiet isolcpus=2" --output "/boot/efi/EFI/Linux/rt\.efi" --os-release @"/boot/efi/\.os-release-rt"$`, Output: ""},
+		{Pattern: ".*", Output: "", Error: fmt.Errorf("unexpected command")},
+	})
+	outputs := []ukiOutput{
+		{path: "/boot/efi/EFI/Linux/production.efi"},
+		{path: "/boot/efi/EFI/Linux/rt.efi", kernelVersion: "6.9.0-rt", extraCmdline: "isolcpus=2", osRelease: "/boot/efi/.os-release-rt"},
+	}
+	err := buildUKI(installRoot, "/boot/vmlinuz-6.8.0-generic", "/boot/initramfs-6.8.0-generic.img", "/boot/cmdline.conf", outputs, &config.ImageTemplate{})
+	if err != nil {
+		t.Errorf("buildUKI failed: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package imageos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imagedisc"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/file"
+)
+
+// mdadmConfPath returns the mdadm.conf location of the image: Debian based
+// distributions keep it under /etc/mdadm, the others directly in /etc.
+func mdadmConfPath(installRoot string) string {
+	if _, err := os.Stat(filepath.Join(installRoot, "etc", "mdadm")); err == nil {
+		return filepath.Join(installRoot, "etc", "mdadm", "mdadm.conf")
+	}
+	return filepath.Join(installRoot, "etc", "mdadm.conf")
+}
+
+// updateImageMdadmConf records the RAID arrays of the template in the
+// mdadm.conf of the image, and makes dracut include the mdraid module along
+// with that file, so the initramfs assembles the arrays under their names.
+// initramfs-tools picks up mdadm.conf through the hook of the mdadm package.
+func updateImageMdadmConf(installRoot string, template *config.ImageTemplate) error {
+	raidArrays := template.GetDiskConfig().RaidArrays
+	if len(raidArrays) == 0 {
+		return nil
+	}
+
+	arrayConf, err := imagedisc.GetRaidArrayConfig(raidArrays)
+	if err != nil {
+		return err
+	}
+	confPath := mdadmConfPath(installRoot)
+	log.Debugf("Adding RAID arrays to %s: %s", confPath, arrayConf)
+	if err := file.Append(arrayConf, confPath); err != nil {
+		log.Errorf("Failed to write mdadm configuration %s: %v", confPath, err)
+		return fmt.Errorf("failed to write mdadm configuration: %w", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(installRoot, "usr", "lib", "dracut")); os.IsNotExist(err) {
+		log.Debugf("dracut not installed in image, skipping mdraid dracut configuration")
+		return nil
+	}
+	dracutConfPath := filepath.Join(installRoot, "etc", "dracut.conf.d", "90-mdraid.conf")
+	if err := file.Write("add_dracutmodules+=\" mdraid \"\nmdadmconf=\"yes\"\n", dracutConfPath); err != nil {
+		log.Errorf("Failed to write dracut mdraid configuration %s: %v", dracutConfPath, err)
+		return fmt.Errorf("failed to write dracut mdraid configuration: %w", err)
+	}
+	return nil
+}
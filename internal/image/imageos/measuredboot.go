@@ -0,0 +1,76 @@
+package imageos
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/file"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+// pcrKeysStageDir holds the PCR signing keys while ukify runs in the image.
+// It is a tmpfs, so the private key never reaches the disk of the image.
+const pcrKeysStageDir = "/run/os-image-composer-pcr"
+
+// pcrSigningArgs returns the ukify options embedding the public key and the
+// PCR 11 policy signed with the private key into the UKI
+func pcrSigningArgs(measuredBoot config.MeasuredBootConfig, privateKey, publicKey string) string {
+	args := fmt.Sprintf(" --pcr-private-key \"%s\"", privateKey)
+	if publicKey != "" {
+		args += fmt.Sprintf(" --pcr-public-key \"%s\"", publicKey)
+	}
+	args += " --pcr-banks " + strings.Join(measuredBoot.PCRBanks(), ",")
+	if len(measuredBoot.Phases) > 0 {
+		args += fmt.Sprintf(" --phases \"%s\"", strings.Join(measuredBoot.Phases, " "))
+	}
+	return args
+}
+
+// stagePCRKeys returns the ukify options signing the PCR policy of the UKI,
+// or an empty string without measured boot, and a function removing the
+// keys staged for it. ukify running in the image reads the keys from a
+// tmpfs in the install root, on the host from where they are.
+func stagePCRKeys(installRoot string, onHost bool, template *config.ImageTemplate) (string, func(), error) {
+	measuredBoot := template.MeasuredBoot
+	if !measuredBoot.IsEnabled() {
+		return "", func() {}, nil
+	}
+	if onHost {
+		return pcrSigningArgs(measuredBoot, measuredBoot.PCRPrivateKey, measuredBoot.PCRPublicKey), func() {}, nil
+	}
+
+	stageDir := filepath.Join(installRoot, pcrKeysStageDir)
+	remove := func() {
+		if _, err := shell.ExecCmd("umount "+stageDir, true, shell.HostPath, nil); err != nil {
+			log.Warnf("Failed to unmount PCR key directory: %v", err)
+		}
+		if _, err := shell.ExecCmd("rm -rf "+stageDir, true, shell.HostPath, nil); err != nil {
+			log.Warnf("Failed to remove PCR key directory %s: %v", stageDir, err)
+		}
+	}
+	if _, err := shell.ExecCmd("mkdir -p "+stageDir, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to create PCR key directory: %v", err)
+		return "", nil, fmt.Errorf("failed to create PCR key directory: %w", err)
+	}
+	if _, err := shell.ExecCmd("mount -t tmpfs -o mode=0700 tmpfs "+stageDir, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to mount tmpfs on %s: %v", stageDir, err)
+		return "", nil, fmt.Errorf("failed to mount tmpfs for PCR keys: %w", err)
+	}
+
+	privateKey := filepath.Join(pcrKeysStageDir, "pcr-private.pem")
+	if err := file.CopyFile(measuredBoot.PCRPrivateKey, filepath.Join(installRoot, privateKey), "", true); err != nil {
+		remove()
+		return "", nil, fmt.Errorf("failed to stage PCR private key: %w", err)
+	}
+	publicKey := ""
+	if measuredBoot.PCRPublicKey != "" {
+		publicKey = filepath.Join(pcrKeysStageDir, "pcr-public.pem")
+		if err := file.CopyFile(measuredBoot.PCRPublicKey, filepath.Join(installRoot, publicKey), "", true); err != nil {
+			remove()
+			return "", nil, fmt.Errorf("failed to stage PCR public key: %w", err)
+		}
+	}
+	return pcrSigningArgs(measuredBoot, privateKey, publicKey), remove, nil
+}
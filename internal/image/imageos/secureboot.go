@@ -0,0 +1,71 @@
+package imageos
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageupdate"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/file"
+)
+
+// secureBootKeysESPDir is where systemd-boot looks for key sets to enroll
+const secureBootKeysESPDir = "/loader/keys"
+
+// loaderConf returns the systemd-boot loader.conf of the image, or an empty
+// string when systemd-boot runs with its defaults.
+func loaderConf(template *config.ImageTemplate) string {
+	var conf string
+	if template.IsABUpdate() {
+		conf = imageupdate.LoaderConf(template)
+	}
+	if timeout := template.GetBootloaderConfig().Timeout; timeout != nil {
+		conf += fmt.Sprintf("timeout %d\n", *timeout)
+	}
+	if id := template.DefaultBootEntry(); id != "" {
+		conf += fmt.Sprintf("default %s.efi\n", id)
+	}
+	if immutability := template.SystemConfig.Immutability; immutability.HasSecureBootEnrollment() {
+		conf += fmt.Sprintf("secure-boot-enroll %s\n", immutability.SecureBootEnroll)
+	}
+	return conf
+}
+
+// writeLoaderConf writes the systemd-boot loader.conf to the ESP
+func writeLoaderConf(installRoot, espDir string, template *config.ImageTemplate) error {
+	conf := loaderConf(template)
+	if conf == "" {
+		return nil
+	}
+	loaderConfPath := filepath.Join(installRoot, espDir, imageupdate.LoaderConfPath)
+	if err := file.Write(conf, loaderConfPath); err != nil {
+		log.Errorf("Failed to write systemd-boot loader.conf: %v", err)
+		return fmt.Errorf("failed to write systemd-boot loader.conf: %w", err)
+	}
+	return nil
+}
+
+// addSecureBootEnrollment places the PK, KEK and db enrollment files of the
+// Secure Boot key set on the ESP. In setup mode systemd-boot offers to enroll
+// them, or enrolls them on its own with the if-safe and force modes.
+func addSecureBootEnrollment(installRoot, espDir string, template *config.ImageTemplate) error {
+	immutability := template.SystemConfig.Immutability
+	if !immutability.HasSecureBootEnrollment() {
+		return nil
+	}
+
+	keySetDir, err := config.SecureBootKeySetDir(immutability.SecureBootKeys)
+	if err != nil {
+		return err
+	}
+	enrollDir := filepath.Join(installRoot, espDir, secureBootKeysESPDir, immutability.SecureBootKeys)
+	for _, name := range config.SecureBootKeyNames {
+		src := filepath.Join(keySetDir, name+".auth")
+		if err := file.CopyFile(src, filepath.Join(enrollDir, name+".auth"), "", true); err != nil {
+			log.Errorf("Failed to copy secure boot %s enrollment file: %v", name, err)
+			return fmt.Errorf("failed to copy secure boot %s enrollment file: %w", name, err)
+		}
+	}
+	log.Infof("Secure boot key set %s placed on the ESP for %s enrollment", immutability.SecureBootKeys, immutability.SecureBootEnroll)
+	return nil
+}
@@ -0,0 +1,87 @@
+package imageos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/artifactsign"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageupdate"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/file"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/system"
+)
+
+// addSysupdateConfig installs what systemd-sysupdate needs to consume the
+// sysupdate bundle of the image: the transfer files, the keyring verifying
+// the bundle signature, and the image name and version in os-release that the
+// transfers match the installed versions against.
+func addSysupdateConfig(installRoot string, template *config.ImageTemplate) error {
+	if !template.HasUpdateBundle(config.UpdateBundleSysupdate) {
+		return nil
+	}
+
+	transfers := imageupdate.SysupdateTransfers(template)
+	names := make([]string, 0, len(transfers))
+	for name := range transfers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		transferPath := filepath.Join(installRoot, imageupdate.SysupdateTransferDir, name)
+		if err := file.Write(transfers[name], transferPath); err != nil {
+			log.Errorf("Failed to write sysupdate transfer %s: %v", transferPath, err)
+			return fmt.Errorf("failed to write sysupdate transfer %s: %w", transferPath, err)
+		}
+	}
+
+	pubring, err := artifactsign.ExportGPGPublicKeys(template.Updates.SigningKey)
+	if err != nil {
+		return fmt.Errorf("failed to export sysupdate signing key: %w", err)
+	}
+	pubringPath := filepath.Join(installRoot, imageupdate.SysupdatePubring)
+	if err := file.Write(string(pubring), pubringPath); err != nil {
+		log.Errorf("Failed to write sysupdate keyring %s: %v", pubringPath, err)
+		return fmt.Errorf("failed to write sysupdate keyring %s: %w", pubringPath, err)
+	}
+
+	return updateOsReleaseImage(installRoot, template)
+}
+
+// updateOsReleaseImage sets IMAGE_ID and IMAGE_VERSION in the os-release of
+// the image.
+func updateOsReleaseImage(installRoot string, template *config.ImageTemplate) error {
+	osReleasePath := filepath.Join(installRoot, system.OsReleaseFile)
+	// /etc/os-release is usually a symlink to /usr/lib/os-release, which must
+	// resolve inside the image
+	if target, err := os.Readlink(osReleasePath); err == nil {
+		if filepath.IsAbs(target) {
+			osReleasePath = filepath.Join(installRoot, target)
+		} else {
+			osReleasePath = filepath.Join(filepath.Dir(osReleasePath), target)
+		}
+	}
+	content, err := file.Read(osReleasePath)
+	if err != nil {
+		log.Errorf("Failed to read os-release %s: %v", osReleasePath, err)
+		return fmt.Errorf("failed to read os-release %s: %w", osReleasePath, err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		if strings.HasPrefix(line, "IMAGE_ID=") || strings.HasPrefix(line, "IMAGE_VERSION=") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines,
+		fmt.Sprintf("IMAGE_ID=%s", template.Image.Name),
+		fmt.Sprintf("IMAGE_VERSION=%s", template.Image.Version))
+	if err := file.Write(strings.Join(lines, "\n")+"\n", osReleasePath); err != nil {
+		log.Errorf("Failed to update os-release %s: %v", osReleasePath, err)
+		return fmt.Errorf("failed to update os-release %s: %w", osReleasePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,421 @@
+package imageprovenance
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/config/version"
+	"github.com/open-edge-platform/os-image-composer/internal/image/artifactsign"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/logger"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/security"
+)
+
+const (
+	// StatementType is the in-toto statement type used for provenance documents
+	StatementType = "https://in-toto.io/Statement/v1"
+	// PredicateType is the SLSA provenance predicate type
+	PredicateType = "https://slsa.dev/provenance/v1"
+	// BuildType identifies the os-image-composer template build process
+	BuildType = "https://github.com/open-edge-platform/os-image-composer/buildtypes/image-template/v1"
+	// DefaultBuilderID is recorded when the template does not provide a builder ID
+	DefaultBuilderID = "https://github.com/open-edge-platform/os-image-composer"
+	// DSSEPayloadType is the DSSE payload type for in-toto statements
+	DSSEPayloadType = "application/vnd.in-toto+json"
+	// FileSuffix is appended to the image name to form the provenance file name
+	FileSuffix = ".intoto.json"
+)
+
+var log = logger.Logger()
+
+// DigestSet maps a digest algorithm to its hex encoded value
+type DigestSet map[string]string
+
+// ResourceDescriptor describes an artifact consumed or produced by the build
+type ResourceDescriptor struct {
+	Name   string    `json:"name,omitempty"`
+	URI    string    `json:"uri,omitempty"`
+	Digest DigestSet `json:"digest,omitempty"`
+}
+
+// Builder identifies the platform that produced the artifacts
+type Builder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+// BuildMetadata records invocation details of a single build
+type BuildMetadata struct {
+	InvocationID string     `json:"invocationId,omitempty"`
+	StartedOn    *time.Time `json:"startedOn,omitempty"`
+	FinishedOn   *time.Time `json:"finishedOn,omitempty"`
+}
+
+// BuildDefinition describes the inputs of the build
+type BuildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   map[string]any       `json:"externalParameters"`
+	InternalParameters   map[string]any       `json:"internalParameters,omitempty"`
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+// RunDetails describes the build invocation
+type RunDetails struct {
+	Builder  Builder       `json:"builder"`
+	Metadata BuildMetadata `json:"metadata"`
+}
+
+// Predicate is the SLSA v1 provenance predicate
+type Predicate struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+// Statement is an in-toto v1 statement carrying SLSA provenance
+type Statement struct {
+	Type          string               `json:"_type"`
+	Subject       []ResourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     Predicate            `json:"predicate"`
+}
+
+// Signature is a single DSSE signature
+type Signature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   string `json:"sig"`
+}
+
+// Envelope is a DSSE envelope wrapping a signed statement
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// GenerateProvenance builds the provenance statement for the artifacts found in
+// imageBuildDir and writes it next to them. When the template configures a signing
+// key, the statement is wrapped in a signed DSSE envelope. The path of the written
+// provenance file is returned.
+func GenerateProvenance(template *config.ImageTemplate, imageBuildDir string) (string, error) {
+	if template == nil {
+		return "", fmt.Errorf("image template is nil")
+	}
+
+	subjects, err := collectSubjects(imageBuildDir, template.GetBuildStartTime())
+	if err != nil {
+		return "", fmt.Errorf("failed to collect provenance subjects: %w", err)
+	}
+	if len(subjects) == 0 {
+		return "", fmt.Errorf("no build artifacts found in %s", imageBuildDir)
+	}
+
+	statement, err := NewStatement(template, subjects)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.MarshalIndent(statement, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal provenance statement: %w", err)
+	}
+
+	output := payload
+	if keyPath := template.GetProvenanceConfig().SigningKey; keyPath != "" {
+		envelope, err := SignStatement(payload, keyPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign provenance: %w", err)
+		}
+		output, err = json.MarshalIndent(envelope, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal provenance envelope: %w", err)
+		}
+	}
+
+	provenancePath := filepath.Join(imageBuildDir, template.GetImageName()+FileSuffix)
+	if err := security.SafeWriteFile(provenancePath, output, 0644, security.RejectSymlinks); err != nil {
+		return "", fmt.Errorf("failed to write provenance file %s: %w", provenancePath, err)
+	}
+
+	log.Infof("Provenance written to %s", provenancePath)
+	return provenancePath, nil
+}
+
+// NewStatement assembles the in-toto statement for the given subjects.
+func NewStatement(template *config.ImageTemplate, subjects []ResourceDescriptor) (*Statement, error) {
+	templateFiles, err := digestFiles(template.PathList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to digest template files: %w", err)
+	}
+
+	builderID := template.GetProvenanceConfig().BuilderID
+	if builderID == "" {
+		builderID = DefaultBuilderID
+	}
+
+	metadata := BuildMetadata{InvocationID: uuid.New().String()}
+	if start := template.GetBuildStartTime(); !start.IsZero() {
+		startedOn := start.UTC()
+		metadata.StartedOn = &startedOn
+	}
+	if finish := template.GetBuildFinishTime(); !finish.IsZero() {
+		finishedOn := finish.UTC()
+		metadata.FinishedOn = &finishedOn
+	}
+
+	return &Statement{
+		Type:          StatementType,
+		Subject:       subjects,
+		PredicateType: PredicateType,
+		Predicate: Predicate{
+			BuildDefinition: BuildDefinition{
+				BuildType: BuildType,
+				ExternalParameters: map[string]any{
+					"templates": templateFiles,
+					"image": map[string]string{
+						"name":    template.Image.Name,
+						"version": template.Image.Version,
+					},
+					"target": map[string]string{
+						"os":        template.Target.OS,
+						"dist":      template.Target.Dist,
+						"arch":      template.Target.Arch,
+						"imageType": template.Target.ImageType,
+					},
+				},
+				InternalParameters: map[string]any{
+					"toolname":     version.Toolname,
+					"organization": version.Organization,
+					"buildDate":    version.BuildDate,
+					"commitSHA":    version.CommitSHA,
+				},
+				ResolvedDependencies: resolvedDependencies(template),
+			},
+			RunDetails: RunDetails{
+				Builder: Builder{
+					ID:      builderID,
+					Version: map[string]string{version.Toolname: version.Version},
+				},
+				Metadata: metadata,
+			},
+		},
+	}, nil
+}
+
+// resolvedDependencies lists the configuration files and packages that went into the image.
+func resolvedDependencies(template *config.ImageTemplate) []ResourceDescriptor {
+	var deps []ResourceDescriptor
+
+	for _, pkg := range template.FullPkgListBom {
+		desc := ResourceDescriptor{
+			Name: pkg.Name,
+			URI:  pkg.URL,
+		}
+		if pkg.Version != "" {
+			desc.Name = pkg.Name + "@" + pkg.Version
+		}
+		for _, checksum := range pkg.Checksums {
+			if checksum.Value == "" {
+				continue
+			}
+			if desc.Digest == nil {
+				desc.Digest = DigestSet{}
+			}
+			desc.Digest[normalizeAlgorithm(checksum.Algorithm)] = strings.ToLower(checksum.Value)
+		}
+		deps = append(deps, desc)
+	}
+
+	sort.SliceStable(deps, func(i, j int) bool { return deps[i].Name < deps[j].Name })
+	return deps
+}
+
+// normalizeAlgorithm maps package checksum algorithm names to in-toto digest names.
+func normalizeAlgorithm(algorithm string) string {
+	name := strings.ToLower(strings.ReplaceAll(algorithm, "-", ""))
+	switch name {
+	case "sha256sum":
+		return "sha256"
+	case "sha512sum":
+		return "sha512"
+	case "sha1sum":
+		return "sha1"
+	}
+	return name
+}
+
+// digestFiles computes SHA256 digests for the given files.
+func digestFiles(paths []string) ([]ResourceDescriptor, error) {
+	var descs []ResourceDescriptor
+	for _, path := range paths {
+		sum, err := FileSHA256(path)
+		if err != nil {
+			return nil, err
+		}
+		descs = append(descs, ResourceDescriptor{
+			Name:   filepath.Base(path),
+			URI:    "file://" + path,
+			Digest: DigestSet{"sha256": sum},
+		})
+	}
+	return descs, nil
+}
+
+// collectSubjects returns digests of the regular files in dir that were written
+// during the current build. Previously written provenance files are skipped.
+func collectSubjects(dir string, since time.Time) ([]ResourceDescriptor, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+
+	var subjects []ResourceDescriptor
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasSuffix(entry.Name(), FileSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", entry.Name(), err)
+		}
+		if !since.IsZero() && info.ModTime().Before(since) {
+			continue
+		}
+		sum, err := FileSHA256(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, ResourceDescriptor{
+			Name:   entry.Name(),
+			Digest: DigestSet{"sha256": sum},
+		})
+	}
+	return subjects, nil
+}
+
+// FileSHA256 returns the hex encoded SHA256 digest of the file at path.
+func FileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// pae computes the DSSE pre-authentication encoding of a payload.
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s",
+		len(payloadType), payloadType, len(payload), payload))
+}
+
+// SignStatement wraps the payload in a DSSE envelope signed with the PEM private key at keyPath,
+// or the key in a PKCS#11 token keyPath is the URI of.
+func SignStatement(payload []byte, keyPath string) (*Envelope, error) {
+	signingKey, err := artifactsign.NewSigningKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := signingKey.Signer()
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, err := artifactsign.PublicKeyID(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := artifactsign.SignMessage(signer, pae(DSSEPayloadType, payload))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		PayloadType: DSSEPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []Signature{{KeyID: keyID, Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}, nil
+}
+
+// VerifyEnvelope checks that at least one envelope signature verifies against the
+// PEM public key at keyPath and returns the decoded payload.
+func VerifyEnvelope(envelope *Envelope, keyPath string) ([]byte, error) {
+	pub, err := artifactsign.LoadPEMPublicKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode envelope payload: %w", err)
+	}
+
+	message := pae(envelope.PayloadType, payload)
+	for _, signature := range envelope.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(signature.Sig)
+		if err != nil {
+			continue
+		}
+		if artifactsign.VerifyMessage(pub, message, sig) == nil {
+			return payload, nil
+		}
+	}
+	return nil, fmt.Errorf("no valid signature found for key %s", keyPath)
+}
+
+// ParseProvenance parses a provenance file that holds either a bare statement or a
+// DSSE envelope. The envelope is returned as nil for unsigned provenance.
+func ParseProvenance(data []byte) (*Statement, *Envelope, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse provenance: %w", err)
+	}
+
+	var envelope *Envelope
+	payload := data
+	if _, ok := probe["payloadType"]; ok {
+		envelope = &Envelope{}
+		if err := json.Unmarshal(data, envelope); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse provenance envelope: %w", err)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode envelope payload: %w", err)
+		}
+		payload = decoded
+	}
+
+	var statement Statement
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse provenance statement: %w", err)
+	}
+	if statement.Type != StatementType || statement.PredicateType != PredicateType {
+		return nil, nil, fmt.Errorf("unsupported provenance format %q / %q", statement.Type, statement.PredicateType)
+	}
+	return &statement, envelope, nil
+}
+
+// FindSubject returns the statement subject with the given name.
+func (s *Statement) FindSubject(name string) (*ResourceDescriptor, bool) {
+	for i := range s.Subject {
+		if s.Subject[i].Name == name {
+			return &s.Subject[i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,283 @@
+package imageprovenance
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/ospackage"
+)
+
+func writeKeyPair(t *testing.T, dir string, priv any, pub any) (string, string) {
+	t.Helper()
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("marshal private key: %v", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	privPath := filepath.Join(dir, "key.pem")
+	pubPath := filepath.Join(dir, "key.pub")
+	if err := os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		t.Fatalf("write private key: %v", err)
+	}
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		t.Fatalf("write public key: %v", err)
+	}
+	return privPath, pubPath
+}
+
+func newTestTemplate(t *testing.T, dir string) *config.ImageTemplate {
+	t.Helper()
+	templatePath := filepath.Join(dir, "template.yml")
+	if err := os.WriteFile(templatePath, []byte("image:\n  name: test\n"), 0644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	template := &config.ImageTemplate{
+		Image:  config.ImageInfo{Name: "test-image", Version: "1.0.0"},
+		Target: config.TargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64", ImageType: "raw"},
+		SystemConfig: config.SystemConfig{
+			Name: "minimal",
+		},
+		PathList: []string{templatePath},
+		FullPkgListBom: []ospackage.PackageInfo{
+			{
+				Name:      "zlib",
+				Version:   "1.3",
+				URL:       "https://example.com/zlib-1.3.rpm",
+				Checksums: []ospackage.Checksum{{Algorithm: "SHA256", Value: "ABCDEF"}},
+			},
+			{Name: "bash", Version: "5.2"},
+		},
+	}
+	template.StartBuildTimeline(time.Now().Add(-time.Minute))
+	template.MarkBuildFinished()
+	return template
+}
+
+func TestNewStatement(t *testing.T) {
+	dir := t.TempDir()
+	template := newTestTemplate(t, dir)
+
+	subjects := []ResourceDescriptor{{Name: "test.raw", Digest: DigestSet{"sha256": "00"}}}
+	statement, err := NewStatement(template, subjects)
+	if err != nil {
+		t.Fatalf("NewStatement failed: %v", err)
+	}
+
+	if statement.Type != StatementType || statement.PredicateType != PredicateType {
+		t.Errorf("unexpected statement types %q / %q", statement.Type, statement.PredicateType)
+	}
+	if statement.Predicate.RunDetails.Builder.ID != DefaultBuilderID {
+		t.Errorf("expected default builder ID, got %q", statement.Predicate.RunDetails.Builder.ID)
+	}
+	if statement.Predicate.RunDetails.Metadata.StartedOn == nil || statement.Predicate.RunDetails.Metadata.FinishedOn == nil {
+		t.Errorf("expected build start and finish times to be recorded")
+	}
+
+	deps := statement.Predicate.BuildDefinition.ResolvedDependencies
+	if len(deps) != 2 {
+		t.Fatalf("expected 2 resolved dependencies, got %d", len(deps))
+	}
+	if deps[0].Name != "bash@5.2" || deps[1].Name != "zlib@1.3" {
+		t.Errorf("dependencies not sorted by name: %+v", deps)
+	}
+	if deps[1].Digest["sha256"] != "abcdef" {
+		t.Errorf("expected normalized sha256 digest, got %+v", deps[1].Digest)
+	}
+
+	templates, ok := statement.Predicate.BuildDefinition.ExternalParameters["templates"].([]ResourceDescriptor)
+	if !ok || len(templates) != 1 || templates[0].Digest["sha256"] == "" {
+		t.Errorf("expected template digest in external parameters, got %+v", templates)
+	}
+
+	template.Provenance.BuilderID = "https://ci.example.com/builder"
+	statement, err = NewStatement(template, subjects)
+	if err != nil {
+		t.Fatalf("NewStatement failed: %v", err)
+	}
+	if statement.Predicate.RunDetails.Builder.ID != "https://ci.example.com/builder" {
+		t.Errorf("expected configured builder ID, got %q", statement.Predicate.RunDetails.Builder.ID)
+	}
+}
+
+func TestNewStatement_MissingTemplateFile(t *testing.T) {
+	template := &config.ImageTemplate{PathList: []string{"/nonexistent/template.yml"}}
+	if _, err := NewStatement(template, nil); err == nil {
+		t.Fatal("expected error for missing template file")
+	}
+}
+
+func TestGenerateProvenance_Unsigned(t *testing.T) {
+	dir := t.TempDir()
+	buildDir := filepath.Join(dir, "imagebuild")
+	if err := os.MkdirAll(buildDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	template := newTestTemplate(t, dir)
+	if err := os.WriteFile(filepath.Join(buildDir, "test-image-1.0.0.raw"), []byte("raw image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := GenerateProvenance(template, buildDir)
+	if err != nil {
+		t.Fatalf("GenerateProvenance failed: %v", err)
+	}
+	if filepath.Base(path) != "test-image"+FileSuffix {
+		t.Errorf("unexpected provenance file name %s", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement, envelope, err := ParseProvenance(data)
+	if err != nil {
+		t.Fatalf("ParseProvenance failed: %v", err)
+	}
+	if envelope != nil {
+		t.Error("expected unsigned provenance")
+	}
+	subject, ok := statement.FindSubject("test-image-1.0.0.raw")
+	if !ok {
+		t.Fatalf("expected raw image to be a subject, got %+v", statement.Subject)
+	}
+	want, _ := FileSHA256(filepath.Join(buildDir, "test-image-1.0.0.raw"))
+	if subject.Digest["sha256"] != want {
+		t.Errorf("subject digest %s, want %s", subject.Digest["sha256"], want)
+	}
+
+	// A rerun must not list the previous provenance file as a subject
+	if _, err := GenerateProvenance(template, buildDir); err != nil {
+		t.Fatalf("GenerateProvenance rerun failed: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	statement, _, _ = ParseProvenance(data)
+	if len(statement.Subject) != 1 {
+		t.Errorf("expected only the image as subject, got %+v", statement.Subject)
+	}
+}
+
+func TestGenerateProvenance_NoArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	template := newTestTemplate(t, dir)
+	buildDir := filepath.Join(dir, "empty")
+	if err := os.MkdirAll(buildDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateProvenance(template, buildDir); err == nil {
+		t.Fatal("expected error when no artifacts exist")
+	}
+	if _, err := GenerateProvenance(nil, buildDir); err == nil {
+		t.Fatal("expected error for nil template")
+	}
+}
+
+func TestGenerateProvenance_Signed(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath, pubPath := writeKeyPair(t, dir, priv, pub)
+
+	buildDir := filepath.Join(dir, "imagebuild")
+	if err := os.MkdirAll(buildDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(buildDir, "test-image.qcow2"), []byte("qcow2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	template := newTestTemplate(t, dir)
+	template.Provenance.SigningKey = privPath
+
+	path, err := GenerateProvenance(template, buildDir)
+	if err != nil {
+		t.Fatalf("GenerateProvenance failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	_, envelope, err := ParseProvenance(data)
+	if err != nil {
+		t.Fatalf("ParseProvenance failed: %v", err)
+	}
+	if envelope == nil || envelope.PayloadType != DSSEPayloadType || len(envelope.Signatures) != 1 {
+		t.Fatalf("expected signed DSSE envelope, got %+v", envelope)
+	}
+	if _, err := VerifyEnvelope(envelope, pubPath); err != nil {
+		t.Errorf("VerifyEnvelope failed: %v", err)
+	}
+}
+
+func TestSignAndVerify_ECDSA(t *testing.T) {
+	dir := t.TempDir()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath, pubPath := writeKeyPair(t, dir, priv, &priv.PublicKey)
+
+	payload := []byte(`{"_type":"` + StatementType + `"}`)
+	envelope, err := SignStatement(payload, privPath)
+	if err != nil {
+		t.Fatalf("SignStatement failed: %v", err)
+	}
+	got, err := VerifyEnvelope(envelope, pubPath)
+	if err != nil {
+		t.Fatalf("VerifyEnvelope failed: %v", err)
+	}
+	if string(got) != string(payload) {
+		t.Errorf("payload mismatch: %s", got)
+	}
+
+	// Tampering with the payload must break the signature
+	raw, _ := json.Marshal(map[string]string{"_type": "tampered"})
+	envelope.Payload = strings.TrimSpace(string(raw))
+	if _, err := VerifyEnvelope(envelope, pubPath); err == nil {
+		t.Error("expected verification failure for tampered payload")
+	}
+
+	// A different key must not verify
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	otherDir := t.TempDir()
+	_, otherPubPath := writeKeyPair(t, otherDir, ed25519.NewKeyFromSeed(make([]byte, 32)), otherPub)
+	envelope, _ = SignStatement(payload, privPath)
+	if _, err := VerifyEnvelope(envelope, otherPubPath); err == nil {
+		t.Error("expected verification failure with a different key")
+	}
+}
+
+func TestParseProvenance_Invalid(t *testing.T) {
+	if _, _, err := ParseProvenance([]byte("not json")); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+	if _, _, err := ParseProvenance([]byte(`{"_type":"other"}`)); err == nil {
+		t.Error("expected error for unsupported statement type")
+	}
+}
+
+func TestNormalizeAlgorithm(t *testing.T) {
+	tests := map[string]string{
+		"SHA256":    "sha256",
+		"sha-256":   "sha256",
+		"sha256sum": "sha256",
+		"SHA512":    "sha512",
+		"md5":       "md5",
+	}
+	for in, want := range tests {
+		if got := normalizeAlgorithm(in); got != want {
+			t.Errorf("normalizeAlgorithm(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
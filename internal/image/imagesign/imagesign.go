@@ -3,15 +3,30 @@ package imagesign
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/artifactsign"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageboot"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageinspect"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageupdate"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/logger"
 	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
 	"github.com/open-edge-platform/os-image-composer/internal/utils/system"
 )
 
+var log = logger.Logger()
+
+// SignImage signs every PE binary on the ESP of the image, and the UKIs of the
+// update payload, with the Secure Boot DB key and verifies the signatures.
+// With the shim boot chain they are signed with the MOK key instead.
 func SignImage(installRoot string, template *config.ImageTemplate) error {
+	if template.GetBootloaderConfig().IsShimChain() {
+		return signShimChain(installRoot, template)
+	}
 
 	// If immutability is not enabled, skip signing
 	if !template.IsImmutabilityEnabled() {
@@ -30,9 +45,14 @@ func SignImage(installRoot string, template *config.ImageTemplate) error {
 	prKeyPath := template.GetSecureBootDBCrtPath()
 	prCerPath := template.GetSecureBootDBCerPath()
 
-	// Check if the key and certificate files exist
-	if _, err := os.Stat(pbKeyPath); err != nil {
-		return fmt.Errorf("secure boot key file not found at %s: %w", pbKeyPath, err)
+	// The key is a file or the PKCS#11 URI of a key in an HSM, the
+	// certificates are files
+	dbKey, err := artifactsign.NewSigningKey(pbKeyPath)
+	if err != nil {
+		return fmt.Errorf("invalid secure boot key: %w", err)
+	}
+	if err := dbKey.Check(); err != nil {
+		return fmt.Errorf("secure boot %w", err)
 	}
 	if _, err := os.Stat(prKeyPath); err != nil {
 		return fmt.Errorf("secure boot certificate file not found at %s: %w", prKeyPath, err)
@@ -41,36 +61,117 @@ func SignImage(installRoot string, template *config.ImageTemplate) error {
 		return fmt.Errorf("secure boot UEFI certificate file not found at %s: %w", prCerPath, err)
 	}
 
-	espDir := filepath.Join(installRoot, "boot", "efi")
-	ukiPath := filepath.Join(espDir, "EFI", "Linux", "linux.efi")
-	bootloaderPath := filepath.Join(espDir, "EFI", "BOOT", "BOOTX64.EFI")
+	if err := signESP(installRoot, template, dbKey, prKeyPath); err != nil {
+		return err
+	}
+	return copyCertificate(prCerPath, "DB.cer", template)
+}
 
-	// Sign the UKI (Unified Kernel Image) - create signed file then replace original
-	ukiSignedPath := filepath.Join(espDir, "EFI", "Linux", "linux.efi.signed")
-	cmd := fmt.Sprintf("sbsign --key %s --cert %s --output %s %s",
-		pbKeyPath, prKeyPath, ukiSignedPath, ukiPath)
-	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
-		return fmt.Errorf("failed to sign UKI: %w", err)
+// signShimChain signs the EFI binaries started by shim with the MOK key and
+// keeps the MOK certificate next to the image for manual enrollment
+func signShimChain(installRoot string, template *config.ImageTemplate) error {
+	bootloader := template.GetBootloaderConfig()
+	mokKey, err := artifactsign.NewSigningKey(bootloader.MOKKey)
+	if err != nil {
+		return fmt.Errorf("invalid MOK key: %w", err)
+	}
+	if err := mokKey.Check(); err != nil {
+		return fmt.Errorf("MOK %w", err)
+	}
+	if _, err := os.Stat(bootloader.MOKCrt); err != nil {
+		return fmt.Errorf("MOK certificate file not found at %s: %w", bootloader.MOKCrt, err)
+	}
+	if template.SystemConfig.Immutability.HasSecureBootDBKey() {
+		log.Warnf("The shim boot chain signs with the MOK key, the secure boot DB key is not used")
 	}
 
-	// Replace original with signed version
-	if err := os.Rename(ukiSignedPath, ukiPath); err != nil {
-		return fmt.Errorf("failed to replace UKI with signed version: %w", err)
+	if err := signESP(installRoot, template, mokKey, bootloader.MOKCrt); err != nil {
+		return err
 	}
+	return copyCertificate(filepath.Join(installRoot, imageboot.MOKCertPath), "MOK.cer", template)
+}
 
-	// Sign the bootloader - create signed file then replace original
-	bootloaderSignedPath := filepath.Join(espDir, "EFI", "BOOT", "BOOTX64.EFI.signed")
-	cmd = fmt.Sprintf("sbsign --key %s --cert %s --output %s %s",
-		pbKeyPath, prKeyPath, bootloaderSignedPath, bootloaderPath)
-	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
-		return fmt.Errorf("failed to sign bootloader: %w", err)
+// signESP signs the PE binaries of the ESP and the update payload with key,
+// except shim and MokManager, and verifies them against the certificate at
+// certPath
+func signESP(installRoot string, template *config.ImageTemplate, key artifactsign.SigningKey, certPath string) error {
+	espDir := filepath.Join(installRoot, "boot", "efi")
+	binaries, err := efiInventory(espDir)
+	if err != nil {
+		return err
+	}
+	loaderName, err := fallbackLoaderName(template.Target.Arch)
+	if err != nil {
+		return err
+	}
+	loaderPath := filepath.Join(espDir, "EFI", "BOOT", loaderName)
+	hasLoader := false
+	for _, binary := range binaries {
+		hasLoader = hasLoader || binary.Path == loaderPath
+	}
+	if !hasLoader {
+		log.Errorf("Bootloader %s not found on the ESP", loaderPath)
+		return fmt.Errorf("failed to sign bootloader: %s not found on the ESP", loaderPath)
 	}
 
-	// Replace original with signed version
-	if err := os.Rename(bootloaderSignedPath, bootloaderPath); err != nil {
-		return fmt.Errorf("failed to replace bootloader with signed version: %w", err)
+	// A/B images have one UKI per slot, the UKIs of the updates wait in the
+	// update payload
+	if template.IsABUpdate() {
+		payloadDir, err := imageupdate.PayloadDir(template)
+		if err != nil {
+			return err
+		}
+		payloadUKIs, err := filepath.Glob(filepath.Join(payloadDir, "*.efi"))
+		if err != nil {
+			return fmt.Errorf("failed to list update payload UKIs: %w", err)
+		}
+		for _, path := range payloadUKIs {
+			binary, ok, err := readEFIBinary(path)
+			if err != nil {
+				return fmt.Errorf("failed to read update payload UKI %s: %w", path, err)
+			}
+			if !ok {
+				return fmt.Errorf("update payload UKI %s is not a PE binary", path)
+			}
+			binaries = append(binaries, binary)
+		}
+	}
+
+	// The UKIs first, then the bootloaders and drivers
+	sort.SliceStable(binaries, func(i, j int) bool {
+		return binaries[i].IsUKI && !binaries[j].IsUKI
+	})
+	var signed []string
+	for _, binary := range binaries {
+		// Shim and MokManager keep the signature of their vendor
+		if binary.Kind == imageinspect.BootloaderShim || binary.Kind == imageinspect.BootloaderMokManager {
+			log.Infof("Keeping the vendor signature of %s %s", binary.Kind, binary.Path)
+			continue
+		}
+		if err := signEFIBinary(key, certPath, binary.Path); err != nil {
+			if binary.IsUKI {
+				return fmt.Errorf("failed to sign UKI %s: %w", binary.Path, err)
+			}
+			return fmt.Errorf("failed to sign bootloader %s: %w", binary.Path, err)
+		}
+		signed = append(signed, binary.Path)
 	}
 
+	// Every signature must verify against the certificate
+	for _, path := range signed {
+		cmd := fmt.Sprintf("sbverify --cert %s %s", certPath, path)
+		if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+			log.Errorf("Signature of %s does not verify: %v", path, err)
+			return fmt.Errorf("signature of %s does not verify: %w", path, err)
+		}
+	}
+	log.Infof("Signed and verified %d EFI binaries", len(signed))
+	return nil
+}
+
+// copyCertificate copies the DER certificate at certPath to the image build
+// directory as name
+func copyCertificate(certPath, name string, template *config.ImageTemplate) error {
 	// Getting image build directory
 	globalWorkDir, err := config.WorkDir()
 	if err != nil {
@@ -80,10 +181,10 @@ func SignImage(installRoot string, template *config.ImageTemplate) error {
 		template.Target.Arch)
 	imageBuildDir := filepath.Join(globalWorkDir, providerId, "imagebuild")
 	sysConfigName := template.GetSystemConfigName()
-	finalCerFilePath := filepath.Join(imageBuildDir, sysConfigName, "DB.cer")
+	finalCerFilePath := filepath.Join(imageBuildDir, sysConfigName, name)
 
 	// Copy the certificate file to the temp directory using Go's file library
-	input, err := os.Open(prCerPath)
+	input, err := os.Open(certPath)
 	if err != nil {
 		return fmt.Errorf("failed to open certificate file: %w", err)
 	}
@@ -106,3 +207,77 @@ func SignImage(installRoot string, template *config.ImageTemplate) error {
 
 	return nil
 }
+
+// efiInventory returns the PE binaries below dir. Other files, such as loader
+// entries and enrollment files, are skipped.
+func efiInventory(dir string) ([]imageinspect.EFIBinaryEvidence, error) {
+	var binaries []imageinspect.EFIBinaryEvidence
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		binary, ok, err := readEFIBinary(path)
+		if ok {
+			binaries = append(binaries, binary)
+		}
+		return err
+	})
+	if err != nil {
+		log.Errorf("Failed to list EFI binaries in %s: %v", dir, err)
+		return nil, fmt.Errorf("failed to list EFI binaries in %s: %w", dir, err)
+	}
+	return binaries, nil
+}
+
+// readEFIBinary parses the PE binary at path, ok is false for other files
+func readEFIBinary(path string) (binary imageinspect.EFIBinaryEvidence, ok bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return binary, false, err
+	}
+	magic := make([]byte, 2)
+	_, err = io.ReadFull(f, magic)
+	f.Close()
+	if err != nil || string(magic) != "MZ" {
+		return binary, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return binary, false, err
+	}
+	binary, err = imageinspect.ParsePEFromBytes(path, data)
+	if err != nil {
+		log.Debugf("Skipping %s, not a PE binary: %v", path, err)
+		return binary, false, nil
+	}
+	return binary, true, nil
+}
+
+// fallbackLoaderName returns the name of the default bootloader in EFI/BOOT
+// for arch
+func fallbackLoaderName(arch string) (string, error) {
+	switch arch {
+	case "x86_64", "amd64":
+		return "BOOTX64.EFI", nil
+	case "aarch64", "arm64":
+		return "BOOTAA64.EFI", nil
+	default:
+		return "", fmt.Errorf("secure boot signing is not supported for architecture %q", arch)
+	}
+}
+
+// signEFIBinary signs the EFI binary at path in place: the signed file is
+// created next to it, then replaces the original.
+func signEFIBinary(key artifactsign.SigningKey, certPath, path string) error {
+	signedPath := path + ".signed"
+	cmd := fmt.Sprintf("sbsign %s --cert %s --output %s %s", key.SbsignArgs(), certPath, signedPath, path)
+	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, key.Env()); err != nil {
+		return err
+	}
+
+	// Replace original with signed version
+	if err := os.Rename(signedPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s with signed version: %w", path, err)
+	}
+	return nil
+}
@@ -1,6 +1,14 @@
 package imagesign_test
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/pem"
 	"errors"
 	"os"
 	"path/filepath"
@@ -9,6 +17,7 @@ import (
 	"testing"
 
 	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageboot"
 	"github.com/open-edge-platform/os-image-composer/internal/image/imagesign"
 	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
 )
@@ -37,6 +46,20 @@ func (c *CustomMockExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string
 					}
 				}
 			}
+			// Create the module signature of openssl cms
+			if cmd.Error == nil && strings.HasPrefix(cmdStr, "openssl cms -sign") {
+				parts := strings.Split(cmdStr, " ")
+				if err := os.WriteFile(parts[len(parts)-1], []byte("SIG"), 0644); err != nil && c.t != nil {
+					c.t.Logf("Failed to create signature file: %v", err)
+				}
+			}
+			// Create the public key of the PKCS#11 token key
+			if cmd.Error == nil && strings.HasPrefix(cmdStr, "openssl pkey ") {
+				parts := strings.Split(cmdStr, " ")
+				if err := os.WriteFile(parts[len(parts)-1], tokenPublicKey(c.t), 0644); err != nil && c.t != nil {
+					c.t.Logf("Failed to create public key file: %v", err)
+				}
+			}
 			// Return the mock response
 			if cmd.Error != nil {
 				return cmd.Output, cmd.Error
@@ -47,6 +70,19 @@ func (c *CustomMockExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string
 	return "", nil
 }
 
+// tokenPublicKey returns a PEM public key standing in for the key of a PKCS#11 token
+func tokenPublicKey(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
 func (c *CustomMockExecutor) ExecCmdSilent(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
 	return c.ExecCmd(cmdStr, sudo, chrootPath, envVal)
 }
@@ -130,6 +166,7 @@ func TestSignImage_MissingUKIFile(t *testing.T) {
 	shell.Default = shell.NewMockExecutor(mockCommands)
 
 	template := &config.ImageTemplate{
+		Target: config.TargetInfo{Arch: "x86_64"},
 		SystemConfig: config.SystemConfig{
 			Immutability: config.ImmutabilityConfig{
 				Enabled:         true,
@@ -172,7 +209,7 @@ func TestSignImage_MissingBootloaderFile(t *testing.T) {
 
 	// Create UKI file but not bootloader
 	ukiPath := filepath.Join(linuxDir, "linux.efi")
-	if err := os.WriteFile(ukiPath, []byte("fake UKI"), 0644); err != nil {
+	if err := writeTestPE(ukiPath, ".linux", ".cmdline"); err != nil {
 		t.Fatalf("Failed to create UKI file: %v", err)
 	}
 
@@ -205,6 +242,7 @@ func TestSignImage_MissingBootloaderFile(t *testing.T) {
 	shell.Default = executor
 
 	template := &config.ImageTemplate{
+		Target: config.TargetInfo{Arch: "x86_64"},
 		SystemConfig: config.SystemConfig{
 			Immutability: config.ImmutabilityConfig{
 				Enabled:         true,
@@ -240,10 +278,10 @@ func TestSignImage_WorkDirCreation(t *testing.T) {
 	ukiPath := filepath.Join(linuxDir, "linux.efi")
 	bootloaderPath := filepath.Join(bootDir, "BOOTX64.EFI")
 
-	if err := os.WriteFile(ukiPath, []byte("fake UKI"), 0644); err != nil {
+	if err := writeTestPE(ukiPath, ".linux", ".cmdline"); err != nil {
 		t.Fatalf("Failed to create UKI file: %v", err)
 	}
-	if err := os.WriteFile(bootloaderPath, []byte("fake bootloader"), 0644); err != nil {
+	if err := writeTestPE(bootloaderPath, ".sdmagic"); err != nil {
 		t.Fatalf("Failed to create bootloader file: %v", err)
 	}
 
@@ -263,6 +301,7 @@ func TestSignImage_WorkDirCreation(t *testing.T) {
 	}
 
 	template := &config.ImageTemplate{
+		Target: config.TargetInfo{Arch: "x86_64"},
 		SystemConfig: config.SystemConfig{
 			Name: "test-config",
 			Immutability: config.ImmutabilityConfig{
@@ -356,10 +395,10 @@ func TestSignImage_SuccessfulSigning(t *testing.T) {
 	ukiPath := filepath.Join(linuxDir, "linux.efi")
 	bootloaderPath := filepath.Join(bootDir, "BOOTX64.EFI")
 
-	if err := os.WriteFile(ukiPath, []byte("fake UKI"), 0644); err != nil {
+	if err := writeTestPE(ukiPath, ".linux", ".cmdline"); err != nil {
 		t.Fatalf("Failed to create UKI file: %v", err)
 	}
-	if err := os.WriteFile(bootloaderPath, []byte("fake bootloader"), 0644); err != nil {
+	if err := writeTestPE(bootloaderPath, ".sdmagic"); err != nil {
 		t.Fatalf("Failed to create bootloader file: %v", err)
 	}
 
@@ -390,6 +429,7 @@ func TestSignImage_SuccessfulSigning(t *testing.T) {
 	}
 
 	template := &config.ImageTemplate{
+		Target: config.TargetInfo{Arch: "x86_64"},
 		SystemConfig: config.SystemConfig{
 			Name: "test-config",
 			Immutability: config.ImmutabilityConfig{
@@ -431,10 +471,10 @@ func TestSignImage_FileValidationErrors(t *testing.T) {
 	ukiPath := filepath.Join(linuxDir, "linux.efi")
 	bootloaderPath := filepath.Join(bootDir, "BOOTX64.EFI")
 
-	if err := os.WriteFile(ukiPath, []byte("fake UKI"), 0644); err != nil {
+	if err := writeTestPE(ukiPath, ".linux", ".cmdline"); err != nil {
 		t.Fatalf("Failed to create UKI file: %v", err)
 	}
-	if err := os.WriteFile(bootloaderPath, []byte("fake bootloader"), 0644); err != nil {
+	if err := writeTestPE(bootloaderPath, ".sdmagic"); err != nil {
 		t.Fatalf("Failed to create bootloader file: %v", err)
 	}
 
@@ -542,10 +582,10 @@ func TestSignImage_SbsignErrors(t *testing.T) {
 			ukiPath := filepath.Join(linuxDir, "linux.efi")
 			bootloaderPath := filepath.Join(bootDir, "BOOTX64.EFI")
 
-			if err := os.WriteFile(ukiPath, []byte("fake UKI"), 0644); err != nil {
+			if err := writeTestPE(ukiPath, ".linux", ".cmdline"); err != nil {
 				t.Fatalf("Failed to create UKI file: %v", err)
 			}
-			if err := os.WriteFile(bootloaderPath, []byte("fake bootloader"), 0644); err != nil {
+			if err := writeTestPE(bootloaderPath, ".sdmagic"); err != nil {
 				t.Fatalf("Failed to create bootloader file: %v", err)
 			}
 
@@ -576,6 +616,7 @@ func TestSignImage_SbsignErrors(t *testing.T) {
 			}
 
 			template := &config.ImageTemplate{
+				Target: config.TargetInfo{Arch: "x86_64"},
 				SystemConfig: config.SystemConfig{
 					Name: "test-config",
 					Immutability: config.ImmutabilityConfig{
@@ -642,10 +683,10 @@ func TestSignImage_MissingFiles(t *testing.T) {
 			ukiPath := filepath.Join(linuxDir, "linux.efi")
 			bootloaderPath := filepath.Join(bootDir, "BOOTX64.EFI")
 
-			if err := os.WriteFile(ukiPath, []byte("fake UKI"), 0644); err != nil {
+			if err := writeTestPE(ukiPath, ".linux", ".cmdline"); err != nil {
 				t.Fatalf("Failed to create UKI file: %v", err)
 			}
-			if err := os.WriteFile(bootloaderPath, []byte("fake bootloader"), 0644); err != nil {
+			if err := writeTestPE(bootloaderPath, ".sdmagic"); err != nil {
 				t.Fatalf("Failed to create bootloader file: %v", err)
 			}
 
@@ -775,3 +816,245 @@ func TestSignImage_PartialSecureBootConfig(t *testing.T) {
 		})
 	}
 }
+
+// writeTestPE writes a PE32+ binary with empty sections named sections
+func writeTestPE(path string, sections ...string) error {
+	return writeTestPEMachine(path, pe.IMAGE_FILE_MACHINE_AMD64, sections...)
+}
+
+func writeTestPEMachine(path string, machine uint16, sections ...string) error {
+	var buf bytes.Buffer
+	dos := make([]byte, 0x40)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 0x40)
+	buf.Write(dos)
+	buf.WriteString("PE\x00\x00")
+	header := pe.FileHeader{
+		Machine:              machine,
+		NumberOfSections:     uint16(len(sections)),
+		SizeOfOptionalHeader: uint16(binary.Size(pe.OptionalHeader64{})),
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	optional := pe.OptionalHeader64{Magic: 0x20b, NumberOfRvaAndSizes: 16}
+	if err := binary.Write(&buf, binary.LittleEndian, optional); err != nil {
+		return err
+	}
+	for _, name := range sections {
+		section := pe.SectionHeader32{}
+		copy(section.Name[:], name)
+		if err := binary.Write(&buf, binary.LittleEndian, section); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// signingTemplate writes DB key files below dir and returns a template using them
+func signingTemplate(t *testing.T, dir, arch string) *config.ImageTemplate {
+	t.Helper()
+	template := &config.ImageTemplate{
+		Target: config.TargetInfo{Arch: arch},
+		SystemConfig: config.SystemConfig{
+			Name: "test-config",
+			Immutability: config.ImmutabilityConfig{
+				Enabled:         true,
+				SecureBootDBKey: filepath.Join(dir, "db.key"),
+				SecureBootDBCrt: filepath.Join(dir, "db.crt"),
+				SecureBootDBCer: filepath.Join(dir, "db.cer"),
+			},
+		},
+	}
+	for _, path := range []string{template.GetSecureBootDBKeyPath(), template.GetSecureBootDBCrtPath(), template.GetSecureBootDBCerPath()} {
+		if err := os.WriteFile(path, []byte("test"), 0600); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+	return template
+}
+
+func TestSignImage_Inventory(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	global := config.DefaultGlobalConfig()
+	global.WorkDir = t.TempDir()
+	config.SetGlobal(global)
+
+	installRoot := t.TempDir()
+	espDir := filepath.Join(installRoot, "boot", "efi")
+	if err := writeTestPEMachine(filepath.Join(espDir, "EFI", "BOOT", "BOOTAA64.EFI"), pe.IMAGE_FILE_MACHINE_ARM64, ".sdmagic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTestPE(filepath.Join(espDir, "EFI", "Linux", "linux.efi"), ".linux", ".cmdline"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTestPE(filepath.Join(espDir, "EFI", "systemd", "drivers", "ext4_x64.efi")); err != nil {
+		t.Fatal(err)
+	}
+	// Shim keeps its vendor signature, other files are not PE binaries
+	if err := writeTestPE(filepath.Join(espDir, "EFI", "ubuntu", "shimx64.efi"), ".sbat"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(espDir, "loader.conf"), []byte("timeout 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	template := signingTemplate(t, t.TempDir(), "aarch64")
+	shell.Default = &CustomMockExecutor{t: t, mockCommands: []shell.MockCommand{
+		{Pattern: `sbsign .* --output \S+/(BOOTAA64\.EFI|linux\.efi|ext4_x64\.efi)\.signed \S+$`, Output: ""},
+		{Pattern: `sbverify --cert \S+/db\.crt \S+/(BOOTAA64\.EFI|linux\.efi|ext4_x64\.efi)$`, Output: ""},
+		{Pattern: ".*", Error: errors.New("unexpected command")},
+	}}
+	if err := imagesign.SignImage(installRoot, template); err != nil {
+		t.Fatalf("SignImage failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(espDir, "EFI", "systemd", "drivers", "ext4_x64.efi")); string(data) != "signed content" {
+		t.Error("EFI drivers must be signed")
+	}
+
+	// A failing verification fails the build
+	if err := writeTestPEMachine(filepath.Join(espDir, "EFI", "BOOT", "BOOTAA64.EFI"), pe.IMAGE_FILE_MACHINE_ARM64, ".sdmagic"); err != nil {
+		t.Fatal(err)
+	}
+	shell.Default = &CustomMockExecutor{t: t, mockCommands: []shell.MockCommand{
+		{Pattern: `^sbsign `, Output: ""},
+		{Pattern: `^sbverify `, Error: errors.New("signature verification failed")},
+	}}
+	if err := imagesign.SignImage(installRoot, template); err == nil || !strings.Contains(err.Error(), "does not verify") {
+		t.Errorf("expected a verification error, got %v", err)
+	}
+
+	// The bootloader of the target architecture must be on the ESP
+	template.Target.Arch = "x86_64"
+	if err := imagesign.SignImage(installRoot, template); err == nil || !strings.Contains(err.Error(), "BOOTX64.EFI not found") {
+		t.Errorf("expected a missing bootloader error, got %v", err)
+	}
+	template.Target.Arch = "riscv64"
+	if err := imagesign.SignImage(installRoot, template); err == nil {
+		t.Error("expected an error for an unsupported architecture")
+	}
+}
+
+func TestSignImage_PKCS11(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	global := config.DefaultGlobalConfig()
+	global.WorkDir = t.TempDir()
+	global.TempDir = t.TempDir()
+	config.SetGlobal(global)
+
+	installRoot := t.TempDir()
+	loaderPath := filepath.Join(installRoot, "boot", "efi", "EFI", "BOOT", "BOOTX64.EFI")
+	if err := writeTestPE(loaderPath, ".sdmagic"); err != nil {
+		t.Fatal(err)
+	}
+	template := signingTemplate(t, t.TempDir(), "x86_64")
+	template.SystemConfig.Immutability.SecureBootDBKey = "pkcs11:token=lab;object=db?pin-source=file:/etc/lab.pin"
+
+	// The db key stays in the token, sbsign uses it through the pkcs11 engine
+	shell.Default = &CustomMockExecutor{t: t, mockCommands: []shell.MockCommand{
+		{Pattern: `^openssl pkey -engine pkcs11 -inform engine -in 'pkcs11:token=lab;object=db\?pin-source=file:/etc/lab\.pin' -pubout -out \S+$`, Output: ""},
+		{Pattern: `^sbsign --engine pkcs11 --key 'pkcs11:token=lab;object=db\?pin-source=file:/etc/lab\.pin' --cert \S+/db\.crt --output \S+/BOOTX64\.EFI\.signed \S+/BOOTX64\.EFI$`, Output: ""},
+		{Pattern: `^sbverify --cert \S+/db\.crt \S+/BOOTX64\.EFI$`, Output: ""},
+		{Pattern: ".*", Error: errors.New("unexpected command")},
+	}}
+	if err := imagesign.SignImage(installRoot, template); err != nil {
+		t.Fatalf("SignImage failed: %v", err)
+	}
+	if data, _ := os.ReadFile(loaderPath); string(data) != "signed content" {
+		t.Error("the bootloader must be signed")
+	}
+
+	// A key that is not in the token fails before anything is signed
+	shell.Default = &CustomMockExecutor{t: t, mockCommands: []shell.MockCommand{
+		{Pattern: `^openssl pkey `, Error: errors.New("no such object")},
+		{Pattern: ".*", Error: errors.New("unexpected command")},
+	}}
+	if err := imagesign.SignImage(installRoot, template); err == nil || !strings.Contains(err.Error(), "PKCS#11 token") {
+		t.Errorf("expected a token error, got %v", err)
+	}
+	template.SystemConfig.Immutability.SecureBootDBKey = "pkcs11:object=db'"
+	if err := imagesign.SignImage(installRoot, template); err == nil {
+		t.Error("expected an error for an invalid PKCS#11 URI")
+	}
+}
+
+func TestSignImage_ShimChain(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	global := config.DefaultGlobalConfig()
+	global.WorkDir = t.TempDir()
+	config.SetGlobal(global)
+
+	installRoot := t.TempDir()
+	bootDir := filepath.Join(installRoot, "boot", "efi", "EFI", "BOOT")
+	if err := writeTestPE(filepath.Join(bootDir, "BOOTX64.EFI"), ".sbat"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTestPE(filepath.Join(bootDir, "mmx64.efi"), ".sbat"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTestPE(filepath.Join(bootDir, "grubx64.efi"), ".sbat", ".mods"); err != nil {
+		t.Fatal(err)
+	}
+	cerPath := filepath.Join(installRoot, imageboot.MOKCertPath)
+	if err := os.MkdirAll(filepath.Dir(cerPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cerPath, []byte("MOK"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// No immutability and no DB key: the MOK key signs what shim starts
+	keyDir := t.TempDir()
+	template := &config.ImageTemplate{
+		Target: config.TargetInfo{Arch: "x86_64"},
+		SystemConfig: config.SystemConfig{
+			Name: "test-config",
+			Bootloader: config.Bootloader{
+				BootType: "efi",
+				Provider: "grub",
+				Chain:    config.BootChainShim,
+				MOKKey:   filepath.Join(keyDir, "MOK.key"),
+				MOKCrt:   filepath.Join(keyDir, "MOK.crt"),
+			},
+		},
+	}
+	for _, path := range []string{template.SystemConfig.Bootloader.MOKKey, template.SystemConfig.Bootloader.MOKCrt} {
+		if err := os.WriteFile(path, []byte("test"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	shell.Default = &CustomMockExecutor{t: t, mockCommands: []shell.MockCommand{
+		{Pattern: `^sbsign --key \S+/MOK\.key --cert \S+/MOK\.crt --output \S+/grubx64\.efi\.signed \S+/grubx64\.efi$`, Output: ""},
+		{Pattern: `^mv \S+/grubx64\.efi\.signed \S+/grubx64\.efi$`, Output: ""},
+		{Pattern: `^sbverify --cert \S+/MOK\.crt \S+/grubx64\.efi$`, Output: ""},
+		{Pattern: ".*", Error: errors.New("unexpected command")},
+	}}
+	if err := imagesign.SignImage(installRoot, template); err != nil {
+		t.Fatalf("SignImage failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(bootDir, "BOOTX64.EFI")); string(data) == "signed content" {
+		t.Error("shim must keep the signature of its vendor")
+	}
+	matches, _ := filepath.Glob(filepath.Join(global.WorkDir, "*", "imagebuild", "test-config", "MOK.cer"))
+	if len(matches) != 1 {
+		t.Errorf("expected the MOK certificate next to the image, got %v", matches)
+	}
+
+	template.SystemConfig.Bootloader.MOKKey = filepath.Join(keyDir, "missing.key")
+	if err := imagesign.SignImage(installRoot, template); err == nil || !strings.Contains(err.Error(), "MOK key file not found") {
+		t.Errorf("expected a missing MOK key error, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package imagesign
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+// DefaultKeyDays is the validity of generated Secure Boot certificates
+const DefaultKeyDays = 3650
+
+var commonNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 ._-]*$`)
+
+// GenerateKeySet creates a Secure Boot key set in dir for development and
+// lab devices: a self-signed PK, KEK and db key pair, their certificates in
+// PEM (.crt) and DER (.cer) format, EFI signature lists (.esl) and signed
+// enrollment updates (.auth). The PK signs itself and the KEK, the KEK signs
+// the db. The certificates are named after commonName.
+func GenerateKeySet(dir, commonName string, days int) error {
+	if !commonNamePattern.MatchString(commonName) {
+		return fmt.Errorf("invalid common name %q: use letters, digits, spaces, dots, underscores and dashes", commonName)
+	}
+	if days <= 0 {
+		return fmt.Errorf("invalid certificate validity %d days", days)
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("key set directory %s is not empty", dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create key set directory %s: %w", dir, err)
+	}
+
+	guid := uuid.NewString()
+	if err := os.WriteFile(filepath.Join(dir, config.SecureBootGUIDFile), []byte(guid+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write key set GUID: %w", err)
+	}
+
+	path := func(name, ext string) string {
+		return filepath.Join(dir, name+"."+ext)
+	}
+	for _, name := range config.SecureBootKeyNames {
+		cmds := []string{
+			fmt.Sprintf("openssl req -new -x509 -newkey rsa:2048 -nodes -sha256 -days %d -subj '/CN=%s %s/' -keyout %s -out %s",
+				days, commonName, name, path(name, "key"), path(name, "crt")),
+			fmt.Sprintf("openssl x509 -in %s -outform DER -out %s", path(name, "crt"), path(name, "cer")),
+			fmt.Sprintf("cert-to-efi-sig-list -g %s %s %s", guid, path(name, "crt"), path(name, "esl")),
+		}
+		for _, cmd := range cmds {
+			if _, err := shell.ExecCmd(cmd, false, shell.HostPath, nil); err != nil {
+				log.Errorf("Failed to create secure boot %s key: %v", name, err)
+				return fmt.Errorf("failed to create secure boot %s key: %w", name, err)
+			}
+		}
+	}
+
+	// Each signature list is signed by the key above it in the hierarchy
+	signers := map[string]string{
+		config.SecureBootPK:  config.SecureBootPK,
+		config.SecureBootKEK: config.SecureBootPK,
+		config.SecureBootDB:  config.SecureBootKEK,
+	}
+	for _, name := range config.SecureBootKeyNames {
+		signer := signers[name]
+		cmd := fmt.Sprintf("sign-efi-sig-list -g %s -k %s -c %s %s %s %s",
+			guid, path(signer, "key"), path(signer, "crt"), name, path(name, "esl"), path(name, "auth"))
+		if _, err := shell.ExecCmd(cmd, false, shell.HostPath, nil); err != nil {
+			log.Errorf("Failed to sign secure boot %s signature list: %v", name, err)
+			return fmt.Errorf("failed to sign secure boot %s signature list: %w", name, err)
+		}
+	}
+
+	log.Infof("Secure boot key set created in %s", dir)
+	return nil
+}
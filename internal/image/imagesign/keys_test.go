@@ -0,0 +1,57 @@
+package imagesign_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/open-edge-platform/os-image-composer/internal/image/imagesign"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func TestGenerateKeySet(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `^openssl req -new -x509 -newkey rsa:2048 -nodes -sha256 -days 365 -subj '/CN=Lab Device (PK|KEK|db)/' -keyout \S+/(PK|KEK|db)\.key -out \S+/(PK|KEK|db)\.crt$`, Output: ""},
+		{Pattern: `^openssl x509 -in \S+/(PK|KEK|db)\.crt -outform DER -out \S+/(PK|KEK|db)\.cer$`, Output: ""},
+		{Pattern: `^cert-to-efi-sig-list -g [0-9a-f-]{36} \S+/(PK|KEK|db)\.crt \S+/(PK|KEK|db)\.esl$`, Output: ""},
+		// PK signs itself and the KEK, the KEK signs the db
+		{Pattern: `^sign-efi-sig-list -g [0-9a-f-]{36} -k \S+/PK\.key -c \S+/PK\.crt (PK|KEK) \S+/(PK|KEK)\.esl \S+/(PK|KEK)\.auth$`, Output: ""},
+		{Pattern: `^sign-efi-sig-list -g [0-9a-f-]{36} -k \S+/KEK\.key -c \S+/KEK\.crt db \S+/db\.esl \S+/db\.auth$`, Output: ""},
+		{Pattern: ".*", Error: errors.New("unexpected command")},
+	})
+
+	dir := filepath.Join(t.TempDir(), "lab")
+	if err := imagesign.GenerateKeySet(dir, "Lab Device", 365); err != nil {
+		t.Fatalf("GenerateKeySet failed: %v", err)
+	}
+	guid, err := os.ReadFile(filepath.Join(dir, "GUID"))
+	if err != nil {
+		t.Fatalf("failed to read key set GUID: %v", err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f-]{36}\n$`).Match(guid) {
+		t.Errorf("unexpected GUID %q", guid)
+	}
+
+	// An existing key set is not overwritten
+	if err := imagesign.GenerateKeySet(dir, "Lab Device", 365); err == nil {
+		t.Error("expected an error for an existing key set")
+	}
+	if err := imagesign.GenerateKeySet(t.TempDir(), "lab'; rm -rf /", 365); err == nil {
+		t.Error("expected an error for an invalid common name")
+	}
+	if err := imagesign.GenerateKeySet(t.TempDir(), "lab", 0); err == nil {
+		t.Error("expected an error for an invalid validity")
+	}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "sign-efi-sig-list", Error: errors.New("signing failed")},
+		{Pattern: ".*", Output: ""},
+	})
+	if err := imagesign.GenerateKeySet(filepath.Join(t.TempDir(), "lab"), "lab", 365); err == nil {
+		t.Error("expected an error when signing fails")
+	}
+}
@@ -0,0 +1,212 @@
+package imagesign
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/artifactsign"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+	"github.com/ulikunitz/xz"
+)
+
+// moduleSignatureMagic ends a signed kernel module
+const moduleSignatureMagic = "~Module signature appended~\n"
+
+// pkeyIDPKCS7 is the id_type of a module signature holding a PKCS#7 message
+const pkeyIDPKCS7 = 2
+
+// outOfTreeModuleDirs are the directories below lib/modules/<version> that
+// DKMS and kmod packages install out-of-tree modules to
+var outOfTreeModuleDirs = []string{"updates", "extra"}
+
+// SignKernelModules signs the out-of-tree kernel modules of the image with the
+// module signing key, the way the kernel sign-file tool does: a detached
+// PKCS#7 signature of the module is appended to it. Modules that are already
+// signed are left alone. Compressed modules are signed uncompressed and
+// compressed again.
+func SignKernelModules(installRoot string, template *config.ImageTemplate) error {
+	immutability := template.SystemConfig.Immutability
+	if !immutability.HasModuleSigningKey() {
+		return nil
+	}
+	certPath := immutability.ModuleSigningCrt
+	key, err := artifactsign.NewSigningKey(immutability.ModuleSigningKey)
+	if err != nil {
+		return fmt.Errorf("invalid module signing key: %w", err)
+	}
+	if err := key.Check(); err != nil {
+		return fmt.Errorf("module signing %w", err)
+	}
+	if _, err := os.Stat(certPath); err != nil {
+		return fmt.Errorf("module signing certificate file not found at %s: %w", certPath, err)
+	}
+
+	var modules []string
+	for _, dir := range outOfTreeModuleDirs {
+		moduleDirs, err := filepath.Glob(filepath.Join(installRoot, "lib", "modules", "*", dir))
+		if err != nil {
+			return fmt.Errorf("failed to list kernel module directories: %w", err)
+		}
+		for _, moduleDir := range moduleDirs {
+			err := filepath.WalkDir(moduleDir, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil || !entry.Type().IsRegular() {
+					return err
+				}
+				if moduleCompression(path) != "" || strings.HasSuffix(path, ".ko") {
+					modules = append(modules, path)
+				}
+				return nil
+			})
+			if err != nil {
+				log.Errorf("Failed to list kernel modules in %s: %v", moduleDir, err)
+				return fmt.Errorf("failed to list kernel modules in %s: %w", moduleDir, err)
+			}
+		}
+	}
+
+	signed := 0
+	for _, path := range modules {
+		ok, err := signKernelModule(key, certPath, path)
+		if err != nil {
+			log.Errorf("Failed to sign kernel module %s: %v", path, err)
+			return fmt.Errorf("failed to sign kernel module %s: %w", path, err)
+		}
+		if ok {
+			signed++
+		}
+	}
+	log.Infof("Signed %d of %d out-of-tree kernel modules", signed, len(modules))
+	return nil
+}
+
+// moduleCompression returns the compression of the module at path from its
+// extension, or an empty string for other files
+func moduleCompression(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".ko.xz"):
+		return "xz"
+	case strings.HasSuffix(path, ".ko.zst"):
+		return "zst"
+	}
+	return ""
+}
+
+// signKernelModule appends a signature to the module at path, ok is false
+// for a module that is already signed
+func signKernelModule(key artifactsign.SigningKey, certPath, path string) (ok bool, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	compression := moduleCompression(path)
+	module, err := decompressModule(data, compression)
+	if err != nil {
+		return false, err
+	}
+	if bytes.HasSuffix(module, []byte(moduleSignatureMagic)) {
+		log.Debugf("Kernel module %s is already signed", path)
+		return false, nil
+	}
+
+	tmpDir, err := os.MkdirTemp(config.TempDir(), "modsign-*")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	unsignedPath := filepath.Join(tmpDir, "module.ko")
+	sigPath := filepath.Join(tmpDir, "module.p7s")
+	if err := os.WriteFile(unsignedPath, module, 0600); err != nil {
+		return false, fmt.Errorf("failed to write unsigned module: %w", err)
+	}
+	cmd := fmt.Sprintf("openssl cms -sign -binary -noattr -nocerts -nosmimecap -md sha256 -signer %s %s -in %s -outform DER -out %s",
+		certPath, key.OpenSSLArgs(), unsignedPath, sigPath)
+	if _, err := shell.ExecCmd(cmd, false, shell.HostPath, nil); err != nil {
+		return false, err
+	}
+	sig, err := os.ReadFile(sigPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read module signature: %w", err)
+	}
+
+	module = appendModuleSignature(module, sig)
+	if data, err = compressModule(module, compression); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(path, data, info.Mode().Perm()); err != nil {
+		return false, fmt.Errorf("failed to write signed module: %w", err)
+	}
+	return true, nil
+}
+
+// appendModuleSignature returns module followed by the PKCS#7 signature sig,
+// the module_signature descriptor and the signature magic
+func appendModuleSignature(module, sig []byte) []byte {
+	descriptor := make([]byte, 12)
+	descriptor[2] = pkeyIDPKCS7
+	binary.BigEndian.PutUint32(descriptor[8:], uint32(len(sig)))
+
+	signed := make([]byte, 0, len(module)+len(sig)+len(descriptor)+len(moduleSignatureMagic))
+	signed = append(signed, module...)
+	signed = append(signed, sig...)
+	signed = append(signed, descriptor...)
+	return append(signed, moduleSignatureMagic...)
+}
+
+func decompressModule(data []byte, compression string) ([]byte, error) {
+	switch compression {
+	case "xz":
+		reader, err := xz.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress module: %w", err)
+		}
+		return io.ReadAll(reader)
+	case "zst":
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+		defer decoder.Close()
+		return decoder.DecodeAll(data, nil)
+	}
+	return data, nil
+}
+
+// compressModule compresses the way the kernel module install does: xz with
+// a CRC32 check, which the in-kernel decompressor requires, or zstd
+func compressModule(data []byte, compression string) ([]byte, error) {
+	switch compression {
+	case "xz":
+		var buf bytes.Buffer
+		writer, err := xz.WriterConfig{CheckSum: xz.CRC32}.NewWriter(&buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create xz writer: %w", err)
+		}
+		if _, err := writer.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to compress module: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress module: %w", err)
+		}
+		return buf.Bytes(), nil
+	case "zst":
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		defer encoder.Close()
+		return encoder.EncodeAll(data, nil), nil
+	}
+	return data, nil
+}
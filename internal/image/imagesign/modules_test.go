@@ -0,0 +1,147 @@
+package imagesign_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imagesign"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+	"github.com/ulikunitz/xz"
+)
+
+const moduleMagic = "~Module signature appended~\n"
+
+func writeModule(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkSignedModule checks module is data followed by the "SIG" signature of the mock
+func checkSignedModule(t *testing.T, name string, module, data []byte) {
+	t.Helper()
+	trailer := 3 + 12 + len(moduleMagic)
+	if len(module) != len(data)+trailer || !bytes.HasPrefix(module, data) || !bytes.HasSuffix(module, []byte(moduleMagic)) {
+		t.Errorf("%s is not signed: %q", name, module)
+		return
+	}
+	descriptor := module[len(data)+3 : len(data)+15]
+	if descriptor[2] != 2 || binary.BigEndian.Uint32(descriptor[8:]) != 3 || string(module[len(data):len(data)+3]) != "SIG" {
+		t.Errorf("%s has an unexpected signature descriptor %v", name, descriptor)
+	}
+}
+
+func TestSignKernelModules(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	global := config.DefaultGlobalConfig()
+	global.TempDir = t.TempDir()
+	config.SetGlobal(global)
+
+	installRoot := t.TempDir()
+	template := &config.ImageTemplate{}
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{{Pattern: ".*", Error: errors.New("unexpected command")}})
+	if err := imagesign.SignKernelModules(installRoot, template); err != nil {
+		t.Fatalf("expected no-op without a module signing key, got %v", err)
+	}
+
+	keyDir := t.TempDir()
+	template.SystemConfig.Immutability.ModuleSigningKey = filepath.Join(keyDir, "mok.key")
+	template.SystemConfig.Immutability.ModuleSigningCrt = filepath.Join(keyDir, "mok.crt")
+	if err := imagesign.SignKernelModules(installRoot, template); err == nil {
+		t.Error("expected an error for a missing module signing key")
+	}
+	for _, name := range []string{"mok.key", "mok.crt"} {
+		if err := os.WriteFile(filepath.Join(keyDir, name), []byte("test"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	modulesDir := filepath.Join(installRoot, "lib", "modules", "6.8.0-45-generic")
+	plain := []byte("\x7fELF dkms module")
+	writeModule(t, filepath.Join(modulesDir, "updates", "dkms", "wifi.ko"), plain)
+	encoder, _ := zstd.NewWriter(nil)
+	writeModule(t, filepath.Join(modulesDir, "extra", "gpu.ko.zst"), encoder.EncodeAll(plain, nil))
+	encoder.Close()
+	var xzData bytes.Buffer
+	xzWriter, _ := xz.NewWriter(&xzData)
+	xzWriter.Write(plain)
+	xzWriter.Close()
+	writeModule(t, filepath.Join(modulesDir, "extra", "nic.ko.xz"), xzData.Bytes())
+	// In-tree, already signed and other files are left alone
+	writeModule(t, filepath.Join(modulesDir, "kernel", "drivers", "intree.ko"), plain)
+	signed := append(append([]byte{}, plain...), moduleMagic...)
+	writeModule(t, filepath.Join(modulesDir, "updates", "signed.ko"), signed)
+	writeModule(t, filepath.Join(modulesDir, "updates", "dkms", "README"), []byte("readme"))
+
+	shell.Default = &CustomMockExecutor{t: t, mockCommands: []shell.MockCommand{
+		{Pattern: `^openssl cms -sign -binary -noattr -nocerts -nosmimecap -md sha256 -signer \S+/mok\.crt -inkey \S+/mok\.key -in \S+/module\.ko -outform DER -out \S+/module\.p7s$`, Output: ""},
+		{Pattern: ".*", Error: errors.New("unexpected command")},
+	}}
+	if err := imagesign.SignKernelModules(installRoot, template); err != nil {
+		t.Fatalf("SignKernelModules failed: %v", err)
+	}
+
+	module, _ := os.ReadFile(filepath.Join(modulesDir, "updates", "dkms", "wifi.ko"))
+	checkSignedModule(t, "wifi.ko", module, plain)
+	data, _ := os.ReadFile(filepath.Join(modulesDir, "extra", "gpu.ko.zst"))
+	decoder, _ := zstd.NewReader(nil)
+	module, err := decoder.DecodeAll(data, nil)
+	decoder.Close()
+	if err != nil {
+		t.Fatalf("gpu.ko.zst is not zstd compressed: %v", err)
+	}
+	checkSignedModule(t, "gpu.ko.zst", module, plain)
+	data, _ = os.ReadFile(filepath.Join(modulesDir, "extra", "nic.ko.xz"))
+	xzReader, err := xz.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("nic.ko.xz is not xz compressed: %v", err)
+	}
+	var xzModule bytes.Buffer
+	if _, err := xzModule.ReadFrom(xzReader); err != nil {
+		t.Fatal(err)
+	}
+	checkSignedModule(t, "nic.ko.xz", xzModule.Bytes(), plain)
+
+	for name, want := range map[string][]byte{
+		filepath.Join("kernel", "drivers", "intree.ko"): plain,
+		filepath.Join("updates", "signed.ko"):           signed,
+	} {
+		if got, _ := os.ReadFile(filepath.Join(modulesDir, name)); !bytes.Equal(got, want) {
+			t.Errorf("%s must not change", name)
+		}
+	}
+
+	// A module signing key in a PKCS#11 token is used through the pkcs11 engine
+	writeModule(t, filepath.Join(modulesDir, "updates", "dkms", "wifi.ko"), plain)
+	template.SystemConfig.Immutability.ModuleSigningKey = "pkcs11:token=lab;object=mok"
+	shell.Default = &CustomMockExecutor{t: t, mockCommands: []shell.MockCommand{
+		{Pattern: `^openssl pkey -engine pkcs11 -inform engine -in 'pkcs11:token=lab;object=mok' -pubout -out \S+$`, Output: ""},
+		{Pattern: `^openssl cms -sign -binary -noattr -nocerts -nosmimecap -md sha256 -signer \S+/mok\.crt -engine pkcs11 -keyform engine -inkey 'pkcs11:token=lab;object=mok' -in \S+/module\.ko -outform DER -out \S+/module\.p7s$`, Output: ""},
+		{Pattern: ".*", Error: errors.New("unexpected command")},
+	}}
+	if err := imagesign.SignKernelModules(installRoot, template); err != nil {
+		t.Fatalf("SignKernelModules failed: %v", err)
+	}
+	module, _ = os.ReadFile(filepath.Join(modulesDir, "updates", "dkms", "wifi.ko"))
+	checkSignedModule(t, "wifi.ko", module, plain)
+
+	writeModule(t, filepath.Join(modulesDir, "updates", "dkms", "wifi.ko"), plain)
+	template.SystemConfig.Immutability.ModuleSigningKey = filepath.Join(keyDir, "mok.key")
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{{Pattern: ".*", Error: errors.New("openssl failed")}})
+	if err := imagesign.SignKernelModules(installRoot, template); err == nil {
+		t.Error("expected an error when signing fails")
+	}
+}
@@ -0,0 +1,232 @@
+package imageupdate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/artifactsign"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imagedisc"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/security"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+const (
+	// SysupdateDirName is the directory next to the raw image holding the
+	// files of the systemd-sysupdate bundle, to be published at the update URL
+	SysupdateDirName = "sysupdate"
+	// SysupdateTransferDir is where systemd-sysupdate reads the transfers
+	SysupdateTransferDir = "/usr/lib/sysupdate.d"
+	// SysupdatePubring is the keyring systemd-sysupdate verifies the
+	// SHA256SUMS signature with
+	SysupdatePubring = "/etc/systemd/import-pubring.gpg"
+
+	sysupdateSums      = "SHA256SUMS"
+	sysupdateSignature = "SHA256SUMS.gpg"
+	raucManifestFile   = "manifest.raucm"
+	raucUKIClass       = "uki"
+)
+
+// SysupdateUKIName returns the file name of the UKI in the sysupdate bundle.
+func SysupdateUKIName(template *config.ImageTemplate) string {
+	return fmt.Sprintf("%s_%s.efi", template.Image.Name, template.Image.Version)
+}
+
+// SysupdateInstalledUKIName returns the file name systemd-sysupdate gives the
+// UKI on the ESP, with the boot counter.
+func SysupdateInstalledUKIName(template *config.ImageTemplate) string {
+	return fmt.Sprintf("%s_%s+%d-0.efi", template.Image.Name, template.Image.Version, template.BootTries())
+}
+
+// sysupdatePartitionName returns the file name of the image of the slot
+// partition id in the sysupdate bundle.
+func sysupdatePartitionName(template *config.ImageTemplate, id string) string {
+	return fmt.Sprintf("%s_%s_%s.raw", template.Image.Name, template.Image.Version, id)
+}
+
+// SysupdateTransfers returns the systemd-sysupdate transfer files of the
+// image by file name: one per slot partition, written to the free partition
+// of its type, and one installing the UKI to the ESP last, so a new version
+// only becomes bootable once its partitions are complete.
+func SysupdateTransfers(template *config.ImageTemplate) map[string]string {
+	transfers := make(map[string]string)
+	name := template.Image.Name
+	url := strings.TrimSuffix(template.Updates.URL, "/")
+	for i, slot := range template.SlotPartitions() {
+		var b strings.Builder
+		b.WriteString("[Transfer]\nProtectVersion=%A\n\n")
+		b.WriteString("[Source]\nType=url-file\n")
+		fmt.Fprintf(&b, "Path=%s\n", url)
+		fmt.Fprintf(&b, "MatchPattern=%s_@v_%s.raw\n\n", name, slot.ID)
+		b.WriteString("[Target]\nType=partition\nPath=auto\n")
+		fmt.Fprintf(&b, "MatchPattern=%s\n", config.SysupdateLabel(slot.ID, "@v"))
+		fmt.Fprintf(&b, "MatchPartitionType=%s\n", imagedisc.PartitionTypeGUID(slot))
+		b.WriteString("ReadOnly=1\n")
+		transfers[fmt.Sprintf("%d-%s.transfer", 50+i, slot.ID)] = b.String()
+	}
+
+	var b strings.Builder
+	b.WriteString("[Transfer]\nProtectVersion=%A\n\n")
+	b.WriteString("[Source]\nType=url-file\n")
+	fmt.Fprintf(&b, "Path=%s\n", url)
+	fmt.Fprintf(&b, "MatchPattern=%s_@v.efi\n\n", name)
+	b.WriteString("[Target]\nType=regular-file\nPath=/EFI/Linux\nPathRelativeTo=esp\n")
+	fmt.Fprintf(&b, "MatchPattern=%s_@v+@l-@d.efi %s_@v+@l.efi %s_@v.efi\n", name, name, name)
+	b.WriteString("Mode=0444\n")
+	fmt.Fprintf(&b, "TriesLeft=%d\nTriesDone=0\n", template.BootTries())
+	b.WriteString("InstancesMax=2\n")
+	transfers["90-uki.transfer"] = b.String()
+	return transfers
+}
+
+// WriteBundles builds the update bundles selected by the template from the
+// slot B update payload. It runs after WritePayload.
+func WriteBundles(template *config.ImageTemplate) error {
+	if !template.IsABUpdate() || len(template.Updates.Bundles) == 0 {
+		return nil
+	}
+	payloadDir, err := PayloadDir(template)
+	if err != nil {
+		return err
+	}
+	manifest, err := readManifest(payloadDir)
+	if err != nil {
+		return err
+	}
+	if template.HasUpdateBundle(config.UpdateBundleSysupdate) {
+		if err := writeSysupdateBundle(payloadDir, manifest, template); err != nil {
+			return fmt.Errorf("failed to write sysupdate bundle: %w", err)
+		}
+	}
+	if template.HasUpdateBundle(config.UpdateBundleRauc) {
+		if err := writeRaucBundle(payloadDir, manifest, template); err != nil {
+			return fmt.Errorf("failed to write RAUC bundle: %w", err)
+		}
+	}
+	return nil
+}
+
+func readManifest(payloadDir string) (*Manifest, error) {
+	manifestPath := filepath.Join(payloadDir, ManifestFile)
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		log.Errorf("Failed to read update manifest %s: %v", manifestPath, err)
+		return nil, fmt.Errorf("failed to read update manifest %s: %w", manifestPath, err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse update manifest %s: %w", manifestPath, err)
+	}
+	return &manifest, nil
+}
+
+// writeSysupdateBundle lays out the bundle the way systemd-sysupdate reads a
+// url-file source: the versioned partition images and UKI, their SHA256SUMS
+// and its detached OpenPGP signature.
+func writeSysupdateBundle(payloadDir string, manifest *Manifest, template *config.ImageTemplate) error {
+	bundleDir := filepath.Join(filepath.Dir(payloadDir), SysupdateDirName)
+	if err := os.RemoveAll(bundleDir); err != nil {
+		return fmt.Errorf("failed to clean up sysupdate bundle directory %s: %w", bundleDir, err)
+	}
+	if err := os.MkdirAll(bundleDir, 0755); err != nil {
+		return fmt.Errorf("failed to create sysupdate bundle directory %s: %w", bundleDir, err)
+	}
+
+	var sums strings.Builder
+	for _, partition := range manifest.Partitions {
+		name := sysupdatePartitionName(template, partition.ID)
+		// The payload and the bundle share the image build directory
+		if err := os.Link(filepath.Join(payloadDir, partition.File), filepath.Join(bundleDir, name)); err != nil {
+			return fmt.Errorf("failed to add partition image %s: %w", partition.File, err)
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", partition.SHA256, name)
+	}
+
+	// The UKI was built for the bundle while the OS was installed
+	ukiName := SysupdateUKIName(template)
+	ukiPath := filepath.Join(bundleDir, ukiName)
+	if err := os.Rename(filepath.Join(payloadDir, ukiName), ukiPath); err != nil {
+		log.Errorf("Sysupdate UKI missing from the update payload: %v", err)
+		return fmt.Errorf("sysupdate UKI missing from the update payload: %w", err)
+	}
+	uki, err := fileManifest(ukiPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash UKI %s: %w", ukiPath, err)
+	}
+	fmt.Fprintf(&sums, "%s  %s\n", uki.SHA256, ukiName)
+
+	sumsPath := filepath.Join(bundleDir, sysupdateSums)
+	if err := security.SafeWriteFile(sumsPath, []byte(sums.String()), 0644, security.RejectSymlinks); err != nil {
+		log.Errorf("Failed to write %s: %v", sumsPath, err)
+		return fmt.Errorf("failed to write %s: %w", sumsPath, err)
+	}
+	signer, err := artifactsign.NewSigner(artifactsign.MethodGPG, template.Updates.SigningKey, "")
+	if err != nil {
+		return err
+	}
+	sig, err := signer.SignFile(sumsPath)
+	if err != nil {
+		return err
+	}
+	sigPath := filepath.Join(bundleDir, sysupdateSignature)
+	if err := security.SafeWriteFile(sigPath, sig, 0644, security.RejectSymlinks); err != nil {
+		log.Errorf("Failed to write %s: %v", sigPath, err)
+		return fmt.Errorf("failed to write %s: %w", sigPath, err)
+	}
+	log.Infof("Sysupdate bundle written to %s", bundleDir)
+	return nil
+}
+
+// raucManifest returns the RAUC bundle manifest of the payload. The images
+// are named after their slot classes: the slot A partition IDs and "uki".
+func raucManifest(manifest *Manifest, template *config.ImageTemplate) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[update]\ncompatible=%s\nversion=%s\n\n", template.Image.Name, template.Image.Version)
+	b.WriteString("[bundle]\nformat=verity\n")
+	for _, partition := range manifest.Partitions {
+		fmt.Fprintf(&b, "\n[image.%s]\nfilename=%s\n", partition.ID, partition.File)
+	}
+	fmt.Fprintf(&b, "\n[image.%s]\nfilename=%s\n", raucUKIClass, manifest.UKI.File)
+	return b.String()
+}
+
+// writeRaucBundle builds <name>_<version>.raucb next to the raw image from
+// the slot B payload.
+func writeRaucBundle(payloadDir string, manifest *Manifest, template *config.ImageTemplate) error {
+	// The content directory shares the image build directory with the
+	// payload, so the images are linked rather than copied
+	contentDir, err := os.MkdirTemp(filepath.Dir(payloadDir), ".rauc-bundle-*")
+	if err != nil {
+		return fmt.Errorf("failed to create RAUC bundle directory: %w", err)
+	}
+	defer os.RemoveAll(contentDir)
+
+	files := []string{manifest.UKI.File}
+	for _, partition := range manifest.Partitions {
+		files = append(files, partition.File)
+	}
+	for _, name := range files {
+		if err := os.Link(filepath.Join(payloadDir, name), filepath.Join(contentDir, name)); err != nil {
+			return fmt.Errorf("failed to add %s to the RAUC bundle: %w", name, err)
+		}
+	}
+	manifestPath := filepath.Join(contentDir, raucManifestFile)
+	if err := security.SafeWriteFile(manifestPath, []byte(raucManifest(manifest, template)), 0644, security.RejectSymlinks); err != nil {
+		return fmt.Errorf("failed to write RAUC manifest: %w", err)
+	}
+
+	bundlePath := filepath.Join(filepath.Dir(payloadDir), fmt.Sprintf("%s_%s.raucb", template.Image.Name, template.Image.Version))
+	if err := os.Remove(bundlePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove previous RAUC bundle %s: %w", bundlePath, err)
+	}
+	cmd := fmt.Sprintf("rauc bundle --cert=%s --key=%s %s %s", template.Updates.RaucCert, template.Updates.RaucKey, contentDir, bundlePath)
+	if _, err := shell.ExecCmd(cmd, false, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to build RAUC bundle %s: %v", bundlePath, err)
+		return fmt.Errorf("failed to build RAUC bundle %s: %w", bundlePath, err)
+	}
+	log.Infof("RAUC bundle written to %s", bundlePath)
+	return nil
+}
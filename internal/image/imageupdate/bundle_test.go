@@ -0,0 +1,206 @@
+package imageupdate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
+)
+
+func bundleTemplate(bundles ...string) *config.ImageTemplate {
+	return &config.ImageTemplate{
+		Image:        config.ImageInfo{Name: "edge", Version: "1.2.0"},
+		Target:       config.TargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64"},
+		SystemConfig: config.SystemConfig{Name: "ab", Immutability: config.ImmutabilityConfig{Enabled: true}},
+		Disk: config.DiskConfig{Partitions: []config.PartitionInfo{
+			{ID: "boot", MountPoint: "/boot/efi"},
+			{ID: "rootfs", Type: "linux-root-amd64", MountPoint: "/"},
+			{ID: "rootfs-b", Type: "linux-root-amd64"},
+			{ID: "roothash", MountPoint: "none"},
+			{ID: "roothash-b"},
+		}},
+		Updates: config.UpdatesConfig{
+			Scheme:  config.UpdateSchemeAB,
+			Tries:   2,
+			Bundles: bundles,
+			URL:     "https://updates.example.com/edge/",
+		},
+	}
+}
+
+// stagePayload writes the slot B payload WritePayload leaves behind
+func stagePayload(t *testing.T, template *config.ImageTemplate) string {
+	t.Helper()
+	payloadDir, err := PayloadDir(template)
+	if err != nil {
+		t.Fatalf("PayloadDir failed: %v", err)
+	}
+	if err := os.MkdirAll(payloadDir, 0755); err != nil {
+		t.Fatalf("failed to create payload dir: %v", err)
+	}
+	files := map[string]string{
+		"rootfs.img":      "root",
+		"roothash.img":    "hash",
+		"linux-b+2-0.efi": "uki b",
+		"edge_1.2.0.efi":  "uki",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(payloadDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to stage %s: %v", name, err)
+		}
+	}
+	manifest := Manifest{
+		Scheme: config.UpdateSchemeAB,
+		Slot:   SlotB,
+		Tries:  2,
+		UKI:    FileManifest{File: "linux-b+2-0.efi"},
+		Partitions: []PartitionManifest{
+			{ID: "rootfs", Target: "rootfs-b", FileManifest: FileManifest{File: "rootfs.img", SHA256: "aaaa"}},
+			{ID: "roothash", Target: "roothash-b", FileManifest: FileManifest{File: "roothash.img", SHA256: "bbbb"}},
+		},
+	}
+	data, _ := json.Marshal(manifest)
+	if err := os.WriteFile(filepath.Join(payloadDir, ManifestFile), data, 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	return payloadDir
+}
+
+func writeSigningKey(t *testing.T) (string, openpgp.EntityList) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Update Signer", "", "updates@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+	var priv bytes.Buffer
+	w, _ := armor.Encode(&priv, openpgp.PrivateKeyType, nil)
+	if err := entity.SerializePrivateWithoutSigning(w, nil); err != nil {
+		t.Fatalf("failed to serialize private key: %v", err)
+	}
+	w.Close()
+	keyPath := filepath.Join(t.TempDir(), "sysupdate.asc")
+	if err := os.WriteFile(keyPath, priv.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return keyPath, openpgp.EntityList{entity}
+}
+
+func TestSysupdateTransfers(t *testing.T) {
+	template := bundleTemplate(config.UpdateBundleSysupdate)
+	transfers := SysupdateTransfers(template)
+	if len(transfers) != 3 {
+		t.Fatalf("expected two partition transfers and the UKI transfer, got %v", transfers)
+	}
+	root := transfers["50-rootfs.transfer"]
+	for _, expected := range []string{
+		"ProtectVersion=%A",
+		"Path=https://updates.example.com/edge\n",
+		"MatchPattern=edge_@v_rootfs.raw",
+		"MatchPattern=rootfs_@v\n",
+		"MatchPartitionType=4f68bce3-e8cd-4db1-96e7-fbcaf984b709",
+	} {
+		if !strings.Contains(root, expected) {
+			t.Errorf("root transfer does not contain %q:\n%s", expected, root)
+		}
+	}
+	if hash := transfers["51-roothash.transfer"]; !strings.Contains(hash, "MatchPartitionType=0fc63daf-8483-4772-8e79-3d69d8477de4") {
+		t.Errorf("hash transfer must default to the Linux filesystem type:\n%s", hash)
+	}
+	uki := transfers["90-uki.transfer"]
+	for _, expected := range []string{"MatchPattern=edge_@v.efi", "PathRelativeTo=esp", "edge_@v+@l-@d.efi", "TriesLeft=2"} {
+		if !strings.Contains(uki, expected) {
+			t.Errorf("UKI transfer does not contain %q:\n%s", expected, uki)
+		}
+	}
+	if SysupdateInstalledUKIName(template) != "edge_1.2.0+2-0.efi" {
+		t.Errorf("unexpected installed UKI name %s", SysupdateInstalledUKIName(template))
+	}
+}
+
+func TestWriteSysupdateBundle(t *testing.T) {
+	setupWorkDir(t)
+	template := bundleTemplate(config.UpdateBundleSysupdate)
+	var keyring openpgp.EntityList
+	template.Updates.SigningKey, keyring = writeSigningKey(t)
+
+	// The payload must be complete
+	if err := WriteBundles(template); err == nil {
+		t.Fatal("expected an error without the update payload")
+	}
+	payloadDir := stagePayload(t, template)
+	if err := WriteBundles(template); err != nil {
+		t.Fatalf("WriteBundles failed: %v", err)
+	}
+
+	bundleDir := filepath.Join(filepath.Dir(payloadDir), SysupdateDirName)
+	sums, err := os.ReadFile(filepath.Join(bundleDir, "SHA256SUMS"))
+	if err != nil {
+		t.Fatalf("failed to read SHA256SUMS: %v", err)
+	}
+	for _, expected := range []string{"aaaa  edge_1.2.0_rootfs.raw\n", "bbbb  edge_1.2.0_roothash.raw\n", "  edge_1.2.0.efi\n"} {
+		if !strings.Contains(string(sums), expected) {
+			t.Errorf("SHA256SUMS does not contain %q:\n%s", expected, sums)
+		}
+	}
+	for _, name := range []string{"edge_1.2.0_rootfs.raw", "edge_1.2.0_roothash.raw", "edge_1.2.0.efi"} {
+		if _, err := os.Stat(filepath.Join(bundleDir, name)); err != nil {
+			t.Errorf("bundle file %s missing: %v", name, err)
+		}
+	}
+
+	sig, err := os.Open(filepath.Join(bundleDir, "SHA256SUMS.gpg"))
+	if err != nil {
+		t.Fatalf("failed to open signature: %v", err)
+	}
+	defer sig.Close()
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(sums), sig, nil); err != nil {
+		t.Errorf("SHA256SUMS signature does not verify: %v", err)
+	}
+}
+
+func TestWriteRaucBundle(t *testing.T) {
+	setupWorkDir(t)
+	template := bundleTemplate(config.UpdateBundleRauc)
+	template.Updates.RaucKey = "/keys/rauc.key.pem"
+	template.Updates.RaucCert = "/keys/rauc.cert.pem"
+	payloadDir := stagePayload(t, template)
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `rauc bundle --cert=/keys/rauc.cert.pem --key=/keys/rauc.key.pem .*/\.rauc-bundle-\S+ .*/edge_1\.2\.0\.raucb$`, Output: ""},
+		{Pattern: ".*", Error: fmt.Errorf("unexpected command")},
+	})
+	if err := WriteBundles(template); err != nil {
+		t.Fatalf("WriteBundles failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(payloadDir), SysupdateDirName)); !os.IsNotExist(err) {
+		t.Errorf("no sysupdate bundle expected, got %v", err)
+	}
+
+	manifest, err := readManifest(payloadDir)
+	if err != nil {
+		t.Fatalf("readManifest failed: %v", err)
+	}
+	content := raucManifest(manifest, template)
+	for _, expected := range []string{"compatible=edge\nversion=1.2.0", "format=verity", "[image.rootfs]\nfilename=rootfs.img", "[image.uki]\nfilename=linux-b+2-0.efi"} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("RAUC manifest does not contain %q:\n%s", expected, content)
+		}
+	}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: ".*", Error: fmt.Errorf("rauc failed")},
+	})
+	if err := WriteBundles(template); err == nil {
+		t.Error("expected an error when rauc fails")
+	}
+}
@@ -0,0 +1,247 @@
+package imageupdate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageprovenance"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/logger"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/security"
+	"github.com/open-edge-platform/os-image-composer/internal/utils/system"
+)
+
+var log = logger.Logger()
+
+const (
+	// PayloadDirName is the directory next to the raw image holding the
+	// slot B update payload
+	PayloadDirName = "update-b"
+	// ManifestFile describes the payload
+	ManifestFile = "manifest.json"
+
+	// LoaderConfPath is the systemd-boot configuration on the ESP
+	LoaderConfPath = "/loader/loader.conf"
+
+	// SlotA and SlotB name the update slots in the UKI file names
+	SlotA = "a"
+	SlotB = "b"
+
+	sectorSize = 512
+	copyBlock  = 1024 * 1024
+)
+
+// Manifest describes the slot B update payload: the partition images to
+// write to the slot B partitions and the UKI booting them.
+type Manifest struct {
+	Scheme     string              `json:"scheme"`
+	Slot       string              `json:"slot"`
+	Image      string              `json:"image"`
+	Tries      int                 `json:"tries"`
+	Partitions []PartitionManifest `json:"partitions"`
+	UKI        FileManifest        `json:"uki"`
+}
+
+// PartitionManifest is a partition image of the payload
+type PartitionManifest struct {
+	ID       string `json:"id"`       // ID of the slot A partition the image was read from
+	Target   string `json:"target"`   // ID of the slot B partition to write the image to
+	PartUUID string `json:"partUUID"` // GPT unique partition GUID of the target partition
+	FileManifest
+}
+
+// FileManifest is a file of the payload
+type FileManifest struct {
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// UKIName returns the file name of the UKI booting slot. The "+tries-0"
+// suffix is the systemd-boot boot counter: the entry is tried that many
+// times before it is considered bad, systemd-bless-boot drops the suffix
+// once a boot succeeded.
+func UKIName(slot string, tries int) string {
+	return fmt.Sprintf("linux-%s+%d-0.efi", slot, tries)
+}
+
+// LoaderConf returns the systemd-boot configuration of an A/B image. Boot
+// counting sorts bad entries last, so the newest slot that still boots is the
+// default.
+func LoaderConf(template *config.ImageTemplate) string {
+	pattern := "linux-*"
+	if template.HasUpdateBundle(config.UpdateBundleSysupdate) {
+		// systemd-sysupdate installs the UKIs under the image name
+		pattern = template.Image.Name + "_*"
+	}
+	return fmt.Sprintf("timeout 0\ndefault %s\neditor no\n", pattern)
+}
+
+// PayloadDir returns the directory receiving the slot B update payload of the
+// image built from template.
+func PayloadDir(template *config.ImageTemplate) (string, error) {
+	globalWorkDir, err := config.WorkDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get global work directory: %w", err)
+	}
+	providerId := system.GetProviderId(template.Target.OS, template.Target.Dist, template.Target.Arch)
+	return filepath.Join(globalWorkDir, providerId, "imagebuild", template.GetSystemConfigName(), PayloadDirName), nil
+}
+
+// WritePayload completes the slot B update payload of the raw image at
+// imagePath: the content of every slot A partition is copied to an image
+// file next to the slot B UKI staged while the OS was installed, and the
+// manifest lists them with their digests. Slot B is written with exactly the
+// bytes of slot A, so its dm-verity root hash is the one on the command line
+// of the slot B UKI.
+func WritePayload(imagePath string, template *config.ImageTemplate) error {
+	if !template.IsABUpdate() {
+		return nil
+	}
+	payloadDir, err := PayloadDir(template)
+	if err != nil {
+		return err
+	}
+
+	ukiName := UKIName(SlotB, template.BootTries())
+	uki, err := fileManifest(filepath.Join(payloadDir, ukiName))
+	if err != nil {
+		log.Errorf("Slot B UKI missing from the update payload: %v", err)
+		return fmt.Errorf("slot B UKI missing from the update payload: %w", err)
+	}
+
+	image, err := os.Open(imagePath)
+	if err != nil {
+		log.Errorf("Failed to open raw image %s: %v", imagePath, err)
+		return fmt.Errorf("failed to open raw image %s: %w", imagePath, err)
+	}
+	defer image.Close()
+	table, err := gpt.Read(image, sectorSize, sectorSize)
+	if err != nil {
+		log.Errorf("Failed to read GPT of %s: %v", imagePath, err)
+		return fmt.Errorf("failed to read GPT of %s: %w", imagePath, err)
+	}
+
+	manifest := Manifest{
+		Scheme: config.UpdateSchemeAB,
+		Slot:   SlotB,
+		Image:  filepath.Base(imagePath),
+		Tries:  template.BootTries(),
+		UKI:    uki,
+	}
+	for _, slot := range template.SlotPartitions() {
+		source, err := gptPartition(table, template.Disk.Partitions, slot.ID)
+		if err != nil {
+			return err
+		}
+		targetID := config.SlotBID(slot.ID)
+		target, err := gptPartition(table, template.Disk.Partitions, targetID)
+		if err != nil {
+			return err
+		}
+		if partitionBytes(target) < partitionBytes(source) {
+			return fmt.Errorf("slot B partition %s is smaller than %s", targetID, slot.ID)
+		}
+
+		partition := PartitionManifest{ID: slot.ID, Target: targetID, PartUUID: target.GUID}
+		partition.File = slot.ID + ".img"
+		partition.Size = int64(partitionBytes(source))
+		if partition.SHA256, err = extractPartition(image, source, filepath.Join(payloadDir, partition.File)); err != nil {
+			return err
+		}
+		manifest.Partitions = append(manifest.Partitions, partition)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode update manifest: %w", err)
+	}
+	manifestPath := filepath.Join(payloadDir, ManifestFile)
+	if err := security.SafeWriteFile(manifestPath, append(data, '\n'), 0644, security.RejectSymlinks); err != nil {
+		log.Errorf("Failed to write update manifest %s: %v", manifestPath, err)
+		return fmt.Errorf("failed to write update manifest %s: %w", manifestPath, err)
+	}
+	log.Infof("Slot B update payload written to %s", payloadDir)
+	return nil
+}
+
+// gptPartition returns the GPT entry of the partition id. The GPT holds the
+// partitions in the order of the template.
+func gptPartition(table *gpt.Table, partitions []config.PartitionInfo, id string) (*gpt.Partition, error) {
+	for i, partition := range partitions {
+		if partition.ID == id && i < len(table.Partitions) && table.Partitions[i].Start != 0 {
+			return table.Partitions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("partition '%s' not found in the GPT", id)
+}
+
+func partitionBytes(partition *gpt.Partition) uint64 {
+	return (partition.End - partition.Start + 1) * sectorSize
+}
+
+// extractPartition copies the partition from image to a sparse file at path
+// and returns its SHA256 digest.
+func extractPartition(image *os.File, partition *gpt.Partition, path string) (string, error) {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Errorf("Failed to create partition image %s: %v", path, err)
+		return "", fmt.Errorf("failed to create partition image %s: %w", path, err)
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	src := io.NewSectionReader(image, int64(partition.Start*sectorSize), int64(partitionBytes(partition)))
+	buf := make([]byte, copyBlock)
+	var offset int64
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			hash.Write(buf[:n])
+			// Zero blocks are left as holes
+			if !isZero(buf[:n]) {
+				if _, werr := out.WriteAt(buf[:n], offset); werr != nil {
+					return "", fmt.Errorf("failed to write partition image %s: %w", path, werr)
+				}
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read partition at sector %d: %w", partition.Start, err)
+		}
+	}
+	if err := out.Truncate(offset); err != nil {
+		return "", fmt.Errorf("failed to size partition image %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func fileManifest(path string) (FileManifest, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileManifest{}, err
+	}
+	digest, err := imageprovenance.FileSHA256(path)
+	if err != nil {
+		return FileManifest{}, err
+	}
+	return FileManifest{File: filepath.Base(path), Size: info.Size(), SHA256: digest}, nil
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
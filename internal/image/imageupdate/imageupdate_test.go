@@ -0,0 +1,143 @@
+package imageupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/open-edge-platform/os-image-composer/internal/config"
+)
+
+func setupWorkDir(t *testing.T) {
+	t.Helper()
+	original := config.Global()
+	global := config.DefaultGlobalConfig()
+	global.WorkDir = t.TempDir()
+	global.TempDir = t.TempDir()
+	config.SetGlobal(global)
+	t.Cleanup(func() { config.SetGlobal(original) })
+}
+
+func TestUKIName(t *testing.T) {
+	if got := UKIName(SlotA, 3); got != "linux-a+3-0.efi" {
+		t.Errorf("unexpected UKI name %s", got)
+	}
+	template := &config.ImageTemplate{Updates: config.UpdatesConfig{Scheme: config.UpdateSchemeAB}}
+	if !strings.Contains(LoaderConf(template), "default linux-*") {
+		t.Errorf("loader.conf must default to the newest slot: %q", LoaderConf(template))
+	}
+	template.Image.Name = "edge"
+	template.Updates.Bundles = []string{config.UpdateBundleSysupdate}
+	if !strings.Contains(LoaderConf(template), "default edge_*") {
+		t.Errorf("loader.conf must default to the newest sysupdate UKI: %q", LoaderConf(template))
+	}
+}
+
+func TestWritePayload(t *testing.T) {
+	setupWorkDir(t)
+	template := &config.ImageTemplate{
+		Target:       config.TargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64"},
+		SystemConfig: config.SystemConfig{Name: "ab", Immutability: config.ImmutabilityConfig{Enabled: true}},
+		Disk: config.DiskConfig{Partitions: []config.PartitionInfo{
+			{ID: "boot", MountPoint: "/boot/efi"},
+			{ID: "rootfs", MountPoint: "/"},
+			{ID: "rootfs-b"},
+			{ID: "roothashmap", MountPoint: "none"},
+			{ID: "roothashmap-b"},
+		}},
+		Updates: config.UpdatesConfig{Scheme: config.UpdateSchemeAB, Tries: 2},
+	}
+
+	imagePath := filepath.Join(t.TempDir(), "ab-1.0.raw")
+	disk, err := os.Create(imagePath)
+	if err != nil {
+		t.Fatalf("failed to create disk: %v", err)
+	}
+	if err := disk.Truncate(32 * 1024 * 1024); err != nil {
+		t.Fatalf("failed to size disk: %v", err)
+	}
+	table := &gpt.Table{
+		LogicalSectorSize:  sectorSize,
+		PhysicalSectorSize: sectorSize,
+		ProtectiveMBR:      true,
+		Partitions: []*gpt.Partition{
+			{Start: 2048, End: 4095, Type: gpt.EFISystemPartition, Name: "boot"},
+			{Start: 4096, End: 12287, Type: gpt.LinuxFilesystem, Name: "rootfs"},
+			{Start: 12288, End: 20479, Type: gpt.LinuxFilesystem, Name: "rootfs-b", GUID: "4f68bce3-e8cd-4db1-96e7-fbcaf984b709"},
+			{Start: 20480, End: 22527, Type: gpt.LinuxFilesystem, Name: "roothashmap"},
+			{Start: 22528, End: 24575, Type: gpt.LinuxFilesystem, Name: "roothashmap-b"},
+		},
+	}
+	for _, p := range table.Partitions {
+		p.Size = (p.End - p.Start + 1) * sectorSize
+	}
+	if err := table.Write(disk, 32*1024*1024); err != nil {
+		t.Fatalf("failed to write partition table: %v", err)
+	}
+	rootData := []byte("root filesystem")
+	if _, err := disk.WriteAt(rootData, 4096*sectorSize+8192); err != nil {
+		t.Fatalf("failed to write root data: %v", err)
+	}
+	disk.Close()
+
+	// The slot B UKI is missing until the OS is installed
+	if err := WritePayload(imagePath, template); err == nil {
+		t.Fatal("expected an error without the slot B UKI")
+	}
+	payloadDir, err := PayloadDir(template)
+	if err != nil {
+		t.Fatalf("PayloadDir failed: %v", err)
+	}
+	if err := os.MkdirAll(payloadDir, 0755); err != nil {
+		t.Fatalf("failed to create payload dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(payloadDir, "linux-b+2-0.efi"), []byte("uki"), 0644); err != nil {
+		t.Fatalf("failed to stage UKI: %v", err)
+	}
+
+	if err := WritePayload(imagePath, template); err != nil {
+		t.Fatalf("WritePayload failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(payloadDir, ManifestFile))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	if manifest.Slot != SlotB || manifest.Tries != 2 || manifest.Image != "ab-1.0.raw" || manifest.UKI.File != "linux-b+2-0.efi" {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+	if len(manifest.Partitions) != 2 {
+		t.Fatalf("expected root and hash partitions, got %+v", manifest.Partitions)
+	}
+	root := manifest.Partitions[0]
+	if root.ID != "rootfs" || root.Target != "rootfs-b" || root.Size != 8192*sectorSize ||
+		!strings.EqualFold(root.PartUUID, "4f68bce3-e8cd-4db1-96e7-fbcaf984b709") {
+		t.Errorf("unexpected root partition %+v", root)
+	}
+
+	rootImage, err := os.ReadFile(filepath.Join(payloadDir, root.File))
+	if err != nil {
+		t.Fatalf("failed to read root image: %v", err)
+	}
+	if int64(len(rootImage)) != root.Size || !bytes.Equal(rootImage[8192:8192+len(rootData)], rootData) {
+		t.Errorf("root image does not hold the slot A partition")
+	}
+	digest := sha256.Sum256(rootImage)
+	if hex.EncodeToString(digest[:]) != root.SHA256 {
+		t.Errorf("root image digest mismatch")
+	}
+
+	// Images without update slots get no payload
+	if err := WritePayload("/nonexistent.raw", &config.ImageTemplate{}); err != nil {
+		t.Errorf("expected no-op without update scheme, got %v", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/open-edge-platform/os-image-composer/internal/chroot"
 	"github.com/open-edge-platform/os-image-composer/internal/config"
 	"github.com/open-edge-platform/os-image-composer/internal/config/manifest"
+	"github.com/open-edge-platform/os-image-composer/internal/image/artifactsign"
 	"github.com/open-edge-platform/os-image-composer/internal/image/imageos"
 	"github.com/open-edge-platform/os-image-composer/internal/ospackage/debutils"
 	"github.com/open-edge-platform/os-image-composer/internal/ospackage/rpmutils"
@@ -172,6 +173,11 @@ func (initrdMaker *InitrdMaker) BuildInitrdImage() (err error) {
 		// Don't fail the build if SBOM copy fails, just log warning
 	}
 
+	// Sign the final artifacts and SBOMs once they are all in place
+	if err := artifactsign.SignArtifacts(initrdMaker.template, initrdMaker.ImageBuildDir); err != nil {
+		return fmt.Errorf("failed to sign image artifacts: %w", err)
+	}
+
 	initrdMaker.template.FinishPureImageBuildTimer()
 	pureImageBuildDuration := initrdMaker.template.GetPureImageBuildDuration()
 	if pureImageBuildDuration > 0 {
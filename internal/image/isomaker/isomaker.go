@@ -12,6 +12,7 @@ import (
 	"github.com/open-edge-platform/os-image-composer/internal/chroot"
 	"github.com/open-edge-platform/os-image-composer/internal/config"
 	"github.com/open-edge-platform/os-image-composer/internal/config/manifest"
+	"github.com/open-edge-platform/os-image-composer/internal/image/artifactsign"
 	"github.com/open-edge-platform/os-image-composer/internal/image/imageos"
 	"github.com/open-edge-platform/os-image-composer/internal/image/initrdmaker"
 	"github.com/open-edge-platform/os-image-composer/internal/utils/file"
@@ -112,6 +113,11 @@ func (isoMaker *IsoMaker) BuildIsoImage() (err error) {
 		// Don't fail the build if SBOM copy fails, just log warning
 	}
 
+	// Sign the final artifacts and SBOMs once they are all in place
+	if err := artifactsign.SignArtifacts(isoMaker.template, isoMaker.ImageBuildDir); err != nil {
+		return fmt.Errorf("failed to sign image artifacts: %w", err)
+	}
+
 	isoMaker.template.FinishPureImageBuildTimer()
 	pureImageBuildDuration := isoMaker.template.GetPureImageBuildDuration()
 	if pureImageBuildDuration > 0 {
@@ -9,9 +9,11 @@ import (
 	"github.com/open-edge-platform/os-image-composer/internal/chroot"
 	"github.com/open-edge-platform/os-image-composer/internal/config"
 	"github.com/open-edge-platform/os-image-composer/internal/config/manifest"
+	"github.com/open-edge-platform/os-image-composer/internal/image/artifactsign"
 	"github.com/open-edge-platform/os-image-composer/internal/image/imageconvert"
 	"github.com/open-edge-platform/os-image-composer/internal/image/imagedisc"
 	"github.com/open-edge-platform/os-image-composer/internal/image/imageos"
+	"github.com/open-edge-platform/os-image-composer/internal/image/imageupdate"
 	"github.com/open-edge-platform/os-image-composer/internal/utils/logger"
 	"github.com/open-edge-platform/os-image-composer/internal/utils/shell"
 	"github.com/open-edge-platform/os-image-composer/internal/utils/system"
@@ -118,42 +120,44 @@ func (rawMaker *RawMaker) BuildRawImage() error {
 
 	log.Infof("Creating raw image file: %s", imageFile)
 
-	// Create loop device
-	loopDevPath, diskPathIdMap, err := rawMaker.LoopDev.CreateRawImageLoopDev(imageFile, rawMaker.template)
+	var versionInfo string
+	var err error
+	if rawMaker.template.GetDiskConfig().IsLoopless() {
+		versionInfo, err = rawMaker.assembleRawImage(imageFile)
+	} else {
+		versionInfo, err = rawMaker.installLoopDevImage(imageFile)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create loop device: %w", err)
+		return err
 	}
 
-	// Setup cleanup for loop device (always needed)
-	defer func() {
-		if loopDevPath != "" {
-			if detachErr := rawMaker.LoopDev.LoopSetupDelete(loopDevPath); detachErr != nil {
-				log.Errorf("Failed to detach loopback device %s: %v", loopDevPath, detachErr)
-			} else {
-				log.Infof("Successfully detached loopback device: %s", loopDevPath)
-			}
+	if rawMaker.template.GetDiskConfig().Shrink {
+		if err := imagedisc.ShrinkRawImage(imageFile); err != nil {
+			rawMaker.cleanupImageFileOnError(imageFile)
+			return fmt.Errorf("failed to shrink raw image: %w", err)
 		}
-	}()
-
-	log.Infof("Created loop device: %s", loopDevPath)
-
-	// Install OS
-	versionInfo, err := rawMaker.ImageOs.InstallImageOs(diskPathIdMap)
-	if err != nil {
-		// Loop device will be cleaned up by defer
-		// Image file cleanup handled separately if needed
+	}
+	// Rewriting the GPT resets the MBR, so the hybrid MBR is written last
+	if err := imagedisc.WriteHybridMBR(imageFile, rawMaker.template.GetDiskConfig()); err != nil {
 		rawMaker.cleanupImageFileOnError(imageFile)
-		return fmt.Errorf("failed to install OS: %w", err)
+		return fmt.Errorf("failed to write hybrid MBR: %w", err)
 	}
 
-	log.Infof("OS installation completed with version: %s", versionInfo)
-
 	// File renaming
 	finalImagePath, err := rawMaker.renameImageFile(imageFile, imageName, versionInfo)
 	if err != nil {
 		rawMaker.cleanupImageFileOnError(imageFile)
 		return fmt.Errorf("failed to rename image file: %w", err)
 	}
+	// The slot B payload is read from the raw image before conversion
+	if err := imageupdate.WritePayload(finalImagePath, rawMaker.template); err != nil {
+		rawMaker.cleanupImageFileOnError(finalImagePath)
+		return fmt.Errorf("failed to write update payload: %w", err)
+	}
+	if err := imageupdate.WriteBundles(rawMaker.template); err != nil {
+		rawMaker.cleanupImageFileOnError(finalImagePath)
+		return fmt.Errorf("failed to write update bundles: %w", err)
+	}
 	rawMaker.template.FinishPureImageBuildTimer()
 
 	pureImageBuildDuration := rawMaker.template.GetPureImageBuildDuration()
@@ -187,5 +191,94 @@ func (rawMaker *RawMaker) BuildRawImage() error {
 		// Don't fail the build if SBOM copy fails, just log warning
 	}
 
+	// Sign the final artifacts and SBOMs once they are all in place
+	if err := artifactsign.SignArtifacts(rawMaker.template, rawMaker.ImageBuildDir); err != nil {
+		return fmt.Errorf("failed to sign image artifacts: %w", err)
+	}
+
 	return nil
 }
+
+// installLoopDevImage partitions the raw image through a loop device and
+// installs the OS onto its mounted partitions.
+func (rawMaker *RawMaker) installLoopDevImage(imageFile string) (string, error) {
+	// The kernel records access, change and creation times while the
+	// partitions are mounted
+	if rawMaker.template.IsReproducible() {
+		log.Warnf("Reproducible builds only pin identifiers and modification times with the loop device builder; use builder: %s for bit-for-bit identical images",
+			config.DiskBuilderLoopless)
+	}
+
+	// Create loop device
+	loopDevPath, diskPathIdMap, err := rawMaker.LoopDev.CreateRawImageLoopDev(imageFile, rawMaker.template)
+	if err != nil {
+		return "", fmt.Errorf("failed to create loop device: %w", err)
+	}
+
+	// Setup cleanup for loop device (always needed)
+	defer func() {
+		if loopDevPath != "" {
+			// Active logical volumes and open LUKS containers keep the loop
+			// device busy
+			if err := imagedisc.DeactivateVolumeGroups(rawMaker.template); err != nil {
+				log.Warnf("Failed to deactivate volume groups on %s: %v", loopDevPath, err)
+			}
+			if err := imagedisc.CloseEncryptedVolumes(rawMaker.template); err != nil {
+				log.Warnf("Failed to close encrypted volumes on %s: %v", loopDevPath, err)
+			}
+			if detachErr := rawMaker.LoopDev.LoopSetupDelete(loopDevPath); detachErr != nil {
+				log.Errorf("Failed to detach loopback device %s: %v", loopDevPath, detachErr)
+			} else {
+				log.Infof("Successfully detached loopback device: %s", loopDevPath)
+			}
+		}
+	}()
+
+	log.Infof("Created loop device: %s", loopDevPath)
+
+	// Install OS
+	versionInfo, err := rawMaker.ImageOs.InstallImageOs(diskPathIdMap)
+	if err != nil {
+		// Loop device will be cleaned up by defer
+		// Image file cleanup handled separately if needed
+		rawMaker.cleanupImageFileOnError(imageFile)
+		return "", fmt.Errorf("failed to install OS: %w", err)
+	}
+
+	log.Infof("OS installation completed with version: %s", versionInfo)
+
+	// Drop the state recorded while the partitions were mounted
+	if err := imagedisc.NormalizeFilesystems(rawMaker.template, diskPathIdMap); err != nil {
+		rawMaker.cleanupImageFileOnError(imageFile)
+		return "", fmt.Errorf("failed to normalize filesystems: %w", err)
+	}
+
+	return versionInfo, nil
+}
+
+// assembleRawImage installs the OS into the install root, then assembles the
+// raw image from filesystem images built from it, without loop devices.
+func (rawMaker *RawMaker) assembleRawImage(imageFile string) (string, error) {
+	assembler, err := imagedisc.NewDiskAssembler(imageFile, rawMaker.template)
+	if err != nil {
+		return "", fmt.Errorf("failed to lay out raw image: %w", err)
+	}
+	defer func() {
+		if err := assembler.Cleanup(); err != nil {
+			log.Warnf("Failed to clean up partition images: %v", err)
+		}
+	}()
+
+	versionInfo, err := rawMaker.ImageOs.InstallImageOs(assembler.PartitionDevices())
+	if err != nil {
+		return "", fmt.Errorf("failed to install OS: %w", err)
+	}
+
+	log.Infof("OS installation completed with version: %s", versionInfo)
+
+	if err := assembler.Assemble(rawMaker.ImageOs.GetInstallRoot()); err != nil {
+		rawMaker.cleanupImageFileOnError(imageFile)
+		return "", fmt.Errorf("failed to assemble raw image: %w", err)
+	}
+	return versionInfo, nil
+}
@@ -17,7 +17,13 @@ import (
 
 // GenerateSPDXFileName creates a SPDX manifest filename based on repository configuration
 func GenerateSPDXFileName(repoNm string) string {
-	timestamp := time.Now().Format("20060102_150405")
+	return GenerateSPDXFileNameAt(repoNm, time.Now())
+}
+
+// GenerateSPDXFileNameAt returns the SPDX file name stamped with t, so
+// reproducible builds can pin it to SOURCE_DATE_EPOCH.
+func GenerateSPDXFileNameAt(repoNm string, t time.Time) string {
+	timestamp := t.Format("20060102_150405")
 	SPDXFileNm := filepath.Join("spdx_manifest_deb_" + strings.ReplaceAll(repoNm, " ", "_") + "_" + timestamp + ".json")
 	return SPDXFileNm
 }
@@ -62,7 +62,7 @@ func CompressFile(compressPath, outputPath, compressType string, sudo bool) erro
 		cmdStr = fmt.Sprintf("cd %s && %s tar -czf %s %s", dirName, sudoStr, outputPath, fileName)
 		_, err = shell.ExecCmd(cmdStr, false, shell.HostPath, nil)
 	case "gz":
-		cmdStr = fmt.Sprintf("gzip -c %s > %s", compressPath, outputPath)
+		cmdStr = fmt.Sprintf("gzip -n -c %s > %s", compressPath, outputPath)
 		_, err = shell.ExecCmd(cmdStr, sudo, shell.HostPath, nil)
 	case "xz":
 		cmdStr = fmt.Sprintf("xz -z -c %s > %s", compressPath, outputPath)
@@ -256,7 +256,7 @@ func TestCompressFile(t *testing.T) {
 			compressType: "gz",
 			sudo:         false,
 			mockCommands: []shell.MockCommand{
-				{Pattern: "gzip -c /tmp/test/file.txt > /tmp/output/file.gz", Output: "", Error: nil},
+				{Pattern: "gzip -n -c /tmp/test/file.txt > /tmp/output/file.gz", Output: "", Error: nil},
 			},
 			expectError: false,
 		},
@@ -267,7 +267,7 @@ func TestCompressFile(t *testing.T) {
 			compressType: "gz",
 			sudo:         true,
 			mockCommands: []shell.MockCommand{
-				{Pattern: "gzip -c /tmp/test/file.txt > /tmp/output/file.gz", Output: "", Error: nil},
+				{Pattern: "gzip -n -c /tmp/test/file.txt > /tmp/output/file.gz", Output: "", Error: nil},
 			},
 			expectError: false,
 		},
@@ -344,7 +344,7 @@ func TestCompressFile(t *testing.T) {
 			compressType: "gz",
 			sudo:         false,
 			mockCommands: []shell.MockCommand{
-				{Pattern: "gzip -c /tmp/test/file.txt > /tmp/output/file.gz", Output: "", Error: fmt.Errorf("gzip command failed")},
+				{Pattern: "gzip -n -c /tmp/test/file.txt > /tmp/output/file.gz", Output: "", Error: fmt.Errorf("gzip command failed")},
 			},
 			expectError:   true,
 			expectedError: "gzip command failed",
@@ -813,7 +813,7 @@ func TestAllCompressionTypes(t *testing.T) {
 			case "tar.gz":
 				expectedPattern = "tar -czf"
 			case "gz":
-				expectedPattern = "gzip -c"
+				expectedPattern = "gzip -n -c"
 			case "xz":
 				expectedPattern = "xz -z"
 			}
@@ -26,6 +26,7 @@ var commandMap = map[string][]string{
 	"bash":               {"/usr/bin/bash"},
 	"blkid":              {"/usr/sbin/blkid"},
 	"bootctl":            {"/usr/bin/bootctl"},
+	"btrfs":              {"/usr/bin/btrfs", "/usr/sbin/btrfs"},
 	"bunzip2":            {"/usr/bin/bunzip2"},
 	"cat":                {"/bin/cat"},
 	"cd":                 {"cd"}, // 'cd' is a shell builtin, not a standalone command
@@ -41,6 +42,7 @@ var commandMap = map[string][]string{
 	"date":               {"/usr/bin/date"},
 	"dd":                 {"/usr/bin/dd"},
 	"df":                 {"/usr/bin/df"},
+	"du":                 {"/usr/bin/du"},
 	"dirname":            {"/usr/bin/dirname"},
 	"debugfs":            {"/usr/sbin/debugfs", "/usr/bin/debugfs"},
 	"dnf":                {"/usr/bin/dnf"},
@@ -73,12 +75,15 @@ var commandMap = map[string][]string{
 	"lsblk":              {"/usr/bin/lsblk"},
 	"losetup":            {"/usr/sbin/losetup"},
 	"lvcreate":           {"/usr/sbin/lvcreate"},
+	"mdadm":              {"/usr/sbin/mdadm"},
 	"mformat":            {"/usr/bin/mformat"},
 	"mcopy":              {"/usr/bin/mcopy"},
+	"mmd":                {"/usr/bin/mmd"},
 	"mmdebstrap":         {"/usr/bin/mmdebstrap"},
 	"mkdir":              {"/bin/mkdir"},
 	"mkfs":               {"/usr/sbin/mkfs"},
 	"mkswap":             {"/usr/sbin/mkswap"},
+	"mksquashfs":         {"/usr/bin/mksquashfs"},
 	"mktemp":             {"/usr/bin/mktemp"},
 	"mount":              {"/usr/bin/mount"},
 	"opkg":               {"/usr/bin/opkg"},
@@ -113,7 +118,9 @@ var commandMap = map[string][]string{
 	"uname":              {"/usr/bin/uname"},
 	"uniq":               {"/usr/bin/uniq"},
 	"veritysetup":        {"/usr/sbin/veritysetup"},
+	"vgchange":           {"/usr/sbin/vgchange"},
 	"vgcreate":           {"/usr/sbin/vgcreate"},
+	"vgs":                {"/usr/sbin/vgs"},
 	"wget":               {"/usr/bin/wget"},
 	"wipefs":             {"/usr/sbin/wipefs"},
 	"xorriso":            {"/usr/bin/xorriso"},
@@ -123,17 +130,25 @@ var commandMap = map[string][]string{
 	"dracut":             {"/usr/bin/dracut"},
 	"useradd":            {"/usr/sbin/useradd"},
 	"usermod":            {"/usr/sbin/usermod"},
+	"chage":              {"/usr/bin/chage"},
 	"groups":             {"/usr/bin/groups"},
 	"passwd":             {"/usr/bin/passwd"},
 	"mv":                 {"/bin/mv"},
 	"grub-mkimage":       {"/usr/bin/grub-mkimage"},
 	"grub-install":       {"/usr/sbin/grub-install"},
 	"sbsign":             {"/usr/bin/sbsign"},
+	"sbverify":           {"/usr/bin/sbverify"},
+	"rauc":               {"/usr/bin/rauc"},
 	"systemctl":          {"/usr/bin/systemctl"},
 	"test":               {"/bin/test"},
 	"awk":                {"/usr/bin/awk"},
 	"update-initramfs":   {"/usr/sbin/update-initramfs", "/usr/bin/update-initramfs"},
 	"update-grub":        {"/usr/sbin/update-grub", "/usr/bin/update-grub"},
+
+	// Secure Boot key sets
+	"openssl":              {"/usr/bin/openssl"},
+	"cert-to-efi-sig-list": {"/usr/bin/cert-to-efi-sig-list"},
+	"sign-efi-sig-list":    {"/usr/bin/sign-efi-sig-list"},
 	// Add more mappings as needed
 }
 
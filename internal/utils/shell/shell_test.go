@@ -360,3 +360,43 @@ func TestGetFullCmdStr_Env(t *testing.T) {
 		t.Errorf("Expected env var in command, got: %s", fullCmd)
 	}
 }
+
+func TestGetFullCmdStr_UserProvisioningCommands(t *testing.T) {
+	// Every command run while provisioning users must pass the real
+	// commandMap check, mock executors accept any command
+	tempDir := t.TempDir()
+	binaries := map[string]string{
+		"useradd":  "usr/sbin/useradd",
+		"usermod":  "usr/sbin/usermod",
+		"groupadd": "usr/sbin/groupadd",
+		"getent":   "usr/bin/getent",
+		"chage":    "usr/bin/chage",
+	}
+	for _, rel := range binaries {
+		path := filepath.Join(tempDir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte("fake"), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	cmds := map[string]string{
+		"useradd -r -M -s /usr/sbin/nologin -g 990 svc": "/usr/sbin/useradd",
+		"usermod -L root":                "/usr/sbin/usermod",
+		"groupadd -r -g 990 svc":         "/usr/sbin/groupadd",
+		"getent group 990":               "/usr/bin/getent",
+		"chage -M 90 -E 2030-01-31 root": "/usr/bin/chage",
+	}
+	for cmd, fullPath := range cmds {
+		fullCmd, err := shell.GetFullCmdStr(cmd, true, tempDir, nil)
+		if err != nil {
+			t.Errorf("GetFullCmdStr(%q) failed: %v", cmd, err)
+			continue
+		}
+		if !strings.Contains(fullCmd, "chroot "+tempDir+" "+fullPath+" ") {
+			t.Errorf("Expected %s in command, got: %s", fullPath, fullCmd)
+		}
+	}
+}